@@ -569,6 +569,14 @@ func (cc *ContentCreator) Add_BMC(tag core.PdfObjectName) *ContentCreator {
 	return cc
 }
 
+func (cc *ContentCreator) Add_BDC(tag core.PdfObjectName, props core.PdfObject) *ContentCreator {
+	op := ContentStreamOperation{}
+	op.Operand = "BDC"
+	op.Params = []core.PdfObject{core.MakeName(string(tag)), props}
+	cc.operands = append(cc.operands, &op)
+	return cc
+}
+
 func (cc *ContentCreator) Add_EMC() *ContentCreator {
 	op := ContentStreamOperation{}
 	op.Operand = "EMC"
@@ -0,0 +1,116 @@
+package core
+
+import (
+	"container/list"
+
+	"github.com/finalversus/doc/common"
+)
+
+
+type ParserOpts struct {
+	MaxCachedObjects int
+
+	Strict bool
+
+	UseLinearization bool
+
+	Limits Limits
+}
+
+type cacheKey struct {
+	objNum int
+	objStm bool
+}
+
+type objectLRU struct {
+	max     int
+	order   *list.List
+	entries map[cacheKey]*list.Element
+}
+
+func newObjectLRU(max int) *objectLRU {
+	return &objectLRU{
+		max:     max,
+		order:   list.New(),
+		entries: map[cacheKey]*list.Element{},
+	}
+}
+
+
+func (c *objectLRU) touch(key cacheKey) {
+	if e, ok := c.entries[key]; ok {
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.order.PushFront(key)
+}
+
+
+func (c *objectLRU) removeOldest() (cacheKey, bool) {
+	if c.order.Len() <= c.max {
+		return cacheKey{}, false
+	}
+	e := c.order.Back()
+	key := c.order.Remove(e).(cacheKey)
+	delete(c.entries, key)
+	return key, true
+}
+
+func (c *objectLRU) reset() {
+	c.order.Init()
+	c.entries = map[cacheKey]*list.Element{}
+}
+
+
+func (parser *PdfParser) cacheObject(objNum int, obj PdfObject) {
+	parser.ObjCache[objNum] = obj
+	parser.touchCache(cacheKey{objNum: objNum})
+}
+
+
+func (parser *PdfParser) cacheObjectStream(objNum int, objstm objectStream) {
+	parser.objstms[objNum] = objstm
+	parser.touchCache(cacheKey{objNum: objNum, objStm: true})
+}
+
+
+func (parser *PdfParser) touchCache(key cacheKey) {
+	if parser.lru == nil {
+		return
+	}
+	parser.lru.touch(key)
+	for {
+		evicted, ok := parser.lru.removeOldest()
+		if !ok {
+			break
+		}
+		parser.evict(evicted)
+	}
+}
+
+
+func (parser *PdfParser) evict(key cacheKey) {
+	if key.objStm {
+		common.Log.Trace("Evicting object stream %d", key.objNum)
+		delete(parser.objstms, key.objNum)
+		return
+	}
+	obj, ok := parser.ObjCache[key.objNum]
+	if !ok {
+		return
+	}
+	common.Log.Trace("Evicting object %d", key.objNum)
+	delete(parser.ObjCache, key.objNum)
+	if parser.crypter != nil {
+		delete(parser.crypter.decryptedObjects, obj)
+	}
+}
+
+
+func (parser *PdfParser) resetCache() {
+	parser.ObjCache = objectCache{}
+	parser.objstms = objectStreams{}
+	if parser.lru != nil {
+		parser.lru.reset()
+	}
+}
@@ -33,6 +33,26 @@ type XrefTable struct {
 	ObjectMap map[int]XrefObject
 
 	sortedObjects []XrefObject
+
+	free map[int]int
+}
+
+func (x *XrefTable) markFree(objNum, gen int) {
+	if _, inUse := x.ObjectMap[objNum]; inUse {
+		return
+	}
+	if _, ok := x.free[objNum]; ok {
+		return
+	}
+	if x.free == nil {
+		x.free = map[int]int{}
+	}
+	x.free[objNum] = gen
+}
+
+func (x *XrefTable) isFree(objNum, gen int) bool {
+	freeGen, ok := x.free[objNum]
+	return ok && gen < freeGen
 }
 
 type objectStream struct {
@@ -89,6 +109,9 @@ func (parser *PdfParser) lookupObjectViaOS(sobjNumber int, objNum int) (PdfObjec
 		}
 
 		common.Log.Trace("type: %s number of objects: %d", name, *N)
+		if err := parser.checkObjectCount(int(*N)); err != nil {
+			return nil, err
+		}
 		ds, err := DecodeStream(so)
 		if err != nil {
 			return nil, err
@@ -134,8 +157,9 @@ func (parser *PdfParser) lookupObjectViaOS(sobjNumber int, objNum int) (PdfObjec
 		}
 
 		objstm = objectStream{N: int(*N), ds: ds, offsets: offsets}
-		parser.objstms[sobjNumber] = objstm
+		parser.cacheObjectStream(sobjNumber, objstm)
 	} else {
+		parser.touchCache(cacheKey{objNum: sobjNumber, objStm: true})
 
 		bakOffset := parser.GetFileOffset()
 		defer func() { parser.SetFileOffset(bakOffset) }()
@@ -206,10 +230,17 @@ func (parser *PdfParser) lookupByNumber(objNumber int, attemptRepairs bool) (Pdf
 	obj, ok := parser.ObjCache[objNumber]
 	if ok {
 		common.Log.Trace("Returning cached object %d", objNumber)
+		parser.touchCache(cacheKey{objNum: objNumber})
 		return obj, false, nil
 	}
 
 	xref, ok := parser.xrefs.ObjectMap[objNumber]
+	if !ok && parser.deferredXrefs {
+		if err := parser.loadDeferredXrefs(); err != nil {
+			return nil, false, err
+		}
+		xref, ok = parser.xrefs.ObjectMap[objNumber]
+	}
 	if !ok {
 
 		common.Log.Trace("Unable to locate object in xrefs! - Returning null object")
@@ -229,8 +260,14 @@ func (parser *PdfParser) lookupByNumber(objNumber int, attemptRepairs bool) (Pdf
 		obj, err := parser.ParseIndirectObject()
 		if err != nil {
 			common.Log.Debug("ERROR Failed reading xref (%s)", err)
+			if isFatalError(err) {
+				return nil, false, err
+			}
 
 			if attemptRepairs {
+				if derr := parser.diagnose(DiagnosticXrefEntry, xref.Offset, "failed reading object %d: %v", objNumber, err); derr != nil {
+					return nil, false, derr
+				}
 				common.Log.Debug("Attempting to repair xrefs (top down)")
 				xrefTable, err := parser.repairRebuildXrefsTopDown()
 				if err != nil {
@@ -248,19 +285,22 @@ func (parser *PdfParser) lookupByNumber(objNumber int, attemptRepairs bool) (Pdf
 			realObjNum, _, _ := getObjectNumber(obj)
 			if int(realObjNum) != objNumber {
 				common.Log.Debug("Invalid xrefs: Rebuilding")
+				if err := parser.diagnose(DiagnosticXrefEntry, xref.Offset, "xref entry of object %d points to object %d", objNumber, realObjNum); err != nil {
+					return nil, false, err
+				}
 				err := parser.rebuildXrefTable()
 				if err != nil {
 					return nil, false, err
 				}
 
-				parser.ObjCache = objectCache{}
+				parser.resetCache()
 
 				return parser.lookupByNumberWrapper(objNumber, false)
 			}
 		}
 
 		common.Log.Trace("Returning obj")
-		parser.ObjCache[objNumber] = obj
+		parser.cacheObject(objNumber, obj)
 		return obj, false, nil
 	} else if xref.XType == XrefTypeObjectStream {
 		common.Log.Trace("xref from object stream!")
@@ -272,6 +312,11 @@ func (parser *PdfParser) lookupByNumber(objNumber int, attemptRepairs bool) (Pdf
 			return nil, true, errors.New("xref circular reference")
 		}
 
+		if _, exists := parser.xrefs.ObjectMap[xref.OsObjNumber]; !exists && parser.deferredXrefs {
+			if err := parser.loadDeferredXrefs(); err != nil {
+				return nil, true, err
+			}
+		}
 		if _, exists := parser.xrefs.ObjectMap[xref.OsObjNumber]; exists {
 			optr, err := parser.lookupObjectViaOS(xref.OsObjNumber, objNumber)
 			if err != nil {
@@ -279,11 +324,11 @@ func (parser *PdfParser) lookupByNumber(objNumber int, attemptRepairs bool) (Pdf
 				return nil, true, err
 			}
 			common.Log.Trace("<Loaded via OS")
-			parser.ObjCache[objNumber] = optr
 			if parser.crypter != nil {
 
 				parser.crypter.decryptedObjects[optr] = true
 			}
+			parser.cacheObject(objNumber, optr)
 			return optr, true, nil
 		}
 
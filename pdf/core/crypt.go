@@ -1,8 +1,10 @@
 package core
 
 import (
+	gocrypto "crypto"
 	"crypto/md5"
 	"crypto/rand"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"time"
@@ -20,7 +22,17 @@ type EncryptInfo struct {
 	ID0, ID1 string
 }
 
+type CryptOpts struct {
+	UnencryptedMetadata bool
+
+	EmbeddedFilesOnly bool
+}
+
 func PdfCryptNewEncrypt(cf crypto.Filter, userPass, ownerPass []byte, perm security.Permissions) (*PdfCrypt, *EncryptInfo, error) {
+	return PdfCryptNewEncryptOpts(cf, userPass, ownerPass, perm, nil)
+}
+
+func PdfCryptNewEncryptOpts(cf crypto.Filter, userPass, ownerPass []byte, perm security.Permissions, opts *CryptOpts) (*PdfCrypt, *EncryptInfo, error) {
 	crypter := &PdfCrypt{
 		encryptedObjects: make(map[PdfObject]bool),
 		cryptFilters:     make(cryptFilters),
@@ -48,17 +60,12 @@ func PdfCryptNewEncrypt(cf crypto.Filter, userPass, ownerPass []byte, perm secur
 		crypter.streamFilter = defaultFilter
 		crypter.stringFilter = defaultFilter
 	}
+	if err := crypter.applyOpts(opts, defaultFilter); err != nil {
+		return nil, nil, err
+	}
 	ed := crypter.newEncryptDict()
 
-	hashcode := md5.Sum([]byte(time.Now().Format(time.RFC850)))
-	id0 := string(hashcode[:])
-	b := make([]byte, 100)
-	rand.Read(b)
-	hashcode = md5.Sum(b)
-	id1 := string(hashcode[:])
-	common.Log.Trace("Random b: % x", b)
-
-	common.Log.Trace("Gen Id 0: % x", id0)
+	id0, id1 := generateIDs()
 
 	crypter.id0 = string(id0)
 
@@ -81,9 +88,125 @@ func PdfCryptNewEncrypt(cf crypto.Filter, userPass, ownerPass []byte, perm secur
 	}, nil
 }
 
+func PdfCryptNewEncryptPubKey(cf crypto.Filter, recipients []security.PubKeyRecipient, opts *CryptOpts) (*PdfCrypt, *EncryptInfo, error) {
+	if cf == nil {
+		return nil, nil, errors.New("crypt filter required")
+	}
+	crypter := &PdfCrypt{
+		encryptedObjects: make(map[PdfObject]bool),
+		cryptFilters:     make(cryptFilters),
+		encryptStd: security.StdEncryptDict{
+			P:               security.PermOwner,
+			EncryptMetadata: true,
+		},
+		encryptPubKey: security.PubKeyEncryptDict{
+			EncryptMetadata: true,
+		},
+	}
+	crypter.encrypt.Filter = pubKeyFilter
+
+	var vers Version
+	v := cf.PDFVersion()
+	vers.Major, vers.Minor = v[0], v[1]
+
+	V, R := cf.HandlerVersion()
+	crypter.encrypt.V = V
+	crypter.encryptStd.R = R
+	crypter.encrypt.Length = cf.KeyLength() * 8
+
+	filterName := stdCryptFilter
+	crypter.encryptPubKey.SubFilter = security.SubFilterPKCS7S4
+	if V >= 4 {
+		filterName = pubKeyCryptFilter
+		crypter.encryptPubKey.SubFilter = security.SubFilterPKCS7S5
+		crypter.streamFilter = filterName
+		crypter.stringFilter = filterName
+		if vers.Major == 1 && vers.Minor < 5 {
+			vers.Minor = 5
+		}
+	} else if vers.Major == 1 && vers.Minor < 4 {
+		vers.Major, vers.Minor = 1, 4
+	}
+	crypter.cryptFilters[filterName] = cf
+	crypter.encrypt.SubFilter = crypter.encryptPubKey.SubFilter
+	if err := crypter.applyOpts(opts, filterName); err != nil {
+		return nil, nil, err
+	}
+	crypter.encryptPubKey.EncryptMetadata = crypter.encryptStd.EncryptMetadata
+
+	id0, id1 := generateIDs()
+	crypter.id0 = id0
+
+	h := security.NewPubKeyHandler(cf.KeyLength())
+	ekey, err := h.GenerateParams(&crypter.encryptPubKey, recipients)
+	if err != nil {
+		return nil, nil, err
+	}
+	crypter.encryptionKey = ekey
+
+	ed := crypter.newEncryptDict()
+	ed.Set("SubFilter", MakeName(crypter.encryptPubKey.SubFilter))
+	recps := MakeArray()
+	for _, r := range crypter.encryptPubKey.Recipients {
+		recps.Append(MakeStringFromBytes(r))
+	}
+	if V >= 4 {
+		if err := crypter.saveCryptFilters(ed); err != nil {
+			return nil, nil, err
+		}
+		if cfd, ok := GetDict(ed.Get("CF")); ok {
+			if fd, ok := GetDict(cfd.Get(PdfObjectName(filterName))); ok {
+				fd.Set("Recipients", recps)
+				fd.Set("EncryptMetadata", MakeBool(crypter.encryptPubKey.EncryptMetadata))
+			}
+		}
+	} else {
+		ed.Set("Recipients", recps)
+	}
+
+	return crypter, &EncryptInfo{
+		Version: vers,
+		Encrypt: ed,
+		ID0:     id0, ID1: id1,
+	}, nil
+}
+
+func (crypt *PdfCrypt) applyOpts(opts *CryptOpts, filter string) error {
+	if opts == nil {
+		return nil
+	}
+	if (opts.UnencryptedMetadata || opts.EmbeddedFilesOnly) && crypt.encrypt.V < 4 {
+		return errors.New("crypt options require crypt filters (V>=4)")
+	}
+	if opts.UnencryptedMetadata {
+		crypt.encryptStd.EncryptMetadata = false
+	}
+	if opts.EmbeddedFilesOnly {
+		crypt.cryptFilters["Identity"] = crypto.NewIdentity()
+		crypt.streamFilter = "Identity"
+		crypt.stringFilter = "Identity"
+		crypt.encrypt.EFF = filter
+	}
+	return nil
+}
+
+func generateIDs() (string, string) {
+	hashcode := md5.Sum([]byte(time.Now().Format(time.RFC850)))
+	id0 := string(hashcode[:])
+	b := make([]byte, 100)
+	rand.Read(b)
+	hashcode = md5.Sum(b)
+	id1 := string(hashcode[:])
+	common.Log.Trace("Random b: % x", b)
+
+	common.Log.Trace("Gen Id 0: % x", id0)
+	return id0, id1
+}
+
 type PdfCrypt struct {
-	encrypt    encryptDict
-	encryptStd security.StdEncryptDict
+	encrypt       encryptDict
+	encryptStd    security.StdEncryptDict
+	encryptPubKey security.PubKeyEncryptDict
 
 	id0              string
 	encryptionKey    []byte
@@ -106,6 +229,9 @@ func encodeEncryptStd(d *security.StdEncryptDict, ed *PdfObjectDictionary) {
 
 	ed.Set("O", MakeStringFromBytes(d.O))
 	ed.Set("U", MakeStringFromBytes(d.U))
+	if d.R == 4 && !d.EncryptMetadata {
+		ed.Set("EncryptMetadata", MakeBool(d.EncryptMetadata))
+	}
 	if d.R >= 5 {
 		ed.Set("OE", MakeStringFromBytes(d.OE))
 		ed.Set("UE", MakeStringFromBytes(d.UE))
@@ -228,8 +354,12 @@ func decodeCryptFilter(cf *crypto.FilterDict, d *PdfObjectDictionary) error {
 
 func (crypt *PdfCrypt) newEncryptDict() *PdfObjectDictionary {
 
+	filter := crypt.encrypt.Filter
+	if filter == "" {
+		filter = standardFilter
+	}
 	ed := MakeDict()
-	ed.Set("Filter", MakeName("Standard"))
+	ed.Set("Filter", MakeName(filter))
 	ed.Set("V", MakeInteger(int64(crypt.encrypt.V)))
 	ed.Set("Length", MakeInteger(int64(crypt.encrypt.Length)))
 	return ed
@@ -280,6 +410,14 @@ type encryptDict struct {
 
 const stdCryptFilter = "StdCF"
 
+const pubKeyCryptFilter = "DefaultCryptFilter"
+
+const (
+	standardFilter = "Standard"
+
+	pubKeyFilter = "Adobe.PubSec"
+)
+
 func newCryptFiltersV2(length int) cryptFilters {
 	return cryptFilters{
 		stdCryptFilter: crypto.NewFilterV2(length),
@@ -359,6 +497,14 @@ func (crypt *PdfCrypt) loadCryptFilters(ed *PdfObjectDictionary) error {
 		crypt.streamFilter = string(*stmf)
 	}
 
+	crypt.encrypt.EFF = ""
+	if eff, ok := ed.Get("EFF").(*PdfObjectName); ok {
+		if _, exists := crypt.cryptFilters[string(*eff)]; !exists {
+			return fmt.Errorf("crypt filter for EFF not specified in CF dictionary (%s)", *eff)
+		}
+		crypt.encrypt.EFF = string(*eff)
+	}
+
 	return nil
 }
 
@@ -385,11 +531,18 @@ func (crypt *PdfCrypt) saveCryptFilters(ed *PdfObjectDictionary) error {
 		if name == "Identity" {
 			continue
 		}
-		v := encodeCryptFilter(filter, "")
+		event := security.EventDocOpen
+		if name == crypt.encrypt.EFF && name != crypt.streamFilter && name != crypt.stringFilter {
+			event = security.EventEFOpen
+		}
+		v := encodeCryptFilter(filter, event)
 		cf.Set(PdfObjectName(name), v)
 	}
 	ed.Set("StrF", MakeName(crypt.stringFilter))
 	ed.Set("StmF", MakeName(crypt.streamFilter))
+	if crypt.encrypt.EFF != "" && crypt.encrypt.EFF != crypt.streamFilter {
+		ed.Set("EFF", MakeName(crypt.encrypt.EFF))
+	}
 	return nil
 }
 
@@ -407,13 +560,17 @@ func PdfCryptNewDecrypt(parser *PdfParser, ed, trailer *PdfObjectDictionary) (*P
 		common.Log.Debug("ERROR Crypt dictionary missing required Filter field!")
 		return crypter, errors.New("required crypt field Filter missing")
 	}
-	if *filter != "Standard" {
+	if *filter != standardFilter && *filter != pubKeyFilter {
 		common.Log.Debug("ERROR Unsupported filter (%s)", *filter)
 		return crypter, errors.New("unsupported Filter")
 	}
 	crypter.encrypt.Filter = string(*filter)
 
-	if subfilter, ok := ed.Get("SubFilter").(*PdfObjectString); ok {
+	switch subfilter := ed.Get("SubFilter").(type) {
+	case *PdfObjectName:
+		crypter.encrypt.SubFilter = string(*subfilter)
+		common.Log.Debug("Using subfilter %s", subfilter)
+	case *PdfObjectString:
 		crypter.encrypt.SubFilter = subfilter.Str()
 		common.Log.Debug("Using subfilter %s", subfilter)
 	}
@@ -445,7 +602,11 @@ func PdfCryptNewDecrypt(parser *PdfParser, ed, trailer *PdfObjectDictionary) (*P
 		}
 	}
 
-	if err := decodeEncryptStd(&crypter.encryptStd, ed); err != nil {
+	if crypter.isPubKey() {
+		if err := crypter.decodeEncryptPubKey(ed); err != nil {
+			return crypter, err
+		}
+	} else if err := decodeEncryptStd(&crypter.encryptStd, ed); err != nil {
 		return crypter, err
 	}
 
@@ -464,6 +625,135 @@ func PdfCryptNewDecrypt(parser *PdfParser, ed, trailer *PdfObjectDictionary) (*P
 	return crypter, nil
 }
 
+func (crypt *PdfCrypt) isPubKey() bool {
+	return crypt.encrypt.Filter == pubKeyFilter
+}
+
+func (crypt *PdfCrypt) decodeEncryptPubKey(ed *PdfObjectDictionary) error {
+	d := &crypt.encryptPubKey
+	d.SubFilter = crypt.encrypt.SubFilter
+	switch d.SubFilter {
+	case security.SubFilterPKCS7S3, security.SubFilterPKCS7S4, security.SubFilterPKCS7S5:
+	default:
+		common.Log.Debug("ERROR Unsupported public-key SubFilter (%s)", d.SubFilter)
+		return fmt.Errorf("unsupported public-key SubFilter (%s)", d.SubFilter)
+	}
+
+	d.EncryptMetadata = true
+	if em, ok := ed.Get("EncryptMetadata").(*PdfObjectBool); ok {
+		d.EncryptMetadata = bool(*em)
+	}
+	recipients := ed.Get("Recipients")
+
+	if crypt.encrypt.V >= 4 {
+		filter := crypt.defaultFilter()
+		cf, err := crypt.resolveDict(ed.Get("CF"))
+		if err != nil {
+			return err
+		}
+		if cf != nil {
+			fd, err := crypt.resolveDict(cf.Get(PdfObjectName(filter)))
+			if err != nil {
+				return err
+			}
+			if fd != nil {
+				if r := fd.Get("Recipients"); r != nil {
+					recipients = r
+				}
+				if em, ok := fd.Get("EncryptMetadata").(*PdfObjectBool); ok {
+					d.EncryptMetadata = bool(*em)
+				}
+			}
+		}
+	}
+
+	obj, err := crypt.resolve(recipients)
+	if err != nil {
+		return err
+	}
+	d.Recipients = nil
+	switch t := obj.(type) {
+	case *PdfObjectString:
+		d.Recipients = append(d.Recipients, t.Bytes())
+	case *PdfObjectArray:
+		for _, o := range t.Elements() {
+			o, err := crypt.resolve(o)
+			if err != nil {
+				return err
+			}
+			str, ok := o.(*PdfObjectString)
+			if !ok {
+				return fmt.Errorf("invalid recipient type: %T", o)
+			}
+			d.Recipients = append(d.Recipients, str.Bytes())
+		}
+	}
+	if len(d.Recipients) == 0 {
+		return errors.New("encrypt dictionary missing Recipients")
+	}
+	crypt.encryptStd.EncryptMetadata = d.EncryptMetadata
+	return nil
+}
+
+func (crypt *PdfCrypt) resolve(obj PdfObject) (PdfObject, error) {
+	obj = TraceToDirectObject(obj)
+	if ref, isRef := obj.(*PdfObjectReference); isRef {
+		o, err := crypt.parser.LookupByReference(*ref)
+		if err != nil {
+			return nil, err
+		}
+		obj = TraceToDirectObject(o)
+	}
+	return obj, nil
+}
+
+func (crypt *PdfCrypt) resolveDict(obj PdfObject) (*PdfObjectDictionary, error) {
+	obj, err := crypt.resolve(obj)
+	if err != nil {
+		return nil, err
+	}
+	dict, _ := obj.(*PdfObjectDictionary)
+	return dict, nil
+}
+
+func (crypt *PdfCrypt) defaultFilter() string {
+	for _, name := range []string{crypt.streamFilter, crypt.stringFilter, crypt.encrypt.EFF} {
+		if name != "" && name != "Identity" {
+			return name
+		}
+	}
+	return "Identity"
+}
+
+func (crypt *PdfCrypt) pubKeyHandler() security.PubKeyHandler {
+	length := crypt.encrypt.Length / 8
+	if crypt.encrypt.V >= 4 {
+		filter := crypt.defaultFilter()
+		if f, ok := crypt.cryptFilters[filter]; ok && f.KeyLength() > 0 {
+			length = f.KeyLength()
+		}
+	}
+	return security.NewPubKeyHandler(length)
+}
+
+func (crypt *PdfCrypt) authenticateCertificate(cert *x509.Certificate, key gocrypto.PrivateKey) (bool, error) {
+	crypt.authenticated = false
+	if !crypt.isPubKey() {
+		return false, errors.New("document is not encrypted with a public-key security handler")
+	}
+	h := crypt.pubKeyHandler()
+	fkey, perm, err := h.Authenticate(&crypt.encryptPubKey, cert, key)
+	if err != nil {
+		return false, err
+	} else if len(fkey) == 0 {
+		return false, nil
+	}
+	crypt.authenticated = true
+	crypt.encryptionKey = fkey
+	crypt.encryptStd.P = perm
+	return true, nil
+}
+
 func (crypt *PdfCrypt) GetAccessPermissions() security.Permissions {
 	return crypt.encryptStd.P
 }
@@ -477,6 +767,10 @@ func (crypt *PdfCrypt) securityHandler() security.StdHandler {
 
 func (crypt *PdfCrypt) authenticate(password []byte) (bool, error) {
 	crypt.authenticated = false
+	if crypt.isPubKey() {
+		common.Log.Debug("Public-key security handler requires a certificate for decryption")
+		return false, nil
+	}
 	h := crypt.securityHandler()
 	fkey, perm, err := h.Authenticate(&crypt.encryptStd, password)
 	if err != nil {
@@ -490,6 +784,9 @@ func (crypt *PdfCrypt) authenticate(password []byte) (bool, error) {
 }
 
 func (crypt *PdfCrypt) checkAccessRights(password []byte) (bool, security.Permissions, error) {
+	if crypt.isPubKey() {
+		return false, 0, nil
+	}
 	h := crypt.securityHandler()
 
 	fkey, perm, err := h.Authenticate(&crypt.encryptStd, password)
@@ -513,6 +810,18 @@ var encryptDictKeys = []PdfObjectName{
 	"V", "R", "O", "U", "P",
 }
 
+func (crypt *PdfCrypt) clone(parser *PdfParser) *PdfCrypt {
+	c := *crypt
+	c.parser = parser
+	c.decryptedObjects = make(map[PdfObject]bool)
+	c.encryptedObjects = make(map[PdfObject]bool)
+	c.decryptedObjNum = make(map[int]struct{}, len(crypt.decryptedObjNum))
+	for objNum := range crypt.decryptedObjNum {
+		c.decryptedObjNum[objNum] = struct{}{}
+	}
+	return &c
+}
+
 func (crypt *PdfCrypt) isDecrypted(obj PdfObject) bool {
 	_, ok := crypt.decryptedObjects[obj]
 	if ok {
@@ -595,27 +904,8 @@ func (crypt *PdfCrypt) Decrypt(obj PdfObject, parentObjNum, parentGenNum int64)
 
 		streamFilter := stdCryptFilter
 		if crypt.encrypt.V >= 4 {
-			streamFilter = crypt.streamFilter
-			common.Log.Trace("this.streamFilter = %s", crypt.streamFilter)
-
-			if filters, ok := dict.Get("Filter").(*PdfObjectArray); ok {
-
-				if firstFilter, ok := GetName(filters.Get(0)); ok {
-					if *firstFilter == "Crypt" {
-
-						streamFilter = "Identity"
-
-						if decodeParams, ok := dict.Get("DecodeParms").(*PdfObjectDictionary); ok {
-							if filterName, ok := decodeParams.Get("Name").(*PdfObjectName); ok {
-								if _, ok := crypt.cryptFilters[string(*filterName)]; ok {
-									common.Log.Trace("Using stream filter %s", *filterName)
-									streamFilter = string(*filterName)
-								}
-							}
-						}
-					}
-				}
-			}
+			streamFilter = crypt.streamCryptFilter(dict)
+			removeCryptFilter(dict)
 
 			common.Log.Trace("with %s filter", streamFilter)
 			if streamFilter == "Identity" {
@@ -711,6 +1001,84 @@ func (crypt *PdfCrypt) Decrypt(obj PdfObject, parentObjNum, parentGenNum int64)
 	return nil
 }
 
+func (crypt *PdfCrypt) streamCryptFilter(dict *PdfObjectDictionary) string {
+	if params, ok := getCryptFilterParams(dict); ok {
+		if params != nil {
+			if name, ok := GetName(params.Get("Name")); ok {
+				if _, ok := crypt.cryptFilters[string(*name)]; ok {
+					common.Log.Trace("Using stream filter %s", *name)
+					return string(*name)
+				}
+				common.Log.Debug("Unknown crypt filter %s - assuming Identity", *name)
+			}
+		}
+		return "Identity"
+	}
+
+	if typ, ok := GetName(dict.Get("Type")); ok {
+		switch *typ {
+		case "Metadata":
+			if !crypt.encryptStd.EncryptMetadata {
+				return "Identity"
+			}
+		case "EmbeddedFile":
+			if crypt.encrypt.EFF != "" {
+				return crypt.encrypt.EFF
+			}
+		}
+	}
+	common.Log.Trace("this.streamFilter = %s", crypt.streamFilter)
+	return crypt.streamFilter
+}
+
+func getCryptFilterParams(dict *PdfObjectDictionary) (*PdfObjectDictionary, bool) {
+	var first PdfObject
+	switch filter := TraceToDirectObject(dict.Get("Filter")).(type) {
+	case *PdfObjectName:
+		first = filter
+	case *PdfObjectArray:
+		first = TraceToDirectObject(filter.Get(0))
+	}
+	if name, ok := first.(*PdfObjectName); !ok || *name != "Crypt" {
+		return nil, false
+	}
+
+	switch params := TraceToDirectObject(dict.Get("DecodeParms")).(type) {
+	case *PdfObjectDictionary:
+		return params, true
+	case *PdfObjectArray:
+		params0, _ := GetDict(params.Get(0))
+		return params0, true
+	}
+	return nil, true
+}
+
+func removeCryptFilter(dict *PdfObjectDictionary) {
+	if _, ok := getCryptFilterParams(dict); !ok {
+		return
+	}
+	filters, ok := GetArray(dict.Get("Filter"))
+	if !ok || filters.Len() <= 1 {
+		dict.Remove("Filter")
+		dict.Remove("DecodeParms")
+		return
+	}
+	dict.Set("Filter", MakeArray(filters.Elements()[1:]...))
+
+	switch params := TraceToDirectObject(dict.Get("DecodeParms")).(type) {
+	case *PdfObjectArray:
+		if params.Len() > 1 {
+			dict.Set("DecodeParms", MakeArray(params.Elements()[1:]...))
+		} else {
+			dict.Remove("DecodeParms")
+		}
+	case *PdfObjectDictionary:
+		if _, ok := params.Get("Name").(*PdfObjectName); ok {
+			dict.Remove("DecodeParms")
+		}
+	}
+}
+
 func (crypt *PdfCrypt) isEncrypted(obj PdfObject) bool {
 	_, ok := crypt.encryptedObjects[obj]
 	if ok {
@@ -763,28 +1131,7 @@ func (crypt *PdfCrypt) Encrypt(obj PdfObject, parentObjNum, parentGenNum int64)
 
 		streamFilter := stdCryptFilter
 		if crypt.encrypt.V >= 4 {
-
-			streamFilter = crypt.streamFilter
-			common.Log.Trace("this.streamFilter = %s", crypt.streamFilter)
-
-			if filters, ok := dict.Get("Filter").(*PdfObjectArray); ok {
-
-				if firstFilter, ok := GetName(filters.Get(0)); ok {
-					if *firstFilter == "Crypt" {
-
-						streamFilter = "Identity"
-
-						if decodeParams, ok := dict.Get("DecodeParms").(*PdfObjectDictionary); ok {
-							if filterName, ok := decodeParams.Get("Name").(*PdfObjectName); ok {
-								if _, ok := crypt.cryptFilters[string(*filterName)]; ok {
-									common.Log.Trace("Using stream filter %s", *filterName)
-									streamFilter = string(*filterName)
-								}
-							}
-						}
-					}
-				}
-			}
+			streamFilter = crypt.streamCryptFilter(dict)
 
 			common.Log.Trace("with %s filter", streamFilter)
 			if streamFilter == "Identity" {
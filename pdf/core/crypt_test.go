@@ -1,10 +1,14 @@
 package core
 
 import (
+	"bytes"
 	"testing"
 
+	"github.com/stretchr/testify/require"
+
 	"github.com/finalversus/doc/common"
 	"github.com/finalversus/doc/pdf/core/security"
+	crypto "github.com/finalversus/doc/pdf/core/security/crypt"
 )
 
 func init() {
@@ -86,3 +90,93 @@ func TestDecryption1(t *testing.T) {
 		return
 	}
 }
+
+func TestCryptFilterOptions(t *testing.T) {
+	plain := []byte("stream data which is encrypted unless excluded by the crypt filter options")
+
+	cases := []struct {
+		name string
+		opts *CryptOpts
+
+		normal, metadata, embedded bool
+	}{
+		{name: "default", opts: nil, normal: true, metadata: true, embedded: true},
+		{name: "metadata", opts: &CryptOpts{UnencryptedMetadata: true}, normal: true, metadata: false, embedded: true},
+		{name: "attachments", opts: &CryptOpts{EmbeddedFilesOnly: true}, normal: false, metadata: false, embedded: true},
+	}
+
+	for _, c := range cases {
+		for _, cf := range []crypto.Filter{crypto.NewFilterAESV2(), crypto.NewFilterAESV3()} {
+			crypter, info, err := PdfCryptNewEncryptOpts(cf, []byte("user"), []byte("owner"), security.PermOwner, c.opts)
+			require.NoError(t, err)
+
+			makeStream := func(num int64, typ string) *PdfObjectStream {
+				dict := MakeDict()
+				if typ != "" {
+					dict.Set("Type", MakeName(typ))
+				}
+				return &PdfObjectStream{
+					PdfObjectReference:  PdfObjectReference{ObjectNumber: num},
+					PdfObjectDictionary: dict,
+					Stream:              append([]byte{}, plain...),
+				}
+			}
+			normal := makeStream(1, "")
+			metadata := makeStream(2, "Metadata")
+			embedded := makeStream(3, "EmbeddedFile")
+			identity := makeStream(4, "")
+			identity.Set("Filter", MakeArray(MakeName("Crypt")))
+			params := MakeDict()
+			params.Set("Type", MakeName("CryptFilterDecodeParms"))
+			params.Set("Name", MakeName("Identity"))
+			identity.Set("DecodeParms", MakeArray(params))
+
+			check := func(stream *PdfObjectStream, encrypted bool) {
+				require.Equal(t, encrypted, !bytes.Equal(stream.Stream, plain), "%s: object %d", c.name, stream.ObjectNumber)
+			}
+			for _, s := range []*PdfObjectStream{normal, metadata, embedded, identity} {
+				require.NoError(t, crypter.Encrypt(s, s.ObjectNumber, 0))
+			}
+			check(normal, c.normal)
+			check(metadata, c.metadata)
+			check(embedded, c.embedded)
+			check(identity, false)
+
+			trailer := MakeDict()
+			trailer.Set("ID", MakeArray(MakeHexString(info.ID0), MakeHexString(info.ID1)))
+			decrypter, err := PdfCryptNewDecrypt(&PdfParser{}, info.Encrypt, trailer)
+			require.NoError(t, err)
+			ok, err := decrypter.authenticate([]byte("user"))
+			require.NoError(t, err)
+			require.True(t, ok)
+
+			for _, s := range []*PdfObjectStream{normal, metadata, embedded, identity} {
+				require.NoError(t, decrypter.Decrypt(s, 0, 0))
+				check(s, false)
+			}
+			require.Nil(t, identity.Get("Filter"))
+			require.Nil(t, identity.Get("DecodeParms"))
+		}
+	}
+}
+
+func TestRemoveCryptFilter(t *testing.T) {
+	dict := MakeDict()
+	dict.Set("Filter", MakeArray(MakeName("Crypt"), MakeName("FlateDecode")))
+	params := MakeDict()
+	params.Set("Name", MakeName("StdCF"))
+	dict.Set("DecodeParms", MakeArray(params, MakeNull()))
+
+	params, ok := getCryptFilterParams(dict)
+	require.True(t, ok)
+	name, ok := GetName(params.Get("Name"))
+	require.True(t, ok)
+	require.Equal(t, "StdCF", name.String())
+
+	removeCryptFilter(dict)
+	require.Equal(t, "[/FlateDecode]", dict.Get("Filter").WriteString())
+	require.Equal(t, "[null]", dict.Get("DecodeParms").WriteString())
+
+	_, ok = getCryptFilterParams(dict)
+	require.False(t, ok)
+}
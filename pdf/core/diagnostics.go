@@ -0,0 +1,84 @@
+package core
+
+import (
+	"fmt"
+
+	"github.com/finalversus/doc/common"
+)
+
+
+type DiagnosticKind int
+
+
+const (
+	DiagnosticHeaderOffset DiagnosticKind = iota
+	DiagnosticXrefOffset
+	DiagnosticXrefEntry
+	DiagnosticXrefStream
+	DiagnosticTrailer
+	DiagnosticStreamKeyword
+	DiagnosticStreamLength
+	DiagnosticMissingEndstream
+	DiagnosticMissingEndobj
+	DiagnosticEmptyObject
+	DiagnosticInvalidName
+)
+
+var diagnosticKindNames = map[DiagnosticKind]string{
+	DiagnosticHeaderOffset:     "header offset",
+	DiagnosticXrefOffset:       "xref offset",
+	DiagnosticXrefEntry:        "xref entry",
+	DiagnosticXrefStream:       "xref stream",
+	DiagnosticTrailer:          "trailer",
+	DiagnosticStreamKeyword:    "stream keyword",
+	DiagnosticStreamLength:     "stream length",
+	DiagnosticMissingEndstream: "missing endstream",
+	DiagnosticMissingEndobj:    "missing endobj",
+	DiagnosticEmptyObject:      "empty object",
+	DiagnosticInvalidName:      "invalid name",
+}
+
+func (k DiagnosticKind) String() string {
+	if name, ok := diagnosticKindNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown (%d)", int(k))
+}
+
+
+type Diagnostic struct {
+	Kind DiagnosticKind
+
+	Offset int64
+
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s at offset %d: %s", d.Kind, d.Offset, d.Message)
+}
+
+
+type DiagnosticError struct {
+	Diagnostic
+}
+
+func (e *DiagnosticError) Error() string {
+	return "strict mode: " + e.Diagnostic.String()
+}
+
+
+func (parser *PdfParser) Diagnostics() []Diagnostic {
+	return parser.diagnostics
+}
+
+
+func (parser *PdfParser) diagnose(kind DiagnosticKind, offset int64, format string, args ...interface{}) error {
+	d := Diagnostic{Kind: kind, Offset: offset, Message: fmt.Sprintf(format, args...)}
+	common.Log.Debug("Diagnostic: %s", d)
+	parser.diagnostics = append(parser.diagnostics, d)
+	if parser.strict {
+		return &DiagnosticError{Diagnostic: d}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// buildDiagnosticsTestPdf builds a PDF file with `objects` numbered from 1 and a valid xref table.
+// If `startxref` is non-negative, it replaces the actual xref offset.
+func buildDiagnosticsTestPdf(objects []string, startxref int64) ([]byte, []int64) {
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int64, len(objects))
+	for i, obj := range objects {
+		offsets[i] = int64(buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xrefOffset := int64(buf.Len())
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f\r\n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n\r\n", off)
+	}
+	if startxref >= 0 {
+		xrefOffset = startxref
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xrefOffset)
+	return buf.Bytes(), offsets
+}
+
+func TestDiagnosticsStreamLength(t *testing.T) {
+	data, offsets := buildDiagnosticsTestPdf([]string{
+		"<< /Type /Catalog >>",
+		"<< /Length 100 >>\nstream\n0123456789\nendstream",
+		"(next)",
+	}, -1)
+
+	parser, err := NewParserWithOpts(bytes.NewReader(data), nil)
+	require.NoError(t, err)
+	require.Len(t, parser.Diagnostics(), 0)
+
+	obj, err := parser.LookupByNumber(2)
+	require.NoError(t, err)
+	stream, ok := obj.(*PdfObjectStream)
+	require.True(t, ok)
+	require.Equal(t, "0123456789\n", string(stream.Stream))
+
+	diags := parser.Diagnostics()
+	require.Len(t, diags, 1)
+	require.Equal(t, DiagnosticStreamLength, diags[0].Kind)
+	streamStart := offsets[1] + int64(len("2 0 obj\n<< /Length 100 >>\nstream\n"))
+	require.Equal(t, streamStart, diags[0].Offset)
+
+	strict, err := NewParserWithOpts(bytes.NewReader(data), &ParserOpts{Strict: true})
+	require.NoError(t, err)
+	_, err = strict.LookupByNumber(2)
+	require.Error(t, err)
+	derr, ok := err.(*DiagnosticError)
+	require.True(t, ok)
+	require.Equal(t, DiagnosticStreamLength, derr.Kind)
+}
+
+func TestDiagnosticsMissingEndobj(t *testing.T) {
+	data, offsets := buildDiagnosticsTestPdf([]string{
+		"<< /Type /Catalog >>",
+		"<< /Key /Value >>\n3 0 obj",
+	}, -1)
+	// Blank out the "endobj" of object 2, which is followed by a stray object header.
+	data = bytes.Replace(data, []byte("3 0 obj\nendobj"), []byte("3 0 obj\n      "), 1)
+
+	parser, err := NewParserWithOpts(bytes.NewReader(data), nil)
+	require.NoError(t, err)
+
+	obj, err := parser.LookupByNumber(2)
+	require.NoError(t, err)
+	ind, ok := obj.(*PdfIndirectObject)
+	require.True(t, ok)
+	dict, ok := ind.PdfObject.(*PdfObjectDictionary)
+	require.True(t, ok)
+	require.Equal(t, "Value", dict.Get("Key").String())
+
+	diags := parser.Diagnostics()
+	require.Len(t, diags, 1)
+	require.Equal(t, DiagnosticMissingEndobj, diags[0].Kind)
+	require.Equal(t, offsets[1]+int64(len("2 0 obj\n<< /Key /Value >>\n")), diags[0].Offset)
+}
+
+func TestDiagnosticsXrefOffset(t *testing.T) {
+	// The xref repair searches the last 1000 bytes of the file for the xref table.
+	data, _ := buildDiagnosticsTestPdf([]string{
+		"<< /Type /Catalog >>",
+		"(" + strings.Repeat("x", 1000) + ")",
+	}, 100000)
+
+	parser, err := NewParserWithOpts(bytes.NewReader(data), nil)
+	require.NoError(t, err)
+	diags := parser.Diagnostics()
+	require.Len(t, diags, 1)
+	require.Equal(t, DiagnosticXrefOffset, diags[0].Kind)
+	require.Equal(t, int64(100000), diags[0].Offset)
+
+	_, err = NewParserWithOpts(bytes.NewReader(data), &ParserOpts{Strict: true})
+	require.Error(t, err)
+	derr, ok := err.(*DiagnosticError)
+	require.True(t, ok)
+	require.Equal(t, DiagnosticXrefOffset, derr.Kind)
+}
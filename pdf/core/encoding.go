@@ -32,6 +32,8 @@ import (
 
 	"github.com/finalversus/doc/common"
 	"github.com/finalversus/doc/pdf/internal/ccittfax"
+	"github.com/finalversus/doc/pdf/internal/jbig2"
+	"github.com/finalversus/doc/pdf/internal/jpx"
 )
 
 
@@ -63,6 +65,9 @@ type StreamEncoder interface {
 	EncodeBytes(data []byte) ([]byte, error)
 	DecodeBytes(encoded []byte) ([]byte, error)
 	DecodeStream(streamObj *PdfObjectStream) ([]byte, error)
+
+	DecodeReader(r io.Reader) (io.Reader, error)
+	EncodeWriter(w io.Writer) (io.WriteCloser, error)
 }
 
 
@@ -72,6 +77,8 @@ type FlateEncoder struct {
 	
 	Columns int
 	Colors  int
+
+	maxDecodedSize int64
 }
 
 
@@ -168,6 +175,7 @@ func (enc *FlateEncoder) UpdateParams(params *PdfObjectDictionary) {
 
 func newFlateEncoderFromStream(streamObj *PdfObjectStream, decodeParams *PdfObjectDictionary) (*FlateEncoder, error) {
 	encoder := NewFlateEncoder()
+	encoder.maxDecodedSize = streamObj.maxDecodedSize
 
 	encDict := streamObj.PdfObjectDictionary
 	if encDict == nil {
@@ -266,10 +274,12 @@ func (enc *FlateEncoder) DecodeBytes(encoded []byte) ([]byte, error) {
 	}
 	defer r.Close()
 
-	var outBuf bytes.Buffer
-	outBuf.ReadFrom(r)
+	outData, err := readAllLimited(r, enc.maxDecodedSize)
+	if _, ok := err.(*LimitError); ok {
+		return nil, err
+	}
 
-	return outBuf.Bytes(), nil
+	return outData, nil
 }
 
 
@@ -476,6 +486,8 @@ type LZWEncoder struct {
 	Colors  int
 	
 	EarlyChange int
+
+	maxDecodedSize int64
 }
 
 
@@ -572,6 +584,7 @@ func (enc *LZWEncoder) UpdateParams(params *PdfObjectDictionary) {
 func newLZWEncoderFromStream(streamObj *PdfObjectStream, decodeParams *PdfObjectDictionary) (*LZWEncoder, error) {
 	
 	encoder := NewLZWEncoder()
+	encoder.maxDecodedSize = streamObj.maxDecodedSize
 
 	encDict := streamObj.PdfObjectDictionary
 	if encDict == nil {
@@ -678,7 +691,6 @@ func newLZWEncoderFromStream(streamObj *PdfObjectStream, decodeParams *PdfObject
 
 
 func (enc *LZWEncoder) DecodeBytes(encoded []byte) ([]byte, error) {
-	var outBuf bytes.Buffer
 	bufReader := bytes.NewReader(encoded)
 
 	var r io.ReadCloser
@@ -691,12 +703,7 @@ func (enc *LZWEncoder) DecodeBytes(encoded []byte) ([]byte, error) {
 	}
 	defer r.Close()
 
-	_, err := outBuf.ReadFrom(r)
-	if err != nil {
-		return nil, err
-	}
-
-	return outBuf.Bytes(), nil
+	return readAllLimited(r, enc.maxDecodedSize)
 }
 
 
@@ -1975,7 +1982,11 @@ func (enc *CCITTFaxEncoder) EncodeBytes(data []byte) ([]byte, error) {
 
 
 
-type JBIG2Encoder struct{}
+type JBIG2Encoder struct {
+	Globals []byte
+
+	decodeParams *PdfObjectDictionary
+}
 
 
 func NewJBIG2Encoder() *JBIG2Encoder {
@@ -1983,6 +1994,46 @@ func NewJBIG2Encoder() *JBIG2Encoder {
 }
 
 
+
+func newJBIG2EncoderFromStream(streamObj *PdfObjectStream, decodeParams *PdfObjectDictionary) (*JBIG2Encoder, error) {
+	encoder := NewJBIG2Encoder()
+
+	encDict := streamObj.PdfObjectDictionary
+	if encDict == nil {
+		return encoder, nil
+	}
+
+	if decodeParams == nil {
+		obj := TraceToDirectObject(encDict.Get("DecodeParms"))
+		switch t := obj.(type) {
+		case *PdfObjectDictionary:
+			decodeParams = t
+		case *PdfObjectArray:
+			if t.Len() == 1 {
+				if dp, ok := GetDict(t.Get(0)); ok {
+					decodeParams = dp
+				}
+			}
+		}
+	}
+	if decodeParams == nil {
+		return encoder, nil
+	}
+
+	if globals, ok := GetStream(decodeParams.Get("JBIG2Globals")); ok {
+		data, err := DecodeStream(globals)
+		if err != nil {
+			common.Log.Debug("ERROR: Unable to decode JBIG2Globals: %v", err)
+			return nil, err
+		}
+		encoder.Globals = data
+	}
+	encoder.decodeParams = decodeParams
+
+	return encoder, nil
+}
+
+
 func (enc *JBIG2Encoder) GetFilterName() string {
 	return StreamEncodingFilterNameJBIG2
 }
@@ -1990,12 +2041,23 @@ func (enc *JBIG2Encoder) GetFilterName() string {
 
 
 func (enc *JBIG2Encoder) MakeDecodeParams() PdfObject {
-	return nil
+	if enc.decodeParams == nil {
+		return nil
+	}
+	return enc.decodeParams
 }
 
 
 func (enc *JBIG2Encoder) MakeStreamDict() *PdfObjectDictionary {
-	return MakeDict()
+	dict := MakeDict()
+	dict.Set("Filter", MakeName(enc.GetFilterName()))
+
+	decodeParams := enc.MakeDecodeParams()
+	if decodeParams != nil {
+		dict.Set("DecodeParms", decodeParams)
+	}
+
+	return dict
 }
 
 
@@ -2003,16 +2065,20 @@ func (enc *JBIG2Encoder) UpdateParams(params *PdfObjectDictionary) {
 }
 
 
+
 func (enc *JBIG2Encoder) DecodeBytes(encoded []byte) ([]byte, error) {
-	common.Log.Debug("Error: Attempting to use unsupported encoding %s", enc.GetFilterName())
-	return encoded, ErrNoJBIG2Decode
-}
+	bitmap, err := jbig2.Decode(encoded, enc.Globals)
+	if err != nil {
+		common.Log.Debug("ERROR: JBIG2 decoding failed: %v", err)
+		return nil, err
+	}
 
+	return bitmap.ToBytes(false), nil
+}
 
 
 func (enc *JBIG2Encoder) DecodeStream(streamObj *PdfObjectStream) ([]byte, error) {
-	common.Log.Debug("Error: Attempting to use unsupported encoding %s", enc.GetFilterName())
-	return streamObj.Stream, ErrNoJBIG2Decode
+	return enc.DecodeBytes(streamObj.Stream)
 }
 
 
@@ -2023,7 +2089,20 @@ func (enc *JBIG2Encoder) EncodeBytes(data []byte) ([]byte, error) {
 
 
 
-type JPXEncoder struct{}
+type JPXEncoder struct {
+	ColorComponents  int
+	BitsPerComponent int
+	Width            int
+	Height           int
+
+	ColorSpace PdfObject
+
+	SMaskInData int
+
+	ReduceResolution int
+
+	Levels int
+}
 
 
 func NewJPXEncoder() *JPXEncoder {
@@ -2031,6 +2110,63 @@ func NewJPXEncoder() *JPXEncoder {
 }
 
 
+
+func newJPXEncoderFromStream(streamObj *PdfObjectStream, multiEnc *MultiEncoder) (*JPXEncoder, error) {
+	encoder := NewJPXEncoder()
+
+	encDict := streamObj.PdfObjectDictionary
+	if encDict == nil {
+		return encoder, nil
+	}
+
+	if smask, err := GetNumberAsInt64(encDict.Get("SMaskInData")); err == nil {
+		encoder.SMaskInData = int(smask)
+	}
+
+	encoded := streamObj.Stream
+	if multiEnc != nil {
+		e, err := multiEnc.DecodeBytes(encoded)
+		if err != nil {
+			return nil, err
+		}
+		encoded = e
+	}
+
+	cfg, err := jpx.DecodeConfig(encoded)
+	if err != nil {
+		common.Log.Debug("Error decoding JPX header: %s", err)
+		return nil, err
+	}
+
+	encoder.ColorComponents = cfg.ColorComponents
+	encoder.BitsPerComponent = cfg.BitsPerComponent
+	encoder.Width = cfg.Width
+	encoder.Height = cfg.Height
+	encoder.Levels = cfg.Levels
+
+	switch cfg.ColorSpace {
+	case jpx.ColorSpaceGray:
+		encoder.ColorSpace = MakeName("DeviceGray")
+	case jpx.ColorSpaceRGB:
+		encoder.ColorSpace = MakeName("DeviceRGB")
+	case jpx.ColorSpaceCMYK:
+		encoder.ColorSpace = MakeName("DeviceCMYK")
+	}
+	if cfg.ICCProfile != nil && encoder.ColorSpace != nil {
+		icc, err := MakeStream(cfg.ICCProfile, nil)
+		if err != nil {
+			return nil, err
+		}
+		icc.Set("N", MakeInteger(int64(cfg.ColorComponents)))
+		icc.Set("Alternate", encoder.ColorSpace)
+		encoder.ColorSpace = MakeArray(MakeName("ICCBased"), icc)
+	}
+	common.Log.Trace("JPX Encoder: %+v", encoder)
+
+	return encoder, nil
+}
+
+
 func (enc *JPXEncoder) GetFilterName() string {
 	return StreamEncodingFilterNameJPX
 }
@@ -2043,24 +2179,84 @@ func (enc *JPXEncoder) MakeDecodeParams() PdfObject {
 
 
 func (enc *JPXEncoder) MakeStreamDict() *PdfObjectDictionary {
-	return MakeDict()
+	dict := MakeDict()
+	dict.Set("Filter", MakeName(enc.GetFilterName()))
+	return dict
 }
 
 
 func (enc *JPXEncoder) UpdateParams(params *PdfObjectDictionary) {
+	colorComponents, err := GetNumberAsInt64(params.Get("ColorComponents"))
+	if err == nil {
+		enc.ColorComponents = int(colorComponents)
+	}
+
+	bpc, err := GetNumberAsInt64(params.Get("BitsPerComponent"))
+	if err == nil {
+		enc.BitsPerComponent = int(bpc)
+	}
+
+	width, err := GetNumberAsInt64(params.Get("Width"))
+	if err == nil {
+		enc.Width = int(width)
+	}
+
+	height, err := GetNumberAsInt64(params.Get("Height"))
+	if err == nil {
+		enc.Height = int(height)
+	}
+
+	reduce, err := GetNumberAsInt64(params.Get("ReduceResolution"))
+	if err == nil {
+		enc.ReduceResolution = int(reduce)
+	}
+}
+
+
+type JPXImage struct {
+	Width            int
+	Height           int
+	ColorComponents  int
+	BitsPerComponent int
+
+	Data []byte
+
+	Alpha []byte
+}
+
+
+
+func (enc *JPXEncoder) DecodeImage(encoded []byte) (*JPXImage, error) {
+	img, err := jpx.Decode(encoded, &jpx.Options{Reduce: enc.ReduceResolution})
+	if err != nil {
+		common.Log.Debug("ERROR: JPX decoding failed: %v", err)
+		return nil, err
+	}
+
+	return &JPXImage{
+		Width:            img.Width,
+		Height:           img.Height,
+		ColorComponents:  img.ColorComponents,
+		BitsPerComponent: img.BitsPerComponent,
+		Data:             img.Data,
+		Alpha:            img.Alpha,
+	}, nil
 }
 
 
 func (enc *JPXEncoder) DecodeBytes(encoded []byte) ([]byte, error) {
-	common.Log.Debug("Error: Attempting to use unsupported encoding %s", enc.GetFilterName())
-	return encoded, ErrNoJPXDecode
+	img, err := enc.DecodeImage(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	return img.Data, nil
 }
 
 
 
 func (enc *JPXEncoder) DecodeStream(streamObj *PdfObjectStream) ([]byte, error) {
-	common.Log.Debug("Error: Attempting to use unsupported encoding %s", enc.GetFilterName())
-	return streamObj.Stream, ErrNoJPXDecode
+	return enc.DecodeBytes(streamObj.Stream)
 }
 
 
@@ -2183,6 +2379,30 @@ func newMultiEncoderFromStream(streamObj *PdfObjectStream) (*MultiEncoder, error
 			mencoder.AddEncoder(encoder)
 			common.Log.Trace("Added DCT encoder...")
 			common.Log.Trace("Multi encoder: %#v", mencoder)
+		} else if *name == StreamEncodingFilterNameRunLength {
+			encoder, err := newRunLengthEncoderFromStream(streamObj, dParams)
+			if err != nil {
+				return nil, err
+			}
+			mencoder.AddEncoder(encoder)
+		} else if *name == StreamEncodingFilterNameCCITTFax {
+			encoder, err := newCCITTFaxEncoderFromStream(streamObj, dParams)
+			if err != nil {
+				return nil, err
+			}
+			mencoder.AddEncoder(encoder)
+		} else if *name == StreamEncodingFilterNameJBIG2 {
+			encoder, err := newJBIG2EncoderFromStream(streamObj, dParams)
+			if err != nil {
+				return nil, err
+			}
+			mencoder.AddEncoder(encoder)
+		} else if *name == StreamEncodingFilterNameJPX {
+			encoder, err := newJPXEncoderFromStream(streamObj, mencoder)
+			if err != nil {
+				return nil, err
+			}
+			mencoder.AddEncoder(encoder)
 		} else {
 			common.Log.Error("Unsupported filter %s", *name)
 			return nil, fmt.Errorf("invalid filter in multi filter array")
@@ -2237,7 +2457,11 @@ func (enc *MultiEncoder) AddEncoder(encoder StreamEncoder) {
 
 func (enc *MultiEncoder) MakeStreamDict() *PdfObjectDictionary {
 	dict := MakeDict()
-	dict.Set("Filter", MakeName(enc.GetFilterName()))
+	filters := MakeArray()
+	for _, encoder := range enc.encoders {
+		filters.Append(MakeName(encoder.GetFilterName()))
+	}
+	dict.Set("Filter", filters)
 
 	
 	for _, encoder := range enc.encoders {
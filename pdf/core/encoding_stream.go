@@ -0,0 +1,725 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+
+	lzw0 "compress/lzw"
+
+	lzw1 "golang.org/x/image/tiff/lzw"
+
+	"github.com/finalversus/doc/common"
+)
+
+func (enc *FlateEncoder) DecodeReader(r io.Reader) (io.Reader, error) {
+	if enc.BitsPerComponent != 8 {
+		return nil, fmt.Errorf("invalid BitsPerComponent=%d (only 8 supported)", enc.BitsPerComponent)
+	}
+
+	zr, err := zlib.NewReader(r)
+	if err != nil {
+		common.Log.Debug("Decoding error %v\n", err)
+		return nil, err
+	}
+
+	return newPredictorReader(flateReader{newLimitReader(zr, enc.maxDecodedSize)},
+		enc.Predictor, enc.Columns, enc.Colors)
+}
+
+func (enc *FlateEncoder) EncodeWriter(w io.Writer) (io.WriteCloser, error) {
+	if enc.Predictor != 1 && enc.Predictor != 11 {
+		common.Log.Debug("Encoding error: FlateEncoder Predictor = 1, 11 only supported")
+		return nil, ErrUnsupportedEncodingParameters
+	}
+
+	zw := zlib.NewWriter(w)
+	if enc.Predictor == 11 {
+		if enc.Columns < 1 {
+			return nil, errors.New("invalid row length")
+		}
+		return newPNGSubWriter(zw, enc.Columns), nil
+	}
+	return zw, nil
+}
+
+func (enc *LZWEncoder) DecodeReader(r io.Reader) (io.Reader, error) {
+	var lr io.Reader
+	if enc.EarlyChange == 1 {
+		lr = lzw1.NewReader(r, lzw1.MSB, 8)
+	} else {
+		lr = lzw0.NewReader(r, lzw0.MSB, 8)
+	}
+
+	return newPredictorReader(newLimitReader(lr, enc.maxDecodedSize), enc.Predictor, enc.Columns, enc.Colors)
+}
+
+func (enc *LZWEncoder) EncodeWriter(w io.Writer) (io.WriteCloser, error) {
+	if enc.Predictor != 1 {
+		return nil, fmt.Errorf("LZW Predictor = 1 only supported yet")
+	}
+
+	if enc.EarlyChange == 1 {
+		return nil, fmt.Errorf("LZW Early Change = 0 only supported yet")
+	}
+
+	return lzw0.NewWriter(w, lzw0.MSB, 8), nil
+}
+
+func (enc *DCTEncoder) DecodeReader(r io.Reader) (io.Reader, error) {
+	return decodeReaderBuffered(r, enc.DecodeBytes)
+}
+
+func (enc *DCTEncoder) EncodeWriter(w io.Writer) (io.WriteCloser, error) {
+	return &bufferedEncodeWriter{w: w, encode: enc.EncodeBytes}, nil
+}
+
+func (enc *RunLengthEncoder) DecodeReader(r io.Reader) (io.Reader, error) {
+	return &runLengthReader{r: newByteReader(r)}, nil
+}
+
+func (enc *RunLengthEncoder) EncodeWriter(w io.Writer) (io.WriteCloser, error) {
+	return &runLengthWriter{w: w, enc: enc}, nil
+}
+
+func (enc *ASCIIHexEncoder) DecodeReader(r io.Reader) (io.Reader, error) {
+	return &asciiHexReader{r: newByteReader(r)}, nil
+}
+
+func (enc *ASCIIHexEncoder) EncodeWriter(w io.Writer) (io.WriteCloser, error) {
+	return &asciiHexWriter{w: w}, nil
+}
+
+func (enc *ASCII85Encoder) DecodeReader(r io.Reader) (io.Reader, error) {
+	return &ascii85Reader{r: newByteReader(r)}, nil
+}
+
+func (enc *ASCII85Encoder) EncodeWriter(w io.Writer) (io.WriteCloser, error) {
+	return &ascii85Writer{w: w, enc: enc}, nil
+}
+
+func (enc *RawEncoder) DecodeReader(r io.Reader) (io.Reader, error) {
+	return r, nil
+}
+
+func (enc *RawEncoder) EncodeWriter(w io.Writer) (io.WriteCloser, error) {
+	return nopWriteCloser{w}, nil
+}
+
+func (enc *CCITTFaxEncoder) DecodeReader(r io.Reader) (io.Reader, error) {
+	return decodeReaderBuffered(r, enc.DecodeBytes)
+}
+
+func (enc *CCITTFaxEncoder) EncodeWriter(w io.Writer) (io.WriteCloser, error) {
+	return &bufferedEncodeWriter{w: w, encode: enc.EncodeBytes}, nil
+}
+
+func (enc *JBIG2Encoder) DecodeReader(r io.Reader) (io.Reader, error) {
+	return decodeReaderBuffered(r, enc.DecodeBytes)
+}
+
+func (enc *JBIG2Encoder) EncodeWriter(w io.Writer) (io.WriteCloser, error) {
+	return &bufferedEncodeWriter{w: w, encode: enc.EncodeBytes}, nil
+}
+
+func (enc *JPXEncoder) DecodeReader(r io.Reader) (io.Reader, error) {
+	return decodeReaderBuffered(r, enc.DecodeBytes)
+}
+
+func (enc *JPXEncoder) EncodeWriter(w io.Writer) (io.WriteCloser, error) {
+	return &bufferedEncodeWriter{w: w, encode: enc.EncodeBytes}, nil
+}
+
+func (enc *MultiEncoder) DecodeReader(r io.Reader) (io.Reader, error) {
+	var err error
+	for _, encoder := range enc.encoders {
+		common.Log.Trace("Multi Encoder Decode: Applying Filter: %v %T", encoder, encoder)
+
+		r, err = encoder.DecodeReader(r)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func (enc *MultiEncoder) EncodeWriter(w io.Writer) (io.WriteCloser, error) {
+	writers := make([]io.WriteCloser, 0, len(enc.encoders))
+	for _, encoder := range enc.encoders {
+		ew, err := encoder.EncodeWriter(w)
+		if err != nil {
+			return nil, err
+		}
+		writers = append(writers, ew)
+		w = ew
+	}
+	return &multiEncodeWriter{writers: writers}, nil
+}
+
+type predictorReader struct {
+	r         io.Reader
+	predictor int
+	colors    int
+	row       []byte
+	prev      []byte
+	out       []byte
+	rows      int
+	err       error
+}
+
+func newPredictorReader(r io.Reader, predictor, columns, colors int) (io.Reader, error) {
+	var rowLength int
+	switch {
+	case predictor <= 1:
+		return r, nil
+	case predictor == 2:
+		rowLength = columns * colors
+		if rowLength < 1 {
+			return bytes.NewReader(nil), nil
+		}
+		if colors < 1 || rowLength%colors != 0 {
+			return nil, fmt.Errorf("invalid row length (%d) for colors %d", rowLength, colors)
+		}
+	case predictor >= 10 && predictor <= 15:
+		rowLength = columns*colors + 1
+		if rowLength < 2 || colors < 1 {
+			return bytes.NewReader(nil), nil
+		}
+	default:
+		common.Log.Debug("ERROR: Unsupported predictor (%d)", predictor)
+		return nil, fmt.Errorf("unsupported predictor (%d)", predictor)
+	}
+
+	return &predictorReader{
+		r:         r,
+		predictor: predictor,
+		colors:    colors,
+		row:       make([]byte, rowLength),
+		prev:      make([]byte, rowLength),
+	}, nil
+}
+
+func (p *predictorReader) Read(b []byte) (int, error) {
+	for len(p.out) == 0 {
+		if p.err != nil {
+			return 0, p.err
+		}
+		p.err = p.nextRow()
+	}
+	n := copy(b, p.out)
+	p.out = p.out[n:]
+	return n, nil
+}
+
+func (p *predictorReader) nextRow() error {
+	rowLength := len(p.row)
+	n, err := io.ReadFull(p.r, p.row)
+	if err == io.EOF {
+		if p.rows == 0 {
+			common.Log.Debug("Row length cannot be longer than data length (0/%d)", rowLength)
+			return errors.New("range check error")
+		}
+		return io.EOF
+	}
+	if err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("invalid row length (%d/%d)", p.rows*rowLength+n, rowLength)
+	}
+	if err != nil {
+		return err
+	}
+	p.rows++
+
+	row := p.row
+	if p.predictor == 2 {
+		for j := p.colors; j < rowLength; j++ {
+			row[j] += row[j-p.colors]
+		}
+		p.out = row
+		p.row, p.prev = p.prev, p.row
+		return nil
+	}
+
+	bpp := p.colors
+	prev := p.prev
+	switch row[0] {
+	case pfNone:
+	case pfSub:
+		for j := 1 + bpp; j < rowLength; j++ {
+			row[j] += row[j-bpp]
+		}
+	case pfUp:
+		for j := 1; j < rowLength; j++ {
+			row[j] += prev[j]
+		}
+	case pfAvg:
+		for j := 1; j < bpp+1; j++ {
+			row[j] += prev[j] / 2
+		}
+		for j := bpp + 1; j < rowLength; j++ {
+			row[j] += byte((int(row[j-bpp]) + int(prev[j])) / 2)
+		}
+	case pfPaeth:
+		for j := 1; j < rowLength; j++ {
+			var a, b, c byte
+			b = prev[j]
+			if j >= bpp+1 {
+				a = row[j-bpp]
+				c = prev[j-bpp]
+			}
+			row[j] += paeth(a, b, c)
+		}
+	default:
+		common.Log.Debug("ERROR: Invalid filter byte (%d) @row %d", row[0], p.rows-1)
+		return fmt.Errorf("invalid filter byte (%d)", row[0])
+	}
+
+	p.out = row[1:]
+	p.row, p.prev = p.prev, p.row
+	return nil
+}
+
+type pngSubWriter struct {
+	w   io.WriteCloser
+	row []byte
+	out []byte
+	n   int
+}
+
+func newPNGSubWriter(w io.WriteCloser, columns int) *pngSubWriter {
+	return &pngSubWriter{
+		w:   w,
+		row: make([]byte, columns),
+		out: make([]byte, columns+1),
+	}
+}
+
+func (p *pngSubWriter) Write(b []byte) (int, error) {
+	written := 0
+	for len(b) > 0 {
+		k := copy(p.row[p.n:], b)
+		p.n += k
+		b = b[k:]
+		written += k
+		if p.n < len(p.row) {
+			break
+		}
+
+		p.out[0] = pfSub
+		p.out[1] = p.row[0]
+		for j := 1; j < len(p.row); j++ {
+			p.out[j+1] = p.row[j] - p.row[j-1]
+		}
+		if _, err := p.w.Write(p.out); err != nil {
+			return written, err
+		}
+		p.n = 0
+	}
+	return written, nil
+}
+
+func (p *pngSubWriter) Close() error {
+	err := p.w.Close()
+	if p.n != 0 {
+		common.Log.Error("Invalid column length")
+		return errors.New("invalid row length")
+	}
+	return err
+}
+
+type runLengthReader struct {
+	r   io.ByteReader
+	buf [128]byte
+	out []byte
+	eod bool
+}
+
+func (rl *runLengthReader) Read(b []byte) (int, error) {
+	for len(rl.out) == 0 {
+		if rl.eod {
+			return 0, io.EOF
+		}
+		if err := rl.nextRun(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(b, rl.out)
+	rl.out = rl.out[n:]
+	return n, nil
+}
+
+func (rl *runLengthReader) nextRun() error {
+	b, err := rl.r.ReadByte()
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+	switch {
+	case b > 128:
+		v, err := rl.r.ReadByte()
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+		n := 257 - int(b)
+		for i := 0; i < n; i++ {
+			rl.buf[i] = v
+		}
+		rl.out = rl.buf[:n]
+	case b < 128:
+		n := int(b) + 1
+		for i := 0; i < n; i++ {
+			v, err := rl.r.ReadByte()
+			if err != nil {
+				return unexpectedEOF(err)
+			}
+			rl.buf[i] = v
+		}
+		rl.out = rl.buf[:n]
+	default:
+		rl.eod = true
+	}
+	return nil
+}
+
+type runLengthWriter struct {
+	w   io.Writer
+	enc *RunLengthEncoder
+	buf []byte
+}
+
+const runLengthChunkSize = 4096
+
+func (rl *runLengthWriter) Write(b []byte) (int, error) {
+	rl.buf = append(rl.buf, b...)
+	if len(rl.buf) >= runLengthChunkSize {
+		if err := rl.flush(); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+func (rl *runLengthWriter) flush() error {
+	if len(rl.buf) == 0 {
+		return nil
+	}
+	encoded, err := rl.enc.EncodeBytes(rl.buf)
+	if err != nil {
+		return err
+	}
+	rl.buf = rl.buf[:0]
+	_, err = rl.w.Write(encoded[:len(encoded)-1])
+	return err
+}
+
+func (rl *runLengthWriter) Close() error {
+	if err := rl.flush(); err != nil {
+		return err
+	}
+	_, err := rl.w.Write([]byte{128})
+	return err
+}
+
+type asciiHexReader struct {
+	r   io.ByteReader
+	err error
+}
+
+func (h *asciiHexReader) Read(b []byte) (int, error) {
+	n := 0
+	for n < len(b) && h.err == nil {
+		hi, ok, err := h.nextDigit()
+		if err != nil || !ok {
+			h.err = err
+			if err == nil {
+				h.err = io.EOF
+			}
+			break
+		}
+		lo, ok, err := h.nextDigit()
+		if err != nil {
+			h.err = err
+			break
+		}
+		if !ok {
+			h.err = io.EOF
+		}
+		b[n] = hi<<4 | lo
+		n++
+	}
+	if n > 0 {
+		return n, nil
+	}
+	return 0, h.err
+}
+
+func (h *asciiHexReader) nextDigit() (byte, bool, error) {
+	for {
+		b, err := h.r.ReadByte()
+		if err != nil {
+			return 0, false, unexpectedEOF(err)
+		}
+		switch {
+		case b == '>':
+			return 0, false, nil
+		case IsWhiteSpace(b):
+			continue
+		case b >= '0' && b <= '9':
+			return b - '0', true, nil
+		case b >= 'a' && b <= 'f':
+			return b - 'a' + 10, true, nil
+		case b >= 'A' && b <= 'F':
+			return b - 'A' + 10, true, nil
+		default:
+			common.Log.Debug("ERROR: Invalid ascii hex character (%c)", b)
+			return 0, false, fmt.Errorf("invalid ascii hex character (%c)", b)
+		}
+	}
+}
+
+type asciiHexWriter struct {
+	w   io.Writer
+	buf []byte
+}
+
+const hexDigitsUpper = "0123456789ABCDEF"
+
+func (h *asciiHexWriter) Write(b []byte) (int, error) {
+	h.buf = h.buf[:0]
+	for _, c := range b {
+		h.buf = append(h.buf, hexDigitsUpper[c>>4], hexDigitsUpper[c&0x0f], ' ')
+	}
+	if _, err := h.w.Write(h.buf); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (h *asciiHexWriter) Close() error {
+	_, err := h.w.Write([]byte{'>'})
+	return err
+}
+
+type ascii85Reader struct {
+	r   io.ByteReader
+	buf [4]byte
+	out []byte
+	eod bool
+}
+
+func (a *ascii85Reader) Read(b []byte) (int, error) {
+	for len(a.out) == 0 {
+		if a.eod {
+			return 0, io.EOF
+		}
+		if err := a.nextGroup(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(b, a.out)
+	a.out = a.out[n:]
+	return n, nil
+}
+
+func (a *ascii85Reader) nextGroup() error {
+	var codes [5]byte
+	n := 0
+loop:
+	for n < 5 {
+		c, err := a.r.ReadByte()
+		if err == io.EOF {
+			a.eod = true
+			break
+		}
+		if err != nil {
+			return err
+		}
+		switch {
+		case IsWhiteSpace(c):
+		case c == '~':
+			a.eod = true
+			break loop
+		case c == 'z' && n == 0:
+			a.buf = [4]byte{}
+			a.out = a.buf[:]
+			return nil
+		case c >= '!' && c <= 'u':
+			codes[n] = c - '!'
+			n++
+		default:
+			common.Log.Error("Failed decoding, invalid code")
+			return errors.New("invalid code encountered")
+		}
+	}
+	if n < 2 {
+		return nil
+	}
+
+	for m := n; m < 5; m++ {
+		codes[m] = 84
+	}
+	value := uint32(codes[0])*85*85*85*85 + uint32(codes[1])*85*85*85 + uint32(codes[2])*85*85 + uint32(codes[3])*85 + uint32(codes[4])
+	a.buf = [4]byte{byte(value >> 24), byte(value >> 16), byte(value >> 8), byte(value)}
+	a.out = a.buf[:n-1]
+	return nil
+}
+
+type ascii85Writer struct {
+	w     io.Writer
+	enc   *ASCII85Encoder
+	group [4]byte
+	n     int
+	buf   []byte
+}
+
+func (a *ascii85Writer) Write(b []byte) (int, error) {
+	a.buf = a.buf[:0]
+	for _, c := range b {
+		a.group[a.n] = c
+		a.n++
+		if a.n == 4 {
+			a.encodeGroup()
+		}
+	}
+	if _, err := a.w.Write(a.buf); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (a *ascii85Writer) encodeGroup() {
+	n := a.n
+	for i := n; i < 4; i++ {
+		a.group[i] = 0
+	}
+	a.n = 0
+
+	base256 := uint32(a.group[0])<<24 | uint32(a.group[1])<<16 | uint32(a.group[2])<<8 | uint32(a.group[3])
+	if base256 == 0 && n == 4 {
+		a.buf = append(a.buf, 'z')
+		return
+	}
+	base85vals := a.enc.base256Tobase85(base256)
+	for _, val := range base85vals[:n+1] {
+		a.buf = append(a.buf, val+'!')
+	}
+}
+
+func (a *ascii85Writer) Close() error {
+	a.buf = a.buf[:0]
+	if a.n > 0 {
+		a.encodeGroup()
+	}
+	a.buf = append(a.buf, '~', '>')
+	_, err := a.w.Write(a.buf)
+	return err
+}
+
+type multiEncodeWriter struct {
+	writers []io.WriteCloser
+}
+
+func (m *multiEncodeWriter) Write(b []byte) (int, error) {
+	return m.writers[len(m.writers)-1].Write(b)
+}
+
+func (m *multiEncodeWriter) Close() error {
+	for i := len(m.writers) - 1; i >= 0; i-- {
+		if err := m.writers[i].Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type bufferedEncodeWriter struct {
+	w      io.Writer
+	encode func([]byte) ([]byte, error)
+	buf    bytes.Buffer
+}
+
+func (b *bufferedEncodeWriter) Write(p []byte) (int, error) {
+	return b.buf.Write(p)
+}
+
+func (b *bufferedEncodeWriter) Close() error {
+	encoded, err := b.encode(b.buf.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = b.w.Write(encoded)
+	return err
+}
+
+func decodeReaderBuffered(r io.Reader, decode func([]byte) ([]byte, error)) (io.Reader, error) {
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(r); err != nil {
+		return nil, err
+	}
+	decoded, err := decode(buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(decoded), nil
+}
+
+type flateReader struct {
+	r io.Reader
+}
+
+func (f flateReader) Read(b []byte) (int, error) {
+	n, err := f.r.Read(b)
+	if err != nil && err != io.EOF {
+		if _, ok := err.(*LimitError); ok {
+			return n, err
+		}
+		common.Log.Debug("Flate decoding error: %v", err)
+		err = io.EOF
+	}
+	return n, err
+}
+
+type limitReader struct {
+	r   io.Reader
+	n   int64
+	max int64
+}
+
+func newLimitReader(r io.Reader, max int64) io.Reader {
+	if max <= 0 {
+		return r
+	}
+	return &limitReader{r: r, max: max}
+}
+
+func (l *limitReader) Read(b []byte) (int, error) {
+	n, err := l.r.Read(b)
+	l.n += int64(n)
+	if l.n > l.max {
+		return 0, &LimitError{Limit: "decoded stream size", Max: l.max}
+	}
+	return n, err
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+func newByteReader(r io.Reader) io.ByteReader {
+	if br, ok := r.(io.ByteReader); ok {
+		return br
+	}
+	return bufio.NewReader(r)
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
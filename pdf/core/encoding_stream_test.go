@@ -0,0 +1,182 @@
+package core
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/require"
+)
+
+// encodeChunked encodes `data` with the streaming encoder of `encoder`, writing `chunk` bytes at a time.
+func encodeChunked(t *testing.T, encoder StreamEncoder, data []byte, chunk int) []byte {
+	var buf bytes.Buffer
+	w, err := encoder.EncodeWriter(&buf)
+	require.NoError(t, err)
+	for len(data) > 0 {
+		n := chunk
+		if n > len(data) {
+			n = len(data)
+		}
+		_, err := w.Write(data[:n])
+		require.NoError(t, err)
+		data = data[n:]
+	}
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+// streamTestData returns `n` bytes of compressible pseudo-random data.
+func streamTestData(n int) []byte {
+	rnd := rand.New(rand.NewSource(1))
+	data := make([]byte, n)
+	for i := range data {
+		if rnd.Intn(4) == 0 {
+			data[i] = byte(rnd.Intn(256))
+		} else if i > 0 {
+			data[i] = data[i-1]
+		}
+	}
+	return data
+}
+
+func TestStreamingEncoders(t *testing.T) {
+	data := streamTestData(30000)
+
+	lzw := NewLZWEncoder()
+	lzw.EarlyChange = 0
+	png := NewFlateEncoder()
+	png.SetPredictor(100)
+	multi := NewMultiEncoder()
+	multi.AddEncoder(NewASCII85Encoder())
+	multi.AddEncoder(NewFlateEncoder())
+	multi.AddEncoder(NewRunLengthEncoder())
+
+	encoders := []StreamEncoder{
+		NewRawEncoder(),
+		NewFlateEncoder(),
+		png,
+		lzw,
+		NewRunLengthEncoder(),
+		NewASCIIHexEncoder(),
+		NewASCII85Encoder(),
+		multi,
+	}
+	for _, encoder := range encoders {
+		for _, size := range []int{0, 1, 5, 1000, len(data)} {
+			if encoder == png && (size == 0 || size%100 != 0) {
+				continue
+			}
+			encoded := encodeChunked(t, encoder, data[:size], 7)
+
+			stream := &PdfObjectStream{PdfObjectDictionary: encoder.MakeStreamDict(), Stream: encoded}
+			decoded, err := DecodeStream(stream)
+			require.NoError(t, err, "%T size %d", encoder, size)
+			require.True(t, bytes.Equal(data[:size], decoded), "%T size %d", encoder, size)
+
+			r, err := encoder.DecodeReader(iotest.OneByteReader(bytes.NewReader(encoded)))
+			require.NoError(t, err)
+			decoded, err = ioutil.ReadAll(iotest.HalfReader(r))
+			require.NoError(t, err, "%T size %d", encoder, size)
+			require.True(t, bytes.Equal(data[:size], decoded), "%T size %d", encoder, size)
+		}
+	}
+}
+
+func TestStreamReaderPredictors(t *testing.T) {
+	data := streamTestData(3 * 40 * 25)
+	rows := make([]byte, 0, len(data)+40)
+	for i := 0; i < 40; i++ {
+		rows = append(rows, byte(i%5))
+		rows = append(rows, data[i*75:(i+1)*75]...)
+	}
+
+	testcases := []struct {
+		Predictor int
+		Input     []byte
+	}{
+		{Predictor: 2, Input: data},
+		{Predictor: 15, Input: rows},
+		{Predictor: 12, Input: rows[:len(rows)-1]},
+		{Predictor: 12, Input: nil},
+	}
+
+	for i, tcase := range testcases {
+		var buf bytes.Buffer
+		zw, err := NewFlateEncoder().EncodeWriter(&buf)
+		require.NoError(t, err)
+		zw.Write(tcase.Input)
+		require.NoError(t, zw.Close())
+
+		encoder := NewFlateEncoder()
+		encoder.Predictor = tcase.Predictor
+		encoder.Colors = 3
+		encoder.Columns = 25
+		stream := &PdfObjectStream{PdfObjectDictionary: encoder.MakeStreamDict(), Stream: buf.Bytes()}
+
+		expected, expectedErr := DecodeStream(stream)
+		r, err := NewStreamReader(stream)
+		require.NoError(t, err)
+		decoded, err := ioutil.ReadAll(r)
+		if expectedErr != nil {
+			require.Error(t, err, "case %d", i)
+			continue
+		}
+		require.NoError(t, err, "case %d", i)
+		require.Equal(t, expected, decoded, "case %d", i)
+	}
+}
+
+func TestStreamReaderLimit(t *testing.T) {
+	data := bytes.Repeat([]byte{1}, 100000)
+	encoded, err := NewFlateEncoder().EncodeBytes(data)
+	require.NoError(t, err)
+
+	stream := &PdfObjectStream{
+		PdfObjectDictionary: NewFlateEncoder().MakeStreamDict(),
+		Stream:              encoded,
+		maxDecodedSize:      1000,
+	}
+	r, err := NewStreamReader(stream)
+	require.NoError(t, err)
+	_, err = ioutil.ReadAll(r)
+	require.True(t, IsLimitExceeded(err))
+
+	stream.maxDecodedSize = int64(len(data))
+	r, err = NewStreamReader(stream)
+	require.NoError(t, err)
+	decoded, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, data, decoded)
+}
+
+func TestMakeStreamFromReader(t *testing.T) {
+	data := streamTestData(50000)
+
+	stream, err := MakeStreamFromReader(bytes.NewReader(data), NewFlateEncoder())
+	require.NoError(t, err)
+	length, ok := stream.Get("Length").(*PdfIndirectObject)
+	require.True(t, ok)
+
+	var buf bytes.Buffer
+	n, err := WriteStream(&buf, stream)
+	require.NoError(t, err)
+	require.Equal(t, int64(buf.Len()), n)
+	require.Equal(t, MakeInteger(n).String(), length.PdfObject.String())
+
+	decoded, err := NewFlateEncoder().DecodeBytes(buf.Bytes())
+	require.NoError(t, err)
+	require.Equal(t, data, decoded)
+
+	stream, err = MakeStreamFromReader(bytes.NewReader(data), NewASCIIHexEncoder())
+	require.NoError(t, err)
+	decoded, err = DecodeStream(stream)
+	require.NoError(t, err)
+	require.Equal(t, data, decoded)
+
+	lzw := NewLZWEncoder()
+	_, err = MakeStreamFromReader(bytes.NewReader(data), lzw)
+	require.Error(t, err)
+}
@@ -349,3 +349,75 @@ func TestMultiEncoder(t *testing.T) {
 		return
 	}
 }
+
+func TestJBIG2Decoding(t *testing.T) {
+
+	encoded := []byte{
+		0x00, 0x00, 0x00, 0x00, 0x30, 0x00, 0x01, 0x00, 0x00, 0x00, 0x13,
+		0x00, 0x00, 0x00, 0x0A, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x01, 0x31, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00,
+	}
+
+	hexEncoded, err := NewASCIIHexEncoder().EncodeBytes(encoded)
+	if err != nil {
+		t.Fatalf("Failed to encode data: %v", err)
+	}
+
+	stream := &PdfObjectStream{PdfObjectDictionary: MakeDict(), Stream: hexEncoded}
+	stream.Set("Filter", MakeArray(MakeName(StreamEncodingFilterNameASCIIHex), MakeName(StreamEncodingFilterNameJBIG2)))
+
+	decoded, err := DecodeStream(stream)
+	if err != nil {
+		t.Fatalf("Failed to decode data: %v", err)
+	}
+
+	expected := []byte{0xFF, 0xC0, 0xFF, 0xC0}
+	if !compareSlices(decoded, expected) {
+		t.Errorf("Decoded % x, expected % x", decoded, expected)
+	}
+}
+
+func TestJPXDecoding(t *testing.T) {
+
+	encoded := []byte{
+		0xFF, 0x4F,
+		0xFF, 0x51, 0x00, 0x29, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x04, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x04, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x01, 0x07, 0x01, 0x01,
+		0xFF, 0x52, 0x00, 0x0C, 0x00, 0x00, 0x00, 0x01, 0x00, 0x01, 0x04, 0x04, 0x00, 0x01,
+		0xFF, 0x5C, 0x00, 0x07, 0x40, 0x40, 0x48, 0x48, 0x50,
+		0xFF, 0x90, 0x00, 0x0A, 0x00, 0x00, 0x00, 0x00, 0x00, 0x10, 0x00, 0x01,
+		0xFF, 0x93, 0x00, 0x00,
+		0xFF, 0xD9,
+	}
+
+	stream := &PdfObjectStream{PdfObjectDictionary: MakeDict(), Stream: encoded}
+	stream.Set("Filter", MakeName(StreamEncodingFilterNameJPX))
+
+	encoder, err := NewEncoderFromStream(stream)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	jpxEnc, ok := encoder.(*JPXEncoder)
+	if !ok {
+		t.Fatalf("Unexpected encoder type %T", encoder)
+	}
+	if jpxEnc.Width != 4 || jpxEnc.Height != 2 || jpxEnc.ColorComponents != 1 || jpxEnc.BitsPerComponent != 8 {
+		t.Errorf("Unexpected image parameters %+v", jpxEnc)
+	}
+	if name, ok := GetName(jpxEnc.ColorSpace); !ok || *name != "DeviceGray" {
+		t.Errorf("Unexpected colorspace %v", jpxEnc.ColorSpace)
+	}
+
+	decoded, err := DecodeStream(stream)
+	if err != nil {
+		t.Fatalf("Failed to decode data: %v", err)
+	}
+
+	expected := []byte{0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80}
+	if !compareSlices(decoded, expected) {
+		t.Errorf("Decoded % x, expected % x", decoded, expected)
+	}
+}
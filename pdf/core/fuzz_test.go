@@ -1,6 +1,8 @@
 package core
 
 import (
+	"bytes"
+	"fmt"
 	"testing"
 )
 
@@ -121,3 +123,98 @@ startxref
 	}
 
 }
+
+// fuzzLimits are the parser limits checked by the fuzz targets.
+var fuzzLimits = Limits{
+	MaxDecodedStreamSize: 1 << 16,
+	MaxNestingDepth:      32,
+	MaxObjects:           1000,
+	MaxXrefChain:         8,
+}
+
+// objectDepth returns the nesting depth of arrays and dictionaries in `obj`.
+func objectDepth(obj PdfObject) int {
+	depth := 0
+	switch t := obj.(type) {
+	case *PdfIndirectObject:
+		return objectDepth(t.PdfObject)
+	case *PdfObjectStream:
+		return objectDepth(t.PdfObjectDictionary)
+	case *PdfObjectArray:
+		for _, elem := range t.Elements() {
+			if d := objectDepth(elem); d > depth {
+				depth = d
+			}
+		}
+		return depth + 1
+	case *PdfObjectDictionary:
+		for _, key := range t.Keys() {
+			if d := objectDepth(t.Get(key)); d > depth {
+				depth = d
+			}
+		}
+		return depth + 1
+	}
+	return depth
+}
+
+func FuzzParserLimits(f *testing.F) {
+	bomb := bytes.Repeat([]byte{0}, 1<<20)
+	encoded, _ := NewFlateEncoder().EncodeBytes(bomb)
+	seeds := [][]string{
+		{"<< /Type /Catalog >>", fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream",
+			len(encoded), encoded)},
+		{"<< /Type /Catalog >>", nestedArray(100)},
+		{"<< /Type /Catalog /Kids [1 0 R] >>", "<< /A << /B << /C [1 2 3] >> >> >>"},
+	}
+	for _, objects := range seeds {
+		data, _ := buildDiagnosticsTestPdf(objects, -1)
+		f.Add(data)
+	}
+	chained, _ := buildDiagnosticsTestPdf([]string{"<< /Type /Catalog >>"}, -1)
+	f.Add(appendXrefSections(chained, 1, 20))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		parser, err := NewParserWithOpts(bytes.NewReader(data), &ParserOpts{Limits: fuzzLimits})
+		if err != nil {
+			return
+		}
+		objNums := parser.GetObjectNums()
+		if len(objNums) > fuzzLimits.MaxObjects {
+			t.Fatalf("object count %d exceeds limit", len(objNums))
+		}
+		for _, objNum := range objNums {
+			obj, err := parser.LookupByNumber(objNum)
+			if err != nil {
+				continue
+			}
+			if depth := objectDepth(obj); depth > fuzzLimits.MaxNestingDepth {
+				t.Fatalf("object %d nesting depth %d exceeds limit", objNum, depth)
+			}
+			stream, ok := obj.(*PdfObjectStream)
+			if !ok {
+				continue
+			}
+			decoded, err := DecodeStream(stream)
+			if err == nil && int64(len(decoded)) > fuzzLimits.MaxDecodedStreamSize {
+				t.Fatalf("object %d decoded size %d exceeds limit", objNum, len(decoded))
+			}
+		}
+	})
+}
+
+func FuzzFlateDecodeLimit(f *testing.F) {
+	for _, size := range []int{0, 100, 1 << 16, 1 << 20} {
+		encoded, _ := NewFlateEncoder().EncodeBytes(bytes.Repeat([]byte("x"), size))
+		f.Add(encoded)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		encoder := NewFlateEncoder()
+		encoder.maxDecodedSize = fuzzLimits.MaxDecodedStreamSize
+		decoded, err := encoder.DecodeBytes(data)
+		if err == nil && int64(len(decoded)) > encoder.maxDecodedSize {
+			t.Fatalf("decoded size %d exceeds limit", len(decoded))
+		}
+	})
+}
@@ -97,3 +97,30 @@ func (parser *PdfParser) ReadBytesAt(offset, len int64) ([]byte, error) {
 
 	return bb, nil
 }
+
+
+func cloneReadSeeker(rs io.ReadSeeker) (io.ReadSeeker, error) {
+	switch t := rs.(type) {
+	case *offsetReader:
+		r, err := cloneReadSeeker(t.reader)
+		if err != nil {
+			return nil, err
+		}
+		return newOffsetReader(r, t.offset)
+	case io.ReaderAt:
+		offset, err := rs.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+		size, err := rs.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := rs.Seek(offset, io.SeekStart); err != nil {
+			return nil, err
+		}
+		return io.NewSectionReader(t, 0, size), nil
+	}
+	common.Log.Debug("ERROR: Cannot clone parser: %T does not implement io.ReaderAt", rs)
+	return nil, ErrNotSupported
+}
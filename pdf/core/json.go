@@ -0,0 +1,723 @@
+package core
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/finalversus/doc/common"
+	"github.com/finalversus/doc/pdf/internal/strutils"
+)
+
+type JSONOpts struct {
+	DecodeStreams bool
+
+	Indent string
+}
+
+type JSONDocument struct {
+	Version Version
+
+	Trailer *PdfObjectDictionary
+
+	Objects map[int64]PdfObject
+}
+
+var jsonTrailerSkipKeys = map[PdfObjectName]bool{
+	"Size":        true,
+	"Prev":        true,
+	"XRefStm":     true,
+	"Encrypt":     true,
+	"Type":        true,
+	"W":           true,
+	"Index":       true,
+	"Filter":      true,
+	"DecodeParms": true,
+	"Length":      true,
+}
+
+func EncodeJSON(obj PdfObject, opts *JSONOpts) ([]byte, error) {
+	e := newJSONEncoder(nil, opts)
+	if err := e.encode(obj, true); err != nil {
+		return nil, err
+	}
+	return e.indent(e.buf.Bytes())
+}
+
+func DecodeJSON(data []byte) (PdfObject, error) {
+	d := newJSONDecoder(bytes.NewReader(data))
+	obj, err := d.decode()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := d.dec.Token(); err != io.EOF {
+		return nil, errors.New("invalid JSON: trailing data")
+	}
+	if err := d.encodeStreams(); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+func (parser *PdfParser) WriteJSON(w io.Writer, opts *JSONOpts) error {
+	if parser.crypter != nil && !parser.crypter.authenticated {
+		return errors.New("encrypted document not authenticated")
+	}
+	trailer := parser.GetTrailer()
+	if trailer == nil {
+		return errors.New("trailer missing")
+	}
+
+	e := newJSONEncoder(parser, opts)
+	e.buf.WriteString(`{"version":`)
+	e.writeString(parser.PdfVersion().String())
+	e.buf.WriteString(`,"trailer":{`)
+	first := true
+	for _, key := range trailer.Keys() {
+		if jsonTrailerSkipKeys[key] {
+			continue
+		}
+		if !first {
+			e.buf.WriteByte(',')
+		}
+		first = false
+		e.writeString(key.WriteString())
+		e.buf.WriteByte(':')
+		if err := e.encode(trailer.Get(key), false); err != nil {
+			return err
+		}
+	}
+	e.buf.WriteString(`},"objects":{`)
+
+	objects := map[PdfObjectReference][]byte{}
+	for len(e.queue) > 0 {
+		ref := e.queue[0]
+		e.queue = e.queue[1:]
+
+		obj := e.pending[ref]
+		if obj == nil {
+			var err error
+			obj, err = parser.LookupByReference(ref)
+			if err != nil {
+				common.Log.Debug("ERROR: Failed looking up object %d %d R: %v - writing null", ref.ObjectNumber, ref.GenerationNumber, err)
+				obj = MakeNull()
+			}
+		}
+		delete(e.pending, ref)
+
+		start := e.buf.Len()
+		if err := e.encode(obj, true); err != nil {
+			return err
+		}
+		objects[ref] = append([]byte(nil), e.buf.Bytes()[start:]...)
+		e.buf.Truncate(start)
+	}
+
+	refs := make([]PdfObjectReference, 0, len(objects))
+	for ref := range objects {
+		refs = append(refs, ref)
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].ObjectNumber != refs[j].ObjectNumber {
+			return refs[i].ObjectNumber < refs[j].ObjectNumber
+		}
+		return refs[i].GenerationNumber < refs[j].GenerationNumber
+	})
+	for i, ref := range refs {
+		if i > 0 {
+			e.buf.WriteByte(',')
+		}
+		e.writeString(fmt.Sprintf("%d %d R", ref.ObjectNumber, ref.GenerationNumber))
+		e.buf.WriteByte(':')
+		e.buf.Write(objects[ref])
+	}
+	e.buf.WriteString("}}")
+
+	data, err := e.indent(e.buf.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func ReadJSON(r io.Reader) (*JSONDocument, error) {
+	d := newJSONDecoder(r)
+	if err := d.expectDelim('{'); err != nil {
+		return nil, err
+	}
+
+	doc := &JSONDocument{
+		Version: Version{Major: 1, Minor: 3},
+		Objects: map[int64]PdfObject{},
+	}
+	for d.dec.More() {
+		key, err := d.key()
+		if err != nil {
+			return nil, err
+		}
+		switch key {
+		case "version":
+			tok, err := d.dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			s, _ := tok.(string)
+			if _, err := fmt.Sscanf(s, "%d.%d", &doc.Version.Major, &doc.Version.Minor); err != nil {
+				return nil, fmt.Errorf("invalid JSON: version %q", s)
+			}
+		case "trailer":
+			obj, err := d.decode()
+			if err != nil {
+				return nil, err
+			}
+			trailer, ok := obj.(*PdfObjectDictionary)
+			if !ok {
+				return nil, errors.New("invalid JSON: trailer not a dictionary")
+			}
+			doc.Trailer = trailer
+		case "objects":
+			if err := d.expectDelim('{'); err != nil {
+				return nil, err
+			}
+			for d.dec.More() {
+				key, err := d.key()
+				if err != nil {
+					return nil, err
+				}
+				ref, err := parseJSONReference(key)
+				if err != nil {
+					return nil, err
+				}
+				obj, err := d.decode()
+				if err != nil {
+					return nil, err
+				}
+				switch t := obj.(type) {
+				case *PdfObjectStream:
+					t.PdfObjectReference = ref
+				default:
+					obj = &PdfIndirectObject{PdfObjectReference: ref, PdfObject: obj}
+				}
+				if _, has := doc.Objects[ref.ObjectNumber]; has {
+					return nil, fmt.Errorf("invalid JSON: duplicate object %q", key)
+				}
+				doc.Objects[ref.ObjectNumber] = obj
+			}
+			if err := d.expectDelim('}'); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("invalid JSON: unexpected key %q", key)
+		}
+	}
+	if err := d.expectDelim('}'); err != nil {
+		return nil, err
+	}
+	if doc.Trailer == nil {
+		return nil, errors.New("invalid JSON: trailer missing")
+	}
+
+	resolve := func(obj PdfObject) PdfObject {
+		ref, ok := obj.(*PdfObjectReference)
+		if !ok {
+			return obj
+		}
+		target, ok := doc.Objects[ref.ObjectNumber]
+		if !ok {
+			common.Log.Debug("Object %d %d R missing - replacing with null", ref.ObjectNumber, ref.GenerationNumber)
+			return MakeNull()
+		}
+		return target
+	}
+	resolveJSONReferences(doc.Trailer, resolve)
+	for _, obj := range doc.Objects {
+		switch t := obj.(type) {
+		case *PdfIndirectObject:
+			t.PdfObject = resolve(t.PdfObject)
+			resolveJSONReferences(t.PdfObject, resolve)
+		case *PdfObjectStream:
+			resolveJSONReferences(t.PdfObjectDictionary, resolve)
+		}
+	}
+
+	if err := d.encodeStreams(); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func resolveJSONReferences(obj PdfObject, resolve func(PdfObject) PdfObject) {
+	switch t := obj.(type) {
+	case *PdfObjectDictionary:
+		for _, key := range t.Keys() {
+			val := resolve(t.Get(key))
+			t.Set(key, val)
+			resolveJSONReferences(val, resolve)
+		}
+	case *PdfObjectArray:
+		for i, val := range t.Elements() {
+			val = resolve(val)
+			t.Set(i, val)
+			resolveJSONReferences(val, resolve)
+		}
+	}
+}
+
+type jsonEncoder struct {
+	buf    bytes.Buffer
+	opts   JSONOpts
+	parser *PdfParser
+
+	queue   []PdfObjectReference
+	pending map[PdfObjectReference]PdfObject
+	queued  map[PdfObjectReference]bool
+}
+
+func newJSONEncoder(parser *PdfParser, opts *JSONOpts) *jsonEncoder {
+	e := &jsonEncoder{
+		parser:  parser,
+		pending: map[PdfObjectReference]PdfObject{},
+		queued:  map[PdfObjectReference]bool{},
+	}
+	if opts != nil {
+		e.opts = *opts
+	}
+	return e
+}
+
+func (e *jsonEncoder) indent(data []byte) ([]byte, error) {
+	if e.opts.Indent == "" {
+		return data, nil
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, data, "", e.opts.Indent); err != nil {
+		return nil, err
+	}
+	out.WriteByte('\n')
+	return out.Bytes(), nil
+}
+
+func (e *jsonEncoder) writeString(s string) {
+	enc := json.NewEncoder(&e.buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	e.buf.Truncate(e.buf.Len() - 1)
+}
+
+func (e *jsonEncoder) reference(ref PdfObjectReference, obj PdfObject) {
+	ref.parser = nil
+	e.writeString(fmt.Sprintf("%d %d R", ref.ObjectNumber, ref.GenerationNumber))
+	if e.queued[ref] {
+		return
+	}
+	e.queued[ref] = true
+	e.queue = append(e.queue, ref)
+	if obj != nil {
+		e.pending[ref] = obj
+	}
+}
+
+func (e *jsonEncoder) encode(obj PdfObject, top bool) error {
+	switch t := obj.(type) {
+	case nil, *PdfObjectNull:
+		e.buf.WriteString("null")
+	case *PdfObjectBool:
+		e.buf.WriteString(strconv.FormatBool(bool(*t)))
+	case *PdfObjectInteger:
+		e.buf.WriteString(strconv.FormatInt(int64(*t), 10))
+	case *PdfObjectFloat:
+		val := float64(*t)
+		if math.IsNaN(val) || math.IsInf(val, 0) {
+			return fmt.Errorf("invalid real number %v", val)
+		}
+		s := strconv.FormatFloat(val, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".e") {
+			s += ".0"
+		}
+		e.buf.WriteString(s)
+	case *PdfObjectString:
+		e.writeString(encodeJSONString(t))
+	case *PdfObjectName:
+		e.writeString(t.WriteString())
+	case *PdfObjectArray:
+		e.buf.WriteByte('[')
+		for i, val := range t.Elements() {
+			if i > 0 {
+				e.buf.WriteByte(',')
+			}
+			if err := e.encode(val, false); err != nil {
+				return err
+			}
+		}
+		e.buf.WriteByte(']')
+	case *PdfObjectDictionary:
+		e.buf.WriteByte('{')
+		for i, key := range t.Keys() {
+			if i > 0 {
+				e.buf.WriteByte(',')
+			}
+			e.writeString(key.WriteString())
+			e.buf.WriteByte(':')
+			if err := e.encode(t.Get(key), false); err != nil {
+				return err
+			}
+		}
+		e.buf.WriteByte('}')
+	case *PdfObjectReference:
+		e.reference(*t, nil)
+	case *PdfIndirectObject:
+		if !top {
+			e.reference(t.PdfObjectReference, t)
+			return nil
+		}
+		if _, isIndirect := t.PdfObject.(*PdfIndirectObject); isIndirect {
+			return errors.New("indirect object contains an indirect object")
+		}
+		return e.encode(t.PdfObject, false)
+	case *PdfObjectStream:
+		if !top {
+			e.reference(t.PdfObjectReference, t)
+			return nil
+		}
+		return e.encodeStream(t)
+	default:
+		return fmt.Errorf("unsupported object type %T", obj)
+	}
+	return nil
+}
+
+func (e *jsonEncoder) encodeStream(stream *PdfObjectStream) error {
+	if err := LoadStream(stream); err != nil {
+		return err
+	}
+	e.buf.WriteString(`{"stream":{"dict":`)
+	if err := e.encode(stream.PdfObjectDictionary, false); err != nil {
+		return err
+	}
+	if decoded, ok := e.decodeStream(stream); ok {
+		if utf8.Valid(decoded) {
+			e.buf.WriteString(`,"text":`)
+			e.writeString(string(decoded))
+		} else {
+			e.buf.WriteString(`,"decoded":`)
+			e.writeString(base64.StdEncoding.EncodeToString(decoded))
+		}
+	} else {
+		e.buf.WriteString(`,"data":`)
+		e.writeString(base64.StdEncoding.EncodeToString(stream.Stream))
+	}
+	e.buf.WriteString("}}")
+	return nil
+}
+
+func (e *jsonEncoder) decodeStream(stream *PdfObjectStream) ([]byte, bool) {
+	if !e.opts.DecodeStreams {
+		return nil, false
+	}
+	encoder, err := NewEncoderFromStream(stream)
+	if err != nil || !isLosslessEncoder(encoder) {
+		return nil, false
+	}
+	decoded, err := DecodeStream(stream)
+	if err != nil {
+		common.Log.Debug("Stream %d not decoded: %v", stream.ObjectNumber, err)
+		return nil, false
+	}
+
+	encoded, err := encoder.EncodeBytes(decoded)
+	if err != nil {
+		common.Log.Debug("Stream %d cannot be encoded: %v - writing encoded data", stream.ObjectNumber, err)
+		return nil, false
+	}
+	redecoded, err := encoder.DecodeBytes(encoded)
+	if err != nil || !bytes.Equal(redecoded, decoded) {
+		common.Log.Debug("Stream %d encoding not lossless - writing encoded data", stream.ObjectNumber)
+		return nil, false
+	}
+	return decoded, true
+}
+
+func isLosslessEncoder(encoder StreamEncoder) bool {
+	switch t := encoder.(type) {
+	case *RawEncoder, *FlateEncoder, *LZWEncoder, *RunLengthEncoder, *ASCIIHexEncoder, *ASCII85Encoder:
+		return true
+	case *MultiEncoder:
+		for _, enc := range t.encoders {
+			if !isLosslessEncoder(enc) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func encodeJSONString(str *PdfObjectString) string {
+	text := str.Decoded()
+	if enc := makeJSONTextString(text); enc.val == str.val && enc.isHex == str.isHex {
+		return "u:" + text
+	}
+	if str.isHex {
+		return "h:" + hex.EncodeToString(str.Bytes())
+	}
+	return "b:" + hex.EncodeToString(str.Bytes())
+}
+
+func makeJSONTextString(text string) *PdfObjectString {
+	if strutils.PDFDocEncodingToString(strutils.StringToPDFDocEncoding(text)) == text {
+		return MakeEncodedString(text, false)
+	}
+	return MakeEncodedString(text, true)
+}
+
+func decodeJSONString(s string) (PdfObject, error) {
+	switch {
+	case strings.HasPrefix(s, "/"):
+		return decodeJSONName(s)
+	case strings.HasPrefix(s, "u:"):
+		return makeJSONTextString(s[2:]), nil
+	case strings.HasPrefix(s, "b:"), strings.HasPrefix(s, "h:"):
+		data, err := hex.DecodeString(s[2:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSON string %q: %v", s, err)
+		}
+		return &PdfObjectString{val: string(data), isHex: s[0] == 'h'}, nil
+	case strings.HasSuffix(s, " R"):
+		ref, err := parseJSONReference(s)
+		if err != nil {
+			return nil, err
+		}
+		return &ref, nil
+	}
+	return nil, fmt.Errorf("invalid JSON string %q", s)
+}
+
+func decodeJSONName(s string) (*PdfObjectName, error) {
+	var b bytes.Buffer
+	for i := 1; i < len(s); i++ {
+		if s[i] != '#' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+2 >= len(s) {
+			return nil, fmt.Errorf("invalid JSON name %q", s)
+		}
+		code, err := hex.DecodeString(s[i+1 : i+3])
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSON name %q", s)
+		}
+		b.Write(code)
+		i += 2
+	}
+	return MakeName(b.String()), nil
+}
+
+func parseJSONReference(s string) (PdfObjectReference, error) {
+	var ref PdfObjectReference
+	fields := strings.Fields(s)
+	if len(fields) != 3 || fields[2] != "R" {
+		return ref, fmt.Errorf("invalid JSON reference %q", s)
+	}
+	var err error
+	if ref.ObjectNumber, err = strconv.ParseInt(fields[0], 10, 64); err != nil || ref.ObjectNumber <= 0 {
+		return ref, fmt.Errorf("invalid JSON reference %q", s)
+	}
+	if ref.GenerationNumber, err = strconv.ParseInt(fields[1], 10, 64); err != nil || ref.GenerationNumber < 0 {
+		return ref, fmt.Errorf("invalid JSON reference %q", s)
+	}
+	return ref, nil
+}
+
+type jsonDecoder struct {
+	dec *json.Decoder
+
+	streams []*PdfObjectStream
+}
+
+func newJSONDecoder(r io.Reader) *jsonDecoder {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	return &jsonDecoder{dec: dec}
+}
+
+func (d *jsonDecoder) expectDelim(delim json.Delim) error {
+	tok, err := d.dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != delim {
+		return fmt.Errorf("invalid JSON: expected %q, got %v", delim, tok)
+	}
+	return nil
+}
+
+func (d *jsonDecoder) key() (string, error) {
+	tok, err := d.dec.Token()
+	if err != nil {
+		return "", err
+	}
+	key, ok := tok.(string)
+	if !ok {
+		return "", fmt.Errorf("invalid JSON: expected key, got %v", tok)
+	}
+	return key, nil
+}
+
+func (d *jsonDecoder) decode() (PdfObject, error) {
+	tok, err := d.dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := tok.(type) {
+	case nil:
+		return MakeNull(), nil
+	case bool:
+		return MakeBool(t), nil
+	case json.Number:
+		if !strings.ContainsAny(string(t), ".eE") {
+			val, err := t.Int64()
+			if err != nil {
+				return nil, fmt.Errorf("invalid JSON integer %s", t)
+			}
+			return MakeInteger(val), nil
+		}
+		val, err := t.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSON real number %s", t)
+		}
+		return MakeFloat(val), nil
+	case string:
+		return decodeJSONString(t)
+	case json.Delim:
+		switch t {
+		case '[':
+			array := MakeArray()
+			for d.dec.More() {
+				obj, err := d.decode()
+				if err != nil {
+					return nil, err
+				}
+				array.Append(obj)
+			}
+			return array, d.expectDelim(']')
+		case '{':
+			dict := MakeDict()
+			for d.dec.More() {
+				key, err := d.key()
+				if err != nil {
+					return nil, err
+				}
+				if key == "stream" && len(dict.Keys()) == 0 {
+					stream, err := d.decodeStream()
+					if err != nil {
+						return nil, err
+					}
+					return stream, d.expectDelim('}')
+				}
+				if !strings.HasPrefix(key, "/") {
+					return nil, fmt.Errorf("invalid JSON dictionary key %q", key)
+				}
+				name, err := decodeJSONName(key)
+				if err != nil {
+					return nil, err
+				}
+				obj, err := d.decode()
+				if err != nil {
+					return nil, err
+				}
+				dict.Set(*name, obj)
+			}
+			return dict, d.expectDelim('}')
+		}
+	}
+	return nil, fmt.Errorf("invalid JSON: unexpected %v", tok)
+}
+
+func (d *jsonDecoder) decodeStream() (*PdfObjectStream, error) {
+	if err := d.expectDelim('{'); err != nil {
+		return nil, err
+	}
+	stream := &PdfObjectStream{}
+	hasData := false
+	decoded := false
+	for d.dec.More() {
+		key, err := d.key()
+		if err != nil {
+			return nil, err
+		}
+		if key == "dict" {
+			obj, err := d.decode()
+			if err != nil {
+				return nil, err
+			}
+			dict, ok := obj.(*PdfObjectDictionary)
+			if !ok {
+				return nil, errors.New("invalid JSON: stream dictionary not a dictionary")
+			}
+			stream.PdfObjectDictionary = dict
+			continue
+		}
+
+		tok, err := d.dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		s, ok := tok.(string)
+		if !ok || hasData {
+			return nil, fmt.Errorf("invalid JSON: stream %s", key)
+		}
+		hasData = true
+		switch key {
+		case "text":
+			stream.Stream = []byte(s)
+			decoded = true
+		case "data", "decoded":
+			stream.Stream, err = base64.StdEncoding.DecodeString(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid JSON: stream %s: %v", key, err)
+			}
+			decoded = key == "decoded"
+		default:
+			return nil, fmt.Errorf("invalid JSON: unexpected stream key %q", key)
+		}
+	}
+	if err := d.expectDelim('}'); err != nil {
+		return nil, err
+	}
+	if stream.PdfObjectDictionary == nil {
+		stream.PdfObjectDictionary = MakeDict()
+	}
+
+	if decoded {
+		d.streams = append(d.streams, stream)
+	} else {
+		stream.Set("Length", MakeInteger(int64(len(stream.Stream))))
+	}
+	return stream, nil
+}
+
+func (d *jsonDecoder) encodeStreams() error {
+	for _, stream := range d.streams {
+		encoder, err := NewEncoderFromStream(stream)
+		if err != nil {
+			return err
+		}
+		stream.Stream, err = encoder.EncodeBytes(stream.Stream)
+		if err != nil {
+			return err
+		}
+		stream.Set("Length", MakeInteger(int64(len(stream.Stream))))
+	}
+	d.streams = nil
+	return nil
+}
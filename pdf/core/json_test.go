@@ -0,0 +1,112 @@
+package core
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONObjectRoundTrip(t *testing.T) {
+	dict := MakeDict()
+	dict.Set("Int", MakeInteger(-12))
+	dict.Set("Real", MakeFloat(3))
+	dict.Set("Small", MakeFloat(1e-9))
+	dict.Set("Bool", MakeBool(true))
+	dict.Set("Null", MakeNull())
+	dict.Set("Name", MakeName("A name#with/delimiters"))
+	dict.Set("Text", MakeString("Hello (world)"))
+	dict.Set("Unicode", MakeEncodedString("Привет", true))
+	dict.Set("Bytes", MakeString("\x00\xff\xfe"))
+	dict.Set("Hex", MakeHexString("abc"))
+	dict.Set("Ref", &PdfObjectReference{ObjectNumber: 12, GenerationNumber: 1})
+	dict.Set("Array", MakeArray(MakeInteger(1), MakeFloat(1.5), MakeString("1 0 R"), MakeArray()))
+	dict.Set("Dict", MakeDict())
+	dict.Set("#", MakeName(""))
+
+	data, err := EncodeJSON(dict, nil)
+	require.NoError(t, err)
+	require.Contains(t, string(data), `"/Real":3.0`)
+	require.Contains(t, string(data), `"/Name":"/A#20name#23with#2fdelimiters"`)
+	require.Contains(t, string(data), `"/Text":"u:Hello (world)"`)
+	require.Contains(t, string(data), `"/Unicode":"u:Привет"`)
+	require.Contains(t, string(data), `"/Bytes":"b:00fffe"`)
+	require.Contains(t, string(data), `"/Hex":"h:616263"`)
+	require.Contains(t, string(data), `"/Ref":"12 1 R"`)
+
+	obj, err := DecodeJSON(data)
+	require.NoError(t, err)
+	decoded, ok := obj.(*PdfObjectDictionary)
+	require.True(t, ok)
+	require.Equal(t, dict.Keys(), decoded.Keys())
+	require.Equal(t, dict.WriteString(), decoded.WriteString())
+
+	// Indented output decodes to the same objects.
+	indented, err := EncodeJSON(dict, &JSONOpts{Indent: "  "})
+	require.NoError(t, err)
+	require.True(t, bytes.Contains(indented, []byte("\n  ")))
+	obj, err = DecodeJSON(indented)
+	require.NoError(t, err)
+	require.Equal(t, dict.WriteString(), obj.WriteString())
+}
+
+func TestJSONStreamRoundTrip(t *testing.T) {
+	content := []byte("BT /F1 12 Tf (Hello) Tj ET")
+	encoders := []StreamEncoder{NewRawEncoder(), NewFlateEncoder(), NewRunLengthEncoder(), NewASCII85Encoder()}
+	multi := NewMultiEncoder()
+	multi.AddEncoder(NewASCIIHexEncoder())
+	multi.AddEncoder(NewFlateEncoder())
+	encoders = append(encoders, multi)
+
+	for _, encoder := range encoders {
+		stream, err := MakeStream(content, encoder)
+		require.NoError(t, err)
+
+		for _, decode := range []bool{false, true} {
+			data, err := EncodeJSON(stream, &JSONOpts{DecodeStreams: decode})
+			require.NoError(t, err)
+			require.Equal(t, decode, strings.Contains(string(data), `"text":"BT /F1 12 Tf (Hello) Tj ET"`), string(data))
+
+			obj, err := DecodeJSON(data)
+			require.NoError(t, err)
+			decoded, ok := obj.(*PdfObjectStream)
+			require.True(t, ok)
+			require.Equal(t, stream.PdfObjectDictionary.WriteString(), decoded.PdfObjectDictionary.WriteString())
+			decodedContent, err := DecodeStream(decoded)
+			require.NoError(t, err)
+			require.Equal(t, content, decodedContent)
+		}
+	}
+
+	// Edited decoded data is encoded with the stream filters.
+	stream, err := DecodeJSON([]byte(`{"stream":{"dict":{"/Filter":"/FlateDecode","/Length":1},"text":"q Q"}}`))
+	require.NoError(t, err)
+	streamObj := stream.(*PdfObjectStream)
+	length, ok := GetIntVal(streamObj.Get("Length"))
+	require.True(t, ok)
+	require.Equal(t, len(streamObj.Stream), length)
+	decoded, err := DecodeStream(streamObj)
+	require.NoError(t, err)
+	require.Equal(t, "q Q", string(decoded))
+}
+
+func TestJSONInvalid(t *testing.T) {
+	for _, data := range []string{
+		``,
+		`"text"`,
+		`"/Name#4"`,
+		`"b:xyz"`,
+		`"0 0 R"`,
+		`{"Key":1}`,
+		`{"/Key":}`,
+		`[1, 2`,
+		`1 2`,
+		`{"stream":{"data":"!"}}`,
+		`{"stream":{"data":"","text":""}}`,
+		`{"stream":{"dict":{"/Filter":"/Unknown"},"text":""}}`,
+	} {
+		_, err := DecodeJSON([]byte(data))
+		require.Error(t, err, data)
+	}
+}
@@ -0,0 +1,102 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+
+type Limits struct {
+	MaxDecodedStreamSize int64
+
+	MaxNestingDepth int
+
+	MaxObjects int
+
+	MaxXrefChain int
+}
+
+
+var ErrLimitExceeded = errors.New("limit exceeded")
+
+
+type LimitError struct {
+	Limit string
+
+	Max int64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s: %s (max %d)", ErrLimitExceeded, e.Limit, e.Max)
+}
+
+func (e *LimitError) Unwrap() error {
+	return ErrLimitExceeded
+}
+
+
+func IsLimitExceeded(err error) bool {
+	return errors.Is(err, ErrLimitExceeded)
+}
+
+
+func isFatalError(err error) bool {
+	switch err.(type) {
+	case *DiagnosticError, *LimitError:
+		return true
+	}
+	return false
+}
+
+
+func (parser *PdfParser) enterNesting() error {
+	if max := parser.limits.MaxNestingDepth; max > 0 && parser.depth >= max {
+		return &LimitError{Limit: "nesting depth", Max: int64(max)}
+	}
+	parser.depth++
+	return nil
+}
+
+func (parser *PdfParser) leaveNesting() {
+	parser.depth--
+}
+
+
+func (parser *PdfParser) checkObjectCount(count int) error {
+	if max := parser.limits.MaxObjects; max > 0 && count > max {
+		return &LimitError{Limit: "object count", Max: int64(max)}
+	}
+	return nil
+}
+
+
+func (parser *PdfParser) checkXrefChain(sections int) error {
+	if max := parser.limits.MaxXrefChain; max > 0 && sections > max {
+		return &LimitError{Limit: "xref chain length", Max: int64(max)}
+	}
+	return nil
+}
+
+
+func readAllLimited(r io.Reader, max int64) ([]byte, error) {
+	var buf bytes.Buffer
+	if max <= 0 {
+		_, err := buf.ReadFrom(r)
+		return buf.Bytes(), err
+	}
+	n, err := buf.ReadFrom(io.LimitReader(r, max+1))
+	if n > max {
+		return nil, &LimitError{Limit: "decoded stream size", Max: max}
+	}
+	return buf.Bytes(), err
+}
+
+
+func checkDecodedSize(data []byte, max int64) error {
+	if max > 0 && int64(len(data)) > max {
+		return &LimitError{Limit: "decoded stream size", Max: max}
+	}
+	return nil
+}
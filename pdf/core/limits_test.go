@@ -0,0 +1,137 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// buildStreamObject returns a stream object with `data` encoded with `encoder`.
+func buildStreamObject(t *testing.T, encoder StreamEncoder, data []byte) string {
+	encoded, err := encoder.EncodeBytes(data)
+	require.NoError(t, err)
+	dict := encoder.MakeStreamDict()
+	dict.Set("Length", MakeInteger(int64(len(encoded))))
+	return fmt.Sprintf("%s\nstream\n%s\nendstream", dict.WriteString(), encoded)
+}
+
+// nestedArray returns `depth` nested arrays.
+func nestedArray(depth int) string {
+	return strings.Repeat("[", depth) + strings.Repeat("]", depth)
+}
+
+// appendXrefSections appends `count` incremental update sections to the file `data` built with
+// buildDiagnosticsTestPdf, each redefining object 1.
+func appendXrefSections(data []byte, numObjects int, count int) []byte {
+	var buf bytes.Buffer
+	buf.Write(data)
+	prev := bytes.LastIndex(data, []byte("xref\n"))
+	for i := 0; i < count; i++ {
+		offset := buf.Len()
+		fmt.Fprintf(&buf, "1 0 obj\n<< /Type /Catalog /Rev %d >>\nendobj\n", i)
+		xrefOffset := buf.Len()
+		fmt.Fprintf(&buf, "xref\n1 1\n%010d 00000 n\r\n", offset)
+		fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R /Prev %d >>\nstartxref\n%d\n%%%%EOF\n",
+			numObjects+1, prev, xrefOffset)
+		prev = xrefOffset
+	}
+	return buf.Bytes()
+}
+
+func TestLimitsDecodedStreamSize(t *testing.T) {
+	data := bytes.Repeat([]byte{0}, 100000)
+	lzw := NewLZWEncoder()
+	lzw.EarlyChange = 0
+	for _, encoder := range []StreamEncoder{NewFlateEncoder(), lzw} {
+		pdf, _ := buildDiagnosticsTestPdf([]string{
+			"<< /Type /Catalog >>",
+			buildStreamObject(t, encoder, data),
+		}, -1)
+
+		parser, err := NewParserWithOpts(bytes.NewReader(pdf), nil)
+		require.NoError(t, err)
+		obj, err := parser.LookupByNumber(2)
+		require.NoError(t, err)
+		decoded, err := DecodeStream(obj.(*PdfObjectStream))
+		require.NoError(t, err)
+		require.Equal(t, data, decoded)
+
+		opts := &ParserOpts{Limits: Limits{MaxDecodedStreamSize: 1000}}
+		parser, err = NewParserWithOpts(bytes.NewReader(pdf), opts)
+		require.NoError(t, err)
+		obj, err = parser.LookupByNumber(2)
+		require.NoError(t, err)
+		_, err = DecodeStream(obj.(*PdfObjectStream))
+		require.Error(t, err)
+		require.True(t, errors.Is(err, ErrLimitExceeded))
+		require.True(t, IsLimitExceeded(err))
+		lerr, ok := err.(*LimitError)
+		require.True(t, ok)
+		require.Equal(t, int64(1000), lerr.Max)
+	}
+}
+
+func TestLimitsNestingDepth(t *testing.T) {
+	pdf, _ := buildDiagnosticsTestPdf([]string{
+		"<< /Type /Catalog >>",
+		nestedArray(50),
+		"<< /A " + nestedArray(49) + " >>",
+		nestedArray(51),
+		"<< /A " + nestedArray(49) + " >>",
+	}, -1)
+
+	parser, err := NewParserWithOpts(bytes.NewReader(pdf), &ParserOpts{Limits: Limits{MaxNestingDepth: 50}})
+	require.NoError(t, err)
+
+	_, err = parser.LookupByNumber(2)
+	require.NoError(t, err)
+	_, err = parser.LookupByNumber(3)
+	require.NoError(t, err)
+	_, err = parser.LookupByNumber(4)
+	require.Error(t, err)
+	require.True(t, IsLimitExceeded(err))
+
+	// The rejected objects do not count in the nesting depth of the next objects.
+	for i := 0; i < 3; i++ {
+		_, err = parser.LookupByNumber(4)
+		require.True(t, IsLimitExceeded(err))
+	}
+	_, err = parser.LookupByNumber(5)
+	require.NoError(t, err)
+}
+
+func TestLimitsObjects(t *testing.T) {
+	objects := []string{"<< /Type /Catalog >>"}
+	for i := 0; i < 9; i++ {
+		objects = append(objects, "null")
+	}
+	pdf, _ := buildDiagnosticsTestPdf(objects, -1)
+
+	_, err := NewParserWithOpts(bytes.NewReader(pdf), &ParserOpts{Limits: Limits{MaxObjects: 10}})
+	require.NoError(t, err)
+
+	_, err = NewParserWithOpts(bytes.NewReader(pdf), &ParserOpts{Limits: Limits{MaxObjects: 9}})
+	require.Error(t, err)
+	require.True(t, IsLimitExceeded(err))
+}
+
+func TestLimitsXrefChain(t *testing.T) {
+	pdf, _ := buildDiagnosticsTestPdf([]string{"<< /Type /Catalog >>"}, -1)
+	pdf = appendXrefSections(pdf, 1, 3)
+
+	parser, err := NewParserWithOpts(bytes.NewReader(pdf), &ParserOpts{Limits: Limits{MaxXrefChain: 4}})
+	require.NoError(t, err)
+	obj, err := parser.LookupByNumber(1)
+	require.NoError(t, err)
+	dict, ok := GetDict(obj)
+	require.True(t, ok)
+	require.Equal(t, "2", dict.Get("Rev").String())
+
+	_, err = NewParserWithOpts(bytes.NewReader(pdf), &ParserOpts{Limits: Limits{MaxXrefChain: 3}})
+	require.Error(t, err)
+	require.True(t, IsLimitExceeded(err))
+}
@@ -0,0 +1,542 @@
+package core
+
+import (
+	"errors"
+	"io"
+	"math/bits"
+
+	"github.com/finalversus/doc/common"
+)
+
+
+type Linearization struct {
+	FileLength int64
+
+	HintOffset int64
+	HintLength int64
+
+	FirstPageObject int
+
+	FirstPageEnd int64
+
+	NumPages int
+
+	MainXrefOffset int64
+}
+
+
+func (parser *PdfParser) GetLinearization() *Linearization {
+	return parser.linearization
+}
+
+
+func (parser *PdfParser) loadLinearized() (bool, error) {
+	fSize, err := parser.rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return false, err
+	}
+	parser.fileSize = fSize
+
+	parser.SetFileOffset(0)
+	bb, _ := parser.reader.Peek(1024)
+	loc := reIndirectObject.FindIndex(bb)
+	if loc == nil {
+		return false, nil
+	}
+	parser.SetFileOffset(int64(loc[0]))
+	obj, err := parser.ParseIndirectObject()
+	if err != nil {
+		if isFatalError(err) {
+			return false, err
+		}
+		common.Log.Debug("Unable to parse first object: %v", err)
+		return false, nil
+	}
+	ind, ok := obj.(*PdfIndirectObject)
+	if !ok {
+		return false, nil
+	}
+	dict, ok := ind.PdfObject.(*PdfObjectDictionary)
+	if !ok || dict.Get("Linearized") == nil {
+		return false, nil
+	}
+
+	lin, err := newLinearization(dict)
+	if err != nil {
+		common.Log.Debug("Invalid linearization dictionary: %v", err)
+		return false, nil
+	}
+	if lin.FileLength != fSize {
+		common.Log.Debug("Linearized file length mismatch (%d != %d) - ignoring linearization", lin.FileLength, fSize)
+		return false, nil
+	}
+
+	parser.skipSpaces()
+	bb, _ = parser.reader.Peek(20)
+	if !reXrefTable.Match(bb) && !reIndirectObject.Match(bb) {
+		common.Log.Debug("First-page xref not found - ignoring linearization")
+		return false, nil
+	}
+
+	parser.xrefs.ObjectMap = make(map[int]XrefObject)
+	parser.objstms = make(objectStreams)
+	trailer, err := parser.parseXref()
+	if err == nil {
+		if xo, ok := trailer.Get("XRefStm").(*PdfObjectInteger); ok {
+			_, err = parser.parseXrefStream(xo)
+		}
+	}
+	if err != nil {
+		if isFatalError(err) {
+			return false, err
+		}
+		common.Log.Debug("Failed loading first-page xref: %v - ignoring linearization", err)
+		return false, nil
+	}
+
+	parser.trailer = trailer
+	parser.linearization = lin
+	parser.deferredXrefs = true
+	return true, nil
+}
+
+func newLinearization(dict *PdfObjectDictionary) (*Linearization, error) {
+	intVal := func(obj PdfObject) (int64, error) {
+		val, ok := GetIntVal(obj)
+		if !ok || val < 0 {
+			return 0, errors.New("invalid linearization parameter")
+		}
+		return int64(val), nil
+	}
+
+	lin := &Linearization{}
+	var err error
+	if lin.FileLength, err = intVal(dict.Get("L")); err != nil {
+		return nil, err
+	}
+	h, ok := GetArray(dict.Get("H"))
+	if !ok || h.Len() < 2 {
+		return nil, errors.New("invalid hint stream location")
+	}
+	if lin.HintOffset, err = intVal(h.Get(0)); err != nil {
+		return nil, err
+	}
+	if lin.HintLength, err = intVal(h.Get(1)); err != nil {
+		return nil, err
+	}
+	o, err := intVal(dict.Get("O"))
+	if err != nil {
+		return nil, err
+	}
+	lin.FirstPageObject = int(o)
+	if lin.FirstPageEnd, err = intVal(dict.Get("E")); err != nil {
+		return nil, err
+	}
+	n, err := intVal(dict.Get("N"))
+	if err != nil {
+		return nil, err
+	}
+	lin.NumPages = int(n)
+	if lin.MainXrefOffset, err = intVal(dict.Get("T")); err != nil {
+		return nil, err
+	}
+	return lin, nil
+}
+
+
+func (parser *PdfParser) loadDeferredXrefs() error {
+	if !parser.deferredXrefs {
+		return nil
+	}
+	parser.deferredXrefs = false
+	common.Log.Trace("Loading deferred xrefs")
+
+	firstPage := parser.xrefs.ObjectMap
+	parser.xrefs.sortedObjects = nil
+	if _, err := parser.loadXrefs(); err != nil {
+		common.Log.Debug("ERROR: Failed to load xref table! %s", err)
+		parser.xrefs.ObjectMap = firstPage
+		return err
+	}
+	return nil
+}
+
+
+func (parser *PdfParser) GetHintTables() (*PageOffsetHintTable, *SharedObjectHintTable, error) {
+	if parser.hintPages != nil {
+		return parser.hintPages, parser.hintShared, nil
+	}
+	lin := parser.linearization
+	if lin == nil {
+		return nil, nil, errors.New("not a linearized file")
+	}
+
+	hintNum := -1
+	for num, xref := range parser.xrefs.ObjectMap {
+		if xref.XType == XrefTypeTableEntry && xref.Offset == lin.HintOffset {
+			hintNum = num
+			break
+		}
+	}
+	if hintNum < 0 {
+		return nil, nil, errors.New("primary hint stream not found")
+	}
+	obj, err := parser.LookupByNumber(hintNum)
+	if err != nil {
+		return nil, nil, err
+	}
+	stream, ok := obj.(*PdfObjectStream)
+	if !ok {
+		return nil, nil, errors.New("primary hint stream not a stream")
+	}
+	data, err := DecodeStream(stream)
+	if err != nil {
+		return nil, nil, err
+	}
+	sharedOffset, ok := GetIntVal(stream.Get("S"))
+	if !ok {
+		return nil, nil, errors.New("missing shared object hint table offset")
+	}
+	pages, shared, err := DecodeHintTables(data, lin.NumPages, sharedOffset)
+	if err != nil {
+		return nil, nil, err
+	}
+	parser.hintPages, parser.hintShared = pages, shared
+	return pages, shared, nil
+}
+
+
+type PageOffsetHint struct {
+	NumObjects int
+
+	Length int64
+
+	SharedRefs []int
+
+	ContentOffset int64
+	ContentLength int64
+}
+
+
+type PageOffsetHintTable struct {
+	FirstPageOffset int64
+
+	Pages []PageOffsetHint
+}
+
+
+type SharedObjectHint struct {
+	Length int64
+
+	NumObjects int
+}
+
+
+type SharedObjectHintTable struct {
+	FirstObjectNumber int
+	FirstObjectOffset int64
+
+	NumFirstPage int
+
+	Groups []SharedObjectHint
+}
+
+
+func EncodeHintTables(pages *PageOffsetHintTable, shared *SharedObjectHintTable) ([]byte, int) {
+	w := &hintWriter{}
+	pages.encode(w)
+	sharedOffset := len(w.data)
+	shared.encode(w)
+	return w.data, sharedOffset
+}
+
+
+func DecodeHintTables(data []byte, numPages int, sharedOffset int) (*PageOffsetHintTable, *SharedObjectHintTable, error) {
+	if sharedOffset < 0 || sharedOffset > len(data) {
+		return nil, nil, errors.New("invalid shared object hint table offset")
+	}
+	pages := &PageOffsetHintTable{}
+	if err := pages.decode(&hintReader{data: data[:sharedOffset]}, numPages); err != nil {
+		return nil, nil, err
+	}
+	shared := &SharedObjectHintTable{}
+	if err := shared.decode(&hintReader{data: data[sharedOffset:]}); err != nil {
+		return nil, nil, err
+	}
+	return pages, shared, nil
+}
+
+func (t *PageOffsetHintTable) encode(w *hintWriter) {
+	var minObjs, maxObjs int
+	var minLen, maxLen, minCOff, maxCOff, minCLen, maxCLen int64
+	var maxRefs, maxRef int
+	for i, p := range t.Pages {
+		if i == 0 || p.NumObjects < minObjs {
+			minObjs = p.NumObjects
+		}
+		if p.NumObjects > maxObjs {
+			maxObjs = p.NumObjects
+		}
+		if i == 0 || p.Length < minLen {
+			minLen = p.Length
+		}
+		if p.Length > maxLen {
+			maxLen = p.Length
+		}
+		if i == 0 || p.ContentOffset < minCOff {
+			minCOff = p.ContentOffset
+		}
+		if p.ContentOffset > maxCOff {
+			maxCOff = p.ContentOffset
+		}
+		if i == 0 || p.ContentLength < minCLen {
+			minCLen = p.ContentLength
+		}
+		if p.ContentLength > maxCLen {
+			maxCLen = p.ContentLength
+		}
+		if len(p.SharedRefs) > maxRefs {
+			maxRefs = len(p.SharedRefs)
+		}
+		for _, ref := range p.SharedRefs {
+			if ref > maxRef {
+				maxRef = ref
+			}
+		}
+	}
+
+	bitsObjs := bitsNeeded(uint64(maxObjs - minObjs))
+	bitsLen := bitsNeeded(uint64(maxLen - minLen))
+	bitsCOff := bitsNeeded(uint64(maxCOff - minCOff))
+	bitsCLen := bitsNeeded(uint64(maxCLen - minCLen))
+	bitsRefs := bitsNeeded(uint64(maxRefs))
+	bitsRef := bitsNeeded(uint64(maxRef))
+
+	w.write(uint64(minObjs), 32)
+	w.write(uint64(t.FirstPageOffset), 32)
+	w.write(uint64(bitsObjs), 16)
+	w.write(uint64(minLen), 32)
+	w.write(uint64(bitsLen), 16)
+	w.write(uint64(minCOff), 32)
+	w.write(uint64(bitsCOff), 16)
+	w.write(uint64(minCLen), 32)
+	w.write(uint64(bitsCLen), 16)
+	w.write(uint64(bitsRefs), 16)
+	w.write(uint64(bitsRef), 16)
+	w.write(0, 16)
+	w.write(1, 16)
+
+	for _, p := range t.Pages {
+		w.write(uint64(p.NumObjects-minObjs), bitsObjs)
+	}
+	w.flush()
+	for _, p := range t.Pages {
+		w.write(uint64(p.Length-minLen), bitsLen)
+	}
+	w.flush()
+	for _, p := range t.Pages {
+		w.write(uint64(len(p.SharedRefs)), bitsRefs)
+	}
+	w.flush()
+	for _, p := range t.Pages {
+		for _, ref := range p.SharedRefs {
+			w.write(uint64(ref), bitsRef)
+		}
+	}
+	w.flush()
+	for _, p := range t.Pages {
+		w.write(uint64(p.ContentOffset-minCOff), bitsCOff)
+	}
+	w.flush()
+	for _, p := range t.Pages {
+		w.write(uint64(p.ContentLength-minCLen), bitsCLen)
+	}
+	w.flush()
+}
+
+func (t *PageOffsetHintTable) decode(r *hintReader, numPages int) error {
+	minObjs := int(r.read(32))
+	t.FirstPageOffset = int64(r.read(32))
+	bitsObjs := int(r.read(16))
+	minLen := int64(r.read(32))
+	bitsLen := int(r.read(16))
+	minCOff := int64(r.read(32))
+	bitsCOff := int(r.read(16))
+	minCLen := int64(r.read(32))
+	bitsCLen := int(r.read(16))
+	bitsRefs := int(r.read(16))
+	bitsRef := int(r.read(16))
+	bitsNum := int(r.read(16))
+	r.read(16)
+	if r.err != nil {
+		return r.err
+	}
+	if bitsObjs > 32 || bitsLen > 32 || bitsCOff > 32 || bitsCLen > 32 || bitsRefs > 32 || bitsRef > 32 || bitsNum > 32 {
+		return errors.New("invalid page offset hint table header")
+	}
+	if numPages < 0 || numPages > len(r.data)*8+1 {
+		return errors.New("invalid number of pages for page offset hint table")
+	}
+
+	t.Pages = make([]PageOffsetHint, numPages)
+	for i := range t.Pages {
+		t.Pages[i].NumObjects = minObjs + int(r.read(bitsObjs))
+	}
+	r.align()
+	for i := range t.Pages {
+		t.Pages[i].Length = minLen + int64(r.read(bitsLen))
+	}
+	r.align()
+	for i := range t.Pages {
+		t.Pages[i].SharedRefs = make([]int, r.read(bitsRefs))
+	}
+	r.align()
+	for i := range t.Pages {
+		for j := range t.Pages[i].SharedRefs {
+			t.Pages[i].SharedRefs[j] = int(r.read(bitsRef))
+		}
+	}
+	r.align()
+	for i := range t.Pages {
+		for range t.Pages[i].SharedRefs {
+			r.read(bitsNum)
+		}
+	}
+	r.align()
+	for i := range t.Pages {
+		t.Pages[i].ContentOffset = minCOff + int64(r.read(bitsCOff))
+	}
+	r.align()
+	for i := range t.Pages {
+		t.Pages[i].ContentLength = minCLen + int64(r.read(bitsCLen))
+	}
+	return r.err
+}
+
+func (t *SharedObjectHintTable) encode(w *hintWriter) {
+	var minLen, maxLen int64
+	var maxObjs int
+	for i, g := range t.Groups {
+		if i == 0 || g.Length < minLen {
+			minLen = g.Length
+		}
+		if g.Length > maxLen {
+			maxLen = g.Length
+		}
+		if g.NumObjects-1 > maxObjs {
+			maxObjs = g.NumObjects - 1
+		}
+	}
+	bitsObjs := bitsNeeded(uint64(maxObjs))
+	bitsLen := bitsNeeded(uint64(maxLen - minLen))
+
+	w.write(uint64(t.FirstObjectNumber), 32)
+	w.write(uint64(t.FirstObjectOffset), 32)
+	w.write(uint64(t.NumFirstPage), 32)
+	w.write(uint64(len(t.Groups)), 32)
+	w.write(uint64(bitsObjs), 16)
+	w.write(uint64(minLen), 32)
+	w.write(uint64(bitsLen), 16)
+
+	for _, g := range t.Groups {
+		w.write(uint64(g.Length-minLen), bitsLen)
+	}
+	w.flush()
+	for range t.Groups {
+		w.write(0, 1)
+	}
+	w.flush()
+	for _, g := range t.Groups {
+		w.write(uint64(g.NumObjects-1), bitsObjs)
+	}
+	w.flush()
+}
+
+func (t *SharedObjectHintTable) decode(r *hintReader) error {
+	t.FirstObjectNumber = int(r.read(32))
+	t.FirstObjectOffset = int64(r.read(32))
+	t.NumFirstPage = int(r.read(32))
+	numGroups := int(r.read(32))
+	bitsObjs := int(r.read(16))
+	minLen := int64(r.read(32))
+	bitsLen := int(r.read(16))
+	if r.err != nil {
+		return r.err
+	}
+	if bitsObjs > 32 || bitsLen > 32 || numGroups > len(r.data)*8 || t.NumFirstPage > numGroups {
+		return errors.New("invalid shared object hint table header")
+	}
+
+	t.Groups = make([]SharedObjectHint, numGroups)
+	for i := range t.Groups {
+		t.Groups[i].Length = minLen + int64(r.read(bitsLen))
+	}
+	r.align()
+	signed := make([]bool, numGroups)
+	for i := range t.Groups {
+		signed[i] = r.read(1) == 1
+	}
+	r.align()
+	for i := range t.Groups {
+		if signed[i] {
+			r.read(64)
+			r.read(64)
+		}
+	}
+	for i := range t.Groups {
+		t.Groups[i].NumObjects = int(r.read(bitsObjs)) + 1
+	}
+	return r.err
+}
+
+func bitsNeeded(v uint64) int {
+	return bits.Len64(v)
+}
+
+type hintWriter struct {
+	data  []byte
+	cur   byte
+	nbits uint
+}
+
+func (w *hintWriter) write(v uint64, n int) {
+	for i := n - 1; i >= 0; i-- {
+		w.cur = w.cur<<1 | byte(v>>uint(i)&1)
+		w.nbits++
+		if w.nbits == 8 {
+			w.data = append(w.data, w.cur)
+			w.cur, w.nbits = 0, 0
+		}
+	}
+}
+
+func (w *hintWriter) flush() {
+	if w.nbits > 0 {
+		w.data = append(w.data, w.cur<<(8-w.nbits))
+		w.cur, w.nbits = 0, 0
+	}
+}
+
+type hintReader struct {
+	data []byte
+	pos  uint
+	err  error
+}
+
+func (r *hintReader) read(n int) uint64 {
+	var v uint64
+	for i := 0; i < n; i++ {
+		idx := r.pos / 8
+		if idx >= uint(len(r.data)) {
+			r.err = errors.New("hint table truncated")
+			return 0
+		}
+		v = v<<1 | uint64(r.data[idx]>>(7-r.pos%8)&1)
+		r.pos++
+	}
+	return v
+}
+
+func (r *hintReader) align() {
+	r.pos = (r.pos + 7) / 8 * 8
+}
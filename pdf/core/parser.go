@@ -5,6 +5,8 @@ package core
 import (
 	"bufio"
 	"bytes"
+	"crypto"
+	"crypto/x509"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -45,6 +47,18 @@ type PdfParser struct {
 	repairsAttempted bool 
 
 	ObjCache objectCache
+	lru      *objectLRU
+
+	diagnostics []Diagnostic
+	strict      bool
+
+	limits Limits
+	depth  int
+
+	linearization *Linearization
+	deferredXrefs bool
+	hintPages     *PageOffsetHintTable
+	hintShared    *SharedObjectHintTable
 
 	
 	
@@ -87,6 +101,7 @@ func (parser *PdfParser) GetTrailer() *PdfObjectDictionary {
 
 
 func (parser *PdfParser) GetXrefTable() XrefTable {
+	parser.loadDeferredXrefs()
 	return parser.xrefs
 }
 
@@ -230,6 +245,9 @@ func (parser *PdfParser) parseName() (PdfObjectName, error) {
 				code, err := hex.DecodeString(string(hexcode[1:3]))
 				if err != nil {
 					common.Log.Debug("ERROR: Invalid hex following '#', continuing using literal - Output may be incorrect")
+					if derr := parser.diagnose(DiagnosticInvalidName, parser.GetFileOffset()-3, "invalid hex escape %q in name", hexcode); derr != nil {
+						return PdfObjectName(r.String()), derr
+					}
 					r.WriteByte('#') 
 					continue
 				}
@@ -446,6 +464,10 @@ func (parser *PdfParser) parseHexString() (*PdfObjectString, error) {
 
 func (parser *PdfParser) parseArray() (*PdfObjectArray, error) {
 	arr := MakeArray()
+	if err := parser.enterNesting(); err != nil {
+		return arr, err
+	}
+	defer parser.leaveNesting()
 
 	parser.reader.ReadByte()
 
@@ -620,6 +642,10 @@ func (parser *PdfParser) ParseDict() (*PdfObjectDictionary, error) {
 
 	dict := MakeDict()
 	dict.parser = parser
+	if err := parser.enterNesting(); err != nil {
+		return nil, err
+	}
+	defer parser.leaveNesting()
 
 	
 	c, _ := parser.reader.ReadByte()
@@ -712,7 +738,11 @@ func (parser *PdfParser) parsePdfVersion() (int, int, error) {
 		
 		
 		
-		parser.rs, err = newOffsetReader(parser.rs, parser.GetFileOffset()-8)
+		headerOffset := parser.GetFileOffset() - 8
+		if err := parser.diagnose(DiagnosticHeaderOffset, headerOffset, "PDF header not at start of file"); err != nil {
+			return 0, 0, err
+		}
+		parser.rs, err = newOffsetReader(parser.rs, headerOffset)
 		if err != nil {
 			return 0, 0, err
 		}
@@ -796,14 +826,21 @@ func (parser *PdfParser) parseXrefTable() (*PdfObjectDictionary, error) {
 				
 				
 				x, ok := parser.xrefs.ObjectMap[curObjNum]
-				if !ok || gen > x.Generation {
+				if (!ok || gen > x.Generation) && !parser.xrefs.isFree(curObjNum, gen) {
 					obj := XrefObject{ObjectNumber: curObjNum,
 						XType:  XrefTypeTableEntry,
 						Offset: first, Generation: gen}
 					parser.xrefs.ObjectMap[curObjNum] = obj
+					if err := parser.checkObjectCount(len(parser.xrefs.ObjectMap)); err != nil {
+						return nil, err
+					}
 				}
 			}
 
+			if strings.ToLower(third) == "f" && curObjNum > 0 {
+				parser.xrefs.markFree(curObjNum, gen)
+			}
+
 			curObjNum++
 			continue
 		}
@@ -980,6 +1017,9 @@ func (parser *PdfParser) parseXrefStream(xstm *PdfObjectInteger) (*PdfObjectDict
 	if entries == objCount+1 {
 		
 		common.Log.Debug("Incompatibility: Index missing coverage of 1 object - appending one - May lead to problems")
+		if err := parser.diagnose(DiagnosticXrefStream, xsOffset, "Index missing coverage of 1 object"); err != nil {
+			return nil, err
+		}
 		maxIndex := objCount - 1
 		for _, ind := range indexList {
 			if ind > maxIndex {
@@ -1055,7 +1095,10 @@ func (parser *PdfParser) parseXrefStream(xstm *PdfObjectInteger) (*PdfObjectDict
 
 		common.Log.Trace("%d. xref: %d %d %d", objNum, ftype, n2, n3)
 		if ftype == 0 {
-			common.Log.Trace("- Free object - can probably ignore")
+			common.Log.Trace("- Free object")
+			if objNum > 0 {
+				parser.xrefs.markFree(objNum, int(n3))
+			}
 		} else if ftype == 1 {
 			common.Log.Trace("- In use - uncompressed via offset %b", p2)
 			
@@ -1068,21 +1111,27 @@ func (parser *PdfParser) parseXrefStream(xstm *PdfObjectInteger) (*PdfObjectDict
 
 			
 			
-			if xr, ok := parser.xrefs.ObjectMap[objNum]; !ok || int(n3) > xr.Generation {
+			if xr, ok := parser.xrefs.ObjectMap[objNum]; (!ok || int(n3) > xr.Generation) && !parser.xrefs.isFree(objNum, int(n3)) {
 				
 				
 				obj := XrefObject{ObjectNumber: objNum,
 					XType: XrefTypeTableEntry, Offset: n2, Generation: int(n3)}
 				parser.xrefs.ObjectMap[objNum] = obj
+				if err := parser.checkObjectCount(len(parser.xrefs.ObjectMap)); err != nil {
+					return nil, err
+				}
 			}
 		} else if ftype == 2 {
 			
 			common.Log.Trace("- In use - compressed object")
-			if _, ok := parser.xrefs.ObjectMap[objNum]; !ok {
+			if _, ok := parser.xrefs.ObjectMap[objNum]; !ok && !parser.xrefs.isFree(objNum, 0) {
 				obj := XrefObject{ObjectNumber: objNum,
 					XType: XrefTypeObjectStream, OsObjNumber: int(n2), OsObjIndex: int(n3)}
 				parser.xrefs.ObjectMap[objNum] = obj
 				common.Log.Trace("entry: %+v", obj)
+				if err := parser.checkObjectCount(len(parser.xrefs.ObjectMap)); err != nil {
+					return nil, err
+				}
 			}
 		} else {
 			common.Log.Debug("ERROR: --------INVALID TYPE XrefStm invalid?-------")
@@ -1103,6 +1152,7 @@ func (parser *PdfParser) parseXrefStream(xstm *PdfObjectInteger) (*PdfObjectDict
 
 
 func (parser *PdfParser) parseXref() (*PdfObjectDictionary, error) {
+	xrefOffset := parser.GetFileOffset()
 	
 	
 	
@@ -1132,6 +1182,9 @@ func (parser *PdfParser) parseXref() (*PdfObjectDictionary, error) {
 	}
 
 	common.Log.Debug("Warning: Unable to find xref table or stream. Repair attempted: Looking for earliest xref from bottom.")
+	if err := parser.diagnose(DiagnosticXrefOffset, xrefOffset, "no xref table or stream at offset"); err != nil {
+		return nil, err
+	}
 	if err := parser.repairSeekXrefMarker(); err != nil {
 		common.Log.Debug("Repair failed - %v", err)
 		return nil, err
@@ -1201,6 +1254,7 @@ func (parser *PdfParser) seekToEOFMarker(fSize int64) error {
 
 func (parser *PdfParser) loadXrefs() (*PdfObjectDictionary, error) {
 	parser.xrefs.ObjectMap = make(map[int]XrefObject)
+	parser.xrefs.free = nil
 	parser.objstms = make(objectStreams)
 
 	
@@ -1257,6 +1311,9 @@ func (parser *PdfParser) loadXrefs() (*PdfObjectDictionary, error) {
 	if offsetXref > fSize {
 		common.Log.Debug("ERROR: Xref offset outside of file")
 		common.Log.Debug("Attempting repair")
+		if err := parser.diagnose(DiagnosticXrefOffset, offsetXref, "startxref offset outside of file (size %d)", fSize); err != nil {
+			return nil, err
+		}
 		offsetXref, err = parser.repairLocateXref()
 		if err != nil {
 			common.Log.Debug("ERROR: Repair attempt failed (%s)")
@@ -1298,13 +1355,22 @@ func (parser *PdfParser) loadXrefs() (*PdfObjectDictionary, error) {
 
 	
 	
+	sectionOffset := offsetXref
+	sections := 1
 	xx = trailerDict.Get("Prev")
 	for xx != nil {
+		sections++
+		if err := parser.checkXrefChain(sections); err != nil {
+			return nil, err
+		}
 		prevInt, ok := xx.(*PdfObjectInteger)
 		if !ok {
 			
 			
 			common.Log.Debug("Invalid Prev reference: Not a *PdfObjectInteger (%T)", xx)
+			if err := parser.diagnose(DiagnosticTrailer, sectionOffset, "invalid Prev entry (%T)", xx); err != nil {
+				return nil, err
+			}
 			return trailerDict, nil
 		}
 
@@ -1317,20 +1383,30 @@ func (parser *PdfParser) loadXrefs() (*PdfObjectDictionary, error) {
 
 		ptrailerDict, err := parser.parseXref()
 		if err != nil {
+			if isFatalError(err) {
+				return nil, err
+			}
 			common.Log.Debug("Warning: Error - Failed loading another (Prev) trailer")
 			common.Log.Debug("Attempting to continue by ignoring it")
+			if err := parser.diagnose(DiagnosticTrailer, int64(off), "failed loading Prev xref section: %v", err); err != nil {
+				return nil, err
+			}
 			break
 		}
+		sectionOffset = int64(off)
 
 		xx = ptrailerDict.Get("Prev")
-		if xx != nil {
-			prevoff := *(xx.(*PdfObjectInteger))
-			if intInSlice(int64(prevoff), prevList) {
+		if prevInt, ok := xx.(*PdfObjectInteger); ok {
+			prevoff := int64(*prevInt)
+			if intInSlice(prevoff, prevList) {
 				
 				common.Log.Debug("Preventing circular xref referencing")
+				if err := parser.diagnose(DiagnosticTrailer, sectionOffset, "circular Prev reference to %d", prevoff); err != nil {
+					return nil, err
+				}
 				break
 			}
-			prevList = append(prevList, int64(prevoff))
+			prevList = append(prevList, prevoff)
 		}
 	}
 
@@ -1437,6 +1513,7 @@ func (parser *PdfParser) ParseIndirectObject() (PdfObject, error) {
 	}
 	parser.reader.Discard(indices[0]) 
 	common.Log.Trace("Offsets % d", indices)
+	objOffset := parser.GetFileOffset()
 
 	
 	hlen := indices[1] - indices[0]
@@ -1502,6 +1579,9 @@ func (parser *PdfParser) ParseIndirectObject() (PdfObject, error) {
 							
 							
 							common.Log.Debug("Non-conformant PDF not ending stream line properly with EOL marker")
+							if err := parser.diagnose(DiagnosticStreamKeyword, parser.GetFileOffset(), "stream keyword of object %d not followed by EOL", on); err != nil {
+								return nil, err
+							}
 							discardBytes++
 						}
 						if bb[discardBytes] == '\r' {
@@ -1553,6 +1633,9 @@ func (parser *PdfParser) ParseIndirectObject() (PdfObject, error) {
 							return nil, errors.New("invalid stream length, going past boundaries")
 						}
 
+						if err := parser.diagnose(DiagnosticStreamLength, streamStartOffset, "stream Length %d of object %d runs past next object at %d, corrected to %d", streamLength, on, nextObjectOffset, newLength); err != nil {
+							return nil, err
+						}
 						common.Log.Debug("Attempting a length correction to %d...", newLength)
 						streamLength = PdfObjectInteger(newLength)
 						dict.Set("Length", MakeInteger(newLength))
@@ -1578,17 +1661,32 @@ func (parser *PdfParser) ParseIndirectObject() (PdfObject, error) {
 					streamobj.ObjectNumber = indirect.ObjectNumber
 					streamobj.GenerationNumber = indirect.GenerationNumber
 					streamobj.PdfObjectReference.parser = parser
+					streamobj.maxDecodedSize = parser.limits.MaxDecodedStreamSize
 
 					parser.skipSpaces()
-					parser.reader.Discard(9) 
+					if bb, _ := parser.reader.Peek(9); string(bb) == "endstream" {
+						parser.reader.Discard(9)
+					} else if err := parser.diagnose(DiagnosticMissingEndstream, parser.GetFileOffset(), "stream data of object %d not followed by endstream", on); err != nil {
+						return nil, err
+					}
 					parser.skipSpaces()
 					return &streamobj, nil
 				}
 			}
 
+			if indirect.PdfObject != nil {
+				if err := parser.diagnose(DiagnosticMissingEndobj, parser.GetFileOffset(), "object %d not terminated by endobj", on); err != nil {
+					return nil, err
+				}
+				break
+			}
+
 			indirect.PdfObject, err = parser.parseObject()
 			if indirect.PdfObject == nil {
 				common.Log.Debug("INCOMPATIBILITY: Indirect object not containing an object - assuming null object")
+				if derr := parser.diagnose(DiagnosticEmptyObject, objOffset, "object %d is empty", on); derr != nil {
+					return nil, derr
+				}
 				indirect.PdfObject = MakeNull()
 			}
 			return &indirect, err
@@ -1596,6 +1694,9 @@ func (parser *PdfParser) ParseIndirectObject() (PdfObject, error) {
 	}
 	if indirect.PdfObject == nil {
 		common.Log.Debug("INCOMPATIBILITY: Indirect object not containing an object - assuming null object")
+		if err := parser.diagnose(DiagnosticEmptyObject, objOffset, "object %d is empty", on); err != nil {
+			return nil, err
+		}
 		indirect.PdfObject = MakeNull()
 	}
 	common.Log.Trace("Returning indirect!")
@@ -1621,11 +1722,23 @@ func NewParserFromString(txt string) *PdfParser {
 
 
 func NewParser(rs io.ReadSeeker) (*PdfParser, error) {
+	return NewParserWithOpts(rs, nil)
+}
+
+
+func NewParserWithOpts(rs io.ReadSeeker, opts *ParserOpts) (*PdfParser, error) {
 	parser := &PdfParser{
 		rs:                                    rs,
 		ObjCache:                              make(objectCache),
 		streamLengthReferenceLookupInProgress: map[int64]bool{},
 	}
+	if opts != nil && opts.MaxCachedObjects > 0 {
+		parser.lru = newObjectLRU(opts.MaxCachedObjects)
+	}
+	if opts != nil {
+		parser.strict = opts.Strict
+		parser.limits = opts.Limits
+	}
 
 	
 	majorVersion, minorVersion, err := parser.parsePdfVersion()
@@ -1637,9 +1750,17 @@ func NewParser(rs io.ReadSeeker) (*PdfParser, error) {
 	parser.version.Minor = minorVersion
 
 	
-	if parser.trailer, err = parser.loadXrefs(); err != nil {
-		common.Log.Debug("ERROR: Failed to load xref table! %s", err)
-		return nil, err
+	linearized := false
+	if opts != nil && opts.UseLinearization {
+		if linearized, err = parser.loadLinearized(); err != nil {
+			return nil, err
+		}
+	}
+	if !linearized {
+		if parser.trailer, err = parser.loadXrefs(); err != nil {
+			common.Log.Debug("ERROR: Failed to load xref table! %s", err)
+			return nil, err
+		}
 	}
 	common.Log.Trace("Trailer: %s", parser.trailer)
 
@@ -1651,16 +1772,59 @@ func NewParser(rs io.ReadSeeker) (*PdfParser, error) {
 }
 
 
+func (parser *PdfParser) Clone() (*PdfParser, error) {
+	rs, err := cloneReadSeeker(parser.rs)
+	if err != nil {
+		return nil, err
+	}
+
+	xrefs := XrefTable{ObjectMap: make(map[int]XrefObject, len(parser.xrefs.ObjectMap))}
+	for objNum, xref := range parser.xrefs.ObjectMap {
+		xrefs.ObjectMap[objNum] = xref
+	}
+	trailer := MakeDict()
+	if parser.trailer != nil {
+		trailer.Merge(parser.trailer)
+	}
+
+	clone := &PdfParser{
+		version:                               parser.version,
+		rs:                                    rs,
+		reader:                                bufio.NewReader(rs),
+		fileSize:                              parser.fileSize,
+		xrefs:                                 xrefs,
+		objstms:                               make(objectStreams),
+		trailer:                               trailer,
+		repairsAttempted:                      parser.repairsAttempted,
+		ObjCache:                              make(objectCache),
+		strict:                                parser.strict,
+		limits:                                parser.limits,
+		linearization:                         parser.linearization,
+		deferredXrefs:                         parser.deferredXrefs,
+		hintPages:                             parser.hintPages,
+		hintShared:                            parser.hintShared,
+		streamLengthReferenceLookupInProgress: map[int64]bool{},
+	}
+	if parser.lru != nil {
+		clone.lru = newObjectLRU(parser.lru.max)
+	}
+	if parser.crypter != nil {
+		clone.crypter = parser.crypter.clone(clone)
+	}
+	return clone, nil
+}
+
+
 func (parser *PdfParser) resolveReference(ref *PdfObjectReference) (PdfObject, bool, error) {
 	cachedObj, isCached := parser.ObjCache[int(ref.ObjectNumber)]
 	if isCached {
+		parser.touchCache(cacheKey{objNum: int(ref.ObjectNumber)})
 		return cachedObj, true, nil
 	}
 	obj, err := parser.LookupByReference(*ref)
 	if err != nil {
 		return nil, false, err
 	}
-	parser.ObjCache[int(ref.ObjectNumber)] = obj
 	return obj, false, nil
 }
 
@@ -1762,6 +1926,14 @@ func (parser *PdfParser) Decrypt(password []byte) (bool, error) {
 
 
 
+func (parser *PdfParser) DecryptWithCertificate(cert *x509.Certificate, key crypto.PrivateKey) (bool, error) {
+	if parser.crypter == nil {
+		return false, errors.New("check encryption first")
+	}
+	return parser.crypter.authenticateCertificate(cert, key)
+}
+
+
 func (parser *PdfParser) CheckAccessRights(password []byte) (bool, security.Permissions, error) {
 	
 	if parser.crypter == nil {
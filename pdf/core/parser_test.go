@@ -6,7 +6,9 @@ import (
 	"encoding/hex"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	"sort"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -791,3 +793,46 @@ func TestPDFVersionParse(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, string(b), expected)
 }
+
+func TestParserObjectCacheLimit(t *testing.T) {
+	for _, path := range []string{"./testdata/minimal.pdf", "./testdata/x300.pdf"} {
+		data, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+
+		unbounded, err := NewParser(bytes.NewReader(data))
+		require.NoError(t, err)
+		require.Nil(t, unbounded.lru)
+
+		parser, err := NewParserWithOpts(bytes.NewReader(data), &ParserOpts{MaxCachedObjects: 2})
+		require.NoError(t, err)
+
+		var objNums []int
+		for objNum := range parser.xrefs.ObjectMap {
+			objNums = append(objNums, objNum)
+		}
+		sort.Ints(objNums)
+
+		for pass := 0; pass < 2; pass++ {
+			for _, objNum := range objNums {
+				expected, err := unbounded.LookupByNumber(objNum)
+				require.NoError(t, err)
+				obj, err := parser.LookupByNumber(objNum)
+				require.NoError(t, err)
+				require.Equal(t, cachedObjectString(expected), cachedObjectString(obj), "%s: object %d", path, objNum)
+
+				require.True(t, len(parser.ObjCache)+len(parser.objstms) <= 2)
+				require.True(t, parser.lru.order.Len() <= 2)
+			}
+		}
+	}
+}
+
+func cachedObjectString(obj PdfObject) string {
+	switch t := obj.(type) {
+	case *PdfIndirectObject:
+		return t.PdfObject.WriteString()
+	case *PdfObjectStream:
+		return t.PdfObjectDictionary.WriteString() + string(t.Stream)
+	}
+	return obj.WriteString()
+}
@@ -5,6 +5,8 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -59,6 +61,11 @@ type PdfObjectStream struct {
 	PdfObjectReference
 	*PdfObjectDictionary
 	Stream []byte
+
+	maxDecodedSize int64
+
+	source        io.Reader
+	sourceEncoder StreamEncoder
 }
 
 type PdfObjectStreams struct {
@@ -545,6 +552,12 @@ func (d *PdfObjectDictionary) WriteString() string {
 	return b.String()
 }
 
+func (d *PdfObjectDictionary) SortKeys() {
+	sort.Slice(d.keys, func(i, j int) bool {
+		return d.keys[i] < d.keys[j]
+	})
+}
+
 func (d *PdfObjectDictionary) Set(key PdfObjectName, val PdfObject) {
 	_, found := d.dict[key]
 	if !found {
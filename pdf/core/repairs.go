@@ -38,6 +38,9 @@ func (parser *PdfParser) repairLocateXref() (int64, error) {
 }
 
 func (parser *PdfParser) rebuildXrefTable() error {
+	if err := parser.loadDeferredXrefs(); err != nil {
+		return err
+	}
 	newXrefs := XrefTable{}
 	newXrefs.ObjectMap = map[int]XrefObject{}
 	for objNum, xref := range parser.xrefs.ObjectMap {
@@ -88,6 +91,7 @@ func (parser *PdfParser) repairRebuildXrefsTopDown() (*XrefTable, error) {
 		return nil, fmt.Errorf("repair failed")
 	}
 	parser.repairsAttempted = true
+	parser.deferredXrefs = false
 
 	parser.rs.Seek(0, os.SEEK_SET)
 	parser.reader = bufio.NewReader(parser.rs)
@@ -155,6 +159,9 @@ func (parser *PdfParser) repairRebuildXrefsTopDown() (*XrefTable, error) {
 				xrefEntry.Generation = int(genNum)
 				xrefEntry.Offset = objOffset
 				xrefTable.ObjectMap[objNum] = xrefEntry
+				if err := parser.checkObjectCount(len(xrefTable.ObjectMap)); err != nil {
+					return nil, err
+				}
 			}
 		}
 
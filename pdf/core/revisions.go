@@ -0,0 +1,237 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/finalversus/doc/common"
+)
+
+var reRevisionStartXref = regexp.MustCompile(`startxref\s+(\d+)\s*$`)
+
+const revisionScanChunkSize = 64 * 1024
+
+type Revision struct {
+	Offset int64
+
+	Length int64
+
+	XrefOffset int64
+
+	Trailer *PdfObjectDictionary
+
+	Added []int
+
+	Modified []int
+
+	Deleted []int
+}
+
+type revisionEnd struct {
+	end        int64
+	xrefOffset int64
+}
+
+func (parser *PdfParser) GetRevisions() ([]*Revision, error) {
+	fileSize, err := parser.rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	ends, err := parser.findRevisionEnds(fileSize)
+	if err != nil {
+		return nil, err
+	}
+
+	var revisions []*Revision
+	var prevObjects map[int]XrefObject
+	var offset int64
+	for _, end := range ends {
+		sub, err := NewParserWithOpts(newSectionReadSeeker(parser.rs, end.end), &ParserOpts{Strict: parser.strict, Limits: parser.limits})
+		if err != nil {
+			common.Log.Debug("Skipping revision candidate ending at %d: %v", end.end, err)
+			continue
+		}
+		trailer := sub.GetTrailer()
+		if trailer == nil {
+			continue
+		}
+		if prev, ok := GetIntVal(trailer.Get("Prev")); ok && int64(prev) >= end.end {
+			common.Log.Trace("Skipping revision candidate ending at %d: Prev %d after end", end.end, prev)
+			continue
+		}
+
+		rev := &Revision{
+			Offset:     offset,
+			Length:     end.end - offset,
+			XrefOffset: end.xrefOffset,
+			Trailer:    trailer,
+		}
+		rev.Added, rev.Modified, rev.Deleted = diffXrefObjects(prevObjects, sub.xrefs.ObjectMap)
+		revisions = append(revisions, rev)
+		prevObjects = sub.xrefs.ObjectMap
+		offset = end.end
+	}
+
+	if len(revisions) == 0 {
+		common.Log.Debug("No revision found - using the whole file")
+		added, _, _ := diffXrefObjects(nil, parser.xrefs.ObjectMap)
+		revisions = append(revisions, &Revision{
+			Length:  fileSize,
+			Trailer: parser.trailer,
+			Added:   added,
+		})
+	}
+	return revisions, nil
+}
+
+func (parser *PdfParser) RevisionReader(rev *Revision) io.ReadSeeker {
+	return newSectionReadSeeker(parser.rs, rev.Offset+rev.Length)
+}
+
+func (parser *PdfParser) findRevisionEnds(fileSize int64) ([]revisionEnd, error) {
+	marker := []byte("%%EOF")
+	buf := make([]byte, revisionScanChunkSize+len(marker)-1)
+
+	var ends []revisionEnd
+	for pos := int64(0); pos < fileSize; pos += revisionScanChunkSize {
+		n, err := parser.readAt(buf, pos)
+		if err != nil {
+			return nil, err
+		}
+		chunk := buf[:n]
+		for i := 0; ; {
+			idx := bytes.Index(chunk[i:], marker)
+			if idx < 0 || i+idx >= revisionScanChunkSize {
+				break
+			}
+			markerPos := pos + int64(i+idx)
+			i += idx + len(marker)
+
+			end, ok, err := parser.revisionEndAt(markerPos, fileSize)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				ends = append(ends, end)
+			}
+		}
+	}
+	return ends, nil
+}
+
+func (parser *PdfParser) revisionEndAt(markerPos, fileSize int64) (revisionEnd, bool, error) {
+	var end revisionEnd
+
+	start := markerPos - 64
+	if start < 0 {
+		start = 0
+	}
+	before := make([]byte, markerPos-start)
+	if _, err := parser.readAt(before, start); err != nil {
+		return end, false, err
+	}
+	result := reRevisionStartXref.FindSubmatch(before)
+	if len(result) < 2 {
+		return end, false, nil
+	}
+	xrefOffset, err := strconv.ParseInt(string(result[1]), 10, 64)
+	if err != nil || xrefOffset >= markerPos {
+		return end, false, nil
+	}
+
+	end.xrefOffset = xrefOffset
+	end.end = markerPos + 5
+	after := make([]byte, 2)
+	n, err := parser.readAt(after, end.end)
+	if err != nil {
+		return end, false, err
+	}
+	switch {
+	case n == 2 && after[0] == '\r' && after[1] == '\n':
+		end.end += 2
+	case n >= 1 && (after[0] == '\r' || after[0] == '\n'):
+		end.end++
+	}
+	return end, true, nil
+}
+
+func (parser *PdfParser) readAt(p []byte, offset int64) (int, error) {
+	if _, err := parser.rs.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := io.ReadFull(parser.rs, p)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	return n, err
+}
+
+func diffXrefObjects(prev, cur map[int]XrefObject) (added, modified, deleted []int) {
+	for objNum, xref := range cur {
+		prevXref, ok := prev[objNum]
+		switch {
+		case !ok:
+			added = append(added, objNum)
+		case prevXref != xref:
+			modified = append(modified, objNum)
+		}
+	}
+	for objNum := range prev {
+		if _, ok := cur[objNum]; !ok {
+			deleted = append(deleted, objNum)
+		}
+	}
+	sort.Ints(added)
+	sort.Ints(modified)
+	sort.Ints(deleted)
+	return added, modified, deleted
+}
+
+type sectionReadSeeker struct {
+	rs   io.ReadSeeker
+	size int64
+	pos  int64
+}
+
+func newSectionReadSeeker(rs io.ReadSeeker, size int64) io.ReadSeeker {
+	if ra, ok := rs.(io.ReaderAt); ok {
+		return io.NewSectionReader(ra, 0, size)
+	}
+	return &sectionReadSeeker{rs: rs, size: size}
+}
+
+func (s *sectionReadSeeker) Read(p []byte) (int, error) {
+	if s.pos >= s.size {
+		return 0, io.EOF
+	}
+	if max := s.size - s.pos; int64(len(p)) > max {
+		p = p[:max]
+	}
+	if _, err := s.rs.Seek(s.pos, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := s.rs.Read(p)
+	s.pos += int64(n)
+	return n, err
+}
+
+func (s *sectionReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += s.pos
+	case io.SeekEnd:
+		offset += s.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	s.pos = offset
+	return offset, nil
+}
@@ -0,0 +1,138 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// xrefEntry is a cross-reference table entry of a test revision. Objects with an empty body are
+// marked as free with generation `gen`.
+type xrefEntry struct {
+	objNum int
+	gen    int
+	body   string
+}
+
+// buildIncrementalPdf returns a PDF file with the revisions `revisions`, and the end offsets of
+// the revisions.
+func buildIncrementalPdf(revisions [][]xrefEntry) ([]byte, []int64) {
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+
+	var ends []int64
+	prevXref := -1
+	size := 0
+	for _, entries := range revisions {
+		offsets := map[int]int{}
+		for _, e := range entries {
+			if e.body != "" {
+				offsets[e.objNum] = buf.Len()
+				fmt.Fprintf(&buf, "%d %d obj\n%s\nendobj\n", e.objNum, e.gen, e.body)
+			}
+			if e.objNum >= size {
+				size = e.objNum + 1
+			}
+		}
+
+		xrefOffset := buf.Len()
+		buf.WriteString("xref\n")
+		sort.Slice(entries, func(i, j int) bool { return entries[i].objNum < entries[j].objNum })
+		if prevXref < 0 {
+			buf.WriteString("0 1\n0000000000 65535 f\r\n")
+		}
+		for _, e := range entries {
+			fmt.Fprintf(&buf, "%d 1\n", e.objNum)
+			if e.body != "" {
+				fmt.Fprintf(&buf, "%.10d %.5d n\r\n", offsets[e.objNum], e.gen)
+			} else {
+				fmt.Fprintf(&buf, "%.10d %.5d f\r\n", 0, e.gen)
+			}
+		}
+		fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R", size)
+		if prevXref >= 0 {
+			fmt.Fprintf(&buf, " /Prev %d", prevXref)
+		}
+		fmt.Fprintf(&buf, " >>\nstartxref\n%d\n%%%%EOF\n", xrefOffset)
+		ends = append(ends, int64(buf.Len()))
+		prevXref = xrefOffset
+	}
+	return buf.Bytes(), ends
+}
+
+func TestRevisions(t *testing.T) {
+	data, ends := buildIncrementalPdf([][]xrefEntry{
+		{
+			{1, 0, "<< /Type /Catalog /Pages 2 0 R >>"},
+			{2, 0, "<< /Type /Pages /Kids [3 0 R] /Count 1 >>"},
+			{3, 0, "<< /Type /Page /Parent 2 0 R /Contents (%%EOF) >>"},
+		},
+		{
+			{3, 0, "<< /Type /Page /Parent 2 0 R /Annots [4 0 R] >>"},
+			{4, 0, "<< /Type /Annot /Subtype /Text >>"},
+		},
+		{
+			{3, 0, "<< /Type /Page /Parent 2 0 R >>"},
+			{4, 1, ""},
+		},
+	})
+	// Data after the last revision is ignored.
+	data = append(data, "\n\n"...)
+
+	parser, err := NewParser(bytes.NewReader(data))
+	require.NoError(t, err)
+
+	// Objects deleted in a later revision are not loaded from an earlier one.
+	_, ok := parser.GetXrefTable().ObjectMap[4]
+	require.False(t, ok)
+
+	revisions, err := parser.GetRevisions()
+	require.NoError(t, err)
+	require.Len(t, revisions, 3)
+
+	expected := []struct {
+		added, modified, deleted []int
+	}{
+		{[]int{1, 2, 3}, nil, nil},
+		{[]int{4}, []int{3}, nil},
+		{nil, []int{3}, []int{4}},
+	}
+	var offset int64
+	for i, rev := range revisions {
+		require.Equal(t, offset, rev.Offset, "revision %d", i)
+		require.Equal(t, ends[i], rev.Offset+rev.Length, "revision %d", i)
+		require.Equal(t, expected[i].added, rev.Added, "revision %d", i)
+		require.Equal(t, expected[i].modified, rev.Modified, "revision %d", i)
+		require.Equal(t, expected[i].deleted, rev.Deleted, "revision %d", i)
+		offset = ends[i]
+
+		// The revision reader gives the document as of the revision.
+		revParser, err := NewParser(parser.RevisionReader(rev))
+		require.NoError(t, err)
+		page, err := revParser.LookupByNumber(3)
+		require.NoError(t, err)
+		dict, ok := GetDict(page)
+		require.True(t, ok)
+		require.Equal(t, i == 1, dict.Get("Annots") != nil, "revision %d", i)
+	}
+
+	// Readers without io.ReaderAt are supported.
+	parser, err = NewParser(readSeekerOnly{bytes.NewReader(data)})
+	require.NoError(t, err)
+	revisions, err = parser.GetRevisions()
+	require.NoError(t, err)
+	require.Len(t, revisions, 3)
+	revParser, err := NewParser(parser.RevisionReader(revisions[1]))
+	require.NoError(t, err)
+	_, ok = revParser.GetXrefTable().ObjectMap[4]
+	require.True(t, ok)
+}
+
+// readSeekerOnly is an io.ReadSeeker which does not implement io.ReaderAt.
+type readSeekerOnly struct {
+	io.ReadSeeker
+}
@@ -0,0 +1,235 @@
+package security
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"math/big"
+
+	"github.com/gunnsth/pkcs7"
+
+	"github.com/finalversus/doc/common"
+)
+
+const (
+	SubFilterPKCS7S3 = "adbe.pkcs7.s3"
+
+	SubFilterPKCS7S4 = "adbe.pkcs7.s4"
+
+	SubFilterPKCS7S5 = "adbe.pkcs7.s5"
+)
+
+const pubKeySeedLen = 20
+
+type PubKeyRecipient struct {
+	Certificate *x509.Certificate
+	Permissions Permissions
+}
+
+type PubKeyEncryptDict struct {
+	SubFilter string
+
+	Recipients      [][]byte
+	EncryptMetadata bool
+}
+
+func NewPubKeyHandler(length int) PubKeyHandler {
+	return PubKeyHandler{Length: length}
+}
+
+type PubKeyHandler struct {
+	Length int
+}
+
+func (h PubKeyHandler) GenerateParams(d *PubKeyEncryptDict, recipients []PubKeyRecipient) ([]byte, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("no recipients specified")
+	}
+	seed := make([]byte, pubKeySeedLen)
+	if _, err := rand.Read(seed); err != nil {
+		return nil, err
+	}
+
+	var perms []Permissions
+	groups := make(map[Permissions][]*x509.Certificate)
+	for _, r := range recipients {
+		if r.Certificate == nil {
+			return nil, errors.New("recipient without certificate")
+		}
+		if _, ok := groups[r.Permissions]; !ok {
+			perms = append(perms, r.Permissions)
+		}
+		groups[r.Permissions] = append(groups[r.Permissions], r.Certificate)
+	}
+
+	d.Recipients = d.Recipients[:0]
+	for _, p := range perms {
+		content := make([]byte, pubKeySeedLen+4)
+		copy(content, seed)
+		binary.BigEndian.PutUint32(content[pubKeySeedLen:], uint32(p))
+
+		env, err := encryptEnvelope(content, groups[p])
+		if err != nil {
+			return nil, err
+		}
+		d.Recipients = append(d.Recipients, env)
+	}
+	return h.fileKey(d, seed), nil
+}
+
+var (
+	oidData                = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidEnvelopedData       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 3}
+	oidRSAEncryption       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidAES256CBCEncryption = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+type envelopeContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type envelopedData struct {
+	Version              int
+	RecipientInfos       []envelopeRecipientInfo `asn1:"set"`
+	EncryptedContentInfo envelopeEncryptedContentInfo
+}
+
+type envelopeRecipientInfo struct {
+	Version                int
+	IssuerAndSerialNumber  envelopeIssuerAndSerial
+	KeyEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedKey           []byte
+}
+
+type envelopeIssuerAndSerial struct {
+	IssuerName   asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type envelopeEncryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedContent           asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+func encryptEnvelope(content []byte, certs []*x509.Certificate) ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	pad := aes.BlockSize - len(content)%aes.BlockSize
+	data := append(append([]byte{}, content...), bytes.Repeat([]byte{byte(pad)}, pad)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(data, data)
+	data, err = asn1.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	env := envelopedData{
+		EncryptedContentInfo: envelopeEncryptedContentInfo{
+			ContentType: oidData,
+			ContentEncryptionAlgorithm: pkix.AlgorithmIdentifier{
+				Algorithm:  oidAES256CBCEncryption,
+				Parameters: asn1.RawValue{Tag: asn1.TagOctetString, Bytes: iv},
+			},
+			EncryptedContent: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: data},
+		},
+	}
+	for _, cert := range certs {
+		pub, ok := cert.PublicKey.(*rsa.PublicKey)
+		if !ok {
+			return nil, errors.New("unsupported recipient public key algorithm")
+		}
+		encKey, err := rsa.EncryptPKCS1v15(rand.Reader, pub, key)
+		if err != nil {
+			return nil, err
+		}
+		env.RecipientInfos = append(env.RecipientInfos, envelopeRecipientInfo{
+			IssuerAndSerialNumber: envelopeIssuerAndSerial{
+				IssuerName:   asn1.RawValue{FullBytes: cert.RawIssuer},
+				SerialNumber: cert.SerialNumber,
+			},
+			KeyEncryptionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidRSAEncryption},
+			EncryptedKey:           encKey,
+		})
+	}
+	inner, err := asn1.Marshal(env)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(envelopeContentInfo{
+		ContentType: oidEnvelopedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: inner},
+	})
+}
+
+func (h PubKeyHandler) Authenticate(d *PubKeyEncryptDict, cert *x509.Certificate, key crypto.PrivateKey) ([]byte, Permissions, error) {
+	if cert == nil || key == nil {
+		return nil, 0, errors.New("certificate and private key required")
+	}
+	for i, r := range d.Recipients {
+		p7, err := pkcs7.Parse(r)
+		if err != nil {
+			common.Log.Debug("Invalid recipient %d: %v", i, err)
+			continue
+		}
+		content, err := p7.Decrypt(cert, key)
+		if err != nil {
+			common.Log.Trace("Recipient %d not decrypted: %v", i, err)
+			continue
+		}
+		var perm Permissions
+		switch len(content) {
+		case pubKeySeedLen:
+			perm = PermOwner
+		case pubKeySeedLen + 4:
+			perm = Permissions(binary.BigEndian.Uint32(content[pubKeySeedLen:]))
+		default:
+			common.Log.Debug("Invalid recipient %d content length: %d", i, len(content))
+			continue
+		}
+		return h.fileKey(d, content[:pubKeySeedLen]), perm, nil
+	}
+	return nil, 0, nil
+}
+
+func (h PubKeyHandler) fileKey(d *PubKeyEncryptDict, seed []byte) []byte {
+	var md hash.Hash
+	if h.Length > sha1.Size {
+		md = sha256.New()
+	} else {
+		md = sha1.New()
+	}
+	md.Write(seed)
+	for _, r := range d.Recipients {
+		md.Write(r)
+	}
+	if !d.EncryptMetadata {
+		md.Write([]byte{0xff, 0xff, 0xff, 0xff})
+	}
+	key := md.Sum(nil)
+	if h.Length > 0 && h.Length < len(key) {
+		key = key[:h.Length]
+	}
+	return key
+}
@@ -0,0 +1,135 @@
+package security
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/gunnsth/pkcs7"
+)
+
+func newTestRecipient(t *testing.T, serial int64) (*x509.Certificate, *rsa.PrivateKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "recipient"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func TestPubKeyHandler(t *testing.T) {
+	cert1, key1 := newTestRecipient(t, 1)
+	cert2, key2 := newTestRecipient(t, 2)
+	cert3, key3 := newTestRecipient(t, 3)
+
+	const perm2 = PermPrinting | PermAnnotate
+
+	for _, length := range []int{16, 32} {
+		for _, encMeta := range []bool{true, false} {
+			h := NewPubKeyHandler(length)
+			d := &PubKeyEncryptDict{SubFilter: SubFilterPKCS7S5, EncryptMetadata: encMeta}
+			fkey, err := h.GenerateParams(d, []PubKeyRecipient{
+				{Certificate: cert1, Permissions: PermOwner},
+				{Certificate: cert2, Permissions: perm2},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(fkey) != length {
+				t.Fatalf("key length %d, expected %d", len(fkey), length)
+			}
+			if len(d.Recipients) != 2 {
+				t.Fatalf("expected 2 recipient envelopes, got %d", len(d.Recipients))
+			}
+
+			for _, c := range []struct {
+				cert *x509.Certificate
+				key  *rsa.PrivateKey
+				perm Permissions
+			}{{cert1, key1, PermOwner}, {cert2, key2, perm2}} {
+				key, perm, err := h.Authenticate(d, c.cert, c.key)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(key, fkey) {
+					t.Fatalf("wrong file key: % x vs % x", key, fkey)
+				}
+				if perm != c.perm {
+					t.Fatalf("wrong permissions: %x vs %x", perm, c.perm)
+				}
+			}
+
+			key, perm, err := h.Authenticate(d, cert3, key3)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if key != nil || perm != 0 {
+				t.Fatalf("authenticated with a certificate which is not a recipient")
+			}
+
+			seed := make([]byte, pubKeySeedLen)
+			k1 := h.fileKey(d, seed)
+			d.EncryptMetadata = !encMeta
+			if bytes.Equal(h.fileKey(d, seed), k1) {
+				t.Fatalf("EncryptMetadata does not affect the file key")
+			}
+		}
+	}
+}
+
+func TestPubKeyEnvelope(t *testing.T) {
+	cert, key := newTestRecipient(t, 1)
+	alg := pkcs7.ContentEncryptionAlgorithm
+
+	content := []byte("0123456789abcdef0123")
+	env, err := encryptEnvelope(content, []*x509.Certificate{cert})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkcs7.ContentEncryptionAlgorithm != alg {
+		t.Fatalf("global content encryption algorithm changed")
+	}
+
+	var info envelopeContentInfo
+	if _, err := asn1.Unmarshal(env, &info); err != nil {
+		t.Fatal(err)
+	}
+	var ed envelopedData
+	if _, err := asn1.Unmarshal(info.Content.Bytes, &ed); err != nil {
+		t.Fatal(err)
+	}
+	if a := ed.EncryptedContentInfo.ContentEncryptionAlgorithm.Algorithm; !a.Equal(oidAES256CBCEncryption) {
+		t.Fatalf("wrong content encryption algorithm: %v", a)
+	}
+
+	p7, err := pkcs7.Parse(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := p7.Decrypt(cert, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Fatalf("wrong content: % x", data)
+	}
+}
@@ -1,7 +1,10 @@
 package core
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"io/ioutil"
 
 	"github.com/finalversus/doc/common"
 )
@@ -62,9 +65,9 @@ func NewEncoderFromStream(streamObj *PdfObjectStream) (StreamEncoder, error) {
 	} else if *method == StreamEncodingFilterNameCCITTFax {
 		return newCCITTFaxEncoderFromStream(streamObj, nil)
 	} else if *method == StreamEncodingFilterNameJBIG2 {
-		return NewJBIG2Encoder(), nil
+		return newJBIG2EncoderFromStream(streamObj, nil)
 	} else if *method == StreamEncodingFilterNameJPX {
-		return NewJPXEncoder(), nil
+		return newJPXEncoderFromStream(streamObj, nil)
 	} else {
 		common.Log.Debug("ERROR: Unsupported encoding method!")
 		return nil, fmt.Errorf("unsupported encoding method (%s)", *method)
@@ -74,6 +77,10 @@ func NewEncoderFromStream(streamObj *PdfObjectStream) (StreamEncoder, error) {
 func DecodeStream(streamObj *PdfObjectStream) ([]byte, error) {
 	common.Log.Trace("Decode stream")
 
+	if err := LoadStream(streamObj); err != nil {
+		return nil, err
+	}
+
 	encoder, err := NewEncoderFromStream(streamObj)
 	if err != nil {
 		common.Log.Debug("ERROR: Stream decoding failed: %v", err)
@@ -86,6 +93,9 @@ func DecodeStream(streamObj *PdfObjectStream) ([]byte, error) {
 		common.Log.Debug("ERROR: Stream decoding failed: %v", err)
 		return nil, err
 	}
+	if err := checkDecodedSize(decoded, streamObj.maxDecodedSize); err != nil {
+		return nil, err
+	}
 
 	return decoded, nil
 }
@@ -118,3 +128,100 @@ func EncodeStream(streamObj *PdfObjectStream) error {
 
 	return nil
 }
+
+func NewStreamReader(streamObj *PdfObjectStream) (io.Reader, error) {
+	if err := LoadStream(streamObj); err != nil {
+		return nil, err
+	}
+
+	encoder, err := NewEncoderFromStream(streamObj)
+	if err != nil {
+		common.Log.Debug("ERROR: Stream decoding failed: %v", err)
+		return nil, err
+	}
+
+	r, err := encoder.DecodeReader(bytes.NewReader(streamObj.Stream))
+	if err != nil {
+		common.Log.Debug("ERROR: Stream decoding failed: %v", err)
+		return nil, err
+	}
+
+	return newLimitReader(r, streamObj.maxDecodedSize), nil
+}
+
+func MakeStreamFromReader(r io.Reader, encoder StreamEncoder) (*PdfObjectStream, error) {
+	if encoder == nil {
+		encoder = NewRawEncoder()
+	}
+
+	if _, err := encoder.EncodeWriter(ioutil.Discard); err != nil {
+		return nil, err
+	}
+
+	stream := &PdfObjectStream{}
+	stream.PdfObjectDictionary = encoder.MakeStreamDict()
+	stream.PdfObjectDictionary.Set("Length", MakeIndirectObject(MakeInteger(0)))
+	stream.source = r
+	stream.sourceEncoder = encoder
+	return stream, nil
+}
+
+func WriteStream(w io.Writer, streamObj *PdfObjectStream) (int64, error) {
+	if streamObj.source == nil {
+		n, err := w.Write(streamObj.Stream)
+		return int64(n), err
+	}
+
+	cw := &countingWriter{w: w}
+	err := encodeStreamSource(cw, streamObj)
+	setStreamLength(streamObj, cw.n)
+	return cw.n, err
+}
+
+func LoadStream(streamObj *PdfObjectStream) error {
+	if streamObj.source == nil {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	if err := encodeStreamSource(&buf, streamObj); err != nil {
+		return err
+	}
+	streamObj.Stream = buf.Bytes()
+	setStreamLength(streamObj, int64(buf.Len()))
+	return nil
+}
+
+func encodeStreamSource(w io.Writer, streamObj *PdfObjectStream) error {
+	source := streamObj.source
+	streamObj.source = nil
+
+	ew, err := streamObj.sourceEncoder.EncodeWriter(w)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(ew, source); err != nil {
+		ew.Close()
+		return err
+	}
+	return ew.Close()
+}
+
+func setStreamLength(streamObj *PdfObjectStream, length int64) {
+	if ind, ok := streamObj.PdfObjectDictionary.Get("Length").(*PdfIndirectObject); ok {
+		ind.PdfObject = MakeInteger(length)
+		return
+	}
+	streamObj.PdfObjectDictionary.Set("Length", MakeInteger(length))
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	return n, err
+}
@@ -24,10 +24,14 @@ func checkBounds(sliceLen, a, b int) error {
 }
 
 func (parser *PdfParser) Inspect() (map[string]int, error) {
+	if err := parser.loadDeferredXrefs(); err != nil {
+		return nil, err
+	}
 	return parser.inspect()
 }
 
 func (parser *PdfParser) GetObjectNums() []int {
+	parser.loadDeferredXrefs()
 	var objNums []int
 	for _, x := range parser.xrefs.ObjectMap {
 		objNums = append(objNums, x.ObjectNumber)
@@ -41,6 +41,10 @@ type Block struct {
 
 	// Block annotations.
 	annotations []*model.PdfAnnotation
+
+	// Root of the structure nodes of the contents drawn on the block, tagged when the block is
+	// drawn (see newStructTemplate).
+	structRoot *structNode
 }
 
 // NewBlock creates a new Block with specified width and height.
@@ -169,6 +173,17 @@ func (blk *Block) GeneratePageBlocks(ctx DrawContext) ([]*Block, DrawContext, er
 		blocks = append(blocks, dup)
 	}
 
+	// The contents drawn on the block are tagged with the nodes of the context. In tagging mode,
+	// the blocks drawn as artifacts (e.g. page headers) and the blocks without marked contents
+	// (e.g. imported pages) are artifacts.
+	if blk.structRoot != nil {
+		blk.structRoot.instantiate(blocks, ctx.structNode)
+	}
+	node := ctx.structNode
+	if node != nil && (node.isArtifact || blk.structRoot == nil && !hasMarkedContent(blk.contents)) {
+		node.artifact().wrap(blocks)
+	}
+
 	return blocks, ctx, nil
 }
 
@@ -307,7 +322,22 @@ func (blk *Block) drawToPage(page *model.PdfPage) error {
 
 // Draw draws the drawable d on the block.
 // Note that the drawable must not wrap, i.e. only return one block. Otherwise an error is returned.
+// In tagging mode (see Creator.EnableTagging), the contents are tagged when the block is drawn.
 func (blk *Block) Draw(d Drawable) error {
+	return blk.drawTagged(d, blk.structContext())
+}
+
+// structContext returns the root of the structure nodes of the contents drawn on the block.
+func (blk *Block) structContext() *structNode {
+	if blk.structRoot == nil {
+		blk.structRoot = newStructTemplate()
+	}
+	return blk.structRoot
+}
+
+// drawTagged draws the drawable d on the block like Draw, with the structure tree node `node` in
+// tagging mode.
+func (blk *Block) drawTagged(d Drawable, node *structNode) error {
 	ctx := DrawContext{}
 	ctx.Width = blk.width
 	ctx.Height = blk.height
@@ -315,6 +345,7 @@ func (blk *Block) Draw(d Drawable) error {
 	ctx.PageHeight = blk.height
 	ctx.X = 0 // Upper left corner of block
 	ctx.Y = 0
+	ctx.structNode = node
 
 	blocks, _, err := d.GeneratePageBlocks(ctx)
 	if err != nil {
@@ -336,7 +367,15 @@ func (blk *Block) Draw(d Drawable) error {
 }
 
 // DrawWithContext draws the Block using the specified drawing context.
+// In tagging mode (see Creator.EnableTagging), the contents are tagged when the block is drawn.
 func (blk *Block) DrawWithContext(d Drawable, ctx DrawContext) error {
+	ctx.structNode = blk.structContext()
+	return blk.drawWithContext(d, ctx)
+}
+
+// drawWithContext draws the drawable d on the block using the specified drawing context, with
+// the structure tree node of the context.
+func (blk *Block) drawWithContext(d Drawable, ctx DrawContext) error {
 	blocks, _, err := d.GeneratePageBlocks(ctx)
 	if err != nil {
 		return err
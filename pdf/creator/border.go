@@ -368,5 +368,6 @@ func (border *border) GeneratePageBlocks(ctx DrawContext) ([]*Block, DrawContext
 		}
 	}
 
+	ctx.structNode.artifact().wrap([]*Block{block})
 	return []*Block{block}, ctx, nil
 }
@@ -58,6 +58,13 @@ type Chapter struct {
 
 	// The level of the chapter in the chapters hierarchy.
 	level uint
+
+	// The named destination of the chapter (see SetDestinationName).
+	destName string
+
+	// The page (starting at 1) and position of the chapter heading, set when the chapter is drawn.
+	destPage     int64
+	destX, destY float64
 }
 
 // newChapter creates a new chapter with the specified title as the heading.
@@ -109,6 +116,12 @@ func (chap *Chapter) SetIncludeInTOC(includeInTOC bool) {
 	chap.includeInTOC = includeInTOC
 }
 
+// SetDestinationName sets the name of the named destination of the chapter, which points to the
+// chapter heading. The destination can be used by external links, e.g. file.pdf#nameddest=name.
+func (chap *Chapter) SetDestinationName(name string) {
+	chap.destName = name
+}
+
 // GetHeading returns the chapter heading paragraph. Used to give access to address style: font, sizing etc.
 func (chap *Chapter) GetHeading() *Paragraph {
 	return chap.heading
@@ -189,17 +202,24 @@ func (chap *Chapter) GeneratePageBlocks(ctx DrawContext) ([]*Block, DrawContext,
 		ctx.Height -= chap.margins.top
 	}
 
+	// In tagging mode, the chapter is a section starting with its heading.
+	sect := origCtx.structNode.child("Sect")
+	ctx.structNode = sect.child(headingStructType(chap.level))
+
 	blocks, c, err := chap.heading.GeneratePageBlocks(ctx)
 	if err != nil {
 		return blocks, ctx, err
 	}
 	ctx = c
+	ctx.structNode = sect
 
 	// Generate chapter title and number.
 	posX := ctx.X
 	posY := ctx.Y - chap.heading.Height()
 	page := int64(ctx.Page)
 
+	chap.destPage, chap.destX, chap.destY = page, posX, posY
+
 	chapNumber := chap.headingNumber()
 	chapTitle := chap.headingText()
 
@@ -250,6 +270,7 @@ func (chap *Chapter) GeneratePageBlocks(ctx DrawContext) ([]*Block, DrawContext,
 		// Move back X to same start of line.
 		ctx.X = origCtx.X
 	}
+	ctx.structNode = origCtx.structNode
 
 	if chap.positioning.isAbsolute() {
 		// If absolute: return original context.
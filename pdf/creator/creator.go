@@ -10,7 +10,9 @@ import (
 	"strconv"
 
 	"github.com/finalversus/doc/common"
+	"github.com/finalversus/doc/pdf/core"
 	"github.com/finalversus/doc/pdf/model"
+	"github.com/finalversus/doc/pdf/model/xmp"
 )
 
 // Creator is a wrapper around functionality for creating PDF reports and/or adding new
@@ -30,6 +32,25 @@ type Creator struct {
 	// Keep track of number of chapters for indexing.
 	chapters int
 
+	// The chapters created by the creator (see NewChapter), used for the named destinations.
+	chapterList []*Chapter
+
+	// Named destinations of the chapters, set when finalizing.
+	namedDests map[string]*model.PdfDestination
+
+	// Viewer settings of the document (empty or nil for the defaults).
+	pageMode    model.PageMode
+	pageLayout  model.PageLayout
+	viewerPrefs *model.ViewerPreferences
+	openAction  *model.PdfAction
+	openDest    *model.PdfDestination
+
+	// Document-level attachments (see AddAttachment).
+	attachments []*model.PdfFileSpec
+
+	// Structure tree builder in tagging mode (nil if disabled).
+	tagger *structTagger
+
 	// Hooks.
 	genFrontPageFunc      func(args FrontpageFunctionArgs)
 	genTableOfContentFunc func(toc *TOC) error
@@ -48,6 +69,12 @@ type Creator struct {
 	// Controls whether outlines will be generated.
 	AddOutlines bool
 
+	// Page label ranges (see SetPageLabels).
+	pageLabels []model.PdfPageLabelRange
+
+	// Controls whether the table of contents shows the page labels instead of the page numbers.
+	TOCPageLabels bool
+
 	// Outline.
 	outline *model.Outline
 
@@ -56,6 +83,13 @@ type Creator struct {
 
 	optimizer model.Optimizer
 
+	// Deterministic output options (nil if disabled).
+	deterministic *model.DeterministicOpts
+
+	// Document information and XMP metadata (nil for the defaults).
+	info *model.PdfInfo
+	xmp  *xmp.Document
+
 	// Default fonts used by all components instantiated through the creator.
 	defaultFontRegular *model.PdfFont
 	defaultFontBold    *model.PdfFont
@@ -139,6 +173,123 @@ func (c *Creator) SetOptimizer(optimizer model.Optimizer) {
 	c.optimizer = optimizer
 }
 
+// SetDeterministic enables the deterministic output mode, in which identical inputs yield
+// byte-identical PDF files (see model.PdfWriter.SetDeterministic). If `opts` is nil, the
+// default options are used.
+func (c *Creator) SetDeterministic(opts *model.DeterministicOpts) {
+	if opts == nil {
+		opts = &model.DeterministicOpts{}
+	}
+	c.deterministic = opts
+}
+
+// SetDocInfo sets the document information dictionary of the output document (see
+// model.PdfWriter.SetDocInfo).
+func (c *Creator) SetDocInfo(info *model.PdfInfo) {
+	c.info = info
+}
+
+// SetXMP sets the XMP metadata of the output document, which is synchronized with the document
+// information dictionary when writing (see model.PdfWriter.SetXMP).
+func (c *Creator) SetXMP(doc *xmp.Document) {
+	c.xmp = doc
+}
+
+// SetPageLabels sets the page label ranges of the output document (see
+// model.PdfWriter.SetPageLabels). The page indices include the front page and the table of
+// contents pages. Set TOCPageLabels to use the labels in the table of contents.
+func (c *Creator) SetPageLabels(ranges []model.PdfPageLabelRange) {
+	c.pageLabels = ranges
+}
+
+// SetPageMode sets the page mode of the output document, e.g. model.PageModeUseOutlines to
+// show the outline panel when the document is opened.
+func (c *Creator) SetPageMode(mode model.PageMode) {
+	c.pageMode = mode
+}
+
+// SetPageLayout sets the page layout of the output document.
+func (c *Creator) SetPageLayout(layout model.PageLayout) {
+	c.pageLayout = layout
+}
+
+// SetViewerPreferences sets the viewer preferences of the output document.
+func (c *Creator) SetViewerPreferences(prefs *model.ViewerPreferences) {
+	c.viewerPrefs = prefs
+}
+
+// SetOpenAction sets the action performed when the output document is opened.
+func (c *Creator) SetOpenAction(action *model.PdfAction) {
+	c.openAction = action
+	c.openDest = nil
+}
+
+// SetOpenDestination sets the destination displayed when the output document is opened. The
+// page of `dest` is a zero-based page index, including the front page and the table of contents
+// pages.
+func (c *Creator) SetOpenDestination(dest *model.PdfDestination) {
+	c.openDest = dest
+	c.openAction = nil
+}
+
+// AddAttachment adds the document-level attachment `fs` to the output document, replacing any
+// attachment with the same file name.
+func (c *Creator) AddAttachment(fs *model.PdfFileSpec) error {
+	if fs == nil || fs.FileName == "" {
+		return errors.New("attachment without file name")
+	}
+	c.RemoveAttachment(fs.FileName)
+	c.attachments = append(c.attachments, fs)
+	return nil
+}
+
+// RemoveAttachment removes the attachment named `fileName` added with AddAttachment and returns
+// false if there is none.
+func (c *Creator) RemoveAttachment(fileName string) bool {
+	for i, fs := range c.attachments {
+		if fs.FileName == fileName {
+			c.attachments = append(c.attachments[:i], c.attachments[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// AddFileAttachmentAnnotation adds a file attachment annotation of the file `fs` to the current
+// page. The icon is drawn in the rectangle at position (`x`, `y`) from the top left corner of the
+// page with dimensions `width` and `height`.
+func (c *Creator) AddFileAttachmentAnnotation(fs *model.PdfFileSpec, x, y, width, height float64) error {
+	page := c.getActivePage()
+	if page == nil {
+		return errors.New("no page to annotate")
+	}
+	mbox, err := page.GetMediaBox()
+	if err != nil {
+		return err
+	}
+	top := mbox.Ury - y
+	page.AddFileAttachmentAnnotation(fs, &model.PdfRectangle{
+		Llx: mbox.Llx + x,
+		Lly: top - height,
+		Urx: mbox.Llx + x + width,
+		Ury: top,
+	})
+	return nil
+}
+
+// EnableTagging enables the tagging mode, in which the output document is a tagged PDF document
+// as required for accessibility (e.g. PDF/UA): the contents drawn afterwards are marked and
+// organized in a structure tree, with a Document element containing paragraphs (P), chapter
+// sections (Sect) with headings (H1-H6), tables (Table, TR, TH, TD), lists (L, LI, Lbl, LBody),
+// figures (Figure) and links (Link). The contents drawn on blocks with Block.Draw are tagged where
+// the blocks are drawn. Graphics, page headers and footers, and repeated table headers are marked
+// as artifacts. The natural language of the document is `lang`, e.g. "en-US", and the alternate
+// descriptions of the images are set with Image.SetAltText.
+func (c *Creator) EnableTagging(lang string) {
+	c.tagger = newStructTagger(lang)
+	c.context.structNode = c.tagger.document
+}
+
 // GetOptimizer returns current PDF optimizer.
 func (c *Creator) GetOptimizer() model.Optimizer {
 	return c.optimizer
@@ -358,6 +509,10 @@ func (c *Creator) finalize() error {
 		genpages += len(blocks)
 
 		// Update the table of content Page numbers, accounting for front Page and TOC.
+		var labels []string
+		if c.TOCPageLabels && c.pageLabels != nil {
+			labels = model.FormatPageLabels(c.pageLabels, totPages+genpages)
+		}
 		lines := c.toc.Lines()
 		for _, line := range lines {
 			pageNum, err := strconv.Atoi(line.Page.Text)
@@ -366,6 +521,9 @@ func (c *Creator) finalize() error {
 			}
 
 			line.Page.Text = strconv.Itoa(pageNum + genpages)
+			if idx := pageNum + genpages - 1; idx >= 0 && idx < len(labels) {
+				line.Page.Text = labels[idx]
+			}
 		}
 	}
 
@@ -382,7 +540,13 @@ func (c *Creator) finalize() error {
 			PageNum:    1,
 			TotalPages: totPages,
 		}
+		if c.tagger != nil {
+			c.context.structNode = c.tagger.section(-2)
+		}
 		c.genFrontPageFunc(args)
+		if c.tagger != nil {
+			c.context.structNode = c.tagger.document
+		}
 		hasFrontPage = true
 	}
 
@@ -404,7 +568,11 @@ func (c *Creator) finalize() error {
 
 		// Create TOC pages.
 		var tocpages []*model.PdfPage
-		blocks, _, _ := c.toc.GeneratePageBlocks(c.context)
+		tocCtx := c.context
+		if c.tagger != nil {
+			tocCtx.structNode = c.tagger.section(-1)
+		}
+		blocks, _, _ := c.toc.GeneratePageBlocks(tocCtx)
 
 		for _, block := range blocks {
 			block.SetPos(0, 0)
@@ -464,6 +632,34 @@ func (c *Creator) finalize() error {
 		}
 	}
 
+	// Named destinations of the chapters.
+	var addChapterDests func(chap *Chapter)
+	addChapterDests = func(chap *Chapter) {
+		if chap.destName != "" && chap.destPage > 0 {
+			dest, _ := model.NewPdfDestination(
+				core.MakeInteger(chap.destPage-1+int64(genpages)),
+				model.DestinationXYZ,
+				chap.destX, c.pageHeight-chap.destY, 0,
+			)
+			if c.namedDests == nil {
+				c.namedDests = map[string]*model.PdfDestination{}
+			}
+			c.namedDests[chap.destName] = dest
+		}
+		for _, d := range chap.contents {
+			if subchap, ok := d.(*Chapter); ok {
+				addChapterDests(subchap)
+			}
+		}
+	}
+	for _, chap := range c.chapterList {
+		addChapterDests(chap)
+	}
+
+	// Page headers and footers are pagination artifacts.
+	if c.tagger != nil {
+		c.context.structNode = c.tagger.pagination()
+	}
 	for idx, page := range c.pages {
 		c.setActivePage(page)
 		if c.drawHeaderFunc != nil {
@@ -501,6 +697,9 @@ func (c *Creator) finalize() error {
 			}
 		}
 	}
+	if c.tagger != nil {
+		c.context.structNode = c.tagger.document
+	}
 
 	c.finalized = true
 
@@ -552,6 +751,9 @@ func (c *Creator) Draw(d Drawable) error {
 		}
 
 		p := c.getActivePage()
+		if c.tagger != nil {
+			c.tagger.place(blk, p)
+		}
 		err := blk.drawToPage(p)
 		if err != nil {
 			return err
@@ -574,6 +776,20 @@ func (c *Creator) Write(ws io.Writer) error {
 
 	pdfWriter := model.NewPdfWriter()
 	pdfWriter.SetOptimizer(c.optimizer)
+	if c.deterministic != nil {
+		pdfWriter.SetDeterministic(c.deterministic)
+	}
+	if c.info != nil {
+		pdfWriter.SetDocInfo(c.info)
+	}
+	if c.xmp != nil {
+		pdfWriter.SetXMP(c.xmp)
+	}
+	if c.pageLabels != nil {
+		if err := pdfWriter.SetPageLabels(c.pageLabels); err != nil {
+			return err
+		}
+	}
 
 	// Form fields.
 	if c.acroForm != nil {
@@ -584,6 +800,56 @@ func (c *Creator) Write(ws io.Writer) error {
 		}
 	}
 
+	// Viewer settings.
+	if c.pageMode != "" {
+		pdfWriter.SetPageMode(c.pageMode)
+	}
+	if c.pageLayout != "" {
+		pdfWriter.SetPageLayout(c.pageLayout)
+	}
+	if c.viewerPrefs != nil {
+		pdfWriter.SetViewerPreferences(c.viewerPrefs)
+	}
+	if c.openAction != nil {
+		if err := pdfWriter.SetOpenAction(c.openAction); err != nil {
+			return err
+		}
+	}
+	if c.openDest != nil {
+		if err := pdfWriter.SetOpenDestination(c.openDest); err != nil {
+			return err
+		}
+	}
+
+	// Logical structure.
+	if c.tagger != nil {
+		root, err := c.tagger.finish(c.pages)
+		if err != nil {
+			return err
+		}
+		if root != nil {
+			pdfWriter.SetStructTreeRoot(root)
+			pdfWriter.SetMarkInfo(&model.PdfMarkInfo{Marked: true})
+		}
+		if c.tagger.lang != "" {
+			pdfWriter.SetLanguage(c.tagger.lang)
+		}
+	}
+
+	// Attachments.
+	for _, fs := range c.attachments {
+		if err := pdfWriter.AddAttachment(fs); err != nil {
+			return err
+		}
+	}
+
+	// Named destinations.
+	for name, dest := range c.namedDests {
+		if err := pdfWriter.AddNamedDestination(name, dest); err != nil {
+			return err
+		}
+	}
+
 	// Outlines.
 	if c.outline != nil && c.AddOutlines {
 		pdfWriter.AddOutlineTree(&c.outline.ToPdfOutline().PdfOutlineTreeNode)
@@ -713,7 +979,9 @@ func (c *Creator) NewChapter(title string) *Chapter {
 	style := c.NewTextStyle()
 	style.FontSize = 16
 
-	return newChapter(nil, c.toc, c.outline, title, c.chapters, style)
+	chapter := newChapter(nil, c.toc, c.outline, title, c.chapters, style)
+	c.chapterList = append(c.chapterList, chapter)
+	return chapter
 }
 
 // NewInvoice returns an instance of an empty invoice.
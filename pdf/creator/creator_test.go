@@ -19,6 +19,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/boombuler/barcode"
 	"github.com/boombuler/barcode/qr"
@@ -29,6 +30,7 @@ import (
 	"github.com/finalversus/doc/pdf/core"
 	"github.com/finalversus/doc/pdf/model"
 	"github.com/finalversus/doc/pdf/model/optimize"
+	"github.com/finalversus/doc/pdf/model/xmp"
 )
 
 func init() {
@@ -2963,6 +2965,178 @@ func TestCreatorStable(t *testing.T) {
 	}
 }
 
+func TestCreatorDeterministic(t *testing.T) {
+	writePDF := func() []byte {
+		c := New()
+		c.SetDeterministic(&model.DeterministicOpts{
+			CreationDate: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		})
+		c.SetOptimizer(optimize.New(optimize.Options{
+			CombineDuplicateDirectObjects:   true,
+			CombineIdenticalIndirectObjects: true,
+			CombineDuplicateStreams:         true,
+			UseObjectStreams:                true,
+		}))
+
+		font, err := model.NewCompositePdfFontFromTTFFile(testFreeSansTTFFile)
+		require.NoError(t, err)
+
+		for i := 0; i < 3; i++ {
+			c.NewPage()
+			p := c.NewParagraph("Hello ÆØÅ")
+			p.SetFont(font)
+			require.NoError(t, c.Draw(p))
+
+			table := c.NewTable(2)
+			for j := 0; j < 4; j++ {
+				require.NoError(t, table.NewCell().SetContent(c.NewParagraph("cell")))
+			}
+			require.NoError(t, c.Draw(table))
+		}
+
+		var buf bytes.Buffer
+		require.NoError(t, c.Write(&buf))
+		return buf.Bytes()
+	}
+
+	expected := writePDF()
+	for i := 0; i < 10; i++ {
+		require.Equal(t, expected, writePDF())
+	}
+	require.Regexp(t, `/ID \[<[0-9a-f]{32}> <[0-9a-f]{32}>\]`, string(expected))
+}
+
+func TestCreatorXMP(t *testing.T) {
+	c := New()
+	c.SetDeterministic(&model.DeterministicOpts{
+		CreationDate: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+	})
+	info := model.NewPdfInfo()
+	info.Title = model.NewPdfInfoText("Report")
+	info.Author = model.NewPdfInfoText("Author")
+	c.SetDocInfo(info)
+	doc := xmp.NewDocument()
+	doc.DublinCore.Title.SetDefault("Outdated")
+	doc.SetProperty("http://example.com/ns/", "id", xmp.NewText("42"))
+	c.SetXMP(doc)
+	require.NoError(t, c.Draw(c.NewParagraph("Hello")))
+
+	var buf bytes.Buffer
+	require.NoError(t, c.Write(&buf))
+	reader, err := model.NewPdfReader(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+
+	readDoc, err := reader.GetXMP()
+	require.NoError(t, err)
+	require.NotNil(t, readDoc)
+	require.Equal(t, "Report", readDoc.DublinCore.Title.Default())
+	require.Equal(t, []string{"Author"}, readDoc.DublinCore.Creator)
+	require.True(t, time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC).Equal(readDoc.Basic.CreateDate))
+	id, ok := readDoc.GetProperty("http://example.com/ns/", "id")
+	require.True(t, ok)
+	require.Equal(t, "42", id.Text)
+}
+
+func TestChapterNamedDestinations(t *testing.T) {
+	c := New()
+	c.AddTOC = true
+
+	ch1 := c.NewChapter("Introduction")
+	ch1.SetDestinationName("intro")
+	ch1.Add(c.NewParagraph("Introduction text"))
+	sub := ch1.NewSubchapter("Scope")
+	sub.SetDestinationName("scope")
+	require.NoError(t, c.Draw(ch1))
+
+	c.NewPage()
+	ch2 := c.NewChapter("Results")
+	ch2.SetDestinationName("results")
+	require.NoError(t, c.Draw(ch2))
+
+	var buf bytes.Buffer
+	require.NoError(t, c.Write(&buf))
+	reader, err := model.NewPdfReader(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+
+	names, err := reader.GetNamedDestinationNames()
+	require.NoError(t, err)
+	require.Equal(t, []string{"intro", "results", "scope"}, names)
+
+	// The chapters start after the table of contents page.
+	for name, pageNum := range map[string]int{"intro": 2, "scope": 2, "results": 3} {
+		dest, err := reader.GetNamedDestination(name)
+		require.NoError(t, err)
+		require.Equal(t, model.DestinationXYZ, dest.Type)
+		num, err := reader.GetDestinationPageNumber(dest)
+		require.NoError(t, err)
+		require.Equal(t, pageNum, num, name)
+	}
+
+	intro, err := reader.GetNamedDestination("intro")
+	require.NoError(t, err)
+	scope, err := reader.GetNamedDestination("scope")
+	require.NoError(t, err)
+	require.Greater(t, *intro.Top, *scope.Top)
+}
+
+func TestCreatorViewerSettings(t *testing.T) {
+	c := New()
+	c.AddOutlines = true
+	c.SetPageMode(model.PageModeUseOutlines)
+	c.SetPageLayout(model.PageLayoutOneColumn)
+	c.SetViewerPreferences(&model.ViewerPreferences{DisplayDocTitle: true})
+	dest, err := model.NewPdfDestination(core.MakeInteger(0), model.DestinationFit)
+	require.NoError(t, err)
+	c.SetOpenDestination(dest)
+	require.NoError(t, c.Draw(c.NewChapter("Introduction")))
+
+	var buf bytes.Buffer
+	require.NoError(t, c.Write(&buf))
+	reader, err := model.NewPdfReader(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+
+	require.Equal(t, model.PageModeUseOutlines, reader.GetPageMode())
+	require.Equal(t, model.PageLayoutOneColumn, reader.GetPageLayout())
+	prefs, err := reader.GetViewerPreferences()
+	require.NoError(t, err)
+	require.True(t, prefs.DisplayDocTitle)
+	action, err := reader.GetOpenAction()
+	require.NoError(t, err)
+	require.Equal(t, model.ActionTypeGoTo, action.GetType())
+}
+
+func TestCreatorAttachments(t *testing.T) {
+	c := New()
+	require.Error(t, c.AddFileAttachmentAnnotation(model.NewPdfFileSpec("a.txt", nil), 0, 0, 10, 10))
+	c.NewPage()
+
+	audit := model.NewPdfFileSpec("audit.log", model.NewEmbeddedFile([]byte("entry"), "text/plain"))
+	require.NoError(t, c.AddAttachment(audit))
+	require.NoError(t, c.AddAttachment(model.NewPdfFileSpec("tmp.txt", model.NewEmbeddedFile(nil, ""))))
+	require.True(t, c.RemoveAttachment("tmp.txt"))
+	require.NoError(t, c.AddFileAttachmentAnnotation(audit, 10, 20, 16, 16))
+
+	var buf bytes.Buffer
+	require.NoError(t, c.Write(&buf))
+	reader, err := model.NewPdfReader(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+
+	attachments, err := reader.GetAttachments()
+	require.NoError(t, err)
+	require.Len(t, attachments, 1)
+	require.Equal(t, "audit.log", attachments[0].FileName)
+	require.Equal(t, []byte("entry"), attachments[0].File.Content)
+
+	page, err := reader.GetPage(1)
+	require.NoError(t, err)
+	annots, err := page.GetAnnotations()
+	require.NoError(t, err)
+	require.Len(t, annots, 1)
+	rect, err := model.NewPdfRectangle(*annots[0].Rect.(*core.PdfObjectArray))
+	require.NoError(t, err)
+	require.Equal(t, model.PdfRectangle{Llx: 10, Lly: c.Height() - 36, Urx: 26, Ury: c.Height() - 20}, *rect)
+}
+
 var errRenderNotSupported = errors.New("rendering pdf is not supported on this system")
 
 // renderPDFToPNGs uses ghostscript (gs) to render specified PDF file into a set of PNG images (one per page).
@@ -3130,3 +3304,173 @@ func copyFile(src, dst string) error {
 	_, err = io.Copy(out, in)
 	return err
 }
+
+func TestCreatorTagging(t *testing.T) {
+	c := New()
+	c.EnableTagging("en-US")
+	c.AddTOC = true
+	c.DrawFooter(func(footer *Block, args FooterFunctionArgs) {
+		p := c.NewParagraph(fmt.Sprintf("Page %d", args.PageNum))
+		p.SetPos(50, 10)
+		footer.Draw(p)
+	})
+
+	ch := c.NewChapter("Introduction")
+	ch.Add(c.NewParagraph("Accessible documents are tagged."))
+	table := c.NewTable(2)
+	for _, text := range []string{"Name", "Value", "Width", "10"} {
+		cell := table.NewCell()
+		cell.SetBorder(CellBorderSideAll, CellBorderStyleSingle, 1)
+		cell.SetContent(c.NewParagraph(text))
+	}
+	require.NoError(t, table.SetHeaderRows(1, 1))
+	ch.Add(table)
+	img, err := c.NewImageFromFile(testImageFile1)
+	require.NoError(t, err)
+	img.ScaleToWidth(100)
+	img.SetAltText("Company logo")
+	ch.Add(img)
+	require.NoError(t, c.Draw(ch))
+
+	list := c.NewList()
+	_, _, err = list.AddTextItem("First item")
+	require.NoError(t, err)
+	_, _, err = list.AddTextItem("Second item")
+	require.NoError(t, err)
+	require.NoError(t, c.Draw(list))
+
+	sp := c.NewStyledParagraph()
+	sp.Append("See ")
+	sp.AddExternalLink("the website", "https://example.com")
+	require.NoError(t, c.Draw(sp))
+	require.NoError(t, c.Draw(c.NewRectangle(10, 10, 20, 20)))
+
+	var buf bytes.Buffer
+	require.NoError(t, c.Write(&buf))
+	reader, err := model.NewPdfReader(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+
+	info, err := reader.GetMarkInfo()
+	require.NoError(t, err)
+	require.Equal(t, &model.PdfMarkInfo{Marked: true}, info)
+	require.Equal(t, "en-US", reader.GetLanguage())
+
+	root, err := reader.GetStructTreeRoot()
+	require.NoError(t, err)
+	require.NotNil(t, root)
+	var types []string
+	err = root.Walk(func(elem *model.PdfStructElem, depth int) error {
+		types = append(types, strings.Repeat(" ", depth)+elem.StandardType())
+		return nil
+	})
+	require.NoError(t, err)
+	tocLinks := []string{"     Link", "     Link", "     Link", "     Link", "     Link"}
+	expected := append([]string{"Document", " Div", "  TOC", "   Caption", "   TOCI", "    P"}, tocLinks...)
+	expected = append(expected,
+		" Sect", "  H1", "  P",
+		"  Table", "   TR", "    TH", "     P", "    TH", "     P", "   TR", "    TD", "     P", "    TD", "     P",
+		"  Figure",
+		" L", "  LI", "   Lbl", "   LBody", "    P", "  LI", "   Lbl", "   LBody", "    P",
+		" P", "  Link")
+	require.Equal(t, expected, types)
+
+	// The TOC is on the first page and the contents on the second page.
+	page, err := reader.GetPage(2)
+	require.NoError(t, err)
+	require.Equal(t, "/S", page.Tabs.WriteString())
+	doc := root.Kids[0]
+	sect := doc.GetElems()[1]
+	heading, err := root.GetElemForMCID(page, 0)
+	require.NoError(t, err)
+	require.Equal(t, sect.GetElems()[0], heading)
+	figure := sect.GetElems()[3]
+	require.Equal(t, "Company logo", figure.Alt)
+
+	link := doc.GetElems()[3].GetElems()[0]
+	require.Len(t, link.Kids, 2)
+	require.Equal(t, model.StructKidObject, link.Kids[1].Type)
+	annots, err := page.GetAnnotations()
+	require.NoError(t, err)
+	require.Len(t, annots, 1)
+	require.Equal(t, annots[0], link.Kids[1].Annotation)
+	key, ok := core.GetIntVal(annots[0].StructParent)
+	require.True(t, ok)
+	elem, err := root.GetElemForStructParent(key)
+	require.NoError(t, err)
+	require.Equal(t, link, elem)
+}
+
+func TestCreatorTaggingBlock(t *testing.T) {
+	write := func(c *Creator) (*model.PdfReader, string) {
+		var buf bytes.Buffer
+		require.NoError(t, c.Write(&buf))
+		reader, err := model.NewPdfReader(bytes.NewReader(buf.Bytes()))
+		require.NoError(t, err)
+		page, err := reader.GetPage(1)
+		require.NoError(t, err)
+		contents, err := page.GetAllContentStreams()
+		require.NoError(t, err)
+		return reader, contents
+	}
+
+	// The contents drawn on a block are tagged where the block is drawn, and the contents of the
+	// page footers are artifacts.
+	c := New()
+	c.EnableTagging("en-US")
+	blk := NewBlock(200, 100)
+	require.NoError(t, blk.Draw(c.NewParagraph("Drawn in a block")))
+	require.NoError(t, blk.Draw(c.NewRectangle(0, 0, 10, 10)))
+	require.NoError(t, c.Draw(blk))
+	require.NoError(t, c.Draw(c.NewParagraph("Tagged paragraph")))
+	require.NoError(t, c.Draw(blk))
+	c.DrawFooter(func(footer *Block, args FooterFunctionArgs) {
+		require.NoError(t, footer.Draw(c.NewParagraph("Footer")))
+	})
+
+	reader, contents := write(c)
+	require.Equal(t, 3, strings.Count(contents, "/P <<"))
+	require.Equal(t, 2, strings.Count(contents, "/Artifact BMC"))
+	require.Equal(t, 1, strings.Count(contents, "/Artifact <<"))
+	require.Contains(t, contents, "/Pagination")
+	root, err := reader.GetStructTreeRoot()
+	require.NoError(t, err)
+	require.NotNil(t, root)
+	var types []string
+	err = root.Walk(func(elem *model.PdfStructElem, depth int) error {
+		types = append(types, strings.Repeat(" ", depth)+elem.StandardType())
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"Document", " P", " P", " P"}, types)
+	info, err := reader.GetMarkInfo()
+	require.NoError(t, err)
+	require.Equal(t, &model.PdfMarkInfo{Marked: true}, info)
+
+	// The untagged contents of a block are artifacts, and the document has no structure tree if
+	// nothing was tagged.
+	c = New()
+	c.EnableTagging("en-US")
+	blk = NewBlock(200, 100)
+	require.NoError(t, blk.addContentsByString("0 0 10 10 re f"))
+	require.NoError(t, c.Draw(blk))
+
+	reader, contents = write(c)
+	require.Contains(t, contents, "/Artifact BMC")
+	root, err = reader.GetStructTreeRoot()
+	require.NoError(t, err)
+	require.Nil(t, root)
+	info, err = reader.GetMarkInfo()
+	require.NoError(t, err)
+	require.Nil(t, info)
+	require.Equal(t, "en-US", reader.GetLanguage())
+
+	// Without tagging, the contents drawn on blocks are not marked.
+	c = New()
+	blk = NewBlock(200, 100)
+	require.NoError(t, blk.Draw(c.NewParagraph("Drawn in a block")))
+	require.NoError(t, c.Draw(blk))
+
+	_, contents = write(c)
+	require.NotContains(t, contents, "BDC")
+	require.NotContains(t, contents, "BMC")
+}
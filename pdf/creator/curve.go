@@ -64,5 +64,6 @@ func (c *Curve) GeneratePageBlocks(ctx DrawContext) ([]*Block, DrawContext, erro
 	if err != nil {
 		return nil, ctx, err
 	}
+	ctx.structNode.artifact().wrap([]*Block{block})
 	return []*Block{block}, ctx, nil
 }
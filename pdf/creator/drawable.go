@@ -43,4 +43,7 @@ type DrawContext struct {
 
 	// Controls whether the components are stacked horizontally
 	Inline bool
+
+	// Structure tree node of the drawn contents in tagging mode (nil if disabled).
+	structNode *structNode
 }
@@ -87,5 +87,6 @@ func (ell *Ellipse) GeneratePageBlocks(ctx DrawContext) ([]*Block, DrawContext,
 		return nil, ctx, err
 	}
 
+	ctx.structNode.artifact().wrap([]*Block{block})
 	return []*Block{block}, ctx, nil
 }
@@ -105,5 +105,6 @@ func (fc *FilledCurve) GeneratePageBlocks(ctx DrawContext) ([]*Block, DrawContex
 	if err != nil {
 		return nil, ctx, err
 	}
+	ctx.structNode.artifact().wrap([]*Block{block})
 	return []*Block{block}, ctx, nil
 }
@@ -50,6 +50,9 @@ type Image struct {
 
 	// Encoder
 	encoder core.StreamEncoder
+
+	// Alternate description of the image in tagging mode.
+	altText string
 }
 
 // newImage create a new image from a Document image (model.Image).
@@ -221,6 +224,8 @@ func (img *Image) GeneratePageBlocks(ctx DrawContext) ([]*Block, DrawContext, er
 
 	blocks = append(blocks, blk)
 
+	origCtx.structNode.child("Figure").setAlt(img.altText).wrap(blocks)
+
 	if img.positioning.isAbsolute() {
 		// Absolute drawing should not affect context.
 		ctx = origCtx
@@ -233,6 +238,12 @@ func (img *Image) GeneratePageBlocks(ctx DrawContext) ([]*Block, DrawContext, er
 	return blocks, ctx, nil
 }
 
+// SetAltText sets the alternate description of the image, which is the description of its
+// Figure structure element in tagging mode (see Creator.EnableTagging).
+func (img *Image) SetAltText(text string) {
+	img.altText = text
+}
+
 // SetPos sets the absolute position. Changes object positioning to absolute.
 func (img *Image) SetPos(x, y float64) {
 	img.positioning = positionAbsolute
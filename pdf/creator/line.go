@@ -83,5 +83,6 @@ func (l *Line) GeneratePageBlocks(ctx DrawContext) ([]*Block, DrawContext, error
 		return nil, ctx, err
 	}
 
+	ctx.structNode.artifact().wrap([]*Block{block})
 	return []*Block{block}, ctx, nil
 }
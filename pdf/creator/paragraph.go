@@ -386,6 +386,7 @@ func (p *Paragraph) GeneratePageBlocks(ctx DrawContext) ([]*Block, DrawContext,
 	}
 
 	blocks = append(blocks, blk)
+	origContext.structNode.content("P").wrap(blocks)
 	if p.positioning.isRelative() {
 		ctx.X -= p.margins.left // Move back.
 		ctx.Width = origContext.Width
@@ -75,5 +75,6 @@ func (rect *Rectangle) GeneratePageBlocks(ctx DrawContext) ([]*Block, DrawContex
 		return nil, ctx, err
 	}
 
+	ctx.structNode.artifact().wrap([]*Block{block})
 	return []*Block{block}, ctx, nil
 }
@@ -498,6 +498,11 @@ func drawStyledParagraphOnBlock(blk *Block, p *StyledParagraph, ctx DrawContext)
 
 	cc.Add_BT()
 
+	// In tagging mode, the text is a paragraph with links to the annotations of the chunks.
+	// `mark` is the node of the current marked-content sequence.
+	node := ctx.structNode.content("P")
+	var mark *structNode
+
 	currY := yPos
 	for idx, line := range p.lines {
 		currX := ctx.X
@@ -595,6 +600,16 @@ func drawStyledParagraphOnBlock(blk *Block, p *StyledParagraph, ctx DrawContext)
 		for k, chunk := range line {
 			style := &chunk.Style
 
+			chunkMark := node
+			if chunk.annotation != nil {
+				chunkMark = node.child("Link")
+			}
+			if chunkMark != mark {
+				mark.end(cc)
+				chunkMark.begin(cc)
+				mark = chunkMark
+			}
+
 			r, g, b := style.Color.ToRGB()
 			fontName := defaultFontName
 			fontSize := defaultFontSize
@@ -689,6 +704,7 @@ func drawStyledParagraphOnBlock(blk *Block, p *StyledParagraph, ctx DrawContext)
 				}
 
 				blk.AddAnnotation(chunk.annotation)
+				chunkMark.addAnnotation(chunk.annotation)
 			}
 
 			currX += chunkWidth
@@ -700,6 +716,7 @@ func drawStyledParagraphOnBlock(blk *Block, p *StyledParagraph, ctx DrawContext)
 
 		currY -= height
 	}
+	mark.end(cc)
 	cc.Add_ET()
 	cc.Add_Q()
 
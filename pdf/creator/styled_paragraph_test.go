@@ -1,8 +1,12 @@
 package creator
 
 import (
+	"bytes"
 	"testing"
 
+	"github.com/stretchr/testify/require"
+
+	"github.com/finalversus/doc/pdf/core"
 	"github.com/finalversus/doc/pdf/model"
 )
 
@@ -405,6 +409,26 @@ Sed imperdiet sodales lacus sed sollicitudin. In porta tortor quis augue tempor,
 	}
 }
 
+func TestStyledParagraphExternalLinkAction(t *testing.T) {
+	c := New()
+	p := c.NewStyledParagraph()
+	p.Append("Visit ")
+	p.AddExternalLink("the website", "https://example.com")
+	require.NoError(t, c.Draw(p))
+
+	var buf bytes.Buffer
+	require.NoError(t, c.Write(&buf))
+	reader, err := model.NewPdfReader(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+
+	actions, err := reader.GetActions()
+	require.NoError(t, err)
+	require.Len(t, actions, 1)
+	uri, ok := actions[0].GetContext().(*model.PdfActionURI)
+	require.True(t, ok)
+	require.Equal(t, "https://example.com", uri.URI.(*core.PdfObjectString).Str())
+}
+
 func TestStyledParagraphRenderingModes(t *testing.T) {
 	fontRegular := newStandard14Font(t, model.HelveticaName)
 
@@ -35,6 +35,9 @@ type Table struct {
 
 	headerStartRow int
 	headerEndRow   int
+
+	// Structure types of the elements of the table in tagging mode (nil for the default types).
+	structTypes *tableStructTypes
 }
 
 func newTable(cols int) *Table {
@@ -345,6 +348,15 @@ func (table *Table) GeneratePageBlocks(ctx DrawContext) ([]*Block, DrawContext,
 	var drawingHeaders bool
 	var resumeIdx, resumeStartRow int
 
+	// In tagging mode, the cells are elements of the rows of the table. The headers repeated on
+	// the following pages are artifacts.
+	structTypes := table.structTypes
+	if structTypes == nil {
+		structTypes = defaultTableStructTypes
+	}
+	tableNode := origCtx.structNode.child(structTypes.table)
+	rowNodes := map[int]*structNode{}
+
 	for cellIdx := 0; cellIdx < len(table.cells); cellIdx++ {
 		cell := table.cells[cellIdx]
 
@@ -400,6 +412,17 @@ func (table *Table) GeneratePageBlocks(ctx DrawContext) ([]*Block, DrawContext,
 		ctx.X = ulX + xrel
 		ctx.Y = ulY + yrel
 
+		cellNode := tableNode.artifact()
+		if !drawingHeaders {
+			rowNode, ok := rowNodes[cell.row]
+			if !ok {
+				rowNode = tableNode.child(structTypes.row)
+				rowNodes[cell.row] = rowNode
+			}
+			isHeader := table.hasHeader && cell.row >= table.headerStartRow && cell.row <= table.headerEndRow
+			cellNode = rowNode.child(structTypes.cellType(cell.col, isHeader))
+		}
+
 		border := newBorder(ctx.X, ctx.Y, w, h)
 
 		if cell.backgroundColor != nil {
@@ -435,7 +458,7 @@ func (table *Table) GeneratePageBlocks(ctx DrawContext) ([]*Block, DrawContext,
 		border.SetWidthRight(cell.borderWidthRight)
 		border.SetWidthTop(cell.borderWidthTop)
 
-		err := block.Draw(border)
+		err := block.drawTagged(border, tableNode)
 		if err != nil {
 			common.Log.Debug("ERROR: %v", err)
 		}
@@ -494,7 +517,9 @@ func (table *Table) GeneratePageBlocks(ctx DrawContext) ([]*Block, DrawContext,
 				}
 			}
 
-			err := block.DrawWithContext(cell.content, ctx)
+			cellCtx := ctx
+			cellCtx.structNode = cellNode
+			err := block.drawWithContext(cell.content, cellCtx)
 			if err != nil {
 				common.Log.Debug("ERROR: %v", err)
 			}
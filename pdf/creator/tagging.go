@@ -0,0 +1,442 @@
+package creator
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/finalversus/doc/pdf/contentstream"
+	"github.com/finalversus/doc/pdf/core"
+	"github.com/finalversus/doc/pdf/model"
+)
+
+// leafStructTypes are the structure types of the elements which directly contain the marked
+// content of the drawables drawn in them (see structNode.content).
+var leafStructTypes = map[string]struct{}{
+	"P": {}, "H": {}, "H1": {}, "H2": {}, "H3": {}, "H4": {}, "H5": {}, "H6": {},
+	"Lbl": {}, "Caption": {}, "Figure": {}, "Link": {}, "Span": {},
+}
+
+// structNode is a node of the structure tree built in tagging mode (see Creator.EnableTagging).
+// The drawables mark their contents with the nodes of the draw context, and the structure
+// elements of the nodes are created when the marked contents are drawn on the pages, so that
+// contents which are laid out but not drawn (e.g. when estimating the number of table of contents
+// pages) are not part of the structure tree.
+//
+// A nil node disables the tagging, and all the methods of structNode accept nil nodes.
+type structNode struct {
+	tagger *structTagger
+	parent *structNode
+
+	// Structure type of the element.
+	typ string
+
+	// Alternate description of the element (Alt), e.g. of figures.
+	alt string
+
+	// Order of top-level elements (see structTagger.finish).
+	order int
+
+	// Artifacts are contents which are not part of the logical structure, such as page headers
+	// and decorative graphics. Their marked contents have the optional properties `props`.
+	isArtifact bool
+	props      *core.PdfObjectDictionary
+
+	elem *model.PdfStructElem
+}
+
+// child returns a new node of type `typ` under the node. The child of an artifact is the
+// artifact itself.
+func (n *structNode) child(typ string) *structNode {
+	if n == nil || n.isArtifact {
+		return n
+	}
+	return &structNode{tagger: n.tagger, parent: n, typ: typ}
+}
+
+// content returns the node of the contents of a drawable of type `typ`: the node itself if it
+// directly contains marked content (e.g. headings), or a new child of type `typ` otherwise.
+func (n *structNode) content(typ string) *structNode {
+	if n == nil || n.isArtifact {
+		return n
+	}
+	if _, ok := leafStructTypes[n.typ]; ok {
+		return n
+	}
+	return n.child(typ)
+}
+
+// artifact returns an artifact node for the decorative contents of the node.
+func (n *structNode) artifact() *structNode {
+	if n == nil || n.isArtifact {
+		return n
+	}
+	return &structNode{tagger: n.tagger, parent: n, isArtifact: true}
+}
+
+// setAlt sets the alternate description of the element of the node and returns the node.
+func (n *structNode) setAlt(alt string) *structNode {
+	if n != nil && !n.isArtifact {
+		n.alt = alt
+	}
+	return n
+}
+
+// begin adds the beginning of a marked-content sequence of the node to `cc`.
+func (n *structNode) begin(cc *contentstream.ContentCreator) {
+	if n == nil {
+		return
+	}
+	if n.isArtifact {
+		switch {
+		case n.props != nil:
+			cc.Add_BDC("Artifact", n.props)
+		case n.tagger.template:
+			// Template artifacts are replaced when the block is drawn (see instantiate).
+			props := core.MakeDict()
+			n.tagger.marks[props] = n
+			cc.Add_BDC("Artifact", props)
+		default:
+			cc.Add_BMC("Artifact")
+		}
+		return
+	}
+
+	// The MCID is set when the content is drawn on its page.
+	props := core.MakeDict()
+	n.tagger.marks[props] = n
+	cc.Add_BDC(core.PdfObjectName(n.typ), props)
+}
+
+// end adds the end of a marked-content sequence of the node to `cc`.
+func (n *structNode) end(cc *contentstream.ContentCreator) {
+	if n == nil {
+		return
+	}
+	cc.Add_EMC()
+}
+
+// wrap marks the contents of each of the `blocks` as a marked-content sequence of the node.
+func (n *structNode) wrap(blocks []*Block) {
+	if n == nil {
+		return
+	}
+	for _, blk := range blocks {
+		if len(*blk.contents) == 0 {
+			continue
+		}
+		cc := contentstream.NewContentCreator()
+		n.begin(cc)
+		ops := append(*cc.Operations(), *blk.contents...)
+		*blk.contents = append(ops, *contentstream.NewContentCreator().Add_EMC().Operations()...)
+	}
+}
+
+// instantiate replaces the marked-content sequences of the nodes of the template rooted at `n`
+// in `blocks`, the drawn copies of the template block, with marked-content sequences of new nodes
+// under `parent`. They are removed if `parent` is nil (tagging disabled) or an artifact, whose
+// marked-content sequence wraps the blocks.
+func (n *structNode) instantiate(blocks []*Block, parent *structNode) {
+	t := n.tagger
+	nodes := map[*structNode]*structNode{n: parent}
+	var get func(m *structNode) *structNode
+	get = func(m *structNode) *structNode {
+		if inst, ok := nodes[m]; ok {
+			return inst
+		}
+		p := get(m.parent)
+		var inst *structNode
+		switch {
+		case p == nil || p.isArtifact:
+		case m.isArtifact:
+			inst = p.artifact()
+		case m.parent == n:
+			inst = p.content(m.typ)
+		default:
+			inst = p.child(m.typ)
+		}
+		if inst != p {
+			inst.setAlt(m.alt)
+		}
+		nodes[m] = inst
+		return inst
+	}
+
+	for _, blk := range blocks {
+		var ops contentstream.ContentStreamOperations
+		// Marked-content sequences being read, true for the removed ones.
+		var removed []bool
+		for _, op := range *blk.contents {
+			switch op.Operand {
+			case "BMC", "BDC":
+				m := t.templateNode(op)
+				if m == nil {
+					removed = append(removed, false)
+					break
+				}
+				inst := get(m)
+				removed = append(removed, inst == nil)
+				cc := contentstream.NewContentCreator()
+				inst.begin(cc)
+				ops = append(ops, *cc.Operations()...)
+				continue
+			case "EMC":
+				if len(removed) > 0 {
+					isRemoved := removed[len(removed)-1]
+					removed = removed[:len(removed)-1]
+					if isRemoved {
+						continue
+					}
+				}
+			}
+			ops = append(ops, op)
+		}
+		*blk.contents = ops
+
+		for _, annot := range blk.annotations {
+			if m, ok := t.annots[annot]; ok {
+				get(m).addAnnotation(annot)
+			}
+		}
+	}
+}
+
+// hasMarkedContent returns true if `ops` contain marked-content sequences.
+func hasMarkedContent(ops *contentstream.ContentStreamOperations) bool {
+	for _, op := range *ops {
+		if op.Operand == "BMC" || op.Operand == "BDC" {
+			return true
+		}
+	}
+	return false
+}
+
+// addAnnotation sets the node as the structure element of the annotation `annot`.
+func (n *structNode) addAnnotation(annot *model.PdfAnnotation) {
+	if n == nil || n.isArtifact {
+		return
+	}
+	n.tagger.annots[annot] = n
+}
+
+// structElem returns the structure element of the node, created with the elements of its
+// parents if needed.
+func (n *structNode) structElem() *model.PdfStructElem {
+	if n.elem != nil {
+		return n.elem
+	}
+	n.elem = model.NewPdfStructElem(n.typ)
+	n.elem.Alt = n.alt
+	if n.order != 0 {
+		n.tagger.orders[n.elem] = n.order
+	}
+	if n.parent == nil {
+		n.tagger.root.AddElem(n.elem)
+	} else {
+		n.parent.structElem().AddElem(n.elem)
+	}
+	return n.elem
+}
+
+// tableStructTypes are the structure types of the elements of a table: the table, its rows, the
+// cells of its header rows and the cells of its other rows. If set, `cols` are the structure
+// types of the cells of each column.
+type tableStructTypes struct {
+	table, row, header, cell string
+	cols                     []string
+}
+
+// defaultTableStructTypes are the structure types of the elements of tables.
+var defaultTableStructTypes = &tableStructTypes{table: "Table", row: "TR", header: "TH", cell: "TD"}
+
+// listStructTypes are the structure types of the elements of the table of a list: the item
+// markers are labels and the item drawables are list bodies.
+var listStructTypes = &tableStructTypes{table: "L", row: "LI", header: "Lbl", cols: []string{"Lbl", "LBody"}}
+
+// cellType returns the structure type of the cell in column `col` (1-based), `header` being true
+// for the cells of header rows.
+func (types *tableStructTypes) cellType(col int, header bool) string {
+	if header {
+		return types.header
+	}
+	if col-1 < len(types.cols) {
+		return types.cols[col-1]
+	}
+	return types.cell
+}
+
+// headingStructType returns the structure type of the heading of a chapter of level `level`.
+func headingStructType(level uint) string {
+	switch {
+	case level < 1:
+		return "H1"
+	case level > 6:
+		return "H6"
+	}
+	return fmt.Sprintf("H%d", level)
+}
+
+// structTagger builds the structure tree of the document in tagging mode.
+type structTagger struct {
+	// Natural language of the document.
+	lang string
+
+	// The tagger of a template is the tagger of the contents drawn on a block, whose nodes are
+	// instantiated when the block is drawn (see newStructTemplate).
+	template bool
+
+	// The Document element, root of the nodes.
+	document *structNode
+
+	// Nodes of the marked-content sequences, by their properties dictionary, and of the
+	// annotations of the laid out contents.
+	marks  map[*core.PdfObjectDictionary]*structNode
+	annots map[*model.PdfAnnotation]*structNode
+
+	// Nodes of the marked-content sequences drawn on each page, indexed by MCID.
+	pageMarks map[*model.PdfPage][]*structNode
+
+	// Structure element orders of the top-level nodes (see structNode.order).
+	orders map[*model.PdfStructElem]int
+
+	root *model.PdfStructTreeRoot
+}
+
+// newStructTagger returns a tagger of a document in language `lang`.
+func newStructTagger(lang string) *structTagger {
+	t := &structTagger{
+		lang:      lang,
+		marks:     map[*core.PdfObjectDictionary]*structNode{},
+		annots:    map[*model.PdfAnnotation]*structNode{},
+		pageMarks: map[*model.PdfPage][]*structNode{},
+		orders:    map[*model.PdfStructElem]int{},
+		root:      model.NewPdfStructTreeRoot(),
+	}
+	t.document = &structNode{tagger: t, typ: "Document"}
+	return t
+}
+
+// newStructTemplate returns the root of the structure nodes of the contents drawn on a block.
+// The contents are tagged when the block is drawn, with new nodes under the node of the draw
+// context (see structNode.instantiate), so that blocks can be drawn before they are placed in
+// the document, and drawn several times.
+func newStructTemplate() *structNode {
+	t := &structTagger{
+		template: true,
+		marks:    map[*core.PdfObjectDictionary]*structNode{},
+		annots:   map[*model.PdfAnnotation]*structNode{},
+	}
+	t.document = &structNode{tagger: t}
+	return t.document
+}
+
+// templateNode returns the template node of the marked-content operator `op`, or nil if the
+// marked content is not tagged by the template.
+func (t *structTagger) templateNode(op *contentstream.ContentStreamOperation) *structNode {
+	if op.Operand != "BDC" || len(op.Params) != 2 {
+		return nil
+	}
+	props, ok := op.Params[1].(*core.PdfObjectDictionary)
+	if !ok {
+		return nil
+	}
+	return t.marks[props]
+}
+
+// section returns a new Div node under the Document element, ordered with `order` relative to
+// the other top-level nodes (0 for the contents).
+func (t *structTagger) section(order int) *structNode {
+	n := t.document.child("Div")
+	n.order = order
+	return n
+}
+
+// pagination returns an artifact node for the page headers and footers.
+func (t *structTagger) pagination() *structNode {
+	props := core.MakeDict()
+	props.Set("Type", core.MakeName("Pagination"))
+	return &structNode{tagger: t, isArtifact: true, props: props}
+}
+
+// place sets the MCIDs of the marked-content sequences of `blk`, drawn on `page`, and adds them
+// and the annotations of the block to their structure elements.
+func (t *structTagger) place(blk *Block, page *model.PdfPage) {
+	for _, op := range *blk.contents {
+		if op.Operand != "BDC" || len(op.Params) != 2 {
+			continue
+		}
+		props, ok := op.Params[1].(*core.PdfObjectDictionary)
+		if !ok {
+			continue
+		}
+		n, ok := t.marks[props]
+		if !ok {
+			continue
+		}
+
+		mcid := len(t.pageMarks[page])
+		t.pageMarks[page] = append(t.pageMarks[page], n)
+		props.Set("MCID", core.MakeInteger(int64(mcid)))
+		n.structElem().AddMarkedContent(page, mcid)
+	}
+
+	for _, annot := range blk.annotations {
+		if n, ok := t.annots[annot]; ok {
+			n.structElem().AddAnnotation(page, annot)
+		}
+	}
+}
+
+// finish sets the parent tree of the structure tree, with the StructParents entries of the
+// `pages` and the StructParent entries of their tagged annotations, sets the tab order of the
+// pages to the structure order, and returns the structure tree root, or nil if no content was
+// tagged.
+func (t *structTagger) finish(pages []*model.PdfPage) (*model.PdfStructTreeRoot, error) {
+	if t.document.elem == nil {
+		return nil, nil
+	}
+
+	tree := model.NewPdfNumberTree()
+	key := 0
+	for _, page := range pages {
+		page.Tabs = core.MakeName("S")
+
+		if nodes := t.pageMarks[page]; len(nodes) > 0 {
+			elems := core.MakeArray()
+			for _, n := range nodes {
+				elems.Append(n.elem.GetContainingPdfObject())
+			}
+			if err := tree.Set(key, elems); err != nil {
+				return nil, err
+			}
+			page.StructParents = core.MakeInteger(int64(key))
+			key++
+		}
+
+		annots, err := page.GetAnnotations()
+		if err != nil {
+			return nil, err
+		}
+		for _, annot := range annots {
+			n, ok := t.annots[annot]
+			if !ok || n.elem == nil {
+				continue
+			}
+			if err := tree.Set(key, n.elem.GetContainingPdfObject()); err != nil {
+				return nil, err
+			}
+			annot.StructParent = core.MakeInteger(int64(key))
+			key++
+		}
+	}
+	t.root.ParentTree = tree
+	t.root.ParentTreeNextKey = key
+
+	// The front page and the table of contents are drawn after the contents and are moved
+	// before them.
+	if doc := t.document.elem; doc != nil {
+		sort.SliceStable(doc.Kids, func(i, j int) bool {
+			return t.orders[doc.Kids[i].Elem] < t.orders[doc.Kids[j].Elem]
+		})
+	}
+	return t.root, nil
+}
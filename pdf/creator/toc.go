@@ -159,6 +159,10 @@ func (t *TOC) SetShowLinks(showLinks bool) {
 func (t *TOC) GeneratePageBlocks(ctx DrawContext) ([]*Block, DrawContext, error) {
 	origCtx := ctx
 
+	// In tagging mode, the heading is the caption of the table of contents.
+	node := origCtx.structNode.child("TOC")
+	ctx.structNode = node.child("Caption")
+
 	blocks, ctx, err := t.heading.GeneratePageBlocks(ctx)
 	if err != nil {
 		return blocks, ctx, err
@@ -170,6 +174,7 @@ func (t *TOC) GeneratePageBlocks(ctx DrawContext) ([]*Block, DrawContext, error)
 			line.linkPage = 0
 		}
 
+		ctx.structNode = node.child("TOCI")
 		newBlocks, c, err := line.GeneratePageBlocks(ctx)
 		line.linkPage = linkPage
 
@@ -190,6 +195,7 @@ func (t *TOC) GeneratePageBlocks(ctx DrawContext) ([]*Block, DrawContext, error)
 
 		ctx.X = origCtx.X
 	}
+	ctx.structNode = origCtx.structNode
 
 	if t.positioning.isAbsolute() {
 
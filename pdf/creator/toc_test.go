@@ -1,8 +1,11 @@
 package creator
 
 import (
+	"bytes"
 	"testing"
 
+	"github.com/stretchr/testify/require"
+
 	"github.com/finalversus/doc/pdf/model"
 )
 
@@ -91,3 +94,36 @@ func TestTOCAdvanced(t *testing.T) {
 		t.Fatalf("Fail: %v\n", err)
 	}
 }
+
+func TestTOCPageLabels(t *testing.T) {
+	c := New()
+	c.AddTOC = true
+	c.TOCPageLabels = true
+	c.SetPageLabels([]model.PdfPageLabelRange{
+		{PageIndex: 0, Label: model.PdfPageLabel{Style: model.PageLabelStyleLowerRoman}},
+		{PageIndex: 2, Label: model.PdfPageLabel{Style: model.PageLabelStyleDecimal}},
+	})
+	c.CreateFrontPage(func(args FrontpageFunctionArgs) {
+		require.NoError(t, c.Draw(c.NewParagraph("Cover")))
+	})
+
+	for _, title := range []string{"Introduction", "Results"} {
+		c.NewPage()
+		require.NoError(t, c.Draw(c.NewChapter(title)))
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, c.Write(&buf))
+
+	var pages []string
+	for _, line := range c.TOC().Lines() {
+		pages = append(pages, line.Page.Text)
+	}
+	require.Equal(t, []string{"1", "2"}, pages)
+
+	reader, err := model.NewPdfReader(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	labels, err := reader.GetPageLabels()
+	require.NoError(t, err)
+	require.Equal(t, []string{"i", "ii", "1", "2"}, labels)
+}
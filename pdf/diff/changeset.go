@@ -0,0 +1,98 @@
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ChangeType is the type of a Change.
+type ChangeType string
+
+// Change types.
+const (
+	// Added means that the object only exists in the second document.
+	Added ChangeType = "added"
+	// Removed means that the object only exists in the first document.
+	Removed ChangeType = "removed"
+	// Modified means that the object exists in both documents with a different value.
+	Modified ChangeType = "modified"
+)
+
+// Change represents a difference between two documents.
+type Change struct {
+	Type ChangeType `json:"type"`
+
+	// Path locates the changed object, starting from the page, form field or document-level
+	// dictionary containing it, e.g. "Page 2/Resources/Font/F1/BaseFont" or "AcroForm/Fields/name/V".
+	Path string `json:"path"`
+
+	// Old and New describe the object in the first and second document respectively. Old is empty
+	// for added objects and New is empty for removed objects.
+	Old string `json:"old,omitempty"`
+	New string `json:"new,omitempty"`
+}
+
+// String returns a one line description of the change.
+func (c Change) String() string {
+	switch c.Type {
+	case Added:
+		return fmt.Sprintf("+ %s: %s", c.Path, c.New)
+	case Removed:
+		return fmt.Sprintf("- %s: %s", c.Path, c.Old)
+	}
+	return fmt.Sprintf("~ %s: %s -> %s", c.Path, c.Old, c.New)
+}
+
+// Changeset is the list of differences between two documents, in document order: document-level
+// dictionaries, then pages, then form fields.
+type Changeset struct {
+	Changes []Change `json:"changes"`
+}
+
+// Empty returns true if the documents are structurally identical.
+func (cs *Changeset) Empty() bool {
+	return len(cs.Changes) == 0
+}
+
+// Filter returns the changes with a path starting with `prefix`, e.g. "Page 1/" for the changes of
+// the first page.
+func (cs *Changeset) Filter(prefix string) []Change {
+	var changes []Change
+	for _, c := range cs.Changes {
+		if strings.HasPrefix(c.Path, prefix) {
+			changes = append(changes, c)
+		}
+	}
+	return changes
+}
+
+// Text returns the changeset as text, with one change per line (see Change.String).
+func (cs *Changeset) Text() string {
+	var b strings.Builder
+	for _, c := range cs.Changes {
+		b.WriteString(c.String())
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// WriteText writes the text representation of the changeset to `w`.
+func (cs *Changeset) WriteText(w io.Writer) error {
+	_, err := io.WriteString(w, cs.Text())
+	return err
+}
+
+// JSON returns the changeset as indented JSON.
+func (cs *Changeset) JSON() ([]byte, error) {
+	if cs.Changes == nil {
+		return json.MarshalIndent(Changeset{Changes: []Change{}}, "", "  ")
+	}
+	return json.MarshalIndent(cs, "", "  ")
+}
+
+// add appends a change to the changeset.
+func (cs *Changeset) add(t ChangeType, path, old, new string) {
+	cs.Changes = append(cs.Changes, Change{Type: t, Path: path, Old: old, New: new})
+}
@@ -0,0 +1,460 @@
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/finalversus/doc/common"
+	"github.com/finalversus/doc/pdf/core"
+	"github.com/finalversus/doc/pdf/model"
+)
+
+// maxDescriptionLength is the maximum length of the object descriptions in the changes.
+const maxDescriptionLength = 80
+
+// ignoredKeys are the dictionary keys which are not compared: back references to parent objects and
+// pages, which are compared by their own path.
+var ignoredKeys = map[core.PdfObjectName]bool{
+	"Parent": true,
+	"P":      true,
+}
+
+// streamEncodingKeys are the stream dictionary keys which only depend on how stream data is encoded.
+// Streams are compared by their decoded data instead.
+var streamEncodingKeys = map[core.PdfObjectName]bool{
+	"Length":      true,
+	"Filter":      true,
+	"DecodeParms": true,
+}
+
+// fieldKeys are the keys of form field dictionaries which are compared in form fields. The keys of
+// the widget annotations of the fields are compared with the page annotations.
+var fieldKeys = []core.PdfObjectName{
+	"FT", "T", "TU", "TM", "Ff", "V", "DV", "AA", "DA", "Q", "DS", "RV", "MaxLen", "Opt", "TI", "I",
+	"Lock", "SV",
+}
+
+// differ walks the object graphs of two documents, collecting the differences.
+type differ struct {
+	changes Changeset
+
+	// visited contains the pairs of container objects already compared in the current page or
+	// document-level dictionary, to handle cycles. Objects shared by several pages (e.g. fonts) are
+	// compared, and their changes reported, for each page.
+	visited map[[2]core.PdfObject]struct{}
+
+	// pagesA and pagesB map the page objects of the documents to their page numbers, so that
+	// references to pages are compared by page number.
+	pagesA map[core.PdfObject]int
+	pagesB map[core.PdfObject]int
+}
+
+// Compare compares the documents loaded by `a` and `b` and returns the changes from `a` to `b`.
+// The document information dictionaries, catalogs, pages and form fields of the documents are
+// walked in parallel:
+// - pages are matched by page number,
+// - resources (fonts, images, etc.) are matched by resource name,
+// - annotations are matched by subtype and name (NM, or field name T for widgets), or by their
+// position among the annotations of the same subtype on the page,
+// - form fields are matched by fully qualified field name,
+// - references to pages are compared by page number,
+// - streams are compared by decoded data.
+// Encrypted documents must be decrypted before comparing them.
+func Compare(a, b *model.PdfReader) (*Changeset, error) {
+	d := &differ{}
+
+	pagesA, err := loadPages(a)
+	if err != nil {
+		return nil, err
+	}
+	pagesB, err := loadPages(b)
+	if err != nil {
+		return nil, err
+	}
+	d.pagesA = pageNumbers(pagesA)
+	d.pagesB = pageNumbers(pagesB)
+
+	trailerA, err := a.GetTrailer()
+	if err != nil {
+		return nil, err
+	}
+	trailerB, err := b.GetTrailer()
+	if err != nil {
+		return nil, err
+	}
+
+	d.reset()
+	d.compare("Info", trailerA.Get("Info"), trailerB.Get("Info"))
+
+	catalogA, _ := core.GetDict(trailerA.Get("Root"))
+	catalogB, _ := core.GetDict(trailerB.Get("Root"))
+	if catalogA == nil || catalogB == nil {
+		return nil, fmt.Errorf("missing catalog")
+	}
+	d.reset()
+	d.compareDicts("Catalog", catalogA, catalogB, map[core.PdfObjectName]bool{
+		"Pages":    true,
+		"AcroForm": true,
+	})
+
+	for i := 0; i < len(pagesA) || i < len(pagesB); i++ {
+		path := fmt.Sprintf("Page %d", i+1)
+		switch {
+		case i >= len(pagesA):
+			d.changes.add(Added, path, "", "page")
+		case i >= len(pagesB):
+			d.changes.add(Removed, path, "page", "")
+		default:
+			if err := d.comparePages(path, pagesA[i], pagesB[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	formA, _ := core.GetDict(catalogA.Get("AcroForm"))
+	formB, _ := core.GetDict(catalogB.Get("AcroForm"))
+	d.reset()
+	d.compareForms("AcroForm", formA, formB)
+
+	return &d.changes, nil
+}
+
+// reset clears the compared objects, before comparing a page or document-level dictionary.
+func (d *differ) reset() {
+	d.visited = map[[2]core.PdfObject]struct{}{}
+}
+
+// loadPages returns the pages of the document loaded by `reader`.
+func loadPages(reader *model.PdfReader) ([]*model.PdfPage, error) {
+	numPages, err := reader.GetNumPages()
+	if err != nil {
+		return nil, err
+	}
+	pages := make([]*model.PdfPage, 0, numPages)
+	for i := 1; i <= numPages; i++ {
+		page, err := reader.GetPage(i)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, page)
+	}
+	return pages, nil
+}
+
+// pageNumbers maps the page objects and dictionaries of `pages` to their page numbers.
+func pageNumbers(pages []*model.PdfPage) map[core.PdfObject]int {
+	numbers := make(map[core.PdfObject]int, 2*len(pages))
+	for i, page := range pages {
+		if ind := page.GetPageAsIndirectObject(); ind != nil {
+			numbers[ind] = i + 1
+			numbers[ind.PdfObject] = i + 1
+		}
+	}
+	return numbers
+}
+
+// comparePages compares the matching pages `a` and `b`.
+func (d *differ) comparePages(path string, a, b *model.PdfPage) error {
+	d.reset()
+	dictA, dictB := a.GetPageDict(), b.GetPageDict()
+	d.compareDicts(path, dictA, dictB, map[core.PdfObjectName]bool{
+		"Contents": true,
+		"Annots":   true,
+	})
+
+	contentsA, err := a.GetAllContentStreams()
+	if err != nil {
+		return err
+	}
+	contentsB, err := b.GetAllContentStreams()
+	if err != nil {
+		return err
+	}
+	if contentsA != contentsB {
+		d.changes.add(Modified, path+"/Contents", describeData([]byte(contentsA)), describeData([]byte(contentsB)))
+	}
+
+	annotsA, _ := core.GetArray(dictA.Get("Annots"))
+	annotsB, _ := core.GetArray(dictB.Get("Annots"))
+	d.compareNamed(path+"/Annots", annotationKeys(annotsA), annotationKeys(annotsB), nil)
+	return nil
+}
+
+// namedObjects are objects identified by a structural key, in order.
+type namedObjects struct {
+	keys    []string
+	objects map[string]core.PdfObject
+}
+
+// add adds `obj` with `key`. Objects with duplicate keys are ignored.
+func (n *namedObjects) add(key string, obj core.PdfObject) {
+	if n.objects == nil {
+		n.objects = map[string]core.PdfObject{}
+	}
+	if _, ok := n.objects[key]; ok {
+		common.Log.Debug("Duplicate key %s - ignoring", key)
+		return
+	}
+	n.keys = append(n.keys, key)
+	n.objects[key] = obj
+}
+
+// annotationKeys returns the annotations of `annots` keyed by subtype and name.
+func annotationKeys(annots *core.PdfObjectArray) namedObjects {
+	var named namedObjects
+	if annots == nil {
+		return named
+	}
+	counts := map[string]int{}
+	for _, annot := range annots.Elements() {
+		dict, ok := core.GetDict(annot)
+		if !ok {
+			continue
+		}
+		subtype := "Annot"
+		if name, ok := core.GetNameVal(dict.Get("Subtype")); ok {
+			subtype = name
+		}
+		var key string
+		if nm, ok := core.GetStringVal(dict.Get("NM")); ok && nm != "" {
+			key = subtype + ":" + nm
+		} else if t, ok := core.GetStringVal(dict.Get("T")); ok && subtype == "Widget" {
+			key = subtype + ":" + t
+		} else {
+			counts[subtype]++
+			key = fmt.Sprintf("%s#%d", subtype, counts[subtype])
+		}
+		named.add(key, annot)
+	}
+	return named
+}
+
+// compareNamed compares the objects of `a` and `b` with matching keys. If `keys` is not nil, only
+// these dictionary keys of the objects are compared.
+func (d *differ) compareNamed(path string, a, b namedObjects, keys []core.PdfObjectName) {
+	order := append([]string{}, a.keys...)
+	for _, key := range b.keys {
+		if _, ok := a.objects[key]; !ok {
+			order = append(order, key)
+		}
+	}
+
+	for _, key := range order {
+		objA, inA := a.objects[key]
+		objB, inB := b.objects[key]
+		objPath := path + "/" + key
+		switch {
+		case !inA:
+			d.changes.add(Added, objPath, "", d.describe(objB, d.pagesB))
+		case !inB:
+			d.changes.add(Removed, objPath, d.describe(objA, d.pagesA), "")
+		case keys != nil:
+			dictA, _ := core.GetDict(objA)
+			dictB, _ := core.GetDict(objB)
+			for _, k := range keys {
+				d.compare(objPath+"/"+string(k), dictA.Get(k), dictB.Get(k))
+			}
+		default:
+			d.compare(objPath, objA, objB)
+		}
+	}
+}
+
+// compareForms compares the interactive form dictionaries `a` and `b`, either of which may be nil.
+func (d *differ) compareForms(path string, a, b *core.PdfObjectDictionary) {
+	if a == nil && b == nil {
+		return
+	}
+	if a == nil || b == nil {
+		d.compare(path, a, b)
+		return
+	}
+	d.compareDicts(path, a, b, map[core.PdfObjectName]bool{"Fields": true})
+
+	var fieldsA, fieldsB namedObjects
+	collectFields(&fieldsA, a.Get("Fields"), "", 0)
+	collectFields(&fieldsB, b.Get("Fields"), "", 0)
+	d.compareNamed(path+"/Fields", fieldsA, fieldsB, fieldKeys)
+}
+
+// maxFieldDepth is the maximum depth of the form field hierarchy.
+const maxFieldDepth = 32
+
+// collectFields adds the fields of the field array `fields` and their descendants to `named`,
+// keyed by fully qualified field name. `parent` is the name of the parent field.
+func collectFields(named *namedObjects, fields core.PdfObject, parent string, depth int) {
+	arr, ok := core.GetArray(fields)
+	if !ok || depth > maxFieldDepth {
+		return
+	}
+	for i, field := range arr.Elements() {
+		dict, ok := core.GetDict(field)
+		if !ok {
+			continue
+		}
+		t, hasName := core.GetStringVal(dict.Get("T"))
+		if !hasName {
+			// Widget annotation of the parent field.
+			continue
+		}
+		name := t
+		if parent != "" {
+			name = parent + "." + t
+		}
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		named.add(name, dict)
+		collectFields(named, dict.Get("Kids"), name, depth+1)
+	}
+}
+
+// compare compares the objects `a` and `b` found at `path`.
+func (d *differ) compare(path string, a, b core.PdfObject) {
+	directA := core.TraceToDirectObject(a)
+	directB := core.TraceToDirectObject(b)
+	if isNull(directA) && isNull(directB) {
+		return
+	}
+	if isNull(directA) {
+		d.changes.add(Added, path, "", d.describe(directB, d.pagesB))
+		return
+	}
+	if isNull(directB) {
+		d.changes.add(Removed, path, d.describe(directA, d.pagesA), "")
+		return
+	}
+
+	// References to pages are compared by page number.
+	pageA, isPageA := d.pagesA[directA]
+	pageB, isPageB := d.pagesB[directB]
+	if isPageA || isPageB {
+		if pageA != pageB {
+			d.changes.add(Modified, path, d.describe(directA, d.pagesA), d.describe(directB, d.pagesB))
+		}
+		return
+	}
+
+	switch directA.(type) {
+	case *core.PdfObjectDictionary, *core.PdfObjectArray, *core.PdfObjectStream:
+		key := [2]core.PdfObject{directA, directB}
+		if _, ok := d.visited[key]; ok {
+			return
+		}
+		d.visited[key] = struct{}{}
+	}
+
+	switch ta := directA.(type) {
+	case *core.PdfObjectDictionary:
+		if tb, ok := directB.(*core.PdfObjectDictionary); ok {
+			d.compareDicts(path, ta, tb, nil)
+			return
+		}
+	case *core.PdfObjectStream:
+		if tb, ok := directB.(*core.PdfObjectStream); ok {
+			d.compareDicts(path, ta.PdfObjectDictionary, tb.PdfObjectDictionary, streamEncodingKeys)
+			dataA, dataB := streamData(ta), streamData(tb)
+			if !bytes.Equal(dataA, dataB) {
+				d.changes.add(Modified, path+"/(data)", describeData(dataA), describeData(dataB))
+			}
+			return
+		}
+	case *core.PdfObjectArray:
+		if tb, ok := directB.(*core.PdfObjectArray); ok {
+			d.compareArrays(path, ta, tb)
+			return
+		}
+	default:
+		if directA.WriteString() == directB.WriteString() {
+			return
+		}
+	}
+
+	d.changes.add(Modified, path, d.describe(directA, d.pagesA), d.describe(directB, d.pagesB))
+}
+
+// compareDicts compares the dictionaries `a` and `b` found at `path`, except for the keys in `skip`
+// and ignoredKeys. The keys are compared in sorted order.
+func (d *differ) compareDicts(path string, a, b *core.PdfObjectDictionary, skip map[core.PdfObjectName]bool) {
+	keys := map[core.PdfObjectName]struct{}{}
+	for _, key := range a.Keys() {
+		keys[key] = struct{}{}
+	}
+	for _, key := range b.Keys() {
+		keys[key] = struct{}{}
+	}
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		if !skip[key] && !ignoredKeys[key] {
+			sorted = append(sorted, string(key))
+		}
+	}
+	sort.Strings(sorted)
+
+	for _, key := range sorted {
+		name := core.PdfObjectName(key)
+		d.compare(path+"/"+key, a.Get(name), b.Get(name))
+	}
+}
+
+// compareArrays compares the arrays `a` and `b` found at `path` element by element.
+func (d *differ) compareArrays(path string, a, b *core.PdfObjectArray) {
+	for i := 0; i < a.Len() || i < b.Len(); i++ {
+		d.compare(fmt.Sprintf("%s[%d]", path, i), a.Get(i), b.Get(i))
+	}
+}
+
+// isNull returns true if `obj` is nil or the null object.
+func isNull(obj core.PdfObject) bool {
+	if obj == nil {
+		return true
+	}
+	_, ok := obj.(*core.PdfObjectNull)
+	return ok
+}
+
+// streamData returns the decoded data of `stream`, or its encoded data if it cannot be decoded.
+func streamData(stream *core.PdfObjectStream) []byte {
+	data, err := core.DecodeStream(stream)
+	if err != nil {
+		common.Log.Debug("Unable to decode stream: %v", err)
+		return stream.Stream
+	}
+	return data
+}
+
+// describe returns a short description of `obj`. `pages` maps page objects to page numbers.
+func (d *differ) describe(obj core.PdfObject, pages map[core.PdfObject]int) string {
+	obj = core.TraceToDirectObject(obj)
+	if n, ok := pages[obj]; ok {
+		return fmt.Sprintf("page %d", n)
+	}
+	switch t := obj.(type) {
+	case nil:
+		return ""
+	case *core.PdfObjectStream:
+		return "stream " + describeData(streamData(t))
+	case *core.PdfObjectDictionary:
+		if name, ok := core.GetNameVal(t.Get("Type")); ok {
+			return fmt.Sprintf("dictionary /Type /%s", name)
+		}
+		if name, ok := core.GetNameVal(t.Get("Subtype")); ok {
+			return fmt.Sprintf("dictionary /Subtype /%s", name)
+		}
+	}
+	return truncate(obj.WriteString())
+}
+
+// describeData returns a short description of the data `data`.
+func describeData(data []byte) string {
+	return fmt.Sprintf("(%d bytes)", len(data))
+}
+
+// truncate shortens `s` to maxDescriptionLength characters.
+func truncate(s string) string {
+	if len(s) <= maxDescriptionLength {
+		return s
+	}
+	return s[:maxDescriptionLength-3] + "..."
+}
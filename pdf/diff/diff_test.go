@@ -0,0 +1,117 @@
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/finalversus/doc/pdf/core"
+	"github.com/finalversus/doc/pdf/model"
+	"github.com/finalversus/doc/pdf/model/optimize"
+)
+
+// testDocument describes the contents of a test document.
+type testDocument struct {
+	pages    []string
+	font     model.StdFontName
+	note     string
+	name     string
+	optimize bool
+}
+
+// build writes the document `doc` and loads it with a PdfReader.
+func (doc testDocument) build(t *testing.T) *model.PdfReader {
+	font := model.NewStandard14FontMustCompile(doc.font)
+	w := model.NewPdfWriter()
+	for i, text := range doc.pages {
+		page := model.NewPdfPage()
+		page.MediaBox = &model.PdfRectangle{Urx: 300, Ury: 300}
+		page.Resources = model.NewPdfPageResources()
+		page.Resources.SetFontByName("F1", font.ToPdfObject())
+		require.NoError(t, page.SetContentStreams([]string{"BT /F1 12 Tf (" + text + ") Tj ET"}, core.NewFlateEncoder()))
+		if i == 0 {
+			note := model.NewPdfAnnotationText()
+			note.Rect = core.MakeArrayFromFloats([]float64{10, 10, 30, 30})
+			note.NM = core.MakeString("note1")
+			note.Contents = core.MakeString(doc.note)
+			page.AddAnnotation(note.PdfAnnotation)
+		}
+		require.NoError(t, w.AddPage(page))
+	}
+
+	field := model.NewPdfField()
+	field.FT = core.MakeName("Tx")
+	field.T = core.MakeString("name")
+	field.V = core.MakeString(doc.name)
+	form := model.NewPdfAcroForm()
+	*form.Fields = append(*form.Fields, field)
+	require.NoError(t, w.SetForms(form))
+
+	date := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	w.SetDeterministic(&model.DeterministicOpts{CreationDate: date, ModDate: date})
+	if doc.optimize {
+		w.SetOptimizer(optimize.New(optimize.Options{UseObjectStreams: true, CompressStreams: true}))
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, w.Write(&buf))
+	reader, err := model.NewPdfReader(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	return reader
+}
+
+func TestCompareIdentical(t *testing.T) {
+	doc := testDocument{pages: []string{"Hello", "World"}, font: model.HelveticaName, note: "a", name: "Alice"}
+	a := doc.build(t)
+	doc.optimize = true
+	b := doc.build(t)
+
+	changes, err := Compare(a, b)
+	require.NoError(t, err)
+	require.True(t, changes.Empty(), changes.Text())
+}
+
+func TestCompare(t *testing.T) {
+	a := testDocument{
+		pages: []string{"Hello", "World"},
+		font:  model.HelveticaName,
+		note:  "a",
+		name:  "Alice",
+	}.build(t)
+	b := testDocument{
+		pages:    []string{"Hello!", "World", "Again"},
+		font:     model.TimesRomanName,
+		note:     "b",
+		name:     "Bob",
+		optimize: true,
+	}.build(t)
+
+	changes, err := Compare(a, b)
+	require.NoError(t, err)
+
+	require.Equal(t, []Change{
+		{Type: Modified, Path: "Page 1/Resources/Font/F1/BaseFont", Old: "/Helvetica", New: "/Times-Roman"},
+		{Type: Modified, Path: "Page 1/Contents", Old: "(26 bytes)", New: "(27 bytes)"},
+		{Type: Modified, Path: "Page 1/Annots/Text:note1/Contents", Old: "(a)", New: "(b)"},
+		{Type: Modified, Path: "Page 2/Resources/Font/F1/BaseFont", Old: "/Helvetica", New: "/Times-Roman"},
+		{Type: Added, Path: "Page 3", New: "page"},
+		{Type: Modified, Path: "AcroForm/Fields/name/V", Old: "(Alice)", New: "(Bob)"},
+	}, changes.Changes)
+
+	require.Len(t, changes.Filter("Page 1/"), 3)
+	require.Equal(t, "~ AcroForm/Fields/name/V: (Alice) -> (Bob)\n", (&Changeset{Changes: changes.Filter("AcroForm/")}).Text())
+
+	data, err := changes.JSON()
+	require.NoError(t, err)
+	var decoded Changeset
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	require.Equal(t, changes.Changes, decoded.Changes)
+
+	// Reversed comparison.
+	changes, err = Compare(b, a)
+	require.NoError(t, err)
+	require.Contains(t, changes.Changes, Change{Type: Removed, Path: "Page 3", Old: "page"})
+}
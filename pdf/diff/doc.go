@@ -0,0 +1,8 @@
+
+
+// Package diff compares the object graphs of two PDF documents. Pages, resources, fonts,
+// annotations and form fields are matched structurally (by page number, resource name, annotation
+// name and field name) rather than by object number, so that documents written by different
+// producers or with different object layouts can be compared. The differences are reported as a
+// Changeset, which can be printed as text or JSON.
+package diff
@@ -0,0 +1,89 @@
+package extractor
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+
+	"github.com/finalversus/doc/common"
+	"github.com/finalversus/doc/pdf/core"
+	"github.com/finalversus/doc/pdf/model"
+)
+
+func ExtractDocumentText(reader *model.PdfReader, workers int) ([]string, error) {
+	numPages, err := reader.GetNumPages()
+	if err != nil {
+		return nil, err
+	}
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if workers > numPages {
+		workers = numPages
+	}
+
+	readers := []*model.PdfReader{reader}
+	for i := 1; i < workers; i++ {
+		clone, err := reader.Clone()
+		if err == core.ErrNotSupported {
+			common.Log.Debug("Reader cannot be cloned - extracting text with %d worker(s)", len(readers))
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		readers = append(readers, clone)
+	}
+
+	texts := make([]string, numPages)
+	errs := make([]error, len(readers))
+	pages := make(chan int)
+	done := make(chan struct{})
+	var stop sync.Once
+	var wg sync.WaitGroup
+	for i, r := range readers {
+		wg.Add(1)
+		go func(i int, r *model.PdfReader) {
+			defer wg.Done()
+			for pageNum := range pages {
+				text, err := extractPageText(r, pageNum)
+				if err != nil {
+					errs[i] = fmt.Errorf("page %d: %w", pageNum, err)
+					stop.Do(func() { close(done) })
+					return
+				}
+				texts[pageNum-1] = text
+			}
+		}(i, r)
+	}
+
+feed:
+	for pageNum := 1; pageNum <= numPages; pageNum++ {
+		select {
+		case pages <- pageNum:
+		case <-done:
+			break feed
+		}
+	}
+	close(pages)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return texts, nil
+}
+
+func extractPageText(reader *model.PdfReader, pageNum int) (string, error) {
+	page, err := reader.GetPage(pageNum)
+	if err != nil {
+		return "", err
+	}
+	e, err := New(page)
+	if err != nil {
+		return "", err
+	}
+	return e.ExtractText()
+}
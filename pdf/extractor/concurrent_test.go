@@ -0,0 +1,117 @@
+package extractor
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/finalversus/doc/pdf/core"
+	"github.com/finalversus/doc/pdf/core/security"
+	"github.com/finalversus/doc/pdf/model"
+)
+
+// makeTextPdf returns a PDF with `numPages` pages, each showing its page number with a shared font.
+func makeTextPdf(t *testing.T, numPages int, password string) []byte {
+	font := model.NewStandard14FontMustCompile(model.HelveticaName)
+	fontObj := font.ToPdfObject()
+
+	w := model.NewPdfWriter()
+	for i := 1; i <= numPages; i++ {
+		page := model.NewPdfPage()
+		page.MediaBox = &model.PdfRectangle{Urx: 300, Ury: 300}
+		page.Resources = model.NewPdfPageResources()
+		page.Resources.SetFontByName("F1", fontObj)
+		content := fmt.Sprintf("BT /F1 24 Tf 20 150 Td (Page %d) Tj ET", i)
+		require.NoError(t, page.SetContentStreams([]string{content}, core.NewFlateEncoder()))
+		require.NoError(t, w.AddPage(page))
+	}
+	if password != "" {
+		opts := &model.EncryptOptions{Permissions: security.PermOwner}
+		require.NoError(t, w.Encrypt([]byte(password), []byte("owner"), opts))
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, w.Write(&buf))
+	return buf.Bytes()
+}
+
+// readSeeker is an io.ReadSeeker which does not implement io.ReaderAt.
+type readSeeker struct {
+	r io.ReadSeeker
+}
+
+func (rs readSeeker) Read(p []byte) (int, error) {
+	return rs.r.Read(p)
+}
+
+func (rs readSeeker) Seek(offset int64, whence int) (int64, error) {
+	return rs.r.Seek(offset, whence)
+}
+
+func TestExtractDocumentText(t *testing.T) {
+	const numPages = 40
+	expected := make([]string, numPages)
+	for i := range expected {
+		expected[i] = fmt.Sprintf("Page %d", i+1)
+	}
+
+	for _, password := range []string{"", "user"} {
+		data := makeTextPdf(t, numPages, password)
+		for _, lazy := range []bool{false, true} {
+			for _, workers := range []int{0, 1, 4, 16} {
+				reader, err := model.NewPdfReaderWithOpts(bytes.NewReader(data), &model.ReaderOpts{LazyLoad: lazy})
+				require.NoError(t, err)
+				if password != "" {
+					ok, err := reader.Decrypt([]byte(password))
+					require.NoError(t, err)
+					require.True(t, ok)
+				}
+
+				texts, err := ExtractDocumentText(reader, workers)
+				require.NoError(t, err, "lazy=%t workers=%d", lazy, workers)
+				require.Equal(t, expected, texts, "lazy=%t workers=%d", lazy, workers)
+			}
+		}
+	}
+
+	// Readers that cannot be cloned are processed sequentially.
+	data := makeTextPdf(t, numPages, "")
+	reader, err := model.NewPdfReader(readSeeker{bytes.NewReader(data)})
+	require.NoError(t, err)
+	_, err = reader.Clone()
+	require.Equal(t, core.ErrNotSupported, err)
+	texts, err := ExtractDocumentText(reader, 4)
+	require.NoError(t, err)
+	require.Equal(t, expected, texts)
+}
+
+func TestExtractDocumentTextFiles(t *testing.T) {
+	for _, filename := range []string{
+		"./testdata/basic_xobject.pdf",
+		"./testdata/inline.pdf",
+		"./testdata/multi.pdf",
+	} {
+		f, err := os.Open(filename)
+		require.NoError(t, err)
+		defer f.Close()
+
+		reader, err := model.NewPdfReader(f)
+		require.NoError(t, err)
+		numPages, err := reader.GetNumPages()
+		require.NoError(t, err)
+		var expected []string
+		for pageNum := 1; pageNum <= numPages; pageNum++ {
+			text, err := extractPageText(reader, pageNum)
+			require.NoError(t, err)
+			expected = append(expected, text)
+		}
+
+		texts, err := ExtractDocumentText(reader, 8)
+		require.NoError(t, err, filename)
+		require.Equal(t, expected, texts, filename)
+	}
+}
@@ -79,6 +79,14 @@ func (e *Extractor) extractPageText(contents string, resources *model.PdfPageRes
 						state.tfont, fontStack.peek(), fontStack.String())
 					state.tfont = fontStack.pop()
 				}
+			case "BMC":
+				state.mcids = append(state.mcids, state.mcid())
+			case "BDC":
+				state.mcids = append(state.mcids, markedContentID(op, resources, state.mcid()))
+			case "EMC":
+				if len(state.mcids) > 0 {
+					state.mcids = state.mcids[:len(state.mcids)-1]
+				}
 			case "BT":
 
 				if to != nil {
@@ -290,7 +298,13 @@ func (e *Extractor) extractPageText(contents string, resources *model.PdfPageRes
 					e.formResults[string(name)] = formResult
 				}
 
-				pageText.marks = append(pageText.marks, formResult.pageText.marks...)
+				// The text of the form without marked content belongs to the enclosing sequence.
+				for _, mark := range formResult.pageText.marks {
+					if mark.mcid < 0 {
+						mark.mcid = state.mcid()
+					}
+					pageText.marks = append(pageText.marks, mark)
+				}
 				state.numChars += formResult.numChars
 				state.numMisses += formResult.numMisses
 			}
@@ -532,6 +546,46 @@ type textState struct {
 
 	numChars  int
 	numMisses int
+
+	// Marked-content identifiers of the enclosing marked-content sequences (innermost last),
+	// -1 for sequences without identifier.
+	mcids []int
+}
+
+// mcid returns the marked-content identifier of the current text, or -1 if none.
+func (state *textState) mcid() int {
+	if len(state.mcids) == 0 {
+		return -1
+	}
+	return state.mcids[len(state.mcids)-1]
+}
+
+// markedContentID returns the MCID of the properties of BDC operation `op`, an inline dictionary
+// or a name of the Properties resources, or `parent` if the properties have no MCID.
+func markedContentID(op *contentstream.ContentStreamOperation, resources *model.PdfPageResources,
+	parent int) int {
+	if len(op.Params) != 2 {
+		return parent
+	}
+	props := op.Params[1]
+	if name, ok := core.GetName(props); ok {
+		if resources == nil {
+			return parent
+		}
+		propsDict, ok := core.GetDict(resources.Properties)
+		if !ok {
+			return parent
+		}
+		props = propsDict.Get(*name)
+	}
+	dict, ok := core.GetDict(props)
+	if !ok {
+		return parent
+	}
+	if mcid, ok := core.GetIntVal(dict.Get("MCID")); ok {
+		return mcid
+	}
+	return parent
 }
 
 type textObject struct {
@@ -672,6 +726,7 @@ type textMark struct {
 	height        float64
 	spaceWidth    float64
 	count         int64
+	mcid          int
 }
 
 func (to *textObject) newTextMark(text string, trm transform.Matrix, end transform.Point, spaceWidth float64) textMark {
@@ -693,6 +748,7 @@ func (to *textObject) newTextMark(text string, trm transform.Matrix, end transfo
 		height:        height,
 		spaceWidth:    spaceWidth,
 		count:         to.e.textCount,
+		mcid:          to.state.mcid(),
 	}
 }
 
@@ -739,6 +795,23 @@ func (pt PageText) height() float64 {
 	return fontHeight
 }
 
+// MarkedContentText returns the text of the marked-content sequences of the page by marked-content
+// identifier (MCID). The structure elements of tagged documents reference their content by MCID
+// (see model.PdfStructTreeRoot).
+func (pt PageText) MarkedContentText() map[int]string {
+	marks := map[int][]textMark{}
+	for _, mark := range pt.marks {
+		if mark.mcid >= 0 {
+			marks[mark.mcid] = append(marks[mark.mcid], mark)
+		}
+	}
+	texts := make(map[int]string, len(marks))
+	for mcid, m := range marks {
+		texts[mcid] = PageText{marks: m}.ToText()
+	}
+	return texts
+}
+
 func (pt PageText) ToText() string {
 	fontHeight := pt.height()
 
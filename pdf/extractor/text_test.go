@@ -10,6 +10,7 @@ import (
 	"testing"
 
 	"github.com/finalversus/doc/common"
+	"github.com/finalversus/doc/pdf/core"
 	"github.com/finalversus/doc/pdf/model"
 
 	"golang.org/x/text/unicode/norm"
@@ -109,6 +110,59 @@ func TestTextExtractionFragments(t *testing.T) {
 	}
 }
 
+func TestTextExtractionMarkedContent(t *testing.T) {
+	contents := `
+        /H1 <</MCID 0>> BDC
+        BT
+        /UniDocCourier 24 Tf
+        10 700 Td
+        (Title)Tj
+        ET
+        EMC
+        /Artifact BMC
+        BT
+        /UniDocCourier 10 Tf
+        10 20 Td
+        (Footer)Tj
+        ET
+        EMC
+        /P /MC1 BDC
+        BT
+        /UniDocCourier 12 Tf
+        10 600 Td
+        (Body)Tj
+        /Span BMC
+        ( text)Tj
+        EMC
+        ET
+        EMC
+        `
+
+	resources := model.NewPdfPageResources()
+	resources.SetFontByName("UniDocCourier", model.NewStandard14FontMustCompile(model.CourierName).ToPdfObject())
+	props := core.MakeDict()
+	mc1 := core.MakeDict()
+	mc1.Set("MCID", core.MakeInteger(1))
+	props.Set("MC1", mc1)
+	resources.Properties = props
+
+	e := Extractor{resources: resources, contents: contents}
+	pageText, _, _, err := e.ExtractPageText()
+	if err != nil {
+		t.Fatalf("Error extracting text: %v", err)
+	}
+	texts := pageText.MarkedContentText()
+	expected := map[int]string{0: "Title", 1: "Body text"}
+	if len(texts) != len(expected) {
+		t.Fatalf("Marked content mismatch. Got %q. Expected %q", texts, expected)
+	}
+	for mcid, text := range expected {
+		if texts[mcid] != text {
+			t.Fatalf("Text mismatch for MCID %d. Got %q. Expected %q", mcid, texts[mcid], text)
+		}
+	}
+}
+
 func TestTextExtractionFiles(t *testing.T) {
 	if len(corpusFolder) == 0 && !forceTest {
 		t.Log("Corpus folder not set - skipping")
@@ -0,0 +1,98 @@
+package e2etest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/finalversus/doc/pdf/model"
+)
+
+// The lazy scan test loads the content streams of every page of the PDF files in a corpus with a
+// lazy-loading reader with a bounded object cache, and samples the heap in use while scanning.
+// With a bounded cache the heap profile should stay flat, regardless of the number of pages.
+// Set environment variables:
+//		UNIDOC_E2E_FORCE_TESTS to "1" to force the tests to execute.
+//		UNIDOC_LAZYSCAN_TESTDATA to the path of the corpus folder.
+var (
+	lazyScanCorpusFolder = os.Getenv("UNIDOC_LAZYSCAN_TESTDATA")
+)
+
+const (
+	// lazyScanMaxCachedObjects is the object cache limit used for the lazy scan test.
+	lazyScanMaxCachedObjects = 500
+
+	// lazyScanSampleInterval is the number of pages between heap samples.
+	lazyScanSampleInterval = 100
+)
+
+func TestLazyScanMemory(t *testing.T) {
+	if len(lazyScanCorpusFolder) == 0 {
+		if forceTest {
+			t.Fatalf("UNIDOC_LAZYSCAN_TESTDATA not set")
+		}
+	}
+
+	files, err := ioutil.ReadDir(lazyScanCorpusFolder)
+	if err != nil {
+		if forceTest {
+			t.Fatalf("Error opening %s: %v", lazyScanCorpusFolder, err)
+		}
+		t.Skipf("Skipping lazy scan test - unable to open UNIDOC_LAZYSCAN_TESTDATA (%s)", lazyScanCorpusFolder)
+		return
+	}
+
+	for _, file := range files {
+		// Ensure memory is garbage collected prior to running for consistency.
+		debug.FreeOSMemory()
+
+		fpath := filepath.Join(lazyScanCorpusFolder, file.Name())
+		t.Logf("%s", fpath)
+		lazyScanSinglePdf(t, fpath)
+	}
+}
+
+func lazyScanSinglePdf(t *testing.T, inputPath string) {
+	measure := startMemoryMeasurement()
+
+	file, err := os.Open(inputPath)
+	require.NoError(t, err)
+	defer file.Close()
+
+	reader, err := model.NewPdfReaderWithOpts(file, &model.ReaderOpts{
+		LazyLoad:         true,
+		MaxCachedObjects: lazyScanMaxCachedObjects,
+	})
+	require.NoError(t, err)
+
+	isEncrypted, err := reader.IsEncrypted()
+	require.NoError(t, err)
+	if isEncrypted {
+		auth, err := reader.Decrypt([]byte(""))
+		require.NoError(t, err)
+		require.True(t, auth)
+	}
+
+	numPages, err := reader.GetNumPages()
+	require.NoError(t, err)
+
+	measure.Sample()
+	for i := 1; i <= numPages; i++ {
+		page, err := reader.GetPage(i)
+		require.NoError(t, err)
+
+		_, err = page.GetAllContentStreams()
+		require.NoError(t, err)
+
+		if i%lazyScanSampleInterval == 0 {
+			measure.Sample()
+		}
+	}
+	measure.Sample()
+
+	measure.Stop()
+	t.Logf("%s - %d pages - summary %s", inputPath, numPages, measure.Summary())
+}
@@ -14,6 +14,9 @@ type memoryMeasure struct {
 	startTime time.Time
 	end       runtime.MemStats
 	endTime   time.Time
+
+	// Heap in use (bytes) recorded by Sample, used for checking the memory profile over time.
+	samples []uint64
 }
 
 func startMemoryMeasurement() memoryMeasure {
@@ -30,6 +33,30 @@ func (m *memoryMeasure) Stop() {
 	m.endTime = time.Now().UTC()
 }
 
+// Sample records the heap in use after a garbage collection.
+func (m *memoryMeasure) Sample() {
+	runtime.GC()
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	m.samples = append(m.samples, ms.HeapAlloc)
+}
+
+// Samples returns the heap in use (bytes) of the recorded samples.
+func (m memoryMeasure) Samples() []uint64 {
+	return m.samples
+}
+
+// PeakSample returns the highest recorded heap in use (bytes).
+func (m memoryMeasure) PeakSample() uint64 {
+	var peak uint64
+	for _, s := range m.samples {
+		if s > peak {
+			peak = s
+		}
+	}
+	return peak
+}
+
 func (m memoryMeasure) Summary() string {
 	alloc := float64(m.end.Alloc) - float64(m.start.Alloc)
 	mallocs := int64(m.end.Mallocs) - int64(m.start.Mallocs)
@@ -42,5 +69,13 @@ func (m memoryMeasure) Summary() string {
 	b.WriteString(fmt.Sprintf("Alloc: %.2f MB\n", alloc/1024.0/1024.0))
 	b.WriteString(fmt.Sprintf("Mallocs: %d\n", mallocs))
 	b.WriteString(fmt.Sprintf("Frees: %d\n", frees))
+	if len(m.samples) > 0 {
+		b.WriteString(fmt.Sprintf("Peak heap: %.2f MB\n", float64(m.PeakSample())/1024.0/1024.0))
+		b.WriteString("Heap profile (MB):")
+		for _, s := range m.samples {
+			b.WriteString(fmt.Sprintf(" %.2f", float64(s)/1024.0/1024.0))
+		}
+		b.WriteString("\n")
+	}
 	return b.String()
 }
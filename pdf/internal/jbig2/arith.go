@@ -0,0 +1,62 @@
+package jbig2
+
+import "github.com/finalversus/doc/pdf/internal/mq"
+
+// newIntContexts returns the contexts for an integer arithmetic decoding procedure (IAx).
+func newIntContexts() []byte {
+	return make([]byte, 512)
+}
+
+// decodeInt decodes an integer with `d` using the procedure described in Annex A.2 with the
+// contexts `cx`. The second return value is false when the out-of-band value is decoded.
+func decodeInt(d *mq.Decoder, cx []byte) (int, bool) {
+	prev := 1
+	readBits := func(n int) int {
+		v := 0
+		for i := 0; i < n; i++ {
+			bit := d.DecodeBit(cx, prev)
+			if prev < 256 {
+				prev = prev<<1 | bit
+			} else {
+				prev = ((prev<<1 | bit) & 511) | 256
+			}
+			v = v<<1 | bit
+		}
+		return v
+	}
+
+	sign := readBits(1)
+	var v int
+	switch {
+	case readBits(1) == 0:
+		v = readBits(2)
+	case readBits(1) == 0:
+		v = readBits(4) + 4
+	case readBits(1) == 0:
+		v = readBits(6) + 20
+	case readBits(1) == 0:
+		v = readBits(8) + 84
+	case readBits(1) == 0:
+		v = readBits(12) + 340
+	default:
+		v = readBits(32) + 4436
+	}
+
+	if sign == 0 {
+		return v, true
+	}
+	if v > 0 {
+		return -v, true
+	}
+	return 0, false
+}
+
+// decodeIAID decodes a symbol ID using the procedure described in Annex A.3 with code length `codeLen`.
+func decodeIAID(d *mq.Decoder, cx []byte, codeLen int) int {
+	prev := 1
+	for i := 0; i < codeLen; i++ {
+		bit := d.DecodeBit(cx, prev)
+		prev = prev<<1 | bit
+	}
+	return prev - (1 << uint(codeLen))
+}
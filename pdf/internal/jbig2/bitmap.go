@@ -0,0 +1,163 @@
+package jbig2
+
+import "errors"
+
+// maxBitmapPixels limits the size of the bitmaps allocated by the decoder so that
+// corrupt headers cannot trigger huge allocations.
+const maxBitmapPixels = 1 << 28
+
+// errBitmapTooLarge is returned when a segment requests a bitmap larger than maxBitmapPixels.
+var errBitmapTooLarge = errors.New("jbig2: bitmap dimensions too large")
+
+// combinationOperator defines how a region bitmap is combined with the page bitmap.
+type combinationOperator int
+
+// Combination operators as defined in section 7.4.1.5 of the JBIG2 specification.
+const (
+	combineOR combinationOperator = iota
+	combineAND
+	combineXOR
+	combineXNOR
+	combineReplace
+)
+
+// Bitmap represents a bi-level image. Each pixel is stored in a separate byte
+// where 1 denotes a black pixel and 0 a white pixel.
+type Bitmap struct {
+	Width  int
+	Height int
+	Data   []byte
+}
+
+// NewBitmap returns a new white bitmap with the specified dimensions.
+func NewBitmap(width, height int) (*Bitmap, error) {
+	if width < 0 || height < 0 || (height > 0 && width > maxBitmapPixels/height) {
+		return nil, errBitmapTooLarge
+	}
+	return &Bitmap{
+		Width:  width,
+		Height: height,
+		Data:   make([]byte, width*height),
+	}, nil
+}
+
+// GetPixel returns the value of the pixel at (x, y). Pixels outside the bitmap are white (0).
+func (b *Bitmap) GetPixel(x, y int) byte {
+	if x < 0 || y < 0 || x >= b.Width || y >= b.Height {
+		return 0
+	}
+	return b.Data[y*b.Width+x]
+}
+
+// SetPixel sets the value of the pixel at (x, y). Pixels outside the bitmap are ignored.
+func (b *Bitmap) SetPixel(x, y int, v byte) {
+	if x < 0 || y < 0 || x >= b.Width || y >= b.Height {
+		return
+	}
+	b.Data[y*b.Width+x] = v
+}
+
+// fill sets all pixels of the bitmap to `v`.
+func (b *Bitmap) fill(v byte) {
+	for i := range b.Data {
+		b.Data[i] = v
+	}
+}
+
+// row returns the pixels of row `y`.
+func (b *Bitmap) row(y int) []byte {
+	return b.Data[y*b.Width : (y+1)*b.Width]
+}
+
+// subBitmap returns a copy of the rectangular area of `b` starting at (x, y) with
+// the specified dimensions. Pixels outside `b` are white.
+func (b *Bitmap) subBitmap(x, y, width, height int) (*Bitmap, error) {
+	sub, err := NewBitmap(width, height)
+	if err != nil {
+		return nil, err
+	}
+	for j := 0; j < height; j++ {
+		for i := 0; i < width; i++ {
+			sub.Data[j*width+i] = b.GetPixel(x+i, y+j)
+		}
+	}
+	return sub, nil
+}
+
+// growHeight extends the bitmap to `height` rows filling the new rows with `v`.
+func (b *Bitmap) growHeight(height int, v byte) error {
+	if height <= b.Height {
+		return nil
+	}
+	if b.Width > 0 && height > maxBitmapPixels/b.Width {
+		return errBitmapTooLarge
+	}
+	data := make([]byte, b.Width*height)
+	copy(data, b.Data)
+	if v != 0 {
+		for i := len(b.Data); i < len(data); i++ {
+			data[i] = v
+		}
+	}
+	b.Data = data
+	b.Height = height
+	return nil
+}
+
+// compose combines `src` onto `b` with its top left corner at (x, y) using operator `op`.
+func (b *Bitmap) compose(src *Bitmap, x, y int, op combinationOperator) {
+	for j := 0; j < src.Height; j++ {
+		dy := y + j
+		if dy < 0 || dy >= b.Height {
+			continue
+		}
+		srow := src.row(j)
+		drow := b.row(dy)
+		for i, s := range srow {
+			dx := x + i
+			if dx < 0 || dx >= b.Width {
+				continue
+			}
+			d := drow[dx]
+			switch op {
+			case combineOR:
+				d |= s
+			case combineAND:
+				d &= s
+			case combineXOR:
+				d ^= s
+			case combineXNOR:
+				d = 1 ^ (d ^ s)
+			case combineReplace:
+				d = s
+			}
+			drow[dx] = d
+		}
+	}
+}
+
+// ToBytes packs the bitmap into rows of bytes, 8 pixels per byte with the most significant
+// bit first, each row padded to a byte boundary. If `blackIs1` is false, the pixel values
+// are inverted so that 0 denotes black, which is the convention used by the PDF JBIG2Decode filter.
+func (b *Bitmap) ToBytes(blackIs1 bool) []byte {
+	stride := (b.Width + 7) / 8
+	out := make([]byte, stride*b.Height)
+	for y := 0; y < b.Height; y++ {
+		row := b.row(y)
+		dst := out[y*stride : (y+1)*stride]
+		for x, v := range row {
+			if v != 0 {
+				dst[x>>3] |= 0x80 >> uint(x&7)
+			}
+		}
+		if !blackIs1 {
+			for i := range dst {
+				dst[i] = ^dst[i]
+			}
+			if rem := b.Width & 7; rem != 0 {
+				dst[stride-1] &= 0xff << uint(8-rem)
+			}
+		}
+	}
+	return out
+}
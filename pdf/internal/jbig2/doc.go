@@ -0,0 +1,7 @@
+// Package jbig2 implements a decoder for JBIG2 bi-level image data as defined
+// in ITU-T recommendation T.88 and embedded in PDF files via the JBIG2Decode filter.
+//
+// The decoder supports generic regions (MMR and arithmetic coding), generic
+// refinement regions, symbol dictionaries, text regions, pattern dictionaries and
+// halftone regions, as well as standard and user-defined Huffman tables.
+package jbig2
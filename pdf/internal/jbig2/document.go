@@ -0,0 +1,679 @@
+package jbig2
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/finalversus/doc/pdf/internal/mq"
+)
+
+// Segment types (section 7.3).
+const (
+	segmentSymbolDictionary               = 0
+	segmentIntermediateTextRegion         = 4
+	segmentImmediateTextRegion            = 6
+	segmentImmediateLosslessTextRegion    = 7
+	segmentPatternDictionary              = 16
+	segmentIntermediateHalftoneRegion     = 20
+	segmentImmediateHalftoneRegion        = 22
+	segmentImmediateLosslessHalftone      = 23
+	segmentIntermediateGenericRegion      = 36
+	segmentImmediateGenericRegion         = 38
+	segmentImmediateLosslessGenericRegion = 39
+	segmentIntermediateRefinementRegion   = 40
+	segmentImmediateRefinementRegion      = 42
+	segmentImmediateLosslessRefinement    = 43
+	segmentPageInformation                = 48
+	segmentEndOfPage                      = 49
+	segmentEndOfStripe                    = 50
+	segmentEndOfFile                      = 51
+	segmentProfiles                       = 52
+	segmentTables                         = 53
+	segmentExtension                      = 62
+)
+
+// maxSymbols limits the number of symbols a symbol dictionary may define.
+const maxSymbols = 1 << 20
+
+// unknownLength is the segment data length value used for immediate generic regions whose
+// length is determined by scanning for the end of the coded data (section 7.2.7).
+const unknownLength = 0xffffffff
+
+// segment is a parsed JBIG2 segment along with the results of decoding it that can be
+// referred to by later segments.
+type segment struct {
+	number    uint32
+	kind      int
+	pageAssoc uint32
+	referred  []uint32
+	data      []byte
+
+	symbols  []*Bitmap
+	patterns []*Bitmap
+	table    *huffmanTable
+	bitmap   *Bitmap
+}
+
+// regionInfo is the region segment information field (section 7.4.1).
+type regionInfo struct {
+	width         int
+	height        int
+	x             int
+	y             int
+	combOp        combinationOperator
+	unknownHeight bool
+}
+
+// decoder holds the state of the decoding of an embedded JBIG2 stream.
+type decoder struct {
+	segments      map[uint32]*segment
+	page          *Bitmap
+	pageDefPixel  byte
+	unknownHeight bool
+	done          bool
+}
+
+// Decode decodes the JBIG2 embedded stream `data` (sequential organization without file header,
+// as used by the PDF JBIG2Decode filter) and returns the bitmap of its page. `globals` holds the
+// optional global segments (the content of the JBIG2Globals stream).
+func Decode(data, globals []byte) (*Bitmap, error) {
+	d := &decoder{segments: map[uint32]*segment{}}
+	if len(globals) > 0 {
+		if err := d.decodeSegments(globals); err != nil {
+			return nil, fmt.Errorf("jbig2: globals: %v", err)
+		}
+		d.done = false
+	}
+	if err := d.decodeSegments(data); err != nil {
+		return nil, err
+	}
+	if d.page == nil {
+		return nil, errors.New("jbig2: missing page information segment")
+	}
+	return d.page, nil
+}
+
+// decodeSegments parses and decodes the segments of `data` until the end of data,
+// the end of the page or the end of file segment.
+func (d *decoder) decodeSegments(data []byte) error {
+	r := newReader(data)
+	for !d.done && r.remaining() > 0 {
+		s, length, err := readSegmentHeader(r)
+		if err != nil {
+			return err
+		}
+		if length == unknownLength {
+			if s.kind != segmentImmediateGenericRegion {
+				return fmt.Errorf("jbig2: unknown data length of segment %d", s.number)
+			}
+			length, err = findGenericRegionEnd(r.data[r.pos:])
+			if err != nil {
+				return err
+			}
+		}
+		if s.data, err = r.bytes(int(length)); err != nil {
+			return err
+		}
+		if err := d.decodeSegment(s); err != nil {
+			return fmt.Errorf("jbig2: segment %d (type %d): %v", s.number, s.kind, err)
+		}
+		d.segments[s.number] = s
+	}
+	return nil
+}
+
+// readSegmentHeader reads a segment header (section 7.2) and returns the segment along
+// with its data length.
+func readSegmentHeader(r *reader) (*segment, uint32, error) {
+	number, err := r.readUint32()
+	if err != nil {
+		return nil, 0, err
+	}
+	flags, err := r.readByte()
+	if err != nil {
+		return nil, 0, err
+	}
+	s := &segment{number: number, kind: int(flags & 0x3f)}
+
+	b, err := r.readByte()
+	if err != nil {
+		return nil, 0, err
+	}
+	count := int(b >> 5)
+	switch count {
+	case 5, 6:
+		return nil, 0, fmt.Errorf("jbig2: invalid referred-to segment count in segment %d", number)
+	case 7:
+		rest, err := r.bytes(3)
+		if err != nil {
+			return nil, 0, err
+		}
+		count = int((uint32(b)<<24 | uint32(rest[0])<<16 | uint32(rest[1])<<8 | uint32(rest[2])) & 0x1fffffff)
+		if _, err := r.bytes((count + 8) / 8); err != nil {
+			return nil, 0, err
+		}
+	}
+	if count > r.remaining() {
+		return nil, 0, errUnexpectedEOF
+	}
+
+	refSize := 4
+	if number <= 256 {
+		refSize = 1
+	} else if number <= 65536 {
+		refSize = 2
+	}
+	s.referred = make([]uint32, count)
+	for i := range s.referred {
+		switch refSize {
+		case 1:
+			v, err := r.readByte()
+			if err != nil {
+				return nil, 0, err
+			}
+			s.referred[i] = uint32(v)
+		case 2:
+			v, err := r.readUint16()
+			if err != nil {
+				return nil, 0, err
+			}
+			s.referred[i] = uint32(v)
+		default:
+			if s.referred[i], err = r.readUint32(); err != nil {
+				return nil, 0, err
+			}
+		}
+	}
+
+	if flags&0x40 != 0 {
+		s.pageAssoc, err = r.readUint32()
+	} else {
+		var v byte
+		v, err = r.readByte()
+		s.pageAssoc = uint32(v)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	length, err := r.readUint32()
+	if err != nil {
+		return nil, 0, err
+	}
+	return s, length, nil
+}
+
+// findGenericRegionEnd determines the length of the data of an immediate generic region
+// segment of unknown length by locating the end marker of the coded data followed by the
+// row count (section 7.2.7).
+func findGenericRegionEnd(data []byte) (uint32, error) {
+	const headerLen = 18
+	if len(data) < headerLen {
+		return 0, errUnexpectedEOF
+	}
+	marker := []byte{0xff, 0xac}
+	if data[17]&1 != 0 {
+		marker = []byte{0x00, 0x00}
+	}
+	i := bytes.Index(data[headerLen:], marker)
+	if i < 0 || headerLen+i+2+4 > len(data) {
+		return 0, errors.New("jbig2: end of generic region of unknown length not found")
+	}
+	return uint32(headerLen + i + 2 + 4), nil
+}
+
+// decodeSegment decodes segment `s` and stores its results.
+func (d *decoder) decodeSegment(s *segment) error {
+	switch s.kind {
+	case segmentPageInformation:
+		if d.page != nil {
+			// Only the first page is decoded.
+			d.done = true
+			return nil
+		}
+		return d.decodePageInformation(s)
+	case segmentEndOfPage, segmentEndOfFile:
+		d.done = true
+		return nil
+	case segmentEndOfStripe:
+		return d.decodeEndOfStripe(s)
+	case segmentTables:
+		t, err := parseTableSegment(s.data)
+		if err != nil {
+			return err
+		}
+		s.table = t
+		return nil
+	case segmentSymbolDictionary:
+		return d.decodeSymbolDictionarySegment(s)
+	case segmentPatternDictionary:
+		patterns, err := decodePatternDictionary(s.data)
+		if err != nil {
+			return err
+		}
+		s.patterns = patterns
+		return nil
+	case segmentIntermediateTextRegion, segmentImmediateTextRegion, segmentImmediateLosslessTextRegion:
+		return d.decodeRegion(s, d.decodeTextRegionSegment)
+	case segmentIntermediateHalftoneRegion, segmentImmediateHalftoneRegion, segmentImmediateLosslessHalftone:
+		return d.decodeRegion(s, d.decodeHalftoneRegionSegment)
+	case segmentIntermediateGenericRegion, segmentImmediateGenericRegion, segmentImmediateLosslessGenericRegion:
+		return d.decodeRegion(s, d.decodeGenericRegionSegment)
+	case segmentIntermediateRefinementRegion, segmentImmediateRefinementRegion, segmentImmediateLosslessRefinement:
+		return d.decodeRegion(s, d.decodeRefinementRegionSegment)
+	}
+	// Profiles, extensions and reserved segment types are ignored.
+	return nil
+}
+
+// decodePageInformation decodes a page information segment (section 7.4.8) and allocates the page.
+func (d *decoder) decodePageInformation(s *segment) error {
+	r := newReader(s.data)
+	width, err := r.readUint32()
+	if err != nil {
+		return err
+	}
+	height, err := r.readUint32()
+	if err != nil {
+		return err
+	}
+	if _, err := r.bytes(8); err != nil {
+		return err
+	}
+	flags, err := r.readByte()
+	if err != nil {
+		return err
+	}
+	if height == 0xffffffff {
+		d.unknownHeight = true
+		height = 0
+	}
+	if width > maxBitmapPixels || height > maxBitmapPixels {
+		return errBitmapTooLarge
+	}
+	page, err := NewBitmap(int(width), int(height))
+	if err != nil {
+		return err
+	}
+	d.pageDefPixel = (flags >> 2) & 1
+	if d.pageDefPixel != 0 {
+		page.fill(1)
+	}
+	d.page = page
+	return nil
+}
+
+// decodeEndOfStripe handles an end of stripe segment (section 7.4.10) by growing
+// a page of unknown height.
+func (d *decoder) decodeEndOfStripe(s *segment) error {
+	if d.page == nil {
+		return errors.New("jbig2: end of stripe before page information")
+	}
+	endRow, err := newReader(s.data).readUint32()
+	if err != nil {
+		return err
+	}
+	if d.unknownHeight && endRow < maxBitmapPixels {
+		return d.page.growHeight(int(endRow)+1, d.pageDefPixel)
+	}
+	return nil
+}
+
+// decodeRegion decodes a region segment with `decodeFn` and either stores the region bitmap
+// for intermediate regions or combines it with the page for immediate regions.
+func (d *decoder) decodeRegion(s *segment, decodeFn func(*segment, *reader, regionInfo) (*Bitmap, error)) error {
+	r := newReader(s.data)
+	info, err := readRegionInfo(r)
+	if err != nil {
+		return err
+	}
+	bm, err := decodeFn(s, r, info)
+	if err != nil {
+		return err
+	}
+	switch s.kind {
+	case segmentIntermediateTextRegion, segmentIntermediateHalftoneRegion,
+		segmentIntermediateGenericRegion, segmentIntermediateRefinementRegion:
+		s.bitmap = bm
+		return nil
+	}
+	if d.page == nil {
+		return errors.New("jbig2: region segment before page information")
+	}
+	if d.unknownHeight {
+		if err := d.page.growHeight(info.y+bm.Height, d.pageDefPixel); err != nil {
+			return err
+		}
+	}
+	d.page.compose(bm, info.x, info.y, info.combOp)
+	return nil
+}
+
+// readRegionInfo reads the region segment information field.
+func readRegionInfo(r *reader) (regionInfo, error) {
+	var info regionInfo
+	var v [4]uint32
+	for i := range v {
+		n, err := r.readUint32()
+		if err != nil {
+			return info, err
+		}
+		v[i] = n
+	}
+	flags, err := r.readByte()
+	if err != nil {
+		return info, err
+	}
+	info.width, info.height = int(v[0]), int(v[1])
+	info.x, info.y = int(int32(v[2])), int(int32(v[3]))
+	info.combOp = combinationOperator(flags & 7)
+	info.unknownHeight = v[1] == 0xffffffff
+	return info, nil
+}
+
+// readAT reads `n` adaptive template pixel positions.
+func readAT(r *reader, n int) ([]point, error) {
+	at := make([]point, n)
+	for i := range at {
+		x, err := r.readInt8()
+		if err != nil {
+			return nil, err
+		}
+		y, err := r.readInt8()
+		if err != nil {
+			return nil, err
+		}
+		at[i] = point{x, y}
+	}
+	return at, nil
+}
+
+// referredSymbols returns the symbols exported by the symbol dictionaries referred to by `s`.
+func (d *decoder) referredSymbols(s *segment) []*Bitmap {
+	var symbols []*Bitmap
+	for _, n := range s.referred {
+		if ref, ok := d.segments[n]; ok && ref.kind == segmentSymbolDictionary {
+			symbols = append(symbols, ref.symbols...)
+		}
+	}
+	return symbols
+}
+
+// referredTables returns the user-defined Huffman tables referred to by `s`.
+func (d *decoder) referredTables(s *segment) *userTables {
+	u := &userTables{}
+	for _, n := range s.referred {
+		if ref, ok := d.segments[n]; ok && ref.kind == segmentTables {
+			u.tables = append(u.tables, ref.table)
+		}
+	}
+	return u
+}
+
+// decodeSymbolDictionarySegment decodes a symbol dictionary segment (section 7.4.2).
+func (d *decoder) decodeSymbolDictionarySegment(s *segment) error {
+	r := newReader(s.data)
+	flags, err := r.readUint16()
+	if err != nil {
+		return err
+	}
+	p := &symbolDictParams{
+		huffman:   flags&1 != 0,
+		refAgg:    flags&2 != 0,
+		template:  int(flags>>10) & 3,
+		rTemplate: int(flags>>12) & 1,
+	}
+	if !p.huffman {
+		n := 1
+		if p.template == 0 {
+			n = 4
+		}
+		if p.at, err = readAT(r, n); err != nil {
+			return err
+		}
+	}
+	if p.refAgg && p.rTemplate == 0 {
+		if p.rat, err = readAT(r, 2); err != nil {
+			return err
+		}
+	}
+	numExported, err := r.readUint32()
+	if err != nil {
+		return err
+	}
+	numNew, err := r.readUint32()
+	if err != nil {
+		return err
+	}
+	if numExported > maxSymbols || numNew > maxSymbols {
+		return fmt.Errorf("jbig2: too many symbols (%d exported, %d new)", numExported, numNew)
+	}
+	p.numExported = int(numExported)
+	p.numNew = int(numNew)
+	p.inputSymbols = d.referredSymbols(s)
+
+	if p.huffman {
+		tables := d.referredTables(s)
+		if p.tableDH, err = tables.selectTable(int(flags>>2)&3, 4, 5); err != nil {
+			return err
+		}
+		if p.tableDW, err = tables.selectTable(int(flags>>4)&3, 2, 3); err != nil {
+			return err
+		}
+		if p.tableBMSize, err = tables.selectTable(int(flags>>6)&1, 1); err != nil {
+			return err
+		}
+		if p.tableAggInst, err = tables.selectTable(int(flags>>7)&1, 1); err != nil {
+			return err
+		}
+	}
+
+	s.symbols, err = decodeSymbolDictionary(r, p)
+	return err
+}
+
+// decodeTextRegionSegment decodes the text region of segment `s` (section 7.4.3).
+func (d *decoder) decodeTextRegionSegment(s *segment, r *reader, info regionInfo) (*Bitmap, error) {
+	flags, err := r.readUint16()
+	if err != nil {
+		return nil, err
+	}
+	dsOffset := int(flags>>10) & 0x1f
+	if dsOffset > 0x0f {
+		dsOffset -= 0x20
+	}
+	p := &textRegionParams{
+		huffman:    flags&1 != 0,
+		refine:     flags&2 != 0,
+		width:      info.width,
+		height:     info.height,
+		logStrips:  int(flags>>2) & 3,
+		refCorner:  int(flags>>4) & 3,
+		transposed: flags&0x40 != 0,
+		combOp:     combinationOperator(flags>>7) & 3,
+		defPixel:   byte(flags>>9) & 1,
+		dsOffset:   dsOffset,
+		rTemplate:  int(flags>>15) & 1,
+	}
+
+	var hflags uint16
+	if p.huffman {
+		if hflags, err = r.readUint16(); err != nil {
+			return nil, err
+		}
+	}
+	if p.refine && p.rTemplate == 0 {
+		if p.rat, err = readAT(r, 2); err != nil {
+			return nil, err
+		}
+	}
+	numInstances, err := r.readUint32()
+	if err != nil {
+		return nil, err
+	}
+	if numInstances > maxBitmapPixels {
+		return nil, fmt.Errorf("jbig2: too many symbol instances (%d)", numInstances)
+	}
+	p.numInstances = int(numInstances)
+
+	p.symbols = d.referredSymbols(s)
+	for (1 << uint(p.symCodeLen)) < len(p.symbols) {
+		p.symCodeLen++
+	}
+
+	if !p.huffman {
+		return decodeTextRegion(r, newArithState(mq.NewDecoder(r.rest()), 0, p.symCodeLen), p)
+	}
+
+	tables := d.referredTables(s)
+	selections := []struct {
+		table    **huffmanTable
+		sel      int
+		standard []int
+	}{
+		{&p.tableFS, int(hflags) & 3, []int{6, 7}},
+		{&p.tableDS, int(hflags>>2) & 3, []int{8, 9, 10}},
+		{&p.tableDT, int(hflags>>4) & 3, []int{11, 12, 13}},
+		{&p.tableRDW, int(hflags>>6) & 3, []int{14, 15}},
+		{&p.tableRDH, int(hflags>>8) & 3, []int{14, 15}},
+		{&p.tableRDX, int(hflags>>10) & 3, []int{14, 15}},
+		{&p.tableRDY, int(hflags>>12) & 3, []int{14, 15}},
+		{&p.tableRSize, int(hflags>>14) & 1, []int{1}},
+	}
+	for _, sel := range selections {
+		if *sel.table, err = tables.selectTable(sel.sel, sel.standard...); err != nil {
+			return nil, err
+		}
+	}
+	if p.symCodes, err = readSymbolIDTable(r, len(p.symbols)); err != nil {
+		return nil, err
+	}
+	return decodeTextRegion(r, newArithState(nil, 0, p.symCodeLen), p)
+}
+
+// decodeHalftoneRegionSegment decodes the halftone region of segment `s` (section 7.4.5).
+func (d *decoder) decodeHalftoneRegionSegment(s *segment, r *reader, info regionInfo) (*Bitmap, error) {
+	flags, err := r.readByte()
+	if err != nil {
+		return nil, err
+	}
+	var grid [4]uint32
+	for i := range grid {
+		if grid[i], err = r.readUint32(); err != nil {
+			return nil, err
+		}
+	}
+	vectorX, err := r.readUint16()
+	if err != nil {
+		return nil, err
+	}
+	vectorY, err := r.readUint16()
+	if err != nil {
+		return nil, err
+	}
+	if grid[0] > maxBitmapPixels || grid[1] > maxBitmapPixels {
+		return nil, errBitmapTooLarge
+	}
+
+	var patterns []*Bitmap
+	for _, n := range s.referred {
+		if ref, ok := d.segments[n]; ok && ref.kind == segmentPatternDictionary {
+			patterns = ref.patterns
+			break
+		}
+	}
+
+	return decodeHalftoneRegion(r.rest(), &halftoneRegionParams{
+		width:      info.width,
+		height:     info.height,
+		mmr:        flags&1 != 0,
+		template:   int(flags>>1) & 3,
+		enableSkip: flags&8 != 0,
+		combOp:     combinationOperator(flags>>4) & 7,
+		defPixel:   (flags >> 7) & 1,
+		gridWidth:  int(grid[0]),
+		gridHeight: int(grid[1]),
+		gridX:      int(int32(grid[2])),
+		gridY:      int(int32(grid[3])),
+		vectorX:    int(vectorX),
+		vectorY:    int(vectorY),
+		patterns:   patterns,
+	})
+}
+
+// decodeGenericRegionSegment decodes the generic region of segment `s` (section 7.4.6).
+func (d *decoder) decodeGenericRegionSegment(s *segment, r *reader, info regionInfo) (*Bitmap, error) {
+	flags, err := r.readByte()
+	if err != nil {
+		return nil, err
+	}
+	p := &genericRegionParams{
+		mmr:      flags&1 != 0,
+		width:    info.width,
+		height:   info.height,
+		template: int(flags>>1) & 3,
+		tpgdon:   flags&8 != 0,
+	}
+	if !p.mmr {
+		n := 1
+		if p.template == 0 {
+			n = 4
+		}
+		if p.at, err = readAT(r, n); err != nil {
+			return nil, err
+		}
+	}
+	data := r.rest()
+	if s.kind == segmentImmediateGenericRegion && info.unknownHeight {
+		// The data of a region of unknown height ends with its row count.
+		if len(data) < 4 {
+			return nil, errUnexpectedEOF
+		}
+		rows := newReader(data[len(data)-4:])
+		n, _ := rows.readUint32()
+		p.height = int(n)
+		data = data[:len(data)-4]
+	}
+
+	if p.mmr {
+		bm, _, err := decodeMMR(data, p.width, p.height)
+		return bm, err
+	}
+	return decodeGenericRegion(mq.NewDecoder(data), newGenericContexts(p.template), p)
+}
+
+// decodeRefinementRegionSegment decodes the generic refinement region of segment `s` (section 7.4.7).
+func (d *decoder) decodeRefinementRegionSegment(s *segment, r *reader, info regionInfo) (*Bitmap, error) {
+	flags, err := r.readByte()
+	if err != nil {
+		return nil, err
+	}
+	p := &refinementRegionParams{
+		width:    info.width,
+		height:   info.height,
+		template: int(flags & 1),
+		tpgron:   flags&2 != 0,
+	}
+	if p.template == 0 {
+		if p.at, err = readAT(r, 2); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, n := range s.referred {
+		if ref, ok := d.segments[n]; ok && ref.bitmap != nil {
+			p.reference = ref.bitmap
+			break
+		}
+	}
+	if p.reference == nil {
+		if d.page == nil {
+			return nil, errors.New("jbig2: refinement region before page information")
+		}
+		if p.reference, err = d.page.subBitmap(info.x, info.y, info.width, info.height); err != nil {
+			return nil, err
+		}
+	}
+	return decodeRefinementRegion(mq.NewDecoder(r.rest()), newRefinementContexts(), p)
+}
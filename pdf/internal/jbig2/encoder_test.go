@@ -0,0 +1,326 @@
+package jbig2
+
+import "github.com/finalversus/doc/pdf/internal/mq"
+
+// The encoders below produce the arithmetic coded data decoded by the tests. They compute
+// the contexts from the pixel layouts of the specification rather than from the decoder
+// tables. The typical prediction bits share their contexts with the pixels, so a decoder
+// context layout that differs from the specification changes the decoded data of bitmaps
+// containing the neighbourhoods of those contexts.
+
+// genericContextPixels returns the pixels forming the context of a generic region template
+// (section 6.2.5.3) from the least significant bit of the context, with the adaptive
+// template pixels `at`.
+func genericContextPixels(template int, at []point) []point {
+	switch template {
+	case 0:
+		return []point{{-1, 0}, {-2, 0}, {-3, 0}, {-4, 0}, at[0],
+			{2, -1}, {1, -1}, {0, -1}, {-1, -1}, {-2, -1}, at[1],
+			at[2], {1, -2}, {0, -2}, {-1, -2}, at[3]}
+	case 1:
+		return []point{{-1, 0}, {-2, 0}, {-3, 0}, at[0],
+			{2, -1}, {1, -1}, {0, -1}, {-1, -1}, {-2, -1},
+			{2, -2}, {1, -2}, {0, -2}, {-1, -2}}
+	case 2:
+		return []point{{-1, 0}, {-2, 0}, at[0],
+			{1, -1}, {0, -1}, {-1, -1}, {-2, -1},
+			{1, -2}, {0, -2}, {-1, -2}}
+	}
+	return []point{{-1, 0}, {-2, 0}, {-3, 0}, {-4, 0}, at[0],
+		{1, -1}, {0, -1}, {-1, -1}, {-2, -1}, {-3, -1}}
+}
+
+// genericContext computes the context of pixel (x, y) formed by `pixels`.
+func genericContext(bm *Bitmap, pixels []point, x, y int) int {
+	context := 0
+	for i, p := range pixels {
+		context |= int(bm.GetPixel(x+p.x, y+p.y)) << uint(i)
+	}
+	return context
+}
+
+// testSLTPContexts are the contexts of the SLTP bit of generic regions (section 6.2.5.7).
+var testSLTPContexts = [4]int{0x9B25, 0x0795, 0x00E5, 0x0195}
+
+// encodeGenericRegion encodes `bm` with the generic region encoding procedure. Pixels set in
+// `skip` are not coded and must be white in `bm`.
+func encodeGenericRegion(e *mq.Encoder, cx []byte, bm *Bitmap, template int, tpgdon bool, skip *Bitmap, at []point) {
+	pixels := genericContextPixels(template, at)
+	ltp := 0
+	for y := 0; y < bm.Height; y++ {
+		if tpgdon {
+			typical := 1
+			for x := 0; x < bm.Width; x++ {
+				if bm.GetPixel(x, y) != bm.GetPixel(x, y-1) {
+					typical = 0
+					break
+				}
+			}
+			e.EncodeBit(cx, testSLTPContexts[template], typical^ltp)
+			ltp = typical
+			if ltp == 1 {
+				continue
+			}
+		}
+		for x := 0; x < bm.Width; x++ {
+			if skip != nil && skip.GetPixel(x, y) == 1 {
+				continue
+			}
+			e.EncodeBit(cx, genericContext(bm, pixels, x, y), int(bm.GetPixel(x, y)))
+		}
+	}
+}
+
+// refinementContext computes the context of pixel (x, y) of a generic refinement region
+// (section 6.3.5.3) with reference offset (dx, dy).
+func refinementContext(bm, ref *Bitmap, template int, at []point, x, y, dx, dy int) int {
+	p := func(i, j int) int { return int(bm.GetPixel(x+i, y+j)) }
+	r := func(i, j int) int { return int(ref.GetPixel(x-dx+i, y-dy+j)) }
+	if template == 0 {
+		return p(-1, 0) | p(1, -1)<<1 | p(0, -1)<<2 | p(at[0].x, at[0].y)<<3 |
+			r(1, 1)<<4 | r(0, 1)<<5 | r(-1, 1)<<6 | r(1, 0)<<7 | r(0, 0)<<8 | r(-1, 0)<<9 |
+			r(1, -1)<<10 | r(0, -1)<<11 | r(at[1].x, at[1].y)<<12
+	}
+	return p(-1, 0) | p(1, -1)<<1 | p(0, -1)<<2 | p(-1, -1)<<3 |
+		r(1, 1)<<4 | r(0, 1)<<5 | r(1, 0)<<6 | r(0, 0)<<7 | r(-1, 0)<<8 | r(0, -1)<<9
+}
+
+// testRefinementSLTPContexts are the contexts of the SLTP bit of refinement regions (section 6.3.5.6).
+var testRefinementSLTPContexts = [2]int{0x0100, 0x0080}
+
+// encodeRefinementRegion encodes `bm` as a refinement of `ref` with offset (dx, dy).
+func encodeRefinementRegion(e *mq.Encoder, cx []byte, bm, ref *Bitmap, template int, tpgron bool, at []point, dx, dy int) {
+	// predicted returns the value of pixel (x, y) predicted by the reference, if any.
+	predicted := func(x, y int) (byte, bool) {
+		v := ref.GetPixel(x-dx, y-dy)
+		for j := -1; j <= 1; j++ {
+			for i := -1; i <= 1; i++ {
+				if ref.GetPixel(x-dx+i, y-dy+j) != v {
+					return 0, false
+				}
+			}
+		}
+		return v, true
+	}
+
+	ltp := 0
+	for y := 0; y < bm.Height; y++ {
+		if tpgron {
+			typical := 1
+			for x := 0; x < bm.Width; x++ {
+				if v, ok := predicted(x, y); ok && v != bm.GetPixel(x, y) {
+					typical = 0
+					break
+				}
+			}
+			e.EncodeBit(cx, testRefinementSLTPContexts[template], typical^ltp)
+			ltp = typical
+		}
+		for x := 0; x < bm.Width; x++ {
+			if ltp == 1 {
+				if _, ok := predicted(x, y); ok {
+					continue
+				}
+			}
+			e.EncodeBit(cx, refinementContext(bm, ref, template, at, x, y, dx, dy), int(bm.GetPixel(x, y)))
+		}
+	}
+}
+
+// encodeInt encodes `v` with the integer arithmetic encoding procedure (Annex A.2).
+// The out-of-band value is encoded when `oob` is true.
+func encodeInt(e *mq.Encoder, cx []byte, v int, oob bool) {
+	prev := 1
+	writeBits := func(v, n int) {
+		for i := n - 1; i >= 0; i-- {
+			bit := v >> uint(i) & 1
+			e.EncodeBit(cx, prev, bit)
+			if prev < 256 {
+				prev = prev<<1 | bit
+			} else {
+				prev = ((prev<<1 | bit) & 511) | 256
+			}
+		}
+	}
+
+	if oob {
+		writeBits(1, 1)
+		writeBits(0, 3)
+		return
+	}
+	sign := 0
+	if v < 0 {
+		sign = 1
+		v = -v
+	}
+	ranges := []struct{ prefix, prefixLen, bits, low int }{
+		{0, 1, 2, 0},
+		{2, 2, 4, 4},
+		{6, 3, 6, 20},
+		{14, 4, 8, 84},
+		{30, 5, 12, 340},
+		{31, 5, 32, 4436},
+	}
+	for _, r := range ranges {
+		if v < r.low+1<<uint(r.bits) || r.bits == 32 {
+			writeBits(sign, 1)
+			writeBits(r.prefix, r.prefixLen)
+			writeBits(v-r.low, r.bits)
+			return
+		}
+	}
+}
+
+// encodeIAID encodes the symbol ID `id` (Annex A.3).
+func encodeIAID(e *mq.Encoder, cx []byte, id, codeLen int) {
+	prev := 1
+	for i := codeLen - 1; i >= 0; i-- {
+		bit := id >> uint(i) & 1
+		e.EncodeBit(cx, prev, bit)
+		prev = prev<<1 | bit
+	}
+}
+
+// testInstance is a symbol instance of a text region with its top left corner at (x, y).
+// A non-nil `refined` bitmap is coded as a refinement of the symbol with offset (rdx, rdy).
+type testInstance struct {
+	id       int
+	x, y     int
+	refined  *Bitmap
+	rdx, rdy int
+}
+
+// testTextRegion holds the parameters of an arithmetic coded text region with the top left
+// reference corner and no transposition.
+type testTextRegion struct {
+	symbols    []*Bitmap
+	symCodeLen int
+	logStrips  int
+	dsOffset   int
+	refine     bool
+	rTemplate  int
+	rat        []point
+}
+
+// encodeTextRegion encodes the symbol instances `instances`, which must be sorted by strip
+// and then by x, with the contexts of `a` (section 6.4).
+func encodeTextRegion(e *mq.Encoder, a *arithState, p *testTextRegion, instances []testInstance) {
+	strips := 1 << uint(p.logStrips)
+	encodeInt(e, a.iadt, 0, false)
+	stripT, firstS := 0, 0
+	for i := 0; i < len(instances); {
+		strip := instances[i].y &^ (strips - 1)
+		encodeInt(e, a.iadt, (strip-stripT)/strips, false)
+		stripT = strip
+
+		curS := 0
+		first := true
+		for ; i < len(instances) && instances[i].y&^(strips-1) == strip; i++ {
+			inst := instances[i]
+			if first {
+				encodeInt(e, a.iafs, inst.x-firstS, false)
+				firstS = inst.x
+				first = false
+			} else {
+				encodeInt(e, a.iads, inst.x-curS-p.dsOffset, false)
+			}
+			if strips > 1 {
+				encodeInt(e, a.iait, inst.y-strip, false)
+			}
+			encodeIAID(e, a.iaid, inst.id, p.symCodeLen)
+
+			bm := p.symbols[inst.id]
+			if p.refine {
+				ri := 0
+				if inst.refined != nil {
+					ri = 1
+				}
+				encodeInt(e, a.iari, ri, false)
+			}
+			if inst.refined != nil {
+				rdw, rdh := inst.refined.Width-bm.Width, inst.refined.Height-bm.Height
+				encodeInt(e, a.iardw, rdw, false)
+				encodeInt(e, a.iardh, rdh, false)
+				encodeInt(e, a.iardx, inst.rdx, false)
+				encodeInt(e, a.iardy, inst.rdy, false)
+				encodeRefinementRegion(e, a.gr, inst.refined, bm, p.rTemplate, false, p.rat,
+					rdw>>1+inst.rdx, rdh>>1+inst.rdy)
+				bm = inst.refined
+			}
+			curS = inst.x + bm.Width - 1
+		}
+		encodeInt(e, a.iads, 0, true)
+	}
+}
+
+// testSymbol is a symbol of a symbol dictionary. In a refinement/aggregate coded dictionary,
+// a symbol with several `parts` is coded as their aggregation, otherwise as a refinement of
+// the symbol `ref` with offset (rdx, rdy).
+type testSymbol struct {
+	bm       *Bitmap
+	parts    []testInstance
+	ref      int
+	rdx, rdy int
+}
+
+// testSymbolDictionary holds the parameters of an arithmetic coded symbol dictionary.
+type testSymbolDictionary struct {
+	template  int
+	at        []point
+	refAgg    bool
+	rTemplate int
+	rat       []point
+	inputs    []*Bitmap
+	exports   []int
+}
+
+// encodeSymbolDictionary encodes the symbols `symbols`, ordered by height class, and the
+// export flag runs of the dictionary (section 6.5).
+func encodeSymbolDictionary(p *testSymbolDictionary, symbols []testSymbol) []byte {
+	all := append([]*Bitmap(nil), p.inputs...)
+	for _, s := range symbols {
+		all = append(all, s.bm)
+	}
+	symCodeLen := 0
+	for (1 << uint(symCodeLen)) < len(all) {
+		symCodeLen++
+	}
+
+	e := mq.NewEncoder()
+	a := newArithState(nil, p.template, symCodeLen)
+	height := 0
+	for i := 0; i < len(symbols); {
+		encodeInt(e, a.iadh, symbols[i].bm.Height-height, false)
+		height = symbols[i].bm.Height
+		width := 0
+		for ; i < len(symbols) && symbols[i].bm.Height == height; i++ {
+			s := symbols[i]
+			encodeInt(e, a.iadw, s.bm.Width-width, false)
+			width = s.bm.Width
+			switch {
+			case !p.refAgg:
+				encodeGenericRegion(e, a.gb, s.bm, p.template, false, nil, p.at)
+			case len(s.parts) > 1:
+				encodeInt(e, a.iaai, len(s.parts), false)
+				encodeTextRegion(e, a, &testTextRegion{
+					symbols:    all,
+					symCodeLen: symCodeLen,
+					refine:     true,
+					rTemplate:  p.rTemplate,
+					rat:        p.rat,
+				}, s.parts)
+			default:
+				encodeInt(e, a.iaai, 1, false)
+				encodeIAID(e, a.iaid, s.ref, symCodeLen)
+				encodeInt(e, a.iardx, s.rdx, false)
+				encodeInt(e, a.iardy, s.rdy, false)
+				encodeRefinementRegion(e, a.gr, s.bm, all[s.ref], p.rTemplate, false, p.rat, s.rdx, s.rdy)
+			}
+		}
+		encodeInt(e, a.iadw, 0, true)
+	}
+	for _, run := range p.exports {
+		encodeInt(e, a.iaex, run, false)
+	}
+	return e.Flush()
+}
@@ -0,0 +1,100 @@
+package jbig2
+
+import (
+	"errors"
+
+	"github.com/finalversus/doc/pdf/internal/mq"
+)
+
+// point is a pixel offset used by the context templates and adaptive template (AT) pixels.
+type point struct {
+	x, y int
+}
+
+// genericTemplates lists the pixels forming the context of each generic region template
+// (section 6.2.5.3) from the most significant bit of the context to the least significant one.
+// The adaptive template pixels are listed at their nominal positions.
+var genericTemplates = [4][]point{
+	{{-2, -2}, {-1, -2}, {0, -2}, {1, -2}, {2, -2}, {-3, -1}, {-2, -1}, {-1, -1}, {0, -1}, {1, -1}, {2, -1}, {3, -1}, {-4, 0}, {-3, 0}, {-2, 0}, {-1, 0}},
+	{{-1, -2}, {0, -2}, {1, -2}, {2, -2}, {-2, -1}, {-1, -1}, {0, -1}, {1, -1}, {2, -1}, {3, -1}, {-3, 0}, {-2, 0}, {-1, 0}},
+	{{-1, -2}, {0, -2}, {1, -2}, {-2, -1}, {-1, -1}, {0, -1}, {1, -1}, {2, -1}, {-2, 0}, {-1, 0}},
+	{{-3, -1}, {-2, -1}, {-1, -1}, {0, -1}, {1, -1}, {2, -1}, {-4, 0}, {-3, 0}, {-2, 0}, {-1, 0}},
+}
+
+// genericATSlots gives for each template the positions in genericTemplates that are taken
+// by the adaptive template pixels A1, A2, A3 and A4.
+var genericATSlots = [4][]int{
+	{11, 5, 4, 0},
+	{9},
+	{7},
+	{5},
+}
+
+// typicalPredictionContexts are the contexts used to decode the SLTP bit for each template
+// (section 6.2.5.7).
+var typicalPredictionContexts = [4]int{0x9B25, 0x0795, 0x00E5, 0x0195}
+
+// genericRegionParams are the parameters of the generic region decoding procedure (Table 2).
+type genericRegionParams struct {
+	mmr      bool
+	width    int
+	height   int
+	template int
+	tpgdon   bool
+	skip     *Bitmap
+	at       []point
+}
+
+// decodeGenericRegion decodes a generic region bitmap with the arithmetic decoder `d` using
+// the generic region contexts `cx` (section 6.2.5).
+func decodeGenericRegion(d *mq.Decoder, cx []byte, p *genericRegionParams) (*Bitmap, error) {
+	if p.template < 0 || p.template > 3 {
+		return nil, errors.New("jbig2: invalid generic region template")
+	}
+	bm, err := NewBitmap(p.width, p.height)
+	if err != nil {
+		return nil, err
+	}
+
+	template := make([]point, len(genericTemplates[p.template]))
+	copy(template, genericTemplates[p.template])
+	for i, slot := range genericATSlots[p.template] {
+		if i < len(p.at) {
+			template[slot] = p.at[i]
+		}
+	}
+
+	ltp := 0
+	sltpContext := typicalPredictionContexts[p.template]
+	for y := 0; y < p.height; y++ {
+		if p.tpgdon {
+			ltp ^= d.DecodeBit(cx, sltpContext)
+			if ltp == 1 {
+				if y > 0 {
+					copy(bm.row(y), bm.row(y-1))
+				}
+				continue
+			}
+		}
+		row := bm.row(y)
+		for x := 0; x < p.width; x++ {
+			if p.skip != nil && p.skip.GetPixel(x, y) == 1 {
+				continue
+			}
+			context := 0
+			for _, t := range template {
+				context = context<<1 | int(bm.GetPixel(x+t.x, y+t.y))
+			}
+			row[x] = byte(d.DecodeBit(cx, context))
+		}
+	}
+	return bm, nil
+}
+
+// newGenericContexts returns the contexts for generic region decoding with the specified template.
+func newGenericContexts(template int) []byte {
+	if template < 0 || template > 3 {
+		template = 0
+	}
+	return make([]byte, 1<<uint(len(genericTemplates[template])))
+}
@@ -0,0 +1,199 @@
+package jbig2
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/finalversus/doc/pdf/internal/mq"
+)
+
+// decodePatternDictionary decodes the patterns of a pattern dictionary segment (section 6.7).
+func decodePatternDictionary(data []byte) ([]*Bitmap, error) {
+	r := newReader(data)
+	flags, err := r.readByte()
+	if err != nil {
+		return nil, err
+	}
+	mmr := flags&1 != 0
+	template := int(flags>>1) & 3
+	width, err := r.readByte()
+	if err != nil {
+		return nil, err
+	}
+	height, err := r.readByte()
+	if err != nil {
+		return nil, err
+	}
+	grayMax, err := r.readUint32()
+	if err != nil {
+		return nil, err
+	}
+	if width == 0 || height == 0 {
+		return nil, errors.New("jbig2: invalid pattern size")
+	}
+	numPatterns := int64(grayMax) + 1
+	if numPatterns*int64(width)*int64(height) > maxBitmapPixels {
+		return nil, errBitmapTooLarge
+	}
+	totWidth := int(numPatterns) * int(width)
+
+	var collective *Bitmap
+	if mmr {
+		collective, _, err = decodeMMR(r.rest(), totWidth, int(height))
+	} else {
+		at := []point{{-int(width), 0}}
+		if template == 0 {
+			at = append(at, point{-3, -1}, point{2, -2}, point{-2, -2})
+		}
+		collective, err = decodeGenericRegion(mq.NewDecoder(r.rest()), newGenericContexts(template), &genericRegionParams{
+			width:    totWidth,
+			height:   int(height),
+			template: template,
+			at:       at,
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	patterns := make([]*Bitmap, numPatterns)
+	for i := range patterns {
+		patterns[i], err = collective.subBitmap(i*int(width), 0, int(width), int(height))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return patterns, nil
+}
+
+// halftoneRegionParams are the parameters of the halftone region decoding procedure (Table 22).
+type halftoneRegionParams struct {
+	width      int
+	height     int
+	mmr        bool
+	template   int
+	enableSkip bool
+	combOp     combinationOperator
+	defPixel   byte
+	gridWidth  int
+	gridHeight int
+	gridX      int
+	gridY      int
+	vectorX    int
+	vectorY    int
+	patterns   []*Bitmap
+}
+
+// decodeHalftoneRegion decodes a halftone region from the gray-scale image coded in `data` (section 6.6.5).
+func decodeHalftoneRegion(data []byte, p *halftoneRegionParams) (*Bitmap, error) {
+	bm, err := NewBitmap(p.width, p.height)
+	if err != nil {
+		return nil, err
+	}
+	if p.defPixel != 0 {
+		bm.fill(1)
+	}
+	if len(p.patterns) == 0 {
+		return nil, errors.New("jbig2: halftone region without patterns")
+	}
+	if p.gridWidth < 0 || p.gridHeight < 0 || int64(p.gridWidth)*int64(p.gridHeight) > maxBitmapPixels {
+		return nil, errBitmapTooLarge
+	}
+	patWidth, patHeight := p.patterns[0].Width, p.patterns[0].Height
+
+	cellPosition := func(mg, ng int) (int, int) {
+		x := (p.gridX + mg*p.vectorY + ng*p.vectorX) >> 8
+		y := (p.gridY + mg*p.vectorX - ng*p.vectorY) >> 8
+		return x, y
+	}
+
+	var skip *Bitmap
+	if p.enableSkip {
+		skip, err = NewBitmap(p.gridWidth, p.gridHeight)
+		if err != nil {
+			return nil, err
+		}
+		for mg := 0; mg < p.gridHeight; mg++ {
+			for ng := 0; ng < p.gridWidth; ng++ {
+				x, y := cellPosition(mg, ng)
+				if x+patWidth <= 0 || x >= p.width || y+patHeight <= 0 || y >= p.height {
+					skip.SetPixel(ng, mg, 1)
+				}
+			}
+		}
+	}
+
+	bpp := 0
+	for (1 << uint(bpp)) < len(p.patterns) {
+		bpp++
+	}
+	planes, err := decodeGrayScalePlanes(data, p, bpp, skip)
+	if err != nil {
+		return nil, err
+	}
+
+	for mg := 0; mg < p.gridHeight; mg++ {
+		for ng := 0; ng < p.gridWidth; ng++ {
+			gray := 0
+			for j, plane := range planes {
+				gray |= int(plane.GetPixel(ng, mg)) << uint(j)
+			}
+			if gray >= len(p.patterns) {
+				gray = len(p.patterns) - 1
+			}
+			x, y := cellPosition(mg, ng)
+			bm.compose(p.patterns[gray], x, y, p.combOp)
+		}
+	}
+	return bm, nil
+}
+
+// decodeGrayScalePlanes decodes the bit planes of a gray-scale image and converts them from
+// Gray code (section C.5). The returned planes are ordered from the least significant bit.
+func decodeGrayScalePlanes(data []byte, p *halftoneRegionParams, bpp int, skip *Bitmap) ([]*Bitmap, error) {
+	planes := make([]*Bitmap, bpp)
+	if p.mmr {
+		pos := 0
+		for j := bpp - 1; j >= 0; j-- {
+			if pos > len(data) {
+				return nil, errUnexpectedEOF
+			}
+			plane, n, err := decodeMMR(data[pos:], p.gridWidth, p.gridHeight)
+			if err != nil {
+				return nil, fmt.Errorf("jbig2: gray-scale plane %d: %v", j, err)
+			}
+			planes[j] = plane
+			pos += n
+		}
+	} else {
+		at := []point{{3, -1}}
+		if p.template >= 2 {
+			at[0].x = 2
+		}
+		if p.template == 0 {
+			at = append(at, point{-3, -1}, point{2, -2}, point{-2, -2})
+		}
+		d := mq.NewDecoder(data)
+		cx := newGenericContexts(p.template)
+		for j := bpp - 1; j >= 0; j-- {
+			plane, err := decodeGenericRegion(d, cx, &genericRegionParams{
+				width:    p.gridWidth,
+				height:   p.gridHeight,
+				template: p.template,
+				skip:     skip,
+				at:       at,
+			})
+			if err != nil {
+				return nil, err
+			}
+			planes[j] = plane
+		}
+	}
+
+	for j := bpp - 2; j >= 0; j-- {
+		for i, v := range planes[j+1].Data {
+			planes[j].Data[i] ^= v
+		}
+	}
+	return planes, nil
+}
@@ -0,0 +1,461 @@
+package jbig2
+
+import (
+	"errors"
+	"fmt"
+)
+
+// errHuffmanCode is returned when a bit sequence does not match any code of a Huffman table.
+var errHuffmanCode = errors.New("jbig2: invalid Huffman code")
+
+// lineKind distinguishes the special lines of a Huffman table.
+type lineKind int
+
+const (
+	lineNormal lineKind = iota
+	lineLower
+	lineUpper
+	lineOOB
+)
+
+// huffmanLine is a single line of a Huffman table (section B.2).
+type huffmanLine struct {
+	prefLen  int
+	rangeLen int
+	rangeLow int
+	kind     lineKind
+	code     uint32
+}
+
+// huffmanTable is a decoding table built from a list of table lines with prefix codes
+// assigned by the procedure of section B.3.
+type huffmanTable struct {
+	lines  []huffmanLine
+	maxLen int
+	codes  map[uint64]*huffmanLine
+}
+
+// newHuffmanTable assigns the prefix codes of `lines` and builds the decoding table.
+func newHuffmanTable(lines []huffmanLine) *huffmanTable {
+	t := &huffmanTable{lines: lines, codes: map[uint64]*huffmanLine{}}
+	for _, l := range lines {
+		if l.prefLen > t.maxLen {
+			t.maxLen = l.prefLen
+		}
+	}
+
+	lenCount := make([]int, t.maxLen+1)
+	for _, l := range lines {
+		lenCount[l.prefLen]++
+	}
+	lenCount[0] = 0
+
+	firstCode := make([]uint32, t.maxLen+2)
+	for curLen := 1; curLen <= t.maxLen; curLen++ {
+		firstCode[curLen] = (firstCode[curLen-1] + uint32(lenCount[curLen-1])) << 1
+		curCode := firstCode[curLen]
+		for i := range t.lines {
+			l := &t.lines[i]
+			if l.prefLen != curLen {
+				continue
+			}
+			l.code = curCode
+			curCode++
+			t.codes[uint64(curLen)<<32|uint64(l.code)] = l
+		}
+	}
+	return t
+}
+
+// decode reads a value from `r`. The second return value is false for the out-of-band value.
+func (t *huffmanTable) decode(r *reader) (int, bool, error) {
+	var code uint32
+	for n := 1; n <= t.maxLen; n++ {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, false, err
+		}
+		code = code<<1 | uint32(bit)
+		l, ok := t.codes[uint64(n)<<32|uint64(code)]
+		if !ok {
+			continue
+		}
+		switch l.kind {
+		case lineOOB:
+			return 0, false, nil
+		case lineLower:
+			v, err := r.readBits(32)
+			if err != nil {
+				return 0, false, err
+			}
+			return l.rangeLow - int(v), true, nil
+		case lineUpper:
+			v, err := r.readBits(32)
+			if err != nil {
+				return 0, false, err
+			}
+			return l.rangeLow + int(v), true, nil
+		default:
+			v, err := r.readBits(l.rangeLen)
+			if err != nil {
+				return 0, false, err
+			}
+			return l.rangeLow + int(v), true, nil
+		}
+	}
+	return 0, false, errHuffmanCode
+}
+
+// decodeValue reads a value that is not allowed to be out-of-band.
+func (t *huffmanTable) decodeValue(r *reader) (int, error) {
+	v, ok, err := t.decode(r)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, errors.New("jbig2: unexpected out-of-band Huffman value")
+	}
+	return v, nil
+}
+
+// standardTableLines holds the lines of the standard Huffman tables B.1 to B.15 given as
+// {PREFLEN, RANGELEN, RANGELOW, kind}.
+var standardTableLines = [][]huffmanLine{
+	// B.1
+	{
+		{prefLen: 1, rangeLen: 4, rangeLow: 0},
+		{prefLen: 2, rangeLen: 8, rangeLow: 16},
+		{prefLen: 3, rangeLen: 16, rangeLow: 272},
+		{prefLen: 3, rangeLen: 32, rangeLow: 65808, kind: lineUpper},
+	},
+	// B.2
+	{
+		{prefLen: 1, rangeLen: 0, rangeLow: 0},
+		{prefLen: 2, rangeLen: 0, rangeLow: 1},
+		{prefLen: 3, rangeLen: 0, rangeLow: 2},
+		{prefLen: 4, rangeLen: 3, rangeLow: 3},
+		{prefLen: 5, rangeLen: 6, rangeLow: 11},
+		{prefLen: 6, rangeLen: 32, rangeLow: 75, kind: lineUpper},
+		{prefLen: 6, kind: lineOOB},
+	},
+	// B.3
+	{
+		{prefLen: 8, rangeLen: 8, rangeLow: -256},
+		{prefLen: 1, rangeLen: 0, rangeLow: 0},
+		{prefLen: 2, rangeLen: 0, rangeLow: 1},
+		{prefLen: 3, rangeLen: 0, rangeLow: 2},
+		{prefLen: 4, rangeLen: 3, rangeLow: 3},
+		{prefLen: 5, rangeLen: 6, rangeLow: 11},
+		{prefLen: 8, rangeLen: 32, rangeLow: -257, kind: lineLower},
+		{prefLen: 7, rangeLen: 32, rangeLow: 75, kind: lineUpper},
+		{prefLen: 6, kind: lineOOB},
+	},
+	// B.4
+	{
+		{prefLen: 1, rangeLen: 0, rangeLow: 1},
+		{prefLen: 2, rangeLen: 0, rangeLow: 2},
+		{prefLen: 3, rangeLen: 0, rangeLow: 3},
+		{prefLen: 4, rangeLen: 3, rangeLow: 4},
+		{prefLen: 5, rangeLen: 6, rangeLow: 12},
+		{prefLen: 5, rangeLen: 32, rangeLow: 76, kind: lineUpper},
+	},
+	// B.5
+	{
+		{prefLen: 7, rangeLen: 8, rangeLow: -255},
+		{prefLen: 1, rangeLen: 0, rangeLow: 1},
+		{prefLen: 2, rangeLen: 0, rangeLow: 2},
+		{prefLen: 3, rangeLen: 0, rangeLow: 3},
+		{prefLen: 4, rangeLen: 3, rangeLow: 4},
+		{prefLen: 5, rangeLen: 6, rangeLow: 12},
+		{prefLen: 7, rangeLen: 32, rangeLow: -256, kind: lineLower},
+		{prefLen: 6, rangeLen: 32, rangeLow: 76, kind: lineUpper},
+	},
+	// B.6
+	{
+		{prefLen: 5, rangeLen: 10, rangeLow: -2048},
+		{prefLen: 4, rangeLen: 9, rangeLow: -1024},
+		{prefLen: 4, rangeLen: 8, rangeLow: -512},
+		{prefLen: 4, rangeLen: 7, rangeLow: -256},
+		{prefLen: 5, rangeLen: 6, rangeLow: -128},
+		{prefLen: 5, rangeLen: 5, rangeLow: -64},
+		{prefLen: 4, rangeLen: 5, rangeLow: -32},
+		{prefLen: 2, rangeLen: 7, rangeLow: 0},
+		{prefLen: 3, rangeLen: 7, rangeLow: 128},
+		{prefLen: 3, rangeLen: 8, rangeLow: 256},
+		{prefLen: 4, rangeLen: 9, rangeLow: 512},
+		{prefLen: 4, rangeLen: 10, rangeLow: 1024},
+		{prefLen: 6, rangeLen: 32, rangeLow: -2049, kind: lineLower},
+		{prefLen: 6, rangeLen: 32, rangeLow: 2048, kind: lineUpper},
+	},
+	// B.7
+	{
+		{prefLen: 4, rangeLen: 9, rangeLow: -1024},
+		{prefLen: 3, rangeLen: 8, rangeLow: -512},
+		{prefLen: 4, rangeLen: 7, rangeLow: -256},
+		{prefLen: 5, rangeLen: 6, rangeLow: -128},
+		{prefLen: 5, rangeLen: 5, rangeLow: -64},
+		{prefLen: 4, rangeLen: 5, rangeLow: -32},
+		{prefLen: 4, rangeLen: 5, rangeLow: 0},
+		{prefLen: 5, rangeLen: 5, rangeLow: 32},
+		{prefLen: 5, rangeLen: 6, rangeLow: 64},
+		{prefLen: 4, rangeLen: 7, rangeLow: 128},
+		{prefLen: 3, rangeLen: 8, rangeLow: 256},
+		{prefLen: 3, rangeLen: 9, rangeLow: 512},
+		{prefLen: 4, rangeLen: 10, rangeLow: 1024},
+		{prefLen: 5, rangeLen: 32, rangeLow: -1025, kind: lineLower},
+		{prefLen: 5, rangeLen: 32, rangeLow: 2048, kind: lineUpper},
+	},
+	// B.8
+	{
+		{prefLen: 8, rangeLen: 3, rangeLow: -15},
+		{prefLen: 9, rangeLen: 1, rangeLow: -7},
+		{prefLen: 8, rangeLen: 1, rangeLow: -5},
+		{prefLen: 9, rangeLen: 0, rangeLow: -3},
+		{prefLen: 7, rangeLen: 0, rangeLow: -2},
+		{prefLen: 4, rangeLen: 0, rangeLow: -1},
+		{prefLen: 2, rangeLen: 1, rangeLow: 0},
+		{prefLen: 5, rangeLen: 0, rangeLow: 2},
+		{prefLen: 6, rangeLen: 0, rangeLow: 3},
+		{prefLen: 3, rangeLen: 4, rangeLow: 4},
+		{prefLen: 6, rangeLen: 1, rangeLow: 20},
+		{prefLen: 4, rangeLen: 4, rangeLow: 22},
+		{prefLen: 4, rangeLen: 5, rangeLow: 38},
+		{prefLen: 5, rangeLen: 6, rangeLow: 70},
+		{prefLen: 5, rangeLen: 7, rangeLow: 134},
+		{prefLen: 6, rangeLen: 7, rangeLow: 262},
+		{prefLen: 7, rangeLen: 8, rangeLow: 390},
+		{prefLen: 6, rangeLen: 10, rangeLow: 646},
+		{prefLen: 9, rangeLen: 32, rangeLow: -16, kind: lineLower},
+		{prefLen: 9, rangeLen: 32, rangeLow: 1670, kind: lineUpper},
+		{prefLen: 2, kind: lineOOB},
+	},
+	// B.9
+	{
+		{prefLen: 8, rangeLen: 4, rangeLow: -31},
+		{prefLen: 9, rangeLen: 2, rangeLow: -15},
+		{prefLen: 8, rangeLen: 2, rangeLow: -11},
+		{prefLen: 9, rangeLen: 1, rangeLow: -7},
+		{prefLen: 7, rangeLen: 1, rangeLow: -5},
+		{prefLen: 4, rangeLen: 1, rangeLow: -3},
+		{prefLen: 3, rangeLen: 1, rangeLow: -1},
+		{prefLen: 3, rangeLen: 1, rangeLow: 1},
+		{prefLen: 5, rangeLen: 1, rangeLow: 3},
+		{prefLen: 6, rangeLen: 1, rangeLow: 5},
+		{prefLen: 3, rangeLen: 5, rangeLow: 7},
+		{prefLen: 6, rangeLen: 2, rangeLow: 39},
+		{prefLen: 4, rangeLen: 5, rangeLow: 43},
+		{prefLen: 4, rangeLen: 6, rangeLow: 75},
+		{prefLen: 5, rangeLen: 7, rangeLow: 139},
+		{prefLen: 5, rangeLen: 8, rangeLow: 267},
+		{prefLen: 6, rangeLen: 8, rangeLow: 523},
+		{prefLen: 7, rangeLen: 9, rangeLow: 779},
+		{prefLen: 6, rangeLen: 11, rangeLow: 1291},
+		{prefLen: 9, rangeLen: 32, rangeLow: -32, kind: lineLower},
+		{prefLen: 9, rangeLen: 32, rangeLow: 3339, kind: lineUpper},
+		{prefLen: 2, kind: lineOOB},
+	},
+	// B.10
+	{
+		{prefLen: 7, rangeLen: 4, rangeLow: -21},
+		{prefLen: 8, rangeLen: 0, rangeLow: -5},
+		{prefLen: 7, rangeLen: 0, rangeLow: -4},
+		{prefLen: 5, rangeLen: 0, rangeLow: -3},
+		{prefLen: 2, rangeLen: 2, rangeLow: -2},
+		{prefLen: 5, rangeLen: 0, rangeLow: 2},
+		{prefLen: 6, rangeLen: 0, rangeLow: 3},
+		{prefLen: 7, rangeLen: 0, rangeLow: 4},
+		{prefLen: 8, rangeLen: 0, rangeLow: 5},
+		{prefLen: 2, rangeLen: 6, rangeLow: 6},
+		{prefLen: 5, rangeLen: 5, rangeLow: 70},
+		{prefLen: 6, rangeLen: 5, rangeLow: 102},
+		{prefLen: 6, rangeLen: 6, rangeLow: 134},
+		{prefLen: 6, rangeLen: 7, rangeLow: 198},
+		{prefLen: 6, rangeLen: 8, rangeLow: 326},
+		{prefLen: 6, rangeLen: 9, rangeLow: 582},
+		{prefLen: 6, rangeLen: 10, rangeLow: 1094},
+		{prefLen: 7, rangeLen: 11, rangeLow: 2118},
+		{prefLen: 8, rangeLen: 32, rangeLow: -22, kind: lineLower},
+		{prefLen: 8, rangeLen: 32, rangeLow: 4166, kind: lineUpper},
+		{prefLen: 2, kind: lineOOB},
+	},
+	// B.11
+	{
+		{prefLen: 1, rangeLen: 0, rangeLow: 1},
+		{prefLen: 2, rangeLen: 1, rangeLow: 2},
+		{prefLen: 4, rangeLen: 0, rangeLow: 4},
+		{prefLen: 4, rangeLen: 1, rangeLow: 5},
+		{prefLen: 5, rangeLen: 1, rangeLow: 7},
+		{prefLen: 5, rangeLen: 2, rangeLow: 9},
+		{prefLen: 6, rangeLen: 2, rangeLow: 13},
+		{prefLen: 7, rangeLen: 2, rangeLow: 17},
+		{prefLen: 7, rangeLen: 3, rangeLow: 21},
+		{prefLen: 7, rangeLen: 4, rangeLow: 29},
+		{prefLen: 7, rangeLen: 5, rangeLow: 45},
+		{prefLen: 7, rangeLen: 6, rangeLow: 77},
+		{prefLen: 7, rangeLen: 32, rangeLow: 141, kind: lineUpper},
+	},
+	// B.12
+	{
+		{prefLen: 1, rangeLen: 0, rangeLow: 1},
+		{prefLen: 2, rangeLen: 0, rangeLow: 2},
+		{prefLen: 3, rangeLen: 1, rangeLow: 3},
+		{prefLen: 5, rangeLen: 0, rangeLow: 5},
+		{prefLen: 5, rangeLen: 1, rangeLow: 6},
+		{prefLen: 6, rangeLen: 1, rangeLow: 8},
+		{prefLen: 7, rangeLen: 0, rangeLow: 10},
+		{prefLen: 7, rangeLen: 1, rangeLow: 11},
+		{prefLen: 7, rangeLen: 2, rangeLow: 13},
+		{prefLen: 7, rangeLen: 3, rangeLow: 17},
+		{prefLen: 7, rangeLen: 4, rangeLow: 25},
+		{prefLen: 8, rangeLen: 5, rangeLow: 41},
+		{prefLen: 8, rangeLen: 32, rangeLow: 73, kind: lineUpper},
+	},
+	// B.13
+	{
+		{prefLen: 1, rangeLen: 0, rangeLow: 1},
+		{prefLen: 3, rangeLen: 0, rangeLow: 2},
+		{prefLen: 4, rangeLen: 0, rangeLow: 3},
+		{prefLen: 5, rangeLen: 0, rangeLow: 4},
+		{prefLen: 4, rangeLen: 1, rangeLow: 5},
+		{prefLen: 3, rangeLen: 3, rangeLow: 7},
+		{prefLen: 6, rangeLen: 1, rangeLow: 15},
+		{prefLen: 6, rangeLen: 2, rangeLow: 17},
+		{prefLen: 6, rangeLen: 3, rangeLow: 21},
+		{prefLen: 6, rangeLen: 4, rangeLow: 29},
+		{prefLen: 6, rangeLen: 5, rangeLow: 45},
+		{prefLen: 7, rangeLen: 6, rangeLow: 77},
+		{prefLen: 7, rangeLen: 32, rangeLow: 141, kind: lineUpper},
+	},
+	// B.14
+	{
+		{prefLen: 3, rangeLen: 0, rangeLow: -2},
+		{prefLen: 3, rangeLen: 0, rangeLow: -1},
+		{prefLen: 1, rangeLen: 0, rangeLow: 0},
+		{prefLen: 3, rangeLen: 0, rangeLow: 1},
+		{prefLen: 3, rangeLen: 0, rangeLow: 2},
+	},
+	// B.15
+	{
+		{prefLen: 7, rangeLen: 4, rangeLow: -24},
+		{prefLen: 6, rangeLen: 2, rangeLow: -8},
+		{prefLen: 5, rangeLen: 1, rangeLow: -4},
+		{prefLen: 4, rangeLen: 0, rangeLow: -2},
+		{prefLen: 3, rangeLen: 0, rangeLow: -1},
+		{prefLen: 1, rangeLen: 0, rangeLow: 0},
+		{prefLen: 3, rangeLen: 0, rangeLow: 1},
+		{prefLen: 4, rangeLen: 0, rangeLow: 2},
+		{prefLen: 5, rangeLen: 1, rangeLow: 3},
+		{prefLen: 6, rangeLen: 2, rangeLow: 5},
+		{prefLen: 7, rangeLen: 4, rangeLow: 9},
+		{prefLen: 7, rangeLen: 32, rangeLow: -25, kind: lineLower},
+		{prefLen: 7, rangeLen: 32, rangeLow: 25, kind: lineUpper},
+	},
+}
+
+// standardTables caches the standard Huffman tables once built.
+var standardTables [15]*huffmanTable
+
+// standardTable returns the standard Huffman table B.n (1-based).
+func standardTable(n int) *huffmanTable {
+	if standardTables[n-1] == nil {
+		lines := make([]huffmanLine, len(standardTableLines[n-1]))
+		copy(lines, standardTableLines[n-1])
+		standardTables[n-1] = newHuffmanTable(lines)
+	}
+	return standardTables[n-1]
+}
+
+func init() {
+	for i := range standardTables {
+		standardTable(i + 1)
+	}
+}
+
+// parseTableSegment parses a code table segment (section 7.4.13) into a user-defined table.
+func parseTableSegment(data []byte) (*huffmanTable, error) {
+	r := newReader(data)
+	flags, err := r.readByte()
+	if err != nil {
+		return nil, err
+	}
+	htoob := flags&1 != 0
+	htps := int((flags>>1)&7) + 1
+	htrs := int((flags>>4)&7) + 1
+
+	low, err := r.readInt32()
+	if err != nil {
+		return nil, err
+	}
+	high, err := r.readInt32()
+	if err != nil {
+		return nil, err
+	}
+	if high < low {
+		return nil, fmt.Errorf("jbig2: invalid code table range [%d, %d]", low, high)
+	}
+
+	var lines []huffmanLine
+	cur := int(low)
+	for cur < int(high) {
+		prefLen, err := r.readBits(htps)
+		if err != nil {
+			return nil, err
+		}
+		rangeLen, err := r.readBits(htrs)
+		if err != nil {
+			return nil, err
+		}
+		if rangeLen > 31 {
+			return nil, errors.New("jbig2: invalid code table range length")
+		}
+		lines = append(lines, huffmanLine{prefLen: int(prefLen), rangeLen: int(rangeLen), rangeLow: cur})
+		cur += 1 << rangeLen
+	}
+
+	prefLen, err := r.readBits(htps)
+	if err != nil {
+		return nil, err
+	}
+	lines = append(lines, huffmanLine{prefLen: int(prefLen), rangeLen: 32, rangeLow: int(low) - 1, kind: lineLower})
+
+	prefLen, err = r.readBits(htps)
+	if err != nil {
+		return nil, err
+	}
+	lines = append(lines, huffmanLine{prefLen: int(prefLen), rangeLen: 32, rangeLow: int(high), kind: lineUpper})
+
+	if htoob {
+		prefLen, err = r.readBits(htps)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, huffmanLine{prefLen: int(prefLen), kind: lineOOB})
+	}
+
+	return newHuffmanTable(lines), nil
+}
+
+// userTables iterates over the user-defined tables referred to by a segment.
+type userTables struct {
+	tables []*huffmanTable
+	next   int
+}
+
+// get returns the next user-defined table.
+func (u *userTables) get() (*huffmanTable, error) {
+	if u.next >= len(u.tables) {
+		return nil, errors.New("jbig2: missing user-defined Huffman table")
+	}
+	t := u.tables[u.next]
+	u.next++
+	return t, nil
+}
+
+// selectTable returns the standard table B.n where n is `standard[sel]`, or the next
+// user-defined table if `sel` does not select a standard table.
+func (u *userTables) selectTable(sel int, standard ...int) (*huffmanTable, error) {
+	if sel < len(standard) {
+		return standardTable(standard[sel]), nil
+	}
+	return u.get()
+}
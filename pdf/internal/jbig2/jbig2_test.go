@@ -0,0 +1,591 @@
+package jbig2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/finalversus/doc/pdf/internal/ccittfax"
+	"github.com/finalversus/doc/pdf/internal/mq"
+)
+
+// TestStandardTables checks that the lines of the standard Huffman tables form valid prefix codes.
+func TestStandardTables(t *testing.T) {
+	for n := 1; n <= len(standardTableLines); n++ {
+		table := standardTable(n)
+		sum := 0.0
+		for _, l := range table.lines {
+			if l.prefLen > 0 {
+				sum += 1 / float64(uint64(1)<<uint(l.prefLen))
+			}
+		}
+		if sum > 1 {
+			t.Errorf("table B.%d: Kraft sum %v exceeds 1", n, sum)
+		}
+	}
+}
+
+// TestHuffmanDecode decodes values coded with standard table B.1.
+func TestHuffmanDecode(t *testing.T) {
+	// 0 0101 | 10 00000011 | 110 0000000000000001 | 111 + 32 bits 0...010
+	w := &bitWriter{}
+	w.write(0, 1)
+	w.write(5, 4)
+	w.write(2, 2)
+	w.write(3, 8)
+	w.write(6, 3)
+	w.write(1, 16)
+	w.write(7, 3)
+	w.write(2, 32)
+
+	r := newReader(w.bytes())
+	table := standardTable(1)
+	for _, expected := range []int{5, 19, 273, 65810} {
+		v, err := table.decodeValue(r)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if v != expected {
+			t.Fatalf("decoded %d, expected %d", v, expected)
+		}
+	}
+}
+
+// TestDecodeMMR checks the MMR decoder with data produced by the CCITT Group 4 encoder.
+func TestDecodeMMR(t *testing.T) {
+	bm := testBitmap(67, 41)
+	encoded := encodeMMR(bm)
+
+	decoded, n, err := decodeMMR(encoded, bm.Width, bm.Height)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if n != len(encoded) {
+		t.Errorf("consumed %d bytes, expected %d", n, len(encoded))
+	}
+	if !bytes.Equal(decoded.Data, bm.Data) {
+		t.Fatalf("decoded bitmap does not match")
+	}
+}
+
+// TestDecodeGenericRegionSegment decodes an embedded stream consisting of a page with a single
+// MMR coded immediate generic region.
+func TestDecodeGenericRegionSegment(t *testing.T) {
+	region := testBitmap(30, 20)
+
+	var pageInfo bytes.Buffer
+	binary.Write(&pageInfo, binary.BigEndian, []uint32{40, 30, 0, 0})
+	pageInfo.Write([]byte{0, 0, 0})
+
+	var generic bytes.Buffer
+	binary.Write(&generic, binary.BigEndian, []uint32{30, 20, 5, 4})
+	generic.WriteByte(byte(combineOR))
+	generic.WriteByte(1) // MMR.
+	generic.Write(encodeMMR(region))
+
+	var data bytes.Buffer
+	writeSegment(&data, 0, segmentPageInformation, pageInfo.Bytes())
+	writeSegment(&data, 1, segmentImmediateLosslessGenericRegion, generic.Bytes())
+	writeSegment(&data, 2, segmentEndOfPage, nil)
+
+	page, err := Decode(data.Bytes(), nil)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if page.Width != 40 || page.Height != 30 {
+		t.Fatalf("page size %dx%d, expected 40x30", page.Width, page.Height)
+	}
+	for y := 0; y < page.Height; y++ {
+		for x := 0; x < page.Width; x++ {
+			expected := region.GetPixel(x-5, y-4)
+			if v := page.GetPixel(x, y); v != expected {
+				t.Fatalf("pixel (%d, %d) = %d, expected %d", x, y, v, expected)
+			}
+		}
+	}
+
+	packed := page.ToBytes(false)
+	if len(packed) != 5*30 {
+		t.Fatalf("packed length %d, expected %d", len(packed), 5*30)
+	}
+	if packed[0] != 0xff {
+		t.Fatalf("expected white first byte, got %02X", packed[0])
+	}
+}
+
+// TestDecodeInt decodes integers, out-of-band values and symbol IDs coded with the integer
+// arithmetic encoding procedures.
+func TestDecodeInt(t *testing.T) {
+	values := []int{0, 1, -1, 3, 4, -19, 20, 83, -84, 339, 340, 4435, -4436, 100000, -2000000000}
+	e := mq.NewEncoder()
+	cx := newIntContexts()
+	idcx := make([]byte, 1<<6)
+	for i, v := range values {
+		encodeInt(e, cx, v, false)
+		encodeIAID(e, idcx, i, 5)
+		if i%4 == 3 {
+			encodeInt(e, cx, 0, true)
+		}
+	}
+
+	d := mq.NewDecoder(e.Flush())
+	cx = newIntContexts()
+	idcx = make([]byte, 1<<6)
+	for i, expected := range values {
+		if v, ok := decodeInt(d, cx); !ok || v != expected {
+			t.Fatalf("decoded %d (%v), expected %d", v, ok, expected)
+		}
+		if id := decodeIAID(d, idcx, 5); id != i {
+			t.Fatalf("decoded symbol ID %d, expected %d", id, i)
+		}
+		if i%4 == 3 {
+			if v, ok := decodeInt(d, cx); ok {
+				t.Fatalf("decoded %d, expected out-of-band value", v)
+			}
+		}
+	}
+}
+
+// TestDecodeArithGenericRegionSegment decodes arithmetic coded immediate generic regions with
+// each template, with and without typical prediction.
+func TestDecodeArithGenericRegionSegment(t *testing.T) {
+	region := testBitmap(37, 23)
+	// Blank and repeated rows are coded with typical prediction.
+	for y := 0; y < region.Height; y++ {
+		switch {
+		case y < 2:
+			copy(region.row(y), make([]byte, region.Width))
+		case y%4 == 3:
+			copy(region.row(y), region.row(y-1))
+		}
+	}
+
+	for _, c := range []struct {
+		name          string
+		template      int
+		tpgdon        bool
+		at            []point
+		unknownLength bool
+	}{
+		{"template 0", 0, false, []point{{3, -1}, {-3, -1}, {2, -2}, {-2, -2}}, false},
+		{"template 0 TPGDON AT", 0, true, []point{{4, -1}, {-5, -1}, {3, -2}, {-1, -3}}, false},
+		{"template 1 TPGDON", 1, true, []point{{3, -1}}, false},
+		{"template 2 TPGDON", 2, true, []point{{2, -1}}, false},
+		{"template 3 unknown length", 3, true, []point{{-2, -2}}, true},
+	} {
+		// The neighbourhood of the SLTP context occurs in the region.
+		region := &Bitmap{Width: region.Width, Height: region.Height, Data: append([]byte(nil), region.Data...)}
+		pixels := genericContextPixels(c.template, c.at)
+		stampContext(region, pixels, 12, 10, testSLTPContexts[c.template])
+		stampContext(region, pixels, 27, 18, testSLTPContexts[c.template])
+
+		e := mq.NewEncoder()
+		encodeGenericRegion(e, make([]byte, 1<<16), region, c.template, c.tpgdon, nil, c.at)
+
+		height, pageHeight := uint32(region.Height), uint32(30)
+		if c.unknownLength {
+			height, pageHeight = 0xffffffff, 0xffffffff
+		}
+		var generic bytes.Buffer
+		writeRegionInfo(&generic, uint32(region.Width), height, 2, 3, combineOR)
+		flags := byte(c.template << 1)
+		if c.tpgdon {
+			flags |= 8
+		}
+		generic.WriteByte(flags)
+		writeAT(&generic, c.at)
+		generic.Write(e.Flush())
+
+		var data bytes.Buffer
+		writeSegment(&data, 0, segmentPageInformation, pageInformation(40, pageHeight))
+		if c.unknownLength {
+			generic.Write([]byte{0xff, 0xac})
+			binary.Write(&generic, binary.BigEndian, uint32(region.Height))
+			writeSegmentHeader(&data, 1, segmentImmediateGenericRegion, nil, unknownLength)
+			data.Write(generic.Bytes())
+		} else {
+			writeSegment(&data, 1, segmentImmediateGenericRegion, generic.Bytes())
+		}
+		writeSegment(&data, 2, segmentEndOfPage, nil)
+
+		page, err := Decode(data.Bytes(), nil)
+		if err != nil {
+			t.Fatalf("%s: Error: %v", c.name, err)
+		}
+		expectedHeight := 30
+		if c.unknownLength {
+			expectedHeight = 3 + region.Height
+		}
+		expected, _ := NewBitmap(40, expectedHeight)
+		drawBitmap(expected, region, 2, 3)
+		checkBitmap(t, c.name, page, expected)
+	}
+}
+
+// TestDecodeRefinementRegionSegment decodes refinement regions of an intermediate region and
+// of the page.
+func TestDecodeRefinementRegionSegment(t *testing.T) {
+	// Isolated pixels in the white bottom rows of the reference and the target give the
+	// neighbourhoods of the SLTP contexts.
+	reference := testBitmap(24, 16)
+	for _, y := range []int{12, 13, 14, 15} {
+		copy(reference.row(y), make([]byte, reference.Width))
+	}
+	reference.SetPixel(4, 14, 1)
+	reference.SetPixel(17, 13, 1)
+	target := refinedBitmap(reference, 24, 16, 0, 0)
+	for _, y := range []int{12, 13, 14, 15} {
+		copy(target.row(y), reference.row(y))
+	}
+
+	for _, c := range []struct {
+		name         string
+		intermediate bool
+		template     int
+		tpgron       bool
+		at           []point
+		combOp       combinationOperator
+	}{
+		{"intermediate reference", true, 0, true, []point{{-1, -2}, {2, 2}}, combineOR},
+		{"page reference", false, 1, true, nil, combineReplace},
+	} {
+		e := mq.NewEncoder()
+		at := []point{{2, -1}}
+		encodeGenericRegion(e, make([]byte, 1<<16), reference, 2, false, nil, at)
+		var generic bytes.Buffer
+		writeRegionInfo(&generic, 24, 16, 5, 6, combineOR)
+		generic.WriteByte(2 << 1)
+		writeAT(&generic, at)
+		generic.Write(e.Flush())
+
+		e = mq.NewEncoder()
+		encodeRefinementRegion(e, make([]byte, 1<<13), target, reference, c.template, c.tpgron, c.at, 0, 0)
+		var refinement bytes.Buffer
+		writeRegionInfo(&refinement, 24, 16, 5, 6, c.combOp)
+		flags := byte(c.template)
+		if c.tpgron {
+			flags |= 2
+		}
+		refinement.WriteByte(flags)
+		writeAT(&refinement, c.at)
+		refinement.Write(e.Flush())
+
+		var data bytes.Buffer
+		writeSegment(&data, 0, segmentPageInformation, pageInformation(40, 30))
+		if c.intermediate {
+			writeSegment(&data, 1, segmentIntermediateGenericRegion, generic.Bytes())
+			writeReferringSegment(&data, 2, segmentImmediateRefinementRegion, []byte{1}, refinement.Bytes())
+		} else {
+			writeSegment(&data, 1, segmentImmediateGenericRegion, generic.Bytes())
+			writeSegment(&data, 2, segmentImmediateRefinementRegion, refinement.Bytes())
+		}
+		writeSegment(&data, 3, segmentEndOfPage, nil)
+
+		page, err := Decode(data.Bytes(), nil)
+		if err != nil {
+			t.Fatalf("%s: Error: %v", c.name, err)
+		}
+		expected, _ := NewBitmap(40, 30)
+		drawBitmap(expected, target, 5, 6)
+		checkBitmap(t, c.name, page, expected)
+	}
+}
+
+// TestDecodeTextRegionSegment decodes a text region using the symbols of a generic coded symbol
+// dictionary and of a refinement/aggregate coded one, with refined symbol instances.
+func TestDecodeTextRegionSegment(t *testing.T) {
+	at := []point{{3, -1}, {-3, -1}, {2, -2}, {-2, -2}}
+	inputs := []*Bitmap{patternBitmap(5, 6, 1), patternBitmap(7, 6, 2), patternBitmap(4, 9, 3)}
+	var dict1 bytes.Buffer
+	binary.Write(&dict1, binary.BigEndian, uint16(0))
+	writeAT(&dict1, at)
+	binary.Write(&dict1, binary.BigEndian, []uint32{3, 3})
+	dict1.Write(encodeSymbolDictionary(&testSymbolDictionary{at: at, exports: []int{0, 3}},
+		[]testSymbol{{bm: inputs[0]}, {bm: inputs[1]}, {bm: inputs[2]}}))
+
+	// The second dictionary defines a refinement of the first input symbol and an aggregation
+	// of the second input symbol with a refinement of the third one.
+	rat := []point{{-1, -1}, {-1, -1}}
+	refined := refinedBitmap(inputs[0], 6, 6, 1, 0)
+	part := refinedBitmap(inputs[2], 4, 9, 0, 0)
+	aggregate, _ := NewBitmap(12, 10)
+	drawBitmap(aggregate, inputs[1], 0, 0)
+	drawBitmap(aggregate, part, 8, 1)
+	var dict2 bytes.Buffer
+	binary.Write(&dict2, binary.BigEndian, uint16(2))
+	writeAT(&dict2, at)
+	writeAT(&dict2, rat)
+	binary.Write(&dict2, binary.BigEndian, []uint32{2, 2})
+	dict2.Write(encodeSymbolDictionary(&testSymbolDictionary{at: at, refAgg: true, rat: rat, inputs: inputs,
+		exports: []int{3, 2}}, []testSymbol{
+		{bm: refined, ref: 0, rdx: 1},
+		{bm: aggregate, parts: []testInstance{{id: 1}, {id: 2, x: 8, y: 1, refined: part}}},
+	}))
+
+	symbols := append(append([]*Bitmap(nil), inputs...), refined, aggregate)
+	instances := []testInstance{
+		{id: 0, x: 2, y: 1},
+		{id: 3, x: 10, y: 0},
+		{id: 1, x: 20, y: 1, refined: refinedBitmap(inputs[1], 9, 7, 2, 1), rdx: 1, rdy: 1},
+		{id: 4, x: 1, y: 14},
+		{id: 2, x: 16, y: 15},
+		{id: 0, x: 30, y: 26},
+		{id: 4, x: 40, y: 27},
+	}
+	e := mq.NewEncoder()
+	encodeTextRegion(e, newArithState(nil, 0, 3), &testTextRegion{symbols: symbols, symCodeLen: 3,
+		logStrips: 1, dsOffset: -1, refine: true, rTemplate: 1}, instances)
+	var text bytes.Buffer
+	writeRegionInfo(&text, 64, 40, 0, 0, combineOR)
+	// Refinement, 2 strips, top left reference corner, SBDSOFFSET -1 and refinement template 1.
+	binary.Write(&text, binary.BigEndian, uint16(2|1<<2|cornerTopLeft<<4|0x1f<<10|1<<15))
+	binary.Write(&text, binary.BigEndian, uint32(len(instances)))
+	text.Write(e.Flush())
+
+	var data bytes.Buffer
+	writeSegment(&data, 0, segmentSymbolDictionary, dict1.Bytes())
+	writeReferringSegment(&data, 1, segmentSymbolDictionary, []byte{0}, dict2.Bytes())
+	writeSegment(&data, 2, segmentPageInformation, pageInformation(64, 40))
+	writeReferringSegment(&data, 3, segmentImmediateTextRegion, []byte{0, 1}, text.Bytes())
+	writeSegment(&data, 4, segmentEndOfPage, nil)
+
+	page, err := Decode(data.Bytes(), nil)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	expected, _ := NewBitmap(64, 40)
+	for _, inst := range instances {
+		bm := symbols[inst.id]
+		if inst.refined != nil {
+			bm = inst.refined
+		}
+		drawBitmap(expected, bm, inst.x, inst.y)
+	}
+	checkBitmap(t, "text region", page, expected)
+}
+
+// TestDecodeHalftoneRegionSegment decodes a halftone region with a grid partly outside the region
+// using the patterns of a pattern dictionary.
+func TestDecodeHalftoneRegionSegment(t *testing.T) {
+	patterns := make([]*Bitmap, 5)
+	collective, _ := NewBitmap(4*len(patterns), 4)
+	for i := range patterns {
+		patterns[i] = patternBitmap(4, 4, i+1)
+		drawBitmap(collective, patterns[i], 4*i, 0)
+	}
+	e := mq.NewEncoder()
+	encodeGenericRegion(e, make([]byte, 1<<16), collective, 0, false, nil,
+		[]point{{-4, 0}, {-3, -1}, {2, -2}, {-2, -2}})
+	var dict bytes.Buffer
+	dict.Write([]byte{0, 4, 4})
+	binary.Write(&dict, binary.BigEndian, uint32(len(patterns)-1))
+	dict.Write(e.Flush())
+
+	// A 7x5 grid of overlapping 4x4 cells at (-4, 0) with a 3.5 pixel spacing in a 16x14
+	// region: the first and last columns and the last row are outside the region.
+	const gridWidth, gridHeight = 7, 5
+	cell := func(mg, ng int) (int, int) { return (-4*256 + ng*896) >> 8, mg * 896 >> 8 }
+	gray := func(mg, ng int) int { return (mg*3 + ng) % len(patterns) }
+	skipped := func(mg, ng int) bool {
+		x, y := cell(mg, ng)
+		return x <= -4 || x >= 16 || y >= 14
+	}
+
+	e = mq.NewEncoder()
+	cx := make([]byte, 1<<16)
+	for j := 2; j >= 0; j-- {
+		plane, _ := NewBitmap(gridWidth, gridHeight)
+		skip, _ := NewBitmap(gridWidth, gridHeight)
+		for mg := 0; mg < gridHeight; mg++ {
+			for ng := 0; ng < gridWidth; ng++ {
+				if skipped(mg, ng) {
+					skip.SetPixel(ng, mg, 1)
+					continue
+				}
+				g := gray(mg, ng)
+				plane.SetPixel(ng, mg, byte((g^g>>1)>>uint(j)&1))
+			}
+		}
+		encodeGenericRegion(e, cx, plane, 1, false, skip, []point{{3, -1}})
+	}
+	var halftone bytes.Buffer
+	writeRegionInfo(&halftone, 16, 14, 2, 1, combineOR)
+	halftone.WriteByte(1<<1 | 8) // Template 1, skipping enabled.
+	binary.Write(&halftone, binary.BigEndian, []uint32{gridWidth, gridHeight, 0xfffffc00, 0})
+	binary.Write(&halftone, binary.BigEndian, []uint16{896, 0})
+	halftone.Write(e.Flush())
+
+	var data bytes.Buffer
+	writeSegment(&data, 0, segmentPatternDictionary, dict.Bytes())
+	writeSegment(&data, 1, segmentPageInformation, pageInformation(20, 16))
+	writeReferringSegment(&data, 2, segmentImmediateHalftoneRegion, []byte{0}, halftone.Bytes())
+	writeSegment(&data, 3, segmentEndOfPage, nil)
+
+	page, err := Decode(data.Bytes(), nil)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	region, _ := NewBitmap(16, 14)
+	for mg := 0; mg < gridHeight; mg++ {
+		for ng := 0; ng < gridWidth; ng++ {
+			if !skipped(mg, ng) {
+				x, y := cell(mg, ng)
+				drawBitmap(region, patterns[gray(mg, ng)], x, y)
+			}
+		}
+	}
+	expected, _ := NewBitmap(20, 16)
+	drawBitmap(expected, region, 2, 1)
+	checkBitmap(t, "halftone region", page, expected)
+}
+
+// testBitmap returns a bitmap with a deterministic pattern of black pixels.
+func testBitmap(width, height int) *Bitmap {
+	bm, _ := NewBitmap(width, height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if (x*x+3*y)%7 < 3 || (x > 10 && x < 20 && y > 5) {
+				bm.SetPixel(x, y, 1)
+			}
+		}
+	}
+	return bm
+}
+
+// encodeMMR encodes `bm` with the CCITT Group 4 encoder.
+func encodeMMR(bm *Bitmap) []byte {
+	rows := make([][]byte, bm.Height)
+	for y := range rows {
+		rows[y] = append([]byte(nil), bm.row(y)...)
+	}
+	enc := &ccittfax.Encoder{K: -1, Columns: bm.Width, BlackIs1: true, EndOfBlock: true}
+	return enc.Encode(rows)
+}
+
+// writeSegment writes a segment header without referred-to segments followed by the segment data.
+func writeSegment(w *bytes.Buffer, number uint32, kind byte, data []byte) {
+	writeReferringSegment(w, number, kind, nil, data)
+}
+
+// writeReferringSegment writes a segment header referring to the segments `referred` followed
+// by the segment data.
+func writeReferringSegment(w *bytes.Buffer, number uint32, kind byte, referred []byte, data []byte) {
+	writeSegmentHeader(w, number, kind, referred, uint32(len(data)))
+	w.Write(data)
+}
+
+// writeSegmentHeader writes the header of a segment of page 1 with data length `length`.
+func writeSegmentHeader(w *bytes.Buffer, number uint32, kind byte, referred []byte, length uint32) {
+	binary.Write(w, binary.BigEndian, number)
+	w.WriteByte(kind)
+	w.WriteByte(byte(len(referred)) << 5)
+	w.Write(referred)
+	w.WriteByte(1)
+	binary.Write(w, binary.BigEndian, length)
+}
+
+// pageInformation returns the data of a page information segment.
+func pageInformation(width, height uint32) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, []uint32{width, height, 0, 0})
+	b.Write([]byte{0, 0, 0})
+	return b.Bytes()
+}
+
+// writeRegionInfo writes a region segment information field.
+func writeRegionInfo(w *bytes.Buffer, width, height, x, y uint32, op combinationOperator) {
+	binary.Write(w, binary.BigEndian, []uint32{width, height, x, y})
+	w.WriteByte(byte(op))
+}
+
+// writeAT writes adaptive template pixel positions.
+func writeAT(w *bytes.Buffer, at []point) {
+	for _, p := range at {
+		w.WriteByte(byte(int8(p.x)))
+		w.WriteByte(byte(int8(p.y)))
+	}
+}
+
+// patternBitmap returns a bitmap with a pattern of black pixels depending on `seed`.
+func patternBitmap(width, height, seed int) *Bitmap {
+	bm, _ := NewBitmap(width, height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if (x*seed+y*y+seed)%3 == 0 || (x+y+seed)%5 == 0 {
+				bm.SetPixel(x, y, 1)
+			}
+		}
+	}
+	return bm
+}
+
+// refinedBitmap returns a bitmap of the specified size derived from `bm` shifted by (dx, dy)
+// with some pixels inverted.
+func refinedBitmap(bm *Bitmap, width, height, dx, dy int) *Bitmap {
+	refined, _ := NewBitmap(width, height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := bm.GetPixel(x-dx, y-dy)
+			if (x*y+x)%7 == 3 {
+				v ^= 1
+			}
+			refined.SetPixel(x, y, v)
+		}
+	}
+	return refined
+}
+
+// stampContext sets the pixels `pixels` around (x, y) to the bits of `context`.
+func stampContext(bm *Bitmap, pixels []point, x, y, context int) {
+	for i, p := range pixels {
+		bm.SetPixel(x+p.x, y+p.y, byte(context>>uint(i)&1))
+	}
+}
+
+// drawBitmap sets the pixels of `dst` that are black in `src` placed at (x, y).
+func drawBitmap(dst, src *Bitmap, x, y int) {
+	for j := 0; j < src.Height; j++ {
+		for i := 0; i < src.Width; i++ {
+			if src.GetPixel(i, j) == 1 {
+				dst.SetPixel(x+i, y+j, 1)
+			}
+		}
+	}
+}
+
+// checkBitmap compares bitmap `bm` decoded in test `name` with `expected`.
+func checkBitmap(t *testing.T, name string, bm, expected *Bitmap) {
+	t.Helper()
+	if bm.Width != expected.Width || bm.Height != expected.Height {
+		t.Fatalf("%s: bitmap size %dx%d, expected %dx%d", name, bm.Width, bm.Height, expected.Width, expected.Height)
+	}
+	for y := 0; y < bm.Height; y++ {
+		for x := 0; x < bm.Width; x++ {
+			if v, e := bm.GetPixel(x, y), expected.GetPixel(x, y); v != e {
+				t.Fatalf("%s: pixel (%d, %d) = %d, expected %d", name, x, y, v, e)
+			}
+		}
+	}
+}
+
+// bitWriter packs bits most significant first.
+type bitWriter struct {
+	data []byte
+	n    uint
+}
+
+func (w *bitWriter) write(v uint32, bits int) {
+	for i := bits - 1; i >= 0; i-- {
+		if w.n%8 == 0 {
+			w.data = append(w.data, 0)
+		}
+		if v>>uint(i)&1 != 0 {
+			w.data[len(w.data)-1] |= 0x80 >> (w.n % 8)
+		}
+		w.n++
+	}
+}
+
+func (w *bitWriter) bytes() []byte {
+	return w.data
+}
@@ -0,0 +1,459 @@
+package jbig2
+
+import "errors"
+
+// errMMRCode is returned when invalid MMR coded data is met.
+var errMMRCode = errors.New("jbig2: invalid MMR code")
+
+// runCode maps a CCITT run-length code to the run length it represents.
+type runCode struct {
+	run  int
+	bits string
+}
+
+// whiteRunCodes are the terminating and make-up codes for white runs (ITU-T T.4 tables 2 and 3).
+var whiteRunCodes = []runCode{
+	{0, "00110101"},
+	{1, "000111"},
+	{2, "0111"},
+	{3, "1000"},
+	{4, "1011"},
+	{5, "1100"},
+	{6, "1110"},
+	{7, "1111"},
+	{8, "10011"},
+	{9, "10100"},
+	{10, "00111"},
+	{11, "01000"},
+	{12, "001000"},
+	{13, "000011"},
+	{14, "110100"},
+	{15, "110101"},
+	{16, "101010"},
+	{17, "101011"},
+	{18, "0100111"},
+	{19, "0001100"},
+	{20, "0001000"},
+	{21, "0010111"},
+	{22, "0000011"},
+	{23, "0000100"},
+	{24, "0101000"},
+	{25, "0101011"},
+	{26, "0010011"},
+	{27, "0100100"},
+	{28, "0011000"},
+	{29, "00000010"},
+	{30, "00000011"},
+	{31, "00011010"},
+	{32, "00011011"},
+	{33, "00010010"},
+	{34, "00010011"},
+	{35, "00010100"},
+	{36, "00010101"},
+	{37, "00010110"},
+	{38, "00010111"},
+	{39, "00101000"},
+	{40, "00101001"},
+	{41, "00101010"},
+	{42, "00101011"},
+	{43, "00101100"},
+	{44, "00101101"},
+	{45, "00000100"},
+	{46, "00000101"},
+	{47, "00001010"},
+	{48, "00001011"},
+	{49, "01010010"},
+	{50, "01010011"},
+	{51, "01010100"},
+	{52, "01010101"},
+	{53, "00100100"},
+	{54, "00100101"},
+	{55, "01011000"},
+	{56, "01011001"},
+	{57, "01011010"},
+	{58, "01011011"},
+	{59, "01001010"},
+	{60, "01001011"},
+	{61, "00110010"},
+	{62, "00110011"},
+	{63, "00110100"},
+	{64, "11011"},
+	{128, "10010"},
+	{192, "010111"},
+	{256, "0110111"},
+	{320, "00110110"},
+	{384, "00110111"},
+	{448, "01100100"},
+	{512, "01100101"},
+	{576, "01101000"},
+	{640, "01100111"},
+	{704, "011001100"},
+	{768, "011001101"},
+	{832, "011010010"},
+	{896, "011010011"},
+	{960, "011010100"},
+	{1024, "011010101"},
+	{1088, "011010110"},
+	{1152, "011010111"},
+	{1216, "011011000"},
+	{1280, "011011001"},
+	{1344, "011011010"},
+	{1408, "011011011"},
+	{1472, "010011000"},
+	{1536, "010011001"},
+	{1600, "010011010"},
+	{1664, "011000"},
+	{1728, "010011011"},
+	{1792, "00000001000"},
+	{1856, "00000001100"},
+	{1920, "00000001101"},
+	{1984, "000000010010"},
+	{2048, "000000010011"},
+	{2112, "000000010100"},
+	{2176, "000000010101"},
+	{2240, "000000010110"},
+	{2304, "000000010111"},
+	{2368, "000000011100"},
+	{2432, "000000011101"},
+	{2496, "000000011110"},
+	{2560, "000000011111"},
+}
+
+// blackRunCodes are the terminating and make-up codes for black runs (ITU-T T.4 tables 2 and 3).
+var blackRunCodes = []runCode{
+	{0, "0000110111"},
+	{1, "010"},
+	{2, "11"},
+	{3, "10"},
+	{4, "011"},
+	{5, "0011"},
+	{6, "0010"},
+	{7, "00011"},
+	{8, "000101"},
+	{9, "000100"},
+	{10, "0000100"},
+	{11, "0000101"},
+	{12, "0000111"},
+	{13, "00000100"},
+	{14, "00000111"},
+	{15, "000011000"},
+	{16, "0000010111"},
+	{17, "0000011000"},
+	{18, "0000001000"},
+	{19, "00001100111"},
+	{20, "00001101000"},
+	{21, "00001101100"},
+	{22, "00000110111"},
+	{23, "00000101000"},
+	{24, "00000010111"},
+	{25, "00000011000"},
+	{26, "000011001010"},
+	{27, "000011001011"},
+	{28, "000011001100"},
+	{29, "000011001101"},
+	{30, "000001101000"},
+	{31, "000001101001"},
+	{32, "000001101010"},
+	{33, "000001101011"},
+	{34, "000011010010"},
+	{35, "000011010011"},
+	{36, "000011010100"},
+	{37, "000011010101"},
+	{38, "000011010110"},
+	{39, "000011010111"},
+	{40, "000001101100"},
+	{41, "000001101101"},
+	{42, "000011011010"},
+	{43, "000011011011"},
+	{44, "000001010100"},
+	{45, "000001010101"},
+	{46, "000001010110"},
+	{47, "000001010111"},
+	{48, "000001100100"},
+	{49, "000001100101"},
+	{50, "000001010010"},
+	{51, "000001010011"},
+	{52, "000000100100"},
+	{53, "000000110111"},
+	{54, "000000111000"},
+	{55, "000000100111"},
+	{56, "000000101000"},
+	{57, "000001011000"},
+	{58, "000001011001"},
+	{59, "000000101011"},
+	{60, "000000101100"},
+	{61, "000001011010"},
+	{62, "000001100110"},
+	{63, "000001100111"},
+	{64, "0000001111"},
+	{128, "000011001000"},
+	{192, "000011001001"},
+	{256, "000001011011"},
+	{320, "000000110011"},
+	{384, "000000110100"},
+	{448, "000000110101"},
+	{512, "0000001101100"},
+	{576, "0000001101101"},
+	{640, "0000001001010"},
+	{704, "0000001001011"},
+	{768, "0000001001100"},
+	{832, "0000001001101"},
+	{896, "0000001110010"},
+	{960, "0000001110011"},
+	{1024, "0000001110100"},
+	{1088, "0000001110101"},
+	{1152, "0000001110110"},
+	{1216, "0000001110111"},
+	{1280, "0000001010010"},
+	{1344, "0000001010011"},
+	{1408, "0000001010100"},
+	{1472, "0000001010101"},
+	{1536, "0000001011010"},
+	{1600, "0000001011011"},
+	{1664, "0000001100100"},
+	{1728, "0000001100101"},
+	{1792, "00000001000"},
+	{1856, "00000001100"},
+	{1920, "00000001101"},
+	{1984, "000000010010"},
+	{2048, "000000010011"},
+	{2112, "000000010100"},
+	{2176, "000000010101"},
+	{2240, "000000010110"},
+	{2304, "000000010111"},
+	{2368, "000000011100"},
+	{2432, "000000011101"},
+	{2496, "000000011110"},
+	{2560, "000000011111"},
+}
+
+// Two-dimensional coding modes (ITU-T T.4 table 4).
+const (
+	modePass = iota
+	modeHorizontal
+	modeV0
+	modeVR1
+	modeVR2
+	modeVR3
+	modeVL1
+	modeVL2
+	modeVL3
+)
+
+// modeCodes maps the two-dimensional mode codes to the coding modes.
+var modeCodes = []runCode{
+	{modeV0, "1"},
+	{modeVR1, "011"},
+	{modeVL1, "010"},
+	{modeHorizontal, "001"},
+	{modePass, "0001"},
+	{modeVR2, "000011"},
+	{modeVL2, "000010"},
+	{modeVR3, "0000011"},
+	{modeVL3, "0000010"},
+}
+
+// codeTable allows looking up a value by its code length and code.
+type codeTable struct {
+	maxLen int
+	values map[uint32]int
+}
+
+// newCodeTable builds a code table from the list of codes.
+func newCodeTable(codes []runCode) *codeTable {
+	t := &codeTable{values: map[uint32]int{}}
+	for _, c := range codes {
+		var code uint32
+		for _, b := range c.bits {
+			code = code<<1 | uint32(b-'0')
+		}
+		t.values[uint32(len(c.bits))<<16|code] = c.run
+		if len(c.bits) > t.maxLen {
+			t.maxLen = len(c.bits)
+		}
+	}
+	return t
+}
+
+// decode reads the next code from `r` and returns its value.
+func (t *codeTable) decode(r *reader) (int, error) {
+	var code uint32
+	for n := 1; n <= t.maxLen; n++ {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		code = code<<1 | uint32(bit)
+		if v, ok := t.values[uint32(n)<<16|code]; ok {
+			return v, nil
+		}
+	}
+	return 0, errMMRCode
+}
+
+var (
+	whiteTable = newCodeTable(whiteRunCodes)
+	blackTable = newCodeTable(blackRunCodes)
+	modeTable  = newCodeTable(modeCodes)
+)
+
+// decodeMMR decodes a bitmap of the specified dimensions coded with the MMR (CCITT Group 4)
+// algorithm from `data`. Decoding stops early if an end-of-facsimile block (EOFB) is met.
+// Returns the bitmap and the number of bytes consumed, with the EOFB code included.
+func decodeMMR(data []byte, width, height int) (*Bitmap, int, error) {
+	bm, err := NewBitmap(width, height)
+	if err != nil {
+		return nil, 0, err
+	}
+	r := newReader(data)
+	ref := make([]byte, width)
+	for y := 0; y < height; y++ {
+		if isEOFB(r) {
+			break
+		}
+		cur := bm.row(y)
+		if err := decodeMMRRow(r, ref, cur); err != nil {
+			return nil, 0, err
+		}
+		ref = cur
+	}
+	isEOFB(r)
+	r.align()
+	return bm, r.pos, nil
+}
+
+// isEOFB checks whether the next bits of `r` form an EOFB code and consumes it if so.
+func isEOFB(r *reader) bool {
+	pos, bitPos := r.pos, r.bitPos
+	v, err := r.readBits(24)
+	if err == nil && v == 0x001001 {
+		return true
+	}
+	r.pos, r.bitPos = pos, bitPos
+	return false
+}
+
+// decodeMMRRow decodes a single coding line `cur` using the reference line `ref`.
+func decodeMMRRow(r *reader, ref, cur []byte) error {
+	width := len(cur)
+	a0 := -1
+	var color byte
+
+	fill := func(from, to int, c byte) {
+		if from < 0 {
+			from = 0
+		}
+		if to > width {
+			to = width
+		}
+		for i := from; i < to; i++ {
+			cur[i] = c
+		}
+	}
+
+	for a0 < width {
+		mode, err := modeTable.decode(r)
+		if err != nil {
+			return err
+		}
+		start := a0
+		if start < 0 {
+			start = 0
+		}
+		switch mode {
+		case modePass:
+			_, b2 := findB1B2(ref, a0, color)
+			fill(start, b2, color)
+			a0 = b2
+		case modeHorizontal:
+			run1, err := readRun(r, color)
+			if err != nil {
+				return err
+			}
+			run2, err := readRun(r, 1-color)
+			if err != nil {
+				return err
+			}
+			fill(start, start+run1, color)
+			fill(start+run1, start+run1+run2, 1-color)
+			a0 = start + run1 + run2
+		default:
+			b1, _ := findB1B2(ref, a0, color)
+			a1 := b1 + verticalOffset(mode)
+			if a1 < start || a1 > width {
+				return errMMRCode
+			}
+			fill(start, a1, color)
+			a0 = a1
+			color = 1 - color
+		}
+	}
+	return nil
+}
+
+// verticalOffset returns the offset of a1 relative to b1 for the vertical modes.
+func verticalOffset(mode int) int {
+	switch mode {
+	case modeVR1:
+		return 1
+	case modeVR2:
+		return 2
+	case modeVR3:
+		return 3
+	case modeVL1:
+		return -1
+	case modeVL2:
+		return -2
+	case modeVL3:
+		return -3
+	}
+	return 0
+}
+
+// findB1B2 finds the changing elements b1 and b2 on the reference line `ref` given the
+// position `a0` and the current `color`.
+func findB1B2(ref []byte, a0 int, color byte) (int, int) {
+	width := len(ref)
+	pixel := func(i int) byte {
+		if i < 0 {
+			return 0
+		}
+		return ref[i]
+	}
+	b1 := a0 + 1
+	for ; b1 < width; b1++ {
+		if ref[b1] != color && pixel(b1-1) == color {
+			break
+		}
+	}
+	if b1 >= width {
+		return width, width
+	}
+	b2 := b1 + 1
+	for ; b2 < width; b2++ {
+		if ref[b2] != ref[b2-1] {
+			break
+		}
+	}
+	return b1, b2
+}
+
+// readRun reads a complete run of pixels of the specified color, i.e. any number
+// of make-up codes followed by a terminating code.
+func readRun(r *reader, color byte) (int, error) {
+	table := whiteTable
+	if color == 1 {
+		table = blackTable
+	}
+	total := 0
+	for {
+		run, err := table.decode(r)
+		if err != nil {
+			return 0, err
+		}
+		total += run
+		if run < 64 {
+			return total, nil
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package jbig2
+
+import "errors"
+
+// errUnexpectedEOF is returned when the data ends before a structure is completely read.
+var errUnexpectedEOF = errors.New("jbig2: unexpected end of data")
+
+// reader reads bytes and bits from JBIG2 segment data. Bits are read most significant first.
+type reader struct {
+	data   []byte
+	pos    int
+	bitPos uint
+}
+
+// newReader returns a new reader over `data`.
+func newReader(data []byte) *reader {
+	return &reader{data: data}
+}
+
+// remaining returns the number of unread bytes (partially read bytes are counted as read).
+func (r *reader) remaining() int {
+	pos := r.pos
+	if r.bitPos > 0 {
+		pos++
+	}
+	if pos > len(r.data) {
+		return 0
+	}
+	return len(r.data) - pos
+}
+
+// align skips the remaining bits of a partially read byte.
+func (r *reader) align() {
+	if r.bitPos > 0 {
+		r.bitPos = 0
+		r.pos++
+	}
+}
+
+// bytes returns the next `n` bytes and advances the reader.
+func (r *reader) bytes(n int) ([]byte, error) {
+	r.align()
+	if n < 0 || r.pos+n > len(r.data) {
+		return nil, errUnexpectedEOF
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+// rest returns all unread bytes and advances the reader to the end.
+func (r *reader) rest() []byte {
+	r.align()
+	if r.pos >= len(r.data) {
+		return nil
+	}
+	b := r.data[r.pos:]
+	r.pos = len(r.data)
+	return b
+}
+
+// readByte reads a single byte.
+func (r *reader) readByte() (byte, error) {
+	r.align()
+	if r.pos >= len(r.data) {
+		return 0, errUnexpectedEOF
+	}
+	b := r.data[r.pos]
+	r.pos++
+	return b, nil
+}
+
+// readInt8 reads a signed byte.
+func (r *reader) readInt8() (int, error) {
+	b, err := r.readByte()
+	return int(int8(b)), err
+}
+
+// readUint16 reads a big-endian 16-bit unsigned integer.
+func (r *reader) readUint16() (uint16, error) {
+	b, err := r.bytes(2)
+	if err != nil {
+		return 0, err
+	}
+	return uint16(b[0])<<8 | uint16(b[1]), nil
+}
+
+// readUint32 reads a big-endian 32-bit unsigned integer.
+func (r *reader) readUint32() (uint32, error) {
+	b, err := r.bytes(4)
+	if err != nil {
+		return 0, err
+	}
+	return uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3]), nil
+}
+
+// readInt32 reads a big-endian 32-bit signed integer.
+func (r *reader) readInt32() (int32, error) {
+	v, err := r.readUint32()
+	return int32(v), err
+}
+
+// readBit reads a single bit.
+func (r *reader) readBit() (int, error) {
+	if r.pos >= len(r.data) {
+		return 0, errUnexpectedEOF
+	}
+	bit := int(r.data[r.pos]>>(7-r.bitPos)) & 1
+	r.bitPos++
+	if r.bitPos == 8 {
+		r.bitPos = 0
+		r.pos++
+	}
+	return bit, nil
+}
+
+// readBits reads `n` bits (at most 32) as an unsigned integer.
+func (r *reader) readBits(n int) (uint32, error) {
+	var v uint32
+	for i := 0; i < n; i++ {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		v = v<<1 | uint32(bit)
+	}
+	return v, nil
+}
@@ -0,0 +1,112 @@
+package jbig2
+
+import (
+	"errors"
+
+	"github.com/finalversus/doc/pdf/internal/mq"
+)
+
+// refinementTemplates lists the pixels forming the context of each generic refinement template
+// (section 6.3.5.3) from the least significant bit of the context to the most significant one.
+// The first slice holds pixels of the bitmap being decoded and the second one pixels of the
+// reference bitmap. Adaptive template pixels are listed at their nominal positions.
+var refinementTemplates = [2][2][]point{
+	{
+		{{-1, 0}, {1, -1}, {0, -1}, {-1, -1}},
+		{{1, 1}, {0, 1}, {-1, 1}, {1, 0}, {0, 0}, {-1, 0}, {1, -1}, {0, -1}, {-1, -1}},
+	},
+	{
+		{{-1, 0}, {1, -1}, {0, -1}, {-1, -1}},
+		{{1, 1}, {0, 1}, {1, 0}, {0, 0}, {-1, 0}, {0, -1}},
+	},
+}
+
+// refinementTPContexts are the contexts used to decode the SLTP bit of the generic refinement
+// region decoding procedure for each template (section 6.3.5.6). Only the bit of the reference
+// pixel corresponding to the current pixel is set.
+var refinementTPContexts = [2]int{0x0100, 0x0080}
+
+// refinementRegionParams are the parameters of the generic refinement region decoding procedure (Table 6).
+type refinementRegionParams struct {
+	width     int
+	height    int
+	template  int
+	reference *Bitmap
+	dx, dy    int
+	tpgron    bool
+	at        []point
+}
+
+// newRefinementContexts returns the contexts for generic refinement region decoding.
+func newRefinementContexts() []byte {
+	return make([]byte, 1<<13)
+}
+
+// decodeRefinementRegion decodes a generic refinement region with the arithmetic decoder `d`
+// using the refinement contexts `cx` (section 6.3.5).
+func decodeRefinementRegion(d *mq.Decoder, cx []byte, p *refinementRegionParams) (*Bitmap, error) {
+	if p.template < 0 || p.template > 1 {
+		return nil, errors.New("jbig2: invalid refinement template")
+	}
+	if p.reference == nil {
+		return nil, errors.New("jbig2: missing refinement reference bitmap")
+	}
+	bm, err := NewBitmap(p.width, p.height)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl := refinementTemplates[p.template]
+	cur := make([]point, len(tmpl[0]))
+	copy(cur, tmpl[0])
+	ref := make([]point, len(tmpl[1]))
+	copy(ref, tmpl[1])
+	if p.template == 0 && len(p.at) >= 2 {
+		cur[3] = p.at[0]
+		ref[8] = p.at[1]
+	}
+
+	reference := p.reference
+	ltp := 0
+	for y := 0; y < p.height; y++ {
+		if p.tpgron {
+			ltp ^= d.DecodeBit(cx, refinementTPContexts[p.template])
+		}
+		row := bm.row(y)
+		for x := 0; x < p.width; x++ {
+			rx, ry := x-p.dx, y-p.dy
+			if ltp == 1 {
+				if v, ok := typicalRefinementPixel(reference, rx, ry); ok {
+					row[x] = v
+					continue
+				}
+			}
+			context := 0
+			shift := uint(0)
+			for _, t := range cur {
+				context |= int(bm.GetPixel(x+t.x, y+t.y)) << shift
+				shift++
+			}
+			for _, t := range ref {
+				context |= int(reference.GetPixel(rx+t.x, ry+t.y)) << shift
+				shift++
+			}
+			row[x] = byte(d.DecodeBit(cx, context))
+		}
+	}
+	return bm, nil
+}
+
+// typicalRefinementPixel checks whether the 3x3 neighbourhood of (x, y) in the reference bitmap
+// has a single color, in which case the pixel is predicted to have that color (TPGRPIX).
+func typicalRefinementPixel(ref *Bitmap, x, y int) (byte, bool) {
+	v := ref.GetPixel(x, y)
+	for j := -1; j <= 1; j++ {
+		for i := -1; i <= 1; i++ {
+			if ref.GetPixel(x+i, y+j) != v {
+				return 0, false
+			}
+		}
+	}
+	return v, true
+}
@@ -0,0 +1,284 @@
+package jbig2
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/finalversus/doc/pdf/internal/mq"
+)
+
+// symbolDictParams are the parameters of the symbol dictionary decoding procedure (Table 13).
+type symbolDictParams struct {
+	huffman      bool
+	refAgg       bool
+	template     int
+	at           []point
+	rTemplate    int
+	rat          []point
+	inputSymbols []*Bitmap
+	numExported  int
+	numNew       int
+
+	tableDH      *huffmanTable
+	tableDW      *huffmanTable
+	tableBMSize  *huffmanTable
+	tableAggInst *huffmanTable
+}
+
+// decodeSymbolDictionary decodes the symbols of a symbol dictionary from `r` and returns the
+// exported symbols (section 6.5.5).
+func decodeSymbolDictionary(r *reader, p *symbolDictParams) ([]*Bitmap, error) {
+	numSymbols := len(p.inputSymbols) + p.numNew
+	symCodeLen := 0
+	for (1 << uint(symCodeLen)) < numSymbols {
+		symCodeLen++
+	}
+
+	var a *arithState
+	if p.huffman {
+		a = newArithState(nil, p.template, symCodeLen)
+	} else {
+		a = newArithState(mq.NewDecoder(r.rest()), p.template, symCodeLen)
+	}
+
+	decode := func(table *huffmanTable, cx []byte) (int, bool, error) {
+		if p.huffman {
+			return table.decode(r)
+		}
+		v, ok := decodeInt(a.d, cx)
+		return v, ok, nil
+	}
+	decodeValue := func(table *huffmanTable, cx []byte) (int, error) {
+		v, ok, err := decode(table, cx)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			return 0, errors.New("jbig2: unexpected out-of-band value in symbol dictionary")
+		}
+		return v, nil
+	}
+
+	newSymbols := make([]*Bitmap, 0, p.numNew)
+	var widths []int
+	hcHeight := 0
+	for len(newSymbols) < p.numNew {
+		dh, err := decodeValue(p.tableDH, a.iadh)
+		if err != nil {
+			return nil, err
+		}
+		hcHeight += dh
+		if hcHeight < 0 {
+			return nil, fmt.Errorf("jbig2: invalid symbol height %d", hcHeight)
+		}
+
+		symWidth := 0
+		totWidth := 0
+		hcFirst := len(newSymbols)
+		widths = widths[:0]
+		for {
+			dw, ok, err := decode(p.tableDW, a.iadw)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				break
+			}
+			if len(newSymbols) >= p.numNew {
+				return nil, errors.New("jbig2: too many symbols in symbol dictionary")
+			}
+			symWidth += dw
+			if symWidth < 0 {
+				return nil, fmt.Errorf("jbig2: invalid symbol width %d", symWidth)
+			}
+			totWidth += symWidth
+
+			if p.huffman && !p.refAgg {
+				widths = append(widths, symWidth)
+				newSymbols = append(newSymbols, nil)
+				continue
+			}
+
+			var bm *Bitmap
+			if !p.refAgg {
+				bm, err = decodeGenericRegion(a.d, a.gb, &genericRegionParams{
+					width:    symWidth,
+					height:   hcHeight,
+					template: p.template,
+					at:       p.at,
+				})
+			} else {
+				bm, err = decodeAggregateSymbol(r, a, p, symWidth, hcHeight, symCodeLen, newSymbols, decodeValue)
+			}
+			if err != nil {
+				return nil, err
+			}
+			newSymbols = append(newSymbols, bm)
+		}
+
+		if p.huffman && !p.refAgg {
+			if err := decodeCollectiveBitmap(r, p, newSymbols[hcFirst:], widths, totWidth, hcHeight); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Export flags (section 6.5.10).
+	all := make([]*Bitmap, 0, numSymbols)
+	all = append(all, p.inputSymbols...)
+	all = append(all, newSymbols...)
+	exported := make([]*Bitmap, 0, p.numExported)
+	export := false
+	for i := 0; i < len(all); {
+		var run int
+		var err error
+		if p.huffman {
+			run, err = standardTable(1).decodeValue(r)
+		} else {
+			run, err = decodeValue(nil, a.iaex)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if run < 0 || run > len(all)-i {
+			return nil, fmt.Errorf("jbig2: invalid export run length %d", run)
+		}
+		if export {
+			exported = append(exported, all[i:i+run]...)
+		}
+		i += run
+		export = !export
+	}
+	if len(exported) != p.numExported {
+		return nil, fmt.Errorf("jbig2: exported %d symbols, expected %d", len(exported), p.numExported)
+	}
+	return exported, nil
+}
+
+// decodeAggregateSymbol decodes a symbol bitmap coded as a refinement or an aggregation of
+// previously decoded symbols (section 6.5.8.2).
+func decodeAggregateSymbol(r *reader, a *arithState, p *symbolDictParams, width, height, symCodeLen int,
+	newSymbols []*Bitmap, decodeValue func(*huffmanTable, []byte) (int, error)) (*Bitmap, error) {
+	numInstances, err := decodeValue(p.tableAggInst, a.iaai)
+	if err != nil {
+		return nil, err
+	}
+	symbols := make([]*Bitmap, 0, len(p.inputSymbols)+len(newSymbols))
+	symbols = append(symbols, p.inputSymbols...)
+	symbols = append(symbols, newSymbols...)
+
+	if numInstances > 1 {
+		return decodeTextRegion(r, a, &textRegionParams{
+			huffman:      p.huffman,
+			refine:       true,
+			width:        width,
+			height:       height,
+			numInstances: numInstances,
+			symbols:      symbols,
+			symCodeLen:   symCodeLen,
+			combOp:       combineOR,
+			refCorner:    cornerTopLeft,
+			rTemplate:    p.rTemplate,
+			rat:          p.rat,
+			tableFS:      standardTable(6),
+			tableDS:      standardTable(8),
+			tableDT:      standardTable(11),
+			tableRDW:     standardTable(15),
+			tableRDH:     standardTable(15),
+			tableRDX:     standardTable(15),
+			tableRDY:     standardTable(15),
+			tableRSize:   standardTable(1),
+		})
+	}
+
+	var id, rdx, rdy int
+	d := a.d
+	if p.huffman {
+		v, err := r.readBits(symCodeLen)
+		if err != nil {
+			return nil, err
+		}
+		id = int(v)
+		if rdx, err = standardTable(15).decodeValue(r); err != nil {
+			return nil, err
+		}
+		if rdy, err = standardTable(15).decodeValue(r); err != nil {
+			return nil, err
+		}
+		size, err := standardTable(1).decodeValue(r)
+		if err != nil {
+			return nil, err
+		}
+		data, err := r.bytes(size)
+		if err != nil {
+			return nil, err
+		}
+		d = mq.NewDecoder(data)
+	} else {
+		id = decodeIAID(a.d, a.iaid, symCodeLen)
+		rdx, _ = decodeInt(a.d, a.iardx)
+		rdy, _ = decodeInt(a.d, a.iardy)
+	}
+	if id < 0 || id >= len(symbols) {
+		return nil, fmt.Errorf("jbig2: symbol ID %d out of range", id)
+	}
+
+	return decodeRefinementRegion(d, a.gr, &refinementRegionParams{
+		width:     width,
+		height:    height,
+		template:  p.rTemplate,
+		reference: symbols[id],
+		dx:        rdx,
+		dy:        rdy,
+		at:        p.rat,
+	})
+}
+
+// decodeCollectiveBitmap decodes the collective bitmap of a height class of a Huffman coded
+// symbol dictionary and splits it into the symbols of the class (section 6.5.9).
+func decodeCollectiveBitmap(r *reader, p *symbolDictParams, symbols []*Bitmap, widths []int,
+	totWidth, height int) error {
+	size, err := p.tableBMSize.decodeValue(r)
+	if err != nil {
+		return err
+	}
+	r.align()
+
+	var collective *Bitmap
+	if size == 0 {
+		collective, err = NewBitmap(totWidth, height)
+		if err != nil {
+			return err
+		}
+		stride := (totWidth + 7) / 8
+		data, err := r.bytes(stride * height)
+		if err != nil {
+			return err
+		}
+		for y := 0; y < height; y++ {
+			row := collective.row(y)
+			for x := range row {
+				row[x] = (data[y*stride+x>>3] >> uint(7-x&7)) & 1
+			}
+		}
+	} else {
+		data, err := r.bytes(size)
+		if err != nil {
+			return err
+		}
+		collective, _, err = decodeMMR(data, totWidth, height)
+		if err != nil {
+			return err
+		}
+	}
+
+	x := 0
+	for i, w := range widths {
+		symbols[i], err = collective.subBitmap(x, 0, w, height)
+		if err != nil {
+			return err
+		}
+		x += w
+	}
+	return nil
+}
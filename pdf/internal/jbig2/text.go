@@ -0,0 +1,371 @@
+package jbig2
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/finalversus/doc/pdf/internal/mq"
+)
+
+// Reference corners of the symbol instances in a text region (section 7.4.3.1.1).
+const (
+	cornerBottomLeft = iota
+	cornerTopLeft
+	cornerBottomRight
+	cornerTopRight
+)
+
+// arithState groups the arithmetic decoder with the contexts used by the symbol dictionary
+// and text region decoding procedures, which share them when symbols are refined or aggregated.
+type arithState struct {
+	d     *mq.Decoder
+	gb    []byte
+	gr    []byte
+	iadh  []byte
+	iadw  []byte
+	iaex  []byte
+	iaai  []byte
+	iadt  []byte
+	iafs  []byte
+	iads  []byte
+	iait  []byte
+	iari  []byte
+	iardw []byte
+	iardh []byte
+	iardx []byte
+	iardy []byte
+	iaid  []byte
+}
+
+// newArithState returns a new arithState with freshly initialized contexts. `d` may be nil
+// if the data is Huffman coded and only refinements are arithmetic coded.
+func newArithState(d *mq.Decoder, template int, symCodeLen int) *arithState {
+	return &arithState{
+		d:     d,
+		gb:    newGenericContexts(template),
+		gr:    newRefinementContexts(),
+		iadh:  newIntContexts(),
+		iadw:  newIntContexts(),
+		iaex:  newIntContexts(),
+		iaai:  newIntContexts(),
+		iadt:  newIntContexts(),
+		iafs:  newIntContexts(),
+		iads:  newIntContexts(),
+		iait:  newIntContexts(),
+		iari:  newIntContexts(),
+		iardw: newIntContexts(),
+		iardh: newIntContexts(),
+		iardx: newIntContexts(),
+		iardy: newIntContexts(),
+		iaid:  make([]byte, 1<<uint(symCodeLen+1)),
+	}
+}
+
+// textRegionParams are the parameters of the text region decoding procedure (Table 9).
+type textRegionParams struct {
+	huffman      bool
+	refine       bool
+	width        int
+	height       int
+	numInstances int
+	logStrips    int
+	symbols      []*Bitmap
+	symCodeLen   int
+	symCodes     *huffmanTable
+	defPixel     byte
+	combOp       combinationOperator
+	transposed   bool
+	refCorner    int
+	dsOffset     int
+	rTemplate    int
+	rat          []point
+
+	tableFS    *huffmanTable
+	tableDS    *huffmanTable
+	tableDT    *huffmanTable
+	tableRDW   *huffmanTable
+	tableRDH   *huffmanTable
+	tableRDX   *huffmanTable
+	tableRDY   *huffmanTable
+	tableRSize *huffmanTable
+}
+
+// decodeTextRegion decodes a text region (section 6.4.5). Huffman coded values are read from `r`,
+// arithmetic coded values are decoded with `a`.
+func decodeTextRegion(r *reader, a *arithState, p *textRegionParams) (*Bitmap, error) {
+	bm, err := NewBitmap(p.width, p.height)
+	if err != nil {
+		return nil, err
+	}
+	if p.defPixel != 0 {
+		bm.fill(1)
+	}
+
+	decode := func(table *huffmanTable, cx []byte) (int, bool, error) {
+		if p.huffman {
+			return table.decode(r)
+		}
+		v, ok := decodeInt(a.d, cx)
+		return v, ok, nil
+	}
+	decodeValue := func(table *huffmanTable, cx []byte) (int, error) {
+		v, ok, err := decode(table, cx)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			return 0, errors.New("jbig2: unexpected out-of-band value in text region")
+		}
+		return v, nil
+	}
+
+	strips := 1 << uint(p.logStrips)
+
+	stripT, err := decodeValue(p.tableDT, a.iadt)
+	if err != nil {
+		return nil, err
+	}
+	stripT *= -strips
+	firstS := 0
+	instances := 0
+	for instances < p.numInstances {
+		dt, err := decodeValue(p.tableDT, a.iadt)
+		if err != nil {
+			return nil, err
+		}
+		stripT += dt * strips
+
+		first := true
+		curS := 0
+		for {
+			if first {
+				dfs, err := decodeValue(p.tableFS, a.iafs)
+				if err != nil {
+					return nil, err
+				}
+				firstS += dfs
+				curS = firstS
+				first = false
+			} else {
+				ids, ok, err := decode(p.tableDS, a.iads)
+				if err != nil {
+					return nil, err
+				}
+				if !ok {
+					break
+				}
+				curS += ids + p.dsOffset
+			}
+			if instances >= p.numInstances {
+				break
+			}
+
+			curT := 0
+			if strips > 1 {
+				if p.huffman {
+					v, err := r.readBits(p.logStrips)
+					if err != nil {
+						return nil, err
+					}
+					curT = int(v)
+				} else {
+					curT, err = decodeValue(nil, a.iait)
+					if err != nil {
+						return nil, err
+					}
+				}
+			}
+			t := stripT + curT
+
+			id, err := decodeSymbolID(r, a, p)
+			if err != nil {
+				return nil, err
+			}
+			if id < 0 || id >= len(p.symbols) {
+				return nil, fmt.Errorf("jbig2: symbol ID %d out of range", id)
+			}
+
+			ri := 0
+			if p.refine {
+				if p.huffman {
+					bit, err := r.readBit()
+					if err != nil {
+						return nil, err
+					}
+					ri = bit
+				} else {
+					ri, err = decodeValue(nil, a.iari)
+					if err != nil {
+						return nil, err
+					}
+				}
+			}
+
+			ib := p.symbols[id]
+			if ri != 0 {
+				ib, err = decodeRefinedInstance(r, a, p, ib, decodeValue)
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			wi, hi := ib.Width, ib.Height
+			if !p.transposed && (p.refCorner == cornerTopRight || p.refCorner == cornerBottomRight) {
+				curS += wi - 1
+			} else if p.transposed && (p.refCorner == cornerBottomLeft || p.refCorner == cornerBottomRight) {
+				curS += hi - 1
+			}
+			s := curS
+
+			var x, y int
+			if !p.transposed {
+				switch p.refCorner {
+				case cornerTopRight:
+					x, y = s-wi+1, t
+				case cornerBottomLeft:
+					x, y = s, t-hi+1
+				case cornerBottomRight:
+					x, y = s-wi+1, t-hi+1
+				default:
+					x, y = s, t
+				}
+			} else {
+				switch p.refCorner {
+				case cornerTopRight:
+					x, y = t-wi+1, s
+				case cornerBottomLeft:
+					x, y = t, s-hi+1
+				case cornerBottomRight:
+					x, y = t-wi+1, s-hi+1
+				default:
+					x, y = t, s
+				}
+			}
+			bm.compose(ib, x, y, p.combOp)
+
+			if !p.transposed && (p.refCorner == cornerTopLeft || p.refCorner == cornerBottomLeft) {
+				curS += wi - 1
+			} else if p.transposed && (p.refCorner == cornerTopLeft || p.refCorner == cornerTopRight) {
+				curS += hi - 1
+			}
+			instances++
+		}
+	}
+	return bm, nil
+}
+
+// decodeSymbolID decodes the ID of the next symbol instance of a text region.
+func decodeSymbolID(r *reader, a *arithState, p *textRegionParams) (int, error) {
+	if !p.huffman {
+		return decodeIAID(a.d, a.iaid, p.symCodeLen), nil
+	}
+	if p.symCodes == nil {
+		v, err := r.readBits(p.symCodeLen)
+		return int(v), err
+	}
+	return p.symCodes.decodeValue(r)
+}
+
+// decodeRefinedInstance decodes the refinement of symbol `ib` for a symbol instance of a text region.
+func decodeRefinedInstance(r *reader, a *arithState, p *textRegionParams, ib *Bitmap,
+	decodeValue func(*huffmanTable, []byte) (int, error)) (*Bitmap, error) {
+	rdw, err := decodeValue(p.tableRDW, a.iardw)
+	if err != nil {
+		return nil, err
+	}
+	rdh, err := decodeValue(p.tableRDH, a.iardh)
+	if err != nil {
+		return nil, err
+	}
+	rdx, err := decodeValue(p.tableRDX, a.iardx)
+	if err != nil {
+		return nil, err
+	}
+	rdy, err := decodeValue(p.tableRDY, a.iardy)
+	if err != nil {
+		return nil, err
+	}
+
+	d := a.d
+	if p.huffman {
+		rsize, err := p.tableRSize.decodeValue(r)
+		if err != nil {
+			return nil, err
+		}
+		r.align()
+		data, err := r.bytes(rsize)
+		if err != nil {
+			return nil, err
+		}
+		d = mq.NewDecoder(data)
+	}
+
+	return decodeRefinementRegion(d, a.gr, &refinementRegionParams{
+		width:     ib.Width + rdw,
+		height:    ib.Height + rdh,
+		template:  p.rTemplate,
+		reference: ib,
+		dx:        (rdw >> 1) + rdx,
+		dy:        (rdh >> 1) + rdy,
+		at:        p.rat,
+	})
+}
+
+// readSymbolIDTable reads the Huffman table used to decode the symbol IDs of a Huffman coded
+// text region (section 7.4.3.1.7).
+func readSymbolIDTable(r *reader, numSymbols int) (*huffmanTable, error) {
+	runLines := make([]huffmanLine, 35)
+	for i := range runLines {
+		n, err := r.readBits(4)
+		if err != nil {
+			return nil, err
+		}
+		runLines[i] = huffmanLine{prefLen: int(n), rangeLow: i}
+	}
+	runCodes := newHuffmanTable(runLines)
+
+	lines := make([]huffmanLine, numSymbols)
+	for i := 0; i < numSymbols; {
+		code, err := runCodes.decodeValue(r)
+		if err != nil {
+			return nil, err
+		}
+		var length, repeat int
+		switch code {
+		case 32:
+			if i == 0 {
+				return nil, errors.New("jbig2: symbol ID code length repeat without previous length")
+			}
+			length = lines[i-1].prefLen
+			v, err := r.readBits(2)
+			if err != nil {
+				return nil, err
+			}
+			repeat = int(v) + 3
+		case 33:
+			v, err := r.readBits(3)
+			if err != nil {
+				return nil, err
+			}
+			repeat = int(v) + 3
+		case 34:
+			v, err := r.readBits(7)
+			if err != nil {
+				return nil, err
+			}
+			repeat = int(v) + 11
+		default:
+			length = code
+			repeat = 1
+		}
+		if i+repeat > numSymbols {
+			return nil, errors.New("jbig2: too many symbol ID code lengths")
+		}
+		for ; repeat > 0; repeat-- {
+			lines[i] = huffmanLine{prefLen: length, rangeLow: i}
+			i++
+		}
+	}
+	r.align()
+	return newHuffmanTable(lines), nil
+}
@@ -0,0 +1,636 @@
+package jpx
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/finalversus/doc/common"
+)
+
+// Markers of the codestream syntax (Table A.2).
+const (
+	markerSOC = 0xff4f
+	markerSIZ = 0xff51
+	markerCOD = 0xff52
+	markerCOC = 0xff53
+	markerTLM = 0xff55
+	markerPLM = 0xff57
+	markerPLT = 0xff58
+	markerQCD = 0xff5c
+	markerQCC = 0xff5d
+	markerRGN = 0xff5e
+	markerPOC = 0xff5f
+	markerPPM = 0xff60
+	markerPPT = 0xff61
+	markerCRG = 0xff63
+	markerCOM = 0xff64
+	markerSOT = 0xff90
+	markerSOP = 0xff91
+	markerEPH = 0xff92
+	markerSOD = 0xff93
+	markerEOC = 0xffd9
+)
+
+// Progression orders (Table A.16).
+const (
+	progressionLRCP = iota
+	progressionRLCP
+	progressionRPCL
+	progressionPCRL
+	progressionCPRL
+)
+
+// Code-block style flags (Table A.19).
+const (
+	cbBypass     = 0x01
+	cbReset      = 0x02
+	cbTermAll    = 0x04
+	cbCausal     = 0x08
+	cbPredictive = 0x10
+	cbSegSymbols = 0x20
+)
+
+// maxLevels is the maximum number of decomposition levels (Table A.15).
+const maxLevels = 32
+
+// imageComponent describes a component of the image (SIZ marker segment).
+type imageComponent struct {
+	precision int
+	signed    bool
+	dx, dy    int
+}
+
+// imageSize holds the content of the SIZ marker segment (section A.5.1).
+type imageSize struct {
+	x1, y1         int
+	x0, y0         int
+	tileW, tileH   int
+	tileX0, tileY0 int
+	components     []imageComponent
+}
+
+// numTiles returns the number of tiles in horizontal and vertical direction.
+func (s *imageSize) numTiles() (int, int) {
+	return ceilDiv(s.x1-s.tileX0, s.tileW), ceilDiv(s.y1-s.tileY0, s.tileH)
+}
+
+// codingStyle holds the parameters of a COD marker segment that apply to all components.
+type codingStyle struct {
+	sop         bool
+	eph         bool
+	progression int
+	layers      int
+	mct         bool
+}
+
+// componentStyle holds the component specific parameters of a COD or COC marker segment.
+type componentStyle struct {
+	levels     int
+	xcb, ycb   int
+	cbStyle    int
+	reversible bool
+	// ppx and ppy are the precinct size exponents of each resolution level.
+	ppx, ppy []int
+}
+
+// stepSize is the exponent and mantissa of a quantization step size.
+type stepSize struct {
+	exponent int
+	mantissa int
+}
+
+// quantization holds the content of a QCD or QCC marker segment (section A.6.4).
+type quantization struct {
+	style  int
+	guard  int
+	values []stepSize
+}
+
+// Quantization styles (Table A.28).
+const (
+	quantNone = iota
+	quantDerived
+	quantExpounded
+)
+
+// step returns the step size of the band with orientation `orient` (0 for LL, 1 for HL,
+// 2 for LH, 3 for HH) at resolution level `r` of a component with `levels` decomposition levels.
+func (q *quantization) step(r, orient, levels int) stepSize {
+	if q.style == quantDerived {
+		if len(q.values) == 0 {
+			return stepSize{}
+		}
+		v := q.values[0]
+		nb := levels
+		if r > 0 {
+			nb = levels - r + 1
+		}
+		return stepSize{exponent: v.exponent - levels + nb, mantissa: v.mantissa}
+	}
+	i := 0
+	if r > 0 {
+		i = 3*(r-1) + orient
+	}
+	if i >= len(q.values) {
+		if len(q.values) == 0 {
+			return stepSize{}
+		}
+		return q.values[len(q.values)-1]
+	}
+	return q.values[i]
+}
+
+// progressionChange is an entry of a POC marker segment (section A.6.6).
+type progressionChange struct {
+	resStart, compStart int
+	layerEnd            int
+	resEnd, compEnd     int
+	order               int
+}
+
+// tileParams holds the coding parameters of a tile, derived from the main header and the
+// tile-part headers of the tile.
+type tileParams struct {
+	coding     codingStyle
+	components []*componentStyle
+	quant      []*quantization
+	roiShift   []int
+	poc        []progressionChange
+
+	// hasCOC and hasQCC record the components with a COC or QCC segment in the same header.
+	hasCOC []bool
+	hasQCC []bool
+}
+
+// clone returns a copy of `p` that can be modified by tile-part headers.
+func (p *tileParams) clone() *tileParams {
+	return &tileParams{
+		coding:     p.coding,
+		components: append([]*componentStyle(nil), p.components...),
+		quant:      append([]*quantization(nil), p.quant...),
+		roiShift:   append([]int(nil), p.roiShift...),
+		poc:        append([]progressionChange(nil), p.poc...),
+		hasCOC:     make([]bool, len(p.components)),
+		hasQCC:     make([]bool, len(p.components)),
+	}
+}
+
+// tileData holds the coding parameters and the packet data of a tile, concatenated from
+// all of its tile-parts.
+type tileData struct {
+	index  int
+	params *tileParams
+	data   []byte
+}
+
+// codestream is a parsed JPEG 2000 codestream.
+type codestream struct {
+	size  imageSize
+	main  *tileParams
+	tiles []*tileData
+}
+
+// parseCodestream parses the main header and the tile-parts of a codestream.
+func parseCodestream(data []byte) (*codestream, error) {
+	r := newByteReader(data)
+	if r.u16() != markerSOC {
+		return nil, errors.New("jpx: missing SOC marker")
+	}
+	cs := &codestream{}
+	hasSIZ := false
+	hasCOD := false
+	hasQCD := false
+	var tiles map[int]*tileData
+
+	for {
+		marker := r.u16()
+		if r.err != nil {
+			if tiles != nil {
+				// Tolerate a missing EOC marker.
+				break
+			}
+			return nil, r.err
+		}
+		if marker == markerEOC {
+			break
+		}
+		if marker == markerSOT {
+			if !hasSIZ || !hasCOD || !hasQCD {
+				return nil, errors.New("jpx: incomplete main header")
+			}
+			if tiles == nil {
+				tiles = map[int]*tileData{}
+			}
+			if err := cs.parseTilePart(r, tiles); err != nil {
+				if len(tiles) == 0 {
+					return nil, err
+				}
+				common.Log.Debug("ERROR: jpx: tile-part: %v", err)
+				break
+			}
+			continue
+		}
+		if marker>>8 != 0xff {
+			return nil, fmt.Errorf("jpx: invalid marker %04x", marker)
+		}
+		length := r.u16()
+		segment := newByteReader(r.bytes(length - 2))
+		if r.err != nil {
+			return nil, r.err
+		}
+		if tiles != nil {
+			return nil, fmt.Errorf("jpx: unexpected marker %04x after tile-parts", marker)
+		}
+
+		var err error
+		switch marker {
+		case markerSIZ:
+			err = cs.parseSIZ(segment)
+			hasSIZ = err == nil
+		case markerCOD:
+			if !hasSIZ {
+				return nil, errors.New("jpx: COD before SIZ")
+			}
+			err = parseCOD(segment, cs.main)
+			hasCOD = true
+		case markerCOC:
+			if !hasSIZ {
+				return nil, errors.New("jpx: COC before SIZ")
+			}
+			err = parseCOC(segment, cs.main)
+		case markerQCD:
+			if !hasSIZ {
+				return nil, errors.New("jpx: QCD before SIZ")
+			}
+			err = parseQCD(segment, cs.main)
+			hasQCD = true
+		case markerQCC:
+			if !hasSIZ {
+				return nil, errors.New("jpx: QCC before SIZ")
+			}
+			err = parseQCC(segment, cs.main)
+		case markerRGN:
+			if !hasSIZ {
+				return nil, errors.New("jpx: RGN before SIZ")
+			}
+			err = parseRGN(segment, cs.main)
+		case markerPOC:
+			if !hasSIZ {
+				return nil, errors.New("jpx: POC before SIZ")
+			}
+			err = parsePOC(segment, cs.main)
+		case markerPPM:
+			return nil, errors.New("jpx: packed packet headers are not supported")
+		case markerTLM, markerPLM, markerCRG, markerCOM:
+		default:
+			common.Log.Debug("jpx: skipping marker %04x", marker)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(tiles) == 0 {
+		return nil, errors.New("jpx: no tile data")
+	}
+	nx, ny := cs.size.numTiles()
+	for i := 0; i < nx*ny; i++ {
+		if t, ok := tiles[i]; ok {
+			cs.tiles = append(cs.tiles, t)
+		}
+	}
+	return cs, nil
+}
+
+// parseSIZ parses the SIZ marker segment.
+func (cs *codestream) parseSIZ(r *byteReader) error {
+	r.u16() // Capabilities.
+	s := &cs.size
+	s.x1 = int(r.u32())
+	s.y1 = int(r.u32())
+	s.x0 = int(r.u32())
+	s.y0 = int(r.u32())
+	s.tileW = int(r.u32())
+	s.tileH = int(r.u32())
+	s.tileX0 = int(r.u32())
+	s.tileY0 = int(r.u32())
+	n := r.u16()
+	for i := 0; i < n; i++ {
+		b := r.u8()
+		c := imageComponent{precision: b&0x7f + 1, signed: b&0x80 != 0, dx: r.u8(), dy: r.u8()}
+		s.components = append(s.components, c)
+	}
+	if r.err != nil {
+		return r.err
+	}
+
+	if s.x1 <= s.x0 || s.y1 <= s.y0 || s.x0 < 0 || s.y0 < 0 || s.x1 > 1<<30 || s.y1 > 1<<30 {
+		return fmt.Errorf("jpx: invalid image area %d,%d-%d,%d", s.x0, s.y0, s.x1, s.y1)
+	}
+	if s.tileW <= 0 || s.tileH <= 0 || s.tileX0 > s.x0 || s.tileY0 > s.y0 ||
+		s.tileX0+s.tileW <= s.x0 || s.tileY0+s.tileH <= s.y0 {
+		return errors.New("jpx: invalid tile grid")
+	}
+	if n == 0 || n > 16384 {
+		return fmt.Errorf("jpx: invalid number of components %d", n)
+	}
+	for _, c := range s.components {
+		if c.dx == 0 || c.dy == 0 {
+			return errors.New("jpx: invalid component subsampling")
+		}
+		if c.precision > 31 {
+			return fmt.Errorf("jpx: unsupported precision %d", c.precision)
+		}
+	}
+
+	cs.main = &tileParams{
+		components: make([]*componentStyle, n),
+		quant:      make([]*quantization, n),
+		roiShift:   make([]int, n),
+		hasCOC:     make([]bool, n),
+		hasQCC:     make([]bool, n),
+	}
+	return nil
+}
+
+// readComponentIndex reads a component index of a COC, QCC, RGN or POC marker segment,
+// which is coded as a byte or a 16-bit integer depending on the number of components.
+func readComponentIndex(r *byteReader, numComponents int) int {
+	if numComponents < 257 {
+		return r.u8()
+	}
+	return r.u16()
+}
+
+// parseComponentStyle parses the SPcod or SPcoc parameters of a COD or COC marker segment.
+func parseComponentStyle(r *byteReader, precincts bool) (*componentStyle, error) {
+	s := &componentStyle{
+		levels:     r.u8(),
+		xcb:        r.u8() + 2,
+		ycb:        r.u8() + 2,
+		cbStyle:    r.u8(),
+		reversible: r.u8() == 1,
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if s.levels > maxLevels {
+		return nil, fmt.Errorf("jpx: invalid number of decomposition levels %d", s.levels)
+	}
+	if s.xcb > 10 || s.ycb > 10 || s.xcb+s.ycb > 12 {
+		return nil, fmt.Errorf("jpx: invalid code-block size %dx%d", s.xcb, s.ycb)
+	}
+	for i := 0; i <= s.levels; i++ {
+		ppx, ppy := 15, 15
+		if precincts {
+			b := r.u8()
+			ppx, ppy = b&0xf, b>>4
+			if i > 0 && (ppx == 0 || ppy == 0) {
+				return nil, errors.New("jpx: invalid precinct size")
+			}
+		}
+		s.ppx = append(s.ppx, ppx)
+		s.ppy = append(s.ppy, ppy)
+	}
+	return s, r.err
+}
+
+// parseCOD parses a COD marker segment into `p`. Components with a COC segment keep their style.
+func parseCOD(r *byteReader, p *tileParams) error {
+	scod := r.u8()
+	c := codingStyle{
+		sop:         scod&2 != 0,
+		eph:         scod&4 != 0,
+		progression: r.u8(),
+		layers:      r.u16(),
+		mct:         r.u8() != 0,
+	}
+	if c.progression > progressionCPRL {
+		return fmt.Errorf("jpx: invalid progression order %d", c.progression)
+	}
+	if c.layers == 0 {
+		return errors.New("jpx: invalid number of layers")
+	}
+	s, err := parseComponentStyle(r, scod&1 != 0)
+	if err != nil {
+		return err
+	}
+	p.coding = c
+	for i := range p.components {
+		if !p.hasCOC[i] {
+			p.components[i] = s
+		}
+	}
+	return nil
+}
+
+// parseCOC parses a COC marker segment into `p`.
+func parseCOC(r *byteReader, p *tileParams) error {
+	c := readComponentIndex(r, len(p.components))
+	scoc := r.u8()
+	s, err := parseComponentStyle(r, scoc&1 != 0)
+	if err != nil {
+		return err
+	}
+	if c >= len(p.components) {
+		return fmt.Errorf("jpx: invalid component %d in COC", c)
+	}
+	p.components[c] = s
+	p.hasCOC[c] = true
+	return nil
+}
+
+// parseQuantization parses the Sqcd and SPqcd parameters of a QCD or QCC marker segment.
+func parseQuantization(r *byteReader) (*quantization, error) {
+	b := r.u8()
+	q := &quantization{style: b & 0x1f, guard: b >> 5}
+	switch q.style {
+	case quantNone:
+		for r.remaining() > 0 {
+			q.values = append(q.values, stepSize{exponent: r.u8() >> 3})
+		}
+	case quantDerived, quantExpounded:
+		for r.remaining() >= 2 {
+			v := r.u16()
+			q.values = append(q.values, stepSize{exponent: v >> 11, mantissa: v & 0x7ff})
+		}
+	default:
+		return nil, fmt.Errorf("jpx: invalid quantization style %d", q.style)
+	}
+	if len(q.values) == 0 {
+		return nil, errors.New("jpx: missing quantization step sizes")
+	}
+	return q, r.err
+}
+
+// parseQCD parses a QCD marker segment into `p`. Components with a QCC segment keep their values.
+func parseQCD(r *byteReader, p *tileParams) error {
+	q, err := parseQuantization(r)
+	if err != nil {
+		return err
+	}
+	for i := range p.quant {
+		if !p.hasQCC[i] {
+			p.quant[i] = q
+		}
+	}
+	return nil
+}
+
+// parseQCC parses a QCC marker segment into `p`.
+func parseQCC(r *byteReader, p *tileParams) error {
+	c := readComponentIndex(r, len(p.components))
+	q, err := parseQuantization(r)
+	if err != nil {
+		return err
+	}
+	if c >= len(p.quant) {
+		return fmt.Errorf("jpx: invalid component %d in QCC", c)
+	}
+	p.quant[c] = q
+	p.hasQCC[c] = true
+	return nil
+}
+
+// parseRGN parses a RGN marker segment into `p`.
+func parseRGN(r *byteReader, p *tileParams) error {
+	c := readComponentIndex(r, len(p.components))
+	if style := r.u8(); style != 0 {
+		return fmt.Errorf("jpx: invalid ROI style %d", style)
+	}
+	shift := r.u8()
+	if r.err != nil {
+		return r.err
+	}
+	if c >= len(p.roiShift) {
+		return fmt.Errorf("jpx: invalid component %d in RGN", c)
+	}
+	p.roiShift[c] = shift
+	return nil
+}
+
+// parsePOC parses a POC marker segment into `p`.
+func parsePOC(r *byteReader, p *tileParams) error {
+	n := len(p.components)
+	size := 7
+	if n >= 257 {
+		size = 9
+	}
+	var changes []progressionChange
+	for r.remaining() >= size {
+		c := progressionChange{
+			resStart:  r.u8(),
+			compStart: readComponentIndex(r, n),
+			layerEnd:  r.u16(),
+			resEnd:    r.u8(),
+			compEnd:   readComponentIndex(r, n),
+			order:     r.u8(),
+		}
+		if c.compEnd == 0 && n < 257 {
+			c.compEnd = 256
+		}
+		if c.order > progressionCPRL {
+			return fmt.Errorf("jpx: invalid progression order %d", c.order)
+		}
+		changes = append(changes, c)
+	}
+	if r.err != nil {
+		return r.err
+	}
+	p.poc = changes
+	return nil
+}
+
+// parseTilePart parses a tile-part starting after the SOT marker and appends its data to `tiles`.
+func (cs *codestream) parseTilePart(r *byteReader, tiles map[int]*tileData) error {
+	start := r.pos - 2
+	length := r.u16()
+	index := r.u16()
+	psot := int(r.u32())
+	r.u8() // Tile-part index.
+	r.u8() // Number of tile-parts.
+	if r.err != nil {
+		return r.err
+	}
+	if length != 10 {
+		return errors.New("jpx: invalid SOT marker segment")
+	}
+	nx, ny := cs.size.numTiles()
+	if index >= nx*ny {
+		return fmt.Errorf("jpx: invalid tile index %d", index)
+	}
+	end := len(r.data)
+	if psot != 0 {
+		end = start + psot
+		if end > len(r.data) || psot < 14 {
+			common.Log.Debug("jpx: tile-part length %d exceeds data", psot)
+			end = len(r.data)
+		}
+	}
+
+	t, ok := tiles[index]
+	if !ok {
+		t = &tileData{index: index, params: cs.main.clone()}
+		tiles[index] = t
+	}
+	p := t.params
+
+	for {
+		marker := r.u16()
+		if r.err != nil {
+			return r.err
+		}
+		if marker == markerSOD {
+			break
+		}
+		l := r.u16()
+		segment := newByteReader(r.bytes(l - 2))
+		if r.err != nil {
+			return r.err
+		}
+		var err error
+		switch marker {
+		case markerCOD:
+			err = parseCOD(segment, p)
+		case markerCOC:
+			err = parseCOC(segment, p)
+		case markerQCD:
+			err = parseQCD(segment, p)
+		case markerQCC:
+			err = parseQCC(segment, p)
+		case markerRGN:
+			err = parseRGN(segment, p)
+		case markerPOC:
+			err = parsePOC(segment, p)
+		case markerPPT:
+			return errors.New("jpx: packed packet headers are not supported")
+		case markerPLT, markerCOM:
+		default:
+			common.Log.Debug("jpx: skipping tile-part marker %04x", marker)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if r.pos > end {
+		return errors.New("jpx: tile-part header exceeds tile-part")
+	}
+	data := r.data[r.pos:end]
+	if psot == 0 && len(data) >= 2 && data[len(data)-2] == 0xff && data[len(data)-1] == 0xd9 {
+		data = data[:len(data)-2]
+	}
+	t.data = append(t.data, data...)
+	r.pos = end
+	return nil
+}
+
+// ceilDiv returns ceil(a/b) for a >= 0 and b > 0.
+func ceilDiv(a, b int) int {
+	return (a + b - 1) / b
+}
+
+// ceilShift returns ceil(a/2^s) for a >= 0.
+func ceilShift(a, s int) int {
+	return (a + (1 << uint(s)) - 1) >> uint(s)
+}
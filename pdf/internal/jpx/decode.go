@@ -0,0 +1,528 @@
+package jpx
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// maxSamples limits the number of samples of decoded images.
+const maxSamples = 1 << 28
+
+// errImageTooLarge is returned for images exceeding maxSamples.
+var errImageTooLarge = errors.New("jpx: image too large")
+
+// Options are the options of Decode.
+type Options struct {
+	// Reduce is the number of highest resolution levels that are discarded. Each level halves
+	// the width and height of the decoded image. It is limited to the number of wavelet
+	// decomposition levels of the image.
+	Reduce int
+}
+
+// Image is a decoded image.
+type Image struct {
+	Width  int
+	Height int
+	// BitsPerComponent is 8 or 16.
+	BitsPerComponent int
+	ColorComponents  int
+	// Data holds the color samples of the image, row by row with interleaved components.
+	// 16-bit samples are stored in big-endian order.
+	Data []byte
+	// Alpha holds the samples of the alpha channel with the same number of bits per
+	// component as Data, or nil if the image has no alpha channel.
+	Alpha      []byte
+	ColorSpace ColorSpace
+	// ICCProfile is the embedded ICC profile, if any.
+	ICCProfile []byte
+}
+
+// Config describes an image without decoding it.
+type Config struct {
+	Width            int
+	Height           int
+	ColorComponents  int
+	BitsPerComponent int
+	ColorSpace       ColorSpace
+	ICCProfile       []byte
+	HasAlpha         bool
+	// Levels is the number of wavelet decomposition levels, i.e. the highest useful value
+	// of Options.Reduce.
+	Levels int
+}
+
+// channel is an image channel derived from a codestream component, possibly through a palette.
+type channel struct {
+	component     int
+	paletteColumn int
+	precision     int
+}
+
+// layout describes how the decoded components are mapped to the output image.
+type layout struct {
+	cs     *codestream
+	header *jp2Header
+	colors []channel
+	alpha  *channel
+	space  ColorSpace
+	icc    []byte
+	ycc    bool
+	bits   int
+	levels int
+}
+
+// parse parses a JP2 file or a raw codestream and determines the layout of the output image.
+func parse(data []byte) (*layout, error) {
+	l := &layout{}
+	codestream := data
+	if !isCodestream(data) {
+		h, err := parseJP2(data)
+		if err != nil {
+			return nil, err
+		}
+		l.header = h
+		codestream = h.codestream
+	}
+	cs, err := parseCodestream(codestream)
+	if err != nil {
+		return nil, err
+	}
+	l.cs = cs
+
+	l.levels = maxLevels
+	for _, t := range cs.tiles {
+		for _, s := range t.params.components {
+			if s != nil && s.levels < l.levels {
+				l.levels = s.levels
+			}
+		}
+	}
+	if err := l.mapChannels(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// mapChannels determines the color and alpha channels of the image from the component mapping,
+// palette and channel definitions of the JP2 header (section I.5.3).
+func (l *layout) mapChannels() error {
+	comps := l.cs.size.components
+	h := l.header
+	if h == nil {
+		h = &jp2Header{}
+	}
+
+	var channels []channel
+	if h.palette != nil && len(h.mapping) > 0 {
+		for _, m := range h.mapping {
+			if m.component >= len(comps) {
+				return fmt.Errorf("jpx: invalid component %d in component mapping", m.component)
+			}
+			ch := channel{component: m.component, paletteColumn: m.paletteColumn, precision: comps[m.component].precision}
+			if m.paletteColumn >= 0 {
+				if m.paletteColumn >= len(h.palette.precision) {
+					return fmt.Errorf("jpx: invalid palette column %d", m.paletteColumn)
+				}
+				ch.precision = h.palette.precision[m.paletteColumn]
+			}
+			channels = append(channels, ch)
+		}
+	} else {
+		for i, c := range comps {
+			channels = append(channels, channel{component: i, paletteColumn: -1, precision: c.precision})
+		}
+	}
+
+	l.icc = h.icc
+	switch h.enumCS {
+	case enumGray:
+		l.space = ColorSpaceGray
+	case enumSRGB:
+		l.space = ColorSpaceRGB
+	case enumSYCC:
+		l.space = ColorSpaceRGB
+		l.ycc = true
+	case enumCMYK:
+		l.space = ColorSpaceCMYK
+	}
+	if l.icc != nil {
+		l.space = iccColorSpace(l.icc)
+	}
+
+	if len(h.channels) > 0 {
+		var colors []channel
+		var assoc []int
+		for _, def := range h.channels {
+			if def.channel >= len(channels) {
+				return fmt.Errorf("jpx: invalid channel %d in channel definition", def.channel)
+			}
+			ch := channels[def.channel]
+			switch def.typ {
+			case 0:
+				// Keep the color channels ordered by their association.
+				i := len(assoc)
+				for i > 0 && assoc[i-1] > def.assoc {
+					i--
+				}
+				assoc = append(assoc[:i], append([]int{def.assoc}, assoc[i:]...)...)
+				colors = append(colors[:i], append([]channel{ch}, colors[i:]...)...)
+			case 1, 2:
+				if l.alpha == nil {
+					l.alpha = &ch
+				}
+			}
+		}
+		l.colors = colors
+	} else {
+		n := componentsOf(l.space)
+		if n == 0 {
+			switch len(channels) {
+			case 1, 2:
+				l.space, n = ColorSpaceGray, 1
+			case 3:
+				l.space, n = ColorSpaceRGB, 3
+			case 4:
+				l.space, n = ColorSpaceCMYK, 4
+			default:
+				n = len(channels)
+			}
+		}
+		if n > len(channels) {
+			return fmt.Errorf("jpx: %d channels for %d color components", len(channels), n)
+		}
+		l.colors = channels[:n]
+		if len(channels) == n+1 {
+			l.alpha = &channels[n]
+		}
+	}
+	if len(l.colors) == 0 {
+		return errors.New("jpx: no color channels")
+	}
+	if n := componentsOf(l.space); n != 0 && n != len(l.colors) {
+		l.space = ColorSpaceUnknown
+		l.icc = nil
+	}
+	if l.ycc && len(l.colors) != 3 {
+		l.ycc = false
+	}
+
+	l.bits = 8
+	for _, ch := range l.colors {
+		if ch.precision > 8 {
+			l.bits = 16
+		}
+	}
+	return nil
+}
+
+// componentsOf returns the number of color components of color space `cs`.
+func componentsOf(cs ColorSpace) int {
+	switch cs {
+	case ColorSpaceGray:
+		return 1
+	case ColorSpaceRGB:
+		return 3
+	case ColorSpaceCMYK:
+		return 4
+	}
+	return 0
+}
+
+// iccColorSpace returns the color space of an ICC profile based on the data color space field
+// of its header.
+func iccColorSpace(icc []byte) ColorSpace {
+	if len(icc) < 20 {
+		return ColorSpaceUnknown
+	}
+	switch string(icc[16:20]) {
+	case "GRAY":
+		return ColorSpaceGray
+	case "RGB ":
+		return ColorSpaceRGB
+	case "CMYK":
+		return ColorSpaceCMYK
+	}
+	return ColorSpaceUnknown
+}
+
+// DecodeConfig returns the dimensions and color information of a JPEG 2000 image in `data`
+// without decoding the image data. `data` may be a JP2 file or a raw codestream.
+func DecodeConfig(data []byte) (*Config, error) {
+	l, err := parse(data)
+	if err != nil {
+		return nil, err
+	}
+	s := &l.cs.size
+	return &Config{
+		Width:            s.x1 - s.x0,
+		Height:           s.y1 - s.y0,
+		ColorComponents:  len(l.colors),
+		BitsPerComponent: l.bits,
+		ColorSpace:       l.space,
+		ICCProfile:       l.icc,
+		HasAlpha:         l.alpha != nil,
+		Levels:           l.levels,
+	}, nil
+}
+
+// plane holds the decoded samples of a component at the decoded resolution.
+type plane struct {
+	x0, y0, w, h int
+	samples      []int32
+}
+
+// Decode decodes the JPEG 2000 image in `data`, which may be a JP2 file or a raw codestream.
+// The options `opts` may be nil.
+func Decode(data []byte, opts *Options) (*Image, error) {
+	l, err := parse(data)
+	if err != nil {
+		return nil, err
+	}
+	reduce := 0
+	if opts != nil && opts.Reduce > 0 {
+		reduce = minInt(opts.Reduce, l.levels)
+	}
+
+	s := &l.cs.size
+	width := ceilShift(s.x1, reduce) - ceilShift(s.x0, reduce)
+	height := ceilShift(s.y1, reduce) - ceilShift(s.y0, reduce)
+	numSamples := int64(0)
+	for _, c := range s.components {
+		w := ceilShift(ceilDiv(s.x1, c.dx), reduce) - ceilShift(ceilDiv(s.x0, c.dx), reduce)
+		h := ceilShift(ceilDiv(s.y1, c.dy), reduce) - ceilShift(ceilDiv(s.y0, c.dy), reduce)
+		numSamples += int64(w) * int64(h)
+	}
+	if numSamples+int64(width)*int64(height)*int64(len(l.colors)+1) > maxSamples {
+		return nil, errImageTooLarge
+	}
+
+	planes := make([]*plane, len(s.components))
+	for i, c := range s.components {
+		x0 := ceilShift(ceilDiv(s.x0, c.dx), reduce)
+		y0 := ceilShift(ceilDiv(s.y0, c.dy), reduce)
+		p := &plane{
+			x0: x0,
+			y0: y0,
+			w:  ceilShift(ceilDiv(s.x1, c.dx), reduce) - x0,
+			h:  ceilShift(ceilDiv(s.y1, c.dy), reduce) - y0,
+		}
+		p.samples = make([]int32, p.w*p.h)
+		planes[i] = p
+	}
+
+	for _, td := range l.cs.tiles {
+		t, err := newTile(s, td)
+		if err != nil {
+			return nil, err
+		}
+		t.readPackets(s, td.data)
+		t.decode(s, reduce, planes)
+	}
+	return l.render(planes, width, height, reduce), nil
+}
+
+// decode decodes the code-blocks of the tile, applies the inverse wavelet and component
+// transforms and stores the samples in `planes`.
+func (t *tile) decode(size *imageSize, reduce int, planes []*plane) {
+	samples := make([][]float32, len(t.components))
+	for c, tc := range t.components {
+		rmax := tc.style.levels - reduce
+		coeffs := make([][][]float32, rmax+1)
+		for r := 0; r <= rmax; r++ {
+			res := tc.resolutions[r]
+			coeffs[r] = make([][]float32, len(res.bands))
+			for i, b := range res.bands {
+				coeffs[r][i] = tc.decodeBand(b)
+			}
+		}
+		samples[c] = tc.reconstruct(rmax, coeffs)
+	}
+
+	if t.params.coding.mct && len(t.components) >= 3 {
+		n := len(samples[0])
+		if len(samples[1]) == n && len(samples[2]) == n {
+			if t.components[0].style.reversible {
+				inverseRCT(samples[0], samples[1], samples[2])
+			} else {
+				inverseICT(samples[0], samples[1], samples[2])
+			}
+		}
+	}
+
+	for c, tc := range t.components {
+		comp := size.components[c]
+		res := tc.resolutions[tc.style.levels-reduce]
+		p := planes[c]
+		// DC level shift (section G.1.2) and conversion of signed samples to unsigned.
+		shift := float32(int(1) << uint(comp.precision-1))
+		maxValue := float32(int(1)<<uint(comp.precision) - 1)
+		w := res.x1 - res.x0
+		for y := res.y0; y < res.y1; y++ {
+			py := y - p.y0
+			if py < 0 || py >= p.h {
+				continue
+			}
+			for x := res.x0; x < res.x1; x++ {
+				px := x - p.x0
+				if px < 0 || px >= p.w {
+					continue
+				}
+				v := samples[c][(y-res.y0)*w+x-res.x0] + shift
+				v = float32(math.Floor(float64(v) + 0.5))
+				if v < 0 {
+					v = 0
+				} else if v > maxValue {
+					v = maxValue
+				}
+				p.samples[py*p.w+px] = int32(v)
+			}
+		}
+	}
+}
+
+// decodeBand decodes the code-blocks of band `b` and returns its dequantized coefficients
+// (section E.1).
+func (tc *tileComponent) decodeBand(b *band) []float32 {
+	w := b.x1 - b.x0
+	out := make([]float32, w*(b.y1-b.y0))
+	scale := b.delta / 2
+	for _, prec := range b.precincts {
+		for _, cb := range prec.blocks {
+			if cb.passes == 0 {
+				continue
+			}
+			values := decodeCodeblock(cb, b.orient, tc.style.cbStyle, b.mb, tc.roiShift)
+			cw := cb.x1 - cb.x0
+			for y := cb.y0; y < cb.y1; y++ {
+				row := out[(y-b.y0)*w:]
+				src := values[(y-cb.y0)*cw:]
+				for x := cb.x0; x < cb.x1; x++ {
+					v := src[x-cb.x0]
+					if tc.style.reversible {
+						row[x-b.x0] = float32(v / 2)
+					} else {
+						row[x-b.x0] = float32(v) * scale
+					}
+				}
+			}
+		}
+	}
+	return out
+}
+
+// inverseRCT applies the inverse reversible component transform (section G.2.2).
+func inverseRCT(c0, c1, c2 []float32) {
+	for i := range c0 {
+		y0, y1, y2 := c0[i], c1[i], c2[i]
+		g := y0 - float32(math.Floor(float64(y1+y2)/4))
+		c0[i] = y2 + g
+		c1[i] = g
+		c2[i] = y1 + g
+	}
+}
+
+// inverseICT applies the inverse irreversible component transform (section G.3.2).
+func inverseICT(c0, c1, c2 []float32) {
+	for i := range c0 {
+		y, cb, cr := c0[i], c1[i], c2[i]
+		c0[i] = y + 1.402*cr
+		c1[i] = y - 0.34413*cb - 0.71414*cr
+		c2[i] = y + 1.772*cb
+	}
+}
+
+// render maps the decoded component planes to the color and alpha channels of the output
+// image, upsampling subsampled components.
+func (l *layout) render(planes []*plane, width, height, reduce int) *Image {
+	s := &l.cs.size
+	img := &Image{
+		Width:            width,
+		Height:           height,
+		BitsPerComponent: l.bits,
+		ColorComponents:  len(l.colors),
+		ColorSpace:       l.space,
+		ICCProfile:       l.icc,
+	}
+	bytesPerSample := l.bits / 8
+	maxOut := float64(int(1)<<uint(l.bits) - 1)
+	gx0, gy0 := ceilShift(s.x0, reduce), ceilShift(s.y0, reduce)
+
+	// values returns the samples of channel `ch` in the output grid at precision l.bits.
+	values := func(ch channel) []float64 {
+		comp := s.components[ch.component]
+		p := planes[ch.component]
+		out := make([]float64, width*height)
+		scale := maxOut / float64(int64(1)<<uint(ch.precision)-1)
+		var pal *palette
+		if ch.paletteColumn >= 0 && l.header != nil {
+			pal = l.header.palette
+		}
+		for y := 0; y < height; y++ {
+			py := minInt(maxInt((y+gy0)/comp.dy-p.y0, 0), p.h-1)
+			for x := 0; x < width; x++ {
+				px := minInt(maxInt((x+gx0)/comp.dx-p.x0, 0), p.w-1)
+				v := float64(p.samples[py*p.w+px])
+				if pal != nil {
+					e := minInt(int(v), pal.entries-1)
+					pv := pal.values[e][ch.paletteColumn]
+					if pal.signed[ch.paletteColumn] {
+						pv += 1 << uint(ch.precision-1)
+					}
+					v = float64(pv)
+				}
+				out[y*width+x] = v * scale
+			}
+		}
+		return out
+	}
+
+	channels := make([][]float64, len(l.colors))
+	for i, ch := range l.colors {
+		channels[i] = values(ch)
+	}
+	if l.ycc {
+		ycc2rgb(channels, maxOut)
+	}
+
+	pack := func(dst []byte, v float64, i int) {
+		v = math.Floor(v + 0.5)
+		if v < 0 {
+			v = 0
+		} else if v > maxOut {
+			v = maxOut
+		}
+		if bytesPerSample == 2 {
+			dst[2*i] = byte(int(v) >> 8)
+			dst[2*i+1] = byte(v)
+		} else {
+			dst[i] = byte(v)
+		}
+	}
+	n := len(channels)
+	img.Data = make([]byte, width*height*n*bytesPerSample)
+	for i := 0; i < width*height; i++ {
+		for c, ch := range channels {
+			pack(img.Data, ch[i], i*n+c)
+		}
+	}
+	if l.alpha != nil {
+		alpha := values(*l.alpha)
+		img.Alpha = make([]byte, width*height*bytesPerSample)
+		for i, v := range alpha {
+			pack(img.Alpha, v, i)
+		}
+	}
+	return img
+}
+
+// ycc2rgb converts sYCC samples with maximum value `maxValue` to RGB in place.
+func ycc2rgb(channels [][]float64, maxValue float64) {
+	offset := (maxValue + 1) / 2
+	for i := range channels[0] {
+		y, cb, cr := channels[0][i], channels[1][i]-offset, channels[2][i]-offset
+		channels[0][i] = y + 1.402*cr
+		channels[1][i] = y - 0.344136*cb - 0.714136*cr
+		channels[2][i] = y + 1.772*cb
+	}
+}
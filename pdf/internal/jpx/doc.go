@@ -0,0 +1,9 @@
+// Package jpx implements a decoder for JPEG 2000 images (ITU-T T.800 | ISO/IEC 15444-1)
+// as embedded in PDF files via the JPXDecode filter. Both raw codestreams and JP2 files
+// are supported.
+//
+// The decoder handles multiple tiles and components, all progression orders including
+// progression order changes, both wavelet transforms and multiple component transforms,
+// all code-block coding styles, palettes, channel definitions and decoding at reduced
+// resolution.
+package jpx
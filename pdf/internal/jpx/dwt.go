@@ -0,0 +1,144 @@
+package jpx
+
+import "math"
+
+// Lifting coefficients of the irreversible 9-7 filter (Table F.4).
+const (
+	liftAlpha = -1.586134342059924
+	liftBeta  = -0.052980118572961
+	liftGamma = 0.882911075530934
+	liftDelta = 0.443506852043971
+	liftK     = 1.230174104914001
+)
+
+// dwtPadding is the number of samples by which signals are extended on each side.
+const dwtPadding = 4
+
+// synthesize performs the one-dimensional inverse wavelet transform of the interleaved
+// signal `x` that starts at index `i0` in place (section F.3.6). `buf` is scratch space of
+// at least len(x)+2*dwtPadding samples.
+func synthesize(x []float32, i0 int, reversible bool, buf []float32) {
+	n := len(x)
+	if n == 0 {
+		return
+	}
+	if n == 1 {
+		if i0&1 != 0 {
+			if reversible {
+				x[0] = float32(int32(x[0]) / 2)
+			} else {
+				x[0] /= 2
+			}
+		}
+		return
+	}
+
+	// Periodic symmetric extension (section F.3.7).
+	period := 2 * (n - 1)
+	ext := buf[:n+2*dwtPadding]
+	for j := range ext {
+		k := (j - dwtPadding) % period
+		if k < 0 {
+			k += period
+		}
+		if k >= n {
+			k = period - k
+		}
+		ext[j] = x[k]
+	}
+
+	// first returns the first index in [1, len(ext)-1) of the given parity of the signal.
+	first := func(odd bool) int {
+		j := 1
+		if ((i0-dwtPadding+j)&1 != 0) != odd {
+			j++
+		}
+		return j
+	}
+	even, odd := first(false), first(true)
+	end := len(ext) - 1
+
+	if reversible {
+		for j := even; j < end; j += 2 {
+			ext[j] -= float32(math.Floor(float64(ext[j-1]+ext[j+1]+2) / 4))
+		}
+		for j := odd; j < end; j += 2 {
+			ext[j] += float32(math.Floor(float64(ext[j-1]+ext[j+1]) / 2))
+		}
+	} else {
+		for j := range ext {
+			if (i0-dwtPadding+j)&1 == 0 {
+				ext[j] *= liftK
+			} else {
+				ext[j] *= 1 / liftK
+			}
+		}
+		lift := func(start int, c float32) {
+			for j := start; j < end; j += 2 {
+				ext[j] -= c * (ext[j-1] + ext[j+1])
+			}
+		}
+		lift(even, liftDelta)
+		lift(odd, liftGamma)
+		lift(even, liftBeta)
+		lift(odd, liftAlpha)
+	}
+	copy(x, ext[dwtPadding:dwtPadding+n])
+}
+
+// reconstruct returns the samples of tile-component `tc` at resolution level `rmax`, given
+// the dequantized coefficients of the bands of resolution levels up to `rmax` (section F.3.2).
+func (tc *tileComponent) reconstruct(rmax int, coeffs [][][]float32) []float32 {
+	res := tc.resolutions[0]
+	a := coeffs[0][0]
+	reversible := tc.style.reversible
+	var buf []float32
+	for r := 1; r <= rmax; r++ {
+		prev := res
+		res = tc.resolutions[r]
+		w, h := res.x1-res.x0, res.y1-res.y0
+		out := make([]float32, w*h)
+
+		// Interleave the bands (section F.3.3).
+		place := func(src []float32, bx0, by0, bx1, by1, xo, yo int) {
+			bw := bx1 - bx0
+			for by := by0; by < by1; by++ {
+				y := 2*by + yo - res.y0
+				if y < 0 || y >= h {
+					continue
+				}
+				for bx := bx0; bx < bx1; bx++ {
+					x := 2*bx + xo - res.x0
+					if x < 0 || x >= w {
+						continue
+					}
+					out[y*w+x] = src[(by-by0)*bw+bx-bx0]
+				}
+			}
+		}
+		place(a, prev.x0, prev.y0, prev.x1, prev.y1, 0, 0)
+		for i, b := range res.bands {
+			xo, yo := b.orient&1, b.orient>>1
+			place(coeffs[r][i], b.x0, b.y0, b.x1, b.y1, xo, yo)
+		}
+
+		if n := maxInt(w, h) + 2*dwtPadding; len(buf) < n {
+			buf = make([]float32, n)
+		}
+		for y := 0; y < h; y++ {
+			synthesize(out[y*w:(y+1)*w], res.x0, reversible, buf)
+		}
+		col := make([]float32, h)
+		for x := 0; x < w; x++ {
+			for y := 0; y < h; y++ {
+				col[y] = out[y*w+x]
+			}
+			synthesize(col, res.y0, reversible, buf)
+			for y := 0; y < h; y++ {
+				out[y*w+x] = col[y]
+			}
+		}
+		a = out
+	}
+	return a
+}
@@ -0,0 +1,678 @@
+package jpx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+
+	"github.com/finalversus/doc/pdf/internal/mq"
+)
+
+// testParams are the coding parameters of the codestreams written by encodeTest.
+type testParams struct {
+	// Image area on the reference grid and tile size.
+	x0, y0, width, height int
+	tileW, tileH          int
+	levels                int
+	// Code-block size exponents and style.
+	xcb, ycb int
+	cbStyle  int
+	// Precinct size exponent of all resolution levels, 0 for the maximum precinct size.
+	pp          int
+	reversible  bool
+	mct         bool
+	layers      int
+	progression int
+}
+
+// encodeTest returns a codestream of the 8-bit components `comps` of an image with parameters
+// `p`. It is the counterpart of the decoder, used to test the decoding of code-blocks with
+// coded data: the forward component and wavelet transforms, the quantization, the coding passes
+// (Annex D) and the packets with their tag trees (Annex B) are computed from the geometry of
+// the decoder.
+func encodeTest(p testParams, comps [][]int) []byte {
+	var header bytes.Buffer
+	w := func(v ...interface{}) {
+		for _, x := range v {
+			binary.Write(&header, binary.BigEndian, x)
+		}
+	}
+	w(uint16(markerSOC))
+	w(uint16(markerSIZ), uint16(38+3*len(comps)), uint16(0))
+	w(uint32(p.x0+p.width), uint32(p.y0+p.height), uint32(p.x0), uint32(p.y0))
+	w(uint32(p.tileW), uint32(p.tileH), uint32(0), uint32(0))
+	w(uint16(len(comps)))
+	for range comps {
+		w([]byte{7, 1, 1})
+	}
+
+	scod := byte(0)
+	var precincts []byte
+	if p.pp > 0 {
+		scod = 1
+		for r := 0; r <= p.levels; r++ {
+			precincts = append(precincts, byte(p.pp<<4|p.pp))
+		}
+	}
+	mct := byte(0)
+	if p.mct {
+		mct = 1
+	}
+	transform := byte(0)
+	if p.reversible {
+		transform = 1
+	}
+	w(uint16(markerCOD), uint16(12+len(precincts)), scod, byte(p.progression), uint16(p.layers), mct)
+	w(byte(p.levels), byte(p.xcb-2), byte(p.ycb-2), byte(p.cbStyle), transform, precincts)
+
+	// The exponents leave room for the growth of the coefficients in the transforms, and the
+	// irreversible step sizes are 1/4 of the nominal range of the bands.
+	const guard = 2
+	numBands := 3*p.levels + 1
+	if p.reversible {
+		w(uint16(markerQCD), uint16(3+numBands), byte(guard<<5|quantNone))
+		for i := 0; i < numBands; i++ {
+			w(byte((9 + bandGain(i)) << 3))
+		}
+	} else {
+		w(uint16(markerQCD), uint16(3+2*numBands), byte(guard<<5|quantExpounded))
+		for i := 0; i < numBands; i++ {
+			w(uint16((10+bandGain(i))<<11 | 0x100))
+		}
+	}
+
+	// Parse the main header with empty tiles to compute the geometry.
+	nx, ny := ceilDiv(p.x0+p.width, p.tileW), ceilDiv(p.y0+p.height, p.tileH)
+	var empty bytes.Buffer
+	empty.Write(header.Bytes())
+	for i := 0; i < nx*ny; i++ {
+		binary.Write(&empty, binary.BigEndian, []uint16{markerSOT, 10, uint16(i)})
+		binary.Write(&empty, binary.BigEndian, uint32(14))
+		empty.Write([]byte{0, 1, 0xff, 0x93})
+	}
+	empty.Write([]byte{0xff, 0xd9})
+	cs, err := parseCodestream(empty.Bytes())
+	if err != nil {
+		panic(err)
+	}
+
+	out := header.Bytes()
+	for _, td := range cs.tiles {
+		t, err := newTile(&cs.size, td)
+		if err != nil {
+			panic(err)
+		}
+		data := t.encode(&cs.size, p, comps)
+		var b bytes.Buffer
+		binary.Write(&b, binary.BigEndian, []uint16{markerSOT, 10, uint16(td.index)})
+		binary.Write(&b, binary.BigEndian, uint32(14+len(data)))
+		b.Write([]byte{0, 1, 0xff, 0x93})
+		b.Write(data)
+		out = append(out, b.Bytes()...)
+	}
+	return append(out, 0xff, 0xd9)
+}
+
+// bandGain returns the log2 gain of band `i` in the order of the quantization step sizes.
+func bandGain(i int) int {
+	if i == 0 {
+		return 0
+	}
+	return [3]int{1, 1, 2}[(i-1)%3]
+}
+
+// encodedBlock holds the coding passes of a code-block.
+type encodedBlock struct {
+	zeroPlanes int
+	passes     int
+	// segments holds the coded data of each codeword segment and passEnds the number of passes
+	// at the end of each segment.
+	segments [][]byte
+	passEnds []int
+	// layers holds the number of passes included up to each layer.
+	layers []int
+	lblock int
+}
+
+// encode returns the packet data of the tile with the samples of `comps`.
+func (t *tile) encode(size *imageSize, p testParams, comps [][]int) []byte {
+	// Tile-component samples with DC level shift.
+	samples := make([][]float32, len(t.components))
+	for c, tc := range t.components {
+		w := tc.x1 - tc.x0
+		samples[c] = make([]float32, w*(tc.y1-tc.y0))
+		for y := tc.y0; y < tc.y1; y++ {
+			for x := tc.x0; x < tc.x1; x++ {
+				v := comps[c][(y-p.y0)*p.width+x-p.x0]
+				samples[c][(y-tc.y0)*w+x-tc.x0] = float32(v - 128)
+			}
+		}
+	}
+	if p.mct {
+		r, g, b := samples[0], samples[1], samples[2]
+		for i := range r {
+			if p.reversible {
+				r[i], g[i], b[i] = float32(math.Floor(float64(r[i]+2*g[i]+b[i])/4)), b[i]-g[i], r[i]-g[i]
+			} else {
+				r[i], g[i], b[i] = 0.299*r[i]+0.587*g[i]+0.114*b[i],
+					-0.16875*r[i]-0.33126*g[i]+0.5*b[i],
+					0.5*r[i]-0.41869*g[i]-0.08131*b[i]
+			}
+		}
+	}
+
+	pe := &packetEncoder{
+		blocks: map[*codeblock]*encodedBlock{},
+		trees:  map[*precinct][2]*tagTreeEncoder{},
+	}
+	for c, tc := range t.components {
+		coeffs := tc.analyze(samples[c])
+		for r, res := range tc.resolutions {
+			for i, b := range res.bands {
+				tc.encodeBand(b, coeffs[r][i], p, pe.blocks)
+			}
+		}
+	}
+
+	var out []byte
+	for _, pk := range t.packets(size) {
+		out = append(out, pe.writePacket(t, pk)...)
+	}
+	return out
+}
+
+// analyze performs the forward wavelet transform of the samples of `tc` and returns the
+// coefficients of each band of each resolution level (section F.4).
+func (tc *tileComponent) analyze(samples []float32) [][][]float32 {
+	levels := tc.style.levels
+	coeffs := make([][][]float32, levels+1)
+	a := samples
+	for r := levels; r >= 1; r-- {
+		res := tc.resolutions[r]
+		w, h := res.x1-res.x0, res.y1-res.y0
+		// The inverse transform synthesizes the rows first.
+		col := make([]float32, h)
+		for x := 0; x < w; x++ {
+			for y := 0; y < h; y++ {
+				col[y] = a[y*w+x]
+			}
+			col = analyze(col, res.y0, tc.style.reversible)
+			for y := 0; y < h; y++ {
+				a[y*w+x] = col[y]
+			}
+		}
+		for y := 0; y < h; y++ {
+			copy(a[y*w:(y+1)*w], analyze(a[y*w:(y+1)*w], res.x0, tc.style.reversible))
+		}
+
+		prev := tc.resolutions[r-1]
+		ll := make([]float32, (prev.x1-prev.x0)*(prev.y1-prev.y0))
+		coeffs[r] = make([][]float32, len(res.bands))
+		for i, b := range res.bands {
+			coeffs[r][i] = make([]float32, (b.x1-b.x0)*(b.y1-b.y0))
+		}
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				gx, gy := x+res.x0, y+res.y0
+				orient := gx&1 | (gy&1)<<1
+				bx, by := gx>>1, gy>>1
+				if orient == bandLL {
+					ll[(by-prev.y0)*(prev.x1-prev.x0)+bx-prev.x0] = a[y*w+x]
+					continue
+				}
+				b := res.bands[orient-1]
+				coeffs[r][orient-1][(by-b.y0)*(b.x1-b.x0)+bx-b.x0] = a[y*w+x]
+			}
+		}
+		a = ll
+	}
+	coeffs[0] = [][]float32{a}
+	return coeffs
+}
+
+// encodeBand quantizes the coefficients of band `b` and encodes its code-blocks.
+func (tc *tileComponent) encodeBand(b *band, coeffs []float32, p testParams, blocks map[*codeblock]*encodedBlock) {
+	w := b.x1 - b.x0
+	for _, prec := range b.precincts {
+		for _, cb := range prec.blocks {
+			cw, ch := cb.x1-cb.x0, cb.y1-cb.y0
+			q := make([]int32, cw*ch)
+			for y := cb.y0; y < cb.y1; y++ {
+				for x := cb.x0; x < cb.x1; x++ {
+					v := float64(coeffs[(y-b.y0)*w+x-b.x0])
+					if !tc.style.reversible {
+						v = math.Trunc(v / float64(b.delta))
+					}
+					q[(y-cb.y0)*cw+x-cb.x0] = int32(v)
+				}
+			}
+			blocks[cb] = encodeCodeblock(q, cw, ch, b.orient, p.cbStyle, b.mb, p.layers)
+		}
+	}
+}
+
+// t1Encoder encodes the coding passes of a code-block with the context modeling of the decoder.
+type t1Encoder struct {
+	*t1
+	mag []int32
+	neg []bool
+	enc *mq.Encoder
+}
+
+// encodeCodeblock encodes the quantized coefficients `q` of a `w` x `h` code-block with all its
+// bit-planes and distributes the passes over `layers` layers.
+func encodeCodeblock(q []int32, w, h, orient, cbStyle, mb, layers int) *encodedBlock {
+	e := &t1Encoder{
+		t1: &t1{
+			w:       w,
+			h:       h,
+			stride:  w + 2,
+			orient:  orient,
+			cbStyle: cbStyle,
+			flags:   make([]uint8, (w+2)*(h+2)),
+		},
+		mag: make([]int32, len(q)),
+		neg: make([]bool, len(q)),
+		enc: mq.NewEncoder(),
+	}
+	e.resetContexts()
+	var max int32
+	for i, v := range q {
+		e.mag[i], e.neg[i] = v, v < 0
+		if v < 0 {
+			e.mag[i] = -v
+		}
+		if e.mag[i] > max {
+			max = e.mag[i]
+		}
+	}
+	numPlanes := 0
+	for max>>uint(numPlanes) != 0 {
+		numPlanes++
+	}
+	if numPlanes > mb {
+		panic("jpx: too many bit-planes")
+	}
+	eb := &encodedBlock{zeroPlanes: mb - numPlanes, lblock: 3}
+	if numPlanes == 0 {
+		eb.layers = make([]int, layers)
+		return eb
+	}
+
+	eb.passes = 3*numPlanes - 2
+	for pass := 0; pass < eb.passes; pass++ {
+		plane := numPlanes - 1 - (pass+2)/3
+		switch passType(pass) {
+		case passSignificance:
+			e.significancePass(plane)
+		case passRefinement:
+			e.refinementPass(plane)
+		case passCleanup:
+			e.cleanupPass(plane)
+		}
+		if cbStyle&cbReset != 0 {
+			e.resetContexts()
+		}
+		if cbStyle&cbTermAll != 0 || pass == eb.passes-1 {
+			eb.segments = append(eb.segments, e.enc.Flush())
+			eb.passEnds = append(eb.passEnds, pass+1)
+			e.enc = mq.NewEncoder()
+		}
+	}
+	// The passes are distributed evenly over the layers.
+	for l := 1; l <= layers; l++ {
+		eb.layers = append(eb.layers, eb.passes*l/layers)
+	}
+	return eb
+}
+
+// bit returns the bit of the magnitude of the coefficient at flag index `i` at `plane`.
+func (e *t1Encoder) bit(i, plane int) int {
+	x, y := i%e.stride-1, i/e.stride-1
+	return int(e.mag[y*e.w+x]>>uint(plane)) & 1
+}
+
+// encodeSign encodes the sign of the coefficient at flag index `i` in row `y` and makes it
+// significant.
+func (e *t1Encoder) encodeSign(i, y int) {
+	f := e.flags
+	h := clampSign(signContribution(f[i-1]) + signContribution(f[i+1]))
+	v := signContribution(f[i-e.stride])
+	if e.cbStyle&cbCausal == 0 || y%4 != 3 {
+		v += signContribution(f[i+e.stride])
+	}
+	sc := signContexts[h+1][clampSign(v)+1]
+	x := i%e.stride - 1
+	neg := 0
+	if e.neg[y*e.w+x] {
+		neg = 1
+	}
+	e.enc.EncodeBit(e.cx[:], sc.ctx, neg^sc.xor)
+	f[i] |= flagSignificant
+	if neg != 0 {
+		f[i] |= flagNegative
+	}
+}
+
+// significancePass encodes a significance propagation pass.
+func (e *t1Encoder) significancePass(plane int) {
+	for y0 := 0; y0 < e.h; y0 += 4 {
+		for x := 0; x < e.w; x++ {
+			for y := y0; y < y0+4 && y < e.h; y++ {
+				i := (y+1)*e.stride + x + 1
+				if e.flags[i]&flagSignificant != 0 {
+					continue
+				}
+				h, v, d := e.neighbours(i, y)
+				if h+v+d == 0 {
+					continue
+				}
+				bit := e.bit(i, plane)
+				e.enc.EncodeBit(e.cx[:], ctxZC+e.zeroCodingContext(h, v, d), bit)
+				if bit == 1 {
+					e.encodeSign(i, y)
+				}
+				e.flags[i] |= flagVisited
+			}
+		}
+	}
+}
+
+// refinementPass encodes a magnitude refinement pass.
+func (e *t1Encoder) refinementPass(plane int) {
+	for y0 := 0; y0 < e.h; y0 += 4 {
+		for x := 0; x < e.w; x++ {
+			for y := y0; y < y0+4 && y < e.h; y++ {
+				i := (y+1)*e.stride + x + 1
+				f := e.flags[i]
+				if f&flagSignificant == 0 || f&flagVisited != 0 {
+					continue
+				}
+				ctx := ctxMR + 2
+				if f&flagRefined == 0 {
+					ctx = ctxMR
+					if h, v, d := e.neighbours(i, y); h+v+d > 0 {
+						ctx = ctxMR + 1
+					}
+				}
+				e.enc.EncodeBit(e.cx[:], ctx, e.bit(i, plane))
+				e.flags[i] |= flagRefined
+			}
+		}
+	}
+}
+
+// cleanupPass encodes a cleanup pass.
+func (e *t1Encoder) cleanupPass(plane int) {
+	for y0 := 0; y0 < e.h; y0 += 4 {
+		for x := 0; x < e.w; x++ {
+			y := y0
+			if y0+4 <= e.h && e.runLengthMode(x, y0) {
+				run := 0
+				for run < 4 && e.bit((y0+run+1)*e.stride+x+1, plane) == 0 {
+					run++
+				}
+				if run == 4 {
+					e.enc.EncodeBit(e.cx[:], ctxRL, 0)
+					continue
+				}
+				e.enc.EncodeBit(e.cx[:], ctxRL, 1)
+				e.enc.EncodeBit(e.cx[:], ctxUNI, run>>1)
+				e.enc.EncodeBit(e.cx[:], ctxUNI, run&1)
+				y += run
+				e.encodeSign((y+1)*e.stride+x+1, y)
+				y++
+			}
+			for ; y < y0+4 && y < e.h; y++ {
+				i := (y+1)*e.stride + x + 1
+				if e.flags[i]&(flagSignificant|flagVisited) != 0 {
+					continue
+				}
+				h, v, d := e.neighbours(i, y)
+				bit := e.bit(i, plane)
+				e.enc.EncodeBit(e.cx[:], ctxZC+e.zeroCodingContext(h, v, d), bit)
+				if bit == 1 {
+					e.encodeSign(i, y)
+				}
+			}
+		}
+	}
+	for i := range e.flags {
+		e.flags[i] &^= flagVisited
+	}
+	if e.cbStyle&cbSegSymbols != 0 {
+		for _, bit := range []int{1, 0, 1, 0} {
+			e.enc.EncodeBit(e.cx[:], ctxUNI, bit)
+		}
+	}
+}
+
+// bitWriter writes the bits of packet headers with bit stuffing after 0xFF bytes.
+type bitWriter struct {
+	data []byte
+	buf  byte
+	ct   int
+}
+
+// bit writes a single bit.
+func (bw *bitWriter) bit(b int) {
+	if bw.ct == 0 {
+		bw.ct = 8
+		if n := len(bw.data); n > 0 && bw.data[n-1] == 0xff {
+			bw.ct = 7
+		}
+		bw.data = append(bw.data, 0)
+	}
+	bw.ct--
+	bw.data[len(bw.data)-1] |= byte(b&1) << uint(bw.ct)
+}
+
+// bits writes the `n` lowest bits of `v`, most significant first.
+func (bw *bitWriter) bits(v, n int) {
+	for i := n - 1; i >= 0; i-- {
+		bw.bit(v >> uint(i))
+	}
+}
+
+// flush pads the last byte and adds a stuffed byte after a final 0xFF byte.
+func (bw *bitWriter) flush() []byte {
+	if n := len(bw.data); n > 0 && bw.data[n-1] == 0xff {
+		bw.data = append(bw.data, 0)
+	}
+	bw.ct = 0
+	return bw.data
+}
+
+// tagTreeEncoder encodes the values of the leaves of a tag tree.
+type tagTreeEncoder struct {
+	tree  *tagTree
+	known []bool
+}
+
+// newTagTreeEncoder returns an encoder of the `w` x `h` leaf values `values`.
+func newTagTreeEncoder(w, h int, values []int) *tagTreeEncoder {
+	t := newTagTree(w, h)
+	for i := range t.nodes {
+		t.nodes[i].value = tagTreeUnknown
+	}
+	for i, v := range values {
+		for j := i; j >= 0; j = t.nodes[j].parent {
+			if v < t.nodes[j].value {
+				t.nodes[j].value = v
+			}
+		}
+	}
+	return &tagTreeEncoder{tree: t, known: make([]bool, len(t.nodes))}
+}
+
+// encode writes the information needed to determine whether the value of the leaf at
+// (`x`, `y`) is less than `threshold` (section B.10.2).
+func (te *tagTreeEncoder) encode(bw *bitWriter, x, y, threshold int) {
+	t := te.tree
+	var path []int
+	for i := y*t.width + x; i >= 0; i = t.nodes[i].parent {
+		path = append(path, i)
+	}
+	low := 0
+	for k := len(path) - 1; k >= 0; k-- {
+		node := &t.nodes[path[k]]
+		if low > node.low {
+			node.low = low
+		} else {
+			low = node.low
+		}
+		for low < threshold {
+			if low >= node.value {
+				if !te.known[path[k]] {
+					bw.bit(1)
+					te.known[path[k]] = true
+				}
+				break
+			}
+			bw.bit(0)
+			low++
+		}
+		node.low = low
+	}
+}
+
+// packetEncoder writes the packets of a tile.
+type packetEncoder struct {
+	blocks map[*codeblock]*encodedBlock
+	// trees holds the inclusion and zero bit-plane tag trees of each precinct.
+	trees map[*precinct][2]*tagTreeEncoder
+}
+
+// writePacket returns the packet `pk` of tile `t`. The code-blocks of the tile record the
+// passes already written.
+func (pe *packetEncoder) writePacket(t *tile, pk packet) []byte {
+	blocks := pe.blocks
+	res := t.components[pk.comp].resolutions[pk.res]
+	bw := &bitWriter{}
+	var body []byte
+
+	empty := true
+	for _, b := range res.bands {
+		for _, cb := range b.precincts[pk.prec].blocks {
+			if eb := blocks[cb]; eb.layers[pk.layer] > cb.passes {
+				empty = false
+			}
+		}
+	}
+	if empty {
+		bw.bit(0)
+		return bw.flush()
+	}
+	bw.bit(1)
+
+	for _, b := range res.bands {
+		prec := b.precincts[pk.prec]
+		if len(prec.blocks) == 0 {
+			continue
+		}
+		trees, ok := pe.trees[prec]
+		if !ok {
+			inclusion := make([]int, len(prec.blocks))
+			zeroPlanes := make([]int, len(prec.blocks))
+			for i, cb := range prec.blocks {
+				eb := blocks[cb]
+				inclusion[i] = tagTreeUnknown
+				for l, n := range eb.layers {
+					if n > 0 {
+						inclusion[i] = l
+						break
+					}
+				}
+				zeroPlanes[i] = eb.zeroPlanes
+			}
+			trees[0] = newTagTreeEncoder(prec.cbw, prec.cbh, inclusion)
+			trees[1] = newTagTreeEncoder(prec.cbw, prec.cbh, zeroPlanes)
+			pe.trees[prec] = trees
+		}
+		inclusion, zeroPlanes := trees[0], trees[1]
+
+		for i, cb := range prec.blocks {
+			eb := blocks[cb]
+			x, y := i%prec.cbw, i/prec.cbw
+			newPasses := eb.layers[pk.layer] - cb.passes
+			if !cb.included {
+				inclusion.encode(bw, x, y, pk.layer+1)
+			} else {
+				bw.bit(boolBit(newPasses > 0))
+			}
+			if newPasses == 0 {
+				continue
+			}
+			if !cb.included {
+				zeroPlanes.encode(bw, x, y, eb.zeroPlanes+1)
+				cb.included = true
+			}
+			writeNumPasses(bw, newPasses)
+
+			// Lengths of the codeword segments of the new passes.
+			type part struct {
+				data   []byte
+				passes int
+			}
+			var parts []part
+			for s, end := range eb.passEnds {
+				start := 0
+				if s > 0 {
+					start = eb.passEnds[s-1]
+				}
+				first, last := maxInt(start, cb.passes), minInt(end, eb.layers[pk.layer])
+				if first >= last {
+					continue
+				}
+				// Without termination, the data of the single segment is split in proportion
+				// to the passes.
+				seg := eb.segments[s]
+				n := end - start
+				parts = append(parts, part{seg[len(seg)*(first-start)/n : len(seg)*(last-start)/n], last - first})
+			}
+			lblock := eb.lblock
+			for _, pt := range parts {
+				for len(pt.data) >= 1<<uint(lblock+floorLog2(pt.passes)) {
+					lblock++
+				}
+			}
+			for ; eb.lblock < lblock; eb.lblock++ {
+				bw.bit(1)
+			}
+			bw.bit(0)
+			for _, pt := range parts {
+				bw.bits(len(pt.data), eb.lblock+floorLog2(pt.passes))
+				body = append(body, pt.data...)
+			}
+			cb.passes += newPasses
+		}
+	}
+	return append(bw.flush(), body...)
+}
+
+// writeNumPasses writes the number of new coding passes of a code-block (Table B.4).
+func writeNumPasses(bw *bitWriter, n int) {
+	switch {
+	case n == 1:
+		bw.bit(0)
+	case n == 2:
+		bw.bits(2, 2)
+	case n <= 5:
+		bw.bits(3, 2)
+		bw.bits(n-3, 2)
+	case n <= 36:
+		bw.bits(0xf, 4)
+		bw.bits(n-6, 5)
+	default:
+		bw.bits(0x1ff, 9)
+		bw.bits(n-37, 7)
+	}
+}
+
+// boolBit returns 1 for true and 0 for false.
+func boolBit(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
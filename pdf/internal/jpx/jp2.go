@@ -0,0 +1,215 @@
+package jpx
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// ColorSpace identifies the color space of a decoded image.
+type ColorSpace int
+
+// Color spaces of decoded images.
+const (
+	// ColorSpaceUnknown is reported when the file does not specify a color space that can be
+	// mapped to a PDF device color space, e.g. a raw codestream with an unusual number of components.
+	ColorSpaceUnknown ColorSpace = iota
+	ColorSpaceGray
+	ColorSpaceRGB
+	ColorSpaceCMYK
+)
+
+// Enumerated color spaces of the JP2 colour specification box (Table I.10).
+const (
+	enumCMYK = 12
+	enumSRGB = 16
+	enumGray = 17
+	enumSYCC = 18
+)
+
+// Box types of the JP2 file format (Annex I).
+const (
+	boxSignature       = 0x6a502020 // 'jP  '
+	boxFileType        = 0x66747970 // 'ftyp'
+	boxHeader          = 0x6a703268 // 'jp2h'
+	boxImageHeader     = 0x69686472 // 'ihdr'
+	boxColour          = 0x636f6c72 // 'colr'
+	boxPalette         = 0x70636c72 // 'pclr'
+	boxComponentMap    = 0x636d6170 // 'cmap'
+	boxChannelDef      = 0x63646566 // 'cdef'
+	boxContiguousCodes = 0x6a703263 // 'jp2c'
+)
+
+// jp2Signature is the content of the JP2 signature box.
+var jp2Signature = []byte{0x0d, 0x0a, 0x87, 0x0a}
+
+// palette is the content of a palette box (section I.5.3.4).
+type palette struct {
+	entries   int
+	precision []int
+	signed    []bool
+	// values holds the palette entries, values[entry][column].
+	values [][]int
+}
+
+// componentMapping is an entry of the component mapping box (section I.5.3.5).
+type componentMapping struct {
+	component int
+	// paletteColumn is the palette column used for the component or -1 for direct use.
+	paletteColumn int
+}
+
+// channelDefinition is an entry of the channel definition box (section I.5.3.6).
+type channelDefinition struct {
+	channel int
+	typ     int
+	assoc   int
+}
+
+// jp2Header holds the information of a JP2 file that is relevant for decoding.
+type jp2Header struct {
+	enumCS     int
+	icc        []byte
+	palette    *palette
+	mapping    []componentMapping
+	channels   []channelDefinition
+	codestream []byte
+}
+
+// isCodestream returns true if `data` starts with a SOC marker followed by a SIZ marker.
+func isCodestream(data []byte) bool {
+	return len(data) >= 4 && data[0] == 0xff && data[1] == 0x4f && data[2] == 0xff && data[3] == 0x51
+}
+
+// parseJP2 parses the boxes of a JP2 file.
+func parseJP2(data []byte) (*jp2Header, error) {
+	h := &jp2Header{}
+	seenSignature := false
+	err := walkBoxes(data, func(typ uint32, content []byte) error {
+		switch typ {
+		case boxSignature:
+			if !bytes.Equal(content, jp2Signature) {
+				return errors.New("jpx: invalid JP2 signature box")
+			}
+			seenSignature = true
+		case boxHeader:
+			return walkBoxes(content, h.parseHeaderBox)
+		case boxContiguousCodes:
+			if h.codestream == nil {
+				h.codestream = content
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !seenSignature {
+		return nil, errors.New("jpx: missing JP2 signature box")
+	}
+	if h.codestream == nil {
+		return nil, errors.New("jpx: missing contiguous codestream box")
+	}
+	return h, nil
+}
+
+// walkBoxes calls `fn` with the type and content of each box in `data` (section I.4).
+func walkBoxes(data []byte, fn func(typ uint32, content []byte) error) error {
+	r := newByteReader(data)
+	for r.remaining() > 0 {
+		length := uint64(r.u32())
+		typ := r.u32()
+		header := 8
+		switch length {
+		case 0:
+			length = uint64(r.remaining() + header)
+		case 1:
+			hi, lo := r.u32(), r.u32()
+			length = uint64(hi)<<32 | uint64(lo)
+			header = 16
+		}
+		if r.err != nil {
+			return r.err
+		}
+		if length < uint64(header) || length-uint64(header) > uint64(r.remaining()) {
+			return fmt.Errorf("jpx: invalid length %d of box %08x", length, typ)
+		}
+		content := r.bytes(int(length) - header)
+		if err := fn(typ, content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseHeaderBox parses a box nested in the JP2 header box.
+func (h *jp2Header) parseHeaderBox(typ uint32, content []byte) error {
+	r := newByteReader(content)
+	switch typ {
+	case boxColour:
+		meth := r.u8()
+		r.u8() // Precedence.
+		r.u8() // Approximation.
+		if r.err != nil {
+			return r.err
+		}
+		// Only the first colour specification box is used (section I.5.3.3).
+		if h.enumCS != 0 || h.icc != nil {
+			return nil
+		}
+		switch meth {
+		case 1:
+			h.enumCS = int(r.u32())
+		case 2, 3:
+			h.icc = content[3:]
+		}
+		return r.err
+	case boxPalette:
+		p := &palette{entries: r.u16()}
+		columns := r.u8()
+		if r.err == nil && (p.entries == 0 || columns == 0) {
+			return errors.New("jpx: invalid palette")
+		}
+		for i := 0; i < columns; i++ {
+			b := r.u8()
+			p.precision = append(p.precision, b&0x7f+1)
+			p.signed = append(p.signed, b&0x80 != 0)
+		}
+		p.values = make([][]int, p.entries)
+		for e := range p.values {
+			p.values[e] = make([]int, columns)
+			for c := 0; c < columns; c++ {
+				n := (p.precision[c] + 7) / 8
+				v := 0
+				for _, b := range r.bytes(n) {
+					v = v<<8 | int(b)
+				}
+				if p.signed[c] && v >= 1<<uint(p.precision[c]-1) {
+					v -= 1 << uint(p.precision[c])
+				}
+				p.values[e][c] = v
+			}
+		}
+		if r.err != nil {
+			return r.err
+		}
+		h.palette = p
+	case boxComponentMap:
+		for r.remaining() >= 4 {
+			cmp := r.u16()
+			mtyp := r.u8()
+			pcol := r.u8()
+			if mtyp == 0 {
+				pcol = -1
+			}
+			h.mapping = append(h.mapping, componentMapping{component: cmp, paletteColumn: pcol})
+		}
+	case boxChannelDef:
+		n := r.u16()
+		for i := 0; i < n; i++ {
+			h.channels = append(h.channels, channelDefinition{channel: r.u16(), typ: r.u16(), assoc: r.u16()})
+		}
+		return r.err
+	}
+	return nil
+}
@@ -0,0 +1,306 @@
+package jpx
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"testing"
+)
+
+// TestTagTree decodes the value of a single node tag tree with increasing thresholds.
+func TestTagTree(t *testing.T) {
+	// Bits 0 0 1: the value is not less than 1, then it is 2.
+	br := &bitReader{data: []byte{0x20}}
+	tree := newTagTree(1, 1)
+	if tree.decode(br, 0, 0, 1) {
+		t.Fatalf("value less than 1")
+	}
+	if !tree.decode(br, 0, 0, 3) {
+		t.Fatalf("value not less than 3")
+	}
+	if v := tree.nodes[0].value; v != 2 {
+		t.Fatalf("value %d, expected 2", v)
+	}
+	if br.pos != 1 || br.ct != 5 {
+		t.Fatalf("read %d bytes with %d bits left, expected 1 byte with 5 bits left", br.pos, br.ct)
+	}
+}
+
+// TestSynthesize checks that the inverse wavelet transforms invert the forward transforms
+// for signals of various lengths and origins.
+func TestSynthesize(t *testing.T) {
+	for _, reversible := range []bool{true, false} {
+		for n := 1; n < 12; n++ {
+			for i0 := 0; i0 < 3; i0++ {
+				x := make([]float32, n)
+				for i := range x {
+					x[i] = float32((i*37+11)%61 - 30)
+				}
+				y := analyze(x, i0, reversible)
+				synthesize(y, i0, reversible, make([]float32, n+2*dwtPadding))
+				for i := range x {
+					if d := math.Abs(float64(y[i] - x[i])); reversible && d != 0 || d > 1e-3 {
+						t.Fatalf("reversible=%t n=%d i0=%d: sample %d is %v, expected %v", reversible, n, i0, i, y[i], x[i])
+					}
+				}
+			}
+		}
+	}
+}
+
+// analyze performs the forward wavelet transform of `x` starting at index `i0` (section F.4.8).
+func analyze(x []float32, i0 int, reversible bool) []float32 {
+	n := len(x)
+	y := append([]float32(nil), x...)
+	if n == 1 {
+		if i0&1 != 0 {
+			y[0] *= 2
+		}
+		return y
+	}
+	period := 2 * (n - 1)
+	ext := make([]float32, n+2*dwtPadding)
+	for j := range ext {
+		k := (j - dwtPadding) % period
+		if k < 0 {
+			k += period
+		}
+		if k >= n {
+			k = period - k
+		}
+		ext[j] = x[k]
+	}
+	isOdd := func(j int) bool { return (i0-dwtPadding+j)&1 != 0 }
+	lift := func(odd bool, f func(l, r float32) float32) {
+		for j := 1; j < len(ext)-1; j++ {
+			if isOdd(j) == odd {
+				ext[j] += f(ext[j-1], ext[j+1])
+			}
+		}
+	}
+	if reversible {
+		lift(true, func(l, r float32) float32 { return -float32(math.Floor(float64(l+r) / 2)) })
+		lift(false, func(l, r float32) float32 { return float32(math.Floor(float64(l+r+2) / 4)) })
+	} else {
+		lift(true, func(l, r float32) float32 { return liftAlpha * (l + r) })
+		lift(false, func(l, r float32) float32 { return liftBeta * (l + r) })
+		lift(true, func(l, r float32) float32 { return liftGamma * (l + r) })
+		lift(false, func(l, r float32) float32 { return liftDelta * (l + r) })
+		for j := range ext {
+			if isOdd(j) {
+				ext[j] *= liftK
+			} else {
+				ext[j] /= liftK
+			}
+		}
+	}
+	copy(y, ext[dwtPadding:dwtPadding+n])
+	return y
+}
+
+// TestDecodeEmptyPackets decodes a codestream of a gray image with an alpha channel whose
+// packets are all empty, which yields mid-gray samples.
+func TestDecodeEmptyPackets(t *testing.T) {
+	data := testCodestream(5, 3, 2)
+
+	cfg, err := DecodeConfig(data)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if cfg.Width != 5 || cfg.Height != 3 || cfg.ColorComponents != 1 || cfg.ColorSpace != ColorSpaceGray ||
+		!cfg.HasAlpha || cfg.Levels != 1 {
+		t.Fatalf("unexpected config %+v", cfg)
+	}
+
+	for reduce, size := range [][2]int{{5, 3}, {3, 2}} {
+		img, err := Decode(data, &Options{Reduce: reduce})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if img.Width != size[0] || img.Height != size[1] || img.BitsPerComponent != 8 {
+			t.Fatalf("reduce %d: image %dx%d with %d bits, expected %dx%d with 8 bits",
+				reduce, img.Width, img.Height, img.BitsPerComponent, size[0], size[1])
+		}
+		expected := bytes.Repeat([]byte{0x80}, size[0]*size[1])
+		if !bytes.Equal(img.Data, expected) || !bytes.Equal(img.Alpha, expected) {
+			t.Fatalf("reduce %d: unexpected samples % x, alpha % x", reduce, img.Data, img.Alpha)
+		}
+	}
+}
+
+// TestDecodeJP2Palette decodes a JP2 file with a palette mapping the single component to RGB.
+func TestDecodeJP2Palette(t *testing.T) {
+	var header bytes.Buffer
+	writeBox(&header, boxImageHeader, []byte{0, 0, 0, 2, 0, 0, 0, 2, 0, 1, 7, 7, 0, 0})
+	writeBox(&header, boxColour, []byte{1, 0, 0, 0, 0, 0, enumSRGB})
+	pclr := []byte{0, 129, 3, 7, 7, 7}
+	for i := 0; i < 129; i++ {
+		pclr = append(pclr, byte(i), 0x10, 0xff-byte(i))
+	}
+	writeBox(&header, boxPalette, pclr)
+	writeBox(&header, boxComponentMap, []byte{0, 0, 1, 0, 0, 0, 1, 1, 0, 0, 1, 2})
+
+	var file bytes.Buffer
+	writeBox(&file, boxSignature, jp2Signature)
+	writeBox(&file, boxFileType, []byte("jp2 \x00\x00\x00\x00jp2 "))
+	writeBox(&file, boxHeader, header.Bytes())
+	writeBox(&file, boxContiguousCodes, testCodestream(2, 2, 1))
+
+	img, err := Decode(file.Bytes(), nil)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if img.ColorSpace != ColorSpaceRGB || img.ColorComponents != 3 || img.Alpha != nil {
+		t.Fatalf("unexpected image %+v", img)
+	}
+	expected := bytes.Repeat([]byte{0x80, 0x10, 0x7f}, 4)
+	if !bytes.Equal(img.Data, expected) {
+		t.Fatalf("samples % x, expected % x", img.Data, expected)
+	}
+}
+
+// TestDecodeCoded decodes codestreams with coded data written by encodeTest and compares the
+// samples with the encoded ones, which are exact with the reversible transforms.
+func TestDecodeCoded(t *testing.T) {
+	const (
+		width  = 37
+		height = 29
+	)
+	for _, c := range []struct {
+		name          string
+		numComponents int
+		params        testParams
+	}{
+		{"gray", 1, testParams{width: width, height: height, tileW: 64, tileH: 64, levels: 2,
+			xcb: 3, ycb: 3, reversible: true, layers: 1, progression: progressionLRCP}},
+		{"tiles RCT", 3, testParams{x0: 3, y0: 5, width: width, height: height, tileW: 16, tileH: 16,
+			levels: 3, xcb: 3, ycb: 2, pp: 3, reversible: true, mct: true, layers: 3,
+			progression: progressionRLCP}},
+		{"code-block styles", 1, testParams{x0: 1, y0: 2, width: width, height: height, tileW: 24, tileH: 20,
+			levels: 2, xcb: 2, ycb: 3, cbStyle: cbReset | cbTermAll | cbCausal | cbSegSymbols,
+			reversible: true, layers: 2, progression: progressionPCRL}},
+		{"9-7 ICT", 3, testParams{width: width, height: height, tileW: 32, tileH: 16, levels: 2,
+			xcb: 3, ycb: 3, mct: true, layers: 2, progression: progressionRPCL}},
+		{"9-7 alpha", 2, testParams{x0: 2, y0: 1, width: width, height: height, tileW: 20, tileH: 20,
+			levels: 1, xcb: 4, ycb: 2, pp: 4, layers: 1, progression: progressionCPRL}},
+	} {
+		comps := testImage(width, height, c.numComponents)
+		img, err := Decode(encodeTest(c.params, comps), nil)
+		if err != nil {
+			t.Fatalf("%s: Error: %v", c.name, err)
+		}
+		if img.Width != width || img.Height != height || img.BitsPerComponent != 8 {
+			t.Fatalf("%s: image %dx%d with %d bits", c.name, img.Width, img.Height, img.BitsPerComponent)
+		}
+		maxDiff := 0
+		if !c.params.reversible {
+			maxDiff = 2
+		}
+		n := img.ColorComponents
+		for i := 0; i < width*height; i++ {
+			for k, comp := range comps {
+				var v byte
+				if k < n {
+					v = img.Data[i*n+k]
+				} else {
+					v = img.Alpha[i]
+				}
+				if d := int(v) - comp[i]; d > maxDiff || d < -maxDiff {
+					t.Fatalf("%s: component %d sample %d,%d is %d, expected %d", c.name, k, i%width, i/width,
+						v, comp[i])
+				}
+			}
+		}
+	}
+}
+
+// TestDecodeJP2File decodes a JP2 file written by another encoder: a 400x300 RGB photograph
+// with an ICC profile, coded with 5 decomposition levels of the reversible transform, the
+// reversible component transform, 64x64 code-blocks and 12 quality layers in LRCP order.
+// testdata/relax.jp2 is testdata/jp2.jp2 of github.com/gabriel-vasile/mimetype (MIT license).
+func TestDecodeJP2File(t *testing.T) {
+	data, err := os.ReadFile("testdata/relax.jp2")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	for _, c := range []struct {
+		reduce        int
+		width, height int
+		first, last   []byte
+		hash          string
+	}{
+		{0, 400, 300, []byte{51, 58, 49}, []byte{19, 59, 30},
+			"fcdb976a6ae6ddc7d7d6261b69fb344d253a9e4a2cff2395f3d81109b7a7fdbc"},
+		{2, 100, 75, []byte{39, 46, 37}, []byte{19, 59, 30},
+			"1f1c1b01dd501723e84bee5c33776496dfd3defa7afd3fce8f7e4e3df5909aab"},
+	} {
+		img, err := Decode(data, &Options{Reduce: c.reduce})
+		if err != nil {
+			t.Fatalf("reduce %d: Error: %v", c.reduce, err)
+		}
+		if img.Width != c.width || img.Height != c.height || img.ColorSpace != ColorSpaceRGB ||
+			img.ColorComponents != 3 || img.BitsPerComponent != 8 || img.Alpha != nil || len(img.ICCProfile) == 0 {
+			t.Fatalf("reduce %d: unexpected image %dx%d, %d components", c.reduce, img.Width, img.Height,
+				img.ColorComponents)
+		}
+		if first, last := img.Data[:3], img.Data[len(img.Data)-3:]; !bytes.Equal(first, c.first) ||
+			!bytes.Equal(last, c.last) {
+			t.Fatalf("reduce %d: first pixel % x, last pixel % x", c.reduce, first, last)
+		}
+		if hash := fmt.Sprintf("%x", sha256.Sum256(img.Data)); hash != c.hash {
+			t.Fatalf("reduce %d: samples hash %s, expected %s", c.reduce, hash, c.hash)
+		}
+	}
+}
+
+// testImage returns `numComponents` components of a `width` x `height` test image with smooth
+// gradients and texture.
+func testImage(width, height, numComponents int) [][]int {
+	comps := make([][]int, numComponents)
+	for c := range comps {
+		comps[c] = make([]int, width*height)
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				v := 40 + 3*x + 2*y + 60*c + (x*y*(c+3))%23 + 40*((x/5+y/7+c)%2)
+				comps[c][y*width+x] = v % 256
+			}
+		}
+	}
+	return comps
+}
+
+// testCodestream returns a codestream of a `width` x `height` image with `numComponents`
+// 8-bit components, one decomposition level of the reversible transform and empty packets.
+func testCodestream(width, height, numComponents int) []byte {
+	var b bytes.Buffer
+	w := func(v ...interface{}) {
+		for _, x := range v {
+			binary.Write(&b, binary.BigEndian, x)
+		}
+	}
+	w(uint16(markerSOC))
+	w(uint16(markerSIZ), uint16(38+3*numComponents), uint16(0))
+	w(uint32(width), uint32(height), uint32(0), uint32(0))
+	w(uint32(width), uint32(height), uint32(0), uint32(0))
+	w(uint16(numComponents))
+	for i := 0; i < numComponents; i++ {
+		w([]byte{7, 1, 1})
+	}
+	w(uint16(markerCOD), uint16(12), []byte{0, progressionLRCP, 0, 1, 0, 1, 4, 4, 0, 1})
+	w(uint16(markerQCD), uint16(7), []byte{0x40, 8 << 3, 9 << 3, 9 << 3, 10 << 3})
+	numPackets := 2 * numComponents
+	w(uint16(markerSOT), uint16(10), uint16(0), uint32(14+numPackets), []byte{0, 1})
+	w(uint16(markerSOD), make([]byte, numPackets))
+	w(uint16(markerEOC))
+	return b.Bytes()
+}
+
+// writeBox writes a JP2 box of type `typ` with content `data`.
+func writeBox(w *bytes.Buffer, typ uint32, data []byte) {
+	binary.Write(w, binary.BigEndian, uint32(8+len(data)))
+	binary.Write(w, binary.BigEndian, typ)
+	w.Write(data)
+}
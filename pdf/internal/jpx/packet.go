@@ -0,0 +1,256 @@
+package jpx
+
+import (
+	"errors"
+	"math"
+	"sort"
+
+	"github.com/finalversus/doc/common"
+)
+
+// packet identifies a packet by its layer, resolution level, component and precinct.
+type packet struct {
+	layer, res, comp, prec int
+}
+
+// packets returns the packets of the tile in the order of the progression, taking
+// progression order changes into account (section B.12).
+func (t *tile) packets(size *imageSize) []packet {
+	p := t.params
+	changes := p.poc
+	if len(changes) == 0 {
+		changes = []progressionChange{{
+			resEnd:   maxLevels + 1,
+			compEnd:  len(t.components),
+			layerEnd: p.coding.layers,
+			order:    p.coding.progression,
+		}}
+	}
+
+	// next holds the next layer of each precinct, indexed by component, resolution and precinct.
+	next := make([][][]int, len(t.components))
+	for c, tc := range t.components {
+		next[c] = make([][]int, len(tc.resolutions))
+		for r, res := range tc.resolutions {
+			next[c][r] = make([]int, res.pw*res.ph)
+		}
+	}
+
+	var packets []packet
+	for _, change := range changes {
+		type entry struct {
+			packet
+			key [5]int
+		}
+		var entries []entry
+		layers := minInt(change.layerEnd, p.coding.layers)
+		for c := change.compStart; c < change.compEnd && c < len(t.components); c++ {
+			tc := t.components[c]
+			comp := size.components[c]
+			for r := change.resStart; r < change.resEnd && r < len(tc.resolutions); r++ {
+				res := tc.resolutions[r]
+				n := uint(tc.style.levels - r)
+				for k := 0; k < res.pw*res.ph; k++ {
+					// Position of the precinct on the reference grid.
+					x, y := t.x0, t.y0
+					if px := (res.x0>>uint(res.ppx) + k%res.pw) << uint(res.ppx); px > res.x0 {
+						x = px * comp.dx << n
+					}
+					if py := (res.y0>>uint(res.ppy) + k/res.pw) << uint(res.ppy); py > res.y0 {
+						y = py * comp.dy << n
+					}
+					for l := 0; l < layers; l++ {
+						e := entry{packet: packet{layer: l, res: r, comp: c, prec: k}}
+						switch change.order {
+						case progressionLRCP:
+							e.key = [5]int{l, r, c, k}
+						case progressionRLCP:
+							e.key = [5]int{r, l, c, k}
+						case progressionRPCL:
+							e.key = [5]int{r, y, x, c, l}
+						case progressionPCRL:
+							e.key = [5]int{y, x, c, r, l}
+						case progressionCPRL:
+							e.key = [5]int{c, y, x, r, l}
+						}
+						entries = append(entries, e)
+					}
+				}
+			}
+		}
+		sort.SliceStable(entries, func(i, j int) bool {
+			a, b := entries[i].key, entries[j].key
+			for k := range a {
+				if a[k] != b[k] {
+					return a[k] < b[k]
+				}
+			}
+			return false
+		})
+		for _, e := range entries {
+			n := &next[e.comp][e.res][e.prec]
+			if e.layer < *n {
+				continue
+			}
+			*n = e.layer + 1
+			packets = append(packets, e.packet)
+		}
+	}
+	return packets
+}
+
+// readPackets reads the packets of the tile from its data and assigns the coded data to the
+// code-blocks. Decoding stops without an error at the first packet that cannot be read, so
+// that truncated codestreams yield the data decoded so far.
+func (t *tile) readPackets(size *imageSize, data []byte) {
+	pos := 0
+	for _, pk := range t.packets(size) {
+		if pos >= len(data) {
+			common.Log.Debug("jpx: tile %d: data ends before all packets are read", t.index)
+			return
+		}
+		n, err := t.readPacket(data, pos, pk)
+		if err != nil {
+			common.Log.Debug("jpx: tile %d: %v", t.index, err)
+			return
+		}
+		pos = n
+	}
+}
+
+// contribution is the data of a codeword segment contained in a packet.
+type contribution struct {
+	seg    *segment
+	length int
+}
+
+// readPacket reads the packet `pk` starting at `pos` in `data` and returns the position after
+// the packet (section B.10).
+func (t *tile) readPacket(data []byte, pos int, pk packet) (int, error) {
+	coding := &t.params.coding
+	tc := t.components[pk.comp]
+	res := tc.resolutions[pk.res]
+
+	if coding.sop && pos+6 <= len(data) && data[pos] == 0xff && data[pos+1] == 0x91 {
+		pos += 6
+	}
+	br := &bitReader{data: data, pos: pos}
+	var contributions []contribution
+	if br.bit() == 1 {
+		for _, b := range res.bands {
+			prec := b.precincts[pk.prec]
+			for i, cb := range prec.blocks {
+				x, y := i%prec.cbw, i/prec.cbw
+				var included bool
+				if !cb.included {
+					included = prec.inclusion.decode(br, x, y, pk.layer+1)
+				} else {
+					included = br.bit() == 1
+				}
+				if !included {
+					continue
+				}
+				if !cb.included {
+					k := 1
+					for !prec.zeroPlanes.decode(br, x, y, k) {
+						if k++; k > 64 || br.err != nil {
+							return 0, errors.New("jpx: invalid number of zero bit-planes")
+						}
+					}
+					cb.zeroPlanes = k - 1
+					cb.included = true
+					cb.lblock = 3
+				}
+
+				newPasses := readNumPasses(br)
+				for br.bit() == 1 {
+					if cb.lblock++; cb.lblock > 32 {
+						return 0, errors.New("jpx: invalid code-block length indicator")
+					}
+				}
+
+				for remaining := newPasses; remaining > 0; {
+					var seg *segment
+					if n := len(cb.segments); n > 0 && cb.segments[n-1].passes < cb.segments[n-1].maxPasses {
+						seg = cb.segments[n-1]
+					} else {
+						seg = &segment{maxPasses: segmentCapacity(tc.style.cbStyle, cb.passes)}
+						cb.segments = append(cb.segments, seg)
+					}
+					k := minInt(remaining, seg.maxPasses-seg.passes)
+					length := br.bits(cb.lblock + floorLog2(k))
+					contributions = append(contributions, contribution{seg: seg, length: length})
+					seg.passes += k
+					cb.passes += k
+					remaining -= k
+				}
+				if br.err != nil {
+					return 0, br.err
+				}
+			}
+		}
+	}
+	br.align()
+	if br.err != nil {
+		return 0, br.err
+	}
+	pos = br.pos
+	if coding.eph && pos+2 <= len(data) && data[pos] == 0xff && data[pos+1] == 0x92 {
+		pos += 2
+	}
+
+	for _, c := range contributions {
+		if pos+c.length > len(data) {
+			c.seg.data = append(c.seg.data, data[pos:]...)
+			return len(data), nil
+		}
+		c.seg.data = append(c.seg.data, data[pos:pos+c.length]...)
+		pos += c.length
+	}
+	return pos, nil
+}
+
+// readNumPasses reads the number of new coding passes of a code-block (Table B.4).
+func readNumPasses(br *bitReader) int {
+	if br.bit() == 0 {
+		return 1
+	}
+	if br.bit() == 0 {
+		return 2
+	}
+	if v := br.bits(2); v < 3 {
+		return 3 + v
+	}
+	if v := br.bits(5); v < 31 {
+		return 6 + v
+	}
+	return 37 + br.bits(7)
+}
+
+// segmentCapacity returns the maximum number of coding passes of the codeword segment that
+// starts with pass `pass` of a code-block with style `cbStyle` (section D.4.1).
+func segmentCapacity(cbStyle, pass int) int {
+	switch {
+	case cbStyle&cbTermAll != 0:
+		return 1
+	case cbStyle&cbBypass != 0:
+		if pass < 10 {
+			return 10 - pass
+		}
+		if passType(pass) == passSignificance {
+			return 2
+		}
+		return 1
+	}
+	return math.MaxInt32
+}
+
+// floorLog2 returns floor(log2(n)) for n > 0.
+func floorLog2(n int) int {
+	l := 0
+	for n > 1 {
+		n >>= 1
+		l++
+	}
+	return l
+}
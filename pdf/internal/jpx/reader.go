@@ -0,0 +1,65 @@
+package jpx
+
+import "errors"
+
+// errUnexpectedEOF is returned when the data ends before a structure is completely read.
+var errUnexpectedEOF = errors.New("jpx: unexpected end of data")
+
+// byteReader reads big-endian values from a marker segment or box. Reading past the end
+// of the data sets a sticky error and returns zero values.
+type byteReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+// newByteReader returns a new byteReader over `data`.
+func newByteReader(data []byte) *byteReader {
+	return &byteReader{data: data}
+}
+
+// bytes returns the next `n` bytes.
+func (r *byteReader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || r.pos+n > len(r.data) {
+		r.err = errUnexpectedEOF
+		return nil
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+// u8 reads an unsigned byte.
+func (r *byteReader) u8() int {
+	b := r.bytes(1)
+	if b == nil {
+		return 0
+	}
+	return int(b[0])
+}
+
+// u16 reads a big-endian 16-bit unsigned integer.
+func (r *byteReader) u16() int {
+	b := r.bytes(2)
+	if b == nil {
+		return 0
+	}
+	return int(b[0])<<8 | int(b[1])
+}
+
+// u32 reads a big-endian 32-bit unsigned integer.
+func (r *byteReader) u32() uint32 {
+	b := r.bytes(4)
+	if b == nil {
+		return 0
+	}
+	return uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+}
+
+// remaining returns the number of unread bytes.
+func (r *byteReader) remaining() int {
+	return len(r.data) - r.pos
+}
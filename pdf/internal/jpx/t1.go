@@ -0,0 +1,391 @@
+package jpx
+
+import (
+	"github.com/finalversus/doc/pdf/internal/mq"
+)
+
+// Coding pass types.
+const (
+	passCleanup = iota
+	passSignificance
+	passRefinement
+)
+
+// passType returns the type of the coding pass with index `pass` of a code-block. The first
+// pass is a cleanup pass, followed by triples of significance propagation, magnitude
+// refinement and cleanup passes (section D.3).
+func passType(pass int) int {
+	if pass == 0 {
+		return passCleanup
+	}
+	return [3]int{passSignificance, passRefinement, passCleanup}[(pass-1)%3]
+}
+
+// Context indices of the coefficient bit modeling (Annex D).
+const (
+	ctxZC  = 0
+	ctxSC  = 9
+	ctxMR  = 14
+	ctxRL  = 17
+	ctxUNI = 18
+	numCtx = 19
+)
+
+// State flags of a coefficient.
+const (
+	flagSignificant = 1 << iota
+	flagNegative
+	flagVisited
+	flagRefined
+)
+
+// signContexts maps the horizontal and vertical sign contributions (offset by one) to the
+// context and the XOR bit of the sign decoding (Table D.3).
+var signContexts = [3][3]struct{ ctx, xor int }{
+	{{13, 1}, {12, 1}, {11, 1}},
+	{{10, 1}, {9, 0}, {10, 0}},
+	{{11, 0}, {12, 0}, {13, 0}},
+}
+
+// rawDecoder reads the bits of a raw codeword segment in selective arithmetic coding bypass
+// mode (section D.6).
+type rawDecoder struct {
+	data []byte
+	pos  int
+	c    byte
+	ct   int
+}
+
+// bit returns the next bit. Past the end of data 1 bits are returned.
+func (r *rawDecoder) bit() int {
+	if r.ct == 0 {
+		prev := r.c
+		r.c = 0xff
+		if r.pos < len(r.data) {
+			r.c = r.data[r.pos]
+		}
+		r.pos++
+		r.ct = 8
+		if prev == 0xff {
+			r.ct = 7
+		}
+	}
+	r.ct--
+	return int(r.c>>uint(r.ct)) & 1
+}
+
+// t1 decodes the coding passes of a code-block (Annex D).
+type t1 struct {
+	w, h    int
+	stride  int
+	orient  int
+	cbStyle int
+	// flags holds the state of each coefficient with a border of one coefficient.
+	flags []uint8
+	// data holds the magnitudes of the coefficients multiplied by two, which leaves room
+	// for reconstruction at the mid-point of the quantization interval.
+	data []int32
+	cx   [numCtx]byte
+	mq   *mq.Decoder
+	raw  *rawDecoder
+}
+
+// resetContexts sets the contexts to their initial states (Table D.7).
+func (t *t1) resetContexts() {
+	for i := range t.cx {
+		t.cx[i] = 0
+	}
+	t.cx[ctxZC] = mq.Context(4, 0)
+	t.cx[ctxRL] = mq.Context(3, 0)
+	t.cx[ctxUNI] = mq.Context(46, 0)
+}
+
+// decodeCodeblock decodes the coded data of `cb` in a band with orientation `orient` and `mb`
+// magnitude bit-planes and returns the signed coefficients multiplied by two, with
+// `roiShift` applied.
+func decodeCodeblock(cb *codeblock, orient, cbStyle, mb, roiShift int) []int32 {
+	w, h := cb.x1-cb.x0, cb.y1-cb.y0
+	t := &t1{
+		w:       w,
+		h:       h,
+		stride:  w + 2,
+		orient:  orient,
+		cbStyle: cbStyle,
+		flags:   make([]uint8, (w+2)*(h+2)),
+		data:    make([]int32, w*h),
+	}
+	t.resetContexts()
+
+	numPlanes := mb + roiShift - cb.zeroPlanes
+	if numPlanes > 30 {
+		numPlanes = 30
+	}
+	passes := cb.passes
+	if maxPasses := 3*numPlanes - 2; passes > maxPasses {
+		passes = maxPasses
+	}
+
+	pass := 0
+	for _, seg := range cb.segments {
+		if pass >= passes {
+			break
+		}
+		raw := cbStyle&cbBypass != 0 && pass >= 10 && passType(pass) != passCleanup
+		if raw {
+			t.raw = &rawDecoder{data: seg.data}
+		} else {
+			t.mq = mq.NewDecoder(seg.data)
+		}
+		for i := 0; i < seg.passes && pass < passes; i++ {
+			plane := numPlanes - 1 - (pass+2)/3
+			switch passType(pass) {
+			case passSignificance:
+				t.significancePass(plane, raw)
+			case passRefinement:
+				t.refinementPass(plane, raw)
+			case passCleanup:
+				t.cleanupPass(plane)
+			}
+			if cbStyle&cbReset != 0 {
+				t.resetContexts()
+			}
+			pass++
+		}
+	}
+
+	out := make([]int32, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := t.data[y*w+x]
+			if roiShift > 0 && v>>1 >= 1<<uint(roiShift) {
+				v >>= uint(roiShift)
+			}
+			if t.flags[(y+1)*t.stride+x+1]&flagNegative != 0 {
+				v = -v
+			}
+			out[y*w+x] = v
+		}
+	}
+	return out
+}
+
+// decodeBit decodes a bit with context `ctx`, or reads a raw bit in bypass mode.
+func (t *t1) decodeBit(ctx int, raw bool) int {
+	if raw {
+		return t.raw.bit()
+	}
+	return t.mq.DecodeBit(t.cx[:], ctx)
+}
+
+// neighbours returns the number of significant horizontal, vertical and diagonal neighbours
+// of the coefficient at flag index `i` in row `y`.
+func (t *t1) neighbours(i, y int) (int, int, int) {
+	f := t.flags
+	s := t.stride
+	h := int(f[i-1]&flagSignificant) + int(f[i+1]&flagSignificant)
+	v := int(f[i-s] & flagSignificant)
+	d := int(f[i-s-1]&flagSignificant) + int(f[i-s+1]&flagSignificant)
+	if t.cbStyle&cbCausal == 0 || y%4 != 3 {
+		v += int(f[i+s] & flagSignificant)
+		d += int(f[i+s-1]&flagSignificant) + int(f[i+s+1]&flagSignificant)
+	}
+	return h, v, d
+}
+
+// zeroCodingContext returns the context of the significance decision (Table D.1).
+func (t *t1) zeroCodingContext(h, v, d int) int {
+	switch t.orient {
+	case bandHL:
+		h, v = v, h
+		fallthrough
+	case bandLL, bandLH:
+		switch {
+		case h == 2:
+			return 8
+		case h == 1 && v >= 1:
+			return 7
+		case h == 1 && d >= 1:
+			return 6
+		case h == 1:
+			return 5
+		case v == 2:
+			return 4
+		case v == 1:
+			return 3
+		case d >= 2:
+			return 2
+		case d == 1:
+			return 1
+		}
+		return 0
+	}
+	hv := h + v
+	switch {
+	case d >= 3:
+		return 8
+	case d == 2 && hv >= 1:
+		return 7
+	case d == 2:
+		return 6
+	case d == 1 && hv >= 2:
+		return 5
+	case d == 1 && hv == 1:
+		return 4
+	case d == 1:
+		return 3
+	case hv >= 2:
+		return 2
+	case hv == 1:
+		return 1
+	}
+	return 0
+}
+
+// signContribution returns the contribution of the neighbour with flags `f` to the sign context.
+func signContribution(f uint8) int {
+	if f&flagSignificant == 0 {
+		return 0
+	}
+	if f&flagNegative != 0 {
+		return -1
+	}
+	return 1
+}
+
+// clampSign clamps `v` to the range [-1, 1].
+func clampSign(v int) int {
+	if v > 1 {
+		return 1
+	}
+	if v < -1 {
+		return -1
+	}
+	return v
+}
+
+// decodeSign decodes the sign of the coefficient at flag index `i` in row `y` and makes
+// it significant at bit-plane `plane` (section D.3.2).
+func (t *t1) decodeSign(i, y, plane int, raw bool) {
+	f := t.flags
+	var neg int
+	if raw {
+		neg = t.raw.bit()
+	} else {
+		h := clampSign(signContribution(f[i-1]) + signContribution(f[i+1]))
+		v := signContribution(f[i-t.stride])
+		if t.cbStyle&cbCausal == 0 || y%4 != 3 {
+			v += signContribution(f[i+t.stride])
+		}
+		sc := signContexts[h+1][clampSign(v)+1]
+		neg = t.mq.DecodeBit(t.cx[:], sc.ctx) ^ sc.xor
+	}
+	f[i] |= flagSignificant
+	if neg != 0 {
+		f[i] |= flagNegative
+	}
+	x := i%t.stride - 1
+	t.data[y*t.w+x] = 3 << uint(plane)
+}
+
+// significancePass decodes a significance propagation pass (section D.3.1).
+func (t *t1) significancePass(plane int, raw bool) {
+	for y0 := 0; y0 < t.h; y0 += 4 {
+		for x := 0; x < t.w; x++ {
+			for y := y0; y < y0+4 && y < t.h; y++ {
+				i := (y+1)*t.stride + x + 1
+				if t.flags[i]&flagSignificant != 0 {
+					continue
+				}
+				h, v, d := t.neighbours(i, y)
+				if h+v+d == 0 {
+					continue
+				}
+				if t.decodeBit(ctxZC+t.zeroCodingContext(h, v, d), raw) == 1 {
+					t.decodeSign(i, y, plane, raw)
+				}
+				t.flags[i] |= flagVisited
+			}
+		}
+	}
+}
+
+// refinementPass decodes a magnitude refinement pass (section D.3.3).
+func (t *t1) refinementPass(plane int, raw bool) {
+	for y0 := 0; y0 < t.h; y0 += 4 {
+		for x := 0; x < t.w; x++ {
+			for y := y0; y < y0+4 && y < t.h; y++ {
+				i := (y+1)*t.stride + x + 1
+				f := t.flags[i]
+				if f&flagSignificant == 0 || f&flagVisited != 0 {
+					continue
+				}
+				ctx := ctxMR + 2
+				if f&flagRefined == 0 {
+					ctx = ctxMR
+					if h, v, d := t.neighbours(i, y); h+v+d > 0 {
+						ctx = ctxMR + 1
+					}
+				}
+				k := y*t.w + x
+				if t.decodeBit(ctx, raw) == 1 {
+					t.data[k] += 1 << uint(plane)
+				} else {
+					t.data[k] -= 1 << uint(plane)
+				}
+				t.flags[i] |= flagRefined
+			}
+		}
+	}
+}
+
+// cleanupPass decodes a cleanup pass (section D.3.4).
+func (t *t1) cleanupPass(plane int) {
+	for y0 := 0; y0 < t.h; y0 += 4 {
+		for x := 0; x < t.w; x++ {
+			y := y0
+			if y0+4 <= t.h && t.runLengthMode(x, y0) {
+				if t.mq.DecodeBit(t.cx[:], ctxRL) == 0 {
+					continue
+				}
+				y += t.mq.DecodeBit(t.cx[:], ctxUNI) << 1
+				y += t.mq.DecodeBit(t.cx[:], ctxUNI)
+				t.decodeSign((y+1)*t.stride+x+1, y, plane, false)
+				y++
+			}
+			for ; y < y0+4 && y < t.h; y++ {
+				i := (y+1)*t.stride + x + 1
+				if t.flags[i]&(flagSignificant|flagVisited) != 0 {
+					continue
+				}
+				h, v, d := t.neighbours(i, y)
+				if t.mq.DecodeBit(t.cx[:], ctxZC+t.zeroCodingContext(h, v, d)) == 1 {
+					t.decodeSign(i, y, plane, false)
+				}
+			}
+		}
+	}
+	for i := range t.flags {
+		t.flags[i] &^= flagVisited
+	}
+	if t.cbStyle&cbSegSymbols != 0 {
+		for i := 0; i < 4; i++ {
+			t.mq.DecodeBit(t.cx[:], ctxUNI)
+		}
+	}
+}
+
+// runLengthMode returns true if the column of four coefficients starting at (`x`, `y0`) is
+// decoded in run-length mode, i.e. none of them is significant, visited or has a
+// significant neighbour.
+func (t *t1) runLengthMode(x, y0 int) bool {
+	for y := y0; y < y0+4; y++ {
+		i := (y+1)*t.stride + x + 1
+		if t.flags[i]&(flagSignificant|flagVisited) != 0 {
+			return false
+		}
+		if h, v, d := t.neighbours(i, y); h+v+d != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,126 @@
+package jpx
+
+// tagTreeNode is a node of a tag tree.
+type tagTreeNode struct {
+	parent int
+	value  int
+	low    int
+}
+
+// tagTree is a tag tree as used for the inclusion information and the number of missing
+// most significant bit-planes of code-blocks in packet headers (section B.10.2).
+type tagTree struct {
+	nodes []tagTreeNode
+	width int
+}
+
+// tagTreeUnknown is the value of nodes that have not been decoded yet.
+const tagTreeUnknown = 1 << 30
+
+// newTagTree returns a tag tree with `w` x `h` leaves.
+func newTagTree(w, h int) *tagTree {
+	t := &tagTree{width: w}
+	// Levels from the leaves to the root.
+	type level struct{ start, w, h int }
+	var levels []level
+	n := 0
+	for lw, lh := w, h; ; lw, lh = (lw+1)/2, (lh+1)/2 {
+		levels = append(levels, level{n, lw, lh})
+		n += lw * lh
+		if lw*lh <= 1 {
+			break
+		}
+	}
+	t.nodes = make([]tagTreeNode, n)
+	for i, l := range levels {
+		for y := 0; y < l.h; y++ {
+			for x := 0; x < l.w; x++ {
+				node := &t.nodes[l.start+y*l.w+x]
+				node.value = tagTreeUnknown
+				node.parent = -1
+				if i+1 < len(levels) {
+					p := levels[i+1]
+					node.parent = p.start + (y/2)*p.w + x/2
+				}
+			}
+		}
+	}
+	return t
+}
+
+// decode decodes the value of the leaf at (`x`, `y`) from `br` as far as needed to determine
+// whether it is less than `threshold` and returns the result.
+func (t *tagTree) decode(br *bitReader, x, y, threshold int) bool {
+	var path [32]int
+	n := 0
+	for i := y*t.width + x; i >= 0; i = t.nodes[i].parent {
+		path[n] = i
+		n++
+	}
+	low := 0
+	for k := n - 1; k >= 0; k-- {
+		node := &t.nodes[path[k]]
+		if low > node.low {
+			node.low = low
+		} else {
+			low = node.low
+		}
+		for low < threshold && low < node.value {
+			if br.bit() == 1 {
+				node.value = low
+			} else {
+				low++
+			}
+		}
+		node.low = low
+	}
+	return t.nodes[path[0]].value < threshold
+}
+
+// bitReader reads the bits of packet headers, skipping the stuffed bits that follow 0xFF
+// bytes (section B.10.1).
+type bitReader struct {
+	data []byte
+	pos  int
+	buf  byte
+	ct   int
+	err  error
+}
+
+// bit reads a single bit. Reading past the end of the data sets err and returns 0.
+func (br *bitReader) bit() int {
+	if br.ct == 0 {
+		if br.pos >= len(br.data) {
+			br.err = errUnexpectedEOF
+			return 0
+		}
+		if br.buf == 0xff {
+			br.ct = 7
+		} else {
+			br.ct = 8
+		}
+		br.buf = br.data[br.pos]
+		br.pos++
+	}
+	br.ct--
+	return int(br.buf>>uint(br.ct)) & 1
+}
+
+// bits reads `n` bits most significant first.
+func (br *bitReader) bits(n int) int {
+	v := 0
+	for i := 0; i < n; i++ {
+		v = v<<1 | br.bit()
+	}
+	return v
+}
+
+// align skips the remaining bits of the current byte and the stuffed byte that follows
+// a terminating 0xFF byte.
+func (br *bitReader) align() {
+	if br.buf == 0xff {
+		br.pos++
+	}
+	br.ct = 0
+	br.buf = 0
+}
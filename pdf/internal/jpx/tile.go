@@ -0,0 +1,224 @@
+package jpx
+
+import (
+	"errors"
+	"math"
+)
+
+// segment is a codeword segment of a code-block, possibly spread over several layers.
+type segment struct {
+	data      []byte
+	passes    int
+	maxPasses int
+}
+
+// codeblock holds the state and the coded data of a code-block.
+type codeblock struct {
+	x0, y0, x1, y1 int
+	included       bool
+	lblock         int
+	zeroPlanes     int
+	passes         int
+	segments       []*segment
+}
+
+// precinct holds the code-blocks of a band that belong to a precinct.
+type precinct struct {
+	cbw, cbh   int
+	blocks     []*codeblock
+	inclusion  *tagTree
+	zeroPlanes *tagTree
+}
+
+// Band orientations.
+const (
+	bandLL = iota
+	bandHL
+	bandLH
+	bandHH
+)
+
+// band is a sub-band of a resolution level.
+type band struct {
+	orient         int
+	x0, y0, x1, y1 int
+	xcb, ycb       int
+	precincts      []*precinct
+	// mb is the maximum number of magnitude bit-planes (Equation E-2).
+	mb int
+	// delta is the quantization step size (Equation E-3).
+	delta float32
+}
+
+// resolution is a resolution level of a tile-component.
+type resolution struct {
+	level          int
+	x0, y0, x1, y1 int
+	ppx, ppy       int
+	pw, ph         int
+	bands          []*band
+}
+
+// tileComponent holds the resolution levels of a component of a tile.
+type tileComponent struct {
+	x0, y0, x1, y1 int
+	style          *componentStyle
+	quant          *quantization
+	roiShift       int
+	resolutions    []*resolution
+}
+
+// tile holds the tile-components of a tile and the parameters used to decode it.
+type tile struct {
+	index          int
+	x0, y0, x1, y1 int
+	params         *tileParams
+	components     []*tileComponent
+}
+
+// newTile computes the geometry of the tile with data `td` (Annex B).
+func newTile(size *imageSize, td *tileData) (*tile, error) {
+	nx, _ := size.numTiles()
+	p, q := td.index%nx, td.index/nx
+	t := &tile{
+		index:  td.index,
+		x0:     maxInt(size.tileX0+p*size.tileW, size.x0),
+		y0:     maxInt(size.tileY0+q*size.tileH, size.y0),
+		x1:     minInt(size.tileX0+(p+1)*size.tileW, size.x1),
+		y1:     minInt(size.tileY0+(q+1)*size.tileH, size.y1),
+		params: td.params,
+	}
+	for c, comp := range size.components {
+		style := td.params.components[c]
+		quant := td.params.quant[c]
+		if style == nil || quant == nil {
+			return nil, errors.New("jpx: missing coding parameters")
+		}
+		tc := &tileComponent{
+			x0:       ceilDiv(t.x0, comp.dx),
+			y0:       ceilDiv(t.y0, comp.dy),
+			x1:       ceilDiv(t.x1, comp.dx),
+			y1:       ceilDiv(t.y1, comp.dy),
+			style:    style,
+			quant:    quant,
+			roiShift: td.params.roiShift[c],
+		}
+		for r := 0; r <= style.levels; r++ {
+			tc.resolutions = append(tc.resolutions, tc.newResolution(r, comp.precision))
+		}
+		t.components = append(t.components, tc)
+	}
+	return t, nil
+}
+
+// newResolution computes the geometry of resolution level `r` of `tc`.
+func (tc *tileComponent) newResolution(r, precision int) *resolution {
+	s := tc.style
+	n := s.levels - r
+	res := &resolution{
+		level: r,
+		x0:    ceilShift(tc.x0, n),
+		y0:    ceilShift(tc.y0, n),
+		x1:    ceilShift(tc.x1, n),
+		y1:    ceilShift(tc.y1, n),
+		ppx:   s.ppx[r],
+		ppy:   s.ppy[r],
+	}
+	if res.x1 > res.x0 && res.y1 > res.y0 {
+		res.pw = ceilShift(res.x1, res.ppx) - res.x0>>uint(res.ppx)
+		res.ph = ceilShift(res.y1, res.ppy) - res.y0>>uint(res.ppy)
+	}
+
+	orients := []int{bandLL}
+	if r > 0 {
+		orients = []int{bandHL, bandLH, bandHH}
+	}
+	for _, orient := range orients {
+		b := &band{orient: orient}
+		if r == 0 {
+			b.x0, b.y0, b.x1, b.y1 = res.x0, res.y0, res.x1, res.y1
+		} else {
+			b.x0, b.x1 = bandRange(res.x0, res.x1, orient&1 != 0)
+			b.y0, b.y1 = bandRange(res.y0, res.y1, orient&2 != 0)
+		}
+
+		ppx, ppy := res.ppx, res.ppy
+		if r > 0 {
+			ppx--
+			ppy--
+		}
+		b.xcb = minInt(s.xcb, ppx)
+		b.ycb = minInt(s.ycb, ppy)
+
+		step := tc.quant.step(r, orient, s.levels)
+		b.mb = tc.quant.guard + step.exponent - 1
+		b.delta = 1
+		if !s.reversible {
+			gain := [4]int{0, 1, 1, 2}[orient]
+			b.delta = float32(math.Ldexp(1+float64(step.mantissa)/2048, precision+gain-step.exponent))
+		}
+
+		kx, ky := res.x0>>uint(res.ppx), res.y0>>uint(res.ppy)
+		for j := 0; j < res.ph; j++ {
+			for i := 0; i < res.pw; i++ {
+				x0 := maxInt(b.x0, (kx+i)<<uint(ppx))
+				y0 := maxInt(b.y0, (ky+j)<<uint(ppy))
+				x1 := minInt(b.x1, (kx+i+1)<<uint(ppx))
+				y1 := minInt(b.y1, (ky+j+1)<<uint(ppy))
+				b.precincts = append(b.precincts, newPrecinct(x0, y0, x1, y1, b.xcb, b.ycb))
+			}
+		}
+		res.bands = append(res.bands, b)
+	}
+	return res
+}
+
+// bandRange returns the range of a band in one dimension given the range [`u0`, `u1`) of its
+// resolution level. `high` is true for the high-pass direction.
+func bandRange(u0, u1 int, high bool) (int, int) {
+	if high {
+		return u0 / 2, u1 / 2
+	}
+	return (u0 + 1) / 2, (u1 + 1) / 2
+}
+
+// newPrecinct returns the precinct covering the band area [`x0`, `x1`) x [`y0`, `y1`) with
+// code-blocks of size 2^xcb x 2^ycb.
+func newPrecinct(x0, y0, x1, y1, xcb, ycb int) *precinct {
+	p := &precinct{}
+	if x1 <= x0 || y1 <= y0 {
+		return p
+	}
+	cx0, cy0 := x0>>uint(xcb), y0>>uint(ycb)
+	p.cbw = ceilShift(x1, xcb) - cx0
+	p.cbh = ceilShift(y1, ycb) - cy0
+	for j := 0; j < p.cbh; j++ {
+		for i := 0; i < p.cbw; i++ {
+			p.blocks = append(p.blocks, &codeblock{
+				x0: maxInt(x0, (cx0+i)<<uint(xcb)),
+				y0: maxInt(y0, (cy0+j)<<uint(ycb)),
+				x1: minInt(x1, (cx0+i+1)<<uint(xcb)),
+				y1: minInt(y1, (cy0+j+1)<<uint(ycb)),
+			})
+		}
+	}
+	p.inclusion = newTagTree(p.cbw, p.cbh)
+	p.zeroPlanes = newTagTree(p.cbw, p.cbh)
+	return p
+}
+
+// minInt returns the smaller of `a` and `b`.
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// maxInt returns the larger of `a` and `b`.
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
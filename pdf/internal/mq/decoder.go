@@ -0,0 +1,183 @@
+// Package mq implements the MQ binary arithmetic decoder shared by the JBIG2 and
+// JPEG 2000 decoders, and the corresponding encoder.
+package mq
+
+// qeEntry is a row of the probability estimation table (Table E.1 of the JBIG2 specification, Table C.2 of the JPEG 2000 specification).
+type qeEntry struct {
+	qe        uint32
+	nmps      uint8
+	nlps      uint8
+	switchMPS bool
+}
+
+// qeTable is the probability estimation state machine shared by all contexts.
+var qeTable = [47]qeEntry{
+	{0x5601, 1, 1, true},
+	{0x3401, 2, 6, false},
+	{0x1801, 3, 9, false},
+	{0x0AC1, 4, 12, false},
+	{0x0521, 5, 29, false},
+	{0x0221, 38, 33, false},
+	{0x5601, 7, 6, true},
+	{0x5401, 8, 14, false},
+	{0x4801, 9, 14, false},
+	{0x3801, 10, 14, false},
+	{0x3001, 11, 17, false},
+	{0x2401, 12, 18, false},
+	{0x1C01, 13, 20, false},
+	{0x1601, 29, 21, false},
+	{0x5601, 15, 14, true},
+	{0x5401, 16, 14, false},
+	{0x5101, 17, 15, false},
+	{0x4801, 18, 16, false},
+	{0x3801, 19, 17, false},
+	{0x3401, 20, 18, false},
+	{0x3001, 21, 19, false},
+	{0x2801, 22, 19, false},
+	{0x2401, 23, 20, false},
+	{0x2201, 24, 21, false},
+	{0x1C01, 25, 22, false},
+	{0x1801, 26, 23, false},
+	{0x1601, 27, 24, false},
+	{0x1401, 28, 25, false},
+	{0x1201, 29, 26, false},
+	{0x1101, 30, 27, false},
+	{0x0AC1, 31, 28, false},
+	{0x09C1, 32, 29, false},
+	{0x08A1, 33, 30, false},
+	{0x0521, 34, 31, false},
+	{0x0441, 35, 32, false},
+	{0x02A1, 36, 33, false},
+	{0x0221, 37, 34, false},
+	{0x0141, 38, 35, false},
+	{0x0111, 39, 36, false},
+	{0x0085, 40, 37, false},
+	{0x0049, 41, 38, false},
+	{0x0025, 42, 39, false},
+	{0x0015, 43, 40, false},
+	{0x0009, 44, 41, false},
+	{0x0005, 45, 42, false},
+	{0x0001, 45, 43, false},
+	{0x5601, 46, 46, false},
+}
+
+// Decoder is the binary arithmetic (MQ) decoder described in Annex E of the JBIG2
+// specification and Annex C of the JPEG 2000 specification. Contexts are stored as bytes
+// holding the state index in the upper bits and the MPS value in the lowest bit.
+type Decoder struct {
+	data  []byte
+	pos   int
+	chigh uint32
+	clow  uint32
+	a     uint32
+	ct    int
+}
+
+// NewDecoder initializes a decoder over `data` (INITDEC procedure).
+func NewDecoder(data []byte) *Decoder {
+	d := &Decoder{data: data}
+	d.chigh = uint32(d.byteAt(0))
+	d.clow = 0
+	d.pos = 0
+	d.byteIn()
+	d.chigh = ((d.chigh << 7) & 0xffff) | ((d.clow >> 9) & 0x7f)
+	d.clow = (d.clow << 7) & 0xffff
+	d.ct -= 7
+	d.a = 0x8000
+	return d
+}
+
+// byteAt returns the byte at `i` or 0xFF past the end of data.
+func (d *Decoder) byteAt(i int) byte {
+	if i < len(d.data) {
+		return d.data[i]
+	}
+	return 0xff
+}
+
+// byteIn reads the next byte of compressed data (BYTEIN procedure).
+func (d *Decoder) byteIn() {
+	if d.byteAt(d.pos) == 0xff {
+		if d.byteAt(d.pos+1) > 0x8f {
+			d.clow += 0xff00
+			d.ct = 8
+		} else {
+			d.pos++
+			d.clow += uint32(d.byteAt(d.pos)) << 9
+			d.ct = 7
+		}
+	} else {
+		d.pos++
+		d.clow += uint32(d.byteAt(d.pos)) << 8
+		d.ct = 8
+	}
+	if d.clow > 0xffff {
+		d.chigh += d.clow >> 16
+		d.clow &= 0xffff
+	}
+}
+
+// DecodeBit decodes a single bit using context `cx[i]` (DECODE procedure).
+func (d *Decoder) DecodeBit(cx []byte, i int) int {
+	index := cx[i] >> 1
+	mps := int(cx[i] & 1)
+	entry := qeTable[index]
+	qe := entry.qe
+
+	var bit int
+	a := d.a - qe
+	if d.chigh < qe {
+		// LPS exchange.
+		if a < qe {
+			a = qe
+			bit = mps
+			index = entry.nmps
+		} else {
+			a = qe
+			bit = 1 ^ mps
+			if entry.switchMPS {
+				mps = bit
+			}
+			index = entry.nlps
+		}
+	} else {
+		d.chigh -= qe
+		if a&0x8000 != 0 {
+			d.a = a
+			return mps
+		}
+		// MPS exchange.
+		if a < qe {
+			bit = 1 ^ mps
+			if entry.switchMPS {
+				mps = bit
+			}
+			index = entry.nlps
+		} else {
+			bit = mps
+			index = entry.nmps
+		}
+	}
+
+	// Renormalization.
+	for {
+		if d.ct == 0 {
+			d.byteIn()
+		}
+		a <<= 1
+		d.chigh = ((d.chigh << 1) & 0xffff) | ((d.clow >> 15) & 1)
+		d.clow = (d.clow << 1) & 0xffff
+		d.ct--
+		if a&0x8000 != 0 {
+			break
+		}
+	}
+	d.a = a
+	cx[i] = index<<1 | uint8(mps)
+	return bit
+}
+
+// Context returns the initial value of a context with probability estimation state `index` and MPS value `mps`.
+func Context(index int, mps int) byte {
+	return byte(index<<1 | mps&1)
+}
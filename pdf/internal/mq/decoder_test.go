@@ -0,0 +1,50 @@
+package mq
+
+import (
+	"bytes"
+	"testing"
+)
+
+// The test sequence of section H.2 of the JBIG2 specification.
+var (
+	testEncoded = []byte{
+		0x84, 0xC7, 0x3B, 0xFC, 0xE1, 0xA1, 0x43, 0x04, 0x02, 0x20, 0x00, 0x00, 0x41, 0x0D, 0xBB, 0x86,
+		0xF4, 0x31, 0x7F, 0xFF, 0x88, 0xFF, 0x37, 0x47, 0x1A, 0xDB, 0x6A, 0xDF, 0xFF, 0xAC,
+	}
+	testDecoded = []byte{
+		0x00, 0x02, 0x00, 0x51, 0x00, 0x00, 0x00, 0xC0, 0x03, 0x52, 0x87, 0x2A, 0xAA, 0xAA, 0xAA, 0xAA,
+		0x82, 0xC0, 0x20, 0x00, 0xFC, 0xD7, 0x9E, 0xF6, 0xBF, 0x7F, 0xED, 0x90, 0x4F, 0x46, 0xA3, 0xBF,
+	}
+)
+
+// TestDecoder checks the decoder against the test sequence of section H.2
+// of the JBIG2 specification.
+func TestDecoder(t *testing.T) {
+	d := NewDecoder(testEncoded)
+	cx := make([]byte, 1)
+	decoded := make([]byte, len(testDecoded))
+	for i := range decoded {
+		for j := 0; j < 8; j++ {
+			decoded[i] = decoded[i]<<1 | byte(d.DecodeBit(cx, 0))
+		}
+	}
+	if !bytes.Equal(decoded, testDecoded) {
+		t.Fatalf("decoded % X, expected % X", decoded, testDecoded)
+	}
+}
+
+// TestEncoder checks the encoder against the test sequence of section H.2
+// of the JBIG2 specification, which ends with the 0xFF 0xAC marker.
+func TestEncoder(t *testing.T) {
+	e := NewEncoder()
+	cx := make([]byte, 1)
+	for _, b := range testDecoded {
+		for j := 7; j >= 0; j-- {
+			e.EncodeBit(cx, 0, int(b>>uint(j))&1)
+		}
+	}
+	expected := testEncoded[:len(testEncoded)-2]
+	if encoded := e.Flush(); !bytes.Equal(encoded, expected) {
+		t.Fatalf("encoded % X, expected % X", encoded, expected)
+	}
+}
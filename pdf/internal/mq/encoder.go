@@ -0,0 +1,114 @@
+package mq
+
+// Encoder is the binary arithmetic (MQ) encoder described in Annex E of the JBIG2
+// specification and Annex C of the JPEG 2000 specification, the counterpart of Decoder.
+type Encoder struct {
+	// Encoded bytes, preceded by the byte before the start of the data (BPST - 1).
+	data []byte
+	c    uint32
+	a    uint32
+	ct   int
+}
+
+// NewEncoder initializes an encoder (INITENC procedure).
+func NewEncoder() *Encoder {
+	return &Encoder{data: []byte{0}, a: 0x8000, ct: 12}
+}
+
+// EncodeBit encodes the bit `bit` using context `cx[i]` (ENCODE procedure).
+func (e *Encoder) EncodeBit(cx []byte, i int, bit int) {
+	index := cx[i] >> 1
+	mps := int(cx[i] & 1)
+	entry := qeTable[index]
+	qe := entry.qe
+
+	e.a -= qe
+	if bit&1 == mps {
+		// CODEMPS.
+		if e.a&0x8000 != 0 {
+			e.c += qe
+			return
+		}
+		if e.a < qe {
+			e.a = qe
+		} else {
+			e.c += qe
+		}
+		index = entry.nmps
+	} else {
+		// CODELPS.
+		if e.a < qe {
+			e.c += qe
+		} else {
+			e.a = qe
+		}
+		if entry.switchMPS {
+			mps = 1 - mps
+		}
+		index = entry.nlps
+	}
+	cx[i] = index<<1 | uint8(mps)
+	e.renormalize()
+}
+
+// renormalize is the RENORME procedure.
+func (e *Encoder) renormalize() {
+	for {
+		e.a <<= 1
+		e.c <<= 1
+		e.ct--
+		if e.ct == 0 {
+			e.byteOut()
+		}
+		if e.a&0x8000 != 0 {
+			break
+		}
+	}
+}
+
+// byteOut outputs a byte of compressed data (BYTEOUT procedure), with bit stuffing after 0xFF
+// bytes.
+func (e *Encoder) byteOut() {
+	last := len(e.data) - 1
+	if e.data[last] == 0xff {
+		e.data = append(e.data, byte(e.c>>20))
+		e.c &= 0xfffff
+		e.ct = 7
+		return
+	}
+	if e.c >= 0x8000000 {
+		// Carry into the previous byte.
+		e.data[last]++
+		if e.data[last] == 0xff {
+			e.c &= 0x7ffffff
+			e.data = append(e.data, byte(e.c>>20))
+			e.c &= 0xfffff
+			e.ct = 7
+			return
+		}
+	}
+	e.data = append(e.data, byte(e.c>>19))
+	e.c &= 0x7ffff
+	e.ct = 8
+}
+
+// Flush terminates the encoding (FLUSH procedure) and returns the encoded data. A final 0xFF
+// byte is discarded as in JPEG 2000; JBIG2 data is followed by the 0xFF 0xAC marker.
+func (e *Encoder) Flush() []byte {
+	// SETBITS.
+	tempc := e.c + e.a
+	e.c |= 0xffff
+	if e.c >= tempc {
+		e.c -= 0x8000
+	}
+
+	e.c <<= uint(e.ct)
+	e.byteOut()
+	e.c <<= uint(e.ct)
+	e.byteOut()
+	data := e.data[1:]
+	if n := len(data); n > 0 && data[n-1] == 0xff {
+		data = data[:n-1]
+	}
+	return data
+}
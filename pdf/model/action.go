@@ -0,0 +1,670 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/finalversus/doc/common"
+	"github.com/finalversus/doc/pdf/core"
+)
+
+// PdfActionType is the type of an action (S entry of the action dictionary).
+type PdfActionType string
+
+// Action types (section 12.6.4 of the PDF 1.7 standard).
+const (
+	ActionTypeGoTo        PdfActionType = "GoTo"
+	ActionTypeGoToR       PdfActionType = "GoToR"
+	ActionTypeGoToE       PdfActionType = "GoToE"
+	ActionTypeLaunch      PdfActionType = "Launch"
+	ActionTypeThread      PdfActionType = "Thread"
+	ActionTypeURI         PdfActionType = "URI"
+	ActionTypeSound       PdfActionType = "Sound"
+	ActionTypeMovie       PdfActionType = "Movie"
+	ActionTypeHide        PdfActionType = "Hide"
+	ActionTypeNamed       PdfActionType = "Named"
+	ActionTypeSubmitForm  PdfActionType = "SubmitForm"
+	ActionTypeResetForm   PdfActionType = "ResetForm"
+	ActionTypeImportData  PdfActionType = "ImportData"
+	ActionTypeJavaScript  PdfActionType = "JavaScript"
+	ActionTypeSetOCGState PdfActionType = "SetOCGState"
+	ActionTypeRendition   PdfActionType = "Rendition"
+	ActionTypeTrans       PdfActionType = "Trans"
+	ActionTypeGoTo3DView  PdfActionType = "GoTo3DView"
+)
+
+// PdfAction represents an action (section 12.6 of the PDF 1.7 standard). The specific fields of
+// the action are in its context (e.g. *PdfActionURI). Actions of other types have no context
+// and are written back unchanged, apart from Next.
+type PdfAction struct {
+	// context contains the specific action fields.
+	context PdfModel
+
+	actionType PdfActionType
+
+	// Next holds the actions performed after this action, in order.
+	Next []*PdfAction
+
+	container *core.PdfIndirectObject
+}
+
+// PdfActionGoTo represents a go-to action, which changes the view to a destination of the
+// document.
+type PdfActionGoTo struct {
+	*PdfAction
+	D core.PdfObject // Destination: name, string or array.
+}
+
+// PdfActionGoToR represents a remote go-to action, which jumps to a destination in another file.
+type PdfActionGoToR struct {
+	*PdfAction
+	F         core.PdfObject // File specification.
+	D         core.PdfObject
+	NewWindow core.PdfObject
+}
+
+// PdfActionLaunch represents a launch action, which launches an application or opens a
+// document.
+type PdfActionLaunch struct {
+	*PdfAction
+	F         core.PdfObject // File specification.
+	Win       core.PdfObject
+	Mac       core.PdfObject
+	Unix      core.PdfObject
+	NewWindow core.PdfObject
+}
+
+// PdfActionURI represents a URI action, which resolves a uniform resource identifier.
+type PdfActionURI struct {
+	*PdfAction
+	URI   core.PdfObject
+	IsMap core.PdfObject
+}
+
+// PdfActionNamed represents a named action (e.g. NextPage), defined by the viewer.
+type PdfActionNamed struct {
+	*PdfAction
+	N core.PdfObject
+}
+
+// PdfActionSubmitForm represents a submit-form action, which sends the form data to an URL.
+type PdfActionSubmitForm struct {
+	*PdfAction
+	F      core.PdfObject // URL file specification.
+	Fields core.PdfObject
+	Flags  core.PdfObject
+}
+
+// PdfActionResetForm represents a reset-form action, which resets form fields to their default
+// values.
+type PdfActionResetForm struct {
+	*PdfAction
+	Fields core.PdfObject
+	Flags  core.PdfObject
+}
+
+// PdfActionJavaScript represents a JavaScript action, which executes a script.
+type PdfActionJavaScript struct {
+	*PdfAction
+	JS core.PdfObject // Text string or stream.
+}
+
+// newPdfAction returns an action of type `actionType` with context `ctx`.
+func newPdfAction(actionType PdfActionType, ctx PdfModel) *PdfAction {
+	return &PdfAction{
+		context:    ctx,
+		actionType: actionType,
+		container:  core.MakeIndirectObject(core.MakeDict()),
+	}
+}
+
+// NewPdfActionGoTo returns a new go-to action.
+func NewPdfActionGoTo() *PdfActionGoTo {
+	action := &PdfActionGoTo{}
+	action.PdfAction = newPdfAction(ActionTypeGoTo, action)
+	return action
+}
+
+// NewPdfActionGoToR returns a new remote go-to action.
+func NewPdfActionGoToR() *PdfActionGoToR {
+	action := &PdfActionGoToR{}
+	action.PdfAction = newPdfAction(ActionTypeGoToR, action)
+	return action
+}
+
+// NewPdfActionLaunch returns a new launch action.
+func NewPdfActionLaunch() *PdfActionLaunch {
+	action := &PdfActionLaunch{}
+	action.PdfAction = newPdfAction(ActionTypeLaunch, action)
+	return action
+}
+
+// NewPdfActionURI returns a new URI action.
+func NewPdfActionURI() *PdfActionURI {
+	action := &PdfActionURI{}
+	action.PdfAction = newPdfAction(ActionTypeURI, action)
+	return action
+}
+
+// NewPdfActionNamed returns a new named action.
+func NewPdfActionNamed() *PdfActionNamed {
+	action := &PdfActionNamed{}
+	action.PdfAction = newPdfAction(ActionTypeNamed, action)
+	return action
+}
+
+// NewPdfActionSubmitForm returns a new submit-form action.
+func NewPdfActionSubmitForm() *PdfActionSubmitForm {
+	action := &PdfActionSubmitForm{}
+	action.PdfAction = newPdfAction(ActionTypeSubmitForm, action)
+	return action
+}
+
+// NewPdfActionResetForm returns a new reset-form action.
+func NewPdfActionResetForm() *PdfActionResetForm {
+	action := &PdfActionResetForm{}
+	action.PdfAction = newPdfAction(ActionTypeResetForm, action)
+	return action
+}
+
+// NewPdfActionJavaScript returns a new JavaScript action.
+func NewPdfActionJavaScript() *PdfActionJavaScript {
+	action := &PdfActionJavaScript{}
+	action.PdfAction = newPdfAction(ActionTypeJavaScript, action)
+	return action
+}
+
+// NewPdfActionFromObject loads an action from the action dictionary `obj`, including the actions
+// of its Next entry. Actions already visited in the Next chain are skipped.
+func NewPdfActionFromObject(obj core.PdfObject) (*PdfAction, error) {
+	return newPdfActionFromObject(obj, map[*core.PdfObjectDictionary]struct{}{})
+}
+
+func newPdfActionFromObject(obj core.PdfObject, visited map[*core.PdfObjectDictionary]struct{}) (*PdfAction, error) {
+	container, ok := core.ResolveReference(obj).(*core.PdfIndirectObject)
+	if !ok {
+		container = core.MakeIndirectObject(core.ResolveReference(obj))
+	}
+	d, ok := core.GetDict(container.PdfObject)
+	if !ok {
+		return nil, fmt.Errorf("invalid action type: %T", container.PdfObject)
+	}
+	visited[d] = struct{}{}
+
+	s, ok := core.GetName(d.Get("S"))
+	if !ok {
+		return nil, errors.New("action type (S) missing or invalid")
+	}
+
+	action := &PdfAction{actionType: PdfActionType(*s), container: container}
+	switch action.actionType {
+	case ActionTypeGoTo:
+		action.context = &PdfActionGoTo{PdfAction: action, D: d.Get("D")}
+	case ActionTypeGoToR:
+		action.context = &PdfActionGoToR{
+			PdfAction: action,
+			F:         d.Get("F"),
+			D:         d.Get("D"),
+			NewWindow: d.Get("NewWindow"),
+		}
+	case ActionTypeLaunch:
+		action.context = &PdfActionLaunch{
+			PdfAction: action,
+			F:         d.Get("F"),
+			Win:       d.Get("Win"),
+			Mac:       d.Get("Mac"),
+			Unix:      d.Get("Unix"),
+			NewWindow: d.Get("NewWindow"),
+		}
+	case ActionTypeURI:
+		action.context = &PdfActionURI{PdfAction: action, URI: d.Get("URI"), IsMap: d.Get("IsMap")}
+	case ActionTypeNamed:
+		action.context = &PdfActionNamed{PdfAction: action, N: d.Get("N")}
+	case ActionTypeSubmitForm:
+		action.context = &PdfActionSubmitForm{
+			PdfAction: action,
+			F:         d.Get("F"),
+			Fields:    d.Get("Fields"),
+			Flags:     d.Get("Flags"),
+		}
+	case ActionTypeResetForm:
+		action.context = &PdfActionResetForm{PdfAction: action, Fields: d.Get("Fields"), Flags: d.Get("Flags")}
+	case ActionTypeJavaScript:
+		action.context = &PdfActionJavaScript{PdfAction: action, JS: d.Get("JS")}
+	default:
+		common.Log.Trace("Action type %s not modeled - keeping dictionary", action.actionType)
+	}
+
+	// Next is a single action dictionary or an array of action dictionaries.
+	next := d.Get("Next")
+	var nextObjs []core.PdfObject
+	if arr, ok := core.GetArray(next); ok {
+		nextObjs = arr.Elements()
+	} else if next != nil {
+		nextObjs = []core.PdfObject{next}
+	}
+	for _, obj := range nextObjs {
+		if nd, ok := core.GetDict(obj); ok {
+			if _, ok := visited[nd]; ok {
+				common.Log.Debug("Action loop in Next chain - skipping")
+				continue
+			}
+		}
+		nextAction, err := newPdfActionFromObject(obj, visited)
+		if err != nil {
+			common.Log.Debug("Invalid action in Next chain: %v - skipping", err)
+			continue
+		}
+		action.Next = append(action.Next, nextAction)
+	}
+	return action, nil
+}
+
+// GetContext returns the action context which contains the type-dependent fields (e.g.
+// *PdfActionURI), or nil for action types that are not modeled.
+func (a *PdfAction) GetContext() PdfModel {
+	if a == nil {
+		return nil
+	}
+	return a.context
+}
+
+// GetType returns the type of the action.
+func (a *PdfAction) GetType() PdfActionType {
+	return a.actionType
+}
+
+// Flatten returns the action followed by the actions of its Next chain, depth-first.
+func (a *PdfAction) Flatten() []*PdfAction {
+	actions := []*PdfAction{a}
+	for _, next := range a.Next {
+		actions = append(actions, next.Flatten()...)
+	}
+	return actions
+}
+
+// GetContainingPdfObject implements interface PdfModel.
+func (a *PdfAction) GetContainingPdfObject() core.PdfObject {
+	return a.container
+}
+
+// ToPdfObject implements interface PdfModel. Returns the action dictionary (as an indirect
+// object), written by the context if the action type is modeled.
+func (a *PdfAction) ToPdfObject() core.PdfObject {
+	if a.context != nil {
+		return a.context.ToPdfObject()
+	}
+	d := a.container.PdfObject.(*core.PdfObjectDictionary)
+	a.appendToPdfDictionary(d)
+	return a.container
+}
+
+// appendToPdfDictionary sets the entries common to all actions in the action dictionary `d`.
+func (a *PdfAction) appendToPdfDictionary(d *core.PdfObjectDictionary) {
+	d.Set("Type", core.MakeName("Action"))
+	d.Set("S", core.MakeName(string(a.actionType)))
+	d.Remove("Next")
+	switch len(a.Next) {
+	case 0:
+	case 1:
+		d.Set("Next", a.Next[0].ToPdfObject())
+	default:
+		arr := core.MakeArray()
+		for _, next := range a.Next {
+			arr.Append(next.ToPdfObject())
+		}
+		d.Set("Next", arr)
+	}
+}
+
+// actionDict returns the action dictionary of the container, with the common entries. The entries
+// which are not modeled (e.g. SD of GoTo actions, vendor keys) are kept.
+func (a *PdfAction) actionDict() *core.PdfObjectDictionary {
+	d := a.container.PdfObject.(*core.PdfObjectDictionary)
+	a.appendToPdfDictionary(d)
+	return d
+}
+
+// setActionEntry sets the entry `key` of the action dictionary `d` to `val`, or removes it if
+// `val` is nil.
+func setActionEntry(d *core.PdfObjectDictionary, key core.PdfObjectName, val core.PdfObject) {
+	if val == nil {
+		d.Remove(key)
+		return
+	}
+	d.Set(key, val)
+}
+
+// ToPdfObject implements interface PdfModel.
+func (a *PdfActionGoTo) ToPdfObject() core.PdfObject {
+	d := a.actionDict()
+	setActionEntry(d, "D", a.D)
+	return a.container
+}
+
+// ToPdfObject implements interface PdfModel.
+func (a *PdfActionGoToR) ToPdfObject() core.PdfObject {
+	d := a.actionDict()
+	setActionEntry(d, "F", a.F)
+	setActionEntry(d, "D", a.D)
+	setActionEntry(d, "NewWindow", a.NewWindow)
+	return a.container
+}
+
+// ToPdfObject implements interface PdfModel.
+func (a *PdfActionLaunch) ToPdfObject() core.PdfObject {
+	d := a.actionDict()
+	setActionEntry(d, "F", a.F)
+	setActionEntry(d, "Win", a.Win)
+	setActionEntry(d, "Mac", a.Mac)
+	setActionEntry(d, "Unix", a.Unix)
+	setActionEntry(d, "NewWindow", a.NewWindow)
+	return a.container
+}
+
+// ToPdfObject implements interface PdfModel.
+func (a *PdfActionURI) ToPdfObject() core.PdfObject {
+	d := a.actionDict()
+	setActionEntry(d, "URI", a.URI)
+	setActionEntry(d, "IsMap", a.IsMap)
+	return a.container
+}
+
+// ToPdfObject implements interface PdfModel.
+func (a *PdfActionNamed) ToPdfObject() core.PdfObject {
+	d := a.actionDict()
+	setActionEntry(d, "N", a.N)
+	return a.container
+}
+
+// ToPdfObject implements interface PdfModel.
+func (a *PdfActionSubmitForm) ToPdfObject() core.PdfObject {
+	d := a.actionDict()
+	setActionEntry(d, "F", a.F)
+	setActionEntry(d, "Fields", a.Fields)
+	setActionEntry(d, "Flags", a.Flags)
+	return a.container
+}
+
+// ToPdfObject implements interface PdfModel.
+func (a *PdfActionResetForm) ToPdfObject() core.PdfObject {
+	d := a.actionDict()
+	setActionEntry(d, "Fields", a.Fields)
+	setActionEntry(d, "Flags", a.Flags)
+	return a.container
+}
+
+// ToPdfObject implements interface PdfModel.
+func (a *PdfActionJavaScript) ToPdfObject() core.PdfObject {
+	d := a.actionDict()
+	setActionEntry(d, "JS", a.JS)
+	return a.container
+}
+
+// PdfAdditionalActions represents an additional-actions dictionary (AA entry of annotations,
+// pages, form fields and the catalog), which maps trigger events (e.g. O for page open, K for
+// field keystroke) to actions.
+type PdfAdditionalActions map[core.PdfObjectName]*PdfAction
+
+// NewPdfAdditionalActionsFromObject loads an additional-actions dictionary from `obj`. Invalid
+// actions are skipped.
+func NewPdfAdditionalActionsFromObject(obj core.PdfObject) (PdfAdditionalActions, error) {
+	d, ok := core.GetDict(obj)
+	if !ok {
+		return nil, fmt.Errorf("invalid additional-actions type: %T", obj)
+	}
+	aa := PdfAdditionalActions{}
+	for _, key := range d.Keys() {
+		action, err := NewPdfActionFromObject(d.Get(key))
+		if err != nil {
+			common.Log.Debug("Invalid additional action %s: %v - skipping", key, err)
+			continue
+		}
+		aa[key] = action
+	}
+	return aa, nil
+}
+
+// ToPdfObject returns the additional-actions dictionary, with the triggers sorted.
+func (aa PdfAdditionalActions) ToPdfObject() core.PdfObject {
+	keys := make([]string, 0, len(aa))
+	for key := range aa {
+		keys = append(keys, string(key))
+	}
+	sort.Strings(keys)
+
+	d := core.MakeDict()
+	for _, key := range keys {
+		d.Set(core.PdfObjectName(key), aa[core.PdfObjectName(key)].ToPdfObject())
+	}
+	return d
+}
+
+// loadAction returns the action of `obj`, or nil if `obj` is nil.
+func loadAction(obj core.PdfObject) (*PdfAction, error) {
+	if obj == nil {
+		return nil, nil
+	}
+	return NewPdfActionFromObject(obj)
+}
+
+// loadAdditionalActions returns the additional actions of `obj`, or nil if `obj` is nil.
+func loadAdditionalActions(obj core.PdfObject) (PdfAdditionalActions, error) {
+	if obj == nil {
+		return nil, nil
+	}
+	return NewPdfAdditionalActionsFromObject(obj)
+}
+
+// actionToPdfObject returns the action dictionary of `action`, or nil if `action` is nil.
+func actionToPdfObject(action *PdfAction) core.PdfObject {
+	if action == nil {
+		return nil
+	}
+	return action.ToPdfObject()
+}
+
+// additionalActionsToPdfObject returns the dictionary of `aa`, or nil if `aa` is empty.
+func additionalActionsToPdfObject(aa PdfAdditionalActions) core.PdfObject {
+	if len(aa) == 0 {
+		return nil
+	}
+	return aa.ToPdfObject()
+}
+
+// GetAction returns the action of the link (A entry), or nil if the link has none.
+func (link *PdfAnnotationLink) GetAction() (*PdfAction, error) {
+	return loadAction(link.A)
+}
+
+// SetAction sets the action of the link (nil to remove it).
+func (link *PdfAnnotationLink) SetAction(action *PdfAction) {
+	link.A = actionToPdfObject(action)
+}
+
+// GetAction returns the action of the widget (A entry), activated when the widget is clicked,
+// or nil if the widget has none.
+func (widget *PdfAnnotationWidget) GetAction() (*PdfAction, error) {
+	return loadAction(widget.A)
+}
+
+// SetAction sets the action of the widget (nil to remove it).
+func (widget *PdfAnnotationWidget) SetAction(action *PdfAction) {
+	widget.A = actionToPdfObject(action)
+}
+
+// GetAdditionalActions returns the additional actions of the widget (AA entry), or nil if the
+// widget has none.
+func (widget *PdfAnnotationWidget) GetAdditionalActions() (PdfAdditionalActions, error) {
+	return loadAdditionalActions(widget.AA)
+}
+
+// SetAdditionalActions sets the additional actions of the widget.
+func (widget *PdfAnnotationWidget) SetAdditionalActions(aa PdfAdditionalActions) {
+	widget.AA = additionalActionsToPdfObject(aa)
+}
+
+// GetAdditionalActions returns the additional actions of the field (AA entry), or nil if the
+// field has none.
+func (f *PdfField) GetAdditionalActions() (PdfAdditionalActions, error) {
+	return loadAdditionalActions(f.AA)
+}
+
+// SetAdditionalActions sets the additional actions of the field.
+func (f *PdfField) SetAdditionalActions(aa PdfAdditionalActions) {
+	f.AA = additionalActionsToPdfObject(aa)
+}
+
+// GetAdditionalActions returns the additional actions of the page (AA entry), or nil if the page
+// has none.
+func (p *PdfPage) GetAdditionalActions() (PdfAdditionalActions, error) {
+	return loadAdditionalActions(p.AA)
+}
+
+// SetAdditionalActions sets the additional actions of the page.
+func (p *PdfPage) SetAdditionalActions(aa PdfAdditionalActions) {
+	p.AA = additionalActionsToPdfObject(aa)
+}
+
+// GetAction returns the action of the outline item (A entry), or nil if the item has none.
+func (oi *PdfOutlineItem) GetAction() (*PdfAction, error) {
+	return loadAction(oi.A)
+}
+
+// SetAction sets the action of the outline item (nil to remove it).
+func (oi *PdfOutlineItem) SetAction(action *PdfAction) {
+	oi.A = actionToPdfObject(action)
+}
+
+// GetOpenAction returns the action performed when the document is opened (catalog OpenAction),
+// or nil if the document has none. Destinations are returned as go-to actions.
+func (r *PdfReader) GetOpenAction() (*PdfAction, error) {
+	obj := core.ResolveReference(r.catalog.Get("OpenAction"))
+	if obj == nil {
+		return nil, nil
+	}
+	if _, ok := core.GetArray(obj); ok {
+		action := NewPdfActionGoTo()
+		action.D = obj
+		return action.PdfAction, nil
+	}
+	return NewPdfActionFromObject(obj)
+}
+
+// GetActions returns all the actions of the document, including the actions of Next chains: the
+// open action, the outline item actions, the page additional actions, the link and widget
+// actions of the page annotations and the form field additional actions. Actions shared by
+// several objects (e.g. merged fields and widgets) are returned once. Invalid actions are
+// skipped.
+func (r *PdfReader) GetActions() ([]*PdfAction, error) {
+	var actions []*PdfAction
+	seen := map[core.PdfObject]struct{}{}
+	add := func(action *PdfAction) {
+		if action == nil {
+			return
+		}
+		for _, a := range action.Flatten() {
+			if _, ok := seen[a.container.PdfObject]; ok {
+				continue
+			}
+			seen[a.container.PdfObject] = struct{}{}
+			actions = append(actions, a)
+		}
+	}
+	addAA := func(aa PdfAdditionalActions) {
+		keys := make([]string, 0, len(aa))
+		for key := range aa {
+			keys = append(keys, string(key))
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			add(aa[core.PdfObjectName(key)])
+		}
+	}
+
+	action, err := r.GetOpenAction()
+	if err != nil {
+		common.Log.Debug("Invalid open action: %v - skipping", err)
+	}
+	add(action)
+
+	visitedItems := map[*PdfOutlineItem]struct{}{}
+	var walkOutline func(node *PdfOutlineTreeNode)
+	walkOutline = func(node *PdfOutlineTreeNode) {
+		for node != nil {
+			item, ok := node.getOuter().(*PdfOutlineItem)
+			if !ok {
+				break
+			}
+			if _, ok := visitedItems[item]; ok {
+				break
+			}
+			visitedItems[item] = struct{}{}
+			node = item.Next
+
+			action, err := item.GetAction()
+			if err != nil {
+				common.Log.Debug("Invalid outline item action: %v - skipping", err)
+			}
+			add(action)
+			walkOutline(item.First)
+		}
+	}
+	if root := r.GetOutlineTree(); root != nil {
+		walkOutline(root.First)
+	}
+
+	numPages, err := r.GetNumPages()
+	if err != nil {
+		return nil, err
+	}
+	for i := 1; i <= numPages; i++ {
+		page, err := r.GetPage(i)
+		if err != nil {
+			return nil, err
+		}
+		aa, err := page.GetAdditionalActions()
+		if err != nil {
+			common.Log.Debug("Invalid additional actions of page %d: %v - skipping", i, err)
+		}
+		addAA(aa)
+
+		annotations, err := page.GetAnnotations()
+		if err != nil {
+			common.Log.Debug("Invalid annotations of page %d: %v - skipping", i, err)
+		}
+		for _, annot := range annotations {
+			switch t := annot.GetContext().(type) {
+			case *PdfAnnotationLink:
+				action, err := t.GetAction()
+				if err != nil {
+					common.Log.Debug("Invalid link action on page %d: %v - skipping", i, err)
+				}
+				add(action)
+			case *PdfAnnotationWidget:
+				action, err := t.GetAction()
+				if err != nil {
+					common.Log.Debug("Invalid widget action on page %d: %v - skipping", i, err)
+				}
+				add(action)
+				aa, err := t.GetAdditionalActions()
+				if err != nil {
+					common.Log.Debug("Invalid widget additional actions on page %d: %v - skipping", i, err)
+				}
+				addAA(aa)
+			}
+		}
+	}
+
+	if r.AcroForm != nil {
+		for _, field := range r.AcroForm.AllFields() {
+			aa, err := field.GetAdditionalActions()
+			if err != nil {
+				common.Log.Debug("Invalid field additional actions: %v - skipping", err)
+			}
+			addAA(aa)
+		}
+	}
+	return actions, nil
+}
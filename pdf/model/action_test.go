@@ -0,0 +1,226 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/finalversus/doc/pdf/core"
+)
+
+func TestActionFromObject(t *testing.T) {
+	// URI action followed by a JavaScript action and an action of a type that is not modeled.
+	js := core.MakeDict()
+	js.Set("S", core.MakeName("JavaScript"))
+	js.Set("JS", core.MakeString("app.alert('hi');"))
+	hide := core.MakeDict()
+	hide.Set("S", core.MakeName("Hide"))
+	hide.Set("T", core.MakeString("field"))
+	uri := core.MakeDict()
+	uri.Set("Type", core.MakeName("Action"))
+	uri.Set("S", core.MakeName("URI"))
+	uri.Set("URI", core.MakeString("https://example.com"))
+	uri.Set("Next", core.MakeArray(core.MakeIndirectObject(js), hide))
+
+	action, err := NewPdfActionFromObject(uri)
+	require.NoError(t, err)
+	require.Equal(t, ActionTypeURI, action.GetType())
+	uriAction, ok := action.GetContext().(*PdfActionURI)
+	require.True(t, ok)
+	require.Equal(t, "https://example.com", uriAction.URI.(*core.PdfObjectString).Str())
+
+	actions := action.Flatten()
+	require.Len(t, actions, 3)
+	jsAction, ok := actions[1].GetContext().(*PdfActionJavaScript)
+	require.True(t, ok)
+	require.Equal(t, "app.alert('hi');", jsAction.JS.(*core.PdfObjectString).Str())
+	require.Equal(t, ActionTypeHide, actions[2].GetType())
+	require.Nil(t, actions[2].GetContext())
+
+	// Writing keeps the entries of actions that are not modeled.
+	d, ok := core.GetDict(action.ToPdfObject())
+	require.True(t, ok)
+	next, ok := core.GetArray(d.Get("Next"))
+	require.True(t, ok)
+	require.Equal(t, 2, next.Len())
+	hideDict, ok := core.GetDict(next.Get(1))
+	require.True(t, ok)
+	require.Equal(t, "field", hideDict.Get("T").(*core.PdfObjectString).Str())
+
+	// Loops in the Next chain are broken.
+	named := core.MakeDict()
+	named.Set("S", core.MakeName("Named"))
+	named.Set("N", core.MakeName("NextPage"))
+	named.Set("Next", named)
+	action, err = NewPdfActionFromObject(named)
+	require.NoError(t, err)
+	require.Len(t, action.Flatten(), 1)
+
+	for _, obj := range []core.PdfObject{core.MakeDict(), core.MakeName("URI"), nil} {
+		_, err := NewPdfActionFromObject(obj)
+		require.Error(t, err)
+	}
+}
+
+func TestActionUnmodeledEntries(t *testing.T) {
+	goTo := core.MakeDict()
+	goTo.Set("S", core.MakeName("GoTo"))
+	goTo.Set("D", core.MakeName("Chapter1"))
+	goTo.Set("SD", core.MakeArray(core.MakeInteger(0)))
+	goTo.Set("XVendor", core.MakeBool(true))
+	submit := core.MakeDict()
+	submit.Set("S", core.MakeName("SubmitForm"))
+	submit.Set("F", core.MakeString("https://example.com/submit"))
+	submit.Set("Flags", core.MakeInteger(4))
+	submit.Set("CharSet", core.MakeString("utf-8"))
+	goTo.Set("Next", submit)
+
+	link := NewPdfAnnotationLink()
+	link.A = core.MakeIndirectObject(goTo)
+	action, err := link.GetAction()
+	require.NoError(t, err)
+	link.SetAction(action)
+
+	d, ok := core.GetDict(link.A)
+	require.True(t, ok)
+	require.Equal(t, "/Chapter1", d.Get("D").WriteString())
+	require.Equal(t, "[0]", d.Get("SD").WriteString())
+	require.Equal(t, "true", d.Get("XVendor").WriteString())
+	require.Equal(t, "/Action", d.Get("Type").WriteString())
+	next, ok := core.GetDict(d.Get("Next"))
+	require.True(t, ok)
+	require.Equal(t, "utf-8", next.Get("CharSet").(*core.PdfObjectString).Str())
+
+	// Modeled entries are updated or removed.
+	goToAction := action.GetContext().(*PdfActionGoTo)
+	goToAction.D = core.MakeName("Chapter2")
+	submitAction := action.Next[0].GetContext().(*PdfActionSubmitForm)
+	submitAction.Flags = nil
+	link.SetAction(action)
+	d, ok = core.GetDict(link.A)
+	require.True(t, ok)
+	require.Equal(t, "/Chapter2", d.Get("D").WriteString())
+	require.Equal(t, "[0]", d.Get("SD").WriteString())
+	next, ok = core.GetDict(d.Get("Next"))
+	require.True(t, ok)
+	require.Nil(t, next.Get("Flags"))
+	require.NotNil(t, next.Get("CharSet"))
+}
+
+func TestActionsInvalidEntries(t *testing.T) {
+	w := NewPdfWriter()
+	page := NewPdfPage()
+	page.MediaBox = &PdfRectangle{Urx: 100, Ury: 100}
+	rect := core.MakeArray(core.MakeInteger(0), core.MakeInteger(0), core.MakeInteger(10), core.MakeInteger(10))
+
+	// Link with an action without type, and link with a URI action followed by an invalid action
+	// and a named action.
+	broken := NewPdfAnnotationLink()
+	broken.Rect = rect
+	broken.A = core.MakeDict()
+	page.AddAnnotation(broken.PdfAnnotation)
+	named := NewPdfActionNamed()
+	named.N = core.MakeName("NextPage")
+	uri := NewPdfActionURI()
+	uri.URI = core.MakeString("https://example.com")
+	link := NewPdfAnnotationLink()
+	link.Rect = rect
+	link.SetAction(uri.PdfAction)
+	uriDict, ok := core.GetDict(link.A)
+	require.True(t, ok)
+	uriDict.Set("Next", core.MakeArray(core.MakeName("Invalid"), named.ToPdfObject()))
+	page.AddAnnotation(link.PdfAnnotation)
+
+	// Page additional actions with an invalid open action.
+	js := NewPdfActionJavaScript()
+	js.JS = core.MakeString("app.alert('bye');")
+	aa := core.MakeDict()
+	aa.Set("O", core.MakeInteger(1))
+	aa.Set("C", js.ToPdfObject())
+	page.AA = aa
+	require.NoError(t, w.AddPage(page))
+	reader := writeTestDocument(t, &w)
+
+	actions, err := reader.GetActions()
+	require.NoError(t, err)
+	var types []PdfActionType
+	for _, action := range actions {
+		types = append(types, action.GetType())
+	}
+	require.Equal(t, []PdfActionType{ActionTypeJavaScript, ActionTypeURI, ActionTypeNamed}, types)
+
+	readPage, err := reader.GetPage(1)
+	require.NoError(t, err)
+	readAA, err := readPage.GetAdditionalActions()
+	require.NoError(t, err)
+	require.Len(t, readAA, 1)
+	require.NotNil(t, readAA["C"])
+}
+
+func TestActionsReadWrite(t *testing.T) {
+	w := NewPdfWriter()
+	w.catalog.Set("OpenAction", core.MakeArray(core.MakeInteger(0), core.MakeName("Fit")))
+
+	page := NewPdfPage()
+	page.MediaBox = &PdfRectangle{Urx: 100, Ury: 100}
+
+	// Link with a URI action followed by a launch action.
+	launch := NewPdfActionLaunch()
+	launch.F = core.MakeString("calc.exe")
+	uri := NewPdfActionURI()
+	uri.URI = core.MakeString("https://example.com")
+	uri.Next = []*PdfAction{launch.PdfAction}
+	link := NewPdfAnnotationLink()
+	link.Rect = core.MakeArray(core.MakeInteger(0), core.MakeInteger(0), core.MakeInteger(10), core.MakeInteger(10))
+	link.SetAction(uri.PdfAction)
+	page.AddAnnotation(link.PdfAnnotation)
+
+	// Page open action.
+	named := NewPdfActionNamed()
+	named.N = core.MakeName("FirstPage")
+	page.SetAdditionalActions(PdfAdditionalActions{"O": named.PdfAction})
+	require.NoError(t, w.AddPage(page))
+
+	// Outline item with a go-to action.
+	goTo := NewPdfActionGoTo()
+	goTo.D = core.MakeString("intro")
+	outline := NewPdfOutline()
+	item := NewPdfOutlineItem()
+	item.Title = core.MakeString("Introduction")
+	item.SetAction(goTo.PdfAction)
+	item.Parent = &outline.PdfOutlineTreeNode
+	outline.First = &item.PdfOutlineTreeNode
+	outline.Last = &item.PdfOutlineTreeNode
+	w.AddOutlineTree(&outline.PdfOutlineTreeNode)
+
+	reader := writeTestDocument(t, &w)
+
+	openAction, err := reader.GetOpenAction()
+	require.NoError(t, err)
+	require.Equal(t, ActionTypeGoTo, openAction.GetType())
+
+	actions, err := reader.GetActions()
+	require.NoError(t, err)
+	var types []PdfActionType
+	for _, action := range actions {
+		types = append(types, action.GetType())
+	}
+	require.Equal(t, []PdfActionType{
+		ActionTypeGoTo, ActionTypeGoTo, ActionTypeNamed, ActionTypeURI, ActionTypeLaunch,
+	}, types)
+
+	goToAction := actions[1].GetContext().(*PdfActionGoTo)
+	require.Equal(t, "intro", goToAction.D.(*core.PdfObjectString).Str())
+	uriAction := actions[3].GetContext().(*PdfActionURI)
+	require.Equal(t, "https://example.com", uriAction.URI.(*core.PdfObjectString).Str())
+	launchAction := actions[4].GetContext().(*PdfActionLaunch)
+	require.Equal(t, "calc.exe", launchAction.F.(*core.PdfObjectString).Str())
+
+	// Removing actions.
+	page, err = reader.GetPage(1)
+	require.NoError(t, err)
+	page.SetAdditionalActions(nil)
+	aa, err := page.GetAdditionalActions()
+	require.NoError(t, err)
+	require.Nil(t, aa)
+}
@@ -13,6 +13,7 @@ import (
 
 	"github.com/finalversus/doc/common"
 	"github.com/finalversus/doc/pdf/core"
+	"github.com/finalversus/doc/pdf/model/xmp"
 )
 
 // PdfAppender appends new PDF content to an existing PDF document via incremental updates.
@@ -23,6 +24,20 @@ type PdfAppender struct {
 	Reader   *PdfReader
 	pages    []*PdfPage
 	acroForm *PdfAcroForm
+	info     *PdfInfo
+	xmp      *xmp.Document
+
+	pageLabels []PdfPageLabelRange
+
+	// Viewer settings of the catalog (see SetPageMode, SetPageLayout, SetViewerPreferences and
+	// SetOpenAction).
+	pageMode    PageMode
+	pageLayout  PageLayout
+	viewerPrefs *ViewerPreferences
+	openAction  core.PdfObject
+
+	// Changes of the document-level attachments (see AddAttachment and RemoveAttachment).
+	attachmentOps []attachmentOp
 
 	xrefs          core.XrefTable
 	greatestObjNum int
@@ -98,6 +113,9 @@ func getPageResources(p *PdfPage) map[core.PdfObjectName]core.PdfObject {
 
 // NewPdfAppender creates a new Pdf appender from a Pdf reader.
 func NewPdfAppender(reader *PdfReader) (*PdfAppender, error) {
+	if err := reader.ensurePageTree(); err != nil {
+		return nil, err
+	}
 	a := &PdfAppender{
 		rs:        reader.rs,
 		Reader:    reader,
@@ -459,6 +477,30 @@ func (a *PdfAppender) Write(w io.Writer) error {
 	}
 
 	writer := NewPdfWriter()
+	if a.info != nil {
+		writer.SetDocInfo(a.info)
+	}
+	xmpDoc := a.xmp
+	if xmpDoc == nil && a.info != nil {
+		// Keep the XMP metadata of the document consistent with the updated info dictionary.
+		doc, err := a.roReader.GetXMP()
+		if err != nil {
+			common.Log.Debug("ERROR: Unable to load XMP metadata: %v - not updating it", err)
+		}
+		xmpDoc = doc
+	}
+	if xmpDoc != nil {
+		writer.SetXMP(xmpDoc)
+	}
+	if a.pageLabels != nil {
+		if err := writer.SetPageLabels(a.pageLabels); err != nil {
+			return err
+		}
+	}
+	a.applyViewerSettings(&writer)
+	if err := a.applyAttachments(&writer); err != nil {
+		return err
+	}
 
 	pagesDict, ok := core.GetDict(writer.pages)
 	if !ok {
@@ -597,7 +639,7 @@ func (a *PdfAppender) Write(w io.Writer) error {
 		return err
 	}
 
-	if len(a.newObjects) == 0 {
+	if len(a.newObjects) == 0 && !a.updatesCatalog() {
 		return nil
 	}
 
@@ -0,0 +1,328 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/finalversus/doc/common"
+	"github.com/finalversus/doc/pdf/core"
+)
+
+// GetAttachments returns the document-level attachments (EmbeddedFiles name tree of the catalog
+// Names dictionary), in the order of their names.
+func (r *PdfReader) GetAttachments() ([]*PdfFileSpec, error) {
+	names, ok := core.GetDict(r.catalog.Get("Names"))
+	if !ok {
+		return nil, nil
+	}
+	obj := names.Get("EmbeddedFiles")
+	if obj == nil {
+		return nil, nil
+	}
+	tree, err := NewPdfNameTreeFromObject(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	var attachments []*PdfFileSpec
+	err = tree.Walk(func(name string, value core.PdfObject) error {
+		fs, err := NewPdfFileSpecFromObject(value)
+		if err != nil {
+			return fmt.Errorf("attachment %q: %v", name, err)
+		}
+		if fs.FileName == "" {
+			fs.FileName = name
+		}
+		attachments = append(attachments, fs)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return attachments, nil
+}
+
+// GetFileSpec returns the file specification of the file attachment annotation.
+func (annot *PdfAnnotationFileAttachment) GetFileSpec() (*PdfFileSpec, error) {
+	if annot.FS == nil {
+		return nil, nil
+	}
+	return NewPdfFileSpecFromObject(annot.FS)
+}
+
+// SetFileSpec sets the file specification of the file attachment annotation.
+func (annot *PdfAnnotationFileAttachment) SetFileSpec(fs *PdfFileSpec) {
+	if fs == nil {
+		annot.FS = nil
+		return
+	}
+	annot.FS = fs.ToPdfObject()
+}
+
+// AddFileAttachmentAnnotation adds a file attachment annotation of the file `fs` to the page,
+// with icon drawn in `rect`. The file description (or name) is used as annotation text.
+func (page *PdfPage) AddFileAttachmentAnnotation(fs *PdfFileSpec, rect *PdfRectangle) *PdfAnnotationFileAttachment {
+	annot := NewPdfAnnotationFileAttachment()
+	annot.Rect = rect.ToPdfObject()
+	text := fs.Description
+	if text == "" {
+		text = fs.FileName
+	}
+	annot.Contents = NewPdfInfoText(text)
+	annot.SetFileSpec(fs)
+	page.AddAnnotation(annot.PdfAnnotation)
+	return annot
+}
+
+// RemoveFileAttachmentAnnotations removes the file attachment annotations of the file named
+// `fileName` from the page and returns the number of removed annotations.
+func (page *PdfPage) RemoveFileAttachmentAnnotations(fileName string) (int, error) {
+	annots, err := page.GetAnnotations()
+	if err != nil {
+		return 0, err
+	}
+
+	// A non-nil list, so that the page Annots entry is not written again when empty.
+	kept := []*PdfAnnotation{}
+	removed := 0
+	for _, annot := range annots {
+		if fa, ok := annot.GetContext().(*PdfAnnotationFileAttachment); ok {
+			fs, err := fa.GetFileSpec()
+			if err != nil {
+				return 0, err
+			}
+			if fs != nil && fs.FileName == fileName {
+				removed++
+				continue
+			}
+		}
+		kept = append(kept, annot)
+	}
+	if removed > 0 {
+		page.SetAnnotations(kept)
+	}
+	return removed, nil
+}
+
+// AddAttachment adds the document-level attachment `fs` to the output document (EmbeddedFiles
+// name tree of the catalog Names dictionary), replacing any attachment with the same file name.
+// Files with an AFRelationship are also listed as associated files of the document (catalog AF
+// array), as required by PDF/A-3.
+func (w *PdfWriter) AddAttachment(fs *PdfFileSpec) error {
+	if fs == nil || fs.FileName == "" {
+		return errors.New("attachment without file name")
+	}
+	w.RemoveAttachment(fs.FileName)
+	w.attachments = append(w.attachments, fs)
+	return nil
+}
+
+// RemoveAttachment removes the attachment named `fileName` added with AddAttachment and returns
+// false if there is none.
+func (w *PdfWriter) RemoveAttachment(fileName string) bool {
+	for i, fs := range w.attachments {
+		if fs.FileName == fileName {
+			w.attachments = append(w.attachments[:i], w.attachments[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// writeAttachments sets the attachments of the writer in the EmbeddedFiles name tree and the
+// catalog AF array.
+func (w *PdfWriter) writeAttachments() error {
+	tree := NewPdfNameTree()
+	var af []core.PdfObject
+	for _, fs := range w.attachments {
+		obj := fs.ToPdfObject()
+		if err := tree.Set(fs.FileName, obj); err != nil {
+			return err
+		}
+		if fs.Relationship != "" {
+			af = append(af, obj)
+		}
+	}
+	w.setNameTree("EmbeddedFiles", tree)
+
+	if len(af) > 0 {
+		arr := core.MakeArray(af...)
+		w.catalog.Set("AF", arr)
+		return w.addObjects(arr)
+	}
+	return nil
+}
+
+// attachmentOp is a change of the document-level attachments made by an appender. A nil `fs`
+// removes the attachment named `name`.
+type attachmentOp struct {
+	name string
+	fs   *PdfFileSpec
+}
+
+// AddAttachment adds the document-level attachment `fs`, replacing any attachment of the
+// document with the same file name (see PdfWriter.AddAttachment).
+func (a *PdfAppender) AddAttachment(fs *PdfFileSpec) error {
+	if fs == nil || fs.FileName == "" {
+		return errors.New("attachment without file name")
+	}
+	a.attachmentOps = append(a.attachmentOps, attachmentOp{name: fs.FileName, fs: fs})
+	return nil
+}
+
+// RemoveAttachment removes the document-level attachment named `fileName`. Attachments that are
+// not found are ignored.
+func (a *PdfAppender) RemoveAttachment(fileName string) {
+	a.attachmentOps = append(a.attachmentOps, attachmentOp{name: fileName})
+}
+
+// AddFileAttachmentAnnotation adds a file attachment annotation of the file `fs` to page
+// `pageNum` (see PdfPage.AddFileAttachmentAnnotation).
+func (a *PdfAppender) AddFileAttachmentAnnotation(pageNum int, fs *PdfFileSpec, rect *PdfRectangle) error {
+	pageIndex := pageNum - 1
+	if pageIndex < 0 || pageIndex > len(a.pages)-1 {
+		return fmt.Errorf("page %d not found", pageNum)
+	}
+	page := a.pages[pageIndex].Duplicate()
+	annots, err := page.GetAnnotations()
+	if err != nil {
+		return err
+	}
+	page.SetAnnotations(append([]*PdfAnnotation{}, annots...))
+	page.AddFileAttachmentAnnotation(fs, rect)
+
+	procPage(page)
+	a.pages[pageIndex] = page
+	return nil
+}
+
+// RemoveFileAttachmentAnnotations removes the file attachment annotations of the file named
+// `fileName` from page `pageNum` and returns the number of removed annotations.
+func (a *PdfAppender) RemoveFileAttachmentAnnotations(pageNum int, fileName string) (int, error) {
+	pageIndex := pageNum - 1
+	if pageIndex < 0 || pageIndex > len(a.pages)-1 {
+		return 0, fmt.Errorf("page %d not found", pageNum)
+	}
+	page := a.pages[pageIndex].Duplicate()
+	removed, err := page.RemoveFileAttachmentAnnotations(fileName)
+	if err != nil || removed == 0 {
+		return 0, err
+	}
+
+	procPage(page)
+	a.pages[pageIndex] = page
+	return removed, nil
+}
+
+// applyAttachments applies the attachment changes of the appender to the catalog of `writer`.
+// Entries of the original Names dictionary and AF array are kept and are not written again.
+func (a *PdfAppender) applyAttachments(writer *PdfWriter) error {
+	if len(a.attachmentOps) == 0 {
+		return nil
+	}
+
+	names := core.MakeDict()
+	tree := NewPdfNameTree()
+	if origNames, ok := core.GetDict(a.roReader.catalog.Get("Names")); ok {
+		for _, key := range origNames.Keys() {
+			if key != "EmbeddedFiles" {
+				names.Set(key, origNames.Get(key))
+			}
+		}
+		if obj := origNames.Get("EmbeddedFiles"); obj != nil {
+			origTree, err := NewPdfNameTreeFromObject(obj)
+			if err != nil {
+				return err
+			}
+			tree = origTree
+		}
+	}
+
+	changed := map[string]struct{}{}
+	for _, op := range a.attachmentOps {
+		changed[op.name] = struct{}{}
+		keys, err := attachmentKeys(tree, op.name)
+		if err != nil {
+			return err
+		}
+		// A replaced attachment keeps the key of its first entry.
+		for i, key := range keys {
+			if i == 0 && op.fs != nil {
+				continue
+			}
+			if _, err := tree.Remove(key); err != nil {
+				return err
+			}
+		}
+		if op.fs == nil {
+			continue
+		}
+		key := op.name
+		if len(keys) > 0 {
+			key = keys[0]
+		}
+		if err := tree.Set(key, op.fs.ToPdfObject()); err != nil {
+			return err
+		}
+	}
+	names.Set("EmbeddedFiles", tree.ToPdfObject())
+	writer.catalog.Set("Names", names)
+	a.addNewObjects(names)
+
+	// Associated files: keep the unchanged files of the original document.
+	var af []core.PdfObject
+	if origAF, ok := core.GetArray(a.roReader.catalog.Get("AF")); ok {
+		for _, obj := range origAF.Elements() {
+			if dict, ok := core.GetDict(obj); ok {
+				if _, ok := changed[fileSpecName(dict)]; ok {
+					continue
+				}
+			}
+			af = append(af, obj)
+		}
+	}
+	for _, op := range a.attachmentOps {
+		if op.fs == nil || op.fs.Relationship == "" || !a.isLastAttachmentOp(op) {
+			continue
+		}
+		af = append(af, op.fs.GetContainingPdfObject())
+	}
+	if len(af) > 0 {
+		arr := core.MakeArray(af...)
+		writer.catalog.Set("AF", arr)
+		a.addNewObjects(arr)
+	} else if a.roReader.catalog.Get("AF") != nil {
+		writer.catalog.Set("AF", core.MakeArray())
+	}
+	return nil
+}
+
+// attachmentKeys returns the keys of the attachments of the EmbeddedFiles name tree `tree` named
+// `fileName`. The keys may differ from the file names of the file specifications (e.g. generated
+// or UTF-16 encoded keys), which are used as in GetAttachments.
+func attachmentKeys(tree *PdfNameTree, fileName string) ([]string, error) {
+	var keys []string
+	err := tree.Walk(func(key string, value core.PdfObject) error {
+		name := key
+		if fs, err := NewPdfFileSpecFromObject(value); err != nil {
+			common.Log.Debug("Invalid attachment %q: %v", key, err)
+		} else if fs.FileName != "" {
+			name = fs.FileName
+		}
+		if name == fileName {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	return keys, err
+}
+
+// isLastAttachmentOp returns true if `op` is the last change of the attachment it refers to.
+func (a *PdfAppender) isLastAttachmentOp(op attachmentOp) bool {
+	for i := len(a.attachmentOps) - 1; i >= 0; i-- {
+		if a.attachmentOps[i].name == op.name {
+			return a.attachmentOps[i].fs == op.fs
+		}
+	}
+	return false
+}
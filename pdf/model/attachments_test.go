@@ -0,0 +1,237 @@
+package model
+
+import (
+	"bytes"
+	"crypto/md5"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/finalversus/doc/pdf/core"
+)
+
+func TestEmbeddedFileFromObject(t *testing.T) {
+	content := []byte("<invoice><total>42</total></invoice>")
+	file := NewEmbeddedFile(content, "text/xml")
+	file.CreationDate = time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+
+	stream, ok := core.GetStream(file.ToPdfObject())
+	require.True(t, ok)
+	typ, _ := core.GetNameVal(stream.Get("Type"))
+	require.Equal(t, "EmbeddedFile", typ)
+	require.Equal(t, "/text#2fxml", stream.Get("Subtype").WriteString())
+
+	readFile, err := NewEmbeddedFileFromObject(stream)
+	require.NoError(t, err)
+	require.Equal(t, content, readFile.Content)
+	require.Equal(t, "text/xml", readFile.Subtype)
+	require.True(t, file.CreationDate.Equal(readFile.CreationDate))
+	require.True(t, readFile.ModDate.IsZero())
+	sum := md5.Sum(content)
+	require.Equal(t, sum[:], readFile.CheckSum)
+	require.True(t, readFile.CheckSumValid())
+
+	readFile.Content = []byte("tampered")
+	require.False(t, readFile.CheckSumValid())
+
+	_, err = NewEmbeddedFileFromObject(core.MakeDict())
+	require.Error(t, err)
+}
+
+func TestEmbeddedFileChecksumUpdate(t *testing.T) {
+	stream, ok := core.GetStream(NewEmbeddedFile([]byte("data"), "").ToPdfObject())
+	require.True(t, ok)
+	file, err := NewEmbeddedFileFromObject(stream)
+	require.NoError(t, err)
+	require.NotNil(t, file.CheckSum)
+
+	// The checksum of the loaded file is recomputed for the new content.
+	file.Content = []byte("new data")
+	readFile, err := NewEmbeddedFileFromObject(file.ToPdfObject())
+	require.NoError(t, err)
+	require.Equal(t, []byte("new data"), readFile.Content)
+	require.True(t, readFile.CheckSumValid())
+
+	// Checksums set with the content are kept.
+	sum := md5.Sum([]byte("other data"))
+	readFile.Content = []byte("other")
+	readFile.CheckSum = sum[:]
+	readFile, err = NewEmbeddedFileFromObject(readFile.ToPdfObject())
+	require.NoError(t, err)
+	require.Equal(t, sum[:], readFile.CheckSum)
+}
+
+func TestFileSpecUnmodeledEntries(t *testing.T) {
+	stream, err := core.MakeStream([]byte("data"), core.NewRawEncoder())
+	require.NoError(t, err)
+	stream.Set("Type", core.MakeName("EmbeddedFile"))
+	params := core.MakeDict()
+	params.Set("Mac", core.MakeDict())
+	stream.Set("Params", params)
+	ef := core.MakeDict()
+	ef.Set("F", stream)
+	ef.Set("RF", core.MakeDict())
+	dict := core.MakeDict()
+	dict.Set("FS", core.MakeName("URL"))
+	dict.Set("F", core.MakeString("data.bin"))
+	dict.Set("CI", core.MakeDict())
+	dict.Set("EF", ef)
+
+	fs, err := NewPdfFileSpecFromObject(core.MakeIndirectObject(dict))
+	require.NoError(t, err)
+	require.Equal(t, "data.bin", fs.FileName)
+	require.Equal(t, []byte("data"), fs.File.Content)
+
+	// Unchanged specifications and files are written as loaded.
+	require.Equal(t, dict, core.TraceToDirectObject(fs.ToPdfObject()))
+	require.Equal(t, []core.PdfObjectName{"FS", "F", "CI", "EF"}, dict.Keys())
+	require.Equal(t, []core.PdfObjectName{"F", "RF"}, ef.Keys())
+	require.Equal(t, stream, ef.Get("F"))
+	require.Equal(t, stream, fs.File.ToPdfObject())
+	require.Nil(t, stream.Get("Filter"))
+
+	// Only the entries of the changed fields are updated.
+	fs.Description = "Data"
+	fs.File.Content = []byte("new data")
+	fs.ToPdfObject()
+	require.Equal(t, "/URL", dict.Get("FS").WriteString())
+	require.NotNil(t, dict.Get("CI"))
+	require.NotNil(t, dict.Get("Desc"))
+	require.Nil(t, dict.Get("UF"))
+	require.Equal(t, ef, dict.Get("EF"))
+	require.Equal(t, "/FlateDecode", stream.Get("Filter").WriteString())
+	readFile, err := NewEmbeddedFileFromObject(stream)
+	require.NoError(t, err)
+	require.Equal(t, []byte("new data"), readFile.Content)
+	require.True(t, readFile.CheckSumValid())
+	streamParams, ok := core.GetDict(stream.Get("Params"))
+	require.True(t, ok)
+	require.NotNil(t, streamParams.Get("Mac"))
+
+	// Another file replaces the embedded file entries.
+	fs.File = NewEmbeddedFile([]byte("other"), "")
+	fs.ToPdfObject()
+	newEF, ok := core.GetDict(dict.Get("EF"))
+	require.True(t, ok)
+	require.Nil(t, newEF.Get("RF"))
+	require.Equal(t, fs.File.ToPdfObject(), newEF.Get("UF"))
+}
+
+func TestAttachmentsReadWrite(t *testing.T) {
+	w := NewPdfWriter()
+	source := NewPdfFileSpec("source.xml", NewEmbeddedFile([]byte("<a/>"), "text/xml"))
+	source.Description = "Source data"
+	source.Relationship = AFRelationshipSource
+	require.NoError(t, w.AddAttachment(source))
+	require.NoError(t, w.AddAttachment(NewPdfFileSpec("audit.log", NewEmbeddedFile([]byte("old"), "text/plain"))))
+	require.NoError(t, w.AddAttachment(NewPdfFileSpec("audit.log", NewEmbeddedFile([]byte("log"), "text/plain"))))
+	require.NoError(t, w.AddAttachment(NewPdfFileSpec("removed.txt", NewEmbeddedFile(nil, ""))))
+	require.True(t, w.RemoveAttachment("removed.txt"))
+	require.False(t, w.RemoveAttachment("removed.txt"))
+	require.Error(t, w.AddAttachment(NewPdfFileSpec("", nil)))
+
+	page := NewPdfPage()
+	page.MediaBox = &PdfRectangle{Urx: 100, Ury: 100}
+	sheet := NewPdfFileSpec("sheet.csv", NewEmbeddedFile([]byte("a,b\n1,2\n"), "text/csv"))
+	page.AddFileAttachmentAnnotation(sheet, &PdfRectangle{Llx: 10, Lly: 10, Urx: 30, Ury: 30})
+	require.NoError(t, w.AddPage(page))
+	reader := writeTestDocument(t, &w)
+
+	attachments, err := reader.GetAttachments()
+	require.NoError(t, err)
+	require.Len(t, attachments, 2)
+	require.Equal(t, "audit.log", attachments[0].FileName)
+	require.Equal(t, []byte("log"), attachments[0].File.Content)
+	require.Equal(t, "source.xml", attachments[1].FileName)
+	require.Equal(t, "Source data", attachments[1].Description)
+	require.Equal(t, AFRelationshipSource, attachments[1].Relationship)
+	require.Equal(t, "text/xml", attachments[1].File.Subtype)
+	require.True(t, attachments[1].File.CheckSumValid())
+	af, ok := core.GetArray(reader.catalog.Get("AF"))
+	require.True(t, ok)
+	require.Equal(t, 1, af.Len())
+
+	page, err = reader.GetPage(1)
+	require.NoError(t, err)
+	annots, err := page.GetAnnotations()
+	require.NoError(t, err)
+	require.Len(t, annots, 1)
+	fa, ok := annots[0].GetContext().(*PdfAnnotationFileAttachment)
+	require.True(t, ok)
+	fs, err := fa.GetFileSpec()
+	require.NoError(t, err)
+	require.Equal(t, "sheet.csv", fs.FileName)
+	require.Equal(t, []byte("a,b\n1,2\n"), fs.File.Content)
+
+	// Update the attachments with an incremental update.
+	appender, err := NewPdfAppender(reader)
+	require.NoError(t, err)
+	appender.RemoveAttachment("source.xml")
+	require.NoError(t, appender.AddAttachment(NewPdfFileSpec("data.json", NewEmbeddedFile([]byte("{}"), "application/json"))))
+	removed, err := appender.RemoveFileAttachmentAnnotations(1, "sheet.csv")
+	require.NoError(t, err)
+	require.Equal(t, 1, removed)
+	require.NoError(t, appender.AddFileAttachmentAnnotation(1, attachments[0], &PdfRectangle{Urx: 10, Ury: 10}))
+	_, err = appender.RemoveFileAttachmentAnnotations(3, "sheet.csv")
+	require.Error(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, appender.Write(&buf))
+
+	reader, err = NewPdfReader(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	attachments, err = reader.GetAttachments()
+	require.NoError(t, err)
+	var fileNames []string
+	for _, fs := range attachments {
+		fileNames = append(fileNames, fs.FileName)
+	}
+	require.Equal(t, []string{"audit.log", "data.json"}, fileNames)
+	require.Equal(t, []byte("log"), attachments[0].File.Content)
+	af, ok = core.GetArray(reader.catalog.Get("AF"))
+	require.True(t, ok)
+	require.Equal(t, 0, af.Len())
+
+	page, err = reader.GetPage(1)
+	require.NoError(t, err)
+	annots, err = page.GetAnnotations()
+	require.NoError(t, err)
+	require.Len(t, annots, 1)
+	fs, err = annots[0].GetContext().(*PdfAnnotationFileAttachment).GetFileSpec()
+	require.NoError(t, err)
+	require.Equal(t, "audit.log", fs.FileName)
+}
+
+func TestAttachmentsTreeKeys(t *testing.T) {
+	// Attachments with keys which differ from the file names, as written by some producers.
+	w := NewPdfWriter()
+	tree := NewPdfNameTree()
+	report := NewPdfFileSpec("report.txt", NewEmbeddedFile([]byte("old"), "text/plain"))
+	require.NoError(t, tree.Set("\xfe\xff\x00A\x001", report.ToPdfObject()))
+	notes := NewPdfFileSpec("notes.txt", NewEmbeddedFile([]byte("notes"), "text/plain"))
+	require.NoError(t, tree.Set("Attachment 2", notes.ToPdfObject()))
+	w.setNameTree("EmbeddedFiles", tree)
+	reader := writeTestDocument(t, &w)
+
+	appender, err := NewPdfAppender(reader)
+	require.NoError(t, err)
+	require.NoError(t, appender.AddAttachment(NewPdfFileSpec("report.txt", NewEmbeddedFile([]byte("new"), "text/plain"))))
+	appender.RemoveAttachment("notes.txt")
+	var buf bytes.Buffer
+	require.NoError(t, appender.Write(&buf))
+
+	reader, err = NewPdfReader(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	attachments, err := reader.GetAttachments()
+	require.NoError(t, err)
+	require.Len(t, attachments, 1)
+	require.Equal(t, "report.txt", attachments[0].FileName)
+	require.Equal(t, []byte("new"), attachments[0].File.Content)
+	names, ok := core.GetDict(reader.catalog.Get("Names"))
+	require.True(t, ok)
+	tree, err = NewPdfNameTreeFromObject(names.Get("EmbeddedFiles"))
+	require.NoError(t, err)
+	keys, err := tree.Keys()
+	require.NoError(t, err)
+	require.Equal(t, []string{"\xfe\xff\x00A\x001"}, keys)
+}
@@ -0,0 +1,339 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/finalversus/doc/common"
+	"github.com/finalversus/doc/pdf/core"
+)
+
+// PdfDestinationType is the type of an explicit destination, which defines how the destination
+// page is displayed.
+type PdfDestinationType string
+
+// Explicit destination types (section 12.3.2.2 of the PDF 1.7 standard).
+const (
+	DestinationXYZ   PdfDestinationType = "XYZ"   // Left, Top and Zoom
+	DestinationFit   PdfDestinationType = "Fit"   // whole page
+	DestinationFitH  PdfDestinationType = "FitH"  // page width, at Top
+	DestinationFitV  PdfDestinationType = "FitV"  // page height, at Left
+	DestinationFitR  PdfDestinationType = "FitR"  // rectangle Left, Bottom, Right, Top
+	DestinationFitB  PdfDestinationType = "FitB"  // whole bounding box
+	DestinationFitBH PdfDestinationType = "FitBH" // bounding box width, at Top
+	DestinationFitBV PdfDestinationType = "FitBV" // bounding box height, at Left
+)
+
+// destinationParams are the names of the parameters of the destination types, in order.
+var destinationParams = map[PdfDestinationType][]string{
+	DestinationXYZ:   {"Left", "Top", "Zoom"},
+	DestinationFit:   nil,
+	DestinationFitH:  {"Top"},
+	DestinationFitV:  {"Left"},
+	DestinationFitR:  {"Left", "Bottom", "Right", "Top"},
+	DestinationFitB:  nil,
+	DestinationFitBH: {"Top"},
+	DestinationFitBV: {"Left"},
+}
+
+// PdfDestination represents an explicit destination, i.e. a page and a view of the page.
+// The parameters not used by the type are ignored, and nil parameters are written as null, which
+// keeps the current value of the viewer.
+type PdfDestination struct {
+	// Page is the destination page: a page object of the document, or the zero-based index of
+	// the page (integer) for destinations in other documents or pages not written yet.
+	Page core.PdfObject
+	Type PdfDestinationType
+
+	Left   *float64
+	Bottom *float64
+	Right  *float64
+	Top    *float64
+	Zoom   *float64
+}
+
+// NewPdfDestination returns a destination of type `destType` to page `page` (page object or
+// zero-based page index) with the parameters `params` of the type, in the order of the standard
+// (e.g. left, top and zoom for DestinationXYZ).
+func NewPdfDestination(page core.PdfObject, destType PdfDestinationType, params ...float64) (*PdfDestination, error) {
+	names, ok := destinationParams[destType]
+	if !ok {
+		return nil, fmt.Errorf("invalid destination type: %s", destType)
+	}
+	if len(params) != len(names) {
+		return nil, fmt.Errorf("destination %s requires %d parameters (got %d)", destType, len(names), len(params))
+	}
+	dest := &PdfDestination{Page: page, Type: destType}
+	for i, name := range names {
+		value := params[i]
+		*dest.param(name) = &value
+	}
+	return dest, nil
+}
+
+// NewPdfDestinationFromObject loads an explicit destination from `obj`, an array or a dictionary
+// with a D entry (as used in named destinations).
+func NewPdfDestinationFromObject(obj core.PdfObject) (*PdfDestination, error) {
+	if dict, ok := core.GetDict(obj); ok {
+		obj = dict.Get("D")
+	}
+	arr, ok := core.GetArray(obj)
+	if !ok || arr.Len() < 2 {
+		return nil, fmt.Errorf("invalid destination: %v", obj)
+	}
+	destType, ok := core.GetName(arr.Get(1))
+	if !ok {
+		return nil, fmt.Errorf("invalid destination type: %v", arr.Get(1))
+	}
+	names, ok := destinationParams[PdfDestinationType(*destType)]
+	if !ok {
+		return nil, fmt.Errorf("invalid destination type: %s", *destType)
+	}
+
+	dest := &PdfDestination{Page: arr.Get(0), Type: PdfDestinationType(*destType)}
+	for i, name := range names {
+		obj := core.TraceToDirectObject(arr.Get(i + 2))
+		if obj == nil || core.IsNullObject(obj) {
+			continue
+		}
+		value, err := core.GetNumberAsFloat(obj)
+		if err != nil {
+			return nil, fmt.Errorf("invalid destination parameter %s: %v", name, obj)
+		}
+		*dest.param(name) = &value
+	}
+	return dest, nil
+}
+
+// param returns the field of the parameter `name`.
+func (d *PdfDestination) param(name string) **float64 {
+	switch name {
+	case "Left":
+		return &d.Left
+	case "Bottom":
+		return &d.Bottom
+	case "Right":
+		return &d.Right
+	case "Top":
+		return &d.Top
+	}
+	return &d.Zoom
+}
+
+// ToPdfObject returns the destination array.
+func (d *PdfDestination) ToPdfObject() core.PdfObject {
+	arr := core.MakeArray(d.Page, core.MakeName(string(d.Type)))
+	for _, name := range destinationParams[d.Type] {
+		if value := *d.param(name); value != nil {
+			arr.Append(core.MakeFloat(*value))
+		} else {
+			arr.Append(core.MakeNull())
+		}
+	}
+	return arr
+}
+
+// GetNamedDestination returns the named destination `name` of the document, from the Dests name
+// tree of the catalog Names dictionary or from the catalog Dests dictionary (PDF 1.1), or nil if
+// not found.
+func (r *PdfReader) GetNamedDestination(name string) (*PdfDestination, error) {
+	obj, err := r.lookupNamedDestination(name)
+	if err != nil || obj == nil {
+		return nil, err
+	}
+	return NewPdfDestinationFromObject(obj)
+}
+
+// GetNamedDestinationNames returns the names of the named destinations of the document, sorted.
+func (r *PdfReader) GetNamedDestinationNames() ([]string, error) {
+	seen := map[string]bool{}
+	var names []string
+	if tree, err := r.destsNameTree(); err != nil {
+		return nil, err
+	} else if tree != nil {
+		keys, err := tree.Keys()
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			seen[key] = true
+			names = append(names, key)
+		}
+	}
+	if dests, ok := core.GetDict(r.catalog.Get("Dests")); ok {
+		for _, key := range dests.Keys() {
+			if !seen[string(key)] {
+				names = append(names, string(key))
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// ResolveDestination returns the explicit destination of `dest`: a destination array, a named
+// destination (name or string) or a destination dictionary.
+func (r *PdfReader) ResolveDestination(dest core.PdfObject) (*PdfDestination, error) {
+	switch t := core.TraceToDirectObject(dest).(type) {
+	case *core.PdfObjectName:
+		return r.resolveNamedDestination(string(*t))
+	case *core.PdfObjectString:
+		return r.resolveNamedDestination(t.Str())
+	}
+	return NewPdfDestinationFromObject(dest)
+}
+
+// resolveNamedDestination returns the named destination `name`, which must exist.
+func (r *PdfReader) resolveNamedDestination(name string) (*PdfDestination, error) {
+	dest, err := r.GetNamedDestination(name)
+	if err != nil {
+		return nil, err
+	}
+	if dest == nil {
+		return nil, fmt.Errorf("named destination %q not found", name)
+	}
+	return dest, nil
+}
+
+// GetDestinationPageNumber returns the page number (starting at 1) of the page of `dest`.
+func (r *PdfReader) GetDestinationPageNumber(dest *PdfDestination) (int, error) {
+	if idx, ok := core.GetIntVal(dest.Page); ok {
+		return idx + 1, nil
+	}
+	ind, ok := core.ResolveReference(dest.Page).(*core.PdfIndirectObject)
+	if !ok {
+		return 0, fmt.Errorf("invalid destination page: %v", dest.Page)
+	}
+	if err := r.ensurePageTree(); err != nil {
+		return 0, err
+	}
+	for i, page := range r.pageList {
+		if page == ind || page.ObjectNumber == ind.ObjectNumber && ind.ObjectNumber != 0 {
+			return i + 1, nil
+		}
+	}
+	return 0, errors.New("destination page not found")
+}
+
+// destsNameTree returns the Dests name tree of the catalog Names dictionary, if any.
+func (r *PdfReader) destsNameTree() (*PdfNameTree, error) {
+	names, ok := core.GetDict(r.catalog.Get("Names"))
+	if !ok {
+		return nil, nil
+	}
+	obj := names.Get("Dests")
+	if obj == nil {
+		return nil, nil
+	}
+	return NewPdfNameTreeFromObject(obj)
+}
+
+// lookupNamedDestination returns the object of the named destination `name`, or nil if not found.
+func (r *PdfReader) lookupNamedDestination(name string) (core.PdfObject, error) {
+	tree, err := r.destsNameTree()
+	if err != nil {
+		return nil, err
+	}
+	if tree != nil {
+		obj, err := tree.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		if obj != nil {
+			return core.ResolveReference(obj), nil
+		}
+	}
+	if dests, ok := core.GetDict(r.catalog.Get("Dests")); ok {
+		if obj := dests.Get(core.PdfObjectName(name)); obj != nil {
+			return core.ResolveReference(obj), nil
+		}
+	}
+	return nil, nil
+}
+
+// resolveNamedOutlineDest returns the explicit destination of the named destination `dest` of an
+// outline item, or `dest` if it is not a named destination or cannot be resolved.
+func (r *PdfReader) resolveNamedOutlineDest(dest core.PdfObject) core.PdfObject {
+	var name string
+	switch t := core.TraceToDirectObject(dest).(type) {
+	case *core.PdfObjectName:
+		name = string(*t)
+	case *core.PdfObjectString:
+		name = t.Str()
+	default:
+		return dest
+	}
+	obj, err := r.lookupNamedDestination(name)
+	if err != nil || obj == nil {
+		common.Log.Debug("Unable to resolve named destination %q: %v", name, err)
+		return dest
+	}
+	if dict, ok := core.GetDict(obj); ok {
+		obj = core.ResolveReference(dict.Get("D"))
+	}
+	if _, ok := core.GetArray(obj); !ok {
+		common.Log.Debug("Invalid named destination %q: %v", name, obj)
+		return dest
+	}
+	return obj
+}
+
+// AddNamedDestination adds the named destination `name` to the output document (Dests name tree
+// of the catalog Names dictionary), so that it can be referenced by links and by URLs such as
+// file.pdf#nameddest=name. The page of `dest` is a page added to the writer (see
+// PdfPage.GetPageAsIndirectObject) or a zero-based page index, which is replaced by the page
+// object when writing.
+func (w *PdfWriter) AddNamedDestination(name string, dest *PdfDestination) error {
+	if name == "" {
+		return errors.New("empty destination name")
+	}
+	if _, ok := destinationParams[dest.Type]; !ok {
+		return fmt.Errorf("invalid destination type: %s", dest.Type)
+	}
+	if w.namedDests == nil {
+		w.namedDests = map[string]*PdfDestination{}
+	}
+	w.namedDests[name] = dest
+	return nil
+}
+
+// writeNamedDestinations sets the named destinations of the writer in the Dests name tree.
+func (w *PdfWriter) writeNamedDestinations() error {
+	tree := NewPdfNameTree()
+	for name, dest := range w.namedDests {
+		resolved, err := w.resolveDestinationPage(dest)
+		if err != nil {
+			return fmt.Errorf("destination %q: %v", name, err)
+		}
+		if err := tree.Set(name, resolved.ToPdfObject()); err != nil {
+			return err
+		}
+	}
+	w.setNameTree("Dests", tree)
+	return nil
+}
+
+// setNameTree sets the name tree `key` of the catalog Names dictionary.
+func (w *PdfWriter) setNameTree(key core.PdfObjectName, tree *PdfNameTree) {
+	if w.nameTrees == nil {
+		w.nameTrees = map[core.PdfObjectName]*PdfNameTree{}
+	}
+	w.nameTrees[key] = tree
+}
+
+// writeNames sets the catalog Names dictionary with the name trees of the writer.
+func (w *PdfWriter) writeNames() error {
+	keys := make([]string, 0, len(w.nameTrees))
+	for key := range w.nameTrees {
+		keys = append(keys, string(key))
+	}
+	sort.Strings(keys)
+
+	names := core.MakeDict()
+	for _, key := range keys {
+		names.Set(core.PdfObjectName(key), w.nameTrees[core.PdfObjectName(key)].ToPdfObject())
+	}
+	w.catalog.Set("Names", names)
+	return w.addObjects(names)
+}
@@ -0,0 +1,146 @@
+package model
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/finalversus/doc/pdf/core"
+)
+
+func TestDestinationFromObject(t *testing.T) {
+	page := core.MakeInteger(2)
+	testcases := []struct {
+		obj      core.PdfObject
+		expected string
+	}{
+		{core.MakeArray(page, core.MakeName("XYZ"), core.MakeInteger(10), core.MakeNull(), core.MakeFloat(1.5)),
+			"[2 /XYZ 10 null 1.5]"},
+		{core.MakeArray(page, core.MakeName("Fit")), "[2 /Fit]"},
+		{core.MakeArray(page, core.MakeName("FitH"), core.MakeInteger(700)), "[2 /FitH 700]"},
+		{core.MakeArray(page, core.MakeName("FitBV")), "[2 /FitBV null]"},
+		{core.MakeArray(page, core.MakeName("FitR"), core.MakeInteger(1), core.MakeInteger(2), core.MakeInteger(3), core.MakeInteger(4)),
+			"[2 /FitR 1 2 3 4]"},
+	}
+	dict := core.MakeDict()
+	dict.Set("D", core.MakeArray(page, core.MakeName("FitB")))
+	testcases = append(testcases, struct {
+		obj      core.PdfObject
+		expected string
+	}{dict, "[2 /FitB]"})
+	for _, tc := range testcases {
+		dest, err := NewPdfDestinationFromObject(tc.obj)
+		require.NoError(t, err, "%v", tc.obj)
+		require.Equal(t, tc.expected, dest.ToPdfObject().WriteString())
+	}
+
+	dest, err := NewPdfDestinationFromObject(testcases[0].obj)
+	require.NoError(t, err)
+	require.Equal(t, DestinationXYZ, dest.Type)
+	require.Equal(t, 10.0, *dest.Left)
+	require.Nil(t, dest.Top)
+	require.Equal(t, 1.5, *dest.Zoom)
+
+	for _, obj := range []core.PdfObject{
+		core.MakeArray(page),
+		core.MakeArray(page, core.MakeName("Zoom")),
+		core.MakeArray(page, core.MakeName("FitH"), core.MakeName("Top")),
+		core.MakeName("intro"),
+	} {
+		_, err := NewPdfDestinationFromObject(obj)
+		require.Error(t, err, "%v", obj)
+	}
+
+	_, err = NewPdfDestination(page, DestinationFitR, 1, 2)
+	require.Error(t, err)
+	dest, err = NewPdfDestination(page, DestinationFitV, 72)
+	require.NoError(t, err)
+	require.Equal(t, "[2 /FitV 72]", dest.ToPdfObject().WriteString())
+}
+
+func TestNamedDestinations(t *testing.T) {
+	w := NewPdfWriter()
+	intro, err := NewPdfDestination(core.MakeInteger(1), DestinationXYZ, 0, 80, 0)
+	require.NoError(t, err)
+	require.NoError(t, w.AddNamedDestination("intro", intro))
+	require.Error(t, w.AddNamedDestination("", intro))
+	fit, err := NewPdfDestination(core.MakeInteger(0), DestinationFit)
+	require.NoError(t, err)
+	require.NoError(t, w.AddNamedDestination("start", fit))
+
+	// Destinations of the catalog Dests dictionary (PDF 1.1).
+	dests := core.MakeDict()
+	dests.Set("legacy", core.MakeArray(core.MakeInteger(0), core.MakeName("FitH"), core.MakeInteger(50)))
+	dests.Set("start", core.MakeArray(core.MakeInteger(1), core.MakeName("Fit")))
+	w.catalog.Set("Dests", dests)
+
+	// Outline item pointing to a named destination.
+	outline := NewPdfOutline()
+	item := NewPdfOutlineItem()
+	item.Title = core.MakeString("Introduction")
+	item.Dest = core.MakeString("intro")
+	item.Parent = &outline.PdfOutlineTreeNode
+	outline.First = &item.PdfOutlineTreeNode
+	outline.Last = &item.PdfOutlineTreeNode
+	w.AddOutlineTree(&outline.PdfOutlineTreeNode)
+
+	page := NewPdfPage()
+	page.MediaBox = &PdfRectangle{Urx: 100, Ury: 100}
+	require.NoError(t, w.AddPage(page))
+	reader := writeTestDocument(t, &w)
+
+	names, err := reader.GetNamedDestinationNames()
+	require.NoError(t, err)
+	require.Equal(t, []string{"intro", "legacy", "start"}, names)
+
+	// The Names dictionary takes precedence over the Dests dictionary.
+	testcases := []struct {
+		name     string
+		destType PdfDestinationType
+		pageNum  int
+	}{
+		{"intro", DestinationXYZ, 2},
+		{"start", DestinationFit, 1},
+		{"legacy", DestinationFitH, 1},
+	}
+	for _, tc := range testcases {
+		dest, err := reader.GetNamedDestination(tc.name)
+		require.NoError(t, err)
+		require.NotNil(t, dest, tc.name)
+		require.Equal(t, tc.destType, dest.Type)
+		pageNum, err := reader.GetDestinationPageNumber(dest)
+		require.NoError(t, err)
+		require.Equal(t, tc.pageNum, pageNum, tc.name)
+
+		dest, err = reader.ResolveDestination(core.MakeName(tc.name))
+		require.NoError(t, err)
+		require.Equal(t, tc.destType, dest.Type)
+	}
+	_, err = reader.ResolveDestination(core.MakeString("missing"))
+	require.Error(t, err)
+	dest, err := reader.GetNamedDestination("missing")
+	require.NoError(t, err)
+	require.Nil(t, dest)
+
+	// The named destination of the outline item is resolved.
+	root := reader.GetOutlineTree()
+	require.NotNil(t, root)
+	readItem, ok := root.First.getOuter().(*PdfOutlineItem)
+	require.True(t, ok)
+	dest, err = NewPdfDestinationFromObject(readItem.Dest)
+	require.NoError(t, err)
+	require.Equal(t, DestinationXYZ, dest.Type)
+	require.Equal(t, 80.0, *dest.Top)
+	pageNum, err := reader.GetDestinationPageNumber(dest)
+	require.NoError(t, err)
+	require.Equal(t, 2, pageNum)
+
+	// Page indices out of range are rejected when writing.
+	w = NewPdfWriter()
+	require.NoError(t, w.AddNamedDestination("intro", intro))
+	page = NewPdfPage()
+	page.MediaBox = &PdfRectangle{Urx: 100, Ury: 100}
+	require.NoError(t, w.AddPage(page))
+	require.Error(t, w.Write(ioutil.Discard))
+}
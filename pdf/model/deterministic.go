@@ -0,0 +1,103 @@
+package model
+
+import (
+	"time"
+
+	"github.com/finalversus/doc/pdf/core"
+)
+
+// DeterministicOpts contains the options of the deterministic output mode (see
+// PdfWriter.SetDeterministic).
+type DeterministicOpts struct {
+	// ID is used for both parts of the file identifier (trailer ID entry). If empty, the file
+	// identifier is derived from the file content.
+	ID []byte
+
+	// CreationDate and ModDate replace the creation and modification dates of the document
+	// information dictionary, if not zero.
+	CreationDate time.Time
+	ModDate      time.Time
+}
+
+// SetDeterministic enables the deterministic output mode, in which writing identical inputs yields
+// byte-identical PDF files. If `opts` is nil, the default options are used.
+//
+// In deterministic mode:
+// - the trailer always contains a file identifier, which is either `opts.ID` or derived from the
+// file content,
+// - the document information dates are set to the dates supplied in `opts`,
+// - dictionary keys are written in sorted order.
+// Objects are numbered in the order in which they were added, as in the default mode.
+//
+// Note that encrypted output is not reproducible, as encryption uses random salts and
+// initialization vectors. The file identifier of encrypted files is generated by Encrypt.
+func (w *PdfWriter) SetDeterministic(opts *DeterministicOpts) {
+	if opts == nil {
+		opts = &DeterministicOpts{}
+	}
+	w.deterministic = opts
+}
+
+// prepareDeterministic applies the deterministic mode options to the objects to be written.
+func (w *PdfWriter) prepareDeterministic() {
+	opts := w.deterministic
+	for _, obj := range w.objects {
+		switch t := obj.(type) {
+		case *core.PdfIndirectObject:
+			sortDictKeys(t.PdfObject)
+		case *core.PdfObjectStream:
+			sortDictKeys(t.PdfObjectDictionary)
+		case *core.PdfObjectStreams:
+			for _, elem := range t.Elements() {
+				if ind, ok := elem.(*core.PdfIndirectObject); ok {
+					sortDictKeys(ind.PdfObject)
+				}
+			}
+		}
+	}
+
+	if len(opts.ID) > 0 && w.crypter == nil {
+		w.setFileID(opts.ID)
+	}
+}
+
+// setDeterministicDates sets the dates of the document information dictionary to those of the
+// deterministic mode options.
+func (w *PdfWriter) setDeterministicDates() {
+	opts := w.deterministic
+	infoDict, ok := core.GetDict(w.infoObj)
+	if !ok {
+		return
+	}
+	if !opts.CreationDate.IsZero() {
+		if cd, err := NewPdfDateFromTime(opts.CreationDate); err == nil {
+			infoDict.Set("CreationDate", cd.ToPdfObject())
+		}
+	}
+	if !opts.ModDate.IsZero() {
+		if md, err := NewPdfDateFromTime(opts.ModDate); err == nil {
+			infoDict.Set("ModDate", md.ToPdfObject())
+		}
+	}
+}
+
+// setFileID sets both parts of the file identifier to `id`.
+func (w *PdfWriter) setFileID(id []byte) {
+	w.ids = core.MakeArray(core.MakeHexString(string(id)), core.MakeHexString(string(id)))
+}
+
+// sortDictKeys sorts the keys of the dictionaries directly contained in `obj`. Indirect objects
+// are processed separately and signature dictionaries are left as is.
+func sortDictKeys(obj core.PdfObject) {
+	switch t := obj.(type) {
+	case *core.PdfObjectDictionary:
+		t.SortKeys()
+		for _, key := range t.Keys() {
+			sortDictKeys(t.Get(key))
+		}
+	case *core.PdfObjectArray:
+		for _, elem := range t.Elements() {
+			sortDictKeys(elem)
+		}
+	}
+}
@@ -0,0 +1,331 @@
+package model
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"time"
+
+	"github.com/finalversus/doc/common"
+	"github.com/finalversus/doc/pdf/core"
+)
+
+// AFRelationship is the relationship between an associated file and the document (PDF 2.0 and
+// PDF/A-3).
+type AFRelationship string
+
+// Associated file relationships.
+const (
+	AFRelationshipSource           AFRelationship = "Source"           // original source of the content
+	AFRelationshipData             AFRelationship = "Data"             // data used to derive the content
+	AFRelationshipAlternative      AFRelationship = "Alternative"      // alternative representation
+	AFRelationshipSupplement       AFRelationship = "Supplement"       // supplemental representation
+	AFRelationshipEncryptedPayload AFRelationship = "EncryptedPayload" // encrypted payload document
+	AFRelationshipFormData         AFRelationship = "FormData"         // data of a form
+	AFRelationshipSchema           AFRelationship = "Schema"           // schema definition
+	AFRelationshipUnspecified      AFRelationship = "Unspecified"      // unknown or other relationship
+)
+
+// EmbeddedFile represents an embedded file stream (section 7.11.4 of the PDF 1.7 standard).
+type EmbeddedFile struct {
+	Content []byte
+
+	// Subtype is the MIME type of the file, e.g. "text/xml".
+	Subtype string
+
+	// Creation and modification dates (not written if zero).
+	CreationDate time.Time
+	ModDate      time.Time
+
+	// CheckSum is the MD5 checksum of the content. It is computed when writing if nil, or if the
+	// content of a loaded or written file changed and the checksum did not.
+	CheckSum []byte
+
+	// The stream loaded or written by ToPdfObject, updated by further calls so that file
+	// specifications referenced several times (e.g. as attachment and by an annotation) share the
+	// same stream.
+	container *core.PdfObjectStream
+
+	// The fields of the file in `container`, used to keep the stream of unchanged files.
+	written *EmbeddedFile
+}
+
+// NewEmbeddedFile returns an embedded file with content `content` and MIME type `mimeType`.
+func NewEmbeddedFile(content []byte, mimeType string) *EmbeddedFile {
+	return &EmbeddedFile{Content: content, Subtype: mimeType}
+}
+
+// NewEmbeddedFileFromObject loads an embedded file from the embedded file stream `obj`.
+func NewEmbeddedFileFromObject(obj core.PdfObject) (*EmbeddedFile, error) {
+	stream, ok := core.GetStream(obj)
+	if !ok {
+		return nil, fmt.Errorf("invalid embedded file type: %T", obj)
+	}
+	content, err := core.DecodeStream(stream)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &EmbeddedFile{Content: content, container: stream}
+	if subtype, ok := core.GetNameVal(stream.Get("Subtype")); ok {
+		file.Subtype = subtype
+	}
+	if params, ok := core.GetDict(stream.Get("Params")); ok {
+		file.CreationDate = loadFileSpecDate(params.Get("CreationDate"))
+		file.ModDate = loadFileSpecDate(params.Get("ModDate"))
+		if checkSum, ok := core.GetString(params.Get("CheckSum")); ok {
+			file.CheckSum = checkSum.Bytes()
+		}
+	}
+	file.setWritten()
+	return file, nil
+}
+
+// setWritten records the fields of the file as the fields of its stream.
+func (f *EmbeddedFile) setWritten() {
+	written := *f
+	written.container = nil
+	written.written = nil
+	f.written = &written
+}
+
+// changed returns true if the fields of the file differ from the fields of its stream.
+func (f *EmbeddedFile) changed() bool {
+	w := f.written
+	return w == nil || !bytes.Equal(f.Content, w.Content) || f.Subtype != w.Subtype ||
+		!f.CreationDate.Equal(w.CreationDate) || !f.ModDate.Equal(w.ModDate) ||
+		!bytes.Equal(f.CheckSum, w.CheckSum)
+}
+
+// loadFileSpecDate returns the date of the date string `obj`, or the zero time if invalid.
+func loadFileSpecDate(obj core.PdfObject) time.Time {
+	str, ok := core.GetString(obj)
+	if !ok {
+		return time.Time{}
+	}
+	date, err := NewPdfDate(str.Str())
+	if err != nil {
+		common.Log.Debug("Invalid embedded file date %q: %v", str.Str(), err)
+		return time.Time{}
+	}
+	return date.ToGoTime()
+}
+
+// CheckSumValid returns false if the file has a checksum which does not match its content.
+func (f *EmbeddedFile) CheckSumValid() bool {
+	if f.CheckSum == nil {
+		return true
+	}
+	sum := md5.Sum(f.Content)
+	return bytes.Equal(sum[:], f.CheckSum)
+}
+
+// ToPdfObject returns the embedded file stream (Flate encoded). The stream of a loaded file is
+// returned unchanged if the fields of the file are unchanged.
+func (f *EmbeddedFile) ToPdfObject() core.PdfObject {
+	if f.container != nil && !f.changed() {
+		return f.container
+	}
+
+	stream, err := core.MakeStream(f.Content, core.NewFlateEncoder())
+	if err != nil {
+		common.Log.Debug("ERROR: Unable to encode embedded file: %v - storing raw data", err)
+		stream, _ = core.MakeStream(f.Content, core.NewRawEncoder())
+	}
+	stream.Set("Type", core.MakeName("EmbeddedFile"))
+	if f.Subtype != "" {
+		stream.Set("Subtype", core.MakeName(f.Subtype))
+	}
+
+	params := core.MakeDict()
+	params.Set("Size", core.MakeInteger(int64(len(f.Content))))
+	for _, date := range []struct {
+		key  core.PdfObjectName
+		time time.Time
+	}{{"CreationDate", f.CreationDate}, {"ModDate", f.ModDate}} {
+		if date.time.IsZero() {
+			continue
+		}
+		if pdfDate, err := NewPdfDateFromTime(date.time); err == nil {
+			params.Set(date.key, pdfDate.ToPdfObject())
+		}
+	}
+	if w := f.written; w != nil && !bytes.Equal(f.Content, w.Content) &&
+		bytes.Equal(f.CheckSum, w.CheckSum) {
+		f.CheckSum = nil
+	}
+	checkSum := f.CheckSum
+	if checkSum == nil {
+		sum := md5.Sum(f.Content)
+		checkSum = sum[:]
+	}
+	params.Set("CheckSum", core.MakeHexString(string(checkSum)))
+	stream.Set("Params", params)
+
+	f.setWritten()
+	if f.container == nil {
+		f.container = stream
+		return stream
+	}
+
+	// Update the stream, keeping its entries (and parameters) which are not modeled.
+	if origParams, ok := core.GetDict(f.container.Get("Params")); ok {
+		for _, key := range origParams.Keys() {
+			if key != "CreationDate" && key != "ModDate" && params.Get(key) == nil {
+				params.Set(key, origParams.Get(key))
+			}
+		}
+	}
+	for _, key := range []core.PdfObjectName{"Filter", "DecodeParms", "DL", "Subtype"} {
+		f.container.Remove(key)
+	}
+	f.container.Merge(stream.PdfObjectDictionary)
+	f.container.Stream = stream.Stream
+	return f.container
+}
+
+// PdfFileSpec represents a file specification (section 7.11 of the PDF 1.7 standard), such as a
+// document attachment or the file of a file attachment annotation.
+type PdfFileSpec struct {
+	// FileName is the name of the file (UF entry, or F if UF is missing).
+	FileName    string
+	Description string
+
+	// Relationship is the relationship of the file with the document, for associated files.
+	Relationship AFRelationship
+
+	// File is the embedded file, or nil if the file is not embedded.
+	File *EmbeddedFile
+
+	// The fields of the specification in the dictionary of `container` (nil if not set), used to
+	// update only the changed entries of loaded specifications.
+	written *PdfFileSpec
+
+	container *core.PdfIndirectObject
+}
+
+// NewPdfFileSpec returns a file specification of the embedded file `file` named `fileName`.
+func NewPdfFileSpec(fileName string, file *EmbeddedFile) *PdfFileSpec {
+	return &PdfFileSpec{
+		FileName:  fileName,
+		File:      file,
+		container: core.MakeIndirectObject(core.MakeDict()),
+	}
+}
+
+// NewPdfFileSpecFromObject loads a file specification from `obj`, a file specification
+// dictionary or string.
+func NewPdfFileSpecFromObject(obj core.PdfObject) (*PdfFileSpec, error) {
+	if str, ok := core.GetString(obj); ok {
+		fs := NewPdfFileSpec(str.Decoded(), nil)
+		return fs, nil
+	}
+
+	container, ok := core.ResolveReference(obj).(*core.PdfIndirectObject)
+	if !ok {
+		container = core.MakeIndirectObject(core.ResolveReference(obj))
+	}
+	dict, ok := core.GetDict(container.PdfObject)
+	if !ok {
+		return nil, fmt.Errorf("invalid file specification type: %T", container.PdfObject)
+	}
+
+	fs := &PdfFileSpec{container: container, FileName: fileSpecName(dict)}
+	if desc, ok := core.GetString(dict.Get("Desc")); ok {
+		fs.Description = desc.Decoded()
+	}
+	if rel, ok := core.GetNameVal(dict.Get("AFRelationship")); ok {
+		fs.Relationship = AFRelationship(rel)
+	}
+	if ef, ok := core.GetDict(dict.Get("EF")); ok {
+		obj := ef.Get("UF")
+		if obj == nil {
+			obj = ef.Get("F")
+		}
+		if obj != nil {
+			file, err := NewEmbeddedFileFromObject(obj)
+			if err != nil {
+				return nil, err
+			}
+			fs.File = file
+		}
+	}
+	fs.setWritten()
+	return fs, nil
+}
+
+// setWritten records the fields of the specification as the fields of its dictionary.
+func (fs *PdfFileSpec) setWritten() {
+	fs.written = &PdfFileSpec{
+		FileName:     fs.FileName,
+		Description:  fs.Description,
+		Relationship: fs.Relationship,
+		File:         fs.File,
+	}
+}
+
+// fileSpecName returns the file name of the file specification dictionary `dict`.
+func fileSpecName(dict *core.PdfObjectDictionary) string {
+	for _, key := range []core.PdfObjectName{"UF", "F", "Unix", "DOS", "Mac"} {
+		if str, ok := core.GetString(dict.Get(key)); ok {
+			return str.Decoded()
+		}
+	}
+	return ""
+}
+
+// GetContainingPdfObject implements interface PdfModel.
+func (fs *PdfFileSpec) GetContainingPdfObject() core.PdfObject {
+	return fs.container
+}
+
+// ToPdfObject implements interface PdfModel. Only the entries of the changed fields are updated
+// in the dictionary of loaded specifications, and the other entries (e.g. FS, RF or CI) are kept.
+func (fs *PdfFileSpec) ToPdfObject() core.PdfObject {
+	if fs.container == nil {
+		fs.container = core.MakeIndirectObject(core.MakeDict())
+	}
+	dict := fs.container.PdfObject.(*core.PdfObjectDictionary)
+	prev := fs.written
+	if prev == nil {
+		dict.Set("Type", core.MakeName("Filespec"))
+	}
+
+	if prev == nil || fs.FileName != prev.FileName {
+		dict.Set("F", core.MakeString(fs.FileName))
+		dict.Set("UF", NewPdfInfoText(fs.FileName))
+	}
+	if prev == nil || fs.Description != prev.Description {
+		if fs.Description != "" {
+			dict.Set("Desc", NewPdfInfoText(fs.Description))
+		} else {
+			dict.Remove("Desc")
+		}
+	}
+	if prev == nil || fs.Relationship != prev.Relationship {
+		if fs.Relationship != "" {
+			dict.Set("AFRelationship", core.MakeName(string(fs.Relationship)))
+		} else {
+			dict.Remove("AFRelationship")
+		}
+	}
+
+	// The embedded file stream of an unchanged file is updated in place (see
+	// EmbeddedFile.ToPdfObject), and the EF dictionary is only replaced for another file.
+	if fs.File == nil {
+		if prev == nil || prev.File != nil {
+			dict.Remove("EF")
+		}
+	} else {
+		stream := fs.File.ToPdfObject()
+		if prev == nil || fs.File != prev.File {
+			ef := core.MakeDict()
+			ef.Set("F", stream)
+			ef.Set("UF", stream)
+			dict.Set("EF", ef)
+		}
+	}
+
+	fs.setWritten()
+	return fs.container
+}
@@ -33,6 +33,10 @@ type FieldAppearanceGenerator interface {
 // annotations intact.
 // When `appgen` is not nil, it will be used to generate appearance streams for the field annotations.
 func (r *PdfReader) FlattenFields(allannots bool, appgen FieldAppearanceGenerator) error {
+	if err := r.ensurePageTree(); err != nil {
+		return err
+	}
+
 	// Load all target widget annotations to be flattened into a map.
 	// The bool value indicates whether the annotation has value content.
 	ftargets := map[*PdfAnnotation]bool{}
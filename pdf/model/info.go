@@ -0,0 +1,216 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/finalversus/doc/common"
+	"github.com/finalversus/doc/pdf/core"
+	"github.com/finalversus/doc/pdf/internal/strutils"
+)
+
+// infoKeys are the standard keys of the document information dictionary.
+var infoKeys = map[core.PdfObjectName]bool{
+	"Title":        true,
+	"Author":       true,
+	"Subject":      true,
+	"Keywords":     true,
+	"Creator":      true,
+	"Producer":     true,
+	"CreationDate": true,
+	"ModDate":      true,
+	"Trapped":      true,
+}
+
+// PdfInfo represents a document information dictionary (section 14.3.3 of the PDF 1.7 standard).
+// The text strings can be read with their Decoded method and created with NewPdfInfoText.
+// Other keys of the dictionary are custom entries (see SetCustomInfo).
+type PdfInfo struct {
+	Title        *core.PdfObjectString
+	Author       *core.PdfObjectString
+	Subject      *core.PdfObjectString
+	Keywords     *core.PdfObjectString
+	Creator      *core.PdfObjectString
+	Producer     *core.PdfObjectString
+	CreationDate *PdfDate
+	ModifiedDate *PdfDate
+
+	// Trapped is /True, /False or /Unknown.
+	Trapped *core.PdfObjectName
+
+	customInfo *core.PdfObjectDictionary
+}
+
+// NewPdfInfo returns an empty document information dictionary.
+func NewPdfInfo() *PdfInfo {
+	return &PdfInfo{customInfo: core.MakeDict()}
+}
+
+// NewPdfInfoText returns a text string for the document information dictionary. The text is
+// encoded with PDFDocEncoding if possible, and with UTF-16BE otherwise.
+func NewPdfInfoText(text string) *core.PdfObjectString {
+	if strutils.PDFDocEncodingToString(strutils.StringToPDFDocEncoding(text)) == text {
+		return core.MakeEncodedString(text, false)
+	}
+	return core.MakeEncodedString(text, true)
+}
+
+// NewPdfInfoFromObject loads a document information dictionary from `obj`.
+// Entries with an invalid type are ignored.
+func NewPdfInfoFromObject(obj core.PdfObject) (*PdfInfo, error) {
+	dict, ok := core.GetDict(obj)
+	if !ok {
+		return nil, fmt.Errorf("invalid info dictionary type: %T", obj)
+	}
+
+	info := NewPdfInfo()
+	for _, key := range dict.Keys() {
+		val := dict.Get(key)
+		if !infoKeys[key] {
+			info.customInfo.Set(key, val)
+			continue
+		}
+
+		var str *core.PdfObjectString
+		if key != "Trapped" {
+			var ok bool
+			if str, ok = core.GetString(val); !ok {
+				common.Log.Debug("Invalid info entry %s (%T) - ignoring", key, core.TraceToDirectObject(val))
+				continue
+			}
+		}
+		switch key {
+		case "Title":
+			info.Title = str
+		case "Author":
+			info.Author = str
+		case "Subject":
+			info.Subject = str
+		case "Keywords":
+			info.Keywords = str
+		case "Creator":
+			info.Creator = str
+		case "Producer":
+			info.Producer = str
+		case "CreationDate", "ModDate":
+			date, err := NewPdfDate(str.Decoded())
+			if err != nil {
+				common.Log.Debug("Invalid info date %s: %v - ignoring", key, err)
+				continue
+			}
+			if key == "CreationDate" {
+				info.CreationDate = &date
+			} else {
+				info.ModifiedDate = &date
+			}
+		case "Trapped":
+			switch t := core.TraceToDirectObject(val).(type) {
+			case *core.PdfObjectName:
+				info.Trapped = t
+			case *core.PdfObjectBool:
+				// Boolean values were used before PDF 1.4.
+				if *t {
+					info.Trapped = core.MakeName("True")
+				} else {
+					info.Trapped = core.MakeName("False")
+				}
+			default:
+				common.Log.Debug("Invalid info entry Trapped (%T) - ignoring", t)
+			}
+		}
+	}
+	return info, nil
+}
+
+// GetCustomInfo returns the custom entry `key` of the dictionary, or nil if not found.
+func (info *PdfInfo) GetCustomInfo(key core.PdfObjectName) core.PdfObject {
+	if info.customInfo == nil {
+		return nil
+	}
+	return info.customInfo.Get(key)
+}
+
+// CustomInfoKeys returns the keys of the custom entries of the dictionary, in order.
+func (info *PdfInfo) CustomInfoKeys() []core.PdfObjectName {
+	if info.customInfo == nil {
+		return nil
+	}
+	return info.customInfo.Keys()
+}
+
+// SetCustomInfo sets the custom entry `key` of the dictionary to the text string `value`.
+// The standard keys (Title, Author, etc.) must be set with the fields of PdfInfo.
+func (info *PdfInfo) SetCustomInfo(key core.PdfObjectName, value string) error {
+	if infoKeys[key] {
+		return fmt.Errorf("%s is a standard info key", key)
+	}
+	if key == "" {
+		return errors.New("empty info key")
+	}
+	if info.customInfo == nil {
+		info.customInfo = core.MakeDict()
+	}
+	info.customInfo.Set(key, NewPdfInfoText(value))
+	return nil
+}
+
+// RemoveCustomInfo removes the custom entry `key` of the dictionary.
+func (info *PdfInfo) RemoveCustomInfo(key core.PdfObjectName) {
+	if info.customInfo != nil {
+		info.customInfo.Remove(key)
+	}
+}
+
+// ToPdfObject returns the document information dictionary.
+func (info *PdfInfo) ToPdfObject() core.PdfObject {
+	dict := core.MakeDict()
+	dict.SetIfNotNil("Title", info.Title)
+	dict.SetIfNotNil("Author", info.Author)
+	dict.SetIfNotNil("Subject", info.Subject)
+	dict.SetIfNotNil("Keywords", info.Keywords)
+	dict.SetIfNotNil("Creator", info.Creator)
+	dict.SetIfNotNil("Producer", info.Producer)
+	if info.CreationDate != nil {
+		dict.Set("CreationDate", info.CreationDate.ToPdfObject())
+	}
+	if info.ModifiedDate != nil {
+		dict.Set("ModDate", info.ModifiedDate.ToPdfObject())
+	}
+	dict.SetIfNotNil("Trapped", info.Trapped)
+	for _, key := range info.CustomInfoKeys() {
+		dict.Set(key, info.customInfo.Get(key))
+	}
+	return dict
+}
+
+// GetPdfInfo returns the document information dictionary of the document, or nil if the document
+// has none.
+func (r *PdfReader) GetPdfInfo() (*PdfInfo, error) {
+	trailer, err := r.GetTrailer()
+	if err != nil {
+		return nil, err
+	}
+	obj := trailer.Get("Info")
+	if ref, ok := obj.(*core.PdfObjectReference); ok {
+		if obj, err = r.parser.LookupByReference(*ref); err != nil {
+			return nil, err
+		}
+	}
+	if obj == nil || core.IsNullObject(core.TraceToDirectObject(obj)) {
+		return nil, nil
+	}
+	return NewPdfInfoFromObject(obj)
+}
+
+// SetDocInfo sets the document information dictionary of the output document, replacing the
+// default one built from the package-level settings (SetPdfAuthor, SetPdfTitle, etc.).
+func (w *PdfWriter) SetDocInfo(info *PdfInfo) {
+	w.infoObj.PdfObject = info.ToPdfObject()
+}
+
+// SetDocInfo sets the document information dictionary of the updated document. By default, the
+// dictionary is built from the package-level settings (SetPdfAuthor, SetPdfTitle, etc.).
+// The current dictionary can be loaded with PdfReader.GetPdfInfo to modify it.
+func (a *PdfAppender) SetDocInfo(info *PdfInfo) {
+	a.info = info
+}
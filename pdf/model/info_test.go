@@ -0,0 +1,142 @@
+package model
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/finalversus/doc/pdf/core"
+)
+
+// writeTestDocument writes a one page document with `w` and returns a reader for it.
+func writeTestDocument(t *testing.T, w *PdfWriter) *PdfReader {
+	page := NewPdfPage()
+	page.MediaBox = &PdfRectangle{Urx: 100, Ury: 100}
+	require.NoError(t, w.AddPage(page))
+
+	var buf bytes.Buffer
+	require.NoError(t, w.Write(&buf))
+	reader, err := NewPdfReader(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	return reader
+}
+
+func TestPdfInfoReadWrite(t *testing.T) {
+	created, err := NewPdfDateFromTime(time.Date(2020, 5, 17, 10, 20, 30, 0, time.FixedZone("", 2*3600)))
+	require.NoError(t, err)
+
+	info := NewPdfInfo()
+	info.Title = NewPdfInfoText("Résumé – Привет")
+	info.Author = NewPdfInfoText("Author")
+	info.Producer = NewPdfInfoText("Producer")
+	info.CreationDate = &created
+	info.Trapped = core.MakeName("False")
+	require.NoError(t, info.SetCustomInfo("Department", "Финансы"))
+	require.NoError(t, info.SetCustomInfo("Project", "Backlog"))
+	require.Error(t, info.SetCustomInfo("Title", "Title"))
+
+	w := NewPdfWriter()
+	w.SetDocInfo(info)
+	reader := writeTestDocument(t, &w)
+
+	readInfo, err := reader.GetPdfInfo()
+	require.NoError(t, err)
+	require.NotNil(t, readInfo)
+	require.Equal(t, "Résumé – Привет", readInfo.Title.Decoded())
+	require.Equal(t, "Author", readInfo.Author.Decoded())
+	require.Equal(t, "Producer", readInfo.Producer.Decoded())
+	require.Nil(t, readInfo.Subject)
+	require.Nil(t, readInfo.ModifiedDate)
+	require.NotNil(t, readInfo.CreationDate)
+	require.True(t, created.ToGoTime().Equal(readInfo.CreationDate.ToGoTime()))
+	require.Equal(t, "False", readInfo.Trapped.String())
+	require.Equal(t, []core.PdfObjectName{"Department", "Project"}, readInfo.CustomInfoKeys())
+	department, ok := core.GetString(readInfo.GetCustomInfo("Department"))
+	require.True(t, ok)
+	require.Equal(t, "Финансы", department.Decoded())
+
+	readInfo.RemoveCustomInfo("Project")
+	require.Nil(t, readInfo.GetCustomInfo("Project"))
+}
+
+func TestPdfInfoDefaults(t *testing.T) {
+	SetPdfTitle("Default title")
+	SetPdfProducer("Default producer")
+	defer func() {
+		SetPdfTitle("")
+		SetPdfProducer("")
+	}()
+
+	w := NewPdfWriter()
+	info, err := writeTestDocument(t, &w).GetPdfInfo()
+	require.NoError(t, err)
+	require.Equal(t, "Default title", info.Title.Decoded())
+	require.Equal(t, "Default producer", info.Producer.Decoded())
+
+	// The document information set on the writer replaces the defaults.
+	w = NewPdfWriter()
+	custom := NewPdfInfo()
+	custom.Author = NewPdfInfoText("Author")
+	w.SetDocInfo(custom)
+	info, err = writeTestDocument(t, &w).GetPdfInfo()
+	require.NoError(t, err)
+	require.Nil(t, info.Title)
+	require.Nil(t, info.Producer)
+	require.Equal(t, "Author", info.Author.Decoded())
+}
+
+func TestPdfInfoFromObject(t *testing.T) {
+	dict := core.MakeDict()
+	dict.Set("Title", core.MakeEncodedString("Title", true))
+	dict.Set("Author", core.MakeInteger(1))
+	dict.Set("CreationDate", core.MakeString("D:2019"))
+	dict.Set("ModDate", core.MakeString("D:20190203"))
+	dict.Set("Trapped", core.MakeBool(true))
+	dict.Set("Pages", core.MakeInteger(3))
+
+	info, err := NewPdfInfoFromObject(dict)
+	require.NoError(t, err)
+	require.Equal(t, "Title", info.Title.Decoded())
+	require.Nil(t, info.Author)
+	require.Equal(t, time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC), info.CreationDate.ToGoTime().UTC())
+	require.Equal(t, time.Date(2019, 2, 3, 0, 0, 0, 0, time.UTC), info.ModifiedDate.ToGoTime().UTC())
+	require.Equal(t, "True", info.Trapped.String())
+	require.Equal(t, core.MakeInteger(3), info.GetCustomInfo("Pages"))
+
+	_, err = NewPdfInfoFromObject(core.MakeArray())
+	require.Error(t, err)
+}
+
+func TestPdfInfoAppender(t *testing.T) {
+	f, err := os.Open("testdata/minimal.pdf")
+	require.NoError(t, err)
+	defer f.Close()
+	reader, err := NewPdfReader(f)
+	require.NoError(t, err)
+
+	info, err := reader.GetPdfInfo()
+	require.NoError(t, err)
+	if info == nil {
+		info = NewPdfInfo()
+	}
+	info.Title = NewPdfInfoText("Updated")
+	require.NoError(t, info.SetCustomInfo("Reviewed", "yes"))
+
+	appender, err := NewPdfAppender(reader)
+	require.NoError(t, err)
+	appender.SetDocInfo(info)
+	var buf bytes.Buffer
+	require.NoError(t, appender.Write(&buf))
+
+	reader, err = NewPdfReader(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	info, err = reader.GetPdfInfo()
+	require.NoError(t, err)
+	require.Equal(t, "Updated", info.Title.Decoded())
+	reviewed, ok := core.GetString(info.GetCustomInfo("Reviewed"))
+	require.True(t, ok)
+	require.Equal(t, "yes", reviewed.Decoded())
+}
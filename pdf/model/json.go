@@ -0,0 +1,93 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/finalversus/doc/pdf/core"
+)
+
+// WriteJSON writes the object graph of the document to `w` as JSON, starting from the trailer
+// dictionary. The document can be built back with core.ReadJSON and NewPdfWriterFromJSON.
+//
+// The JSON document has the form {"version": "1.7", "trailer": {...}, "objects": {"1 0 R": ..., ...}}
+// where the objects are the indirect objects reachable from the trailer, and:
+// - names are written in PDF syntax: "/Name" (dictionary keys too),
+// - strings are prefixed with their encoding: "u:" for text strings, "b:" and "h:" for the
+// hexadecimal bytes of literal and hexadecimal strings,
+// - references are written as "12 0 R",
+// - integers and real numbers are JSON numbers, real numbers always having a fractional part or
+// an exponent,
+// - streams are written as {"stream": {"dict": {...}, "data": "<base64>"}}. With
+// opts.DecodeStreams, streams with lossless filters are written decoded, as "text" if the data is
+// valid UTF-8 or "decoded" (base64) otherwise, and encoded back with their filters when read.
+//
+// Encrypted documents must be decrypted first, and are written decrypted.
+func (r *PdfReader) WriteJSON(w io.Writer, opts *core.JSONOpts) error {
+	return r.parser.WriteJSON(w, opts)
+}
+
+// NewPdfWriterFromJSON returns a writer for the document `doc` read from its JSON representation
+// with core.ReadJSON (see PdfReader.WriteJSON). The objects of `doc` are written as they are,
+// only the objects reachable from the trailer being kept. Pages can be added to the document,
+// and the writer options applied, as with a new writer.
+func NewPdfWriterFromJSON(doc *core.JSONDocument) (PdfWriter, error) {
+	w := PdfWriter{
+		objectsMap:     map[core.PdfObject]struct{}{},
+		objects:        []core.PdfObject{},
+		pendingObjects: map[core.PdfObject][]*core.PdfObjectDictionary{},
+		traversed:      map[core.PdfObject]struct{}{},
+		majorVersion:   doc.Version.Major,
+		minorVersion:   doc.Version.Minor,
+	}
+	if doc.Trailer == nil {
+		return w, errors.New("trailer missing")
+	}
+
+	root, ok := doc.Trailer.Get("Root").(*core.PdfIndirectObject)
+	if !ok {
+		return w, errors.New("root catalog missing")
+	}
+	catalog, ok := root.PdfObject.(*core.PdfObjectDictionary)
+	if !ok {
+		return w, errors.New("root catalog not a dictionary")
+	}
+	pages, ok := catalog.Get("Pages").(*core.PdfIndirectObject)
+	if !ok {
+		return w, errors.New("pages tree missing")
+	}
+	if _, ok := pages.PdfObject.(*core.PdfObjectDictionary); !ok {
+		return w, errors.New("pages tree not a dictionary")
+	}
+
+	// The header version is the base version of the document, possibly overridden in the catalog.
+	if version, ok := core.GetNameVal(catalog.Get("Version")); ok {
+		var major, minor int
+		if _, err := fmt.Sscanf(version, "%d.%d", &major, &minor); err == nil &&
+			(major > w.majorVersion || major == w.majorVersion && minor > w.minorVersion) {
+			w.majorVersion, w.minorVersion = major, minor
+		}
+	}
+
+	info, ok := doc.Trailer.Get("Info").(*core.PdfIndirectObject)
+	if !ok {
+		info = core.MakeIndirectObject(core.MakeDict())
+	}
+	w.infoObj = info
+	if err := w.addObjects(info); err != nil {
+		return w, err
+	}
+
+	w.root = root
+	w.catalog = catalog
+	w.pages = pages
+	if err := w.addObjects(root); err != nil {
+		return w, err
+	}
+
+	if ids, ok := core.GetArray(doc.Trailer.Get("ID")); ok {
+		w.ids = ids
+	}
+	return w, nil
+}
@@ -0,0 +1,126 @@
+package model
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/finalversus/doc/pdf/core"
+	"github.com/finalversus/doc/pdf/core/security"
+)
+
+// jsonRoundTrip writes the document loaded by `reader` as JSON, optionally editing the JSON with
+// `edit`, and returns a reader for the document written back from the JSON.
+func jsonRoundTrip(t *testing.T, reader *PdfReader, opts *core.JSONOpts, edit func(string) string) *PdfReader {
+	var buf bytes.Buffer
+	require.NoError(t, reader.WriteJSON(&buf, opts))
+	data := buf.String()
+	if edit != nil {
+		data = edit(data)
+	}
+
+	doc, err := core.ReadJSON(strings.NewReader(data))
+	require.NoError(t, err)
+	w, err := NewPdfWriterFromJSON(doc)
+	require.NoError(t, err)
+
+	buf.Reset()
+	require.NoError(t, w.Write(&buf))
+	reader, err = NewPdfReader(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	return reader
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	w := NewPdfWriter()
+	for i := 1; i <= 2; i++ {
+		page := NewPdfPage()
+		page.MediaBox = &PdfRectangle{Urx: 300, Ury: 300}
+		require.NoError(t, page.SetContentStreams([]string{fmt.Sprintf("BT (Hello %d) Tj ET", i)}, core.NewFlateEncoder()))
+		note := NewPdfAnnotationText()
+		note.Rect = core.MakeArrayFromFloats([]float64{10, 10, 30, 30})
+		note.Contents = core.MakeEncodedString("Привет", true)
+		page.AddAnnotation(note.PdfAnnotation)
+		require.NoError(t, w.AddPage(page))
+	}
+	require.NoError(t, w.Encrypt([]byte("user"), []byte("owner"), &EncryptOptions{Permissions: security.PermOwner}))
+	var buf bytes.Buffer
+	require.NoError(t, w.Write(&buf))
+
+	reader, err := NewPdfReader(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	require.Error(t, reader.WriteJSON(&bytes.Buffer{}, nil))
+	ok, err := reader.Decrypt([]byte("user"))
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	check := func(reader *PdfReader, expected string) {
+		numPages, err := reader.GetNumPages()
+		require.NoError(t, err)
+		require.Equal(t, 2, numPages)
+		for i := 1; i <= numPages; i++ {
+			page, err := reader.GetPage(i)
+			require.NoError(t, err)
+			contents, err := page.GetAllContentStreams()
+			require.NoError(t, err)
+			require.Equal(t, fmt.Sprintf("BT (%s %d) Tj ET", expected, i), contents)
+
+			annots, err := page.GetAnnotations()
+			require.NoError(t, err)
+			require.Len(t, annots, 1)
+			str, ok := core.GetString(annots[0].Contents)
+			require.True(t, ok)
+			require.Equal(t, "Привет", str.Decoded())
+		}
+	}
+
+	for _, decode := range []bool{false, true} {
+		opts := &core.JSONOpts{DecodeStreams: decode, Indent: " "}
+		out := jsonRoundTrip(t, reader, opts, nil)
+		check(out, "Hello")
+
+		// The JSON is decrypted, so is the output.
+		isEncrypted, err := out.IsEncrypted()
+		require.NoError(t, err)
+		require.False(t, isEncrypted)
+	}
+
+	// Scripted edit of the decoded content streams.
+	edited := jsonRoundTrip(t, reader, &core.JSONOpts{DecodeStreams: true}, func(data string) string {
+		return strings.ReplaceAll(data, "(Hello ", "(Bye ")
+	})
+	check(edited, "Bye")
+}
+
+func TestJSONRoundTripForm(t *testing.T) {
+	f, err := os.Open(`testdata/OoPdfFormExample.pdf`)
+	require.NoError(t, err)
+	defer f.Close()
+
+	reader, err := NewPdfReaderLazy(f)
+	require.NoError(t, err)
+
+	for _, decode := range []bool{false, true} {
+		out := jsonRoundTrip(t, reader, &core.JSONOpts{DecodeStreams: decode}, nil)
+		require.NotNil(t, out.AcroForm)
+		require.Len(t, out.AcroForm.AllFields(), 17)
+
+		page, err := out.GetPage(1)
+		require.NoError(t, err)
+		annots, err := page.GetAnnotations()
+		require.NoError(t, err)
+		require.Len(t, annots, 17)
+
+		expected, err := reader.GetPage(1)
+		require.NoError(t, err)
+		expectedContents, err := expected.GetAllContentStreams()
+		require.NoError(t, err)
+		contents, err := page.GetAllContentStreams()
+		require.NoError(t, err)
+		require.Equal(t, expectedContents, contents)
+	}
+}
@@ -0,0 +1,629 @@
+package model
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/finalversus/doc/common"
+	"github.com/finalversus/doc/pdf/core"
+)
+
+// linearizedPlaceholder reserves space for the values of the linearization parameter dictionary
+// and the first-page trailer which are only known once the whole file has been laid out.
+const linearizedPlaceholder = 9999999999
+
+// SetLinearized enables linearized output (PDF32000-1:2008 Annex F, also known as "fast web view").
+// A linearized file starts with the linearization parameter dictionary and the first-page
+// cross-reference section, followed by the document catalog, the primary hint stream and all
+// objects needed to display the first page. The remaining pages, shared objects and other objects
+// follow, with the main cross-reference section at the end of the file. Viewers can therefore
+// display the first page before the whole file has been received.
+// Object streams are not used in linearized output: objects grouped in object streams (e.g. by
+// the optimizer) are written as regular objects.
+func (w *PdfWriter) SetLinearized(linearized bool) {
+	w.linearized = linearized
+}
+
+// linearizedLayout is the order of the objects in a linearized file, by section.
+type linearizedLayout struct {
+	// Document catalog and document-level objects needed when opening the document.
+	openDoc []core.PdfObject
+
+	// Objects of the first page, starting with the page object.
+	firstPage []core.PdfObject
+
+	// Objects of each of the remaining pages, starting with the page object.
+	pages [][]core.PdfObject
+
+	// Objects referenced from more than one of the remaining pages.
+	shared []core.PdfObject
+
+	// Objects not referenced from any page (page tree nodes, outlines, document info etc.).
+	other []core.PdfObject
+
+	// Objects of the first page and shared objects referenced from each of the remaining pages.
+	sharedRefs [][]core.PdfObject
+}
+
+// linearizationParams are the entries of the linearization parameter dictionary.
+type linearizationParams struct {
+	fileLength     int64 // L
+	hintOffset     int64 // H[0]
+	hintLength     int64 // H[1]
+	firstPageObj   int64 // O
+	firstPageEnd   int64 // E
+	numPages       int64 // N
+	mainXrefOffset int64 // T
+}
+
+// toPdfObject returns the linearization parameter dictionary for `p`.
+func (p linearizationParams) toPdfObject() *core.PdfObjectDictionary {
+	dict := core.MakeDict()
+	dict.Set("Linearized", core.MakeFloat(1.0))
+	dict.Set("L", core.MakeInteger(p.fileLength))
+	dict.Set("H", core.MakeArray(core.MakeInteger(p.hintOffset), core.MakeInteger(p.hintLength)))
+	dict.Set("O", core.MakeInteger(p.firstPageObj))
+	dict.Set("E", core.MakeInteger(p.firstPageEnd))
+	dict.Set("N", core.MakeInteger(p.numPages))
+	dict.Set("T", core.MakeInteger(p.mainXrefOffset))
+	return dict
+}
+
+// writeLinearized writes out the objects of the PdfWriter as a linearized PDF.
+func (w *PdfWriter) writeLinearized(writer io.Writer) error {
+	l, err := w.layoutLinearized()
+	if err != nil {
+		return err
+	}
+
+	// The main section (remaining pages, shared and other objects) is numbered from 1, followed by
+	// the first-page section in file order: linearization dictionary, document-level objects,
+	// primary hint stream and the first page objects.
+	var mainObjs []core.PdfObject
+	for _, objs := range l.pages {
+		mainObjs = append(mainObjs, objs...)
+	}
+	mainObjs = append(mainObjs, l.shared...)
+	mainObjs = append(mainObjs, l.other...)
+
+	numbers := make(map[core.PdfObject]int64)
+	for i, obj := range mainObjs {
+		numbers[obj] = int64(i + 1)
+	}
+	mainSize := int64(len(mainObjs) + 1)
+	linNum := mainSize
+	num := linNum + 1
+	for _, obj := range l.openDoc {
+		numbers[obj] = num
+		num++
+	}
+	hintNum := num
+	num++
+	for _, obj := range l.firstPage {
+		numbers[obj] = num
+		num++
+	}
+	size := num
+
+	var ordered []core.PdfObject
+	ordered = append(ordered, l.openDoc...)
+	ordered = append(ordered, l.firstPage...)
+	ordered = append(ordered, mainObjs...)
+	for _, obj := range ordered {
+		setObjectNumber(obj, numbers[obj])
+	}
+
+	// Encrypt prior to writing. Encrypt dictionary should not be encrypted.
+	if w.crypter != nil {
+		for _, obj := range ordered {
+			if obj == w.encryptObj {
+				continue
+			}
+			if err := w.crypter.Encrypt(obj, numbers[obj], 0); err != nil {
+				common.Log.Debug("ERROR: Failed encrypting (%s)", err)
+				return err
+			}
+		}
+	}
+
+	w.crossReferenceMap = make(map[int]crossReference)
+	data := make(map[core.PdfObject][]byte, len(ordered))
+	for _, obj := range ordered {
+		objData, err := w.serializeObject(int(numbers[obj]), obj)
+		if err != nil {
+			return err
+		}
+		data[obj] = objData
+	}
+
+	// In deterministic mode, the file identifier is derived from the objects, unless specified.
+	if w.deterministic != nil && w.ids == nil {
+		idHash := md5.New()
+		for _, obj := range ordered {
+			idHash.Write(data[obj])
+		}
+		w.setFileID(idHash.Sum(nil))
+	}
+
+	// Lay out the file as if the primary hint stream was not present, which is how the offsets in
+	// the hint tables are specified. The hint stream is inserted before the first page section
+	// afterwards.
+	header := fmt.Sprintf("%%PDF-%d.%d\n%%âãÏÓ\n", w.majorVersion, w.minorVersion)
+	placeholder := linearizationParams{
+		fileLength:     linearizedPlaceholder,
+		hintOffset:     linearizedPlaceholder,
+		hintLength:     linearizedPlaceholder,
+		firstPageObj:   numbers[l.firstPage[0]],
+		firstPageEnd:   linearizedPlaceholder,
+		numPages:       int64(1 + len(l.pages)),
+		mainXrefOffset: linearizedPlaceholder,
+	}
+	linLen := len(linearizationObject(linNum, placeholder, 0))
+	fpXrefOffsets := make([]int64, size-linNum)
+	fpXrefLen := len(w.firstPageXref(linNum, fpXrefOffsets, size, linearizedPlaceholder, 0))
+
+	offsets := make(map[core.PdfObject]int64, len(ordered))
+	pos := int64(len(header))
+	linOffset := pos
+	pos += int64(linLen)
+	fpXrefOffset := pos
+	pos += int64(fpXrefLen)
+	for _, obj := range l.openDoc {
+		offsets[obj] = pos
+		pos += int64(len(data[obj]))
+	}
+	hintOffset := pos
+	for _, obj := range l.firstPage {
+		offsets[obj] = pos
+		pos += int64(len(data[obj]))
+	}
+	firstPageEnd := pos
+	for _, obj := range mainObjs {
+		offsets[obj] = pos
+		pos += int64(len(data[obj]))
+	}
+	mainXrefOffset := pos
+
+	hint, err := w.makeHintStream(l, numbers, offsets, data, firstPageEnd)
+	if err != nil {
+		return err
+	}
+	hint.ObjectNumber = hintNum
+	if w.crypter != nil {
+		if err := w.crypter.Encrypt(hint, hintNum, 0); err != nil {
+			return err
+		}
+	}
+	hintData, err := w.serializeObject(int(hintNum), hint)
+	if err != nil {
+		return err
+	}
+	hintLength := int64(len(hintData))
+
+	// Shift everything following the hint stream.
+	for _, obj := range l.firstPage {
+		offsets[obj] += hintLength
+	}
+	for _, obj := range mainObjs {
+		offsets[obj] += hintLength
+	}
+	firstPageEnd += hintLength
+	mainXrefOffset += hintLength
+
+	mainXrefOffsets := make([]int64, len(mainObjs))
+	for i, obj := range mainObjs {
+		mainXrefOffsets[i] = offsets[obj]
+	}
+	mainXref := mainXrefSection(mainXrefOffsets, fpXrefOffset)
+	subsection := fmt.Sprintf("xref\r\n0 %d\r\n", mainSize)
+
+	params := placeholder
+	params.fileLength = mainXrefOffset + int64(len(mainXref))
+	params.hintOffset = hintOffset
+	params.hintLength = hintLength
+	params.firstPageEnd = firstPageEnd
+	// Offset of the white-space character preceding the first entry of the main xref table.
+	params.mainXrefOffset = mainXrefOffset + int64(len(subsection)) - 1
+
+	fpXrefOffsets[0] = linOffset
+	i := 1
+	for _, obj := range l.openDoc {
+		fpXrefOffsets[i] = offsets[obj]
+		i++
+	}
+	fpXrefOffsets[i] = hintOffset
+	i++
+	for _, obj := range l.firstPage {
+		fpXrefOffsets[i] = offsets[obj]
+		i++
+	}
+
+	w.writePos = 0
+	w.writer = bufio.NewWriter(writer)
+	w.writeString(header)
+	w.writeString(linearizationObject(linNum, params, linLen))
+	w.writeString(w.firstPageXref(linNum, fpXrefOffsets, size, mainXrefOffset, fpXrefLen))
+	for _, obj := range l.openDoc {
+		w.writeBytes(data[obj])
+	}
+	w.writeBytes(hintData)
+	for _, obj := range l.firstPage {
+		w.writeBytes(data[obj])
+	}
+	for _, obj := range mainObjs {
+		w.writeBytes(data[obj])
+	}
+	w.writeString(mainXref)
+	if w.writePos != params.fileLength {
+		common.Log.Debug("ERROR: Linearized file length mismatch: %d != %d", w.writePos, params.fileLength)
+		return errors.New("linearized file layout mismatch")
+	}
+
+	return w.writer.Flush()
+}
+
+// layoutLinearized sorts the objects of the PdfWriter into the sections of a linearized file.
+func (w *PdfWriter) layoutLinearized() (*linearizedLayout, error) {
+	objects := flattenObjectStreams(w.objects)
+	inFile := make(map[core.PdfObject]bool, len(objects))
+	for _, obj := range objects {
+		inFile[obj] = true
+	}
+
+	catalog, ok := w.root.PdfObject.(*core.PdfObjectDictionary)
+	if !ok {
+		return nil, errors.New("invalid catalog (not a dict)")
+	}
+	pageObjs := collectPageObjects(catalog.Get("Pages"))
+	if len(pageObjs) == 0 {
+		return nil, errors.New("linearized output requires at least one page")
+	}
+
+	l := &linearizedLayout{}
+	assigned := map[core.PdfObject]bool{w.root: true}
+	l.openDoc = append(l.openDoc, w.root)
+	if w.encryptObj != nil && inFile[w.encryptObj] {
+		l.openDoc = append(l.openDoc, w.encryptObj)
+		assigned[w.encryptObj] = true
+	}
+	var roots []core.PdfObject
+	for _, key := range []core.PdfObjectName{"ViewerPreferences", "PageMode", "Threads", "OpenAction", "AcroForm"} {
+		val := catalog.Get(key)
+		if isIndirectObject(val) {
+			roots = append(roots, val)
+		} else if val != nil {
+			roots = append(roots, indirectRefs(val)...)
+		}
+	}
+	openDoc := reachableObjects(roots, func(obj core.PdfObject) bool {
+		return !inFile[obj] || assigned[obj] || isPageTreeNode(obj)
+	})
+	for _, obj := range openDoc {
+		l.openDoc = append(l.openDoc, obj)
+		assigned[obj] = true
+	}
+
+	// Objects reachable from each page, not descending into other pages and the page tree.
+	pageReach := make([][]core.PdfObject, len(pageObjs))
+	users := make(map[core.PdfObject]int)
+	for i, page := range pageObjs {
+		page := page
+		pageReach[i] = reachableObjects([]core.PdfObject{page}, func(obj core.PdfObject) bool {
+			return !inFile[obj] || assigned[obj] || (obj != page && isPageTreeNode(obj))
+		})
+		for _, obj := range pageReach[i] {
+			users[obj]++
+		}
+	}
+
+	l.firstPage = pageReach[0]
+	groups := make(map[core.PdfObject]bool)
+	for _, obj := range l.firstPage {
+		assigned[obj] = true
+		groups[obj] = true
+	}
+	for _, objs := range pageReach[1:] {
+		var private []core.PdfObject
+		for _, obj := range objs {
+			if !assigned[obj] && users[obj] == 1 {
+				private = append(private, obj)
+			}
+		}
+		l.pages = append(l.pages, private)
+	}
+	for _, objs := range pageReach[1:] {
+		for _, obj := range objs {
+			if !assigned[obj] && users[obj] > 1 {
+				l.shared = append(l.shared, obj)
+				assigned[obj] = true
+				groups[obj] = true
+			}
+		}
+	}
+	for _, objs := range pageReach[1:] {
+		var refs []core.PdfObject
+		for _, obj := range objs {
+			if groups[obj] {
+				refs = append(refs, obj)
+			}
+		}
+		l.sharedRefs = append(l.sharedRefs, refs)
+	}
+	for _, objs := range l.pages {
+		for _, obj := range objs {
+			assigned[obj] = true
+		}
+	}
+
+	for _, obj := range objects {
+		if !assigned[obj] {
+			l.other = append(l.other, obj)
+		}
+	}
+	return l, nil
+}
+
+// makeHintStream generates the primary hint stream with the page offset and shared object hint
+// tables for the layout `l`. The `offsets` do not account for the hint stream.
+func (w *PdfWriter) makeHintStream(l *linearizedLayout, numbers, offsets map[core.PdfObject]int64,
+	data map[core.PdfObject][]byte, firstPageEnd int64) (*core.PdfObjectStream, error) {
+	end := func(obj core.PdfObject) int64 {
+		return offsets[obj] + int64(len(data[obj]))
+	}
+
+	// Shared object groups consist of a single object: the objects of the first page, followed by
+	// the objects of the shared objects section.
+	groupIDs := make(map[core.PdfObject]int)
+	shared := &core.SharedObjectHintTable{NumFirstPage: len(l.firstPage)}
+	for _, obj := range append(append([]core.PdfObject{}, l.firstPage...), l.shared...) {
+		groupIDs[obj] = len(shared.Groups)
+		shared.Groups = append(shared.Groups, core.SharedObjectHint{Length: int64(len(data[obj])), NumObjects: 1})
+	}
+	if len(l.shared) > 0 {
+		shared.FirstObjectNumber = int(numbers[l.shared[0]])
+		shared.FirstObjectOffset = offsets[l.shared[0]]
+	}
+
+	firstPageOffset := offsets[l.firstPage[0]]
+	pages := &core.PageOffsetHintTable{FirstPageOffset: firstPageOffset}
+	length := firstPageEnd - firstPageOffset
+	pages.Pages = append(pages.Pages, core.PageOffsetHint{
+		NumObjects:    len(l.firstPage),
+		Length:        length,
+		ContentLength: length,
+	})
+	for i, objs := range l.pages {
+		length := end(objs[len(objs)-1]) - offsets[objs[0]]
+		hint := core.PageOffsetHint{
+			NumObjects:    len(objs),
+			Length:        length,
+			ContentLength: length,
+		}
+		for _, obj := range l.sharedRefs[i] {
+			hint.SharedRefs = append(hint.SharedRefs, groupIDs[obj])
+		}
+		pages.Pages = append(pages.Pages, hint)
+	}
+
+	hintData, sharedOffset := core.EncodeHintTables(pages, shared)
+	stream, err := core.MakeStream(hintData, core.NewFlateEncoder())
+	if err != nil {
+		return nil, err
+	}
+	stream.Set("S", core.MakeInteger(int64(sharedOffset)))
+	return stream, nil
+}
+
+// serializeObject returns the serialized indirect object `obj` with object number `num`.
+func (w *PdfWriter) serializeObject(num int, obj core.PdfObject) ([]byte, error) {
+	var buf bytes.Buffer
+	writer, writePos := w.writer, w.writePos
+	w.writer = bufio.NewWriter(&buf)
+	w.writePos = 0
+	err := w.writeObject(num, obj)
+	w.writer.Flush()
+	w.writer, w.writePos = writer, writePos
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// firstPageXref returns the first-page cross-reference section and trailer of a linearized file,
+// padded to `reserved` bytes. `prev` is the offset of the main cross-reference section.
+func (w *PdfWriter) firstPageXref(start int64, offsets []int64, size, prev int64, reserved int) string {
+	var b strings.Builder
+	b.WriteString("xref\r\n")
+	b.WriteString(fmt.Sprintf("%d %d\r\n", start, len(offsets)))
+	for _, offset := range offsets {
+		b.WriteString(fmt.Sprintf("%.10d %.5d n\r\n", offset, 0))
+	}
+
+	trailer := core.MakeDict()
+	trailer.Set("Size", core.MakeInteger(size))
+	trailer.Set("Prev", core.MakeInteger(prev))
+	trailer.Set("Info", w.infoObj)
+	trailer.Set("Root", w.root)
+	if w.crypter != nil {
+		trailer.Set("Encrypt", w.encryptObj)
+	}
+	if w.ids != nil {
+		trailer.Set("ID", w.ids)
+	}
+	b.WriteString("trailer\n")
+	b.WriteString(trailer.WriteString())
+	b.WriteString("\n")
+	if pad := reserved - b.Len() - len("startxref\n0\n%%EOF\n"); pad > 0 {
+		b.WriteString(strings.Repeat(" ", pad-1) + "\n")
+	}
+	b.WriteString("startxref\n0\n%%EOF\n")
+	return b.String()
+}
+
+// mainXrefSection returns the main cross-reference section and trailer of a linearized file for
+// objects 1 to len(offsets). `firstPageXref` is the offset of the first-page cross-reference section.
+func mainXrefSection(offsets []int64, firstPageXref int64) string {
+	var b strings.Builder
+	b.WriteString("xref\r\n")
+	b.WriteString(fmt.Sprintf("0 %d\r\n", len(offsets)+1))
+	b.WriteString(fmt.Sprintf("%.10d %.5d f\r\n", 0, 65535))
+	for _, offset := range offsets {
+		b.WriteString(fmt.Sprintf("%.10d %.5d n\r\n", offset, 0))
+	}
+	trailer := core.MakeDict()
+	trailer.Set("Size", core.MakeInteger(int64(len(offsets)+1)))
+	b.WriteString("trailer\n")
+	b.WriteString(trailer.WriteString())
+	b.WriteString(fmt.Sprintf("\nstartxref\n%d\n%%%%EOF\n", firstPageXref))
+	return b.String()
+}
+
+// linearizationObject returns the linearization parameter dictionary object, padded to `reserved` bytes.
+func linearizationObject(num int64, params linearizationParams, reserved int) string {
+	obj := fmt.Sprintf("%d 0 obj\n%s", num, params.toPdfObject().WriteString())
+	const end = "\nendobj\n"
+	if pad := reserved - len(obj) - len(end); pad > 0 {
+		obj += strings.Repeat(" ", pad)
+	}
+	return obj + end
+}
+
+// flattenObjectStreams replaces the object streams in `objects` by the objects they contain.
+func flattenObjectStreams(objects []core.PdfObject) []core.PdfObject {
+	flat := make([]core.PdfObject, 0, len(objects))
+	seen := make(map[core.PdfObject]bool, len(objects))
+	for _, obj := range objects {
+		elements := []core.PdfObject{obj}
+		if ostreams, ok := obj.(*core.PdfObjectStreams); ok {
+			elements = ostreams.Elements()
+		}
+		for _, elem := range elements {
+			if !seen[elem] {
+				seen[elem] = true
+				flat = append(flat, elem)
+			}
+		}
+	}
+	return flat
+}
+
+// collectPageObjects returns the page objects of the page tree `node` in document order.
+func collectPageObjects(node core.PdfObject) []core.PdfObject {
+	var pages []core.PdfObject
+	visited := make(map[core.PdfObject]bool)
+	var walk func(node core.PdfObject)
+	walk = func(node core.PdfObject) {
+		ind, ok := node.(*core.PdfIndirectObject)
+		if !ok || visited[ind] {
+			return
+		}
+		visited[ind] = true
+		dict, ok := ind.PdfObject.(*core.PdfObjectDictionary)
+		if !ok {
+			return
+		}
+		switch name, _ := core.GetNameVal(dict.Get("Type")); name {
+		case "Page":
+			pages = append(pages, ind)
+		case "Pages":
+			if kids, ok := core.GetArray(dict.Get("Kids")); ok {
+				for _, kid := range kids.Elements() {
+					walk(kid)
+				}
+			}
+		}
+	}
+	walk(node)
+	return pages
+}
+
+// reachableObjects returns the indirect objects reachable from `roots` in breadth-first order,
+// skipping the objects for which `skip` returns true.
+func reachableObjects(roots []core.PdfObject, skip func(obj core.PdfObject) bool) []core.PdfObject {
+	var list []core.PdfObject
+	seen := make(map[core.PdfObject]bool)
+	queue := append([]core.PdfObject{}, roots...)
+	for len(queue) > 0 {
+		obj := queue[0]
+		queue = queue[1:]
+		if seen[obj] || skip(obj) {
+			continue
+		}
+		seen[obj] = true
+		list = append(list, obj)
+		queue = append(queue, indirectRefs(obj)...)
+	}
+	return list
+}
+
+// indirectRefs returns the indirect objects directly referenced from `obj`.
+func indirectRefs(obj core.PdfObject) []core.PdfObject {
+	var refs []core.PdfObject
+	var walk func(obj core.PdfObject)
+	walk = func(obj core.PdfObject) {
+		switch t := obj.(type) {
+		case *core.PdfIndirectObject, *core.PdfObjectStream:
+			refs = append(refs, t)
+		case *core.PdfObjectDictionary:
+			for _, key := range t.Keys() {
+				walk(t.Get(key))
+			}
+		case *pdfSignDictionary:
+			walk(t.PdfObjectDictionary)
+		case *core.PdfObjectArray:
+			for _, elem := range t.Elements() {
+				walk(elem)
+			}
+		}
+	}
+
+	switch t := obj.(type) {
+	case *core.PdfIndirectObject:
+		walk(t.PdfObject)
+	case *core.PdfObjectStream:
+		walk(t.PdfObjectDictionary)
+	default:
+		walk(obj)
+	}
+	return refs
+}
+
+// isIndirectObject returns true if `obj` is an indirect or stream object.
+func isIndirectObject(obj core.PdfObject) bool {
+	switch obj.(type) {
+	case *core.PdfIndirectObject, *core.PdfObjectStream:
+		return true
+	}
+	return false
+}
+
+// isPageTreeNode returns true if `obj` is a page or page tree node.
+func isPageTreeNode(obj core.PdfObject) bool {
+	ind, ok := obj.(*core.PdfIndirectObject)
+	if !ok {
+		return false
+	}
+	dict, ok := ind.PdfObject.(*core.PdfObjectDictionary)
+	if !ok {
+		return false
+	}
+	name, _ := core.GetNameVal(dict.Get("Type"))
+	return name == "Page" || name == "Pages"
+}
+
+// setObjectNumber sets the object number of the indirect object `obj`.
+func setObjectNumber(obj core.PdfObject, num int64) {
+	switch t := obj.(type) {
+	case *core.PdfIndirectObject:
+		t.ObjectNumber = num
+		t.GenerationNumber = 0
+	case *core.PdfObjectStream:
+		t.ObjectNumber = num
+		t.GenerationNumber = 0
+	}
+}
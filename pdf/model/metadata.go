@@ -0,0 +1,95 @@
+package model
+
+import (
+	"github.com/finalversus/doc/pdf/core"
+	"github.com/finalversus/doc/pdf/model/xmp"
+)
+
+// GetXMP returns the XMP metadata of the document (metadata stream of the catalog), or nil if the
+// document has none.
+func (r *PdfReader) GetXMP() (*xmp.Document, error) {
+	stream, ok := core.GetStream(r.catalog.Get("Metadata"))
+	if !ok {
+		return nil, nil
+	}
+	data, err := core.DecodeStream(stream)
+	if err != nil {
+		return nil, err
+	}
+	return xmp.Parse(data)
+}
+
+// SetXMP sets the XMP metadata of the output document. When writing, the entries of the document
+// information dictionary (see SetDocInfo) are copied to `doc`, so that both are consistent.
+func (w *PdfWriter) SetXMP(doc *xmp.Document) {
+	w.xmp = doc
+}
+
+// SetXMP sets the XMP metadata of the updated document. When writing, the entries of the document
+// information dictionary (see SetDocInfo) are copied to `doc`, so that both are consistent.
+// If only the document information dictionary is set, the XMP metadata of the document (if any)
+// is updated accordingly.
+func (a *PdfAppender) SetXMP(doc *xmp.Document) {
+	a.xmp = doc
+}
+
+// writeXMP synchronizes the XMP metadata of the writer with its document information dictionary,
+// and adds it to the catalog as a metadata stream.
+func (w *PdfWriter) writeXMP() error {
+	if infoDict, ok := core.GetDict(w.infoObj); ok {
+		info, err := NewPdfInfoFromObject(infoDict)
+		if err != nil {
+			return err
+		}
+		syncXMPWithInfo(w.xmp, info)
+	}
+
+	data, err := w.xmp.Marshal(nil)
+	if err != nil {
+		return err
+	}
+	stream, err := core.MakeStream(data, nil)
+	if err != nil {
+		return err
+	}
+	stream.Set("Type", core.MakeName("Metadata"))
+	stream.Set("Subtype", core.MakeName("XML"))
+	w.catalog.Set("Metadata", stream)
+	return w.addObjects(stream)
+}
+
+// syncXMPWithInfo sets the XMP properties corresponding to the entries of the document information
+// dictionary `info` (section 14.3.2 of the PDF 1.7 standard), overwriting their values.
+func syncXMPWithInfo(doc *xmp.Document, info *PdfInfo) {
+	if doc.DublinCore.Format == "" {
+		doc.DublinCore.Format = "application/pdf"
+	}
+	if info.Title != nil {
+		doc.DublinCore.Title.SetDefault(info.Title.Decoded())
+	}
+	if info.Author != nil {
+		doc.DublinCore.Creator = []string{info.Author.Decoded()}
+	}
+	if info.Subject != nil {
+		doc.DublinCore.Description.SetDefault(info.Subject.Decoded())
+	}
+	if info.Keywords != nil {
+		doc.PDF.Keywords = info.Keywords.Decoded()
+	}
+	if info.Creator != nil {
+		doc.Basic.CreatorTool = info.Creator.Decoded()
+	}
+	if info.Producer != nil {
+		doc.PDF.Producer = info.Producer.Decoded()
+	}
+	if info.CreationDate != nil {
+		doc.Basic.CreateDate = info.CreationDate.ToGoTime()
+	}
+	if info.ModifiedDate != nil {
+		doc.Basic.ModifyDate = info.ModifiedDate.ToGoTime()
+		doc.Basic.MetadataDate = doc.Basic.ModifyDate
+	}
+	if info.Trapped != nil {
+		doc.PDF.Trapped = info.Trapped.String()
+	}
+}
@@ -0,0 +1,112 @@
+package model
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/finalversus/doc/pdf/core"
+	"github.com/finalversus/doc/pdf/model/xmp"
+)
+
+func TestXMPWriter(t *testing.T) {
+	modified, err := NewPdfDateFromTime(time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC))
+	require.NoError(t, err)
+	info := NewPdfInfo()
+	info.Title = NewPdfInfoText("Title")
+	info.Subject = NewPdfInfoText("Subject")
+	info.Keywords = NewPdfInfoText("a, b")
+	info.Producer = NewPdfInfoText("Producer")
+	info.ModifiedDate = &modified
+	info.Trapped = core.MakeName("False")
+
+	doc := xmp.NewDocument()
+	doc.DublinCore.Title.Set("fr", "Titre")
+	doc.PDFAID = xmp.PDFAID{Part: 2, Conformance: "B"}
+
+	w := NewPdfWriter()
+	w.SetDocInfo(info)
+	w.SetXMP(doc)
+	reader := writeTestDocument(t, &w)
+
+	stream, ok := core.GetStream(reader.catalog.Get("Metadata"))
+	require.True(t, ok)
+	require.Equal(t, "Metadata", stream.Get("Type").(*core.PdfObjectName).String())
+	require.Equal(t, "XML", stream.Get("Subtype").(*core.PdfObjectName).String())
+
+	readDoc, err := reader.GetXMP()
+	require.NoError(t, err)
+	require.Equal(t, xmp.LangAlt{{Lang: "x-default", Text: "Title"}, {Lang: "fr", Text: "Titre"}}, readDoc.DublinCore.Title)
+	require.Equal(t, "Subject", readDoc.DublinCore.Description.Default())
+	require.Equal(t, "application/pdf", readDoc.DublinCore.Format)
+	require.Equal(t, xmp.PDF{Producer: "Producer", Keywords: "a, b", Trapped: "False"}, readDoc.PDF)
+	require.Equal(t, xmp.PDFAID{Part: 2, Conformance: "B"}, readDoc.PDFAID)
+	require.True(t, modified.ToGoTime().Equal(readDoc.Basic.ModifyDate))
+	require.True(t, modified.ToGoTime().Equal(readDoc.Basic.MetadataDate))
+
+	// Documents without metadata stream.
+	w = NewPdfWriter()
+	readDoc, err = writeTestDocument(t, &w).GetXMP()
+	require.NoError(t, err)
+	require.Nil(t, readDoc)
+}
+
+func TestXMPAppender(t *testing.T) {
+	// Write a document with XMP metadata.
+	info := NewPdfInfo()
+	info.Title = NewPdfInfoText("Original")
+	doc := xmp.NewDocument()
+	doc.SetProperty("http://example.com/ns/", "id", xmp.NewText("42"))
+	w := NewPdfWriter()
+	w.SetDocInfo(info)
+	w.SetXMP(doc)
+	page := NewPdfPage()
+	page.MediaBox = &PdfRectangle{Urx: 100, Ury: 100}
+	require.NoError(t, w.AddPage(page))
+	var buf bytes.Buffer
+	require.NoError(t, w.Write(&buf))
+
+	// Updating the info dictionary updates the existing XMP metadata.
+	reader, err := NewPdfReader(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	info, err = reader.GetPdfInfo()
+	require.NoError(t, err)
+	info.Title = NewPdfInfoText("Updated")
+	appender, err := NewPdfAppender(reader)
+	require.NoError(t, err)
+	appender.SetDocInfo(info)
+	var out bytes.Buffer
+	require.NoError(t, appender.Write(&out))
+
+	reader, err = NewPdfReader(bytes.NewReader(out.Bytes()))
+	require.NoError(t, err)
+	readDoc, err := reader.GetXMP()
+	require.NoError(t, err)
+	require.Equal(t, "Updated", readDoc.DublinCore.Title.Default())
+	id, ok := readDoc.GetProperty("http://example.com/ns/", "id")
+	require.True(t, ok)
+	require.Equal(t, "42", id.Text)
+
+	// XMP metadata can be added to documents without metadata.
+	f, err := os.Open("testdata/minimal.pdf")
+	require.NoError(t, err)
+	defer f.Close()
+	reader, err = NewPdfReader(f)
+	require.NoError(t, err)
+	appender, err = NewPdfAppender(reader)
+	require.NoError(t, err)
+	doc = xmp.NewDocument()
+	doc.DublinCore.Subject = []string{"added"}
+	appender.SetXMP(doc)
+	out.Reset()
+	require.NoError(t, appender.Write(&out))
+
+	reader, err = NewPdfReader(bytes.NewReader(out.Bytes()))
+	require.NoError(t, err)
+	readDoc, err = reader.GetXMP()
+	require.NoError(t, err)
+	require.Equal(t, []string{"added"}, readDoc.DublinCore.Subject)
+}
@@ -0,0 +1,470 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/finalversus/doc/common"
+	"github.com/finalversus/doc/pdf/core"
+)
+
+// maxTreeDepth is the maximum depth of the name and number trees which are traversed.
+const maxTreeDepth = 32
+
+// treeNodeSize is the maximum number of entries of the leaf nodes and of kids of the intermediate
+// nodes of the trees built by ToPdfObject.
+const treeNodeSize = 64
+
+// PdfNameTree represents a name tree (section 7.9.6 of the PDF 1.7 standard), which maps string
+// keys to objects, e.g. the named destinations or the embedded files of the document.
+// Trees loaded from objects are parsed lazily: Get only traverses the nodes which may contain the
+// key, and the whole tree is loaded on the first iteration or modification.
+type PdfNameTree struct {
+	tree pdfTree
+}
+
+// NewPdfNameTree returns an empty name tree.
+func NewPdfNameTree() *PdfNameTree {
+	return &PdfNameTree{tree: pdfTree{loaded: true, modified: true}}
+}
+
+// NewPdfNameTreeFromObject returns the name tree of root node `obj`.
+func NewPdfNameTreeFromObject(obj core.PdfObject) (*PdfNameTree, error) {
+	if _, ok := core.GetDict(obj); !ok {
+		return nil, fmt.Errorf("invalid name tree type: %T", obj)
+	}
+	return &PdfNameTree{tree: pdfTree{root: obj}}, nil
+}
+
+// Get returns the value of `key`, or nil if the tree does not contain the key.
+func (t *PdfNameTree) Get(key string) (core.PdfObject, error) {
+	return t.tree.get(treeKey{name: key})
+}
+
+// Set sets the value of `key`, adding the key to the tree if needed.
+func (t *PdfNameTree) Set(key string, value core.PdfObject) error {
+	return t.tree.set(treeKey{name: key}, value)
+}
+
+// Remove removes `key` from the tree. It returns false if the tree does not contain the key.
+func (t *PdfNameTree) Remove(key string) (bool, error) {
+	return t.tree.remove(treeKey{name: key})
+}
+
+// Len returns the number of keys of the tree.
+func (t *PdfNameTree) Len() (int, error) {
+	if err := t.tree.load(); err != nil {
+		return 0, err
+	}
+	return len(t.tree.entries), nil
+}
+
+// Keys returns the keys of the tree in order.
+func (t *PdfNameTree) Keys() ([]string, error) {
+	var keys []string
+	err := t.Walk(func(key string, _ core.PdfObject) error {
+		keys = append(keys, key)
+		return nil
+	})
+	return keys, err
+}
+
+// Walk calls `fn` with the entries of the tree in key order. It stops at the first error of `fn`.
+// The tree must not be modified by `fn`.
+func (t *PdfNameTree) Walk(fn func(key string, value core.PdfObject) error) error {
+	return t.tree.walk(func(key treeKey, value core.PdfObject) error {
+		return fn(key.name, value)
+	})
+}
+
+// ToPdfObject returns the root node of the tree. Modified trees are rebuilt as balanced trees,
+// and unmodified trees are returned as loaded.
+func (t *PdfNameTree) ToPdfObject() core.PdfObject {
+	return t.tree.toPdfObject()
+}
+
+// PdfNumberTree represents a number tree (section 7.9.7 of the PDF 1.7 standard), which maps
+// integer keys to objects, e.g. the page labels or the parent tree of the structure tree.
+// Trees loaded from objects are parsed lazily: Get only traverses the nodes which may contain the
+// key, and the whole tree is loaded on the first iteration or modification.
+type PdfNumberTree struct {
+	tree pdfTree
+}
+
+// NewPdfNumberTree returns an empty number tree.
+func NewPdfNumberTree() *PdfNumberTree {
+	return &PdfNumberTree{tree: pdfTree{numbers: true, loaded: true, modified: true}}
+}
+
+// NewPdfNumberTreeFromObject returns the number tree of root node `obj`.
+func NewPdfNumberTreeFromObject(obj core.PdfObject) (*PdfNumberTree, error) {
+	if _, ok := core.GetDict(obj); !ok {
+		return nil, fmt.Errorf("invalid number tree type: %T", obj)
+	}
+	return &PdfNumberTree{tree: pdfTree{root: obj, numbers: true}}, nil
+}
+
+// Get returns the value of `key`, or nil if the tree does not contain the key.
+func (t *PdfNumberTree) Get(key int) (core.PdfObject, error) {
+	return t.tree.get(treeKey{num: key})
+}
+
+// Set sets the value of `key`, adding the key to the tree if needed.
+func (t *PdfNumberTree) Set(key int, value core.PdfObject) error {
+	return t.tree.set(treeKey{num: key}, value)
+}
+
+// Remove removes `key` from the tree. It returns false if the tree does not contain the key.
+func (t *PdfNumberTree) Remove(key int) (bool, error) {
+	return t.tree.remove(treeKey{num: key})
+}
+
+// Len returns the number of keys of the tree.
+func (t *PdfNumberTree) Len() (int, error) {
+	if err := t.tree.load(); err != nil {
+		return 0, err
+	}
+	return len(t.tree.entries), nil
+}
+
+// Keys returns the keys of the tree in order.
+func (t *PdfNumberTree) Keys() ([]int, error) {
+	var keys []int
+	err := t.Walk(func(key int, _ core.PdfObject) error {
+		keys = append(keys, key)
+		return nil
+	})
+	return keys, err
+}
+
+// Walk calls `fn` with the entries of the tree in key order. It stops at the first error of `fn`.
+// The tree must not be modified by `fn`.
+func (t *PdfNumberTree) Walk(fn func(key int, value core.PdfObject) error) error {
+	return t.tree.walk(func(key treeKey, value core.PdfObject) error {
+		return fn(key.num, value)
+	})
+}
+
+// ToPdfObject returns the root node of the tree. Modified trees are rebuilt as balanced trees,
+// and unmodified trees are returned as loaded.
+func (t *PdfNumberTree) ToPdfObject() core.PdfObject {
+	return t.tree.toPdfObject()
+}
+
+// treeKey is a key of a name tree (name) or of a number tree (num).
+type treeKey struct {
+	name string
+	num  int
+}
+
+// treeEntry is an entry of a name or number tree.
+type treeEntry struct {
+	key   treeKey
+	value core.PdfObject
+}
+
+// pdfTree implements the name and number trees.
+type pdfTree struct {
+	// numbers is true for number trees.
+	numbers bool
+
+	// root is the root node the tree was loaded from.
+	root core.PdfObject
+
+	// entries are the entries of the tree in key order, once loaded.
+	entries  []treeEntry
+	loaded   bool
+	modified bool
+}
+
+// entriesKey returns the key of the entries array of the leaf nodes.
+func (t *pdfTree) entriesKey() core.PdfObjectName {
+	if t.numbers {
+		return "Nums"
+	}
+	return "Names"
+}
+
+// less returns true if key `a` is ordered before key `b`.
+func (t *pdfTree) less(a, b treeKey) bool {
+	if t.numbers {
+		return a.num < b.num
+	}
+	return a.name < b.name
+}
+
+// parseKey returns the key of object `obj`.
+func (t *pdfTree) parseKey(obj core.PdfObject) (treeKey, error) {
+	if t.numbers {
+		num, ok := core.GetIntVal(obj)
+		if !ok {
+			return treeKey{}, fmt.Errorf("invalid number tree key: %v", obj)
+		}
+		return treeKey{num: num}, nil
+	}
+	str, ok := core.GetString(obj)
+	if !ok {
+		return treeKey{}, fmt.Errorf("invalid name tree key: %v", obj)
+	}
+	return treeKey{name: str.Str()}, nil
+}
+
+// keyObject returns the object of key `key`.
+func (t *pdfTree) keyObject(key treeKey) core.PdfObject {
+	if t.numbers {
+		return core.MakeInteger(int64(key.num))
+	}
+	return core.MakeString(key.name)
+}
+
+// search returns the index of the first loaded entry not ordered before `key`.
+func (t *pdfTree) search(key treeKey) int {
+	return sort.Search(len(t.entries), func(i int) bool { return !t.less(t.entries[i].key, key) })
+}
+
+// get returns the value of `key`. Unless the tree is loaded, only the nodes whose limits include
+// the key are traversed.
+func (t *pdfTree) get(key treeKey) (core.PdfObject, error) {
+	if t.loaded {
+		if i := t.search(key); i < len(t.entries) && t.entries[i].key == key {
+			return t.entries[i].value, nil
+		}
+		return nil, nil
+	}
+	return t.getFromNode(t.root, key, 0)
+}
+
+// getFromNode returns the value of `key` in the subtree of node `obj`.
+func (t *pdfTree) getFromNode(obj core.PdfObject, key treeKey, depth int) (core.PdfObject, error) {
+	if depth > maxTreeDepth {
+		return nil, errors.New("tree too deep")
+	}
+	node, ok := core.GetDict(obj)
+	if !ok {
+		return nil, fmt.Errorf("invalid tree node type: %T", obj)
+	}
+	if entries, ok := core.GetArray(node.Get(t.entriesKey())); ok {
+		for i := 0; i+1 < entries.Len(); i += 2 {
+			k, err := t.parseKey(entries.Get(i))
+			if err != nil {
+				return nil, err
+			}
+			if k == key {
+				return entries.Get(i + 1), nil
+			}
+		}
+	}
+	kids, ok := core.GetArray(node.Get("Kids"))
+	if !ok {
+		return nil, nil
+	}
+	for _, kid := range kids.Elements() {
+		kidNode, ok := core.GetDict(kid)
+		if !ok {
+			return nil, fmt.Errorf("invalid tree node type: %T", kid)
+		}
+		if low, high, ok := t.limits(kidNode); ok && (t.less(key, low) || t.less(high, key)) {
+			continue
+		}
+		value, err := t.getFromNode(kidNode, key, depth+1)
+		if value != nil || err != nil {
+			return value, err
+		}
+	}
+	return nil, nil
+}
+
+// limits returns the key range of `node`. Invalid limits are ignored.
+func (t *pdfTree) limits(node *core.PdfObjectDictionary) (low, high treeKey, ok bool) {
+	limits, ok := core.GetArray(node.Get("Limits"))
+	if !ok || limits.Len() != 2 {
+		return low, high, false
+	}
+	low, err := t.parseKey(limits.Get(0))
+	if err != nil {
+		return low, high, false
+	}
+	high, err = t.parseKey(limits.Get(1))
+	if err != nil {
+		return low, high, false
+	}
+	return low, high, true
+}
+
+// load loads the entries of the tree, if not loaded yet.
+func (t *pdfTree) load() error {
+	if t.loaded {
+		return nil
+	}
+	var entries []treeEntry
+	if err := t.collect(t.root, 0, &entries); err != nil {
+		return err
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return t.less(entries[i].key, entries[j].key) })
+
+	// Only the first entry of duplicated keys is kept.
+	t.entries = entries[:0]
+	for i, entry := range entries {
+		if i > 0 && entry.key == entries[i-1].key {
+			common.Log.Debug("Duplicate tree key %v - ignoring", t.keyObject(entry.key))
+			continue
+		}
+		t.entries = append(t.entries, entry)
+	}
+	t.loaded = true
+	return nil
+}
+
+// collect appends the entries of the subtree of node `obj` to `entries`.
+func (t *pdfTree) collect(obj core.PdfObject, depth int, entries *[]treeEntry) error {
+	if depth > maxTreeDepth {
+		return errors.New("tree too deep")
+	}
+	node, ok := core.GetDict(obj)
+	if !ok {
+		return fmt.Errorf("invalid tree node type: %T", obj)
+	}
+	if kids, ok := core.GetArray(node.Get("Kids")); ok {
+		for _, kid := range kids.Elements() {
+			if err := t.collect(kid, depth+1, entries); err != nil {
+				return err
+			}
+		}
+	}
+	if arr, ok := core.GetArray(node.Get(t.entriesKey())); ok {
+		for i := 0; i+1 < arr.Len(); i += 2 {
+			key, err := t.parseKey(arr.Get(i))
+			if err != nil {
+				return err
+			}
+			*entries = append(*entries, treeEntry{key: key, value: arr.Get(i + 1)})
+		}
+	}
+	return nil
+}
+
+// walk calls `fn` with the entries of the tree in order.
+func (t *pdfTree) walk(fn func(key treeKey, value core.PdfObject) error) error {
+	if err := t.load(); err != nil {
+		return err
+	}
+	for _, entry := range t.entries {
+		if err := fn(entry.key, entry.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// set sets the value of `key`.
+func (t *pdfTree) set(key treeKey, value core.PdfObject) error {
+	if value == nil {
+		return errors.New("nil tree value")
+	}
+	if err := t.load(); err != nil {
+		return err
+	}
+	i := t.search(key)
+	if i < len(t.entries) && t.entries[i].key == key {
+		t.entries[i].value = value
+	} else {
+		t.entries = append(t.entries, treeEntry{})
+		copy(t.entries[i+1:], t.entries[i:])
+		t.entries[i] = treeEntry{key: key, value: value}
+	}
+	t.modified = true
+	return nil
+}
+
+// remove removes `key` from the tree.
+func (t *pdfTree) remove(key treeKey) (bool, error) {
+	if err := t.load(); err != nil {
+		return false, err
+	}
+	i := t.search(key)
+	if i == len(t.entries) || t.entries[i].key != key {
+		return false, nil
+	}
+	t.entries = append(t.entries[:i], t.entries[i+1:]...)
+	t.modified = true
+	return true, nil
+}
+
+// treeNode is a node of a tree being built, with its key range.
+type treeNode struct {
+	obj       *core.PdfIndirectObject
+	low, high treeKey
+}
+
+// toPdfObject returns the root node of the tree, rebuilt as a balanced tree if modified.
+func (t *pdfTree) toPdfObject() core.PdfObject {
+	if !t.modified {
+		return t.root
+	}
+
+	if len(t.entries) <= treeNodeSize {
+		root := core.MakeDict()
+		root.Set(t.entriesKey(), t.entriesArray(t.entries))
+		return core.MakeIndirectObject(root)
+	}
+
+	var nodes []treeNode
+	for _, chunk := range splitTreeNodes(len(t.entries)) {
+		entries := t.entries[chunk[0]:chunk[1]]
+		leaf := core.MakeDict()
+		leaf.Set(t.entriesKey(), t.entriesArray(entries))
+		nodes = append(nodes, t.makeNode(leaf, entries[0].key, entries[len(entries)-1].key))
+	}
+	for len(nodes) > treeNodeSize {
+		var parents []treeNode
+		for _, chunk := range splitTreeNodes(len(nodes)) {
+			kids := nodes[chunk[0]:chunk[1]]
+			parent := core.MakeDict()
+			parent.Set("Kids", treeNodesArray(kids))
+			parents = append(parents, t.makeNode(parent, kids[0].low, kids[len(kids)-1].high))
+		}
+		nodes = parents
+	}
+
+	root := core.MakeDict()
+	root.Set("Kids", treeNodesArray(nodes))
+	return core.MakeIndirectObject(root)
+}
+
+// makeNode returns the intermediate or leaf node `dict` with key range [`low`, `high`].
+func (t *pdfTree) makeNode(dict *core.PdfObjectDictionary, low, high treeKey) treeNode {
+	dict.Set("Limits", core.MakeArray(t.keyObject(low), t.keyObject(high)))
+	return treeNode{obj: core.MakeIndirectObject(dict), low: low, high: high}
+}
+
+// entriesArray returns the Names or Nums array of `entries`.
+func (t *pdfTree) entriesArray(entries []treeEntry) *core.PdfObjectArray {
+	arr := core.MakeArray()
+	for _, entry := range entries {
+		arr.Append(t.keyObject(entry.key), entry.value)
+	}
+	return arr
+}
+
+// treeNodesArray returns the Kids array of `nodes`.
+func treeNodesArray(nodes []treeNode) *core.PdfObjectArray {
+	arr := core.MakeArray()
+	for _, node := range nodes {
+		arr.Append(node.obj)
+	}
+	return arr
+}
+
+// splitTreeNodes splits `n` items into ranges of at most treeNodeSize items, of even sizes.
+func splitTreeNodes(n int) [][2]int {
+	count := (n + treeNodeSize - 1) / treeNodeSize
+	var ranges [][2]int
+	start := 0
+	for i := 0; i < count; i++ {
+		end := start + (n-start)/(count-i)
+		ranges = append(ranges, [2]int{start, end})
+		start = end
+	}
+	return ranges
+}
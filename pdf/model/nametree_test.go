@@ -0,0 +1,156 @@
+package model
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/finalversus/doc/pdf/core"
+)
+
+// makeTreeNode returns a tree node with the entries `entries` (key, value pairs) and the kids
+// `kids`. Limits are set if `low` and `high` are not nil.
+func makeTreeNode(entriesKey core.PdfObjectName, entries []core.PdfObject, kids []core.PdfObject, low, high core.PdfObject) *core.PdfIndirectObject {
+	dict := core.MakeDict()
+	if entries != nil {
+		dict.Set(entriesKey, core.MakeArray(entries...))
+	}
+	if kids != nil {
+		dict.Set("Kids", core.MakeArray(kids...))
+	}
+	if low != nil && high != nil {
+		dict.Set("Limits", core.MakeArray(low, high))
+	}
+	return core.MakeIndirectObject(dict)
+}
+
+func TestNameTreeLoad(t *testing.T) {
+	str := core.MakeString
+	root := makeTreeNode("Names", nil, []core.PdfObject{
+		makeTreeNode("Names", []core.PdfObject{str("apple"), core.MakeInteger(1), str("banana"), core.MakeInteger(2)}, nil, str("apple"), str("banana")),
+		makeTreeNode("Names", nil, []core.PdfObject{
+			makeTreeNode("Names", []core.PdfObject{str("cherry"), core.MakeInteger(3)}, nil, str("cherry"), str("cherry")),
+			// Invalid kid, not traversed by lookups outside of its limits.
+			makeTreeNode("Names", []core.PdfObject{core.MakeInteger(0), core.MakeInteger(0)}, nil, str("x"), str("z")),
+		}, str("cherry"), str("z")),
+	}, nil, nil)
+
+	tree, err := NewPdfNameTreeFromObject(root)
+	require.NoError(t, err)
+	value, err := tree.Get("banana")
+	require.NoError(t, err)
+	require.Equal(t, core.MakeInteger(2), value)
+	value, err = tree.Get("cherry")
+	require.NoError(t, err)
+	require.Equal(t, core.MakeInteger(3), value)
+	value, err = tree.Get("date")
+	require.NoError(t, err)
+	require.Nil(t, value)
+
+	// Loading the whole tree fails on the invalid key.
+	_, err = tree.Keys()
+	require.Error(t, err)
+	_, err = tree.Get("y")
+	require.Error(t, err)
+
+	// Unmodified trees are written as loaded.
+	require.Equal(t, core.PdfObject(root), tree.ToPdfObject())
+
+	_, err = NewPdfNameTreeFromObject(core.MakeArray())
+	require.Error(t, err)
+}
+
+func TestNameTreeModify(t *testing.T) {
+	str := core.MakeString
+	root := makeTreeNode("Names", []core.PdfObject{str("b"), core.MakeInteger(2), str("a"), core.MakeInteger(1), str("b"), core.MakeInteger(3)}, nil, nil, nil)
+	tree, err := NewPdfNameTreeFromObject(root)
+	require.NoError(t, err)
+
+	// Unordered entries are sorted, and only the first of duplicated keys is kept.
+	keys, err := tree.Keys()
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b"}, keys)
+	value, err := tree.Get("b")
+	require.NoError(t, err)
+	require.Equal(t, core.MakeInteger(2), value)
+
+	require.NoError(t, tree.Set("c", core.MakeInteger(4)))
+	require.NoError(t, tree.Set("a", core.MakeInteger(5)))
+	require.Error(t, tree.Set("d", nil))
+	removed, err := tree.Remove("b")
+	require.NoError(t, err)
+	require.True(t, removed)
+	removed, err = tree.Remove("b")
+	require.NoError(t, err)
+	require.False(t, removed)
+
+	var entries []string
+	require.NoError(t, tree.Walk(func(key string, value core.PdfObject) error {
+		entries = append(entries, fmt.Sprintf("%s=%s", key, value))
+		return nil
+	}))
+	require.Equal(t, []string{"a=5", "c=4"}, entries)
+
+	written, err := NewPdfNameTreeFromObject(tree.ToPdfObject())
+	require.NoError(t, err)
+	keys, err = written.Keys()
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "c"}, keys)
+}
+
+func TestNumberTreeBalanced(t *testing.T) {
+	tree := NewPdfNumberTree()
+	const n = 5000
+	for i := n - 1; i >= 0; i-- {
+		require.NoError(t, tree.Set(i*2, core.MakeInteger(int64(i))))
+	}
+	length, err := tree.Len()
+	require.NoError(t, err)
+	require.Equal(t, n, length)
+
+	root, ok := core.GetDict(tree.ToPdfObject())
+	require.True(t, ok)
+	require.Nil(t, root.Get("Limits"))
+	require.Nil(t, root.Get("Nums"))
+
+	// All the leaves are at the same depth, with at most treeNodeSize entries.
+	depths := map[int]bool{}
+	var check func(obj core.PdfObject, depth int)
+	check = func(obj core.PdfObject, depth int) {
+		node, ok := core.GetDict(obj)
+		require.True(t, ok)
+		if nums, ok := core.GetArray(node.Get("Nums")); ok {
+			require.True(t, nums.Len() <= 2*treeNodeSize)
+			depths[depth] = true
+			limits, ok := core.GetArray(node.Get("Limits"))
+			require.True(t, ok)
+			require.Equal(t, nums.Get(0), limits.Get(0))
+			require.Equal(t, nums.Get(nums.Len()-2), limits.Get(1))
+			return
+		}
+		kids, ok := core.GetArray(node.Get("Kids"))
+		require.True(t, ok)
+		require.True(t, kids.Len() <= treeNodeSize)
+		for _, kid := range kids.Elements() {
+			check(kid, depth+1)
+		}
+	}
+	check(root, 0)
+	require.Equal(t, map[int]bool{2: true}, depths)
+
+	// Lookups of the written tree follow the limits.
+	written, err := NewPdfNumberTreeFromObject(tree.ToPdfObject())
+	require.NoError(t, err)
+	value, err := written.Get(4242)
+	require.NoError(t, err)
+	require.Equal(t, core.MakeInteger(2121), value)
+	value, err = written.Get(4243)
+	require.NoError(t, err)
+	require.Nil(t, value)
+	keys, err := written.Keys()
+	require.NoError(t, err)
+	require.Len(t, keys, n)
+	require.Equal(t, 0, keys[0])
+	require.Equal(t, 2*(n-1), keys[n-1])
+}
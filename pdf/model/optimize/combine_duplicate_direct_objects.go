@@ -17,6 +17,8 @@ type CombineDuplicateDirectObjects struct {
 func (dup *CombineDuplicateDirectObjects) Optimize(objects []core.PdfObject) (optimizedObjects []core.PdfObject, err error) {
 	updateObjectNumbers(objects)
 	dictsByHash := make(map[string][]*core.PdfObjectDictionary)
+	// Hashes in order of first occurrence, so that the combined objects are numbered consistently.
+	var hashes []string
 	var processDict func(pDict *core.PdfObjectDictionary)
 
 	processDict = func(pDict *core.PdfObjectDictionary) {
@@ -26,6 +28,9 @@ func (dup *CombineDuplicateDirectObjects) Optimize(objects []core.PdfObject) (op
 				hasher := md5.New()
 				hasher.Write([]byte(dict.WriteString()))
 				hash := string(hasher.Sum(nil))
+				if _, ok := dictsByHash[hash]; !ok {
+					hashes = append(hashes, hash)
+				}
 				dictsByHash[hash] = append(dictsByHash[hash], dict)
 				processDict(dict)
 			}
@@ -45,7 +50,8 @@ func (dup *CombineDuplicateDirectObjects) Optimize(objects []core.PdfObject) (op
 	indirects := make([]core.PdfObject, 0, len(dictsByHash))
 	replaceTable := make(map[core.PdfObject]core.PdfObject)
 
-	for _, dicts := range dictsByHash {
+	for _, hash := range hashes {
+		dicts := dictsByHash[hash]
 		if len(dicts) < 2 {
 			continue
 		}
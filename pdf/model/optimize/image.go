@@ -47,7 +47,18 @@ func findImages(objects []core.PdfObject) []*imageInfo {
 			continue
 		}
 		img := &imageInfo{BitsPerComponent: 8, Stream: stream}
-		if img.ColorSpace, err = model.DetermineColorspaceNameFromPdfObject(stream.PdfObjectDictionary.Get("ColorSpace")); err != nil {
+		csObj := stream.PdfObjectDictionary.Get("ColorSpace")
+		jpxEnc := jpxEncoder(stream)
+		if jpxEnc != nil {
+			if jpxEnc.SMaskInData > 0 {
+				common.Log.Debug("Optimization is not supported for JPX images with SMaskInData")
+				continue
+			}
+			if csObj == nil {
+				csObj = jpxEnc.ColorSpace
+			}
+		}
+		if img.ColorSpace, err = model.DetermineColorspaceNameFromPdfObject(csObj); err != nil {
 			common.Log.Error("Error determine color space %s", err)
 			continue
 		}
@@ -60,6 +71,10 @@ func findImages(objects []core.PdfObject) []*imageInfo {
 		if val, ok := core.GetIntVal(stream.PdfObjectDictionary.Get("Height")); ok {
 			img.Height = val
 		}
+		if jpxEnc != nil {
+			// The sample precision of JPX images is given by the JPEG 2000 data.
+			img.BitsPerComponent = jpxEnc.BitsPerComponent
+		}
 
 		switch img.ColorSpace {
 		case "DeviceRGB":
@@ -75,6 +90,21 @@ func findImages(objects []core.PdfObject) []*imageInfo {
 	return images
 }
 
+// jpxEncoder returns the JPX encoder of an image stream or nil if the stream is not JPX encoded.
+func jpxEncoder(stream *core.PdfObjectStream) *core.JPXEncoder {
+	filter, ok := core.GetName(stream.PdfObjectDictionary.Get("Filter"))
+	if !ok || *filter != core.StreamEncodingFilterNameJPX {
+		return nil
+	}
+	encoder, err := core.NewEncoderFromStream(stream)
+	if err != nil {
+		common.Log.Debug("Error get encoder for the JPX image stream: %v", err)
+		return nil
+	}
+	jpxEnc, _ := encoder.(*core.JPXEncoder)
+	return jpxEnc
+}
+
 // Optimize optimizes PDF objects to decrease PDF size.
 func (i *Image) Optimize(objects []core.PdfObject) (optimizedObjects []core.PdfObject, err error) {
 	if i.ImageQuality <= 0 {
@@ -125,6 +155,11 @@ func (i *Image) Optimize(objects []core.PdfObject) (optimizedObjects []core.PdfO
 		newStream.PdfObjectDictionary.Set(core.PdfObjectName("Filter"), &fn)
 		ln := core.PdfObjectInteger(int64(len(streamData)))
 		newStream.PdfObjectDictionary.Set(core.PdfObjectName("Length"), &ln)
+		if _, isJPX := streamEncoder.(*core.JPXEncoder); isJPX {
+			// JPX images may omit entries that are required for DCT encoded images.
+			newStream.PdfObjectDictionary.Set("ColorSpace", core.MakeName(string(img.ColorSpace)))
+			newStream.PdfObjectDictionary.Set("BitsPerComponent", core.MakeInteger(8))
+		}
 		replaceTable[stream] = newStream
 		images[index].Stream = newStream
 	}
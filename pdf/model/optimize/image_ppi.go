@@ -26,6 +26,19 @@ func scaleImage(stream *core.PdfObjectStream, scale float64) error {
 	if err != nil {
 		return err
 	}
+	width, height := float64(*xImg.Width), float64(*xImg.Height)
+
+	jpxEnc, isJPX := xImg.Filter.(*core.JPXEncoder)
+	if isJPX {
+		// Decode JPX images at the highest reduced resolution that is not smaller than the
+		// target size, which is much cheaper than decoding them at full resolution.
+		reduce := 0
+		for reduce < jpxEnc.Levels && scale*float64(int(1)<<uint(reduce+1)) <= 1 {
+			reduce++
+		}
+		jpxEnc.ReduceResolution = reduce
+	}
+
 	i, err := xImg.ToImage()
 	if err != nil {
 		return err
@@ -35,8 +48,8 @@ func scaleImage(stream *core.PdfObjectStream, scale float64) error {
 		return err
 	}
 
-	newW := int(math.RoundToEven(float64(i.Width) * scale))
-	newH := int(math.RoundToEven(float64(i.Height) * scale))
+	newW := int(math.RoundToEven(width * scale))
+	newH := int(math.RoundToEven(height * scale))
 	rect := image.Rect(0, 0, newW, newH)
 
 	var newImage draw.Image
@@ -58,6 +71,14 @@ func scaleImage(stream *core.PdfObjectStream, scale float64) error {
 		return err
 	}
 
+	if isJPX {
+		// JPX encoding is not supported, store the scaled image with Flate encoding.
+		xImg.Filter = core.NewFlateEncoder()
+	}
+	xImg.Width = &i.Width
+	xImg.Height = &i.Height
+	xImg.BitsPerComponent = &i.BitsPerComponent
+
 	// Update image encoder
 	encoderParams := core.MakeDict()
 	encoderParams.Set("ColorComponents", core.MakeInteger(int64(i.ColorComponents)))
@@ -154,7 +154,8 @@ func (r *PdfReader) newPdfOutlineItemFromIndirectObject(container *core.PdfIndir
 
 	// Other keys.
 	if obj := dict.Get("Dest"); obj != nil {
-		item.Dest = core.ResolveReference(obj)
+		// Named destinations are replaced by their explicit destination.
+		item.Dest = r.resolveNamedOutlineDest(core.ResolveReference(obj))
 		if !r.isLazy {
 			err := r.traverseObjectData(item.Dest)
 			if err != nil {
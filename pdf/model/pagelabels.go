@@ -0,0 +1,250 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/finalversus/doc/common"
+	"github.com/finalversus/doc/pdf/core"
+)
+
+// PageLabelStyle is the numbering style of a page label range.
+type PageLabelStyle string
+
+// Page label numbering styles.
+const (
+	PageLabelStyleNone         PageLabelStyle = ""  // labels consist of the prefix only
+	PageLabelStyleDecimal      PageLabelStyle = "D" // 1, 2, 3, ...
+	PageLabelStyleUpperRoman   PageLabelStyle = "R" // I, II, III, ...
+	PageLabelStyleLowerRoman   PageLabelStyle = "r" // i, ii, iii, ...
+	PageLabelStyleUpperLetters PageLabelStyle = "A" // A to Z, then AA to ZZ, ...
+	PageLabelStyleLowerLetters PageLabelStyle = "a" // a to z, then aa to zz, ...
+)
+
+// PdfPageLabel represents a page label dictionary (section 12.4.2 of the PDF 1.7 standard), which
+// defines the labels of a range of pages.
+type PdfPageLabel struct {
+	Style  PageLabelStyle
+	Prefix string
+
+	// Start is the value of the numeric portion of the first label of the range (1 if zero).
+	Start int
+}
+
+// PdfPageLabelRange is a range of pages labeled with Label, starting at the page of index
+// PageIndex (zero-based) and ending before the next range.
+type PdfPageLabelRange struct {
+	PageIndex int
+	Label     PdfPageLabel
+}
+
+// NewPdfPageLabelFromObject loads a page label dictionary from `obj`.
+func NewPdfPageLabelFromObject(obj core.PdfObject) (*PdfPageLabel, error) {
+	dict, ok := core.GetDict(obj)
+	if !ok {
+		return nil, fmt.Errorf("invalid page label type: %T", obj)
+	}
+
+	label := &PdfPageLabel{}
+	if obj := dict.Get("S"); obj != nil {
+		style, ok := core.GetName(obj)
+		if !ok {
+			return nil, fmt.Errorf("invalid page label style type: %T", obj)
+		}
+		label.Style = PageLabelStyle(*style)
+		switch label.Style {
+		case PageLabelStyleDecimal, PageLabelStyleUpperRoman, PageLabelStyleLowerRoman,
+			PageLabelStyleUpperLetters, PageLabelStyleLowerLetters:
+		default:
+			common.Log.Debug("Unsupported page label style %s - using decimal", label.Style)
+			label.Style = PageLabelStyleDecimal
+		}
+	}
+	if obj := dict.Get("P"); obj != nil {
+		prefix, ok := core.GetString(obj)
+		if !ok {
+			return nil, fmt.Errorf("invalid page label prefix type: %T", obj)
+		}
+		label.Prefix = prefix.Decoded()
+	}
+	if obj := dict.Get("St"); obj != nil {
+		start, ok := core.GetIntVal(obj)
+		if !ok || start < 1 {
+			return nil, fmt.Errorf("invalid page label start: %v", obj)
+		}
+		label.Start = start
+	}
+	return label, nil
+}
+
+// ToPdfObject returns the page label dictionary.
+func (l *PdfPageLabel) ToPdfObject() core.PdfObject {
+	dict := core.MakeDict()
+	if l.Style != PageLabelStyleNone {
+		dict.Set("S", core.MakeName(string(l.Style)))
+	}
+	if l.Prefix != "" {
+		dict.Set("P", NewPdfInfoText(l.Prefix))
+	}
+	if l.Start > 1 {
+		dict.Set("St", core.MakeInteger(int64(l.Start)))
+	}
+	return dict
+}
+
+// Format returns the label of the page at offset `offset` (zero-based) in the range.
+func (l *PdfPageLabel) Format(offset int) string {
+	start := l.Start
+	if start < 1 {
+		start = 1
+	}
+	n := start + offset
+
+	var number string
+	switch l.Style {
+	case PageLabelStyleDecimal:
+		number = strconv.Itoa(n)
+	case PageLabelStyleUpperRoman:
+		number = formatRoman(n)
+	case PageLabelStyleLowerRoman:
+		number = strings.ToLower(formatRoman(n))
+	case PageLabelStyleUpperLetters:
+		number = formatLetters(n)
+	case PageLabelStyleLowerLetters:
+		number = strings.ToLower(formatLetters(n))
+	}
+	return l.Prefix + number
+}
+
+// formatRoman returns the uppercase roman numeral of `n`.
+func formatRoman(n int) string {
+	numerals := []struct {
+		value  int
+		symbol string
+	}{
+		{1000, "M"}, {900, "CM"}, {500, "D"}, {400, "CD"}, {100, "C"}, {90, "XC"},
+		{50, "L"}, {40, "XL"}, {10, "X"}, {9, "IX"}, {5, "V"}, {4, "IV"}, {1, "I"},
+	}
+	var sb strings.Builder
+	for _, numeral := range numerals {
+		for n >= numeral.value {
+			sb.WriteString(numeral.symbol)
+			n -= numeral.value
+		}
+	}
+	return sb.String()
+}
+
+// formatLetters returns the uppercase letters label of `n`: A to Z for 1 to 26, AA to ZZ for 27
+// to 52, and so on.
+func formatLetters(n int) string {
+	letter := string(rune('A' + (n-1)%26))
+	return strings.Repeat(letter, (n-1)/26+1)
+}
+
+// FormatPageLabels returns the labels of `numPages` pages labeled with the ranges `ranges`.
+// Pages not covered by a range are labeled with their decimal page number.
+func FormatPageLabels(ranges []PdfPageLabelRange, numPages int) []string {
+	sorted := make([]PdfPageLabelRange, len(ranges))
+	copy(sorted, ranges)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].PageIndex < sorted[j].PageIndex })
+
+	labels := make([]string, numPages)
+	for i := range labels {
+		labels[i] = strconv.Itoa(i + 1)
+	}
+	for i, r := range sorted {
+		end := numPages
+		if i+1 < len(sorted) && sorted[i+1].PageIndex < end {
+			end = sorted[i+1].PageIndex
+		}
+		for idx := r.PageIndex; idx < end; idx++ {
+			if idx >= 0 {
+				labels[idx] = r.Label.Format(idx - r.PageIndex)
+			}
+		}
+	}
+	return labels
+}
+
+// GetPageLabelRanges returns the page label ranges of the document (catalog PageLabels number
+// tree), ordered by page index, or nil if the document has none.
+func (r *PdfReader) GetPageLabelRanges() ([]PdfPageLabelRange, error) {
+	obj := r.catalog.Get("PageLabels")
+	if obj == nil {
+		return nil, nil
+	}
+
+	tree, err := NewPdfNumberTreeFromObject(obj)
+	if err != nil {
+		return nil, err
+	}
+	var ranges []PdfPageLabelRange
+	err = tree.Walk(func(key int, value core.PdfObject) error {
+		label, err := NewPdfPageLabelFromObject(value)
+		if err != nil {
+			return err
+		}
+		ranges = append(ranges, PdfPageLabelRange{PageIndex: key, Label: *label})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ranges, nil
+}
+
+// GetPageLabels returns the labels of the pages of the document, by page index. Documents
+// without page labels have decimal labels ("1", "2", ...).
+func (r *PdfReader) GetPageLabels() ([]string, error) {
+	ranges, err := r.GetPageLabelRanges()
+	if err != nil {
+		return nil, err
+	}
+	numPages, err := r.GetNumPages()
+	if err != nil {
+		return nil, err
+	}
+	return FormatPageLabels(ranges, numPages), nil
+}
+
+// pageLabelsToPdfObject returns the page labels number tree of the ranges `ranges`.
+func pageLabelsToPdfObject(ranges []PdfPageLabelRange) (core.PdfObject, error) {
+	tree := NewPdfNumberTree()
+	for _, r := range ranges {
+		if value, _ := tree.Get(r.PageIndex); value != nil {
+			return nil, fmt.Errorf("duplicate page label range at page index %d", r.PageIndex)
+		}
+		if err := tree.Set(r.PageIndex, r.Label.ToPdfObject()); err != nil {
+			return nil, err
+		}
+	}
+	if value, _ := tree.Get(0); value == nil {
+		return nil, errors.New("page labels must have a range starting at the first page")
+	}
+	return tree.ToPdfObject(), nil
+}
+
+// SetPageLabels sets the page label ranges of the output document. The first range must start at
+// the first page (index 0).
+func (w *PdfWriter) SetPageLabels(ranges []PdfPageLabelRange) error {
+	obj, err := pageLabelsToPdfObject(ranges)
+	if err != nil {
+		return err
+	}
+	w.catalog.Set("PageLabels", obj)
+	return w.addObjects(obj)
+}
+
+// SetPageLabels sets the page label ranges of the updated document, replacing the existing ones.
+// The first range must start at the first page (index 0).
+func (a *PdfAppender) SetPageLabels(ranges []PdfPageLabelRange) error {
+	if _, err := pageLabelsToPdfObject(ranges); err != nil {
+		return err
+	}
+	a.pageLabels = ranges
+	return nil
+}
@@ -0,0 +1,109 @@
+package model
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/finalversus/doc/pdf/core"
+)
+
+func TestPageLabelFormat(t *testing.T) {
+	testcases := []struct {
+		label    PdfPageLabel
+		offset   int
+		expected string
+	}{
+		{PdfPageLabel{Style: PageLabelStyleDecimal}, 0, "1"},
+		{PdfPageLabel{Style: PageLabelStyleDecimal, Prefix: "A-", Start: 8}, 2, "A-10"},
+		{PdfPageLabel{Style: PageLabelStyleUpperRoman}, 3, "IV"},
+		{PdfPageLabel{Style: PageLabelStyleLowerRoman, Start: 1990}, 0, "mcmxc"},
+		{PdfPageLabel{Style: PageLabelStyleUpperLetters}, 25, "Z"},
+		{PdfPageLabel{Style: PageLabelStyleUpperLetters}, 26, "AA"},
+		{PdfPageLabel{Style: PageLabelStyleLowerLetters}, 54, "ccc"},
+		{PdfPageLabel{Prefix: "Cover"}, 1, "Cover"},
+	}
+	for _, tc := range testcases {
+		require.Equal(t, tc.expected, tc.label.Format(tc.offset), "%+v", tc.label)
+	}
+
+	ranges := []PdfPageLabelRange{
+		{PageIndex: 3, Label: PdfPageLabel{Style: PageLabelStyleDecimal}},
+		{PageIndex: 0, Label: PdfPageLabel{Style: PageLabelStyleLowerRoman}},
+	}
+	require.Equal(t, []string{"i", "ii", "iii", "1", "2"}, FormatPageLabels(ranges, 5))
+	require.Equal(t, []string{"1", "2"}, FormatPageLabels(nil, 2))
+}
+
+func TestPageLabelsReadWrite(t *testing.T) {
+	ranges := []PdfPageLabelRange{
+		{PageIndex: 0, Label: PdfPageLabel{Prefix: "Cover"}},
+		{PageIndex: 1, Label: PdfPageLabel{Style: PageLabelStyleLowerRoman}},
+		{PageIndex: 3, Label: PdfPageLabel{Style: PageLabelStyleDecimal, Prefix: "P-", Start: 5}},
+	}
+
+	w := NewPdfWriter()
+	require.Error(t, w.SetPageLabels(ranges[1:]))
+	require.NoError(t, w.SetPageLabels(ranges))
+	for i := 0; i < 4; i++ {
+		page := NewPdfPage()
+		page.MediaBox = &PdfRectangle{Urx: 100, Ury: 100}
+		require.NoError(t, w.AddPage(page))
+	}
+	var buf bytes.Buffer
+	require.NoError(t, w.Write(&buf))
+
+	reader, err := NewPdfReader(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	readRanges, err := reader.GetPageLabelRanges()
+	require.NoError(t, err)
+	require.Equal(t, ranges, readRanges)
+	labels, err := reader.GetPageLabels()
+	require.NoError(t, err)
+	require.Equal(t, []string{"Cover", "i", "ii", "P-5"}, labels)
+
+	// Replace the labels with an incremental update.
+	appender, err := NewPdfAppender(reader)
+	require.NoError(t, err)
+	require.NoError(t, appender.SetPageLabels([]PdfPageLabelRange{
+		{PageIndex: 0, Label: PdfPageLabel{Style: PageLabelStyleUpperLetters}},
+	}))
+	var out bytes.Buffer
+	require.NoError(t, appender.Write(&out))
+	reader, err = NewPdfReader(bytes.NewReader(out.Bytes()))
+	require.NoError(t, err)
+	labels, err = reader.GetPageLabels()
+	require.NoError(t, err)
+	require.Equal(t, []string{"A", "B", "C", "D"}, labels)
+
+	// Documents without page labels.
+	f, err := os.Open("testdata/minimal.pdf")
+	require.NoError(t, err)
+	defer f.Close()
+	reader, err = NewPdfReader(f)
+	require.NoError(t, err)
+	readRanges, err = reader.GetPageLabelRanges()
+	require.NoError(t, err)
+	require.Nil(t, readRanges)
+	labels, err = reader.GetPageLabels()
+	require.NoError(t, err)
+	require.Equal(t, []string{"1"}, labels)
+}
+
+func TestPageLabelFromObject(t *testing.T) {
+	dict := core.MakeDict()
+	dict.Set("S", core.MakeName("r"))
+	dict.Set("P", core.MakeString("Part "))
+	dict.Set("St", core.MakeInteger(4))
+	label, err := NewPdfPageLabelFromObject(dict)
+	require.NoError(t, err)
+	require.Equal(t, PdfPageLabel{Style: PageLabelStyleLowerRoman, Prefix: "Part ", Start: 4}, *label)
+
+	dict.Set("St", core.MakeInteger(0))
+	_, err = NewPdfPageLabelFromObject(dict)
+	require.Error(t, err)
+	_, err = NewPdfPageLabelFromObject(core.MakeName("D"))
+	require.Error(t, err)
+}
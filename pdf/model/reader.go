@@ -3,6 +3,8 @@
 package model
 
 import (
+	"crypto"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"io"
@@ -35,6 +37,48 @@ type PdfReader struct {
 	// For tracking traversal (cache).
 	traversed map[core.PdfObject]struct{}
 	rs        io.ReadSeeker
+
+	// Linearized files in lazy-loading mode: loading of the page tree and outlines is deferred
+	// until needed, pages are located with the linearization parameters and hint tables.
+	linearization   *core.Linearization
+	pageTreeLoaded  bool
+	outlinesLoaded  bool
+	linearizedPages map[int64]*PdfPage
+}
+
+// ReaderOpts defines options for creating PdfReader instances.
+type ReaderOpts struct {
+	// LazyLoad sets the reader to lazy-loading mode, in which objects are only loaded from the
+	// underlying file when needed. See NewPdfReaderLazy.
+	LazyLoad bool
+
+	// MaxCachedObjects limits the number of resolved objects (and decoded object streams) kept in
+	// memory by the parser. When the limit is reached, the least recently used objects are evicted
+	// and re-read from the file on demand. A value of 0 means no limit.
+	// Note that evicted objects are loaded as new instances when accessed again. The limit is
+	// therefore mostly useful in lazy-loading mode where the whole document is not loaded on
+	// reader creation.
+	MaxCachedObjects int
+
+	// Strict makes the reader fail on the first deviation from the PDF specification instead of
+	// attempting a repair. The returned error is a *core.DiagnosticError describing the deviation.
+	// When not strict, repairs are recorded and can be retrieved with PdfReader.Diagnostics.
+	Strict bool
+
+	// Limits sets limits on the resources used when parsing the file: decoded stream size, object
+	// nesting depth, number of objects and length of the cross-reference chain. Zero values mean no
+	// limit. Exceeding a limit results in a *core.LimitError, which can be checked with
+	// core.IsLimitExceeded.
+	Limits core.Limits
+}
+
+// NewReaderOpts generates a default `ReaderOpts` instance.
+func NewReaderOpts() *ReaderOpts {
+	return &ReaderOpts{
+		LazyLoad:         false,
+		MaxCachedObjects: 0,
+		Strict:           false,
+	}
 }
 
 // NewPdfReader returns a new PdfReader for an input io.ReadSeeker interface. Can be used to read PDF from
@@ -43,15 +87,58 @@ type PdfReader struct {
 // Alternatively a lazy-loading reader can be created with NewPdfReaderLazy which loads only references,
 // and references are loaded from disk into memory on an as-needed basis.
 func NewPdfReader(rs io.ReadSeeker) (*PdfReader, error) {
+	return NewPdfReaderWithOpts(rs, nil)
+}
+
+// NewPdfReaderLazy creates a new PdfReader for `rs` in lazy-loading mode. The difference
+// from NewPdfReader is that in lazy-loading mode, objects are only loaded into memory when needed
+// rather than entire structure being loaded into memory on reader creation.
+// Note that it may make sense to use the lazy-load reader when processing only parts of files,
+// rather than loading entire file into memory. Example: splitting a few pages from a large PDF file.
+//
+// For linearized files, the lazy-loading reader only loads the first-page cross-reference section
+// on creation. The first page is located with the linearization parameter dictionary and the other
+// pages with the hint tables, so that accessing the first page only reads the first-page section
+// of the file. The main cross-reference section, page tree and outlines are loaded when needed.
+// In that case, PageList is only populated once the page tree has been loaded.
+func NewPdfReaderLazy(rs io.ReadSeeker) (*PdfReader, error) {
+	return NewPdfReaderWithOpts(rs, &ReaderOpts{LazyLoad: true})
+}
+
+// NewPdfReaderAt creates a new PdfReader for the `size` bytes of `r`, which can fetch byte ranges
+// on demand (e.g. with HTTP range requests). If `opts` is nil, a lazy-loading reader is created
+// (see NewPdfReaderLazy), so that only the parts of the file that are accessed are read.
+func NewPdfReaderAt(r io.ReaderAt, size int64, opts *ReaderOpts) (*PdfReader, error) {
+	if opts == nil {
+		opts = &ReaderOpts{LazyLoad: true}
+	}
+	return NewPdfReaderWithOpts(io.NewSectionReader(r, 0, size), opts)
+}
+
+// NewPdfReaderWithOpts creates a new PdfReader for `rs` configured by `opts`. If `opts` is nil,
+// the default options are used (see NewReaderOpts).
+// Example: a lazy-loading reader with a bounded object cache for processing very large documents:
+//   reader, err := NewPdfReaderWithOpts(f, &ReaderOpts{LazyLoad: true, MaxCachedObjects: 1000})
+func NewPdfReaderWithOpts(rs io.ReadSeeker, opts *ReaderOpts) (*PdfReader, error) {
+	if opts == nil {
+		opts = NewReaderOpts()
+	}
+
 	pdfReader := &PdfReader{
 		rs:           rs,
 		traversed:    map[core.PdfObject]struct{}{},
-		modelManager: newModelManager(),
-		isLazy:       false,
+		modelManager:    newModelManager(),
+		isLazy:          opts.LazyLoad,
+		linearizedPages: map[int64]*PdfPage{},
 	}
 
 	// Create the parser, loads the cross reference table and trailer.
-	parser, err := core.NewParser(rs)
+	parser, err := core.NewParserWithOpts(rs, &core.ParserOpts{
+		MaxCachedObjects: opts.MaxCachedObjects,
+		Strict:           opts.Strict,
+		UseLinearization: opts.LazyLoad,
+		Limits:           opts.Limits,
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -73,40 +160,58 @@ func NewPdfReader(rs io.ReadSeeker) (*PdfReader, error) {
 	return pdfReader, nil
 }
 
-// NewPdfReaderLazy creates a new PdfReader for `rs` in lazy-loading mode. The difference
-// from NewPdfReader is that in lazy-loading mode, objects are only loaded into memory when needed
-// rather than entire structure being loaded into memory on reader creation.
-// Note that it may make sense to use the lazy-load reader when processing only parts of files,
-// rather than loading entire file into memory. Example: splitting a few pages from a large PDF file.
-func NewPdfReaderLazy(rs io.ReadSeeker) (*PdfReader, error) {
-	pdfReader := &PdfReader{
-		rs:           rs,
-		traversed:    map[core.PdfObject]struct{}{},
-		modelManager: newModelManager(),
-		isLazy:       true,
+// Clone returns a new reader of the same document, which can be used concurrently with `r` and with
+// other clones. A PdfReader is not safe for concurrent use, so each goroutine should work with its
+// own clone. The clone reuses the cross-reference table and decryption state of `r`, and loads
+// objects lazily into its own caches (see NewPdfReaderLazy).
+//
+// The clone reads the file independently of `r` with io.ReaderAt, so the io.ReadSeeker `r` was
+// created with must also implement io.ReaderAt (e.g. *os.File or *bytes.Reader). Otherwise,
+// core.ErrNotSupported is returned.
+// Clone must not be called concurrently with other methods of `r`, and objects loaded by one reader
+// (pages, fonts, etc.) must not be shared with other goroutines.
+func (r *PdfReader) Clone() (*PdfReader, error) {
+	ra, ok := r.rs.(io.ReaderAt)
+	if !ok {
+		return nil, core.ErrNotSupported
 	}
-
-	// Create the parser, loads the cross reference table and trailer.
-	parser, err := core.NewParser(rs)
+	offset, err := r.rs.Seek(0, io.SeekCurrent)
 	if err != nil {
 		return nil, err
 	}
-	pdfReader.parser = parser
-
-	isEncrypted, err := pdfReader.IsEncrypted()
+	size, err := r.rs.Seek(0, io.SeekEnd)
 	if err != nil {
 		return nil, err
 	}
+	if _, err := r.rs.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
 
-	// Load pdf doc structure if not encrypted.
-	if !isEncrypted {
-		err = pdfReader.loadStructure()
-		if err != nil {
-			return nil, err
-		}
+	parser, err := r.parser.Clone()
+	if err != nil {
+		return nil, err
 	}
 
-	return pdfReader, nil
+	clone := &PdfReader{
+		parser:          parser,
+		rs:              io.NewSectionReader(ra, 0, size),
+		traversed:       map[core.PdfObject]struct{}{},
+		modelManager:    newModelManager(),
+		isLazy:          true,
+		linearizedPages: map[int64]*PdfPage{},
+	}
+	isEncrypted, err := clone.IsEncrypted()
+	if err != nil {
+		return nil, err
+	}
+	// Encrypted documents can only be loaded once decrypted.
+	if isEncrypted && !parser.IsAuthenticated() {
+		return clone, nil
+	}
+	if err := clone.loadStructure(); err != nil {
+		return nil, err
+	}
+	return clone, nil
 }
 
 // PdfVersion returns version of the PDF file.
@@ -114,6 +219,13 @@ func (r *PdfReader) PdfVersion() core.Version {
 	return r.parser.PdfVersion()
 }
 
+// Diagnostics returns the deviations from the PDF specification encountered and repaired while
+// reading the document so far, in the order they were found. In lazy-loading mode, objects are
+// parsed on demand and further diagnostics may be recorded as the document is accessed.
+func (r *PdfReader) Diagnostics() []core.Diagnostic {
+	return r.parser.Diagnostics()
+}
+
 // IsEncrypted returns true if the PDF file is encrypted.
 func (r *PdfReader) IsEncrypted() (bool, error) {
 	return r.parser.IsEncrypted()
@@ -146,6 +258,27 @@ func (r *PdfReader) Decrypt(password []byte) (bool, error) {
 	return true, nil
 }
 
+// DecryptWithCertificate decrypts a PDF file encrypted with the public-key security handler
+// (Adobe.PubSec) using the recipient certificate `cert` and its private key `key`.
+// Returns true if successful, false if `cert` is not one of the recipients of the document.
+func (r *PdfReader) DecryptWithCertificate(cert *x509.Certificate, key crypto.PrivateKey) (bool, error) {
+	success, err := r.parser.DecryptWithCertificate(cert, key)
+	if err != nil {
+		return false, err
+	}
+	if !success {
+		return false, nil
+	}
+
+	err = r.loadStructure()
+	if err != nil {
+		common.Log.Debug("ERROR: Fail to load structure (%s)", err)
+		return false, err
+	}
+
+	return true, nil
+}
+
 // CheckAccessRights checks access rights and permissions for a specified password.  If either user/owner
 // password is specified,  full rights are granted, otherwise the access rights are specified by the
 // Permissions flag.
@@ -190,6 +323,37 @@ func (r *PdfReader) loadStructure() error {
 	}
 	common.Log.Trace("Catalog: %s", catalog)
 
+	r.root = root
+	r.catalog = catalog
+
+	if lin := r.parser.GetLinearization(); lin != nil && r.isLazy {
+		// Defer loading the page tree and outlines, which are generally not in the first-page section.
+		common.Log.Trace("Linearized file: deferring page tree")
+		r.linearization = lin
+		r.pageCount = lin.NumPages
+	} else {
+		if err := r.loadPageTree(); err != nil {
+			return err
+		}
+		if err := r.loadOutlinesTree(); err != nil {
+			return err
+		}
+	}
+
+	// Load interactive forms and fields.
+	r.AcroForm, err = r.loadForms()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// loadPageTree loads the page tree and builds the page list.
+func (r *PdfReader) loadPageTree() error {
+	r.pageTreeLoaded = true
+	catalog := r.catalog
+
 	// Pages.
 	pagesRef, ok := catalog.Get("Pages").(*core.PdfObjectReference)
 	if !ok {
@@ -221,11 +385,10 @@ func (r *PdfReader) loadStructure() error {
 		pages.Set("Type", core.MakeName("Pages"))
 	}
 
-	r.root = root
-	r.catalog = catalog
 	r.pages = pages
 	r.pageCount = int(*pageCount)
 	r.pageList = []*core.PdfIndirectObject{}
+	r.PageList = nil
 
 	traversedPageNodes := map[core.PdfObject]struct{}{}
 	err = r.buildPageList(ppages, nil, traversedPageNodes)
@@ -237,20 +400,132 @@ func (r *PdfReader) loadStructure() error {
 	common.Log.Trace("Pages")
 	common.Log.Trace("%d: %s", len(r.pageList), r.pageList)
 
-	// Outlines.
+	return nil
+}
+
+// loadOutlinesTree loads the outline tree.
+func (r *PdfReader) loadOutlinesTree() error {
+	r.outlinesLoaded = true
+	var err error
 	r.outlineTree, err = r.loadOutlines()
 	if err != nil {
 		common.Log.Debug("ERROR: Failed to build outline tree (%s)", err)
 		return err
 	}
+	return nil
+}
 
-	// Load interactive forms and fields.
-	r.AcroForm, err = r.loadForms()
+// ensurePageTree loads the page tree if its loading has been deferred.
+func (r *PdfReader) ensurePageTree() error {
+	if r.pageTreeLoaded {
+		return nil
+	}
+	if r.parser.GetCrypter() != nil && !r.parser.IsAuthenticated() {
+		return fmt.Errorf("file need to be decrypted first")
+	}
+	return r.loadPageTree()
+}
+
+// ensureOutlines loads the outline tree if its loading has been deferred.
+func (r *PdfReader) ensureOutlines() error {
+	if r.outlinesLoaded {
+		return nil
+	}
+	if r.parser.GetCrypter() != nil && !r.parser.IsAuthenticated() {
+		return fmt.Errorf("file need to be decrypted first")
+	}
+	return r.loadOutlinesTree()
+}
+
+// getLinearizedPage returns the page `pageNumber` of a linearized file without loading the page
+// tree. The first page is the object specified by the linearization parameter dictionary. The
+// objects of the other pages are numbered consecutively from 1, in page order, each page having
+// the number of objects given by the page offset hint table, and the page object is the only page
+// among the objects of its page. An error is returned if the hint tables do not match the objects,
+// in which case the page tree is used instead (see GetPage).
+func (r *PdfReader) getLinearizedPage(pageNumber int) (*PdfPage, error) {
+	if pageNumber == 1 {
+		return r.loadLinearizedPage(pageNumber, int64(r.linearization.FirstPageObject))
+	}
+
+	pageHints, sharedHints, err := r.parser.GetHintTables()
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if pageNumber > len(pageHints.Pages) {
+		return nil, errors.New("invalid page number (page count too short)")
 	}
 
-	return nil
+	// The objects of the remaining pages precede the shared objects section and the first page.
+	start := int64(1)
+	total := int64(1)
+	for i, hint := range pageHints.Pages[1:] {
+		if hint.NumObjects <= 0 {
+			return nil, fmt.Errorf("page %d without objects in the hint table", i+2)
+		}
+		if i+2 < pageNumber {
+			start += int64(hint.NumObjects)
+		}
+		total += int64(hint.NumObjects)
+	}
+	if total > int64(r.linearization.FirstPageObject) ||
+		len(sharedHints.Groups) > sharedHints.NumFirstPage && int64(sharedHints.FirstObjectNumber) != total {
+		return nil, errors.New("page offset hint table does not match the object numbers")
+	}
+
+	var pageNum int64
+	for objNum := start; objNum < start+int64(pageHints.Pages[pageNumber-1].NumObjects); objNum++ {
+		obj, err := r.parser.LookupByNumber(int(objNum))
+		if err != nil {
+			return nil, err
+		}
+		dict, ok := core.GetDict(obj)
+		if !ok {
+			continue
+		}
+		if name, _ := core.GetNameVal(dict.Get("Type")); name != "Page" {
+			continue
+		}
+		if pageNum != 0 {
+			return nil, fmt.Errorf("page %d objects contain several pages (%d, %d)", pageNumber, pageNum, objNum)
+		}
+		pageNum = objNum
+	}
+	if pageNum == 0 {
+		return nil, fmt.Errorf("page %d objects %d-%d do not contain a page", pageNumber, start,
+			start+int64(pageHints.Pages[pageNumber-1].NumObjects)-1)
+	}
+	return r.loadLinearizedPage(pageNumber, pageNum)
+}
+
+// loadLinearizedPage loads the page `pageNumber` of a linearized file from object `objNum`.
+func (r *PdfReader) loadLinearizedPage(pageNumber int, objNum int64) (*PdfPage, error) {
+	if page, ok := r.linearizedPages[objNum]; ok {
+		return page, nil
+	}
+
+	obj, err := r.parser.LookupByNumber(int(objNum))
+	if err != nil {
+		return nil, err
+	}
+	ind, ok := obj.(*core.PdfIndirectObject)
+	if !ok {
+		return nil, fmt.Errorf("page %d object not an indirect object", pageNumber)
+	}
+	dict, ok := ind.PdfObject.(*core.PdfObjectDictionary)
+	if !ok {
+		return nil, fmt.Errorf("page %d object not a dictionary", pageNumber)
+	}
+	if name, _ := core.GetNameVal(dict.Get("Type")); name != "Page" {
+		return nil, fmt.Errorf("page %d object %d not a page (%s)", pageNumber, objNum, name)
+	}
+	page, err := r.newPdfPageFromDict(dict)
+	if err != nil {
+		return nil, err
+	}
+	page.setContainer(ind)
+	r.linearizedPages[objNum] = page
+	return page, nil
 }
 
 func (r *PdfReader) loadOutlines() (*PdfOutlineTreeNode, error) {
@@ -381,11 +656,17 @@ func (r *PdfReader) buildOutlineTree(obj core.PdfObject, parent *PdfOutlineTreeN
 
 // GetOutlineTree returns the outline tree.
 func (r *PdfReader) GetOutlineTree() *PdfOutlineTreeNode {
+	if err := r.ensureOutlines(); err != nil {
+		common.Log.Debug("ERROR: Failed to load outlines: %v", err)
+	}
 	return r.outlineTree
 }
 
 // GetOutlinesFlattened returns a flattened list of tree nodes and titles.
 func (r *PdfReader) GetOutlinesFlattened() ([]*PdfOutlineTreeNode, []string, error) {
+	if err := r.ensureOutlines(); err != nil {
+		return nil, nil, err
+	}
 	var outlineNodeList []*PdfOutlineTreeNode
 	var flattenedTitleList []string
 
@@ -497,9 +778,13 @@ func (r *PdfReader) buildPageList(node *core.PdfIndirectObject, parent *core.Pdf
 	}
 	common.Log.Trace("buildPageList node type: %s (%+v)", *objType, node)
 	if *objType == "Page" {
-		p, err := r.newPdfPageFromDict(nodeDict)
-		if err != nil {
-			return err
+		p, ok := r.linearizedPages[node.ObjectNumber]
+		if !ok {
+			var err error
+			p, err = r.newPdfPageFromDict(nodeDict)
+			if err != nil {
+				return err
+			}
 		}
 		p.setContainer(node)
 
@@ -570,6 +855,9 @@ func (r *PdfReader) GetNumPages() (int, error) {
 	if r.parser.GetCrypter() != nil && !r.parser.IsAuthenticated() {
 		return 0, fmt.Errorf("file need to be decrypted first")
 	}
+	if !r.pageTreeLoaded && r.linearization != nil {
+		return r.linearization.NumPages, nil
+	}
 	return len(r.pageList), nil
 }
 
@@ -583,7 +871,6 @@ func (r *PdfReader) resolveReference(ref *core.PdfObjectReference) (core.PdfObje
 		if err != nil {
 			return nil, false, err
 		}
-		r.parser.ObjCache[int(ref.ObjectNumber)] = obj
 		return obj, false, nil
 	}
 	return cachedObj, true, nil
@@ -673,6 +960,9 @@ func (r *PdfReader) traverseObjectData(o core.PdfObject) error {
 
 // PageFromIndirectObject returns the PdfPage and page number for a given indirect object.
 func (r *PdfReader) PageFromIndirectObject(ind *core.PdfIndirectObject) (*PdfPage, int, error) {
+	if err := r.ensurePageTree(); err != nil {
+		return nil, 0, err
+	}
 	if len(r.PageList) != len(r.pageList) {
 		return nil, 0, errors.New("page list invalid")
 	}
@@ -690,14 +980,23 @@ func (r *PdfReader) GetPage(pageNumber int) (*PdfPage, error) {
 	if r.parser.GetCrypter() != nil && !r.parser.IsAuthenticated() {
 		return nil, fmt.Errorf("file needs to be decrypted first")
 	}
+	if pageNumber < 1 {
+		return nil, fmt.Errorf("page numbering must start at 1")
+	}
+	if !r.pageTreeLoaded && r.linearization != nil {
+		page, err := r.getLinearizedPage(pageNumber)
+		if err == nil {
+			return page, nil
+		}
+		common.Log.Debug("Unable to locate linearized page %d: %v - loading page tree", pageNumber, err)
+	}
+	if err := r.ensurePageTree(); err != nil {
+		return nil, err
+	}
 	if len(r.pageList) < pageNumber {
 		return nil, errors.New("invalid page number (page count too short)")
 	}
-	idx := pageNumber - 1
-	if idx < 0 {
-		return nil, fmt.Errorf("page numbering must start at 1")
-	}
-	page := r.PageList[idx]
+	page := r.PageList[pageNumber-1]
 	return page, nil
 }
 
@@ -4,7 +4,10 @@ package model
 
 import (
 	"bytes"
+	"fmt"
 	"os"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -44,3 +47,187 @@ func TestReaderLazy(t *testing.T) {
 	err = writer.Write(&buf)
 	require.NoError(t, err)
 }
+
+// rangeReader is an io.ReaderAt which records the greatest offset read.
+type rangeReader struct {
+	data    []byte
+	maxRead int64
+}
+
+func (r *rangeReader) ReadAt(p []byte, off int64) (int, error) {
+	rr := bytes.NewReader(r.data)
+	n, err := rr.ReadAt(p, off)
+	if end := off + int64(n); end > r.maxRead {
+		r.maxRead = end
+	}
+	return n, err
+}
+
+func TestReaderAtLinearized(t *testing.T) {
+	const numPages = 5
+	w := NewPdfWriter()
+	for i := 0; i < numPages; i++ {
+		page := NewPdfPage()
+		page.MediaBox = &PdfRectangle{Urx: 200, Ury: 200}
+		// Large raw contents so that the later pages are well beyond the first-page section.
+		content := fmt.Sprintf("%% Page %d\n%s", i+1, strings.Repeat("0 0 m 10 10 l S\n", 2000))
+		require.NoError(t, page.SetContentStreams([]string{content}, core.NewRawEncoder()))
+		require.NoError(t, w.AddPage(page))
+	}
+	w.SetLinearized(true)
+
+	var buf bytes.Buffer
+	require.NoError(t, w.Write(&buf))
+	data := buf.Bytes()
+
+	ra := &rangeReader{data: data}
+	reader, err := NewPdfReaderAt(ra, int64(len(data)), nil)
+	require.NoError(t, err)
+
+	numPagesRead, err := reader.GetNumPages()
+	require.NoError(t, err)
+	require.Equal(t, numPages, numPagesRead)
+
+	for _, pageNum := range []int{0, -3} {
+		_, err := reader.GetPage(pageNum)
+		require.EqualError(t, err, "page numbering must start at 1")
+	}
+
+	page, err := reader.GetPage(1)
+	require.NoError(t, err)
+	contents, err := page.GetAllContentStreams()
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(contents, "% Page 1\n"))
+
+	// Only the first-page section (and some buffering slack) has been read.
+	lin := reader.parser.GetLinearization()
+	require.NotNil(t, lin)
+	require.True(t, ra.maxRead <= lin.FirstPageEnd+4096, "read up to %d, first page ends at %d", ra.maxRead, lin.FirstPageEnd)
+	require.True(t, ra.maxRead < lin.MainXrefOffset)
+
+	// Other pages are located with the hint tables.
+	for i := numPages; i >= 2; i-- {
+		page, err := reader.GetPage(i)
+		require.NoError(t, err)
+		contents, err := page.GetAllContentStreams()
+		require.NoError(t, err)
+		require.True(t, strings.HasPrefix(contents, fmt.Sprintf("%% Page %d\n", i)), "page %d", i)
+	}
+
+	// Loading the page tree keeps the pages already accessed.
+	_, pageNum, err := reader.PageFromIndirectObject(page.GetPageAsIndirectObject())
+	require.NoError(t, err)
+	require.Equal(t, 1, pageNum)
+	require.Len(t, reader.PageList, numPages)
+	require.Equal(t, page, reader.PageList[0])
+}
+
+func TestReaderAtLinearizedHintMismatch(t *testing.T) {
+	courier, err := NewStandard14Font(CourierName)
+	require.NoError(t, err)
+	courierObj := courier.ToPdfObject()
+
+	// The pages after the first share the Courier font, in the shared objects section.
+	const numPages = 4
+	w := NewPdfWriter()
+	for i := 0; i < numPages; i++ {
+		page := NewPdfPage()
+		page.MediaBox = &PdfRectangle{Urx: 200, Ury: 200}
+		if i > 0 {
+			require.NoError(t, page.Resources.SetFontByName("F1", courierObj))
+		}
+		content := fmt.Sprintf("%% Page %d\nBT /F1 12 Tf 10 10 Td (Page %d) Tj ET", i+1, i+1)
+		require.NoError(t, page.SetContentStreams([]string{content}, core.NewFlateEncoder()))
+		require.NoError(t, w.AddPage(page))
+	}
+	w.SetLinearized(true)
+	var buf bytes.Buffer
+	require.NoError(t, w.Write(&buf))
+	data := buf.Bytes()
+
+	checkPages := func(reader *PdfReader) {
+		for i := numPages; i >= 1; i-- {
+			page, err := reader.GetPage(i)
+			require.NoError(t, err)
+			contents, err := page.GetAllContentStreams()
+			require.NoError(t, err)
+			require.True(t, strings.HasPrefix(contents, fmt.Sprintf("%% Page %d\n", i)), "page %d", i)
+		}
+	}
+
+	// The pages are located with the hint tables if they match the objects.
+	reader, err := NewPdfReaderAt(bytes.NewReader(data), int64(len(data)), nil)
+	require.NoError(t, err)
+	checkPages(reader)
+	require.False(t, reader.pageTreeLoaded)
+
+	// Otherwise the page tree is loaded.
+	for _, modify := range []func(pages *core.PageOffsetHintTable){
+		// The objects of page 3 would start with the contents of page 2.
+		func(pages *core.PageOffsetHintTable) { pages.Pages[1].NumObjects-- },
+		// The objects of page 3 would end with the page object of page 4.
+		func(pages *core.PageOffsetHintTable) { pages.Pages[2].NumObjects++ },
+		// The objects of page 4 would overlap the first page section.
+		func(pages *core.PageOffsetHintTable) { pages.Pages[3].NumObjects += 100 },
+	} {
+		reader, err := NewPdfReaderAt(bytes.NewReader(data), int64(len(data)), nil)
+		require.NoError(t, err)
+		pages, _, err := reader.parser.GetHintTables()
+		require.NoError(t, err)
+		modify(pages)
+		checkPages(reader)
+		require.True(t, reader.pageTreeLoaded)
+	}
+}
+
+func TestReaderCloneConcurrent(t *testing.T) {
+	const numPages = 30
+	w := NewPdfWriter()
+	for i := 1; i <= numPages; i++ {
+		page := NewPdfPage()
+		page.MediaBox = &PdfRectangle{Urx: 100, Ury: 100}
+		require.NoError(t, page.SetContentStreams([]string{fmt.Sprintf("%% page %d", i)}, core.NewFlateEncoder()))
+		require.NoError(t, w.AddPage(page))
+	}
+	var buf bytes.Buffer
+	require.NoError(t, w.Write(&buf))
+
+	reader, err := NewPdfReader(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+
+	readers := []*PdfReader{reader}
+	for i := 0; i < 7; i++ {
+		clone, err := reader.Clone()
+		require.NoError(t, err)
+		readers = append(readers, clone)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(readers))
+	for i, r := range readers {
+		wg.Add(1)
+		go func(i int, r *PdfReader) {
+			defer wg.Done()
+			for pageNum := numPages; pageNum >= 1; pageNum-- {
+				page, err := r.GetPage(pageNum)
+				if err != nil {
+					errs[i] = err
+					return
+				}
+				contents, err := page.GetAllContentStreams()
+				if err != nil {
+					errs[i] = err
+					return
+				}
+				if expected := fmt.Sprintf("%% page %d", pageNum); contents != expected {
+					errs[i] = fmt.Errorf("page %d: got %q, expected %q", pageNum, contents, expected)
+					return
+				}
+			}
+		}(i, r)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+}
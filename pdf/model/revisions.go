@@ -0,0 +1,45 @@
+package model
+
+import (
+	"errors"
+
+	"github.com/finalversus/doc/pdf/core"
+)
+
+// GetRevisions returns the revisions of the document, from the original document to the latest
+// incremental update (e.g. written by PdfAppender). Each revision gives the byte range of the file
+// it was written to, its trailer dictionary, and the numbers of the objects it added, modified or
+// deleted relative to the previous revision.
+// Documents without incremental updates have a single revision.
+func (r *PdfReader) GetRevisions() ([]*core.Revision, error) {
+	return r.parser.GetRevisions()
+}
+
+// OpenRevision returns a reader of the document as it was at revision `rev` (see GetRevisions),
+// configured by `opts` (see NewPdfReaderWithOpts). Encrypted revisions must be decrypted with
+// the returned reader.
+// The returned reader reads the same file as `r`. Unless the io.ReadSeeker `r` was created with
+// implements io.ReaderAt, the readers must not be used concurrently.
+func (r *PdfReader) OpenRevision(rev *core.Revision, opts *ReaderOpts) (*PdfReader, error) {
+	return NewPdfReaderWithOpts(r.parser.RevisionReader(rev), opts)
+}
+
+// GetSignedRevision returns the index in `revisions` of the revision signed by `sig`, i.e. the
+// revision ending where the byte range of the signature ends. The changes made to the document
+// after signing are those of the following revisions.
+func GetSignedRevision(revisions []*core.Revision, sig *PdfSignature) (int, error) {
+	if sig == nil || sig.ByteRange == nil {
+		return -1, errors.New("signature byte range missing")
+	}
+	byteRange, err := sig.ByteRange.ToInt64Slice()
+	if err != nil || len(byteRange) != 4 {
+		return -1, errors.New("invalid signature byte range")
+	}
+	end := byteRange[2] + byteRange[3]
+	for i, rev := range revisions {
+		if rev.Offset+rev.Length == end {
+			return i, nil
+		}
+	}
+	return -1, errors.New("signed revision not found")
+}
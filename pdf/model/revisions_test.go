@@ -0,0 +1,103 @@
+package model_test
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/pkcs12"
+
+	"github.com/finalversus/doc/pdf/core"
+	"github.com/finalversus/doc/pdf/model"
+	"github.com/finalversus/doc/pdf/model/sighandler"
+)
+
+func TestRevisionsAfterSigning(t *testing.T) {
+	data, err := ioutil.ReadFile(testPdfFile1)
+	require.NoError(t, err)
+	reader, err := model.NewPdfReader(bytes.NewReader(data))
+	require.NoError(t, err)
+	original, err := reader.GetRevisions()
+	require.NoError(t, err)
+
+	// Sign the document.
+	appender, err := model.NewPdfAppender(reader)
+	require.NoError(t, err)
+	pfxData, err := ioutil.ReadFile(testPKS12Key)
+	require.NoError(t, err)
+	privateKey, cert, err := pkcs12.Decode(pfxData, testPKS12KeyPassword)
+	require.NoError(t, err)
+	handler, err := sighandler.NewAdobePKCS7Detached(privateKey.(*rsa.PrivateKey), cert)
+	require.NoError(t, err)
+	signature := model.NewPdfSignature(handler)
+	signature.SetName("Test Revisions")
+	signature.SetDate(time.Now(), "")
+	require.NoError(t, signature.Initialize())
+	sigField := model.NewPdfFieldSignature(signature)
+	sigField.T = core.MakeString("Signature1")
+	sigField.Rect = core.MakeArray(core.MakeInteger(0), core.MakeInteger(0), core.MakeInteger(0), core.MakeInteger(0))
+	require.NoError(t, appender.Sign(1, sigField))
+	var buf bytes.Buffer
+	require.NoError(t, appender.Write(&buf))
+
+	// Modify the signed document.
+	reader, err = model.NewPdfReader(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	appender, err = model.NewPdfAppender(reader)
+	require.NoError(t, err)
+	page, err := reader.GetPage(1)
+	require.NoError(t, err)
+	note := model.NewPdfAnnotationText()
+	note.Rect = core.MakeArrayFromFloats([]float64{10, 10, 30, 30})
+	note.Contents = core.MakeString("Added after signing")
+	page.AddAnnotation(note.PdfAnnotation)
+	appender.ReplacePage(1, page)
+	buf.Reset()
+	require.NoError(t, appender.Write(&buf))
+
+	reader, err = model.NewPdfReader(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	revisions, err := reader.GetRevisions()
+	require.NoError(t, err)
+	require.Len(t, revisions, len(original)+2)
+	last := revisions[len(revisions)-1]
+	require.Equal(t, int64(buf.Len()), last.Offset+last.Length)
+
+	fields := reader.AcroForm.AllFields()
+	require.Len(t, fields, 1)
+	sig, ok := fields[0].GetContext().(*model.PdfFieldSignature)
+	require.True(t, ok)
+	signed, err := model.GetSignedRevision(revisions, sig.V)
+	require.NoError(t, err)
+	require.Equal(t, len(original), signed)
+
+	// The appender writes the updated objects as new objects, with a new catalog.
+	require.NotEmpty(t, last.Added)
+	require.NotEqual(t, revisions[signed].Trailer.Get("Root").String(), last.Trailer.Get("Root").String())
+
+	// The signed revision does not contain the annotation.
+	for i, expected := range []int{1, 2} {
+		revReader, err := reader.OpenRevision(revisions[signed+i], nil)
+		require.NoError(t, err)
+		revPage, err := revReader.GetPage(1)
+		require.NoError(t, err)
+		annots, err := revPage.GetAnnotations()
+		require.NoError(t, err)
+		require.Len(t, annots, expected)
+	}
+
+	// Files without incremental updates have a single revision.
+	f, err := os.Open(testPdfLoremIpsumFile)
+	require.NoError(t, err)
+	defer f.Close()
+	reader, err = model.NewPdfReader(f)
+	require.NoError(t, err)
+	revisions, err = reader.GetRevisions()
+	require.NoError(t, err)
+	require.Len(t, revisions, 1)
+	require.Empty(t, revisions[0].Modified)
+}
@@ -0,0 +1,898 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/finalversus/doc/common"
+	"github.com/finalversus/doc/pdf/core"
+)
+
+// standardStructTypes are the standard structure types (section 14.8.4 of the PDF 1.7 standard).
+var standardStructTypes = map[string]struct{}{
+	// Grouping elements.
+	"Document": {}, "Part": {}, "Art": {}, "Sect": {}, "Div": {}, "BlockQuote": {}, "Caption": {},
+	"TOC": {}, "TOCI": {}, "Index": {}, "NonStruct": {}, "Private": {},
+	// Block-level structure elements.
+	"P": {}, "H": {}, "H1": {}, "H2": {}, "H3": {}, "H4": {}, "H5": {}, "H6": {},
+	"L": {}, "LI": {}, "Lbl": {}, "LBody": {},
+	"Table": {}, "TR": {}, "TH": {}, "TD": {}, "THead": {}, "TBody": {}, "TFoot": {},
+	// Inline-level structure elements.
+	"Span": {}, "Quote": {}, "Note": {}, "Reference": {}, "BibEntry": {}, "Code": {}, "Link": {},
+	"Annot": {}, "Ruby": {}, "RB": {}, "RT": {}, "RP": {}, "Warichu": {}, "WT": {}, "WP": {},
+	// Illustration elements.
+	"Figure": {}, "Formula": {}, "Form": {},
+}
+
+// IsStandardStructType returns true if `structType` is a standard structure type, e.g. "H1" or
+// "Table".
+func IsStandardStructType(structType string) bool {
+	_, ok := standardStructTypes[structType]
+	return ok
+}
+
+// PdfMarkInfo represents the mark information dictionary of the document catalog (section
+// 14.7.1 of the PDF 1.7 standard).
+type PdfMarkInfo struct {
+	// Marked is true if the document conforms to the Tagged PDF conventions.
+	Marked         bool
+	UserProperties bool
+	Suspects       bool
+}
+
+// NewPdfMarkInfoFromObject loads the mark information dictionary `obj`.
+func NewPdfMarkInfoFromObject(obj core.PdfObject) (*PdfMarkInfo, error) {
+	dict, ok := core.GetDict(obj)
+	if !ok {
+		return nil, fmt.Errorf("invalid mark info type: %T", obj)
+	}
+	info := &PdfMarkInfo{}
+	if val, ok := core.GetBoolVal(dict.Get("Marked")); ok {
+		info.Marked = val
+	}
+	if val, ok := core.GetBoolVal(dict.Get("UserProperties")); ok {
+		info.UserProperties = val
+	}
+	if val, ok := core.GetBoolVal(dict.Get("Suspects")); ok {
+		info.Suspects = val
+	}
+	return info, nil
+}
+
+// ToPdfObject returns the mark information dictionary.
+func (m *PdfMarkInfo) ToPdfObject() core.PdfObject {
+	dict := core.MakeDict()
+	dict.Set("Marked", core.MakeBool(m.Marked))
+	if m.UserProperties {
+		dict.Set("UserProperties", core.MakeBool(true))
+	}
+	if m.Suspects {
+		dict.Set("Suspects", core.MakeBool(true))
+	}
+	return dict
+}
+
+// GetMarkInfo returns the mark information of the document, or nil if the catalog has no MarkInfo
+// entry.
+func (r *PdfReader) GetMarkInfo() (*PdfMarkInfo, error) {
+	obj := r.catalog.Get("MarkInfo")
+	if obj == nil {
+		return nil, nil
+	}
+	return NewPdfMarkInfoFromObject(obj)
+}
+
+// GetLanguage returns the natural language of the document (catalog Lang entry), or an empty
+// string if not specified.
+func (r *PdfReader) GetLanguage() string {
+	lang, ok := core.GetString(r.catalog.Get("Lang"))
+	if !ok {
+		return ""
+	}
+	return lang.Decoded()
+}
+
+// SetMarkInfo sets the mark information dictionary of the output document. Tagged documents set
+// Marked to true.
+func (w *PdfWriter) SetMarkInfo(info *PdfMarkInfo) {
+	w.catalog.Set("MarkInfo", info.ToPdfObject())
+}
+
+// SetLanguage sets the natural language of the output document (catalog Lang entry), as a
+// language tag such as "en-US".
+func (w *PdfWriter) SetLanguage(lang string) {
+	w.catalog.Set("Lang", core.MakeString(lang))
+}
+
+// PdfStructAttribute represents an attribute object of a structure element (section 14.7.5 of
+// the PDF 1.7 standard).
+type PdfStructAttribute struct {
+	// O is the owner of the attributes, e.g. "Layout", "List", "Table" or "PrintField".
+	O string
+
+	// Attributes are the entries of the attribute object, other than O.
+	Attributes *core.PdfObjectDictionary
+}
+
+// NewPdfStructAttribute returns an empty attribute object of owner `owner`.
+func NewPdfStructAttribute(owner string) *PdfStructAttribute {
+	return &PdfStructAttribute{O: owner, Attributes: core.MakeDict()}
+}
+
+// newPdfStructAttributeFromObject loads the attribute object (dictionary or stream) `obj`.
+func newPdfStructAttributeFromObject(obj core.PdfObject) (*PdfStructAttribute, error) {
+	var dict *core.PdfObjectDictionary
+	if stream, ok := core.GetStream(obj); ok {
+		dict = stream.PdfObjectDictionary
+	} else if d, ok := core.GetDict(obj); ok {
+		dict = d
+	} else {
+		return nil, fmt.Errorf("invalid attribute object type: %T", obj)
+	}
+
+	attr := &PdfStructAttribute{Attributes: core.MakeDict()}
+	for _, key := range dict.Keys() {
+		if key == "O" {
+			attr.O, _ = core.GetNameVal(dict.Get(key))
+			continue
+		}
+		attr.Attributes.Set(key, dict.Get(key))
+	}
+	return attr, nil
+}
+
+// Get returns the attribute `key`, or nil if not set.
+func (a *PdfStructAttribute) Get(key string) core.PdfObject {
+	return a.Attributes.Get(core.PdfObjectName(key))
+}
+
+// Set sets the attribute `key` to `val`.
+func (a *PdfStructAttribute) Set(key string, val core.PdfObject) {
+	a.Attributes.Set(core.PdfObjectName(key), val)
+}
+
+// ToPdfObject returns the attribute object dictionary.
+func (a *PdfStructAttribute) ToPdfObject() core.PdfObject {
+	dict := core.MakeDict()
+	dict.Set("O", core.MakeName(a.O))
+	if a.Attributes != nil {
+		for _, key := range a.Attributes.Keys() {
+			dict.Set(key, a.Attributes.Get(key))
+		}
+	}
+	return dict
+}
+
+// PdfStructKidType is the type of a kid of a structure element.
+type PdfStructKidType int
+
+// Types of structure element kids.
+const (
+	// StructKidElem is a structure element.
+	StructKidElem PdfStructKidType = iota
+
+	// StructKidMarkedContent is a marked-content sequence of a page or form XObject, identified
+	// by its marked-content identifier (MCID).
+	StructKidMarkedContent
+
+	// StructKidObject is a PDF object, such as an annotation or an XObject (object reference).
+	StructKidObject
+)
+
+// PdfStructKid is a kid of a structure element.
+type PdfStructKid struct {
+	Type PdfStructKidType
+
+	// Elem is the structure element (StructKidElem).
+	Elem *PdfStructElem
+
+	// MCID is the marked-content identifier (StructKidMarkedContent), -1 for other kids.
+	MCID int
+
+	// Page is the page of the marked content or object, or nil if unknown.
+	Page *PdfPage
+
+	// Stm is the content stream containing the marked content when it is not the page content,
+	// typically a form XObject stream.
+	Stm core.PdfObject
+
+	// Obj is the referenced object (StructKidObject).
+	Obj core.PdfObject
+
+	// Annotation is the annotation of Page referenced by the kid (StructKidObject), if any.
+	Annotation *PdfAnnotation
+}
+
+// NewStructElemKid returns a kid of structure element `elem`.
+func NewStructElemKid(elem *PdfStructElem) *PdfStructKid {
+	return &PdfStructKid{Type: StructKidElem, Elem: elem, MCID: -1}
+}
+
+// NewStructMarkedContentKid returns a kid of the marked-content sequence with identifier `mcid`
+// in the content of `page`.
+func NewStructMarkedContentKid(page *PdfPage, mcid int) *PdfStructKid {
+	return &PdfStructKid{Type: StructKidMarkedContent, MCID: mcid, Page: page}
+}
+
+// NewStructAnnotationKid returns an object reference kid of annotation `annot` of `page`.
+func NewStructAnnotationKid(page *PdfPage, annot *PdfAnnotation) *PdfStructKid {
+	return &PdfStructKid{
+		Type:       StructKidObject,
+		MCID:       -1,
+		Page:       page,
+		Obj:        annot.GetContainingPdfObject(),
+		Annotation: annot,
+	}
+}
+
+// toPdfObject returns the kid object of the kid of `parent`.
+func (k *PdfStructKid) toPdfObject(parent *PdfStructElem) core.PdfObject {
+	switch k.Type {
+	case StructKidElem:
+		return k.Elem.ToPdfObject()
+	case StructKidMarkedContent:
+		if k.Stm == nil && k.Page == parent.Page {
+			return core.MakeInteger(int64(k.MCID))
+		}
+		dict := core.MakeDict()
+		dict.Set("Type", core.MakeName("MCR"))
+		if k.Page != nil {
+			dict.Set("Pg", k.Page.GetPageAsIndirectObject())
+		}
+		if k.Stm != nil {
+			dict.Set("Stm", k.Stm)
+		}
+		dict.Set("MCID", core.MakeInteger(int64(k.MCID)))
+		return dict
+	default:
+		dict := core.MakeDict()
+		dict.Set("Type", core.MakeName("OBJR"))
+		if k.Page != nil {
+			dict.Set("Pg", k.Page.GetPageAsIndirectObject())
+		}
+		obj := k.Obj
+		if k.Annotation != nil {
+			obj = k.Annotation.GetContainingPdfObject()
+		}
+		dict.Set("Obj", obj)
+		return dict
+	}
+}
+
+// PdfStructElem represents a structure element of the logical structure of a tagged document
+// (section 14.7.2 of the PDF 1.7 standard).
+type PdfStructElem struct {
+	// S is the structure type, which may be mapped to a standard type by the role map of the
+	// structure tree (see StandardType).
+	S string
+
+	// Parent is the parent element, nil for the elements of the structure tree root.
+	Parent *PdfStructElem
+
+	Kids []*PdfStructKid
+
+	// Page is the page of the marked content kids which do not specify their page (Pg).
+	Page *PdfPage
+
+	// Attribute objects (A) and attribute classes of the class map (C).
+	A []*PdfStructAttribute
+	C []string
+
+	ID         []byte // element identifier (byte string), referenced by the IDTree of the root
+	T          string // title
+	Lang       string
+	Alt        string // alternate description, e.g. of figures
+	E          string // expanded form of abbreviations
+	ActualText string
+
+	root      *PdfStructTreeRoot
+	container *core.PdfIndirectObject
+}
+
+// NewPdfStructElem returns a structure element of type `structType`.
+func NewPdfStructElem(structType string) *PdfStructElem {
+	return &PdfStructElem{
+		S:         structType,
+		container: core.MakeIndirectObject(core.MakeDict()),
+	}
+}
+
+// AddElem appends the structure element `elem` to the kids of the element.
+func (e *PdfStructElem) AddElem(elem *PdfStructElem) {
+	elem.Parent = e
+	elem.root = e.root
+	e.Kids = append(e.Kids, NewStructElemKid(elem))
+}
+
+// AddMarkedContent appends the marked-content sequence `mcid` of `page` to the kids of the
+// element. The page of the element is set to `page` if not set.
+func (e *PdfStructElem) AddMarkedContent(page *PdfPage, mcid int) {
+	if e.Page == nil {
+		e.Page = page
+	}
+	e.Kids = append(e.Kids, NewStructMarkedContentKid(page, mcid))
+}
+
+// AddAnnotation appends the annotation `annot` of `page` to the kids of the element.
+func (e *PdfStructElem) AddAnnotation(page *PdfPage, annot *PdfAnnotation) {
+	e.Kids = append(e.Kids, NewStructAnnotationKid(page, annot))
+}
+
+// StandardType returns the standard structure type of the element, resolved with the role map of
+// the structure tree. The structure type is returned if it cannot be mapped to a standard type.
+func (e *PdfStructElem) StandardType() string {
+	if e.root == nil {
+		return e.S
+	}
+	return e.root.ResolveRole(e.S)
+}
+
+// GetAttributes returns the attribute objects of the element, including those of its attribute
+// classes.
+func (e *PdfStructElem) GetAttributes() []*PdfStructAttribute {
+	var attrs []*PdfStructAttribute
+	if e.root != nil {
+		for _, class := range e.C {
+			attrs = append(attrs, e.root.ClassMap[class]...)
+		}
+	}
+	return append(attrs, e.A...)
+}
+
+// GetElems returns the structure element kids of the element.
+func (e *PdfStructElem) GetElems() []*PdfStructElem {
+	var elems []*PdfStructElem
+	for _, kid := range e.Kids {
+		if kid.Type == StructKidElem {
+			elems = append(elems, kid.Elem)
+		}
+	}
+	return elems
+}
+
+// GetContainingPdfObject implements interface PdfModel.
+func (e *PdfStructElem) GetContainingPdfObject() core.PdfObject {
+	return e.container
+}
+
+// ToPdfObject implements interface PdfModel. Only the modeled entries are updated in the
+// dictionary of loaded elements, and the other entries (e.g. R or AF) are kept.
+func (e *PdfStructElem) ToPdfObject() core.PdfObject {
+	if e.container == nil {
+		e.container = core.MakeIndirectObject(core.MakeDict())
+	}
+	dict := e.container.PdfObject.(*core.PdfObjectDictionary)
+
+	dict.Set("Type", core.MakeName("StructElem"))
+	dict.Set("S", core.MakeName(e.S))
+	if e.Parent != nil {
+		dict.Set("P", e.Parent.container)
+	} else if e.root != nil {
+		dict.Set("P", e.root.container)
+	}
+	var id core.PdfObject
+	if len(e.ID) > 0 {
+		id = core.MakeStringFromBytes(e.ID)
+	}
+	setStructEntry(dict, "ID", id)
+	var pg core.PdfObject
+	if e.Page != nil {
+		pg = e.Page.GetPageAsIndirectObject()
+	}
+	setStructEntry(dict, "Pg", pg)
+
+	var k core.PdfObject
+	if len(e.Kids) > 0 {
+		kids := core.MakeArray()
+		for _, kid := range e.Kids {
+			if kid.Type == StructKidElem {
+				kid.Elem.Parent = e
+				kid.Elem.root = e.root
+			}
+			kids.Append(kid.toPdfObject(e))
+		}
+		k = kids
+		if kids.Len() == 1 {
+			k = kids.Get(0)
+		}
+	}
+	setStructEntry(dict, "K", k)
+
+	var a core.PdfObject
+	if len(e.A) == 1 {
+		a = e.A[0].ToPdfObject()
+	} else if len(e.A) > 1 {
+		attrs := core.MakeArray()
+		for _, attr := range e.A {
+			attrs.Append(attr.ToPdfObject())
+		}
+		a = attrs
+	}
+	setStructEntry(dict, "A", a)
+	var c core.PdfObject
+	if len(e.C) == 1 {
+		c = core.MakeName(e.C[0])
+	} else if len(e.C) > 1 {
+		classes := core.MakeArray()
+		for _, class := range e.C {
+			classes.Append(core.MakeName(class))
+		}
+		c = classes
+	}
+	setStructEntry(dict, "C", c)
+
+	for _, entry := range []struct {
+		key core.PdfObjectName
+		val string
+	}{{"T", e.T}, {"Lang", e.Lang}, {"Alt", e.Alt}, {"E", e.E}, {"ActualText", e.ActualText}} {
+		var val core.PdfObject
+		if entry.val != "" {
+			val = NewPdfInfoText(entry.val)
+		}
+		setStructEntry(dict, entry.key, val)
+	}
+	return e.container
+}
+
+// setStructEntry sets the entry `key` of the structure dictionary `dict` to `val`, or removes it
+// if `val` is nil.
+func setStructEntry(dict *core.PdfObjectDictionary, key core.PdfObjectName, val core.PdfObject) {
+	if val == nil {
+		dict.Remove(key)
+		return
+	}
+	dict.Set(key, val)
+}
+
+// PdfStructTreeRoot represents the structure tree root of a tagged document (section 14.7.2 of
+// the PDF 1.7 standard).
+type PdfStructTreeRoot struct {
+	// Kids are the top-level structure elements, usually a single Document element.
+	Kids []*PdfStructElem
+
+	// RoleMap maps structure types to other (usually standard) structure types.
+	RoleMap map[string]string
+
+	// ClassMap maps attribute class names to their attribute objects.
+	ClassMap map[string][]*PdfStructAttribute
+
+	// ParentTree maps the StructParents entries of pages and content streams to arrays of
+	// structure elements indexed by MCID, and the StructParent entries of annotations and
+	// XObjects to structure elements.
+	ParentTree        *PdfNumberTree
+	ParentTreeNextKey int
+
+	// Structure elements by dictionary, used for the parent tree lookups.
+	elems map[*core.PdfObjectDictionary]*PdfStructElem
+
+	container *core.PdfIndirectObject
+}
+
+// NewPdfStructTreeRoot returns an empty structure tree root.
+func NewPdfStructTreeRoot() *PdfStructTreeRoot {
+	return &PdfStructTreeRoot{container: core.MakeIndirectObject(core.MakeDict())}
+}
+
+// AddElem appends the top-level structure element `elem`.
+func (root *PdfStructTreeRoot) AddElem(elem *PdfStructElem) {
+	elem.Parent = nil
+	elem.root = root
+	root.Kids = append(root.Kids, elem)
+}
+
+// ResolveRole returns the standard structure type of `structType`, following the role map. The
+// structure type is returned unchanged if it is standard or cannot be mapped to a standard type.
+func (root *PdfStructTreeRoot) ResolveRole(structType string) string {
+	visited := map[string]struct{}{}
+	for s := structType; ; {
+		if IsStandardStructType(s) {
+			return s
+		}
+		visited[s] = struct{}{}
+		mapped, ok := root.RoleMap[s]
+		if !ok {
+			return structType
+		}
+		if _, ok := visited[mapped]; ok {
+			common.Log.Debug("Role map loop for structure type %q", structType)
+			return structType
+		}
+		s = mapped
+	}
+}
+
+// Walk calls `fn` for the structure elements of the tree in document order, with their depth
+// (0 for the top-level elements). Walking stops if `fn` returns an error.
+func (root *PdfStructTreeRoot) Walk(fn func(elem *PdfStructElem, depth int) error) error {
+	var walk func(elems []*PdfStructElem, depth int) error
+	walk = func(elems []*PdfStructElem, depth int) error {
+		for _, elem := range elems {
+			if err := fn(elem, depth); err != nil {
+				return err
+			}
+			if err := walk(elem.GetElems(), depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return walk(root.Kids, 0)
+}
+
+// GetElemForMCID returns the structure element containing the marked-content sequence `mcid` of
+// `page`, or nil if not found, using the parent tree.
+func (root *PdfStructTreeRoot) GetElemForMCID(page *PdfPage, mcid int) (*PdfStructElem, error) {
+	key, ok := core.GetIntVal(page.StructParents)
+	if !ok || root.ParentTree == nil {
+		return nil, nil
+	}
+	obj, err := root.ParentTree.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	arr, ok := core.GetArray(obj)
+	if !ok || mcid < 0 || mcid >= arr.Len() {
+		return nil, nil
+	}
+	return root.lookupElem(arr.Get(mcid)), nil
+}
+
+// GetElemForStructParent returns the structure element of the object (annotation or XObject)
+// with StructParent entry `key`, or nil if not found, using the parent tree.
+func (root *PdfStructTreeRoot) GetElemForStructParent(key int) (*PdfStructElem, error) {
+	if root.ParentTree == nil {
+		return nil, nil
+	}
+	obj, err := root.ParentTree.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return root.lookupElem(obj), nil
+}
+
+// lookupElem returns the loaded structure element of dictionary `obj`.
+func (root *PdfStructTreeRoot) lookupElem(obj core.PdfObject) *PdfStructElem {
+	dict, ok := core.GetDict(obj)
+	if !ok {
+		return nil
+	}
+	return root.elems[dict]
+}
+
+// GetContainingPdfObject implements interface PdfModel.
+func (root *PdfStructTreeRoot) GetContainingPdfObject() core.PdfObject {
+	return root.container
+}
+
+// ToPdfObject implements interface PdfModel. Only the modeled entries are updated in the
+// dictionary of loaded structure tree roots, and the other entries (e.g. IDTree) are kept.
+func (root *PdfStructTreeRoot) ToPdfObject() core.PdfObject {
+	if root.container == nil {
+		root.container = core.MakeIndirectObject(core.MakeDict())
+	}
+	dict := root.container.PdfObject.(*core.PdfObjectDictionary)
+
+	dict.Set("Type", core.MakeName("StructTreeRoot"))
+	var k core.PdfObject
+	if len(root.Kids) > 0 {
+		kids := core.MakeArray()
+		for _, elem := range root.Kids {
+			elem.Parent = nil
+			elem.root = root
+			kids.Append(elem.ToPdfObject())
+		}
+		k = kids
+		if kids.Len() == 1 {
+			k = kids.Get(0)
+		}
+	}
+	setStructEntry(dict, "K", k)
+
+	var roleMap core.PdfObject
+	if len(root.RoleMap) > 0 {
+		d := core.MakeDict()
+		for _, key := range sortedStringKeys(root.RoleMap) {
+			d.Set(core.PdfObjectName(key), core.MakeName(root.RoleMap[key]))
+		}
+		roleMap = d
+	}
+	setStructEntry(dict, "RoleMap", roleMap)
+	var classMap core.PdfObject
+	if len(root.ClassMap) > 0 {
+		classes := make([]string, 0, len(root.ClassMap))
+		for class := range root.ClassMap {
+			classes = append(classes, class)
+		}
+		sort.Strings(classes)
+
+		d := core.MakeDict()
+		for _, class := range classes {
+			attrs := root.ClassMap[class]
+			if len(attrs) == 1 {
+				d.Set(core.PdfObjectName(class), attrs[0].ToPdfObject())
+				continue
+			}
+			arr := core.MakeArray()
+			for _, attr := range attrs {
+				arr.Append(attr.ToPdfObject())
+			}
+			d.Set(core.PdfObjectName(class), arr)
+		}
+		classMap = d
+	}
+	setStructEntry(dict, "ClassMap", classMap)
+
+	if root.ParentTree != nil {
+		dict.Set("ParentTree", root.ParentTree.ToPdfObject())
+		dict.Set("ParentTreeNextKey", core.MakeInteger(int64(root.ParentTreeNextKey)))
+	} else {
+		dict.Remove("ParentTree")
+		dict.Remove("ParentTreeNextKey")
+	}
+	return root.container
+}
+
+// SetStructTreeRoot sets the structure tree root of the output document. The tree is written
+// with the pages, which should reference the elements of their marked content in the parent tree
+// of `root` (StructParents entries of the pages, StructParent entries of the annotations).
+func (w *PdfWriter) SetStructTreeRoot(root *PdfStructTreeRoot) {
+	w.structTreeRoot = root
+}
+
+// writeStructTreeRoot sets the structure tree root of the writer in the catalog.
+func (w *PdfWriter) writeStructTreeRoot() error {
+	obj := w.structTreeRoot.ToPdfObject()
+	w.catalog.Set("StructTreeRoot", obj)
+	return w.addObjects(obj)
+}
+
+// sortedStringKeys returns the keys of `m` in increasing order.
+func sortedStringKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// GetStructTreeRoot returns the structure tree root of the document, or nil if the document is
+// not tagged. The kids of the structure elements are resolved to the pages and annotations of
+// the document.
+func (r *PdfReader) GetStructTreeRoot() (*PdfStructTreeRoot, error) {
+	obj := r.catalog.Get("StructTreeRoot")
+	if obj == nil {
+		return nil, nil
+	}
+	container, ok := core.ResolveReference(obj).(*core.PdfIndirectObject)
+	if !ok {
+		container = core.MakeIndirectObject(core.ResolveReference(obj))
+	}
+	dict, ok := core.GetDict(container.PdfObject)
+	if !ok {
+		return nil, fmt.Errorf("invalid structure tree root type: %T", container.PdfObject)
+	}
+	if err := r.ensurePageTree(); err != nil {
+		return nil, err
+	}
+
+	root := &PdfStructTreeRoot{
+		container: container,
+		elems:     map[*core.PdfObjectDictionary]*PdfStructElem{},
+	}
+	if roleMap, ok := core.GetDict(dict.Get("RoleMap")); ok {
+		root.RoleMap = map[string]string{}
+		for _, key := range roleMap.Keys() {
+			if role, ok := core.GetNameVal(roleMap.Get(key)); ok {
+				root.RoleMap[string(key)] = role
+			}
+		}
+	}
+	if classMap, ok := core.GetDict(dict.Get("ClassMap")); ok {
+		root.ClassMap = map[string][]*PdfStructAttribute{}
+		for _, key := range classMap.Keys() {
+			attrs, err := loadStructAttributes(classMap.Get(key))
+			if err != nil {
+				common.Log.Debug("Invalid attribute class %q: %v - skipping", key, err)
+				continue
+			}
+			root.ClassMap[string(key)] = attrs
+		}
+	}
+	if obj := dict.Get("ParentTree"); obj != nil {
+		tree, err := NewPdfNumberTreeFromObject(obj)
+		if err != nil {
+			common.Log.Debug("Invalid structure parent tree: %v - skipping", err)
+		}
+		root.ParentTree = tree
+	}
+	if key, ok := core.GetIntVal(dict.Get("ParentTreeNextKey")); ok {
+		root.ParentTreeNextKey = key
+	}
+
+	loader := &structTreeLoader{
+		reader: r,
+		root:   root,
+		pages:  map[core.PdfObject]*PdfPage{},
+	}
+	for i, ind := range r.pageList {
+		if i < len(r.PageList) {
+			loader.pages[ind] = r.PageList[i]
+		}
+	}
+	for _, kid := range structKidObjects(dict.Get("K")) {
+		if elem := loader.loadElem(kid, nil); elem != nil {
+			root.Kids = append(root.Kids, elem)
+		}
+	}
+	return root, nil
+}
+
+// structTreeLoader loads the structure elements of a structure tree.
+type structTreeLoader struct {
+	reader *PdfReader
+	root   *PdfStructTreeRoot
+
+	// Pages by page object.
+	pages map[core.PdfObject]*PdfPage
+}
+
+// structKidObjects returns the kid objects of the K entry `obj`, a kid or array of kids.
+func structKidObjects(obj core.PdfObject) []core.PdfObject {
+	if obj == nil {
+		return nil
+	}
+	if arr, ok := core.GetArray(obj); ok {
+		return arr.Elements()
+	}
+	return []core.PdfObject{obj}
+}
+
+// loadElem loads the structure element `obj` with parent `parent`. Invalid elements and elements
+// which are already loaded (loops) are skipped, with their kids.
+func (l *structTreeLoader) loadElem(obj core.PdfObject, parent *PdfStructElem) *PdfStructElem {
+	container, ok := core.ResolveReference(obj).(*core.PdfIndirectObject)
+	if !ok {
+		container = core.MakeIndirectObject(core.ResolveReference(obj))
+	}
+	dict, ok := core.GetDict(container.PdfObject)
+	if !ok {
+		common.Log.Debug("Invalid structure element type: %T - skipping", container.PdfObject)
+		return nil
+	}
+	if _, ok := l.root.elems[dict]; ok {
+		common.Log.Debug("Structure element loaded twice - skipping")
+		return nil
+	}
+
+	elem := &PdfStructElem{Parent: parent, root: l.root, container: container}
+	elem.S, _ = core.GetNameVal(dict.Get("S"))
+	if elem.S == "" {
+		common.Log.Debug("Structure element without type - skipping")
+		return nil
+	}
+	attrs, err := loadStructAttributes(dict.Get("A"))
+	if err != nil {
+		common.Log.Debug("Invalid attributes of structure element %q: %v - skipping", elem.S, err)
+		return nil
+	}
+	elem.A = attrs
+	l.root.elems[dict] = elem
+	elem.Page = l.page(dict.Get("Pg"))
+
+	if id, ok := core.GetString(dict.Get("ID")); ok {
+		elem.ID = id.Bytes()
+	}
+	for _, entry := range []struct {
+		key core.PdfObjectName
+		val *string
+	}{{"T", &elem.T}, {"Lang", &elem.Lang}, {"Alt", &elem.Alt}, {"E", &elem.E},
+		{"ActualText", &elem.ActualText}} {
+		if str, ok := core.GetString(dict.Get(entry.key)); ok {
+			*entry.val = str.Decoded()
+		}
+	}
+	for _, obj := range structKidObjects(dict.Get("C")) {
+		if class, ok := core.GetNameVal(obj); ok {
+			elem.C = append(elem.C, class)
+		}
+	}
+
+	for _, obj := range structKidObjects(dict.Get("K")) {
+		if kid := l.loadKid(obj, elem); kid != nil {
+			elem.Kids = append(elem.Kids, kid)
+		}
+	}
+	return elem
+}
+
+// loadKid loads the kid `obj` of structure element `elem`. Invalid kids are skipped (nil).
+func (l *structTreeLoader) loadKid(obj core.PdfObject, elem *PdfStructElem) *PdfStructKid {
+	if mcid, ok := core.GetIntVal(obj); ok {
+		return NewStructMarkedContentKid(elem.Page, mcid)
+	}
+	dict, ok := core.GetDict(obj)
+	if !ok {
+		common.Log.Debug("Invalid structure element kid type: %T - skipping", obj)
+		return nil
+	}
+
+	typ, _ := core.GetNameVal(dict.Get("Type"))
+	switch {
+	case typ == "MCR":
+		mcid, ok := core.GetIntVal(dict.Get("MCID"))
+		if !ok {
+			common.Log.Debug("Marked-content reference without MCID - skipping")
+			return nil
+		}
+		kid := NewStructMarkedContentKid(elem.Page, mcid)
+		if page := l.page(dict.Get("Pg")); page != nil {
+			kid.Page = page
+		}
+		kid.Stm = dict.Get("Stm")
+		return kid
+	case typ == "OBJR":
+		kid := &PdfStructKid{Type: StructKidObject, MCID: -1, Page: elem.Page}
+		if page := l.page(dict.Get("Pg")); page != nil {
+			kid.Page = page
+		}
+		kid.Obj = core.ResolveReference(dict.Get("Obj"))
+		annot, err := l.annotation(kid.Page, kid.Obj)
+		if err != nil {
+			common.Log.Debug("Invalid annotations of structure element kid: %v", err)
+		}
+		kid.Annotation = annot
+		return kid
+	case dict.Get("S") != nil:
+		child := l.loadElem(obj, elem)
+		if child == nil {
+			return nil
+		}
+		return NewStructElemKid(child)
+	}
+	common.Log.Debug("Unknown structure element kid type %q - skipping", typ)
+	return nil
+}
+
+// page returns the page of page object `obj`, or nil if not a page of the document.
+func (l *structTreeLoader) page(obj core.PdfObject) *PdfPage {
+	if obj == nil {
+		return nil
+	}
+	return l.pages[core.ResolveReference(obj)]
+}
+
+// annotation returns the annotation of `page` with object `obj`, or nil if not found.
+func (l *structTreeLoader) annotation(page *PdfPage, obj core.PdfObject) (*PdfAnnotation, error) {
+	if page == nil || obj == nil {
+		return nil, nil
+	}
+	annots, err := page.GetAnnotations()
+	if err != nil {
+		return nil, err
+	}
+	for _, annot := range annots {
+		if annot.GetContainingPdfObject() == obj {
+			return annot, nil
+		}
+	}
+	return nil, nil
+}
+
+// loadStructAttributes loads the attribute objects of the A entry or class map entry `obj`, an
+// attribute object or array of attribute objects and revision numbers.
+func loadStructAttributes(obj core.PdfObject) ([]*PdfStructAttribute, error) {
+	var attrs []*PdfStructAttribute
+	for _, obj := range structKidObjects(obj) {
+		if _, ok := core.GetIntVal(obj); ok {
+			// Revision number of the preceding attribute object.
+			continue
+		}
+		attr, err := newPdfStructAttributeFromObject(obj)
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, attr)
+	}
+	return attrs, nil
+}
@@ -0,0 +1,262 @@
+package model
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/finalversus/doc/pdf/core"
+)
+
+func TestStructTreeRoleMap(t *testing.T) {
+	root := NewPdfStructTreeRoot()
+	root.RoleMap = map[string]string{
+		"Heading":  "H1",
+		"Title":    "Heading",
+		"Loop1":    "Loop2",
+		"Loop2":    "Loop1",
+		"P":        "Span",
+		"Sidebar":  "Custom",
+		"Abstract": "P",
+	}
+	require.Equal(t, "H1", root.ResolveRole("Title"))
+	require.Equal(t, "H1", root.ResolveRole("Heading"))
+	require.Equal(t, "P", root.ResolveRole("Abstract"))
+	require.Equal(t, "P", root.ResolveRole("P"))
+	require.Equal(t, "Loop1", root.ResolveRole("Loop1"))
+	require.Equal(t, "Sidebar", root.ResolveRole("Sidebar"))
+	require.Equal(t, "Unknown", root.ResolveRole("Unknown"))
+}
+
+func TestStructTreeReadWrite(t *testing.T) {
+	w := NewPdfWriter()
+	page := NewPdfPage()
+	page.MediaBox = &PdfRectangle{Urx: 100, Ury: 100}
+	page.StructParents = core.MakeInteger(0)
+	link := NewPdfAnnotationLink()
+	link.Rect = core.MakeArray(core.MakeInteger(0), core.MakeInteger(0), core.MakeInteger(10), core.MakeInteger(10))
+	link.StructParent = core.MakeInteger(1)
+	page.AddAnnotation(link.PdfAnnotation)
+	require.NoError(t, w.AddPage(page))
+
+	// Document with a heading, a figure, a paragraph spanning two marked-content sequences and a
+	// link annotation.
+	root := NewPdfStructTreeRoot()
+	root.RoleMap = map[string]string{"Heading": "H1"}
+	bordered := NewPdfStructAttribute("Layout")
+	bordered.Set("BorderStyle", core.MakeName("Solid"))
+	root.ClassMap = map[string][]*PdfStructAttribute{"Bordered": {bordered}}
+
+	doc := NewPdfStructElem("Document")
+	doc.Lang = "en-US"
+	root.AddElem(doc)
+	heading := NewPdfStructElem("Heading")
+	heading.AddMarkedContent(page, 0)
+	doc.AddElem(heading)
+	figure := NewPdfStructElem("Figure")
+	figure.Alt = "Company logo"
+	figure.C = []string{"Bordered"}
+	bbox := NewPdfStructAttribute("Layout")
+	bbox.Set("BBox", (&PdfRectangle{Urx: 50, Ury: 20}).ToPdfObject())
+	figure.A = []*PdfStructAttribute{bbox}
+	figure.AddMarkedContent(page, 1)
+	doc.AddElem(figure)
+	para := NewPdfStructElem("P")
+	para.AddMarkedContent(page, 2)
+	para.AddMarkedContent(page, 3)
+	doc.AddElem(para)
+	linkElem := NewPdfStructElem("Link")
+	linkElem.AddAnnotation(page, link.PdfAnnotation)
+	para.AddElem(linkElem)
+
+	root.ParentTree = NewPdfNumberTree()
+	require.NoError(t, root.ParentTree.Set(0, core.MakeArray(heading.ToPdfObject(), figure.ToPdfObject(),
+		para.ToPdfObject(), para.ToPdfObject())))
+	require.NoError(t, root.ParentTree.Set(1, linkElem.ToPdfObject()))
+	root.ParentTreeNextKey = 2
+
+	w.SetStructTreeRoot(root)
+	markInfo := &PdfMarkInfo{Marked: true}
+	require.Equal(t, "<</Marked true>>", markInfo.ToPdfObject().WriteString())
+	w.SetMarkInfo(markInfo)
+	w.SetLanguage("en-US")
+	reader := writeTestDocument(t, &w)
+	require.Equal(t, "en-US", reader.GetLanguage())
+
+	info, err := reader.GetMarkInfo()
+	require.NoError(t, err)
+	require.Equal(t, &PdfMarkInfo{Marked: true}, info)
+
+	readRoot, err := reader.GetStructTreeRoot()
+	require.NoError(t, err)
+	require.NotNil(t, readRoot)
+	require.Equal(t, 2, readRoot.ParentTreeNextKey)
+
+	var types []string
+	var depths []int
+	err = readRoot.Walk(func(elem *PdfStructElem, depth int) error {
+		types = append(types, elem.StandardType())
+		depths = append(depths, depth)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"Document", "H1", "Figure", "P", "Link"}, types)
+	require.Equal(t, []int{0, 1, 1, 1, 2}, depths)
+
+	readPage, err := reader.GetPage(1)
+	require.NoError(t, err)
+	readDoc := readRoot.Kids[0]
+	require.Equal(t, "en-US", readDoc.Lang)
+	readHeading := readDoc.GetElems()[0]
+	require.Equal(t, "Heading", readHeading.S)
+	require.Equal(t, readDoc, readHeading.Parent)
+	require.Len(t, readHeading.Kids, 1)
+	require.Equal(t, StructKidMarkedContent, readHeading.Kids[0].Type)
+	require.Equal(t, 0, readHeading.Kids[0].MCID)
+	require.Equal(t, readPage, readHeading.Kids[0].Page)
+
+	readFigure := readDoc.GetElems()[1]
+	require.Equal(t, "Company logo", readFigure.Alt)
+	attrs := readFigure.GetAttributes()
+	require.Len(t, attrs, 2)
+	require.Equal(t, "Layout", attrs[0].O)
+	require.Equal(t, "/Solid", attrs[0].Get("BorderStyle").WriteString())
+	require.Equal(t, "[0 0 50 20]", attrs[1].Get("BBox").WriteString())
+
+	readPara := readDoc.GetElems()[2]
+	require.Len(t, readPara.Kids, 3)
+	require.Equal(t, 3, readPara.Kids[1].MCID)
+	readLink := readPara.Kids[2].Elem
+	require.Len(t, readLink.Kids, 1)
+	require.Equal(t, StructKidObject, readLink.Kids[0].Type)
+	require.Equal(t, readPage, readLink.Kids[0].Page)
+	readAnnots, err := readPage.GetAnnotations()
+	require.NoError(t, err)
+	require.Equal(t, readAnnots[0], readLink.Kids[0].Annotation)
+
+	// Parent tree lookups.
+	elem, err := readRoot.GetElemForMCID(readPage, 1)
+	require.NoError(t, err)
+	require.Equal(t, readFigure, elem)
+	elem, err = readRoot.GetElemForMCID(readPage, 3)
+	require.NoError(t, err)
+	require.Equal(t, readPara, elem)
+	elem, err = readRoot.GetElemForMCID(readPage, 4)
+	require.NoError(t, err)
+	require.Nil(t, elem)
+	key, ok := core.GetIntVal(readAnnots[0].StructParent)
+	require.True(t, ok)
+	elem, err = readRoot.GetElemForStructParent(key)
+	require.NoError(t, err)
+	require.Equal(t, readLink, elem)
+
+	// Untagged documents.
+	f, err := os.Open("testdata/minimal.pdf")
+	require.NoError(t, err)
+	defer f.Close()
+	reader, err = NewPdfReader(f)
+	require.NoError(t, err)
+	readRoot, err = reader.GetStructTreeRoot()
+	require.NoError(t, err)
+	require.Nil(t, readRoot)
+	info, err = reader.GetMarkInfo()
+	require.NoError(t, err)
+	require.Nil(t, info)
+	require.Equal(t, "", reader.GetLanguage())
+}
+
+func TestStructTreeUnmodeledEntries(t *testing.T) {
+	elemDict := core.MakeDict()
+	elemDict.Set("S", core.MakeName("P"))
+	elemDict.Set("R", core.MakeInteger(2))
+	elemDict.Set("AF", core.MakeArray())
+	elemDict.Set("T", core.MakeString("Title"))
+	rootDict := core.MakeDict()
+	rootDict.Set("Type", core.MakeName("StructTreeRoot"))
+	rootDict.Set("K", core.MakeIndirectObject(elemDict))
+	idTree := core.MakeDict()
+	idTree.Set("Names", core.MakeArray(core.MakeString("p1"), rootDict.Get("K")))
+	rootDict.Set("IDTree", idTree)
+	rootDict.Set("Namespaces", core.MakeArray())
+	rootDict.Set("RoleMap", core.MakeDict())
+
+	w := NewPdfWriter()
+	w.catalog.Set("StructTreeRoot", core.MakeIndirectObject(rootDict))
+	require.NoError(t, w.addObjects(w.catalog.Get("StructTreeRoot")))
+	reader := writeTestDocument(t, &w)
+
+	root, err := reader.GetStructTreeRoot()
+	require.NoError(t, err)
+	require.Len(t, root.Kids, 1)
+	elem := root.Kids[0]
+	require.Equal(t, "Title", elem.T)
+
+	// Only the modeled entries are updated, and the modeled entries which are now empty are
+	// removed.
+	elem.T = ""
+	elem.Alt = "Description"
+	dict, ok := core.GetDict(root.ToPdfObject())
+	require.True(t, ok)
+	require.NotNil(t, dict.Get("IDTree"))
+	require.NotNil(t, dict.Get("Namespaces"))
+	require.Nil(t, dict.Get("RoleMap"))
+	elemDict, ok = core.GetDict(dict.Get("K"))
+	require.True(t, ok)
+	require.Equal(t, "2", elemDict.Get("R").WriteString())
+	require.NotNil(t, elemDict.Get("AF"))
+	require.Nil(t, elemDict.Get("T"))
+	require.NotNil(t, elemDict.Get("Alt"))
+	require.Equal(t, "/StructElem", elemDict.Get("Type").WriteString())
+}
+
+func TestStructTreeInvalidElems(t *testing.T) {
+	newElem := func(structType string) *core.PdfObjectDictionary {
+		dict := core.MakeDict()
+		if structType != "" {
+			dict.Set("S", core.MakeName(structType))
+		}
+		return dict
+	}
+	untyped := newElem("")
+	invalidAttrs := newElem("Figure")
+	invalidAttrs.Set("A", core.MakeName("Layout"))
+	invalidAttrs.Set("K", newElem("Caption"))
+	para := newElem("P")
+	para.Set("ID", core.MakeString("\x00\xff1"))
+	doc := newElem("Document")
+	doc.Set("K", core.MakeArray(core.MakeIndirectObject(untyped), core.MakeIndirectObject(invalidAttrs),
+		core.MakeIndirectObject(para)))
+	rootDict := core.MakeDict()
+	rootDict.Set("Type", core.MakeName("StructTreeRoot"))
+	rootDict.Set("K", core.MakeArray(core.MakeIndirectObject(doc), core.MakeInteger(3)))
+	classMap := core.MakeDict()
+	classMap.Set("Invalid", core.MakeName("Layout"))
+	rootDict.Set("ClassMap", classMap)
+
+	w := NewPdfWriter()
+	w.catalog.Set("StructTreeRoot", core.MakeIndirectObject(rootDict))
+	require.NoError(t, w.addObjects(w.catalog.Get("StructTreeRoot")))
+	reader := writeTestDocument(t, &w)
+
+	// The invalid elements are skipped with their kids.
+	root, err := reader.GetStructTreeRoot()
+	require.NoError(t, err)
+	var types []string
+	err = root.Walk(func(elem *PdfStructElem, depth int) error {
+		types = append(types, elem.S)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"Document", "P"}, types)
+	require.Empty(t, root.ClassMap)
+
+	// Identifiers are byte strings.
+	elem := root.Kids[0].GetElems()[0]
+	require.Equal(t, []byte("\x00\xff1"), elem.ID)
+	dict, ok := core.GetDict(elem.ToPdfObject())
+	require.True(t, ok)
+	id, ok := core.GetString(dict.Get("ID"))
+	require.True(t, ok)
+	require.Equal(t, []byte("\x00\xff1"), id.Bytes())
+}
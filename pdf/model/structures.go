@@ -106,10 +106,11 @@ func (d PdfDate) ToGoTime() time.Time {
 	return time.Date(int(d.year), time.Month(d.month), int(d.day), int(d.hour), int(d.minute), int(d.second), 0, tz)
 }
 
-var reDate = regexp.MustCompile(`\s*D\s*:\s*(\d{4})(\d{2})(\d{2})(\d{2})(\d{2})(\d{2})([+-Z])?(\d{2})?'?(\d{2})?`)
+var reDate = regexp.MustCompile(`\s*D\s*:\s*(\d{4})(\d{2})?(\d{2})?(\d{2})?(\d{2})?(\d{2})?([+\-Z])?(\d{2})?'?(\d{2})?`)
 
 // NewPdfDate returns a new PdfDate object from a PDF date string (see 7.9.4 Dates).
-// format: "D: YYYYMMDDHHmmSSOHH'mm"
+// format: "D: YYYYMMDDHHmmSSOHH'mm". All fields after the year are optional: the month and day
+// default to 01, the other fields to zero.
 func NewPdfDate(dateStr string) (PdfDate, error) {
 	d := PdfDate{}
 
@@ -124,7 +125,13 @@ func NewPdfDate(dateStr string) (PdfDate, error) {
 	// No need to handle err from ParseInt, as pre-validated via regexp.
 	d.year, _ = strconv.ParseInt(matches[0][1], 10, 32)
 	d.month, _ = strconv.ParseInt(matches[0][2], 10, 32)
+	if d.month == 0 {
+		d.month = 1
+	}
 	d.day, _ = strconv.ParseInt(matches[0][3], 10, 32)
+	if d.day == 0 {
+		d.day = 1
+	}
 	d.hour, _ = strconv.ParseInt(matches[0][4], 10, 32)
 	d.minute, _ = strconv.ParseInt(matches[0][5], 10, 32)
 	d.second, _ = strconv.ParseInt(matches[0][6], 10, 32)
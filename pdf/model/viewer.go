@@ -0,0 +1,347 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/finalversus/doc/common"
+	"github.com/finalversus/doc/pdf/core"
+)
+
+// PageMode specifies how the document is displayed when opened (catalog PageMode).
+type PageMode string
+
+// Page modes.
+const (
+	PageModeUseNone        PageMode = "UseNone"        // neither outline nor thumbnails visible
+	PageModeUseOutlines    PageMode = "UseOutlines"    // outline (bookmarks) panel visible
+	PageModeUseThumbs      PageMode = "UseThumbs"      // thumbnail images visible
+	PageModeFullScreen     PageMode = "FullScreen"     // full-screen mode
+	PageModeUseOC          PageMode = "UseOC"          // optional content group panel visible
+	PageModeUseAttachments PageMode = "UseAttachments" // attachments panel visible
+)
+
+// PageLayout specifies the page layout used when the document is opened (catalog PageLayout).
+type PageLayout string
+
+// Page layouts.
+const (
+	PageLayoutSinglePage     PageLayout = "SinglePage"     // one page at a time
+	PageLayoutOneColumn      PageLayout = "OneColumn"      // pages in one column
+	PageLayoutTwoColumnLeft  PageLayout = "TwoColumnLeft"  // two columns, odd pages on the left
+	PageLayoutTwoColumnRight PageLayout = "TwoColumnRight" // two columns, odd pages on the right
+	PageLayoutTwoPageLeft    PageLayout = "TwoPageLeft"    // two pages at a time, odd pages on the left
+	PageLayoutTwoPageRight   PageLayout = "TwoPageRight"   // two pages at a time, odd pages on the right
+)
+
+// ReadingDirection is the predominant reading order of the text of the document.
+type ReadingDirection string
+
+// Reading directions.
+const (
+	ReadingDirectionL2R ReadingDirection = "L2R" // left to right
+	ReadingDirectionR2L ReadingDirection = "R2L" // right to left, including vertical writing systems
+)
+
+// PrintScaling is the page scaling option of the print dialog.
+type PrintScaling string
+
+// Print scaling options.
+const (
+	PrintScalingNone       PrintScaling = "None"       // no page scaling
+	PrintScalingAppDefault PrintScaling = "AppDefault" // default scaling of the viewer
+)
+
+// Duplex is the paper handling option of the print dialog.
+type Duplex string
+
+// Paper handling options.
+const (
+	DuplexSimplex       Duplex = "Simplex"             // print single-sided
+	DuplexFlipShortEdge Duplex = "DuplexFlipShortEdge" // duplex, flip on the short edge
+	DuplexFlipLongEdge  Duplex = "DuplexFlipLongEdge"  // duplex, flip on the long edge
+)
+
+// ViewerPreferences represents a viewer preferences dictionary (section 12.2 of the PDF 1.7
+// standard), which controls the way the document is presented on the screen or in print.
+// Zero values are not written, so that the viewer defaults apply.
+type ViewerPreferences struct {
+	HideToolbar     bool
+	HideMenubar     bool
+	HideWindowUI    bool
+	FitWindow       bool
+	CenterWindow    bool
+	DisplayDocTitle bool // display the document title (info dictionary) in the window title bar
+
+	// NonFullScreenPageMode is the page mode used when exiting full-screen mode.
+	NonFullScreenPageMode PageMode
+	Direction             ReadingDirection
+
+	// Page boundaries (e.g. CropBox) used for viewing and printing.
+	ViewArea  string
+	ViewClip  string
+	PrintArea string
+	PrintClip string
+
+	PrintScaling      PrintScaling
+	Duplex            Duplex
+	PickTrayByPDFSize *bool
+
+	// PrintPageRange holds the ranges of pages (first and last page number, starting at 1)
+	// selected in the print dialog.
+	PrintPageRange [][2]int
+	NumCopies      int
+}
+
+// NewViewerPreferencesFromObject loads a viewer preferences dictionary from `obj`. Entries of
+// invalid types are ignored.
+func NewViewerPreferencesFromObject(obj core.PdfObject) (*ViewerPreferences, error) {
+	dict, ok := core.GetDict(obj)
+	if !ok {
+		return nil, fmt.Errorf("invalid viewer preferences type: %T", obj)
+	}
+
+	getBool := func(key core.PdfObjectName) bool {
+		val, _ := core.GetBoolVal(dict.Get(key))
+		return val
+	}
+	getName := func(key core.PdfObjectName) string {
+		name, _ := core.GetNameVal(dict.Get(key))
+		return name
+	}
+
+	prefs := &ViewerPreferences{
+		HideToolbar:           getBool("HideToolbar"),
+		HideMenubar:           getBool("HideMenubar"),
+		HideWindowUI:          getBool("HideWindowUI"),
+		FitWindow:             getBool("FitWindow"),
+		CenterWindow:          getBool("CenterWindow"),
+		DisplayDocTitle:       getBool("DisplayDocTitle"),
+		NonFullScreenPageMode: PageMode(getName("NonFullScreenPageMode")),
+		Direction:             ReadingDirection(getName("Direction")),
+		ViewArea:              getName("ViewArea"),
+		ViewClip:              getName("ViewClip"),
+		PrintArea:             getName("PrintArea"),
+		PrintClip:             getName("PrintClip"),
+		PrintScaling:          PrintScaling(getName("PrintScaling")),
+		Duplex:                Duplex(getName("Duplex")),
+	}
+	if val, ok := core.GetBoolVal(dict.Get("PickTrayByPDFSize")); ok {
+		prefs.PickTrayByPDFSize = &val
+	}
+	if arr, ok := core.GetArray(dict.Get("PrintPageRange")); ok {
+		ints, err := arr.ToIntegerArray()
+		if err != nil || len(ints)%2 != 0 {
+			common.Log.Debug("Invalid PrintPageRange %v - ignoring", arr)
+		} else {
+			for i := 0; i < len(ints); i += 2 {
+				prefs.PrintPageRange = append(prefs.PrintPageRange, [2]int{ints[i], ints[i+1]})
+			}
+		}
+	}
+	if val, ok := core.GetIntVal(dict.Get("NumCopies")); ok {
+		prefs.NumCopies = val
+	}
+	return prefs, nil
+}
+
+// ToPdfObject returns the viewer preferences dictionary.
+func (vp *ViewerPreferences) ToPdfObject() core.PdfObject {
+	dict := core.MakeDict()
+	setBool := func(key core.PdfObjectName, val bool) {
+		if val {
+			dict.Set(key, core.MakeBool(true))
+		}
+	}
+	setName := func(key core.PdfObjectName, val string) {
+		if val != "" {
+			dict.Set(key, core.MakeName(val))
+		}
+	}
+
+	setBool("HideToolbar", vp.HideToolbar)
+	setBool("HideMenubar", vp.HideMenubar)
+	setBool("HideWindowUI", vp.HideWindowUI)
+	setBool("FitWindow", vp.FitWindow)
+	setBool("CenterWindow", vp.CenterWindow)
+	setBool("DisplayDocTitle", vp.DisplayDocTitle)
+	setName("NonFullScreenPageMode", string(vp.NonFullScreenPageMode))
+	setName("Direction", string(vp.Direction))
+	setName("ViewArea", vp.ViewArea)
+	setName("ViewClip", vp.ViewClip)
+	setName("PrintArea", vp.PrintArea)
+	setName("PrintClip", vp.PrintClip)
+	setName("PrintScaling", string(vp.PrintScaling))
+	setName("Duplex", string(vp.Duplex))
+	if vp.PickTrayByPDFSize != nil {
+		dict.Set("PickTrayByPDFSize", core.MakeBool(*vp.PickTrayByPDFSize))
+	}
+	if len(vp.PrintPageRange) > 0 {
+		arr := core.MakeArray()
+		for _, r := range vp.PrintPageRange {
+			arr.Append(core.MakeInteger(int64(r[0])), core.MakeInteger(int64(r[1])))
+		}
+		dict.Set("PrintPageRange", arr)
+	}
+	if vp.NumCopies > 0 {
+		dict.Set("NumCopies", core.MakeInteger(int64(vp.NumCopies)))
+	}
+	return dict
+}
+
+// GetPageMode returns the page mode of the document (PageModeUseNone if not specified).
+func (r *PdfReader) GetPageMode() PageMode {
+	if name, ok := core.GetNameVal(r.catalog.Get("PageMode")); ok {
+		return PageMode(name)
+	}
+	return PageModeUseNone
+}
+
+// GetPageLayout returns the page layout of the document (PageLayoutSinglePage if not
+// specified).
+func (r *PdfReader) GetPageLayout() PageLayout {
+	if name, ok := core.GetNameVal(r.catalog.Get("PageLayout")); ok {
+		return PageLayout(name)
+	}
+	return PageLayoutSinglePage
+}
+
+// GetViewerPreferences returns the viewer preferences of the document, or nil if the document
+// has none.
+func (r *PdfReader) GetViewerPreferences() (*ViewerPreferences, error) {
+	obj := r.catalog.Get("ViewerPreferences")
+	if obj == nil {
+		return nil, nil
+	}
+	return NewViewerPreferencesFromObject(obj)
+}
+
+// SetPageMode sets the page mode of the output document, e.g. PageModeUseOutlines to show the
+// outline panel when the document is opened.
+func (w *PdfWriter) SetPageMode(mode PageMode) {
+	w.catalog.Set("PageMode", core.MakeName(string(mode)))
+}
+
+// SetPageLayout sets the page layout of the output document.
+func (w *PdfWriter) SetPageLayout(layout PageLayout) {
+	w.catalog.Set("PageLayout", core.MakeName(string(layout)))
+}
+
+// SetViewerPreferences sets the viewer preferences of the output document.
+func (w *PdfWriter) SetViewerPreferences(prefs *ViewerPreferences) {
+	w.catalog.Set("ViewerPreferences", prefs.ToPdfObject())
+}
+
+// SetOpenAction sets the action performed when the output document is opened.
+func (w *PdfWriter) SetOpenAction(action *PdfAction) error {
+	obj := action.ToPdfObject()
+	w.catalog.Set("OpenAction", obj)
+	w.openDest = nil
+	return w.addObjects(obj)
+}
+
+// SetOpenDestination sets the destination displayed when the output document is opened. The
+// page of `dest` is a page added to the writer or a zero-based page index (see
+// AddNamedDestination).
+func (w *PdfWriter) SetOpenDestination(dest *PdfDestination) error {
+	if _, ok := destinationParams[dest.Type]; !ok {
+		return fmt.Errorf("invalid destination type: %s", dest.Type)
+	}
+	w.openDest = dest
+	return nil
+}
+
+// writeOpenDestination sets the open destination of the writer as the catalog OpenAction.
+func (w *PdfWriter) writeOpenDestination() error {
+	dest, err := w.resolveDestinationPage(w.openDest)
+	if err != nil {
+		return err
+	}
+	w.catalog.Set("OpenAction", dest.ToPdfObject())
+	return nil
+}
+
+// resolveDestinationPage returns a copy of `dest` where a page index is replaced by the page
+// object of the writer.
+func (w *PdfWriter) resolveDestinationPage(dest *PdfDestination) (*PdfDestination, error) {
+	resolved := *dest
+	idx, ok := core.GetIntVal(dest.Page)
+	if !ok {
+		return &resolved, nil
+	}
+	pagesDict, ok := core.GetDict(w.pages)
+	if !ok {
+		return nil, errors.New("invalid Pages obj (not a dict)")
+	}
+	kids, ok := core.GetArray(pagesDict.Get("Kids"))
+	if !ok {
+		return nil, errors.New("invalid Pages Kids obj (not an array)")
+	}
+	if idx < 0 || idx >= kids.Len() {
+		return nil, fmt.Errorf("page index %d out of range", idx)
+	}
+	resolved.Page = kids.Get(idx)
+	return &resolved, nil
+}
+
+// SetPageMode sets the page mode of the updated document.
+func (a *PdfAppender) SetPageMode(mode PageMode) {
+	a.pageMode = mode
+}
+
+// SetPageLayout sets the page layout of the updated document.
+func (a *PdfAppender) SetPageLayout(layout PageLayout) {
+	a.pageLayout = layout
+}
+
+// SetViewerPreferences sets the viewer preferences of the updated document, replacing the
+// existing ones.
+func (a *PdfAppender) SetViewerPreferences(prefs *ViewerPreferences) {
+	a.viewerPrefs = prefs
+}
+
+// SetOpenAction sets the action performed when the updated document is opened.
+func (a *PdfAppender) SetOpenAction(action *PdfAction) {
+	a.openAction = action.ToPdfObject()
+}
+
+// SetOpenDestination sets the destination displayed when the updated document is opened. The
+// page of `dest` is a page of the appender or a zero-based page index.
+func (a *PdfAppender) SetOpenDestination(dest *PdfDestination) error {
+	if _, ok := destinationParams[dest.Type]; !ok {
+		return fmt.Errorf("invalid destination type: %s", dest.Type)
+	}
+	resolved := *dest
+	if idx, ok := core.GetIntVal(dest.Page); ok {
+		if idx < 0 || idx >= len(a.pages) {
+			return fmt.Errorf("page index %d out of range", idx)
+		}
+		resolved.Page = a.pages[idx].GetPageAsIndirectObject()
+	}
+	a.openAction = resolved.ToPdfObject()
+	return nil
+}
+
+// updatesCatalog returns true if the appender changes entries of the document catalog.
+func (a *PdfAppender) updatesCatalog() bool {
+	return a.info != nil || a.xmp != nil || a.pageLabels != nil || a.pageMode != "" ||
+		a.pageLayout != "" || a.viewerPrefs != nil || a.openAction != nil || len(a.attachmentOps) > 0
+}
+
+// applyViewerSettings applies the viewer settings of the appender to `writer`.
+func (a *PdfAppender) applyViewerSettings(writer *PdfWriter) {
+	if a.pageMode != "" {
+		writer.SetPageMode(a.pageMode)
+	}
+	if a.pageLayout != "" {
+		writer.SetPageLayout(a.pageLayout)
+	}
+	if a.viewerPrefs != nil {
+		writer.SetViewerPreferences(a.viewerPrefs)
+	}
+	if a.openAction != nil {
+		// Objects of the original document (e.g. destination pages) are not written again.
+		writer.catalog.Set("OpenAction", a.openAction)
+		a.addNewObjects(a.openAction)
+	}
+}
@@ -0,0 +1,118 @@
+package model
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/finalversus/doc/pdf/core"
+)
+
+func TestViewerPreferencesFromObject(t *testing.T) {
+	pickTray := false
+	prefs := &ViewerPreferences{
+		HideToolbar:           true,
+		DisplayDocTitle:       true,
+		NonFullScreenPageMode: PageModeUseOutlines,
+		Direction:             ReadingDirectionR2L,
+		PrintArea:             "CropBox",
+		PrintScaling:          PrintScalingNone,
+		Duplex:                DuplexFlipLongEdge,
+		PickTrayByPDFSize:     &pickTray,
+		PrintPageRange:        [][2]int{{1, 2}, {5, 5}},
+		NumCopies:             3,
+	}
+	obj := prefs.ToPdfObject()
+	require.Equal(t, "<</HideToolbar true/DisplayDocTitle true/NonFullScreenPageMode /UseOutlines"+
+		"/Direction /R2L/PrintArea /CropBox/PrintScaling /None/Duplex /DuplexFlipLongEdge"+
+		"/PickTrayByPDFSize false/PrintPageRange [1 2 5 5]/NumCopies 3>>", obj.WriteString())
+
+	readPrefs, err := NewViewerPreferencesFromObject(obj)
+	require.NoError(t, err)
+	require.Equal(t, prefs, readPrefs)
+
+	// Invalid entries are ignored.
+	dict := core.MakeDict()
+	dict.Set("FitWindow", core.MakeName("true"))
+	dict.Set("PrintPageRange", core.MakeArray(core.MakeInteger(1)))
+	readPrefs, err = NewViewerPreferencesFromObject(dict)
+	require.NoError(t, err)
+	require.Equal(t, &ViewerPreferences{}, readPrefs)
+
+	_, err = NewViewerPreferencesFromObject(core.MakeArray())
+	require.Error(t, err)
+}
+
+func TestViewerSettingsReadWrite(t *testing.T) {
+	w := NewPdfWriter()
+	w.SetPageMode(PageModeUseOutlines)
+	w.SetPageLayout(PageLayoutTwoPageRight)
+	w.SetViewerPreferences(&ViewerPreferences{FitWindow: true})
+	dest, err := NewPdfDestination(core.MakeInteger(1), DestinationFitH, 50)
+	require.NoError(t, err)
+	require.NoError(t, w.SetOpenDestination(dest))
+	page := NewPdfPage()
+	page.MediaBox = &PdfRectangle{Urx: 100, Ury: 100}
+	require.NoError(t, w.AddPage(page))
+	reader := writeTestDocument(t, &w)
+
+	require.Equal(t, PageModeUseOutlines, reader.GetPageMode())
+	require.Equal(t, PageLayoutTwoPageRight, reader.GetPageLayout())
+	prefs, err := reader.GetViewerPreferences()
+	require.NoError(t, err)
+	require.Equal(t, &ViewerPreferences{FitWindow: true}, prefs)
+	action, err := reader.GetOpenAction()
+	require.NoError(t, err)
+	goTo, ok := action.GetContext().(*PdfActionGoTo)
+	require.True(t, ok)
+	openDest, err := reader.ResolveDestination(goTo.D)
+	require.NoError(t, err)
+	pageNum, err := reader.GetDestinationPageNumber(openDest)
+	require.NoError(t, err)
+	require.Equal(t, 2, pageNum)
+
+	// Update the settings with an incremental update.
+	appender, err := NewPdfAppender(reader)
+	require.NoError(t, err)
+	appender.SetPageMode(PageModeUseThumbs)
+	appender.SetViewerPreferences(&ViewerPreferences{DisplayDocTitle: true})
+	dest, err = NewPdfDestination(core.MakeInteger(0), DestinationFit)
+	require.NoError(t, err)
+	require.NoError(t, appender.SetOpenDestination(dest))
+	dest.Page = core.MakeInteger(2)
+	require.Error(t, appender.SetOpenDestination(dest))
+	var buf bytes.Buffer
+	require.NoError(t, appender.Write(&buf))
+
+	reader, err = NewPdfReader(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, PageModeUseThumbs, reader.GetPageMode())
+	require.Equal(t, PageLayoutTwoPageRight, reader.GetPageLayout())
+	prefs, err = reader.GetViewerPreferences()
+	require.NoError(t, err)
+	require.Equal(t, &ViewerPreferences{DisplayDocTitle: true}, prefs)
+	action, err = reader.GetOpenAction()
+	require.NoError(t, err)
+	openDest, err = reader.ResolveDestination(action.GetContext().(*PdfActionGoTo).D)
+	require.NoError(t, err)
+	pageNum, err = reader.GetDestinationPageNumber(openDest)
+	require.NoError(t, err)
+	require.Equal(t, 1, pageNum)
+
+	// Defaults of documents without viewer settings.
+	f, err := os.Open("testdata/minimal.pdf")
+	require.NoError(t, err)
+	defer f.Close()
+	reader, err = NewPdfReader(f)
+	require.NoError(t, err)
+	require.Equal(t, PageModeUseNone, reader.GetPageMode())
+	require.Equal(t, PageLayoutSinglePage, reader.GetPageLayout())
+	prefs, err = reader.GetViewerPreferences()
+	require.NoError(t, err)
+	require.Nil(t, prefs)
+	action, err = reader.GetOpenAction()
+	require.NoError(t, err)
+	require.Nil(t, action)
+}
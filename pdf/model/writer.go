@@ -6,9 +6,12 @@ package model
 import (
 	"bufio"
 	"bytes"
+	"crypto/md5"
+	"crypto/x509"
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"strings"
 	"time"
@@ -17,6 +20,7 @@ import (
 	"github.com/finalversus/doc/pdf/core"
 	"github.com/finalversus/doc/pdf/core/security"
 	"github.com/finalversus/doc/pdf/core/security/crypt"
+	"github.com/finalversus/doc/pdf/model/xmp"
 )
 
 var pdfAuthor = ""
@@ -56,6 +60,10 @@ func SetPdfCreationDate(creationDate time.Time) {
 	pdfCreationDate = creationDate
 }
 
+func getPdfCreator() string {
+	return pdfCreator
+}
+
 // SetPdfCreator sets the Creator attribute of the output PDF.
 func SetPdfCreator(creator string) {
 	pdfCreator = creator
@@ -76,7 +84,11 @@ func getPdfModifiedDate() time.Time {
 
 // SetPdfModifiedDate sets the ModDate attribute of the output PDF.
 func SetPdfModifiedDate(modifiedDate time.Time) {
-	pdfCreationDate = modifiedDate
+	pdfModifiedDate = modifiedDate
+}
+
+func getPdfProducer() string {
+	return pdfProducer
 }
 
 // SetPdfProducer sets the Producer attribute of the output PDF.
@@ -116,6 +128,22 @@ type PdfWriter struct {
 	fields      []core.PdfObject
 	infoObj     *core.PdfIndirectObject
 
+	// XMP metadata (see SetXMP).
+	xmp *xmp.Document
+
+	// Named destinations (see AddNamedDestination) and name trees of the catalog Names dictionary.
+	namedDests map[string]*PdfDestination
+	nameTrees  map[core.PdfObjectName]*PdfNameTree
+
+	// Destination displayed when the document is opened (see SetOpenDestination).
+	openDest *PdfDestination
+
+	// Document-level attachments (see AddAttachment).
+	attachments []*PdfFileSpec
+
+	// Structure tree of tagged documents (see SetStructTreeRoot).
+	structTreeRoot *PdfStructTreeRoot
+
 	// Encryption
 	crypter     *core.PdfCrypt
 	encryptDict *core.PdfObjectDictionary
@@ -143,6 +171,12 @@ type PdfWriter struct {
 	appendMode        bool
 	appendToXrefs     core.XrefTable
 
+	// Linearized output (see SetLinearized).
+	linearized bool
+
+	// Deterministic output options (see SetDeterministic).
+	deterministic *DeterministicOpts
+
 	// Cache of objects traversed while resolving references.
 	traversed map[core.PdfObject]struct{}
 }
@@ -171,10 +205,12 @@ func NewPdfWriter() PdfWriter {
 		{"Subject", getPdfSubject()},
 		{"Title", getPdfTitle()},
 		{"Keywords", getPdfKeywords()},
+		{"Creator", getPdfCreator()},
+		{"Producer", getPdfProducer()},
 	}
 	for _, tuple := range metadata {
 		if tuple.value != "" {
-			infoDict.Set(tuple.key, core.MakeString(tuple.value))
+			infoDict.Set(tuple.key, NewPdfInfoText(tuple.value))
 		}
 	}
 
@@ -249,10 +285,8 @@ func copyObject(obj core.PdfObject, objectToObjectCopyMap map[core.PdfObject]cor
 		}
 		return newObj
 	case *core.PdfObjectStream:
-		newObj := &core.PdfObjectStream{
-			Stream:             t.Stream,
-			PdfObjectReference: t.PdfObjectReference,
-		}
+		newObj := &core.PdfObjectStream{}
+		*newObj = *t
 		objectToObjectCopyMap[obj] = newObj
 		newObj.PdfObjectDictionary = copyObject(t.PdfObjectDictionary, objectToObjectCopyMap).(*core.PdfObjectDictionary)
 		return newObj
@@ -628,7 +662,7 @@ func (w *PdfWriter) SetForms(form *PdfAcroForm) error {
 }
 
 // writeObject writes out an indirect / stream object.
-func (w *PdfWriter) writeObject(num int, obj core.PdfObject) {
+func (w *PdfWriter) writeObject(num int, obj core.PdfObject) error {
 	common.Log.Trace("Write obj #%d\n", num)
 
 	if pobj, isIndirect := obj.(*core.PdfIndirectObject); isIndirect {
@@ -644,7 +678,7 @@ func (w *PdfWriter) writeObject(num int, obj core.PdfObject) {
 		outStr += pobj.PdfObject.WriteString()
 		outStr += "\nendobj\n"
 		w.writeString(outStr)
-		return
+		return nil
 	}
 
 	// TODO: Add a default encoder if Filter not specified?
@@ -655,9 +689,14 @@ func (w *PdfWriter) writeObject(num int, obj core.PdfObject) {
 		outStr += pobj.PdfObjectDictionary.WriteString()
 		outStr += "\nstream\n"
 		w.writeString(outStr)
-		w.writeBytes(pobj.Stream)
+		n, err := core.WriteStream(w.writer, pobj)
+		w.writePos += n
+		if err != nil {
+			common.Log.Debug("ERROR: Failed writing stream data (%s)", err)
+			return err
+		}
 		w.writeString("\nendstream\nendobj\n")
-		return
+		return nil
 	}
 
 	if ostreams, isObjStreams := obj.(*core.PdfObjectStreams); isObjStreams {
@@ -697,10 +736,11 @@ func (w *PdfWriter) writeObject(num int, obj core.PdfObject) {
 		w.writeString(outStr)
 		w.writeBytes(data)
 		w.writeString("\nendstream\nendobj\n")
-		return
+		return nil
 	}
 
 	w.writer.WriteString(obj.WriteString())
+	return nil
 }
 
 // Update all the object numbers prior to writing.
@@ -724,8 +764,31 @@ func (w *PdfWriter) updateObjectNumbers() {
 
 // EncryptOptions represents encryption options for an output PDF.
 type EncryptOptions struct {
-	Permissions core.AccessPermissions
+	Permissions security.Permissions
 	Algorithm   EncryptionAlgorithm
+
+	// UnencryptedMetadata leaves the document metadata streams (XMP) unencrypted, so that they can be
+	// indexed without decrypting the document. Requires one of the AES algorithms.
+	UnencryptedMetadata bool
+
+	// AttachmentsOnly restricts encryption to embedded file streams (attachments). Strings and all
+	// other streams are left unencrypted (Identity crypt filter) and the embedded file crypt filter
+	// (EFF) is used for the attachments. Requires one of the AES algorithms.
+	AttachmentsOnly bool
+
+	// Recipients lists the recipients of a document encrypted with the public-key security handler
+	// (Adobe.PubSec). When set, the document can only be opened with the private key of one of the
+	// recipient certificates and the user/owner passwords are ignored.
+	Recipients []EncryptRecipient
+}
+
+// EncryptRecipient is a recipient of a document encrypted with the public-key security handler.
+type EncryptRecipient struct {
+	// Certificate is the X.509 certificate of the recipient. Only RSA keys are supported.
+	Certificate *x509.Certificate
+
+	// Permissions are the access permissions granted to the recipient.
+	Permissions security.Permissions
 }
 
 // EncryptionAlgorithm is used in EncryptOptions to change the default algorithm used to encrypt the document.
@@ -741,6 +804,9 @@ const (
 )
 
 // Encrypt encrypts the output file with a specified user/owner password.
+// If `options` specifies Recipients, the output file is encrypted for the recipient certificates
+// with the public-key security handler instead. RC4_128bit uses the adbe.pkcs7.s4 SubFilter, while
+// the AES algorithms use crypt filters (adbe.pkcs7.s5).
 func (w *PdfWriter) Encrypt(userPass, ownerPass []byte, options *EncryptOptions) error {
 	algo := RC4_128bit
 	if options != nil {
@@ -762,7 +828,26 @@ func (w *PdfWriter) Encrypt(userPass, ownerPass []byte, options *EncryptOptions)
 	default:
 		return fmt.Errorf("unsupported algorithm: %v", options.Algorithm)
 	}
-	crypter, info, err := core.PdfCryptNewEncrypt(cf, userPass, ownerPass, perm)
+	var opts *core.CryptOpts
+	if options != nil {
+		opts = &core.CryptOpts{
+			UnencryptedMetadata: options.UnencryptedMetadata,
+			EmbeddedFilesOnly:   options.AttachmentsOnly,
+		}
+	}
+
+	var crypter *core.PdfCrypt
+	var info *core.EncryptInfo
+	var err error
+	if options != nil && len(options.Recipients) > 0 {
+		recipients := make([]security.PubKeyRecipient, len(options.Recipients))
+		for i, r := range options.Recipients {
+			recipients[i] = security.PubKeyRecipient{Certificate: r.Certificate, Permissions: r.Permissions}
+		}
+		crypter, info, err = core.PdfCryptNewEncryptPubKey(cf, recipients, opts)
+	} else {
+		crypter, info, err = core.PdfCryptNewEncryptOpts(cf, userPass, ownerPass, perm, opts)
+	}
 	if err != nil {
 		return err
 	}
@@ -830,6 +915,47 @@ func (w *PdfWriter) Write(writer io.Writer) error {
 		}
 	}
 
+	// Logical structure.
+	if w.structTreeRoot != nil {
+		if err := w.writeStructTreeRoot(); err != nil {
+			return err
+		}
+	}
+
+	// Named destinations and name trees.
+	if len(w.namedDests) > 0 {
+		if err := w.writeNamedDestinations(); err != nil {
+			return err
+		}
+	}
+	if len(w.attachments) > 0 {
+		if err := w.writeAttachments(); err != nil {
+			return err
+		}
+	}
+	if len(w.nameTrees) > 0 {
+		if err := w.writeNames(); err != nil {
+			return err
+		}
+	}
+	if w.openDest != nil {
+		if err := w.writeOpenDestination(); err != nil {
+			return err
+		}
+	}
+
+	// In deterministic mode, the dates are set before the XMP metadata is synchronized with them.
+	if w.deterministic != nil {
+		w.setDeterministicDates()
+	}
+
+	// XMP metadata.
+	if w.xmp != nil {
+		if err := w.writeXMP(); err != nil {
+			return err
+		}
+	}
+
 	// Check pending objects prior to write.
 	for pendingObj, pendingObjDicts := range w.pendingObjects {
 		if !w.hasObject(pendingObj) {
@@ -854,6 +980,18 @@ func (w *PdfWriter) Write(writer io.Writer) error {
 	//       Is copy needed for optimization?
 	w.copyObjects()
 
+	// Streams made from readers are encoded while being written, unless their data is needed
+	// beforehand by the optimizer, the encryption or the linearized layout.
+	if w.optimizer != nil || w.crypter != nil || w.linearized {
+		for _, obj := range w.objects {
+			if stream, ok := obj.(*core.PdfObjectStream); ok {
+				if err := core.LoadStream(stream); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
 	if w.optimizer != nil {
 		var err error
 		w.objects, err = w.optimizer.Optimize(w.objects)
@@ -867,6 +1005,25 @@ func (w *PdfWriter) Write(writer io.Writer) error {
 		w.objectsMap = objMap
 	}
 
+	if w.deterministic != nil {
+		w.prepareDeterministic()
+	}
+
+	if w.linearized {
+		if w.appendMode {
+			return errors.New("linearized output not supported for incremental updates")
+		}
+		return w.writeLinearized(writer)
+	}
+
+	// In deterministic mode, the file identifier is derived from the content preceding the
+	// cross-reference section, unless specified.
+	var idHash hash.Hash
+	if w.deterministic != nil && w.ids == nil {
+		idHash = md5.New()
+		writer = io.MultiWriter(writer, idHash)
+	}
+
 	w.writePos = w.writeOffset
 	w.writer = bufio.NewWriter(writer)
 	useCrossReferenceStream := w.majorVersion > 1 || (w.majorVersion == 1 && w.minorVersion > 4)
@@ -936,10 +1093,16 @@ func (w *PdfWriter) Write(writer io.Writer) error {
 				return err
 			}
 		}
-		w.writeObject(int(objectNumber), obj)
+		if err := w.writeObject(int(objectNumber), obj); err != nil {
+			return err
+		}
 	}
 
 	xrefOffset := w.writePos
+	if idHash != nil {
+		w.writer.Flush()
+		w.setFileID(idHash.Sum(nil))
+	}
 	var maxIndex int
 	for idx := range w.crossReferenceMap {
 		if idx > maxIndex {
@@ -982,11 +1145,15 @@ func (w *PdfWriter) Write(writer io.Writer) error {
 		// If encrypted!
 		if w.crypter != nil {
 			crossReferenceStream.Set("Encrypt", w.encryptObj)
+		}
+		if w.ids != nil {
 			crossReferenceStream.Set("ID", w.ids)
 			common.Log.Trace("Ids: %s", w.ids)
 		}
 
-		w.writeObject(int(crossReferenceStream.ObjectNumber), crossReferenceStream)
+		if err := w.writeObject(int(crossReferenceStream.ObjectNumber), crossReferenceStream); err != nil {
+			return err
+		}
 
 	} else {
 		w.writeString("xref\r\n")
@@ -1012,6 +1179,8 @@ func (w *PdfWriter) Write(writer io.Writer) error {
 		// If encrypted!
 		if w.crypter != nil {
 			trailer.Set("Encrypt", w.encryptObj)
+		}
+		if w.ids != nil {
 			trailer.Set("ID", w.ids)
 			common.Log.Trace("Ids: %s", w.ids)
 		}
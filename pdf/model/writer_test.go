@@ -4,12 +4,23 @@ package model
 
 import (
 	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
 	"github.com/finalversus/doc/pdf/core"
+	"github.com/finalversus/doc/pdf/core/security"
 )
 
 // Tests loading annotations from file, writing back out and reloading.
@@ -97,3 +108,372 @@ func TestReadWriteAnnotations(t *testing.T) {
 		checkAnnots(reader, false)
 	}
 }
+
+// Tests encrypting output for certificate recipients with the public-key security handler and
+// decrypting it with the recipient private keys.
+func TestEncryptPubKey(t *testing.T) {
+	cert1, key1 := makeTestCertificate(t, "recipient 1")
+	cert2, key2 := makeTestCertificate(t, "recipient 2")
+	cert3, key3 := makeTestCertificate(t, "other")
+
+	perm1 := security.PermOwner
+	perm2 := security.PermPrinting | security.PermFillForms
+
+	for _, algo := range []EncryptionAlgorithm{RC4_128bit, AES_128bit, AES_256bit} {
+		f, err := os.Open(`./testdata/minimal.pdf`)
+		require.NoError(t, err)
+		defer f.Close()
+
+		reader, err := NewPdfReader(f)
+		require.NoError(t, err)
+		page, err := reader.GetPage(1)
+		require.NoError(t, err)
+		expected, err := page.GetAllContentStreams()
+		require.NoError(t, err)
+
+		writer := NewPdfWriter()
+		require.NoError(t, writer.AddPage(page))
+		err = writer.Encrypt(nil, nil, &EncryptOptions{
+			Algorithm: algo,
+			Recipients: []EncryptRecipient{
+				{Certificate: cert1, Permissions: perm1},
+				{Certificate: cert2, Permissions: perm2},
+			},
+		})
+		require.NoError(t, err)
+
+		var buf bytes.Buffer
+		require.NoError(t, writer.Write(&buf))
+
+		open := func() *PdfReader {
+			reader, err := NewPdfReader(bytes.NewReader(buf.Bytes()))
+			require.NoError(t, err)
+			isEncrypted, err := reader.IsEncrypted()
+			require.NoError(t, err)
+			require.True(t, isEncrypted)
+			return reader
+		}
+
+		reader = open()
+		ok, err := reader.Decrypt([]byte(""))
+		require.NoError(t, err)
+		require.False(t, ok)
+		ok, err = reader.DecryptWithCertificate(cert3, key3)
+		require.NoError(t, err)
+		require.False(t, ok)
+
+		for _, r := range []struct {
+			cert *x509.Certificate
+			key  *rsa.PrivateKey
+			perm security.Permissions
+		}{{cert1, key1, perm1}, {cert2, key2, perm2}} {
+			reader := open()
+			ok, err := reader.DecryptWithCertificate(r.cert, r.key)
+			require.NoError(t, err)
+			require.True(t, ok, "algorithm %d", algo)
+			require.Equal(t, r.perm, reader.parser.GetCrypter().GetAccessPermissions())
+
+			page, err := reader.GetPage(1)
+			require.NoError(t, err)
+			content, err := page.GetAllContentStreams()
+			require.NoError(t, err)
+			require.Equal(t, expected, content)
+		}
+	}
+}
+
+// makeTestCertificate generates a self-signed certificate with an RSA key for testing.
+func makeTestCertificate(t *testing.T, name string) (*x509.Certificate, *rsa.PrivateKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageKeyEncipherment | x509.KeyUsageDataEncipherment,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert, key
+}
+
+// Tests that metadata streams are left unencrypted when requested in the encryption options.
+func TestEncryptUnencryptedMetadata(t *testing.T) {
+	const xmp = `<x:xmpmeta xmlns:x="adobe:ns:meta/"></x:xmpmeta>`
+
+	for _, algo := range []EncryptionAlgorithm{AES_128bit, AES_256bit} {
+		f, err := os.Open(`./testdata/minimal.pdf`)
+		require.NoError(t, err)
+		defer f.Close()
+
+		reader, err := NewPdfReader(f)
+		require.NoError(t, err)
+		page, err := reader.GetPage(1)
+		require.NoError(t, err)
+
+		metadata, err := core.MakeStream([]byte(xmp), nil)
+		require.NoError(t, err)
+		metadata.Set("Type", core.MakeName("Metadata"))
+		metadata.Set("Subtype", core.MakeName("XML"))
+		page.Metadata = metadata
+
+		writer := NewPdfWriter()
+		require.NoError(t, writer.AddPage(page))
+		err = writer.Encrypt([]byte("user"), []byte("owner"), &EncryptOptions{
+			Permissions:         security.PermOwner,
+			Algorithm:           algo,
+			UnencryptedMetadata: true,
+		})
+		require.NoError(t, err)
+
+		var buf bytes.Buffer
+		require.NoError(t, writer.Write(&buf))
+		require.Contains(t, buf.String(), xmp)
+		require.NotContains(t, buf.String(), "Hello World")
+
+		reader, err = NewPdfReader(bytes.NewReader(buf.Bytes()))
+		require.NoError(t, err)
+		ok, err := reader.Decrypt([]byte("user"))
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		page, err = reader.GetPage(1)
+		require.NoError(t, err)
+		content, err := page.GetAllContentStreams()
+		require.NoError(t, err)
+		require.Contains(t, content, "Hello World")
+
+		stream, ok := core.GetStream(page.Metadata)
+		require.True(t, ok)
+		require.Equal(t, xmp, string(stream.Stream))
+	}
+
+	writer := NewPdfWriter()
+	err := writer.Encrypt([]byte("user"), []byte("owner"), &EncryptOptions{
+		Algorithm:           RC4_128bit,
+		UnencryptedMetadata: true,
+	})
+	require.Error(t, err)
+}
+
+// Tests writing a linearized file and checks the linearization dictionary, the first-page
+// cross-reference section and the hint tables.
+func TestWriteLinearized(t *testing.T) {
+	helvetica, err := NewStandard14Font(HelveticaName)
+	require.NoError(t, err)
+	courier, err := NewStandard14Font(CourierName)
+	require.NoError(t, err)
+	helveticaObj := helvetica.ToPdfObject()
+	courierObj := courier.ToPdfObject()
+
+	// Page 1 uses Helvetica, pages 2 and 3 share Courier, page 4 uses Helvetica again.
+	fonts := []core.PdfObject{helveticaObj, courierObj, courierObj, helveticaObj}
+
+	w := NewPdfWriter()
+	for i, font := range fonts {
+		page := NewPdfPage()
+		page.MediaBox = &PdfRectangle{Urx: 200, Ury: 200}
+		require.NoError(t, page.Resources.SetFontByName("F1", font))
+		content := fmt.Sprintf("BT /F1 12 Tf 10 10 Td (Page %d) Tj ET", i+1)
+		require.NoError(t, page.SetContentStreams([]string{content}, core.NewFlateEncoder()))
+		require.NoError(t, w.AddPage(page))
+	}
+	w.SetLinearized(true)
+
+	var buf bytes.Buffer
+	require.NoError(t, w.Write(&buf))
+	data := buf.Bytes()
+
+	// The linearization dictionary is the first object in the file.
+	match := regexp.MustCompile(`^%PDF-\d\.\d\n[^\n]*\n(\d+) 0 obj`).FindSubmatch(data)
+	require.NotNil(t, match)
+	linNum, err := strconv.Atoi(string(match[1]))
+	require.NoError(t, err)
+
+	parser, err := core.NewParser(bytes.NewReader(data))
+	require.NoError(t, err)
+	linObj, err := parser.LookupByNumber(linNum)
+	require.NoError(t, err)
+	linDict, ok := core.GetDict(linObj)
+	require.True(t, ok)
+
+	intVal := func(key core.PdfObjectName) int {
+		val, ok := core.GetIntVal(linDict.Get(key))
+		require.True(t, ok, "missing %s", key)
+		return val
+	}
+	require.Equal(t, len(data), intVal("L"))
+	require.Equal(t, len(fonts), intVal("N"))
+
+	// Offset of an object in the file.
+	objOffset := func(num int) int {
+		idx := bytes.Index(data, []byte(fmt.Sprintf("\n%d 0 obj\n", num)))
+		require.True(t, idx > 0, "object %d not found", num)
+		return idx + 1
+	}
+
+	// The main xref table follows T.
+	T := intVal("T")
+	require.Equal(t, byte('\n'), data[T])
+	require.True(t, bytes.HasPrefix(data[T+1:], []byte("0000000000 65535 f")))
+
+	// The first page object and the objects it references precede E.
+	reader, err := NewPdfReader(bytes.NewReader(data))
+	require.NoError(t, err)
+	numPages, err := reader.GetNumPages()
+	require.NoError(t, err)
+	require.Equal(t, len(fonts), numPages)
+	page, err := reader.GetPage(1)
+	require.NoError(t, err)
+	pageObj := page.GetPageAsIndirectObject()
+	require.Equal(t, int(pageObj.ObjectNumber), intVal("O"))
+	E := intVal("E")
+	require.True(t, objOffset(intVal("O")) < E)
+	fontDict, ok := core.GetDict(page.Resources.Font)
+	require.True(t, ok)
+	fontObj, ok := core.GetIndirect(fontDict.Get("F1"))
+	require.True(t, ok)
+	require.True(t, objOffset(int(fontObj.ObjectNumber)) < E)
+
+	// Decode the hint tables.
+	H, ok := core.GetArray(linDict.Get("H"))
+	require.True(t, ok)
+	hintOffset, _ := core.GetIntVal(H.Get(0))
+	hintLength, _ := core.GetIntVal(H.Get(1))
+	match = regexp.MustCompile(`^(\d+) 0 obj`).FindSubmatch(data[hintOffset:])
+	require.NotNil(t, match)
+	hintNum, _ := strconv.Atoi(string(match[1]))
+	require.True(t, bytes.HasSuffix(data[:hintOffset+hintLength], []byte("endobj\n")))
+
+	hintObj, err := parser.LookupByNumber(hintNum)
+	require.NoError(t, err)
+	hintStream, ok := core.GetStream(hintObj)
+	require.True(t, ok)
+	hintData, err := core.DecodeStream(hintStream)
+	require.NoError(t, err)
+	sharedOffset, ok := core.GetIntVal(hintStream.Get("S"))
+	require.True(t, ok)
+	pageHints, sharedHints, err := core.DecodeHintTables(hintData, numPages, sharedOffset)
+	require.NoError(t, err)
+
+	// Hint table offsets do not include the hint stream.
+	require.Equal(t, int64(objOffset(intVal("O"))-hintLength), pageHints.FirstPageOffset)
+	require.Len(t, pageHints.Pages, numPages)
+	require.Equal(t, int64(E-objOffset(intVal("O"))), pageHints.Pages[0].Length)
+	require.Len(t, pageHints.Pages[0].SharedRefs, 0)
+
+	// Pages 2 and 3 reference the shared Courier font, page 4 the Helvetica font of the first page.
+	require.Equal(t, pageHints.Pages[0].NumObjects, sharedHints.NumFirstPage)
+	require.Len(t, sharedHints.Groups, sharedHints.NumFirstPage+1)
+	require.Equal(t, []int{sharedHints.NumFirstPage}, pageHints.Pages[1].SharedRefs)
+	require.Equal(t, []int{sharedHints.NumFirstPage}, pageHints.Pages[2].SharedRefs)
+	require.Len(t, pageHints.Pages[3].SharedRefs, 1)
+	require.True(t, pageHints.Pages[3].SharedRefs[0] < sharedHints.NumFirstPage)
+	require.Equal(t, int64(objOffset(sharedHints.FirstObjectNumber)-hintLength), sharedHints.FirstObjectOffset)
+
+	// Each of the remaining pages starts with its page object.
+	offset := objOffset(intVal("O"))
+	for i := 1; i < numPages; i++ {
+		page, err := reader.GetPage(i + 1)
+		require.NoError(t, err)
+		pageObj := page.GetPageAsIndirectObject()
+		pageOffset := objOffset(int(pageObj.ObjectNumber))
+		require.True(t, pageOffset > offset)
+		offset = pageOffset
+		require.Equal(t, 2, pageHints.Pages[i].NumObjects)
+		text, err := page.GetAllContentStreams()
+		require.NoError(t, err)
+		require.Contains(t, text, fmt.Sprintf("(Page %d)", i+1))
+	}
+}
+
+func TestWriteDeterministic(t *testing.T) {
+	creationDate := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	write := func(text string, opts *DeterministicOpts, linearized bool) []byte {
+		w := NewPdfWriter()
+		for i := 0; i < 2; i++ {
+			page := NewPdfPage()
+			page.MediaBox = &PdfRectangle{Urx: 200, Ury: 200}
+			require.NoError(t, page.SetContentStreams([]string{text}, core.NewFlateEncoder()))
+			require.NoError(t, w.AddPage(page))
+		}
+		w.SetDeterministic(opts)
+		w.SetLinearized(linearized)
+		var buf bytes.Buffer
+		require.NoError(t, w.Write(&buf))
+		return buf.Bytes()
+	}
+	fileID := func(data []byte) string {
+		match := regexp.MustCompile(`/ID \[<([0-9a-f]+)> <([0-9a-f]+)>\]`).FindSubmatch(data)
+		require.NotNil(t, match)
+		require.Equal(t, match[1], match[2])
+		return string(match[1])
+	}
+
+	for _, linearized := range []bool{false, true} {
+		opts := &DeterministicOpts{CreationDate: creationDate}
+		data := write("BT ET", opts, linearized)
+		require.Equal(t, data, write("BT ET", opts, linearized))
+
+		// The file identifier is derived from the content.
+		require.NotEqual(t, fileID(data), fileID(write("BT  ET", opts, linearized)))
+
+		// Dictionary keys are sorted and the creation date is set.
+		require.Regexp(t, `<</Pages \d+ 0 R/Type /Catalog/Version /1\.3>>`, string(data))
+		require.Contains(t, string(data), "/CreationDate (D:20200102030405+00'00')")
+
+		reader, err := NewPdfReader(bytes.NewReader(data))
+		require.NoError(t, err)
+		numPages, err := reader.GetNumPages()
+		require.NoError(t, err)
+		require.Equal(t, 2, numPages)
+	}
+
+	data := write("BT ET", &DeterministicOpts{ID: []byte{0xca, 0xfe}}, false)
+	require.Equal(t, "cafe", fileID(data))
+}
+
+func TestWriteStreamFromReader(t *testing.T) {
+	content := strings.Repeat("0 0 m 100 100 l S\n", 5000)
+	write := func(configure func(w *PdfWriter)) []byte {
+		stream, err := core.MakeStreamFromReader(strings.NewReader(content), core.NewFlateEncoder())
+		require.NoError(t, err)
+		page := NewPdfPage()
+		page.MediaBox = &PdfRectangle{Urx: 200, Ury: 200}
+		page.Contents = stream
+
+		w := NewPdfWriter()
+		require.NoError(t, w.AddPage(page))
+		configure(&w)
+		var buf bytes.Buffer
+		require.NoError(t, w.Write(&buf))
+		return buf.Bytes()
+	}
+
+	configs := []func(w *PdfWriter){
+		func(w *PdfWriter) {},
+		func(w *PdfWriter) { w.SetLinearized(true) },
+		func(w *PdfWriter) {
+			opts := &EncryptOptions{Permissions: security.PermOwner}
+			require.NoError(t, w.Encrypt([]byte("user"), []byte("owner"), opts))
+		},
+	}
+	for i, configure := range configs {
+		data := write(configure)
+		reader, err := NewPdfReader(bytes.NewReader(data))
+		require.NoError(t, err, "config %d", i)
+		if isEncrypted, _ := reader.IsEncrypted(); isEncrypted {
+			ok, err := reader.Decrypt([]byte("user"))
+			require.NoError(t, err)
+			require.True(t, ok)
+		}
+		page, err := reader.GetPage(1)
+		require.NoError(t, err, "config %d", i)
+		contents, err := page.GetAllContentStreams()
+		require.NoError(t, err, "config %d", i)
+		require.Equal(t, content, contents, "config %d", i)
+	}
+}
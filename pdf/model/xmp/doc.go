@@ -0,0 +1,8 @@
+// Package xmp provides support for reading, modifying and creating XMP metadata packets
+// (ISO 16684-1), as embedded in the metadata streams of PDF documents.
+//
+// Parse loads an RDF/XML packet into a Document, which gives typed access to the Dublin Core (dc),
+// XMP basic (xmp), Adobe PDF (pdf) and PDF/A identification (pdfaid) schemas. Other properties,
+// including those of custom namespaces, are kept as generic values in Document.Properties.
+// Document.Marshal serializes the document into a padded packet that can be updated in place.
+package xmp
@@ -0,0 +1,324 @@
+package xmp
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/finalversus/doc/common"
+)
+
+// node is an element of a parsed XML tree.
+type node struct {
+	name     xml.Name
+	attrs    []xml.Attr
+	children []*node
+	text     string
+}
+
+// is returns true if the element is `local` of namespace `ns`.
+func (n *node) is(ns, local string) bool {
+	return n.name.Space == ns && n.name.Local == local
+}
+
+// attr returns the value of attribute `local` of namespace `ns`.
+func (n *node) attr(ns, local string) (string, bool) {
+	for _, a := range n.attrs {
+		if a.Name.Space == ns && a.Name.Local == local {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+// propertyAttrs returns the attributes of the element which are properties (rdf:Description
+// shorthand), i.e. excluding namespace declarations and RDF and XML attributes.
+func (n *node) propertyAttrs() []xml.Attr {
+	var attrs []xml.Attr
+	for _, a := range n.attrs {
+		switch {
+		case a.Name.Space == "xmlns", a.Name.Space == "" && a.Name.Local == "xmlns":
+		case a.Name.Space == NamespaceRDF, a.Name.Space == NamespaceXML:
+		case a.Name.Space == "":
+			common.Log.Debug("XMP: unqualified attribute %s - ignoring", a.Name.Local)
+		default:
+			attrs = append(attrs, a)
+		}
+	}
+	return attrs
+}
+
+// parseTree parses the XML data `data`. It returns the root elements and the prefixes declared
+// for the namespaces.
+func parseTree(data []byte) ([]*node, map[string]string, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	prefixes := map[string]string{}
+	var roots, stack []*node
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &node{name: t.Name, attrs: t.Copy().Attr}
+			for _, a := range t.Attr {
+				if _, ok := prefixes[a.Value]; a.Name.Space == "xmlns" && !ok {
+					prefixes[a.Value] = a.Name.Local
+				}
+			}
+			if len(stack) == 0 {
+				roots = append(roots, n)
+			} else {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, n)
+			}
+			stack = append(stack, n)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text += string(t)
+			}
+		}
+	}
+	return roots, prefixes, nil
+}
+
+// findRDF returns the first rdf:RDF element of the trees `nodes`.
+func findRDF(nodes []*node) *node {
+	for _, n := range nodes {
+		if n.is(NamespaceRDF, "RDF") {
+			return n
+		}
+		if rdf := findRDF(n.children); rdf != nil {
+			return rdf
+		}
+	}
+	return nil
+}
+
+// Parse parses the XMP packet `data`. The packet wrapper is optional.
+func Parse(data []byte) (*Document, error) {
+	roots, prefixes, err := parseTree(data)
+	if err != nil {
+		return nil, err
+	}
+	rdf := findRDF(roots)
+	if rdf == nil {
+		return nil, errors.New("xmp: rdf:RDF element not found")
+	}
+
+	doc := &Document{prefixes: prefixes}
+	for _, desc := range rdf.children {
+		if !desc.is(NamespaceRDF, "Description") {
+			common.Log.Debug("XMP: unexpected element %s in rdf:RDF - ignoring", desc.name.Local)
+			continue
+		}
+		if about, ok := desc.attr(NamespaceRDF, "about"); ok && doc.About == "" {
+			doc.About = about
+		}
+		for _, p := range parseProperties(desc) {
+			if !doc.setTyped(p) {
+				doc.Properties = append(doc.Properties, p)
+			}
+		}
+	}
+	return doc, nil
+}
+
+// parseProperties returns the properties described by the attributes and child elements of `n`.
+func parseProperties(n *node) []Property {
+	var props []Property
+	for _, a := range n.propertyAttrs() {
+		props = append(props, Property{Namespace: a.Name.Space, Name: a.Name.Local, Value: NewText(a.Value)})
+	}
+	for _, child := range n.children {
+		props = append(props, Property{Namespace: child.name.Space, Name: child.name.Local, Value: parseValue(child)})
+	}
+	return props
+}
+
+// parseValue returns the value of the property element or array item `n`.
+func parseValue(n *node) Value {
+	var v Value
+	if resource, ok := n.attr(NamespaceRDF, "resource"); ok {
+		v = NewText(resource)
+	} else if parseType, _ := n.attr(NamespaceRDF, "parseType"); parseType == "Resource" {
+		v = Value{Kind: KindStruct, Fields: parseProperties(n)}
+	} else if len(n.children) > 0 {
+		child := n.children[0]
+		switch {
+		case child.is(NamespaceRDF, "Seq"):
+			v = parseArray(KindSeq, child)
+		case child.is(NamespaceRDF, "Bag"):
+			v = parseArray(KindBag, child)
+		case child.is(NamespaceRDF, "Alt"):
+			v = parseArray(KindAlt, child)
+		case child.is(NamespaceRDF, "Description"):
+			v = Value{Kind: KindStruct, Fields: parseProperties(child)}
+		default:
+			v = Value{Kind: KindStruct, Fields: parseProperties(n)}
+		}
+	} else if len(n.propertyAttrs()) > 0 {
+		v = Value{Kind: KindStruct, Fields: parseProperties(n)}
+	} else {
+		v = NewText(n.text)
+	}
+	v.Lang, _ = n.attr(NamespaceXML, "lang")
+	return v
+}
+
+// parseArray returns the array of kind `kind` with the rdf:li items of `n`.
+func parseArray(kind ValueKind, n *node) Value {
+	v := Value{Kind: kind}
+	for _, child := range n.children {
+		if !child.is(NamespaceRDF, "li") {
+			common.Log.Debug("XMP: unexpected array element %s - ignoring", child.name.Local)
+			continue
+		}
+		v.Items = append(v.Items, parseValue(child))
+	}
+	return v
+}
+
+// setTyped sets the typed field of the document corresponding to property `p`. It returns false
+// if the property has no typed field or its value does not have the expected type.
+func (d *Document) setTyped(p Property) bool {
+	v := p.Value
+	switch p.Namespace {
+	case NamespaceDC:
+		switch p.Name {
+		case "title":
+			return setLangAlt(&d.DublinCore.Title, v)
+		case "creator":
+			return setTextArray(&d.DublinCore.Creator, v)
+		case "description":
+			return setLangAlt(&d.DublinCore.Description, v)
+		case "subject":
+			return setTextArray(&d.DublinCore.Subject, v)
+		case "rights":
+			return setLangAlt(&d.DublinCore.Rights, v)
+		case "format":
+			return setText(&d.DublinCore.Format, v)
+		}
+	case NamespaceXMP:
+		switch p.Name {
+		case "CreateDate":
+			return setDate(&d.Basic.CreateDate, v)
+		case "ModifyDate":
+			return setDate(&d.Basic.ModifyDate, v)
+		case "MetadataDate":
+			return setDate(&d.Basic.MetadataDate, v)
+		case "CreatorTool":
+			return setText(&d.Basic.CreatorTool, v)
+		}
+	case NamespacePDF:
+		switch p.Name {
+		case "Producer":
+			return setText(&d.PDF.Producer, v)
+		case "Keywords":
+			return setText(&d.PDF.Keywords, v)
+		case "PDFVersion":
+			return setText(&d.PDF.PDFVersion, v)
+		case "Trapped":
+			return setText(&d.PDF.Trapped, v)
+		}
+	case NamespacePDFAID:
+		switch p.Name {
+		case "part":
+			if v.Kind != KindText || v.Lang != "" {
+				return false
+			}
+			part, err := strconv.Atoi(strings.TrimSpace(v.Text))
+			if err != nil {
+				return false
+			}
+			d.PDFAID.Part = part
+			return true
+		case "conformance":
+			return setText(&d.PDFAID.Conformance, v)
+		}
+	}
+	return false
+}
+
+// setText sets `field` to the simple value `v`.
+func setText(field *string, v Value) bool {
+	if v.Kind != KindText || v.Lang != "" {
+		return false
+	}
+	*field = v.Text
+	return true
+}
+
+// setDate sets `field` to the date value `v`.
+func setDate(field *time.Time, v Value) bool {
+	if v.Kind != KindText || v.Lang != "" {
+		return false
+	}
+	t, err := ParseDate(v.Text)
+	if err != nil {
+		common.Log.Debug("XMP: %v", err)
+		return false
+	}
+	*field = t
+	return true
+}
+
+// setTextArray sets `field` to the items of the array of simple values `v`. A simple value is
+// loaded as a single item array.
+func setTextArray(field *[]string, v Value) bool {
+	switch v.Kind {
+	case KindText:
+		*field = []string{v.Text}
+		return true
+	case KindSeq, KindBag, KindAlt:
+		items := make([]string, 0, len(v.Items))
+		for _, item := range v.Items {
+			if item.Kind != KindText {
+				return false
+			}
+			items = append(items, item.Text)
+		}
+		*field = items
+		return true
+	}
+	return false
+}
+
+// setLangAlt sets `field` to the language alternative `v`. A simple value is loaded as the
+// default item.
+func setLangAlt(field *LangAlt, v Value) bool {
+	switch v.Kind {
+	case KindText:
+		lang := v.Lang
+		if lang == "" {
+			lang = DefaultLang
+		}
+		*field = LangAlt{{Lang: lang, Text: v.Text}}
+		return true
+	case KindAlt, KindSeq, KindBag:
+		alt := make(LangAlt, 0, len(v.Items))
+		for _, item := range v.Items {
+			if item.Kind != KindText {
+				return false
+			}
+			lang := item.Lang
+			if lang == "" {
+				lang = DefaultLang
+			}
+			alt = append(alt, LangText{Lang: lang, Text: item.Text})
+		}
+		*field = alt
+		return true
+	}
+	return false
+}
@@ -0,0 +1,233 @@
+package xmp
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultPadding is the default number of padding bytes of serialized packets.
+const DefaultPadding = 2048
+
+// packetID is the id of the xpacket processing instruction.
+const packetID = "W5M0MpCehiHzreSzNTczkc9d"
+
+// MarshalOpts configures the serialization of XMP documents.
+type MarshalOpts struct {
+	// Padding is the number of whitespace bytes added at the end of the packet, so that the
+	// packet can be modified in place. Zero uses DefaultPadding and negative values disable
+	// padding.
+	Padding int
+
+	// ReadOnly marks the packet as read-only.
+	ReadOnly bool
+}
+
+// Marshal serializes the document into an XMP packet configured by `opts` (nil for defaults).
+func (d *Document) Marshal(opts *MarshalOpts) ([]byte, error) {
+	if opts == nil {
+		opts = &MarshalOpts{}
+	}
+	props := d.allProperties()
+
+	// Declare the namespaces in order of first use.
+	w := &packetWriter{
+		prefixes: map[string]string{NamespaceRDF: "rdf", NamespaceXML: "xml", namespaceX: "x"},
+		used:     map[string]bool{"rdf": true, "xml": true, "x": true},
+	}
+	var namespaces []string
+	var collect func(props []Property)
+	collect = func(props []Property) {
+		for _, p := range props {
+			if _, ok := w.prefixes[p.Namespace]; !ok {
+				w.prefixFor(p.Namespace, d.prefixes)
+				namespaces = append(namespaces, p.Namespace)
+			}
+			collectValue(p.Value, collect)
+		}
+	}
+	collect(props)
+
+	w.buf.WriteString("<?xpacket begin=\"\ufeff\" id=\"" + packetID + "\"?>\n")
+	w.buf.WriteString("<x:xmpmeta xmlns:x=\"" + namespaceX + "\">\n")
+	w.buf.WriteString(" <rdf:RDF xmlns:rdf=\"" + NamespaceRDF + "\">\n")
+	w.buf.WriteString("  <rdf:Description rdf:about=\"" + escape(d.About) + "\"")
+	for _, ns := range namespaces {
+		fmt.Fprintf(&w.buf, "\n    xmlns:%s=\"%s\"", w.prefixes[ns], escape(ns))
+	}
+	w.buf.WriteString(">\n")
+	for _, p := range props {
+		if err := w.writeValue(w.qualifiedName(p), p.Value, 3); err != nil {
+			return nil, err
+		}
+	}
+	w.buf.WriteString("  </rdf:Description>\n")
+	w.buf.WriteString(" </rdf:RDF>\n")
+	w.buf.WriteString("</x:xmpmeta>\n")
+
+	padding := opts.Padding
+	if padding == 0 {
+		padding = DefaultPadding
+	}
+	for padding > 0 {
+		n := padding
+		if n > 100 {
+			n = 100
+		}
+		w.buf.WriteString(strings.Repeat(" ", n-1) + "\n")
+		padding -= n
+	}
+
+	end := "w"
+	if opts.ReadOnly {
+		end = "r"
+	}
+	w.buf.WriteString("<?xpacket end=\"" + end + "\"?>")
+	return w.buf.Bytes(), nil
+}
+
+// collectValue calls `collect` with the structure fields of value `v`.
+func collectValue(v Value, collect func([]Property)) {
+	collect(v.Fields)
+	for _, item := range v.Items {
+		collectValue(item, collect)
+	}
+}
+
+// allProperties returns the typed fields of the document as properties, followed by Properties.
+func (d *Document) allProperties() []Property {
+	var props []Property
+	add := func(ns, name string, v Value) {
+		props = append(props, Property{Namespace: ns, Name: name, Value: v})
+	}
+	addText := func(ns, name, text string) {
+		if text != "" {
+			add(ns, name, NewText(text))
+		}
+	}
+	addArray := func(ns, name string, kind ValueKind, items []string) {
+		if len(items) > 0 {
+			add(ns, name, NewArray(kind, items...))
+		}
+	}
+	addLangAlt := func(ns, name string, alt LangAlt) {
+		if len(alt) == 0 {
+			return
+		}
+		v := Value{Kind: KindAlt}
+		for _, item := range alt {
+			lang := item.Lang
+			if lang == "" {
+				lang = DefaultLang
+			}
+			v.Items = append(v.Items, Value{Kind: KindText, Text: item.Text, Lang: lang})
+		}
+		add(ns, name, v)
+	}
+
+	dc := d.DublinCore
+	addText(NamespaceDC, "format", dc.Format)
+	addLangAlt(NamespaceDC, "title", dc.Title)
+	addArray(NamespaceDC, "creator", KindSeq, dc.Creator)
+	addLangAlt(NamespaceDC, "description", dc.Description)
+	addArray(NamespaceDC, "subject", KindBag, dc.Subject)
+	addLangAlt(NamespaceDC, "rights", dc.Rights)
+
+	basic := d.Basic
+	if !basic.CreateDate.IsZero() {
+		addText(NamespaceXMP, "CreateDate", FormatDate(basic.CreateDate))
+	}
+	if !basic.ModifyDate.IsZero() {
+		addText(NamespaceXMP, "ModifyDate", FormatDate(basic.ModifyDate))
+	}
+	if !basic.MetadataDate.IsZero() {
+		addText(NamespaceXMP, "MetadataDate", FormatDate(basic.MetadataDate))
+	}
+	addText(NamespaceXMP, "CreatorTool", basic.CreatorTool)
+
+	addText(NamespacePDF, "Producer", d.PDF.Producer)
+	addText(NamespacePDF, "Keywords", d.PDF.Keywords)
+	addText(NamespacePDF, "PDFVersion", d.PDF.PDFVersion)
+	addText(NamespacePDF, "Trapped", d.PDF.Trapped)
+
+	if d.PDFAID.Part != 0 {
+		addText(NamespacePDFAID, "part", strconv.Itoa(d.PDFAID.Part))
+	}
+	addText(NamespacePDFAID, "conformance", d.PDFAID.Conformance)
+
+	return append(props, d.Properties...)
+}
+
+// packetWriter writes the properties of an XMP packet.
+type packetWriter struct {
+	buf      bytes.Buffer
+	prefixes map[string]string // namespace URI -> prefix
+	used     map[string]bool   // used prefixes
+}
+
+// prefixFor assigns a prefix to namespace `ns`: the prefix of `preferred` or the well-known
+// prefix if available, and a generated one otherwise.
+func (w *packetWriter) prefixFor(ns string, preferred map[string]string) {
+	prefix, ok := preferred[ns]
+	if !ok || prefix == "" || w.used[prefix] {
+		prefix, ok = defaultPrefixes[ns]
+	}
+	for i := 1; !ok || prefix == "" || w.used[prefix]; i++ {
+		prefix, ok = fmt.Sprintf("ns%d", i), true
+	}
+	w.prefixes[ns] = prefix
+	w.used[prefix] = true
+}
+
+// qualifiedName returns the qualified element name of property `p`.
+func (w *packetWriter) qualifiedName(p Property) string {
+	return w.prefixes[p.Namespace] + ":" + p.Name
+}
+
+// writeValue writes the element `name` with value `v`, indented by `depth`.
+func (w *packetWriter) writeValue(name string, v Value, depth int) error {
+	indent := strings.Repeat(" ", depth)
+	w.buf.WriteString(indent + "<" + name)
+	if v.Lang != "" {
+		w.buf.WriteString(" xml:lang=\"" + escape(v.Lang) + "\"")
+	}
+
+	switch v.Kind {
+	case KindText:
+		w.buf.WriteString(">" + escape(v.Text) + "</" + name + ">\n")
+	case KindSeq, KindBag, KindAlt:
+		w.buf.WriteString(">\n")
+		w.buf.WriteString(indent + " <rdf:" + v.Kind.String() + ">\n")
+		for _, item := range v.Items {
+			if err := w.writeValue("rdf:li", item, depth+2); err != nil {
+				return err
+			}
+		}
+		w.buf.WriteString(indent + " </rdf:" + v.Kind.String() + ">\n")
+		w.buf.WriteString(indent + "</" + name + ">\n")
+	case KindStruct:
+		if len(v.Fields) == 0 {
+			w.buf.WriteString(" rdf:parseType=\"Resource\"/>\n")
+			return nil
+		}
+		w.buf.WriteString(" rdf:parseType=\"Resource\">\n")
+		for _, field := range v.Fields {
+			if err := w.writeValue(w.qualifiedName(field), field.Value, depth+1); err != nil {
+				return err
+			}
+		}
+		w.buf.WriteString(indent + "</" + name + ">\n")
+	default:
+		return fmt.Errorf("xmp: invalid value kind %s of %s", v.Kind, name)
+	}
+	return nil
+}
+
+// escape escapes the XML special characters of `s`.
+func escape(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
@@ -0,0 +1,280 @@
+package xmp
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Namespaces of the schemas supported by Document.
+const (
+	NamespaceRDF    = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	NamespaceXML    = "http://www.w3.org/XML/1998/namespace"
+	NamespaceDC     = "http://purl.org/dc/elements/1.1/"
+	NamespaceXMP    = "http://ns.adobe.com/xap/1.0/"
+	NamespacePDF    = "http://ns.adobe.com/pdf/1.3/"
+	NamespacePDFAID = "http://www.aiim.org/pdfa/ns/id/"
+
+	namespaceX = "adobe:ns:meta/"
+)
+
+// DefaultLang is the language of the default item of language alternatives.
+const DefaultLang = "x-default"
+
+// defaultPrefixes are the preferred prefixes of the well-known namespaces.
+var defaultPrefixes = map[string]string{
+	NamespaceRDF:                             "rdf",
+	NamespaceXML:                             "xml",
+	NamespaceDC:                              "dc",
+	NamespaceXMP:                             "xmp",
+	NamespacePDF:                             "pdf",
+	NamespacePDFAID:                          "pdfaid",
+	namespaceX:                               "x",
+	"http://ns.adobe.com/xap/1.0/mm/":        "xmpMM",
+	"http://ns.adobe.com/xap/1.0/rights/":    "xmpRights",
+	"http://ns.adobe.com/photoshop/1.0/":     "photoshop",
+	"http://www.aiim.org/pdfa/ns/extension/": "pdfaExtension",
+	"http://www.aiim.org/pdfa/ns/schema#":    "pdfaSchema",
+	"http://www.aiim.org/pdfa/ns/property#":  "pdfaProperty",
+}
+
+// Document is an XMP metadata document. The properties of the supported schemas are loaded into
+// typed fields; zero values denote absent properties.
+type Document struct {
+	// About is the rdf:about attribute of the described resource, usually empty.
+	About string
+
+	DublinCore DublinCore
+	Basic      Basic
+	PDF        PDF
+	PDFAID     PDFAID
+
+	// Properties are the other properties of the document, in order.
+	Properties []Property
+
+	// prefixes maps namespace URIs to the prefixes used for them.
+	prefixes map[string]string
+}
+
+// DublinCore represents properties of the Dublin Core schema (dc).
+type DublinCore struct {
+	Title       LangAlt
+	Creator     []string // ordered array (rdf:Seq)
+	Description LangAlt
+	Subject     []string // unordered array (rdf:Bag)
+	Rights      LangAlt
+	Format      string
+}
+
+// Basic represents properties of the XMP basic schema (xmp).
+type Basic struct {
+	CreateDate   time.Time
+	ModifyDate   time.Time
+	MetadataDate time.Time
+	CreatorTool  string
+}
+
+// PDF represents properties of the Adobe PDF schema (pdf).
+type PDF struct {
+	Producer   string
+	Keywords   string
+	PDFVersion string
+	Trapped    string // True, False or Unknown
+}
+
+// PDFAID represents properties of the PDF/A identification schema (pdfaid).
+type PDFAID struct {
+	Part        int    // e.g. 1 for PDF/A-1
+	Conformance string // e.g. "B"
+}
+
+// LangText is a text in the language Lang (RFC 3066 tag, or DefaultLang).
+type LangText struct {
+	Lang string
+	Text string
+}
+
+// LangAlt is a language alternative, i.e. the same text in several languages.
+type LangAlt []LangText
+
+// Get returns the text in the language `lang`.
+func (a LangAlt) Get(lang string) (string, bool) {
+	for _, item := range a {
+		if strings.EqualFold(item.Lang, lang) {
+			return item.Text, true
+		}
+	}
+	return "", false
+}
+
+// Default returns the default text, or the first one if there is no DefaultLang item.
+func (a LangAlt) Default() string {
+	if text, ok := a.Get(DefaultLang); ok {
+		return text
+	}
+	if len(a) > 0 {
+		return a[0].Text
+	}
+	return ""
+}
+
+// Set sets the text in the language `lang`. The default item is kept first.
+func (a *LangAlt) Set(lang, text string) {
+	for i, item := range *a {
+		if strings.EqualFold(item.Lang, lang) {
+			(*a)[i].Text = text
+			return
+		}
+	}
+	if lang == DefaultLang {
+		*a = append(LangAlt{{Lang: lang, Text: text}}, *a...)
+		return
+	}
+	*a = append(*a, LangText{Lang: lang, Text: text})
+}
+
+// SetDefault sets the default text.
+func (a *LangAlt) SetDefault(text string) {
+	a.Set(DefaultLang, text)
+}
+
+// ValueKind is the kind of an XMP value.
+type ValueKind int
+
+// XMP value kinds.
+const (
+	KindText   ValueKind = iota // simple value
+	KindSeq                     // ordered array
+	KindBag                     // unordered array
+	KindAlt                     // alternative array
+	KindStruct                  // structure
+)
+
+// String returns the name of the value kind.
+func (k ValueKind) String() string {
+	switch k {
+	case KindText:
+		return "Text"
+	case KindSeq:
+		return "Seq"
+	case KindBag:
+		return "Bag"
+	case KindAlt:
+		return "Alt"
+	case KindStruct:
+		return "Struct"
+	}
+	return fmt.Sprintf("ValueKind(%d)", int(k))
+}
+
+// Value is a generic XMP value.
+type Value struct {
+	Kind ValueKind
+
+	// Text is the value of KindText values.
+	Text string
+
+	// Lang is the xml:lang qualifier of the value, if any.
+	Lang string
+
+	// Items are the items of array values (KindSeq, KindBag and KindAlt).
+	Items []Value
+
+	// Fields are the fields of KindStruct values.
+	Fields []Property
+}
+
+// Property is a property of a custom namespace or of a schema not supported by Document, or a
+// field of a structure.
+type Property struct {
+	Namespace string // namespace URI
+	Name      string // local name
+	Value     Value
+}
+
+// NewText returns a simple text value.
+func NewText(text string) Value {
+	return Value{Kind: KindText, Text: text}
+}
+
+// NewArray returns an array value of kind `kind` with the text items `items`.
+func NewArray(kind ValueKind, items ...string) Value {
+	v := Value{Kind: kind}
+	for _, item := range items {
+		v.Items = append(v.Items, NewText(item))
+	}
+	return v
+}
+
+// NewDocument returns an empty XMP document.
+func NewDocument() *Document {
+	return &Document{}
+}
+
+// RegisterNamespace sets the prefix used for namespace `uri` when the document is serialized.
+// Prefixes are generated for namespaces without a registered prefix.
+func (d *Document) RegisterNamespace(prefix, uri string) {
+	if d.prefixes == nil {
+		d.prefixes = map[string]string{}
+	}
+	d.prefixes[uri] = prefix
+}
+
+// GetProperty returns the property `name` of namespace `ns` from Properties.
+func (d *Document) GetProperty(ns, name string) (Value, bool) {
+	for _, p := range d.Properties {
+		if p.Namespace == ns && p.Name == name {
+			return p.Value, true
+		}
+	}
+	return Value{}, false
+}
+
+// SetProperty sets the property `name` of namespace `ns` in Properties. Properties of the
+// supported schemas must be set with the typed fields of Document.
+func (d *Document) SetProperty(ns, name string, value Value) {
+	for i, p := range d.Properties {
+		if p.Namespace == ns && p.Name == name {
+			d.Properties[i].Value = value
+			return
+		}
+	}
+	d.Properties = append(d.Properties, Property{Namespace: ns, Name: name, Value: value})
+}
+
+// RemoveProperty removes the property `name` of namespace `ns` from Properties.
+func (d *Document) RemoveProperty(ns, name string) {
+	for i, p := range d.Properties {
+		if p.Namespace == ns && p.Name == name {
+			d.Properties = append(d.Properties[:i], d.Properties[i+1:]...)
+			return
+		}
+	}
+}
+
+// dateLayouts are the date formats of XMP (ISO 8601 subset), from the most precise.
+var dateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+}
+
+// ParseDate parses an XMP date. Dates without time zone are in UTC.
+func ParseDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid XMP date: %q", s)
+}
+
+// FormatDate formats `t` as an XMP date.
+func FormatDate(t time.Time) string {
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,156 @@
+package xmp
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testPacket = `<?xpacket begin="` + "\ufeff" + `" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/" x:xmptk="Test">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about=""
+    xmlns:xmp="http://ns.adobe.com/xap/1.0/"
+    xmlns:pdf="http://ns.adobe.com/pdf/1.3/"
+    xmp:CreatorTool="Writer &amp; Co"
+    xmp:CreateDate="2020-05-17T10:20:30+02:00"
+    pdf:Producer="Producer">
+   <xmp:ModifyDate>2021-01-02</xmp:ModifyDate>
+   <pdf:Keywords>one, two</pdf:Keywords>
+  </rdf:Description>
+  <rdf:Description rdf:about="" xmlns:dc="http://purl.org/dc/elements/1.1/">
+   <dc:format>application/pdf</dc:format>
+   <dc:title>
+    <rdf:Alt>
+     <rdf:li xml:lang="x-default">Title</rdf:li>
+     <rdf:li xml:lang="fr">Titre</rdf:li>
+    </rdf:Alt>
+   </dc:title>
+   <dc:creator><rdf:Seq><rdf:li>First</rdf:li><rdf:li>Second</rdf:li></rdf:Seq></dc:creator>
+   <dc:subject><rdf:Bag><rdf:li>a</rdf:li><rdf:li>b</rdf:li></rdf:Bag></dc:subject>
+  </rdf:Description>
+  <rdf:Description rdf:about=""
+    xmlns:pdfaid="http://www.aiim.org/pdfa/ns/id/"
+    xmlns:ex="http://example.com/ns/"
+    pdfaid:part="2" pdfaid:conformance="B">
+   <ex:link rdf:resource="http://example.com/"/>
+   <ex:info rdf:parseType="Resource">
+    <ex:name>Name</ex:name>
+    <ex:tags><rdf:Bag><rdf:li>x</rdf:li></rdf:Bag></ex:tags>
+   </ex:info>
+   <ex:short ex:value="1"/>
+   <ex:nested><rdf:Description ex:value="2"/></ex:nested>
+   <ex:history>
+    <rdf:Seq>
+     <rdf:li rdf:parseType="Resource"><ex:action>created</ex:action></rdf:li>
+    </rdf:Seq>
+   </ex:history>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>`
+
+const exampleNS = "http://example.com/ns/"
+
+func TestParse(t *testing.T) {
+	doc, err := Parse([]byte(testPacket))
+	require.NoError(t, err)
+
+	require.Equal(t, LangAlt{{"x-default", "Title"}, {"fr", "Titre"}}, doc.DublinCore.Title)
+	require.Equal(t, "Title", doc.DublinCore.Title.Default())
+	require.Equal(t, []string{"First", "Second"}, doc.DublinCore.Creator)
+	require.Equal(t, []string{"a", "b"}, doc.DublinCore.Subject)
+	require.Equal(t, "application/pdf", doc.DublinCore.Format)
+	require.Equal(t, "Writer & Co", doc.Basic.CreatorTool)
+	require.True(t, doc.Basic.CreateDate.Equal(time.Date(2020, 5, 17, 8, 20, 30, 0, time.UTC)))
+	require.True(t, doc.Basic.ModifyDate.Equal(time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC)))
+	require.Equal(t, "Producer", doc.PDF.Producer)
+	require.Equal(t, "one, two", doc.PDF.Keywords)
+	require.Equal(t, PDFAID{Part: 2, Conformance: "B"}, doc.PDFAID)
+
+	expected := []Property{
+		{exampleNS, "link", NewText("http://example.com/")},
+		{exampleNS, "info", Value{Kind: KindStruct, Fields: []Property{
+			{exampleNS, "name", NewText("Name")},
+			{exampleNS, "tags", NewArray(KindBag, "x")},
+		}}},
+		{exampleNS, "short", Value{Kind: KindStruct, Fields: []Property{{exampleNS, "value", NewText("1")}}}},
+		{exampleNS, "nested", Value{Kind: KindStruct, Fields: []Property{{exampleNS, "value", NewText("2")}}}},
+		{exampleNS, "history", Value{Kind: KindSeq, Items: []Value{
+			{Kind: KindStruct, Fields: []Property{{exampleNS, "action", NewText("created")}}},
+		}}},
+	}
+	require.Equal(t, expected, doc.Properties)
+
+	_, err = Parse([]byte("<x:xmpmeta xmlns:x=\"adobe:ns:meta/\"/>"))
+	require.Error(t, err)
+	_, err = Parse([]byte("<rdf:RDF"))
+	require.Error(t, err)
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	doc, err := Parse([]byte(testPacket))
+	require.NoError(t, err)
+	doc.DublinCore.Title.Set("de", "Titel")
+	doc.DublinCore.Description.SetDefault("<Description>")
+	doc.Basic.MetadataDate = time.Date(2022, 3, 4, 5, 6, 7, 0, time.UTC)
+	doc.SetProperty(exampleNS, "link", NewText("http://example.org/"))
+	doc.RemoveProperty(exampleNS, "short")
+	doc.SetProperty("http://other.example.com/", "lang", Value{Kind: KindText, Text: "Hallo", Lang: "de"})
+
+	data, err := doc.Marshal(nil)
+	require.NoError(t, err)
+	require.True(t, bytes.HasPrefix(data, []byte("<?xpacket begin=\"\ufeff\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>")))
+	require.True(t, bytes.HasSuffix(data, []byte("<?xpacket end=\"w\"?>")))
+	require.Contains(t, string(data), "xmlns:ex=\""+exampleNS+"\"")
+	require.Contains(t, string(data), "xmlns:ns1=\"http://other.example.com/\"")
+
+	parsed, err := Parse(data)
+	require.NoError(t, err)
+	require.Equal(t, doc.DublinCore, parsed.DublinCore)
+	require.Equal(t, doc.PDF, parsed.PDF)
+	require.Equal(t, doc.PDFAID, parsed.PDFAID)
+	require.Equal(t, doc.Properties, parsed.Properties)
+	require.True(t, doc.Basic.CreateDate.Equal(parsed.Basic.CreateDate))
+	require.True(t, doc.Basic.MetadataDate.Equal(parsed.Basic.MetadataDate))
+
+	link, ok := parsed.GetProperty(exampleNS, "link")
+	require.True(t, ok)
+	require.Equal(t, "http://example.org/", link.Text)
+	_, ok = parsed.GetProperty(exampleNS, "short")
+	require.False(t, ok)
+}
+
+func TestMarshalPadding(t *testing.T) {
+	doc := NewDocument()
+	doc.DublinCore.Title.SetDefault("Title")
+
+	padded, err := doc.Marshal(nil)
+	require.NoError(t, err)
+	unpadded, err := doc.Marshal(&MarshalOpts{Padding: -1, ReadOnly: true})
+	require.NoError(t, err)
+	require.Equal(t, len(unpadded)+DefaultPadding, len(padded))
+	require.True(t, bytes.HasSuffix(unpadded, []byte("</x:xmpmeta>\n<?xpacket end=\"r\"?>")))
+
+	custom, err := doc.Marshal(&MarshalOpts{Padding: 150})
+	require.NoError(t, err)
+	require.Equal(t, len(unpadded)+150, len(custom))
+}
+
+func TestParseDate(t *testing.T) {
+	for s, expected := range map[string]time.Time{
+		"2019":                      time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC),
+		"2019-02":                   time.Date(2019, 2, 1, 0, 0, 0, 0, time.UTC),
+		"2019-02-03T04:05Z":         time.Date(2019, 2, 3, 4, 5, 0, 0, time.UTC),
+		"2019-02-03T04:05:06.5Z":    time.Date(2019, 2, 3, 4, 5, 6, 5e8, time.UTC),
+		"2019-02-03T04:05:06-01:00": time.Date(2019, 2, 3, 5, 5, 6, 0, time.UTC),
+	} {
+		date, err := ParseDate(s)
+		require.NoError(t, err, s)
+		require.True(t, expected.Equal(date), s)
+	}
+	_, err := ParseDate("yesterday")
+	require.Error(t, err)
+}
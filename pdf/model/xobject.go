@@ -401,12 +401,21 @@ func NewXObjectImageFromStream(stream *core.PdfObjectStream) (*XObjectImage, err
 		return nil, errors.New("height missing")
 	}
 
+	jpxEnc, isJPX := encoder.(*core.JPXEncoder)
+
 	if obj := core.TraceToDirectObject(dict.Get("ColorSpace")); obj != nil {
 		cs, err := NewPdfColorspaceFromPdfObject(obj)
 		if err != nil {
 			return nil, err
 		}
 		img.ColorSpace = cs
+	} else if isJPX && jpxEnc.ColorSpace != nil {
+		// JPX images may omit the colorspace and use the one specified in the JPEG 2000 data.
+		cs, err := NewPdfColorspaceFromPdfObject(jpxEnc.ColorSpace)
+		if err != nil {
+			return nil, err
+		}
+		img.ColorSpace = cs
 	} else {
 		// If not specified, assume gray..
 		common.Log.Debug("XObject Image colorspace not specified - assuming 1 color component")
@@ -420,6 +429,9 @@ func NewXObjectImageFromStream(stream *core.PdfObjectStream) (*XObjectImage, err
 		}
 		iVal := int64(*iObj)
 		img.BitsPerComponent = &iVal
+	} else if isJPX && jpxEnc.BitsPerComponent > 0 {
+		iVal := int64(jpxEnc.BitsPerComponent)
+		img.BitsPerComponent = &iVal
 	}
 
 	img.Intent = dict.Get("Intent")
@@ -521,11 +533,29 @@ func (ximg *XObjectImage) ToImage() (*Image, error) {
 
 	image.ColorComponents = ximg.ColorSpace.GetNumComponents()
 
-	decoded, err := core.DecodeStream(ximg.primitive)
-	if err != nil {
-		return nil, err
+	if jpxEnc, ok := ximg.Filter.(*core.JPXEncoder); ok {
+		// The dimensions and sample precision of JPX images are given by the JPEG 2000 data,
+		// which may also be decoded at a reduced resolution.
+		decoded, err := jpxEnc.DecodeImage(ximg.Stream)
+		if err != nil {
+			return nil, err
+		}
+		image.Width = int64(decoded.Width)
+		image.Height = int64(decoded.Height)
+		image.BitsPerComponent = int64(decoded.BitsPerComponent)
+		image.ColorComponents = decoded.ColorComponents
+		image.Data = decoded.Data
+		if jpxEnc.SMaskInData > 0 && decoded.Alpha != nil {
+			image.alphaData = decoded.Alpha
+			image.hasAlpha = true
+		}
+	} else {
+		decoded, err := core.DecodeStream(ximg.primitive)
+		if err != nil {
+			return nil, err
+		}
+		image.Data = decoded
 	}
-	image.Data = decoded
 
 	if ximg.Decode != nil {
 		darr, ok := ximg.Decode.(*core.PdfObjectArray)